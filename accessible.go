@@ -0,0 +1,61 @@
+package porcupine
+
+import (
+	"html/template"
+	"strings"
+)
+
+type accessibleRow struct {
+	Index       int
+	ClientId    int
+	Start       int64
+	End         int64
+	Description string
+	// position in the longest partial linearization, starting from 1, or 0
+	// if the operation isn't part of it
+	Order int
+}
+
+type accessibleTable struct {
+	Partition int
+	Rows      []accessibleRow
+}
+
+// computeAccessibleTables lists the operations of each partition, in the
+// order of the visualization data.
+func computeAccessibleTables(data visualizationData) []accessibleTable {
+	tables := make([]accessibleTable, len(data.Partitions))
+	for p, partition := range data.Partitions {
+		order := make(map[int]int)
+		if len(partition.PartialLinearizations) > 0 {
+			// the longest linearization is first
+			for i, step := range partition.PartialLinearizations[0] {
+				order[step.Index] = i + 1
+			}
+		}
+		rows := make([]accessibleRow, len(partition.History))
+		for i, elem := range partition.History {
+			rows[i] = accessibleRow{
+				Index:       i,
+				ClientId:    elem.ClientId,
+				Start:       elem.Start,
+				End:         elem.End,
+				Description: elem.Description,
+				Order:       order[i],
+			}
+		}
+		tables[p] = accessibleTable{Partition: p, Rows: rows}
+	}
+	return tables
+}
+
+var accessibleTablesTemplate = template.Must(template.ParseFS(visualizationFS, "visualization/tables.html"))
+
+func renderAccessibleTables(data visualizationData) (template.HTML, error) {
+	var b strings.Builder
+	err := accessibleTablesTemplate.Execute(&b, computeAccessibleTables(data))
+	if err != nil {
+		return "", err
+	}
+	return template.HTML(b.String()), nil
+}
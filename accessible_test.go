@@ -0,0 +1,70 @@
+package porcupine
+
+import (
+	"bytes"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestAccessibleTables(t *testing.T) {
+	ops := []Operation{
+		{0, kvInput{op: 1, key: "x", value: "<y>"}, 0, kvOutput{}, 10},
+		{1, kvInput{op: 0, key: "x"}, 20, kvOutput{"z"}, 30},
+		{2, kvInput{op: 1, key: "y", value: "a very long value"}, 0, kvOutput{}, 10},
+	}
+	res, info := CheckOperationsVerbose(kvModel, ops, 0)
+	if res != Illegal {
+		t.Fatalf("expected output %v, got output %v", Illegal, res)
+	}
+	opts := VisualizationOptions{MaxDescriptionLength: 15}
+	tables := computeAccessibleTables(computeVisualizationData(kvModel, info, opts))
+	expected := []accessibleTable{{
+		Partition: 0,
+		Rows: []accessibleRow{
+			{Index: 0, ClientId: 0, Start: 0, End: 10, Description: "put('x', '<y>')", Order: 1},
+			{Index: 1, ClientId: 1, Start: 20, End: 30, Description: "get('x') -> 'z'", Order: 0},
+		},
+	}, {
+		Partition: 1,
+		Rows: []accessibleRow{
+			{Index: 0, ClientId: 2, Start: 0, End: 10, Description: "put('y', 'a ve…", Order: 1},
+		},
+	}}
+	if !reflect.DeepEqual(expected, tables) {
+		t.Fatalf("expected tables \n%v\n, got \n%v", expected, tables)
+	}
+
+	var buf bytes.Buffer
+	opts.AccessibleTables = true
+	err := VisualizeWithOptions(kvModel, info, &buf, opts)
+	if err != nil {
+		t.Fatalf("visualization failed: %v", err)
+	}
+	out := buf.String()
+	if strings.Count(out, `<table class="operations">`) != 2 {
+		t.Fatalf("expected 2 tables, got %q", out)
+	}
+	if !strings.Contains(out, "<td>put(&#39;x&#39;, &#39;&lt;y&gt;&#39;)</td>") || !strings.Contains(out, "<td>yes (position 1)</td>") {
+		t.Fatalf("expected table to contain escaped operations, got %q", out)
+	}
+
+	buf.Reset()
+	opts.StaticLayout = true
+	err = VisualizeWithOptions(kvModel, info, &buf, opts)
+	if err != nil {
+		t.Fatalf("visualization failed: %v", err)
+	}
+	if strings.Count(buf.String(), `<table class="operations">`) != 2 {
+		t.Fatalf("expected static visualization to contain 2 tables, got %q", buf.String())
+	}
+
+	buf.Reset()
+	err = Visualize(kvModel, info, &buf)
+	if err != nil {
+		t.Fatalf("visualization failed: %v", err)
+	}
+	if strings.Contains(buf.String(), "<table") {
+		t.Fatal("expected no tables by default")
+	}
+}
@@ -0,0 +1,223 @@
+package porcupine
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"reflect"
+	"strings"
+	"sync"
+	"unsafe"
+)
+
+// An AnonymizerFunc returns anonymized copies of the input and output of an
+// operation. It is called with a nil output for pending operations.
+type AnonymizerFunc func(input, output interface{}) (interface{}, interface{})
+
+// AnonymizeHistory returns a copy of a history with the input and output of
+// every operation replaced by fn, such as [Anonymizer.Anonymize], so that the
+// history can be shared without the data it contains. The operations keep
+// their client ids and timestamps.
+func AnonymizeHistory(ops []Operation, fn AnonymizerFunc) []Operation {
+	anonymized := make([]Operation, len(ops))
+	for i, op := range ops {
+		op.Input, op.Output = fn(op.Input, op.Output)
+		anonymized[i] = op
+	}
+	return anonymized
+}
+
+// An Anonymizer replaces values with opaque tokens, so that equal values get
+// equal tokens, and different values get different tokens. Values are
+// anonymized in namespaces, which have independent tokens, so that, for
+// example, the tokens of keys don't reveal which keys are equal to values.
+//
+// Since equality is preserved, a history anonymized with an Anonymizer has
+// the same verdict as the original one for models that only compare values
+// for equality, such as registers, key-value stores with puts and gets, and
+// sets. It is safe for concurrent use by multiple goroutines.
+type Anonymizer struct {
+	mu         sync.Mutex
+	namespaces map[string]*anonymizerNamespace
+}
+
+type anonymizerNamespace struct {
+	strings   map[string]string
+	ints      map[int64]int64
+	originals map[string]interface{} // from token to original value
+}
+
+// NewAnonymizer returns an anonymizer that hasn't seen any values.
+func NewAnonymizer() *Anonymizer {
+	return &Anonymizer{namespaces: make(map[string]*anonymizerNamespace)}
+}
+
+func (a *Anonymizer) namespace(name string) *anonymizerNamespace {
+	ns, ok := a.namespaces[name]
+	if !ok {
+		ns = &anonymizerNamespace{
+			strings:   make(map[string]string),
+			ints:      make(map[int64]int64),
+			originals: make(map[string]interface{}),
+		}
+		a.namespaces[name] = ns
+	}
+	return ns
+}
+
+// String returns the token of a string in a namespace: the namespace's name
+// followed by a number, in the order in which the anonymizer first saw the
+// namespace's strings. The empty string is its own token, since models often
+// use it to represent a missing value.
+func (a *Anonymizer) String(namespace, s string) string {
+	if s == "" {
+		return s
+	}
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	ns := a.namespace(namespace)
+	token, ok := ns.strings[s]
+	if !ok {
+		token = fmt.Sprintf("%s%d", namespace, len(ns.strings)+1)
+		ns.strings[s] = token
+		ns.originals[token] = s
+	}
+	return token
+}
+
+// Bytes returns the token of a byte slice in a namespace, which is the token
+// of the equivalent string.
+func (a *Anonymizer) Bytes(namespace string, b []byte) []byte {
+	if len(b) == 0 {
+		return b
+	}
+	return []byte(a.String(namespace, string(b)))
+}
+
+// Int returns the token of an integer in a namespace: a positive number, in
+// the order in which the anonymizer first saw the namespace's integers. 0 is
+// its own token, since models often use it to represent a missing value.
+// Tokens don't preserve the order of integers.
+func (a *Anonymizer) Int(namespace string, n int64) int64 {
+	if n == 0 {
+		return n
+	}
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	ns := a.namespace(namespace)
+	token, ok := ns.ints[n]
+	if !ok {
+		token = int64(len(ns.ints) + 1)
+		ns.ints[n] = token
+		ns.originals[fmt.Sprint(token)] = n
+	}
+	return token
+}
+
+// Anonymize is an [AnonymizerFunc] that anonymizes the strings, byte slices,
+// and values of kind int contained in an input and an output, including in
+// struct fields, exported or not, and in slices, maps, pointers, and
+// interfaces. Other values, such as bools and other kinds of integers, which
+// are often used for operation types, are kept.
+//
+// Map keys, and struct fields whose name ends with "key" or "Key", with
+// everything they contain, are anonymized in the "key" namespace, and
+// everything else in the "value" namespace.
+func (a *Anonymizer) Anonymize(input, output interface{}) (interface{}, interface{}) {
+	return a.anonymizeInterface("value", input), a.anonymizeInterface("value", output)
+}
+
+func (a *Anonymizer) anonymizeInterface(namespace string, v interface{}) interface{} {
+	if v == nil {
+		return nil
+	}
+	return a.anonymizeValue(namespace, reflect.ValueOf(v)).Interface()
+}
+
+func (a *Anonymizer) anonymizeValue(namespace string, v reflect.Value) reflect.Value {
+	t := v.Type()
+	switch v.Kind() {
+	case reflect.String:
+		return reflect.ValueOf(a.String(namespace, v.String())).Convert(t)
+	case reflect.Int:
+		return reflect.ValueOf(int(a.Int(namespace, v.Int()))).Convert(t)
+	case reflect.Slice:
+		if v.IsNil() {
+			return v
+		}
+		if t.Elem().Kind() == reflect.Uint8 {
+			return reflect.ValueOf(a.Bytes(namespace, v.Bytes())).Convert(t)
+		}
+		out := reflect.MakeSlice(t, v.Len(), v.Len())
+		for i := 0; i < v.Len(); i++ {
+			out.Index(i).Set(a.anonymizeValue(namespace, v.Index(i)))
+		}
+		return out
+	case reflect.Array:
+		out := reflect.New(t).Elem()
+		for i := 0; i < v.Len(); i++ {
+			out.Index(i).Set(a.anonymizeValue(namespace, v.Index(i)))
+		}
+		return out
+	case reflect.Map:
+		if v.IsNil() {
+			return v
+		}
+		out := reflect.MakeMapWithSize(t, v.Len())
+		iter := v.MapRange()
+		for iter.Next() {
+			out.SetMapIndex(a.anonymizeValue("key", iter.Key()), a.anonymizeValue(namespace, iter.Value()))
+		}
+		return out
+	case reflect.Ptr:
+		if v.IsNil() {
+			return v
+		}
+		out := reflect.New(t.Elem())
+		out.Elem().Set(a.anonymizeValue(namespace, v.Elem()))
+		return out
+	case reflect.Interface:
+		if v.IsNil() {
+			return v
+		}
+		out := reflect.New(t).Elem()
+		out.Set(a.anonymizeValue(namespace, v.Elem()))
+		return out
+	case reflect.Struct:
+		out := reflect.New(t).Elem()
+		out.Set(v)
+		for i := 0; i < t.NumField(); i++ {
+			field := out.Field(i)
+			if !field.CanSet() {
+				// unexported fields can't be set through reflection,
+				// but they hold data that must be anonymized too
+				field = reflect.NewAt(field.Type(), unsafe.Pointer(field.UnsafeAddr())).Elem()
+			}
+			ns := namespace
+			if name := t.Field(i).Name; strings.HasSuffix(name, "key") || strings.HasSuffix(name, "Key") {
+				ns = "key"
+			}
+			field.Set(a.anonymizeValue(ns, field))
+		}
+		return out
+	default:
+		return v
+	}
+}
+
+// WriteMapping writes the mapping from tokens back to the original values as
+// JSON, as an object with a member for each namespace, which maps tokens to
+// the values they replace. The mapping reveals the anonymized data, so it
+// should be kept private, such as by writing it to a separate file, or
+// through a writer that encrypts it.
+func (a *Anonymizer) WriteMapping(w io.Writer) error {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	mapping := make(map[string]map[string]interface{}, len(a.namespaces))
+	for name, ns := range a.namespaces {
+		mapping[name] = ns.originals
+	}
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(mapping)
+}
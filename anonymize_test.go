@@ -0,0 +1,90 @@
+package porcupine
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"testing"
+)
+
+func TestAnonymizeJepsen(t *testing.T) {
+	for _, logNum := range []int{0, 2, 5, 7} {
+		events := parseJepsenLog(fmt.Sprintf("test_data/jepsen/etcd_%03d.log", logNum))
+		ops, err := EventsToOperations(events)
+		if err != nil {
+			t.Fatal(err)
+		}
+		anonymized := AnonymizeHistory(ops, NewAnonymizer().Anonymize)
+		changed := false
+		for i := range ops {
+			if ops[i].Call != anonymized[i].Call || ops[i].Return != anonymized[i].Return || ops[i].ClientId != anonymized[i].ClientId {
+				t.Fatalf("expected operation %d to keep its timestamps and client", i)
+			}
+			changed = changed || ops[i].Input != anonymized[i].Input
+		}
+		if !changed {
+			t.Fatalf("etcd_%03d: expected inputs to be anonymized", logNum)
+		}
+		expected := CheckOperations(etcdModel, ops)
+		if res := CheckOperations(etcdModel, anonymized); res != expected {
+			t.Fatalf("etcd_%03d: expected verdict %t, got %t", logNum, expected, res)
+		}
+	}
+}
+
+type anonymizeInput struct {
+	Key    string
+	value  []byte
+	count  int
+	op     uint8
+	tags   map[string]*int
+	nested interface{}
+}
+
+func TestAnonymizer(t *testing.T) {
+	a := NewAnonymizer()
+	one, two := 42, 7
+	input := anonymizeInput{
+		Key:    "user@example.com",
+		value:  []byte("user@example.com"),
+		count:  42,
+		op:     3,
+		tags:   map[string]*int{"secret": &one, "": &two},
+		nested: []string{"secret", ""},
+	}
+	in, out := a.Anonymize(input, "secret")
+	got := in.(anonymizeInput)
+	// keys and values are anonymized independently
+	if got.Key != "key1" || string(got.value) != "value1" {
+		t.Fatalf("unexpected key and value %q, %q", got.Key, got.value)
+	}
+	if got.count != 1 || got.op != 3 {
+		t.Fatalf("expected ints to be anonymized and other integers kept, got %d, %d", got.count, got.op)
+	}
+	if *got.tags["key2"] != 1 || *got.tags[""] != 2 || len(got.tags) != 2 {
+		t.Fatalf("unexpected map %v", got.tags)
+	}
+	if !reflect.DeepEqual(got.nested, []string{"value2", ""}) || out != "value2" {
+		t.Fatalf("expected equal values to get equal tokens, got %v, %v", got.nested, out)
+	}
+	// the original is not modified
+	if input.Key != "user@example.com" || string(input.value) != "user@example.com" || *input.tags["secret"] != 42 {
+		t.Fatalf("expected original to be unchanged, got %+v", input)
+	}
+	if in, out := a.Anonymize(nil, nil); in != nil || out != nil {
+		t.Fatal("expected nil to stay nil")
+	}
+
+	var buf bytes.Buffer
+	if err := a.WriteMapping(&buf); err != nil {
+		t.Fatal(err)
+	}
+	var mapping map[string]map[string]interface{}
+	if err := json.Unmarshal(buf.Bytes(), &mapping); err != nil {
+		t.Fatal(err)
+	}
+	if mapping["key"]["key2"] != "secret" || mapping["value"]["value1"] != "user@example.com" || mapping["value"]["1"] != float64(42) {
+		t.Fatalf("unexpected mapping %s", buf.String())
+	}
+}
@@ -0,0 +1,171 @@
+package porcupine
+
+import (
+	"fmt"
+	"math"
+	"sync"
+)
+
+// In arena mode (see CheckOptions.ArenaAllocation), the cache of a search
+// doesn't hold its entries in a map of slices, whose slice headers, keys,
+// and states the garbage collector scans at every cycle for as long as the
+// partition is being checked. A cacheSlab keeps the entries in chunks of
+// structs without pointers, linked into a hash table by their indices, the
+// words of their keys in chunks of words, and only their states in chunks
+// that hold pointers. An entry takes 24 bytes, and 16 more for its state,
+// where it takes 48 in a bucket of the map, along with the map's own
+// overhead. The chunks come from pools, and go back to them all at once
+// when the search is done.
+
+// slabChunkShift is the log2 of the number of entries in a chunk.
+const slabChunkShift = 12
+
+var (
+	slabEntryChunks = sync.Pool{New: func() interface{} { c := make([]slabEntry, 1<<slabChunkShift); return &c }}
+	slabStateChunks = sync.Pool{New: func() interface{} { c := make([]interface{}, 1<<slabChunkShift); return &c }}
+)
+
+type slabEntry struct {
+	chunk uint32 // of the words of the key
+	off   uint32 // of the words of the key in their chunk
+	n     uint32 // number of words in the key
+	low   uint32
+	top   uint32 // top bits of the mixed hash, to relink the entry and skip most keys
+	next  int32  // index of the next entry in the same bucket, or -1
+}
+
+type cacheSlab struct {
+	alloc   *searchAllocator
+	heads   []int32 // index of the first entry of each bucket, or -1
+	shift   uint    // the bucket of a hash is the top bits of it, mixed; at least 32
+	count   int
+	entries []*[]slabEntry
+	states  []*[]interface{}
+	words   [][]uint64 // chunks of words, of which the last one is filling
+	used    int        // words used in the last chunk
+}
+
+func newCacheSlab(alloc *searchAllocator, size int) *cacheSlab {
+	s := &cacheSlab{alloc: alloc, shift: 63}
+	for 1<<(64-s.shift) < size && s.shift > 32 {
+		s.shift--
+	}
+	s.heads = make([]int32, 1<<(64-s.shift))
+	for i := range s.heads {
+		s.heads[i] = -1
+	}
+	return s
+}
+
+// top returns the top bits of a hash, which pick its bucket. Hashes that mix
+// in no words or states are small, so they're mixed again, to spread them
+// into the top bits.
+func top(hash uint64) uint32 {
+	return uint32(mixHash(hash, 0) >> 32)
+}
+
+func (s *cacheSlab) bucket(top uint32) uint32 {
+	return top >> (s.shift - 32)
+}
+
+func (s *cacheSlab) entry(i int32) *slabEntry {
+	return &(*s.entries[i>>slabChunkShift])[i&(1<<slabChunkShift-1)]
+}
+
+func (s *cacheSlab) state(i int32) interface{} {
+	return (*s.states[i>>slabChunkShift])[i&(1<<slabChunkShift-1)]
+}
+
+func (s *cacheSlab) key(e *slabEntry) linearizedKey {
+	return linearizedKey{e.low, s.words[e.chunk][e.off : e.off+e.n : e.off+e.n]}
+}
+
+// find returns whether the slab holds the state, reached with the given
+// set of linearized operations, where hash and fast are from h.
+func (s *cacheSlab) find(h *stateHasher, hash uint64, linearized linearizedKey, state interface{}, fast bool) bool {
+	t := top(hash)
+	for i := s.heads[s.bucket(t)]; i >= 0; {
+		e := s.entry(i)
+		if e.top == t && e.low == linearized.low && s.key(e).equals(linearized) && h.equal(state, s.state(i), fast) {
+			return true
+		}
+		i = e.next
+	}
+	return false
+}
+
+// add adds the state to the slab, with a copy of linearized, where hash is
+// from a stateHasher.
+func (s *cacheSlab) add(hash uint64, linearized linearizedKey, state interface{}) {
+	if s.count == math.MaxInt32 {
+		panic(fmt.Sprintf("porcupine: the cache of a partition reached %d states, the most that arena allocation supports", s.count))
+	}
+	i := int32(s.count)
+	if s.count>>slabChunkShift == len(s.entries) {
+		entries := slabEntryChunks.Get().(*[]slabEntry)
+		states := slabStateChunks.Get().(*[]interface{})
+		s.entries = append(s.entries, entries)
+		s.states = append(s.states, states)
+		s.alloc.slabEntryChunks = append(s.alloc.slabEntryChunks, entries)
+		s.alloc.slabStateChunks = append(s.alloc.slabStateChunks, states)
+	}
+	s.count++
+	e := s.entry(i)
+	*e = slabEntry{low: linearized.low, n: uint32(len(linearized.words)), top: top(hash)}
+	e.chunk, e.off = s.copyWords(linearized.words)
+	(*s.states[i>>slabChunkShift])[i&(1<<slabChunkShift-1)] = state
+	if s.count > len(s.heads) && s.shift > 32 {
+		s.grow()
+		return
+	}
+	// entries go at the end of their bucket, to be compared in the order
+	// they were added, as they are in a map of slices
+	e.next = -1
+	link := &s.heads[s.bucket(e.top)]
+	for *link >= 0 {
+		link = &s.entry(*link).next
+	}
+	*link = i
+}
+
+// copyWords copies words to the last chunk of words, or to a new one if
+// they don't fit, and returns where they are.
+func (s *cacheSlab) copyWords(words []uint64) (uint32, uint32) {
+	if len(s.words) == 0 || s.used+len(words) > len(s.words[len(s.words)-1]) {
+		var chunk []uint64
+		if len(words) > chunkSize {
+			chunk = make([]uint64, len(words))
+		} else {
+			c := wordChunks.Get().(*[]uint64)
+			s.alloc.wordChunks = append(s.alloc.wordChunks, c)
+			chunk = *c
+		}
+		s.words = append(s.words, chunk)
+		s.used = 0
+	}
+	off := s.used
+	s.used += copy(s.words[len(s.words)-1][off:], words)
+	return uint32(len(s.words) - 1), uint32(off)
+}
+
+// grow doubles the number of buckets and relinks every entry, from the last
+// one, so that each bucket is still in the order its entries were added.
+func (s *cacheSlab) grow() {
+	s.shift--
+	s.heads = make([]int32, 1<<(64-s.shift))
+	for i := range s.heads {
+		s.heads[i] = -1
+	}
+	for i := int32(s.count) - 1; i >= 0; i-- {
+		e := s.entry(i)
+		e.next = s.heads[s.bucket(e.top)]
+		s.heads[s.bucket(e.top)] = i
+	}
+}
+
+// each calls f with every entry of the slab.
+func (s *cacheSlab) each(f func(linearized linearizedKey, state interface{})) {
+	for i := int32(0); i < int32(s.count); i++ {
+		f(s.key(s.entry(i)), s.state(i))
+	}
+}
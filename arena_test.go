@@ -0,0 +1,163 @@
+package porcupine
+
+import (
+	"fmt"
+	"math/rand"
+	"os"
+	"reflect"
+	"runtime"
+	"runtime/metrics"
+	"sort"
+	"testing"
+	"time"
+)
+
+func TestCacheSlab(t *testing.T) {
+	alloc := searchAllocator{arena: true}
+	defer alloc.release()
+	rng := rand.New(rand.NewSource(1))
+	n := 2000
+	order := &opOrder{rank: make([]uint32, n), id: make([]uint32, n)}
+	for i := range order.id {
+		order.rank[i], order.id[i] = uint32(i), uint32(i)
+	}
+	for _, fastType := range []reflect.Type{reflect.TypeOf(0), nil} {
+		model := Model{Equal: func(state1, state2 interface{}) bool { return state1 == state2 }}
+		cache := newStateCache(model, &alloc, fastType, order)
+		// enough entries that the slab grows, with keys of all sizes
+		// and some states reached with the same operations
+		type added struct {
+			linearized bitset
+			state      int
+		}
+		var all []added
+		for len(all) < 20000 {
+			linearized := newBitset(uint(n))
+			for i, count := 0, rng.Intn(n); i < count; i++ {
+				linearized.set(uint(rng.Intn(n)))
+			}
+			for j, states := 0, 1+rng.Intn(3); j < states; j++ {
+				state := rng.Intn(4)
+				if cache.insert(order.key(linearized), state) {
+					all = append(all, added{linearized, state})
+				} else if !cache.contains(order.key(linearized), state) {
+					t.Fatal("expected a state that wasn't inserted to be cached")
+				}
+			}
+		}
+		for _, e := range all {
+			if !cache.contains(order.key(e.linearized), e.state) {
+				t.Fatalf("expected %v to be cached", e.state)
+			}
+			if cache.contains(order.key(e.linearized), 4) {
+				t.Fatal("expected a state that wasn't added not to be cached")
+			}
+		}
+		if entries := cache.all(); len(entries) != len(all) {
+			t.Fatalf("expected %d entries, got %d", len(all), len(entries))
+		}
+	}
+}
+
+// TestArenaAllocation checks that arena mode doesn't change the search, which
+// makes the same steps and reaches the same states either way.
+func TestArenaAllocation(t *testing.T) {
+	type history struct {
+		name   string
+		model  Model
+		events []Event
+	}
+	var histories []history
+	for i := 0; i < 20; i++ {
+		filename := fmt.Sprintf("test_data/jepsen/etcd_%03d.log", i)
+		if _, err := os.Stat(filename); err != nil {
+			continue
+		}
+		histories = append(histories, history{filename, etcdModel, parseJepsenLog(filename)})
+	}
+	for _, log := range []string{"c01-ok", "c01-bad", "c10-ok", "c10-bad"} {
+		events := parseKvLog(fmt.Sprintf("test_data/kv/%s.txt", log))
+		histories = append(histories, history{log, kvModel, events}, history{log + " with Equal", withEqual(kvModel), events})
+	}
+	histories = append(histories, history{"c50-ok", kvModel, parseKvLog("test_data/kv/c50-ok.txt")})
+	ops := randomRegisterHistory(rand.New(rand.NewSource(1)), 5, 20000)
+	histories = append(histories, history{"register", registerModel, OperationsToEvents(ops)})
+	for _, h := range histories {
+		res, info := CheckEventsWithOptions(h.model, h.events, CheckOptions{})
+		arenaRes, arenaInfo := CheckEventsWithOptions(h.model, h.events, CheckOptions{ArenaAllocation: true})
+		if arenaRes != res {
+			t.Fatalf("%s: expected output %v, got output %v", h.name, res, arenaRes)
+		}
+		// the kv model partitions in a different order every time
+		summaries, arenaSummaries := searchSummaries(info), searchSummaries(arenaInfo)
+		for i := range summaries {
+			if arenaSummaries[i] != summaries[i] {
+				t.Fatalf("%s: got partition %s in arena mode, expected %s", h.name, arenaSummaries[i], summaries[i])
+			}
+		}
+	}
+}
+
+// searchSummaries returns a sorted summary of the search of each partition.
+func searchSummaries(info LinearizationInfo) []string {
+	var summaries []string
+	for _, p := range info.Partitions() {
+		summaries = append(summaries, fmt.Sprintf("%v with %d operations, %d linearized, %d steps, %d states", p.Result, p.Operations, p.Linearized, p.Steps, p.States))
+	}
+	sort.Strings(summaries)
+	return summaries
+}
+
+// BenchmarkArenaAllocation compares the peak memory and the time spent in GC
+// of checking the c50 key-value history with and without arena mode. Peak
+// memory is sampled from the memory that the runtime holds, which is about
+// its RSS, and includes whatever the pools held from earlier checks.
+func BenchmarkArenaAllocation(b *testing.B) {
+	events := parseKvLog("test_data/kv/c50-ok.txt")
+	for _, arena := range []bool{false, true} {
+		b.Run(fmt.Sprintf("arena=%t", arena), func(b *testing.B) {
+			runtime.GC()
+			stop := make(chan struct{})
+			peak := samplePeakMemory(stop)
+			var before, after runtime.MemStats
+			runtime.ReadMemStats(&before)
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				if res, _ := CheckEventsWithOptions(kvModel, events, CheckOptions{ArenaAllocation: arena}); res != Ok {
+					b.Fatalf("expected output %v, got output %v", Ok, res)
+				}
+			}
+			b.StopTimer()
+			runtime.ReadMemStats(&after)
+			close(stop)
+			b.ReportMetric(float64(<-peak)/(1<<20), "peak-MB")
+			b.ReportMetric(float64(after.PauseTotalNs-before.PauseTotalNs)/float64(b.N), "gc-pause-ns/op")
+			b.ReportMetric(float64(after.NumGC-before.NumGC)/float64(b.N), "gcs/op")
+		})
+	}
+}
+
+// samplePeakMemory samples the memory that the runtime holds from the OS
+// until stop is closed, and then sends the largest sample.
+func samplePeakMemory(stop <-chan struct{}) <-chan uint64 {
+	peak := make(chan uint64, 1)
+	samples := []metrics.Sample{{Name: "/memory/classes/total:bytes"}, {Name: "/memory/classes/heap/released:bytes"}}
+	go func() {
+		var max uint64
+		ticker := time.NewTicker(time.Millisecond)
+		defer ticker.Stop()
+		for {
+			metrics.Read(samples)
+			if held := samples[0].Value.Uint64() - samples[1].Value.Uint64(); held > max {
+				max = held
+			}
+			select {
+			case <-stop:
+				peak <- max
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+	return peak
+}
@@ -0,0 +1,97 @@
+package porcupine
+
+import (
+	"io"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// A FileError records an error writing a file, along with the stage that
+// failed: "create" (creating the file or its parent directories), "render"
+// (writing the contents), or "rename" (moving the file into place).
+type FileError struct {
+	Stage string
+	Path  string
+	Err   error
+}
+
+func (e *FileError) Error() string {
+	return "porcupine: " + e.Stage + " " + e.Path + ": " + e.Err.Error()
+}
+
+func (e *FileError) Unwrap() error {
+	return e.Err
+}
+
+// tempFile is the subset of *os.File used to write files atomically.
+type tempFile interface {
+	io.Writer
+	Name() string
+	Chmod(mode os.FileMode) error
+	Sync() error
+	Close() error
+}
+
+// createTempFile creates the temporary files used by writeFileAtomic; tests
+// replace it to inject failures.
+var createTempFile = func(dir, pattern string) (tempFile, error) {
+	return createTemp(dir, pattern)
+}
+
+// createTemp creates a new file like os.CreateTemp, with a random string in
+// place of the last "*" in pattern, but with the permissions that os.Create
+// gives it, 0666 less the umask, rather than 0600.
+func createTemp(dir, pattern string) (*os.File, error) {
+	prefix, suffix := pattern, ""
+	if i := strings.LastIndex(pattern, "*"); i >= 0 {
+		prefix, suffix = pattern[:i], pattern[i+1:]
+	}
+	for try := 0; ; try++ {
+		name := filepath.Join(dir, prefix+strconv.FormatUint(uint64(rand.Uint32()), 10)+suffix)
+		f, err := os.OpenFile(name, os.O_RDWR|os.O_CREATE|os.O_EXCL, 0666)
+		if os.IsExist(err) && try < 10000 {
+			continue
+		}
+		return f, err
+	}
+}
+
+// writeFileAtomic writes a file using the given function. The file is
+// written to a temporary file in the same directory, which is synced and
+// renamed to the given path once it has been written successfully, so an
+// error never leaves behind a truncated file. Like os.WriteFile, it keeps the
+// permissions of a file that it replaces, and gives a new file 0666 less the
+// umask. Errors are returned as a *FileError.
+func writeFileAtomic(path string, write func(w io.Writer) error) error {
+	f, err := createTempFile(filepath.Dir(path), "."+filepath.Base(path)+".tmp*")
+	if err != nil {
+		return &FileError{Stage: "create", Path: path, Err: err}
+	}
+	tmpPath := f.Name()
+	stage := "create"
+	if fi, statErr := os.Stat(path); statErr == nil && fi.Mode().IsRegular() {
+		err = f.Chmod(fi.Mode().Perm())
+	}
+	if err == nil {
+		stage = "render"
+		err = write(f)
+	}
+	if err == nil {
+		err = f.Sync()
+	}
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		stage = "rename"
+		err = os.Rename(tmpPath, path)
+	}
+	if err != nil {
+		os.Remove(tmpPath)
+		return &FileError{Stage: stage, Path: path, Err: err}
+	}
+	return nil
+}
@@ -0,0 +1,165 @@
+package porcupine
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func visualizeTestInfo() LinearizationInfo {
+	_, info := CheckOperationsVerbose(registerModel, []Operation{{0, registerInput{false, 100}, 0, 0, 100}}, 0)
+	return info
+}
+
+func expectFileError(t *testing.T, err error, stage, path string) *FileError {
+	t.Helper()
+	var fileErr *FileError
+	if !errors.As(err, &fileErr) {
+		t.Fatalf("expected a *FileError, got %v", err)
+	}
+	if fileErr.Stage != stage || fileErr.Path != path {
+		t.Fatalf("expected error in stage %q for %s, got %v", stage, path, err)
+	}
+	return fileErr
+}
+
+func expectEmptyDir(t *testing.T, dir string) {
+	t.Helper()
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 0 {
+		t.Fatalf("expected no files to be left behind, found %v", entries)
+	}
+}
+
+func TestVisualizePathMissingParent(t *testing.T) {
+	info := visualizeTestInfo()
+	path := filepath.Join(t.TempDir(), "a", "b", "out.html")
+	err := VisualizePath(registerModel, info, path)
+	fileErr := expectFileError(t, err, "create", path)
+	if !errors.Is(fileErr, os.ErrNotExist) {
+		t.Fatalf("expected error to wrap os.ErrNotExist, got %v", fileErr.Err)
+	}
+
+	err = VisualizePathWithOptions(registerModel, info, path, VisualizationOptions{CreateDirs: true})
+	if err != nil {
+		t.Fatalf("visualization failed: %v", err)
+	}
+	if _, err := os.Stat(path); err != nil {
+		t.Fatalf("expected visualization to be written: %v", err)
+	}
+}
+
+func TestVisualizePathPermissionDenied(t *testing.T) {
+	if os.Geteuid() == 0 {
+		t.Skip("permissions are not enforced for root")
+	}
+	dir := t.TempDir()
+	err := os.Chmod(dir, 0555)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Chmod(dir, 0755)
+	path := filepath.Join(dir, "out.html")
+	err = VisualizePath(registerModel, visualizeTestInfo(), path)
+	fileErr := expectFileError(t, err, "create", path)
+	if !errors.Is(fileErr, os.ErrPermission) {
+		t.Fatalf("expected error to wrap os.ErrPermission, got %v", fileErr.Err)
+	}
+}
+
+func TestVisualizePathRenameError(t *testing.T) {
+	dir := t.TempDir()
+	// a non-empty directory can't be replaced by a file
+	path := filepath.Join(dir, "out.html")
+	err := os.MkdirAll(filepath.Join(path, "child"), 0755)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = VisualizePath(registerModel, visualizeTestInfo(), path)
+	expectFileError(t, err, "rename", path)
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 1 {
+		t.Fatalf("expected temporary file to be removed, found %v", entries)
+	}
+}
+
+type failingFile struct {
+	tempFile
+}
+
+var errInjected = errors.New("injected write error")
+
+func (f failingFile) Write(p []byte) (int, error) {
+	return 0, errInjected
+}
+
+func TestVisualizePathWriteError(t *testing.T) {
+	orig := createTempFile
+	defer func() { createTempFile = orig }()
+	createTempFile = func(dir, pattern string) (tempFile, error) {
+		f, err := orig(dir, pattern)
+		if err != nil {
+			return nil, err
+		}
+		return failingFile{f}, nil
+	}
+	dir := t.TempDir()
+	path := filepath.Join(dir, "out.html")
+	err := VisualizePath(registerModel, visualizeTestInfo(), path)
+	fileErr := expectFileError(t, err, "render", path)
+	if !errors.Is(fileErr, errInjected) {
+		t.Fatalf("expected error to wrap the write error, got %v", fileErr.Err)
+	}
+	expectEmptyDir(t, dir)
+}
+
+func TestVisualizePathMode(t *testing.T) {
+	dir := t.TempDir()
+	// a new file gets the permissions that os.Create gives it, with the
+	// umask applied
+	created := filepath.Join(dir, "created")
+	f, err := os.Create(created)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.Close()
+	expected, err := os.Stat(created)
+	if err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(dir, "out.html")
+	if err := VisualizePath(registerModel, visualizeTestInfo(), path); err != nil {
+		t.Fatal(err)
+	}
+	fi, err := os.Stat(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if fi.Mode() != expected.Mode() {
+		t.Fatalf("expected mode %v, got %v", expected.Mode(), fi.Mode())
+	}
+
+	// and a file that is replaced keeps its permissions
+	if err := os.Chmod(path, 0600); err != nil {
+		t.Fatal(err)
+	}
+	if expected, err = os.Stat(path); err != nil {
+		t.Fatal(err)
+	}
+	if err := VisualizePath(registerModel, visualizeTestInfo(), path); err != nil {
+		t.Fatal(err)
+	}
+	if fi, err = os.Stat(path); err != nil {
+		t.Fatal(err)
+	}
+	if fi.Mode() != expected.Mode() {
+		t.Fatalf("expected mode %v, got %v", expected.Mode(), fi.Mode())
+	}
+}
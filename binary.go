@@ -0,0 +1,276 @@
+package porcupine
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// The binary history format starts with a header, binaryMagic followed by
+// the format version as a uvarint, and then contains one record per
+// operation, until the end of the file:
+//
+//	varint  ClientId
+//	varint  Call
+//	varint  Return
+//	value   Input
+//	value   Output
+//
+// A value starts with a uvarint tag: 0 for a nil value, 1 to define a new
+// type, followed by the length-prefixed name of the type, which is assigned
+// the next index in the file's type table, and 2+i to refer to the type at
+// index i in the table. Non-nil values are followed by their length-prefixed
+// JSON encoding, as produced by [MarshalHistory].
+const (
+	binaryMagic   = "PCPNHIST"
+	binaryVersion = 1
+
+	binaryTagNil     = 0
+	binaryTagNewType = 1
+	binaryTagType    = 2
+
+	// maximum length of a type name or an encoded value, to avoid huge
+	// allocations when reading malformed input
+	binaryMaxLength = 1 << 26
+)
+
+// WriteHistory writes a history of operations to w in a compact binary
+// format, which can be read back with [ReadHistory]. Like [MarshalHistory],
+// it requires the types of all inputs and outputs to be registered with
+// [RegisterType].
+func WriteHistory(w io.Writer, history []Operation) error {
+	bw := bufio.NewWriter(w)
+	e := binaryEncoder{w: bw, types: make(map[string]int)}
+	e.writeBytes([]byte(binaryMagic))
+	e.writeUvarint(binaryVersion)
+	for i, op := range history {
+		e.writeVarint(int64(op.ClientId))
+		e.writeVarint(op.Call)
+		e.writeVarint(op.Return)
+		if err := e.writeValue(op.Input); err != nil {
+			return fmt.Errorf("%w (input of operation %d)", err, i)
+		}
+		if err := e.writeValue(op.Output); err != nil {
+			return fmt.Errorf("%w (output of operation %d)", err, i)
+		}
+		if e.err != nil {
+			return e.err
+		}
+	}
+	if e.err != nil {
+		return e.err
+	}
+	return bw.Flush()
+}
+
+type binaryEncoder struct {
+	w     *bufio.Writer
+	types map[string]int
+	buf   [binary.MaxVarintLen64]byte
+	err   error
+}
+
+func (e *binaryEncoder) writeBytes(b []byte) {
+	if e.err == nil {
+		_, e.err = e.w.Write(b)
+	}
+}
+
+func (e *binaryEncoder) writeUvarint(x uint64) {
+	n := binary.PutUvarint(e.buf[:], x)
+	e.writeBytes(e.buf[:n])
+}
+
+func (e *binaryEncoder) writeVarint(x int64) {
+	n := binary.PutVarint(e.buf[:], x)
+	e.writeBytes(e.buf[:n])
+}
+
+func (e *binaryEncoder) writeString(b []byte) {
+	e.writeUvarint(uint64(len(b)))
+	e.writeBytes(b)
+}
+
+func (e *binaryEncoder) writeValue(value interface{}) error {
+	tv, err := encodeValue(value)
+	if err != nil {
+		return err
+	}
+	if tv == nil {
+		e.writeUvarint(binaryTagNil)
+		return nil
+	}
+	if index, ok := e.types[tv.Type]; ok {
+		e.writeUvarint(uint64(binaryTagType + index))
+	} else {
+		e.types[tv.Type] = len(e.types)
+		e.writeUvarint(binaryTagNewType)
+		e.writeString([]byte(tv.Type))
+	}
+	e.writeString(tv.Value)
+	return nil
+}
+
+// A HistoryReader reads operations one at a time from a history written by
+// [WriteHistory], so that large histories can be processed without loading
+// them into memory all at once. Its interface follows bufio.Scanner:
+//
+//	hr := porcupine.ReadHistory(r)
+//	for hr.Next() {
+//		op := hr.Operation()
+//		...
+//	}
+//	if err := hr.Err(); err != nil {
+//		...
+//	}
+type HistoryReader struct {
+	r       *bufio.Reader
+	started bool
+	types   []string
+	op      Operation
+	err     error
+}
+
+// ReadHistory returns a reader for the history in r. The header is read on
+// the first call to [HistoryReader.Next].
+func ReadHistory(r io.Reader) *HistoryReader {
+	return &HistoryReader{r: bufio.NewReader(r)}
+}
+
+// ReadAllHistory reads an entire history written by [WriteHistory].
+func ReadAllHistory(r io.Reader) ([]Operation, error) {
+	hr := ReadHistory(r)
+	var history []Operation
+	for hr.Next() {
+		history = append(history, hr.Operation())
+	}
+	return history, hr.Err()
+}
+
+// Next reads the next operation, which is then available through
+// [HistoryReader.Operation]. It returns false when it reaches the end of the
+// history or an error, after which [HistoryReader.Err] returns the error, if
+// any.
+func (hr *HistoryReader) Next() bool {
+	if hr.err != nil {
+		return false
+	}
+	if !hr.started {
+		hr.started = true
+		if hr.err = hr.readHeader(); hr.err != nil {
+			return false
+		}
+	}
+	// a clean EOF between records is the end of the history
+	if _, err := hr.r.Peek(1); err == io.EOF {
+		hr.err = io.EOF
+		return false
+	}
+	op, err := hr.readOperation()
+	if err != nil {
+		if err == io.EOF {
+			err = io.ErrUnexpectedEOF
+		}
+		hr.err = fmt.Errorf("porcupine: reading operation: %w", err)
+		return false
+	}
+	hr.op = op
+	return true
+}
+
+// Operation returns the operation read by the most recent call to
+// [HistoryReader.Next].
+func (hr *HistoryReader) Operation() Operation {
+	return hr.op
+}
+
+// Err returns the first error that was encountered by the reader, or nil if
+// it reached the end of the history.
+func (hr *HistoryReader) Err() error {
+	if hr.err == io.EOF {
+		return nil
+	}
+	return hr.err
+}
+
+func (hr *HistoryReader) readHeader() error {
+	magic := make([]byte, len(binaryMagic))
+	if _, err := io.ReadFull(hr.r, magic); err != nil || string(magic) != binaryMagic {
+		return errors.New("porcupine: not a binary history")
+	}
+	version, err := binary.ReadUvarint(hr.r)
+	if err != nil {
+		return fmt.Errorf("porcupine: reading history version: %w", err)
+	}
+	if version != binaryVersion {
+		return fmt.Errorf("porcupine: unsupported binary history version %d", version)
+	}
+	return nil
+}
+
+func (hr *HistoryReader) readOperation() (Operation, error) {
+	var op Operation
+	clientId, err := binary.ReadVarint(hr.r)
+	if err != nil {
+		return op, err
+	}
+	op.ClientId = int(clientId)
+	if op.Call, err = binary.ReadVarint(hr.r); err != nil {
+		return op, err
+	}
+	if op.Return, err = binary.ReadVarint(hr.r); err != nil {
+		return op, err
+	}
+	if op.Input, err = hr.readValue(); err != nil {
+		return op, err
+	}
+	if op.Output, err = hr.readValue(); err != nil {
+		return op, err
+	}
+	return op, nil
+}
+
+func (hr *HistoryReader) readString() ([]byte, error) {
+	n, err := binary.ReadUvarint(hr.r)
+	if err != nil {
+		return nil, err
+	}
+	if n > binaryMaxLength {
+		return nil, fmt.Errorf("length %d is too large", n)
+	}
+	b := make([]byte, n)
+	if _, err := io.ReadFull(hr.r, b); err != nil {
+		return nil, err
+	}
+	return b, nil
+}
+
+func (hr *HistoryReader) readValue() (interface{}, error) {
+	tag, err := binary.ReadUvarint(hr.r)
+	if err != nil {
+		return nil, err
+	}
+	var name string
+	switch {
+	case tag == binaryTagNil:
+		return nil, nil
+	case tag == binaryTagNewType:
+		b, err := hr.readString()
+		if err != nil {
+			return nil, err
+		}
+		name = string(b)
+		hr.types = append(hr.types, name)
+	case tag-binaryTagType < uint64(len(hr.types)):
+		name = hr.types[tag-binaryTagType]
+	default:
+		return nil, fmt.Errorf("undefined type index %d", tag-binaryTagType)
+	}
+	data, err := hr.readString()
+	if err != nil {
+		return nil, err
+	}
+	return decodeValue(&typedValue{Type: name, Value: data})
+}
@@ -0,0 +1,27 @@
+//go:build go1.18
+// +build go1.18
+
+package porcupine
+
+import (
+	"bytes"
+	"testing"
+)
+
+func FuzzReadHistory(f *testing.F) {
+	ops := []Operation{
+		{0, codecRegisterInput{false, 100}, 0, 0, 100},
+		{1, codecRegisterInput{true, 0}, 25, 100, 75},
+		{2, codecRegisterInput{true, 0}, 30, nil, 80},
+	}
+	var buf bytes.Buffer
+	if err := WriteHistory(&buf, ops); err != nil {
+		f.Fatal(err)
+	}
+	f.Add(buf.Bytes())
+	f.Add([]byte(binaryMagic))
+	f.Fuzz(func(t *testing.T, data []byte) {
+		// malformed input must produce an error, not a panic
+		ReadAllHistory(bytes.NewReader(data))
+	})
+}
@@ -0,0 +1,97 @@
+package porcupine
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+	"testing"
+)
+
+func TestBinaryHistory(t *testing.T) {
+	ops := []Operation{
+		{0, codecRegisterInput{false, 100}, 0, 0, 100},
+		{-1, codecRegisterInput{true, 0}, 25, 100, 75},
+		{2, codecRegisterInput{true, 0}, 30, nil, 80}, // pending
+	}
+	var buf bytes.Buffer
+	if err := WriteHistory(&buf, ops); err != nil {
+		t.Fatal(err)
+	}
+	decoded, err := ReadAllHistory(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(decoded) != len(ops) {
+		t.Fatalf("expected %v, got %v", ops, decoded)
+	}
+	for i := range ops {
+		if decoded[i] != ops[i] {
+			t.Fatalf("expected %v, got %v", ops, decoded)
+		}
+	}
+}
+
+func TestBinaryHistoryVerdicts(t *testing.T) {
+	for _, logName := range []string{"c01-bad", "c01-ok", "c10-bad", "c10-ok"} {
+		ops, err := EventsToOperations(parseKvLog(fmt.Sprintf("test_data/kv/%s.txt", logName)))
+		if err != nil {
+			t.Fatalf("%s: %v", logName, err)
+		}
+		var buf bytes.Buffer
+		if err := WriteHistory(&buf, ops); err != nil {
+			t.Fatalf("%s: %v", logName, err)
+		}
+		json, err := MarshalHistory(ops)
+		if err != nil {
+			t.Fatalf("%s: %v", logName, err)
+		}
+		if buf.Len() >= len(json)/2 {
+			t.Fatalf("%s: expected binary history (%d bytes) to be much smaller than JSON (%d bytes)", logName, buf.Len(), len(json))
+		}
+		hr := ReadHistory(&buf)
+		var decoded []Operation
+		for hr.Next() {
+			decoded = append(decoded, hr.Operation())
+		}
+		if err := hr.Err(); err != nil {
+			t.Fatalf("%s: %v", logName, err)
+		}
+		if len(decoded) != len(ops) {
+			t.Fatalf("%s: expected %d operations, got %d", logName, len(ops), len(decoded))
+		}
+		if CheckOperations(kvModel, decoded) != CheckOperations(kvModel, ops) {
+			t.Fatalf("%s: expected decoded operations to have the same verdict", logName)
+		}
+	}
+}
+
+func TestBinaryHistoryErrors(t *testing.T) {
+	ops := []Operation{{0, codecRegisterInput{false, 100}, 0, 0, 100}}
+	var buf bytes.Buffer
+	if err := WriteHistory(&buf, ops); err != nil {
+		t.Fatal(err)
+	}
+	valid := buf.Bytes()
+
+	tests := []struct {
+		name string
+		data []byte
+		err  string
+	}{
+		{"empty", nil, "not a binary history"},
+		{"bad magic", []byte("NOTAHISTORY"), "not a binary history"},
+		{"future version", append([]byte(binaryMagic), 2), "unsupported binary history version 2"},
+		{"truncated", valid[:len(valid)-2], "unexpected EOF"},
+		{"undefined type", append(append([]byte(binaryMagic), 1), 0, 0, 0, 5), "undefined type index 3"},
+	}
+	for _, test := range tests {
+		_, err := ReadAllHistory(bytes.NewReader(test.data))
+		if err == nil || !strings.Contains(err.Error(), test.err) {
+			t.Fatalf("%s: expected error containing %q, got %v", test.name, test.err, err)
+		}
+	}
+
+	if err := WriteHistory(&buf, []Operation{{0, registerInput{true, 0}, 0, 0, 1}}); err == nil || !strings.Contains(err.Error(), "porcupine.registerInput") {
+		t.Fatalf("expected error naming the unregistered type, got %v", err)
+	}
+}
@@ -38,6 +38,23 @@ func (b bitset) clear(pos uint) bitset {
 	return b
 }
 
+func (b bitset) get(pos uint) bool {
+	major, minor := bitsetIndex(pos)
+	return b[major]&(1<<minor) != 0
+}
+
+func (b bitset) equals(b2 bitset) bool {
+	if len(b) != len(b2) {
+		return false
+	}
+	for i := range b {
+		if b[i] != b2[i] {
+			return false
+		}
+	}
+	return true
+}
+
 func (b bitset) popcnt() uint {
 	total := 0
 	for _, v := range b {
@@ -46,22 +63,61 @@ func (b bitset) popcnt() uint {
 	return uint(total)
 }
 
-func (b bitset) hash() uint64 {
-	hash := uint64(b.popcnt())
-	for _, v := range b {
-		hash ^= v
+// bitsetPageShift is the log2 of the number of words in a page of a
+// pagedBitset: 256 KiB, or about two million bits.
+const bitsetPageShift = 15
+
+// A pagedBitset is a bitset split into pages, so that the bitset of a
+// partition with hundreds of millions of operations doesn't take one
+// contiguous allocation of hundreds of megabytes.
+type pagedBitset struct {
+	pages []bitset
+	shift uint // log2 of the number of words in a page
+	words uint // in all the pages
+}
+
+func newPagedBitset(bits uint, shift uint) pagedBitset {
+	words := (bits + 63) / 64
+	b := pagedBitset{shift: shift, words: words}
+	for start := uint(0); start < words; start += 1 << shift {
+		size := words - start
+		if size > 1<<shift {
+			size = 1 << shift
+		}
+		b.pages = append(b.pages, make(bitset, size))
 	}
-	return hash
+	return b
 }
 
-func (b bitset) equals(b2 bitset) bool {
-	if len(b) != len(b2) {
-		return false
+func (b pagedBitset) word(i uint) uint64 {
+	return b.pages[i>>b.shift][i&(1<<b.shift-1)]
+}
+
+func (b pagedBitset) set(pos uint) {
+	major, minor := bitsetIndex(pos)
+	b.pages[major>>b.shift][major&(1<<b.shift-1)] |= 1 << minor
+}
+
+func (b pagedBitset) clear(pos uint) {
+	major, minor := bitsetIndex(pos)
+	b.pages[major>>b.shift][major&(1<<b.shift-1)] &^= 1 << minor
+}
+
+// slice returns the words from start to end, which are in the bitset itself
+// if they're in one page, and copied to *buf otherwise.
+func (b pagedBitset) slice(start, end uint, buf *[]uint64) []uint64 {
+	if start == end {
+		return nil
 	}
-	for i := range b {
-		if b[i] != b2[i] {
-			return false
-		}
+	if start>>b.shift == (end-1)>>b.shift {
+		page := b.pages[start>>b.shift]
+		first, last := start&(1<<b.shift-1), (end-1)&(1<<b.shift-1)+1
+		return page[first:last:last]
 	}
-	return true
+	words := (*buf)[:0]
+	for i := start; i < end; i++ {
+		words = append(words, b.word(i))
+	}
+	*buf = words
+	return words[:len(words):len(words)]
 }
@@ -0,0 +1,302 @@
+package porcupine
+
+import (
+	"math"
+	"reflect"
+)
+
+// fastStateType returns the type of the model's initial state if the checker
+// can compare states of that type with == and hash them, instead of calling
+// Equal: if the model doesn't define Equal, and the type is comparable
+// without holding anything that might not be, such as an interface. It
+// returns nil otherwise.
+func fastStateType(model Model) reflect.Type {
+	if model.Equal != nil {
+		return nil
+	}
+	t := reflect.TypeOf(model.Init())
+	if t == nil || !alwaysComparable(t) {
+		return nil
+	}
+	return t
+}
+
+// alwaysComparable returns whether all values of a type can be compared with
+// == and used as map keys.
+func alwaysComparable(t reflect.Type) bool {
+	switch t.Kind() {
+	case reflect.Interface, reflect.Slice, reflect.Map, reflect.Func:
+		return false
+	case reflect.Array:
+		return alwaysComparable(t.Elem())
+	case reflect.Struct:
+		for i := 0; i < t.NumField(); i++ {
+			if !alwaysComparable(t.Field(i).Type) {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// A stateCache holds the states that checkSingle has reached, along with the
+// set of operations that were linearized to reach each one (see
+// linearizedKey).
+//
+// States of the fast type, and of any other type that is always comparable,
+// are compared with ==, without calling the model's Equal function, and
+// common types of states are hashed along with the operations, so that states
+// reached with the same operations don't all land in the same bucket. Other
+// states are compared with Equal. A state that takes the fast path is never
+// equal to one that doesn't with ==, since their types differ.
+type stateCache struct {
+	stateHasher
+	alloc   *searchAllocator
+	order   *opOrder
+	entries map[uint64][]cachedState // map from hash to cache entries
+	slab    *cacheSlab               // the entries instead, in arena mode
+}
+
+// A cachedState holds the fields of its linearizedKey itself, so that the
+// reach fits in the space that the key leaves over.
+type cachedState struct {
+	low   uint32
+	reach uint32 // for the incremental checker, see setReach
+	words []uint64
+	state interface{}
+}
+
+func (e *cachedState) key() linearizedKey {
+	return linearizedKey{e.low, e.words}
+}
+
+func newStateCache(model Model, alloc *searchAllocator, fastType reflect.Type, order *opOrder) *stateCache {
+	c := &stateCache{
+		stateHasher: stateHasher{model: model, fastType: fastType},
+		alloc:       alloc,
+		order:       order,
+	}
+	if alloc.arena {
+		c.slab = newCacheSlab(alloc, len(order.id))
+	} else {
+		c.entries = make(map[uint64][]cachedState, len(order.id))
+	}
+	return c
+}
+
+// hash returns the hash of a state reached with the given operations, and
+// whether the state takes the fast path.
+func (c *stateCache) hash(linearized linearizedKey, state interface{}) (uint64, bool) {
+	return c.hashState(linearized.hash(), state)
+}
+
+// A stateHasher hashes and compares states, taking the fast path for
+// comparable states, as described for [stateCache].
+type stateHasher struct {
+	model     Model
+	fastType  reflect.Type          // nil if the fast path is disabled
+	fastTypes map[reflect.Type]bool // whether other types of states are fast
+}
+
+// hashState mixes the hash of a state into hash, and returns whether the
+// state takes the fast path.
+func (c *stateHasher) hashState(hash uint64, state interface{}) (uint64, bool) {
+	if c.fastType == nil {
+		return hash, false
+	}
+	switch s := state.(type) {
+	case int:
+		return mixHash(hash, uint64(s)), true
+	case int64:
+		return mixHash(hash, uint64(s)), true
+	case uint64:
+		return mixHash(hash, s), true
+	case bool:
+		if s {
+			return mixHash(hash, 1), true
+		}
+		return mixHash(hash, 0), true
+	case string:
+		return mixHash(hash, stringHash(s)), true
+	}
+	return hash, c.isFast(state)
+}
+
+// mixHash mixes v into hash, multiplying by a large odd constant to spread
+// the bits of small values, such as consecutive integers.
+func mixHash(hash, v uint64) uint64 {
+	return (hash ^ v) * 0x9e3779b97f4a7c15
+}
+
+// stringHash is a cheap hash of a string, from its length and up to 8 bytes
+// at each end, which doesn't need to look at all of a long string.
+func stringHash(s string) uint64 {
+	hash := uint64(len(s))
+	for i := 0; i < len(s) && i < 8; i++ {
+		hash = hash<<8 | uint64(s[i])
+	}
+	for i := len(s) - 1; i >= 8 && i >= len(s)-8; i-- {
+		hash = mixHash(hash, uint64(s[i]))
+	}
+	return hash
+}
+
+func (c *stateHasher) isFast(state interface{}) bool {
+	t := reflect.TypeOf(state)
+	if t == c.fastType {
+		return true
+	}
+	if t == nil {
+		return false
+	}
+	fast, ok := c.fastTypes[t]
+	if !ok {
+		fast = alwaysComparable(t)
+		if c.fastTypes == nil {
+			c.fastTypes = make(map[reflect.Type]bool)
+		}
+		c.fastTypes[t] = fast
+	}
+	return fast
+}
+
+// equal returns whether two states are equal, where fast is whether the
+// first one takes the fast path.
+func (c *stateHasher) equal(state1, state2 interface{}, fast bool) bool {
+	if fast {
+		return state1 == state2
+	}
+	return c.model.Equal(state1, state2)
+}
+
+// contains returns whether the cache holds the state, reached with the given
+// set of linearized operations.
+func (c *stateCache) contains(linearized linearizedKey, state interface{}) bool {
+	hash, fast := c.hash(linearized, state)
+	if c.slab != nil {
+		return c.slab.find(&c.stateHasher, hash, linearized, state, fast)
+	}
+	bucket := c.entries[hash]
+	for i := range bucket {
+		if linearized.equals(bucket[i].key()) && c.equal(state, bucket[i].state, fast) {
+			return true
+		}
+	}
+	return false
+}
+
+// add adds the state to the cache, with a copy of linearized.
+func (c *stateCache) add(linearized linearizedKey, state interface{}) {
+	hash, _ := c.hash(linearized, state)
+	if c.slab != nil {
+		c.slab.add(hash, linearized, state)
+		return
+	}
+	c.entries[hash] = c.alloc.appendCacheEntry(c.entries[hash], c.newEntry(linearized, state))
+}
+
+func (c *stateCache) newEntry(linearized linearizedKey, state interface{}) cachedState {
+	return cachedState{low: linearized.low, words: c.alloc.cloneWords(linearized.words), state: state}
+}
+
+// insert adds the state to the cache, like add, unless the cache holds it
+// already, and returns whether it added it.
+func (c *stateCache) insert(linearized linearizedKey, state interface{}) bool {
+	hash, fast := c.hash(linearized, state)
+	if c.slab != nil {
+		if c.slab.find(&c.stateHasher, hash, linearized, state, fast) {
+			return false
+		}
+		c.slab.add(hash, linearized, state)
+		return true
+	}
+	bucket := c.entries[hash]
+	for i := range bucket {
+		if linearized.equals(bucket[i].key()) && c.equal(state, bucket[i].state, fast) {
+			return false
+		}
+	}
+	c.entries[hash] = c.alloc.appendCacheEntry(bucket, c.newEntry(linearized, state))
+	return true
+}
+
+// The incremental checker keeps the cache of a partition between searches,
+// and records in each entry the reach of the state: the latest return, by its
+// rank among the returns of the partition, that was the earliest one pending
+// in a state that the search reached from it. States whose search hasn't
+// finished have unfinishedReach. The incremental checker doesn't use arena
+// mode, so these methods only handle the map.
+
+// unfinishedReach is the reach of a state whose search hasn't finished.
+const unfinishedReach = math.MaxUint32
+
+// insertReach adds the state to the cache with unfinishedReach, unless the
+// cache holds it already, and returns its reach then, and whether it added
+// it.
+func (c *stateCache) insertReach(linearized linearizedKey, state interface{}) (uint32, bool) {
+	hash, fast := c.hash(linearized, state)
+	bucket := c.entries[hash]
+	for i := range bucket {
+		if linearized.equals(bucket[i].key()) && c.equal(state, bucket[i].state, fast) {
+			return bucket[i].reach, false
+		}
+	}
+	e := c.newEntry(linearized, state)
+	e.reach = unfinishedReach
+	c.entries[hash] = c.alloc.appendCacheEntry(bucket, e)
+	return 0, true
+}
+
+// setReach sets the reach of a state whose search finished, and adds it to
+// the cache if prune removed it while it was on the path of the search.
+func (c *stateCache) setReach(linearized linearizedKey, state interface{}, reach uint32) {
+	hash, fast := c.hash(linearized, state)
+	bucket := c.entries[hash]
+	for i := range bucket {
+		if linearized.equals(bucket[i].key()) && c.equal(state, bucket[i].state, fast) {
+			bucket[i].reach = reach
+			return
+		}
+	}
+	e := c.newEntry(linearized, state)
+	e.reach = reach
+	c.entries[hash] = c.alloc.appendCacheEntry(bucket, e)
+}
+
+// prune removes the states with a reach of at least the given one.
+func (c *stateCache) prune(reach uint32) {
+	for hash, bucket := range c.entries {
+		kept := bucket[:0]
+		for _, e := range bucket {
+			if e.reach < reach {
+				kept = append(kept, e)
+			}
+		}
+		if len(kept) == 0 {
+			delete(c.entries, hash)
+			continue
+		}
+		for i := len(kept); i < len(bucket); i++ {
+			bucket[i] = cachedState{}
+		}
+		c.entries[hash] = kept
+	}
+}
+
+// all returns copies of the entries of the cache, with their operations as
+// bitsets of their ids, to save them.
+func (c *stateCache) all() []cacheEntry {
+	var entries []cacheEntry
+	if c.slab != nil {
+		c.slab.each(func(linearized linearizedKey, state interface{}) {
+			entries = append(entries, cacheEntry{c.order.bitset(linearized), state})
+		})
+		return entries
+	}
+	for _, bucket := range c.entries {
+		for i := range bucket {
+			entries = append(entries, cacheEntry{c.order.bitset(bucket[i].key()), bucket[i].state})
+		}
+	}
+	return entries
+}
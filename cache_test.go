@@ -0,0 +1,143 @@
+package porcupine
+
+import (
+	"fmt"
+	"os"
+	"reflect"
+	"testing"
+)
+
+// withEqual returns the model with an Equal function that's the same as the
+// default, which disables the fast path for comparable states.
+func withEqual(model Model) Model {
+	model.Equal = func(state1, state2 interface{}) bool {
+		return state1 == state2
+	}
+	return model
+}
+
+func TestFastStateType(t *testing.T) {
+	for _, model := range []Model{registerModel, etcdModel, kvModel} {
+		if fastStateType(model) == nil {
+			t.Fatalf("expected %T states to take the fast path", model.Init())
+		}
+		if fastStateType(withEqual(model)) != nil {
+			t.Fatal("expected Equal to disable the fast path")
+		}
+	}
+	for _, init := range []interface{}{struct {
+		a int
+		b [2]string
+	}{}, new(int)} {
+		if fastStateType(Model{Init: func() interface{} { return init }}) == nil {
+			t.Fatalf("expected %T states to take the fast path", init)
+		}
+	}
+	for _, init := range []interface{}{nil, map[string]int{}, []int{}, struct{ x interface{} }{1}} {
+		if fastStateType(Model{Init: func() interface{} { return init }}) != nil {
+			t.Fatalf("expected %T states not to take the fast path", init)
+		}
+	}
+}
+
+func TestStateCacheMixedTypes(t *testing.T) {
+	var alloc searchAllocator
+	defer alloc.release()
+	model := Model{Equal: func(state1, state2 interface{}) bool { return reflect.DeepEqual(state1, state2) }}
+	order := &opOrder{rank: []uint32{0, 1, 2}, id: []uint32{0, 1, 2}}
+	cache := newStateCache(model, &alloc, reflect.TypeOf(0), order)
+	linearized := order.key(newBitset(3).set(1))
+	for _, state := range []interface{}{1, "1", []int{1}, nil} {
+		if cache.contains(linearized, state) {
+			t.Fatalf("expected %v not to be cached yet", state)
+		}
+		cache.add(linearized, state)
+		if !cache.contains(linearized, state) {
+			t.Fatalf("expected %v to be cached", state)
+		}
+	}
+	if cache.contains(linearized, 2) || cache.contains(linearized, []int{2}) || cache.contains(order.key(newBitset(3)), 1) {
+		t.Fatal("expected states that weren't added not to be cached")
+	}
+	if _, fast := cache.hash(linearized, "1"); !fast {
+		t.Fatal("expected strings to take the fast path")
+	}
+	if _, fast := cache.hash(linearized, []int{1}); fast {
+		t.Fatal("expected slices not to take the fast path")
+	}
+}
+
+func TestFillDefaultEqual(t *testing.T) {
+	calls := 0
+	equal := func(state1, state2 interface{}) bool {
+		calls++
+		return reflect.DeepEqual(state1, state2)
+	}
+	// states of the type of the initial state are compared with == first
+	model := fillDefault(Model{Init: func() interface{} { return new(int) }, Equal: equal})
+	state := new(int)
+	if !model.Equal(state, state) || calls != 0 {
+		t.Fatalf("expected a state to equal itself without calling Equal, called it %d times", calls)
+	}
+	if !model.Equal(state, new(int)) || calls != 1 {
+		t.Fatalf("expected different pointers to be compared with Equal, called it %d times", calls)
+	}
+	// and other states only with Equal, even if they aren't comparable
+	calls = 0
+	if !model.Equal([]int{1}, []int{1}) || model.Equal(1, []int{1}) || calls != 2 {
+		t.Fatalf("expected other states to be compared with Equal, called it %d times", calls)
+	}
+	model = fillDefault(Model{Init: func() interface{} { return []int{} }, Equal: equal})
+	calls = 0
+	if !model.Equal([]int{1}, []int{1}) || calls != 1 {
+		t.Fatalf("expected states that aren't comparable to be compared with Equal, called it %d times", calls)
+	}
+}
+
+func TestFastPathVerdicts(t *testing.T) {
+	for i := 0; i < 20; i++ {
+		filename := fmt.Sprintf("test_data/jepsen/etcd_%03d.log", i)
+		if _, err := os.Stat(filename); err != nil {
+			continue
+		}
+		events := parseJepsenLog(filename)
+		if fast, slow := CheckEvents(etcdModel, events), CheckEvents(withEqual(etcdModel), events); fast != slow {
+			t.Fatalf("%s: fast path says %t, Equal says %t", filename, fast, slow)
+		}
+	}
+	for _, log := range []string{"c01-ok", "c01-bad", "c10-ok", "c10-bad"} {
+		events := parseKvLog(fmt.Sprintf("test_data/kv/%s.txt", log))
+		if fast, slow := CheckEvents(kvModel, events), CheckEvents(withEqual(kvModel), events); fast != slow {
+			t.Fatalf("%s: fast path says %t, Equal says %t", log, fast, slow)
+		}
+	}
+}
+
+// BenchmarkComparableStates compares the fast path for comparable states with
+// an Equal function that makes the same comparison. The
+// gain is largest when many different states are reached with the same set
+// of operations, as in the key-value logs, whose states are strings.
+func BenchmarkComparableStates(b *testing.B) {
+	type history struct {
+		name   string
+		model  Model
+		events []Event
+	}
+	var histories []history
+	for _, i := range []int{0, 2, 7} {
+		histories = append(histories, history{fmt.Sprintf("etcd_%03d", i), etcdModel, parseJepsenLog(fmt.Sprintf("test_data/jepsen/etcd_%03d.log", i))})
+	}
+	histories = append(histories, history{"kv_c50", kvModel, parseKvLog("test_data/kv/c50-ok.txt")})
+	for _, h := range histories {
+		for _, path := range []struct {
+			name  string
+			model Model
+		}{{"fast", h.model}, {"equal", withEqual(h.model)}} {
+			b.Run(h.name+"/"+path.name, func(b *testing.B) {
+				for i := 0; i < b.N; i++ {
+					CheckEvents(path.model, h.events)
+				}
+			})
+		}
+	}
+}
@@ -1,6 +1,9 @@
 package porcupine
 
 import (
+	"context"
+	"reflect"
+	"runtime/pprof"
 	"sort"
 	"sync/atomic"
 	"time"
@@ -22,8 +25,94 @@ type entry struct {
 }
 
 type LinearizationInfo struct {
-	history               [][]entry // for each partition, a list of entries
-	partialLinearizations [][][]int // for each partition, a set of histories (list of ids)
+	history               [][]entry         // for each partition, a list of entries
+	partialLinearizations [][][]int         // for each partition, a set of histories (list of ids)
+	results               []CheckResult     // for each partition, Unknown if it was not checked to completion
+	coverage              [][]CoverageCount // for each partition, if coverage was recorded
+	stats                 []searchStats     // for each partition, if the check finished
+	traces                []*SearchTrace    // for each partition, if its search was traced
+	cache                 *recordedCache    // if the check recorded its cache
+	checkpointErr         error             // the first error writing a checkpoint
+	err                   error             // the error that stopped the check, if any
+}
+
+// Err returns the error that stopped the check, whose result is then Unknown,
+// or nil if the check wasn't stopped by an error. It is a
+// [*StateMutationError] if the DetectStateMutation option caught the model's
+// Step function modifying its state, and an error naming the partition if a
+// partition has more operations than the checker supports, or if
+// [CheckRegisterSemantics] is given a model without an Accesses function.
+// Unlike the rest of the information, it's available from checks that aren't
+// verbose too.
+func (li LinearizationInfo) Err() error {
+	return li.err
+}
+
+// A PartitionInfo summarizes the result of checking one partition of a
+// history.
+type PartitionInfo struct {
+	// Result is Ok if the partition is linearizable, Illegal if it is not,
+	// and Unknown if the check did not finish, because it timed out or
+	// because the information is from a snapshot.
+	Result CheckResult
+	// Operations is the number of operations in the partition.
+	Operations int
+	// Linearized is the number of operations in the longest partial
+	// linearization that was found, which is Operations if the partition
+	// is linearizable.
+	Linearized int
+	// Steps is the number of times the checker called the model's Step
+	// function, and States is the number of distinct states that the
+	// search reached, counting a state once for each set of operations
+	// linearized to reach it. The checker caches every state it reaches,
+	// so States is also the peak size of its cache. Both are 0 for
+	// information from a snapshot.
+	Steps  int
+	States int
+	// WarmStates is the number of states from a warm cache that seeded
+	// the search (see CheckOptions.WarmCache).
+	WarmStates int
+	// Duration is the wall time that the search of the partition took,
+	// which includes time that its goroutine waited for a CPU while other
+	// partitions were checked. It is 0 for partitions that were finished
+	// in a checkpoint that the check resumed from, and for information
+	// from a snapshot.
+	Duration time.Duration
+	// Coverage counts the classes of the operations in the partition, if
+	// the check recorded coverage (see CheckOptions.RecordCoverage).
+	Coverage []CoverageCount
+}
+
+// Partitions returns a summary of the result for each partition of the
+// history, in the order in which the model partitioned the history.
+func (li LinearizationInfo) Partitions() []PartitionInfo {
+	partitions := make([]PartitionInfo, len(li.history))
+	for i, entries := range li.history {
+		p := &partitions[i]
+		p.Operations = len(entries) / 2
+		for _, partial := range li.partialLinearizations[i] {
+			if len(partial) > p.Linearized {
+				p.Linearized = len(partial)
+			}
+		}
+		if li.coverage != nil {
+			p.Coverage = li.coverage[i]
+		}
+		if li.stats != nil {
+			p.Steps = li.stats[i].steps
+			p.States = li.stats[i].states
+			p.WarmStates = li.stats[i].warmStates
+			p.Duration = li.stats[i].duration
+		}
+		if li.results != nil {
+			p.Result = li.results[i]
+		} else if p.Linearized == p.Operations {
+			p.Result = Ok
+		} else {
+			p.Result = Unknown
+		}
+	}
+	return partitions
 }
 
 type byTime []entry
@@ -80,15 +169,6 @@ func insertBefore(n *node, mark *node) *node {
 	return n
 }
 
-func length(n *node) int {
-	l := 0
-	for n != nil {
-		n = n.next
-		l++
-	}
-	return l
-}
-
 func renumber(events []Event) []Event {
 	var e []Event
 	m := make(map[int]int) // renumbering
@@ -118,21 +198,22 @@ func convertEntries(events []Event) []entry {
 	return entries
 }
 
-func makeLinkedEntries(entries []entry) *node {
+// makeLinkedEntries links the entries into a list of nodes, which are the
+// given nodes, one for each entry.
+func makeLinkedEntries(entries []entry, nodes []node) *node {
 	var root *node = nil
-	match := make(map[int]*node)
+	match := make(map[int]*node, len(entries)/2)
 	for i := len(entries) - 1; i >= 0; i-- {
 		elem := entries[i]
+		entry := &nodes[i]
 		if elem.kind == returnEntry {
-			entry := &node{value: elem.value, match: nil, id: elem.id}
+			*entry = node{value: elem.value, match: nil, id: elem.id}
 			match[elem.id] = entry
-			insertBefore(entry, root)
-			root = entry
 		} else {
-			entry := &node{value: elem.value, match: match[elem.id], id: elem.id}
-			insertBefore(entry, root)
-			root = entry
+			*entry = node{value: elem.value, match: match[elem.id], id: elem.id}
 		}
+		insertBefore(entry, root)
+		root = entry
 	}
 	return root
 }
@@ -142,15 +223,6 @@ type cacheEntry struct {
 	state      interface{}
 }
 
-func cacheContains(model Model, cache map[uint64][]cacheEntry, entry cacheEntry) bool {
-	for _, elem := range cache[entry.linearized.hash()] {
-		if entry.linearized.equals(elem.linearized) && model.Equal(entry.state, elem.state) {
-			return true
-		}
-	}
-	return false
-}
-
 type callsEntry struct {
 	entry *node
 	state interface{}
@@ -176,47 +248,211 @@ func unlift(entry *node) {
 	entry.next.prev = entry
 }
 
-func checkSingle(model Model, history []entry, computePartial bool, kill *int32) (bool, []*[]int) {
-	entry := makeLinkedEntries(history)
-	n := length(entry) / 2
-	linearized := newBitset(uint(n))
-	cache := make(map[uint64][]cacheEntry) // map from hash to cache entry
-	var calls []callsEntry
+// A snapshotter lets a checkSingle goroutine send a copy of its progress when
+// a new snapshot is requested, by incrementing gen.
+type snapshotter struct {
+	gen       *int32
+	partition int
+	responses chan<- partitionSnapshot
+}
+
+type partitionSnapshot struct {
+	gen       int32
+	partition int
+	longest   []*[]int
+}
+
+// send sends a copy of longest, updated with the linearization that is
+// currently being explored. The sequences pointed to by longest are never
+// modified, so they can be shared.
+func (s *snapshotter) send(gen int32, longest []*[]int, calls []callsEntry) {
+	snapshot := make([]*[]int, len(longest))
+	copy(snapshot, longest)
+	seq := make([]int, len(calls))
+	for i, v := range calls {
+		seq[i] = v.entry.id
+	}
+	for _, id := range seq {
+		if snapshot[id] == nil || len(seq) > len(*snapshot[id]) {
+			snapshot[id] = &seq
+		}
+	}
+	s.responses <- partitionSnapshot{gen: gen, partition: s.partition, longest: snapshot}
+}
+
+// searchStats counts the work done by checkSingle.
+type searchStats struct {
+	steps      int           // calls to Step
+	states     int           // entries added to the cache
+	warmStates int           // entries that seeded the cache
+	duration   time.Duration // wall time of the search
+}
+
+// searchOptions configures one search of checkSingle.
+type searchOptions struct {
+	// states of fastType, if it's not nil, are compared with == instead
+	// of the model's Equal function (see fastStateType)
+	fastType       reflect.Type
+	computePartial bool   // whether to keep the longest linearizations
+	arena          bool   // whether the cache allocates from slabs
+	kill           *int32 // stops the search when it's set to nonzero
+	snap           *snapshotter
+	stats          *searchStats // required
+	trace          *searchTracer
+	persisted      *persistedCache
+	ckpt           *checkpointer
+	// for the streaming checker: the states to search from, instead of
+	// the model's initial state; if ends is set, every state that a
+	// linearization leads to is appended to it, instead of stopping at
+	// the first; and the search gives up after adding more than
+	// maxStates states to the cache, unless it's 0
+	starts    []interface{}
+	ends      *[]interface{}
+	maxStates int
+	// for the incremental checker, what the search keeps between
+	// checks; it doesn't use arena mode
+	incr *incrementalSearch
+}
+
+func checkSingle(model Model, history []entry, opts searchOptions) (bool, []*[]int) {
+	alloc := searchAllocator{arena: opts.arena}
+	defer alloc.release()
+	nodes := alloc.newNodes(len(history) + 1)
+	entry := makeLinkedEntries(history, nodes[1:])
+	n := len(history) / 2
+	order := newOpOrder(history)
+	linearized := newLinearizedSet(order)
+	var cache *stateCache
+	if opts.incr != nil {
+		cache = opts.incr.cacheFor(model, opts.fastType, order)
+	} else {
+		cache = newStateCache(model, &alloc, opts.fastType, order)
+	}
+	calls := make([]callsEntry, 0, n)
 	// longest linearizable prefix that includes the given entry
 	longest := make([]*[]int, n)
 
 	state := model.Init()
-	headEntry := insertBefore(&node{value: nil, match: nil, id: -1}, entry)
-	for headEntry.next != nil {
-		if atomic.LoadInt32(kill) != 0 {
+	starts := opts.starts
+	if starts != nil {
+		if len(starts) == 0 {
+			return false, longest
+		}
+		state, starts = starts[0], starts[1:]
+	}
+	if opts.persisted != nil {
+		for _, e := range opts.persisted.warm {
+			cache.add(order.key(e.linearized), e.state)
+		}
+		opts.stats.warmStates = len(opts.persisted.warm)
+		if opts.persisted.record {
+			// runs before alloc.release, while the cache is valid
+			defer func() { opts.persisted.dead = deadEntries(cache, calls, state) }()
+		}
+	}
+	nodes[0] = node{value: nil, match: nil, id: -1}
+	headEntry := insertBefore(&nodes[0], entry)
+	if opts.ckpt != nil && opts.ckpt.resume != nil {
+		calls, state, entry = opts.ckpt.resume.restore(model, nodes[1:], linearized, cache, longest, calls, state, entry)
+	}
+	// in incremental mode, the reach of each state on the path so far, and
+	// the rank of each operation's return (see setReach); the moves from the
+	// states on the path below rescan are explored again
+	var reach, returnRank []uint32
+	rescan := 0
+	if opts.incr != nil {
+		calls, state = opts.incr.restore(nodes[1:], linearized, calls, state)
+		defer func() { opts.incr.save(calls, state) }()
+		entry = headEntry.next
+		rescan = len(calls)
+		reach = make([]uint32, len(calls)+1, n+1)
+		returnRank = returnRanks(history)
+	}
+	var lastGen, lastCheckpoint int32
+	for {
+		if headEntry.next == nil {
+			if opts.ends == nil {
+				break
+			}
+			// every operation is linearized: record the state, and
+			// backtrack, since entry is nil
+			*opts.ends = append(*opts.ends, state)
+		}
+		if atomic.LoadInt32(opts.kill) != 0 {
+			if opts.ckpt != nil && opts.ckpt.stopped != nil {
+				opts.ckpt.stop(history, nodes[1:], entry, calls, cache, longest)
+			}
 			return false, longest
 		}
-		if entry.match != nil {
+		if opts.snap != nil {
+			if gen := atomic.LoadInt32(opts.snap.gen); gen != lastGen {
+				lastGen = gen
+				opts.snap.send(gen, longest, calls)
+			}
+		}
+		if opts.ckpt != nil && opts.ckpt.gen != nil {
+			if gen := atomic.LoadInt32(opts.ckpt.gen); gen != lastCheckpoint {
+				lastCheckpoint = gen
+				opts.ckpt.send(gen, history, nodes[1:], entry, calls, cache, longest)
+			}
+		}
+		if entry != nil && entry.match != nil {
 			matching := entry.match // the return entry
 			ok, newState := model.Step(state, entry.value, matching.value)
+			opts.stats.steps++
 			if ok {
-				newLinearized := linearized.clone().set(uint(entry.id))
-				newCacheEntry := cacheEntry{newLinearized, newState}
-				if !cacheContains(model, cache, newCacheEntry) {
-					hash := newLinearized.hash()
-					cache[hash] = append(cache[hash], newCacheEntry)
+				// look the new state up with the entry's bit set in
+				// place, and copy the key only if the state is new
+				linearized.set(entry.id)
+				var added bool
+				if reach == nil {
+					added = cache.insert(linearized.key(), newState)
+				} else {
+					var r uint32
+					r, added = cache.insertReach(linearized.key(), newState)
+					if r > reach[len(calls)] {
+						reach[len(calls)] = r
+					}
+				}
+				if added {
+					if opts.trace != nil {
+						opts.trace.record(entry.id, entry.value, matching.value, state, newState, SearchAccepted)
+					}
+					opts.stats.states++
+					if opts.maxStates > 0 && opts.stats.states > opts.maxStates {
+						return false, longest
+					}
 					calls = append(calls, callsEntry{entry, state})
+					if reach != nil {
+						reach = append(reach, 0)
+					}
 					state = newState
-					linearized.set(uint(entry.id))
 					lift(entry)
 					entry = headEntry.next
 				} else {
+					if opts.trace != nil {
+						opts.trace.record(entry.id, entry.value, matching.value, state, newState, SearchRevisited)
+					}
+					linearized.clear(entry.id)
 					entry = entry.next
 				}
 			} else {
+				if opts.trace != nil {
+					opts.trace.record(entry.id, entry.value, matching.value, state, nil, SearchRejected)
+				}
 				entry = entry.next
 			}
 		} else {
 			if len(calls) == 0 {
-				return false, longest
+				if len(starts) == 0 {
+					return opts.ends != nil && len(*opts.ends) > 0, longest
+				}
+				state, starts = starts[0], starts[1:]
+				entry = headEntry.next
+				continue
 			}
 			// longest
-			if computePartial {
+			if opts.computePartial {
 				callsLen := len(calls)
 				var seq []int = nil
 				for _, v := range calls {
@@ -232,13 +468,32 @@ func checkSingle(model Model, history []entry, computePartial bool, kill *int32)
 					}
 				}
 			}
+			if reach != nil {
+				// entry is the earliest pending return
+				r := reach[len(calls)]
+				if returnRank[entry.id] > r {
+					r = returnRank[entry.id]
+				}
+				cache.setReach(linearized.key(), state, r)
+				reach = reach[:len(calls)]
+				if r > reach[len(calls)-1] {
+					reach[len(calls)-1] = r
+				}
+			}
 			callsTop := calls[len(calls)-1]
 			entry = callsTop.entry
 			state = callsTop.state
-			linearized.clear(uint(entry.id))
+			linearized.clear(entry.id)
 			calls = calls[:len(calls)-1]
+			if opts.trace != nil {
+				opts.trace.backtrack()
+			}
 			unlift(entry)
 			entry = entry.next
+			if len(calls) < rescan {
+				rescan = len(calls)
+				entry = headEntry.next
+			}
 		}
 	}
 	// longest linearization is the complete linearization, which is calls
@@ -261,6 +516,19 @@ func fillDefault(model Model) Model {
 	}
 	if model.Equal == nil {
 		model.Equal = shallowEqual
+	} else if t := reflect.TypeOf(model.Init()); t != nil && alwaysComparable(t) {
+		// a state that Step returns unchanged is equal to itself, without
+		// calling Equal, which can be expensive; shallowEqual checks that
+		// cheaply already. States of the type of the initial state are
+		// compared with == first, which can't panic, since the type is
+		// always comparable.
+		equal := model.Equal
+		model.Equal = func(state1, state2 interface{}) bool {
+			if reflect.TypeOf(state1) == t && reflect.TypeOf(state2) == t && state1 == state2 {
+				return true
+			}
+			return equal(state1, state2)
+		}
 	}
 	if model.DescribeOperation == nil {
 		model.DescribeOperation = defaultDescribeOperation
@@ -271,74 +539,305 @@ func fillDefault(model Model) Model {
 	return model
 }
 
-func checkParallel(model Model, history [][]entry, computeInfo bool, timeout time.Duration) (CheckResult, LinearizationInfo) {
+type partitionResult struct {
+	partition int
+	ok        bool
+}
+
+// checkParallel checks each partition of a history in its own goroutine.
+// States of fastType, if it's not nil, are compared with == instead of the
+// model's Equal function (see fastStateType).
+func checkParallel(model Model, history [][]entry, fastType reflect.Type, computeInfo bool, opts CheckOptions, resume []*partitionProgress) (CheckResult, LinearizationInfo) {
+	if err := checkPartitionSizes(history); err != nil {
+		return Unknown, LinearizationInfo{err: err}
+	}
 	ok := true
 	timedOut := false
-	results := make(chan bool, len(history))
+	results := make(chan partitionResult, len(history))
 	longest := make([][]*[]int, len(history))
+	stats := make([]searchStats, len(history))
 	kill := int32(0)
+	var snapshotGen int32
+	var snapshots chan partitionSnapshot
+	var snapshotChan <-chan time.Time
+	if opts.SnapshotFunc != nil && opts.SnapshotEvery > 0 {
+		// each goroutine sends at most one response per snapshot, and at
+		// most one stale response after its result, so sends never block
+		snapshots = make(chan partitionSnapshot, 2*len(history))
+		ticker := time.NewTicker(opts.SnapshotEvery)
+		defer ticker.Stop()
+		snapshotChan = ticker.C
+	}
+	var detector *mutationDetector
+	if opts.DetectStateMutation {
+		detector = &mutationDetector{}
+	}
+	var warm *warmCache
+	if opts.WarmCache != nil {
+		warm = readCache(opts.WarmCache, opts.CacheCodec, model)
+	}
+	var recorded *recordedCache
+	if opts.RecordCache {
+		recorded = &recordedCache{codec: opts.CacheCodec, init: model.Init(), dead: make([][]cacheEntry, len(history))}
+	}
+	var checkpointHeaderData []byte
+	var fingerprints []uint64
+	var checkpointErr error
+	var checkpointGen int32
+	var checkpoints chan partitionCheckpoint
+	var checkpointChan <-chan time.Time
+	var stopped []partitionCheckpoint
+	if opts.CheckpointWriter != nil && opts.CheckpointEvery > 0 {
+		checkpointHeaderData, fingerprints, checkpointErr = checkpointHeader(opts.CacheCodec, model, history)
+		if checkpointErr == nil {
+			// like snapshots, sends never block
+			checkpoints = make(chan partitionCheckpoint, 2*len(history))
+			ticker := time.NewTicker(opts.CheckpointEvery)
+			defer ticker.Stop()
+			checkpointChan = ticker.C
+			stopped = make([]partitionCheckpoint, len(history))
+		}
+	}
+	var traces []*SearchTrace
+	if opts.TraceSearch && opts.TracePartition >= 0 && opts.TracePartition < len(history) {
+		traces = make([]*SearchTrace, len(history))
+	}
+	// each goroutine is labeled with its partition, on top of the labels
+	// of the context, if it has any
+	labelParent := context.Background()
+	if opts.Context != nil {
+		labelParent = opts.Context
+	}
 	for i, subhistory := range history {
-		go func(i int, subhistory []entry) {
-			ok, l := checkSingle(model, subhistory, computeInfo, &kill)
+		i, subhistory := i, subhistory
+		var snap *snapshotter
+		if snapshots != nil {
+			snap = &snapshotter{gen: &snapshotGen, partition: i, responses: snapshots}
+		}
+		var ckpt *checkpointer
+		if checkpoints != nil || resume != nil {
+			ckpt = &checkpointer{partition: i, codec: opts.CacheCodec}
+			if checkpoints != nil {
+				ckpt.gen, ckpt.responses, ckpt.stopped = &checkpointGen, checkpoints, &stopped[i]
+			}
+			if resume != nil {
+				ckpt.resume = resume[i]
+			}
+		}
+		go pprof.Do(labelParent, partitionLabels(i, subhistory), func(ctx context.Context) {
+			if ckpt != nil && ckpt.resume != nil && ckpt.resume.result != Unknown {
+				// the partition was checked before the checkpoint
+				longest[i] = ckpt.resume.longest
+				results <- partitionResult{i, ckpt.resume.result == Ok}
+				return
+			}
+			model := model
+			if opts.LabelCallbacks {
+				model = labelCallbacks(ctx, model)
+			}
+			if detector != nil {
+				model = detector.wrap(model, i, &kill)
+			}
+			var trace *searchTracer
+			if traces != nil && i == opts.TracePartition {
+				trace = newSearchTracer(model, i, opts.TraceLimit)
+				traces[i] = trace.trace
+			}
+			var persisted *persistedCache
+			if warm != nil || recorded != nil {
+				persisted = &persistedCache{record: recorded != nil}
+				if warm != nil {
+					persisted.warm = warm.entries(subhistory)
+				}
+			}
+			start := time.Now()
+			ok, l := checkSingle(model, subhistory, searchOptions{
+				fastType:       fastType,
+				computePartial: computeInfo || snap != nil,
+				arena:          opts.ArenaAllocation,
+				kill:           &kill,
+				snap:           snap,
+				stats:          &stats[i],
+				trace:          trace,
+				persisted:      persisted,
+				ckpt:           ckpt,
+			})
+			stats[i].duration = time.Since(start)
 			longest[i] = l
-			results <- ok
-		}(i, subhistory)
+			if recorded != nil {
+				recorded.dead[i] = persisted.dead
+			}
+			results <- partitionResult{i, ok}
+		})
 	}
 	var timeoutChan <-chan time.Time
-	if timeout > 0 {
-		timeoutChan = time.After(timeout)
+	if opts.Timeout > 0 {
+		timeoutChan = time.After(opts.Timeout)
+	}
+	var canceled <-chan struct{}
+	if opts.Context != nil {
+		canceled = opts.Context.Done()
 	}
 	count := 0
-loop:
-	for {
+	done := make([]bool, len(history))
+	partitionResults := make([]CheckResult, len(history))
+	for i := range partitionResults {
+		partitionResults[i] = Unknown
+	}
+	// handleResult records a result, and returns whether the check is over
+	handleResult := func(result partitionResult) bool {
+		count++
+		done[result.partition] = true
+		if result.ok {
+			partitionResults[result.partition] = Ok
+		} else {
+			partitionResults[result.partition] = Illegal
+		}
+		ok = ok && result.ok
+		if !ok && !computeInfo {
+			atomic.StoreInt32(&kill, 1)
+			return true
+		}
+		return count >= len(history)
+	}
+	finished := len(history) == 0
+	for !finished {
 		select {
 		case result := <-results:
-			count++
-			ok = ok && result
-			if !ok && !computeInfo {
-				atomic.StoreInt32(&kill, 1)
-				break loop
+			finished = handleResult(result)
+		case <-snapshotChan:
+			// request a snapshot from every goroutine that is still
+			// running, and wait until each one has either sent its
+			// snapshot or finished
+			gen := atomic.AddInt32(&snapshotGen, 1)
+			snapshot := make([][]*[]int, len(history))
+			got := make([]bool, len(history))
+			pending := 0
+			for i := range history {
+				if done[i] {
+					got[i] = true
+					snapshot[i] = longest[i]
+				} else {
+					pending++
+				}
 			}
-			if count >= len(history) {
-				break loop
+			for pending > 0 {
+				select {
+				case s := <-snapshots:
+					if s.gen == gen && !got[s.partition] {
+						got[s.partition] = true
+						snapshot[s.partition] = s.longest
+						pending--
+					}
+				case result := <-results:
+					finished = handleResult(result) || finished
+					if !got[result.partition] {
+						got[result.partition] = true
+						pending--
+					}
+					snapshot[result.partition] = longest[result.partition]
+				}
+			}
+			snapshotResults := make([]CheckResult, len(history))
+			copy(snapshotResults, partitionResults)
+			opts.SnapshotFunc(LinearizationInfo{
+				history:               history,
+				partialLinearizations: collectPartialLinearizations(snapshot),
+				results:               snapshotResults,
+			})
+		case <-checkpointChan:
+			// like a snapshot, but the goroutines encode their
+			// progress, which is only theirs to read
+			gen := atomic.AddInt32(&checkpointGen, 1)
+			records := make([][]byte, len(history))
+			got := make([]bool, len(history))
+			pending := 0
+			for i := range history {
+				if done[i] {
+					got[i] = true
+					records[i] = finishedRecord(partitionResults[i], longest[i])
+				} else {
+					pending++
+				}
+			}
+			var err error
+			for pending > 0 {
+				select {
+				case c := <-checkpoints:
+					if c.gen == gen && !got[c.partition] {
+						got[c.partition] = true
+						records[c.partition] = c.record
+						if err == nil {
+							err = c.err
+						}
+						pending--
+					}
+				case result := <-results:
+					finished = handleResult(result) || finished
+					if !got[result.partition] {
+						got[result.partition] = true
+						pending--
+					}
+					records[result.partition] = finishedRecord(partitionResults[result.partition], longest[result.partition])
+				}
+			}
+			if err == nil {
+				err = writeCheckpoint(opts.CheckpointWriter, checkpointHeaderData, fingerprints, records)
+			}
+			if checkpointErr == nil {
+				checkpointErr = err
 			}
 		case <-timeoutChan:
 			timedOut = true
 			atomic.StoreInt32(&kill, 1)
-			break loop // if we time out, we might get a false positive
+			finished = true // if we time out, we might get a false positive
+		case <-canceled:
+			timedOut = true
+			atomic.StoreInt32(&kill, 1)
+			finished = true
+		}
+	}
+	var stopErr error
+	if detector != nil {
+		detector.mu.Lock()
+		if detector.err != nil {
+			stopErr = detector.err
 		}
+		detector.mu.Unlock()
 	}
 	var info LinearizationInfo
-	if computeInfo {
+	info.err = stopErr
+	if computeInfo || stopped != nil {
 		// make sure we've waited for all goroutines to finish,
-		// otherwise we might race on access to longest[]
+		// otherwise we might race on access to longest[]; partitions
+		// that finish now were killed, so their results stay Unknown
+		late := make([]*partitionResult, len(history))
 		for count < len(history) {
-			<-results
+			result := <-results
+			late[result.partition] = &result
 			count++
 		}
-		// return longest linearizable prefixes that include each history element
-		partialLinearizations := make([][][]int, len(history))
-		for i := 0; i < len(history); i++ {
-			var partials [][]int
-			// turn longest into a set of unique linearizations
-			set := make(map[*[]int]struct{})
-			for _, v := range longest[i] {
-				if v != nil {
-					set[v] = struct{}{}
-				}
-			}
-			for k := range set {
-				arr := make([]int, len(*k))
-				copy(arr, *k)
-				partials = append(partials, arr)
-			}
-			partialLinearizations[i] = partials
+		if stopped != nil && timedOut && checkpointErr == nil {
+			checkpointErr = writeFinalCheckpoint(opts.CheckpointWriter, checkpointHeaderData, fingerprints, partitionResults, longest, stopped, late)
 		}
+	}
+	if computeInfo {
 		info.history = history
-		info.partialLinearizations = partialLinearizations
+		info.partialLinearizations = collectPartialLinearizations(longest)
+		info.results = partitionResults
+		info.stats = stats
+		info.traces = traces
+		info.cache = recorded
+		info.checkpointErr = checkpointErr
+		if opts.RecordCoverage {
+			info.coverage = computeCoverage(model, history, info.partialLinearizations)
+		}
 	}
 	var result CheckResult
-	if !ok {
+	if stopErr != nil {
+		// the search was stopped, so its result means nothing
+		result = Unknown
+	} else if !ok {
 		result = Illegal
 	} else {
 		if timedOut {
@@ -350,22 +849,63 @@ loop:
 	return result, info
 }
 
-func checkEvents(model Model, history []Event, verbose bool, timeout time.Duration) (CheckResult, LinearizationInfo) {
+// collectPartialLinearizations turns the longest linearizable prefixes that
+// include each history element into sets of unique partial linearizations,
+// for each partition.
+func collectPartialLinearizations(longest [][]*[]int) [][][]int {
+	partialLinearizations := make([][][]int, len(longest))
+	for i := 0; i < len(longest); i++ {
+		var partials [][]int
+		// turn longest into a set of unique linearizations
+		set := make(map[*[]int]struct{})
+		for _, v := range longest[i] {
+			if v != nil {
+				set[v] = struct{}{}
+			}
+		}
+		for k := range set {
+			arr := make([]int, len(*k))
+			copy(arr, *k)
+			partials = append(partials, arr)
+		}
+		partialLinearizations[i] = partials
+	}
+	return partialLinearizations
+}
+
+func checkEvents(model Model, history []Event, verbose bool, opts CheckOptions) (CheckResult, LinearizationInfo) {
+	partitioned, hasEqual := model.PartitionEvent != nil, model.Equal != nil
+	fastType := fastStateType(model)
 	model = fillDefault(model)
 	partitions := model.PartitionEvent(history)
 	l := make([][]entry, len(partitions))
 	for i, subhistory := range partitions {
 		l[i] = convertEntries(renumber(subhistory))
 	}
-	return checkParallel(model, l, verbose, timeout)
+	warnDifficulty(model, l, partitioned, hasEqual, opts)
+	return checkParallel(model, l, fastType, verbose, opts, nil)
 }
 
-func checkOperations(model Model, history []Operation, verbose bool, timeout time.Duration) (CheckResult, LinearizationInfo) {
+func checkOperations(model Model, history []Operation, verbose bool, opts CheckOptions) (CheckResult, LinearizationInfo) {
+	partitioned, hasEqual := model.Partition != nil, model.Equal != nil
+	fastType := fastStateType(model)
 	model = fillDefault(model)
 	partitions := model.Partition(history)
 	l := make([][]entry, len(partitions))
 	for i, subhistory := range partitions {
 		l[i] = makeEntries(subhistory)
 	}
-	return checkParallel(model, l, verbose, timeout)
+	warnDifficulty(model, l, partitioned, hasEqual, opts)
+	return checkParallel(model, l, fastType, verbose, opts, nil)
+}
+
+// warnDifficulty calls the DifficultyWarning option, if it's set, if the
+// history is estimated to be hard to check.
+func warnDifficulty(model Model, history [][]entry, partitioned, hasEqual bool, opts CheckOptions) {
+	if opts.DifficultyWarning == nil {
+		return
+	}
+	if report := estimateDifficulty(model, history, partitioned, hasEqual); report.Difficulty >= DifficultyHard {
+		opts.DifficultyWarning(report)
+	}
 }
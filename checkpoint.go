@@ -0,0 +1,584 @@
+package porcupine
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"time"
+)
+
+// A checkpoint holds the progress of a check, so that a check that is
+// stopped, by a timeout or by the end of its process, can be resumed. The
+// progress of the search of a partition is its position: the operations that
+// it has linearized, in order, and the entry of the history that it was about
+// to process; along with its cache and the longest linearizations that it has
+// found. States along the path are recomputed with the model when the check
+// is resumed, so only the states in the cache are encoded.
+//
+// A checkpoint starts with checkpointMagic followed by the format version as
+// a uvarint and the encoded initial state of the model, and then holds the
+// number of partitions as a uvarint, and each partition, as the fingerprint of
+// its history (see fingerprintHistory) as a little-endian uint64, followed by
+// a length-prefixed record of its progress. Partitions are matched by their
+// fingerprints, since models can partition a history in any order. A record
+// holds:
+//
+//	uvarint result: 0 if the search is running, 1 if Ok, 2 if Illegal
+//	uvarint number of distinct longest linearizations
+//	for each linearization:
+//	        uvarint number of operations, followed by each id
+//	for each operation:
+//	        uvarint 0 if it has no longest linearization, or its index + 1
+//	if the search is running:
+//	        uvarint number of linearized operations, followed by each id
+//	        uvarint index of the entry to process next
+//	        uvarint number of states, followed by each length-prefixed state
+//	        uvarint number of cache entries
+//	        for each cache entry:
+//	                uvarint for each word of the bitset of linearized operations
+//	                uvarint index of its state
+//
+// Unlike a saved cache, which can only make a check slower if it's stale, a
+// checkpoint that doesn't match the history or the model is an error.
+const (
+	checkpointMagic   = "PCPNCKPT"
+	checkpointVersion = 1
+)
+
+const (
+	checkpointRunning = iota
+	checkpointOk
+	checkpointIllegal
+)
+
+// ErrCheckpointMismatch is returned when resuming a check from a checkpoint
+// of a different history, or of a model with a different initial state.
+var ErrCheckpointMismatch = errors.New("porcupine: checkpoint is for a different history or model")
+
+// CheckpointFile returns a [CheckOptions.CheckpointWriter] that writes each
+// checkpoint to the file at path, atomically, like [VisualizePath], so that
+// the file always holds a complete checkpoint, even if the process is stopped
+// while writing one. Errors are returned as a [*FileError].
+func CheckpointFile(path string) func() (io.WriteCloser, error) {
+	return func() (io.WriteCloser, error) {
+		return &checkpointFile{path: path}, nil
+	}
+}
+
+// A checkpointFile holds a checkpoint until it's closed, and then writes it.
+type checkpointFile struct {
+	bytes.Buffer
+	path string
+}
+
+func (f *checkpointFile) Close() error {
+	return writeFileAtomic(f.path, func(w io.Writer) error {
+		_, err := f.WriteTo(w)
+		return err
+	})
+}
+
+// ResumeFromCheckpoint resumes checking a history of operations from a
+// checkpoint written by a check of the same history with the same model (see
+// [CheckOptions.CheckpointWriter]), with a timeout. It returns
+// [ErrCheckpointMismatch] if the checkpoint is for a different history or a
+// model with a different initial state, and an error if it can't read it.
+func ResumeFromCheckpoint(r io.Reader, model Model, history []Operation, timeout time.Duration) (CheckResult, LinearizationInfo, error) {
+	return ResumeFromCheckpointWithOptions(r, model, history, CheckOptions{Timeout: timeout})
+}
+
+// ResumeFromCheckpointWithOptions is like [ResumeFromCheckpoint], with
+// options, which can write checkpoints of the resumed check. The cache
+// options must be the same as the check that wrote the checkpoint, and
+// CacheCodec is used to decode its states.
+func ResumeFromCheckpointWithOptions(r io.Reader, model Model, history []Operation, opts CheckOptions) (CheckResult, LinearizationInfo, error) {
+	partitioned, hasEqual := model.Partition != nil, model.Equal != nil
+	fastType := fastStateType(model)
+	model = fillDefault(model)
+	partitions := model.Partition(history)
+	l := make([][]entry, len(partitions))
+	for i, subhistory := range partitions {
+		l[i] = makeEntries(subhistory)
+	}
+	resume, err := readCheckpoint(r, opts.CacheCodec, model, l)
+	if err != nil {
+		return Unknown, LinearizationInfo{}, err
+	}
+	warnDifficulty(model, l, partitioned, hasEqual, opts)
+	res, info := checkParallel(model, l, fastType, true, opts, resume)
+	return res, info, nil
+}
+
+// ResumeEventsFromCheckpoint is like [ResumeFromCheckpoint], for a history of
+// events.
+func ResumeEventsFromCheckpoint(r io.Reader, model Model, history []Event, timeout time.Duration) (CheckResult, LinearizationInfo, error) {
+	return ResumeEventsFromCheckpointWithOptions(r, model, history, CheckOptions{Timeout: timeout})
+}
+
+// ResumeEventsFromCheckpointWithOptions is like
+// [ResumeFromCheckpointWithOptions], for a history of events.
+func ResumeEventsFromCheckpointWithOptions(r io.Reader, model Model, history []Event, opts CheckOptions) (CheckResult, LinearizationInfo, error) {
+	partitioned, hasEqual := model.PartitionEvent != nil, model.Equal != nil
+	fastType := fastStateType(model)
+	model = fillDefault(model)
+	partitions := model.PartitionEvent(history)
+	l := make([][]entry, len(partitions))
+	for i, subhistory := range partitions {
+		l[i] = convertEntries(renumber(subhistory))
+	}
+	resume, err := readCheckpoint(r, opts.CacheCodec, model, l)
+	if err != nil {
+		return Unknown, LinearizationInfo{}, err
+	}
+	warnDifficulty(model, l, partitioned, hasEqual, opts)
+	res, info := checkParallel(model, l, fastType, true, opts, resume)
+	return res, info, nil
+}
+
+// CheckpointError returns the first error that the check ran into while
+// writing a checkpoint (see [CheckOptions.CheckpointWriter]), or nil.
+func (li LinearizationInfo) CheckpointError() error {
+	return li.checkpointErr
+}
+
+// A checkpointer lets a checkSingle goroutine send its progress when a new
+// checkpoint is requested, by incrementing gen, and when it's killed, and
+// resume from the progress saved in a checkpoint. gen is nil if the check
+// doesn't write checkpoints, and resume is nil if it doesn't resume.
+type checkpointer struct {
+	gen       *int32
+	partition int
+	codec     StateCodec
+	responses chan<- partitionCheckpoint
+	stopped   *partitionCheckpoint // set to the progress when it's killed
+	resume    *partitionProgress
+}
+
+type partitionCheckpoint struct {
+	gen       int32
+	partition int
+	record    []byte
+	err       error
+}
+
+// send sends the position of the search.
+func (c *checkpointer) send(gen int32, history []entry, nodes []node, entry *node, calls []callsEntry, cache *stateCache, longest []*[]int) {
+	record, err := c.codec.encodeProgress(history, nodes, entry, calls, cache, longest)
+	c.responses <- partitionCheckpoint{gen: gen, partition: c.partition, record: record, err: err}
+}
+
+// stop saves the position of the search when it's killed.
+func (c *checkpointer) stop(history []entry, nodes []node, entry *node, calls []callsEntry, cache *stateCache, longest []*[]int) {
+	record, err := c.codec.encodeProgress(history, nodes, entry, calls, cache, longest)
+	*c.stopped = partitionCheckpoint{partition: c.partition, record: record, err: err}
+}
+
+// encodeProgress encodes the record of a partition whose search is running,
+// at entry, which is one of nodes, the linked entries of history.
+func (codec StateCodec) encodeProgress(history []entry, nodes []node, entry *node, calls []callsEntry, cache *stateCache, longest []*[]int) ([]byte, error) {
+	var buf bytes.Buffer
+	bw := bufio.NewWriter(&buf)
+	e := binaryEncoder{w: bw}
+	e.writeUvarint(checkpointRunning)
+	encodeLongest(&e, longest)
+	e.writeUvarint(uint64(len(calls)))
+	for _, call := range calls {
+		e.writeUvarint(uint64(call.entry.id))
+	}
+	cursor := -1
+	for i := range history {
+		if &nodes[i] == entry {
+			cursor = i
+			break
+		}
+	}
+	if cursor < 0 {
+		return nil, errors.New("porcupine: the search is at an entry that isn't in the history")
+	}
+	e.writeUvarint(uint64(cursor))
+	// many entries share a state, so each state is encoded once, as in a
+	// saved cache
+	var states [][]byte
+	entries := cache.all()
+	indices := make([]int, len(entries))
+	index := make(map[string]int)
+	for i, entry := range entries {
+		state, err := codec.encode(entry.state)
+		if err != nil {
+			return nil, fmt.Errorf("porcupine: encoding a state: %w", err)
+		}
+		k, ok := index[string(state)]
+		if !ok {
+			k = len(states)
+			index[string(state)] = k
+			states = append(states, state)
+		}
+		indices[i] = k
+	}
+	e.writeUvarint(uint64(len(states)))
+	for _, state := range states {
+		e.writeString(state)
+	}
+	e.writeUvarint(uint64(len(entries)))
+	for i, entry := range entries {
+		for _, word := range entry.linearized {
+			e.writeUvarint(word)
+		}
+		e.writeUvarint(uint64(indices[i]))
+	}
+	if e.err == nil {
+		e.err = bw.Flush()
+	}
+	return buf.Bytes(), e.err
+}
+
+// finishedRecord encodes the record of a partition whose search finished.
+func finishedRecord(result CheckResult, longest []*[]int) []byte {
+	var buf bytes.Buffer
+	bw := bufio.NewWriter(&buf)
+	e := binaryEncoder{w: bw}
+	if result == Ok {
+		e.writeUvarint(checkpointOk)
+	} else {
+		e.writeUvarint(checkpointIllegal)
+	}
+	encodeLongest(&e, longest)
+	bw.Flush() // writes to a bytes.Buffer can't fail
+	return buf.Bytes()
+}
+
+func encodeLongest(e *binaryEncoder, longest []*[]int) {
+	index := make(map[*[]int]int)
+	var seqs []*[]int
+	for _, seq := range longest {
+		if _, ok := index[seq]; seq != nil && !ok {
+			index[seq] = len(seqs)
+			seqs = append(seqs, seq)
+		}
+	}
+	e.writeUvarint(uint64(len(seqs)))
+	for _, seq := range seqs {
+		e.writeUvarint(uint64(len(*seq)))
+		for _, id := range *seq {
+			e.writeUvarint(uint64(id))
+		}
+	}
+	for _, seq := range longest {
+		if seq == nil {
+			e.writeUvarint(0)
+		} else {
+			e.writeUvarint(uint64(index[seq] + 1))
+		}
+	}
+}
+
+// checkpointHeader returns the header of the checkpoints of a check, which
+// identifies the model, and the fingerprints of its partitions, which
+// identify the history.
+func checkpointHeader(codec StateCodec, model Model, history [][]entry) ([]byte, []uint64, error) {
+	fingerprints, err := checkpointFingerprints(history)
+	if err != nil {
+		return nil, nil, err
+	}
+	init, err := codec.encode(model.Init())
+	if err != nil {
+		return nil, nil, fmt.Errorf("porcupine: encoding the initial state: %w", err)
+	}
+	var buf bytes.Buffer
+	bw := bufio.NewWriter(&buf)
+	e := binaryEncoder{w: bw}
+	e.writeBytes([]byte(checkpointMagic))
+	e.writeUvarint(checkpointVersion)
+	e.writeString(init)
+	if e.err == nil {
+		e.err = bw.Flush()
+	}
+	return buf.Bytes(), fingerprints, e.err
+}
+
+func checkpointFingerprints(history [][]entry) ([]uint64, error) {
+	fingerprints := make([]uint64, len(history))
+	for i, partition := range history {
+		fingerprint, ok := fingerprintHistory(partition)
+		if !ok {
+			return nil, fmt.Errorf("porcupine: the values of partition %d can't be fingerprinted (see CheckOptions.WarmCache)", i)
+		}
+		fingerprints[i] = fingerprint
+	}
+	return fingerprints, nil
+}
+
+// writeCheckpoint writes a checkpoint, with a header and the record of each
+// partition, to a writer from newWriter.
+func writeCheckpoint(newWriter func() (io.WriteCloser, error), header []byte, fingerprints []uint64, records [][]byte) error {
+	w, err := newWriter()
+	if err != nil {
+		return err
+	}
+	bw := bufio.NewWriter(w)
+	e := binaryEncoder{w: bw}
+	e.writeBytes(header)
+	e.writeUvarint(uint64(len(records)))
+	var fp [8]byte
+	for i, record := range records {
+		binary.LittleEndian.PutUint64(fp[:], fingerprints[i])
+		e.writeBytes(fp[:])
+		e.writeString(record)
+	}
+	if e.err == nil {
+		e.err = bw.Flush()
+	}
+	if err := w.Close(); e.err == nil {
+		e.err = err
+	}
+	return e.err
+}
+
+// writeFinalCheckpoint writes the checkpoint of a check that was stopped,
+// once every partition has finished or saved its progress in stopped. late
+// holds the results of partitions that finished after the check stopped.
+func writeFinalCheckpoint(newWriter func() (io.WriteCloser, error), header []byte, fingerprints []uint64, results []CheckResult, longest [][]*[]int, stopped []partitionCheckpoint, late []*partitionResult) error {
+	records := make([][]byte, len(results))
+	for i := range records {
+		switch {
+		case results[i] != Unknown:
+			records[i] = finishedRecord(results[i], longest[i])
+		case stopped[i].record != nil || stopped[i].err != nil:
+			if stopped[i].err != nil {
+				return stopped[i].err
+			}
+			records[i] = stopped[i].record
+		case late[i] != nil && late[i].ok:
+			records[i] = finishedRecord(Ok, longest[i])
+		default:
+			records[i] = finishedRecord(Illegal, longest[i])
+		}
+	}
+	return writeCheckpoint(newWriter, header, fingerprints, records)
+}
+
+// A partitionProgress is the progress of a partition read from a checkpoint.
+type partitionProgress struct {
+	result  CheckResult
+	longest []*[]int
+	calls   []int // ids of the linearized operations, in order
+	cursor  int   // index of the entry to process next
+	cache   []cacheEntry
+}
+
+// readCheckpoint reads a checkpoint written by a check of history, and
+// returns the progress of each partition.
+func readCheckpoint(r io.Reader, codec StateCodec, model Model, history [][]entry) ([]*partitionProgress, error) {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	if !bytes.HasPrefix(data, []byte(checkpointMagic)) {
+		return nil, errors.New("porcupine: not a checkpoint")
+	}
+	cr := cacheReader{data: data[len(checkpointMagic):]}
+	if version := cr.uvarint(); cr.err == nil && version != checkpointVersion {
+		return nil, fmt.Errorf("porcupine: checkpoint has version %d, expected %d", version, checkpointVersion)
+	}
+	savedInit := cr.bytes()
+	count := cr.uvarint()
+	if cr.err != nil {
+		return nil, errCheckpointTruncated
+	}
+	fingerprints, err := checkpointFingerprints(history)
+	if err != nil {
+		return nil, err
+	}
+	init, err := codec.encode(model.Init())
+	if err != nil {
+		return nil, fmt.Errorf("porcupine: encoding the initial state: %w", err)
+	}
+	if !bytes.Equal(init, savedInit) || count != uint64(len(history)) {
+		return nil, ErrCheckpointMismatch
+	}
+	records := make(map[uint64][][]byte)
+	for i := 0; i < len(history); i++ {
+		if len(cr.data) < 8 {
+			return nil, errCheckpointTruncated
+		}
+		fingerprint := binary.LittleEndian.Uint64(cr.data)
+		cr.data = cr.data[8:]
+		record := cr.bytes()
+		if cr.err != nil {
+			return nil, errCheckpointTruncated
+		}
+		records[fingerprint] = append(records[fingerprint], record)
+	}
+	if len(cr.data) != 0 {
+		return nil, errors.New("porcupine: checkpoint has trailing data")
+	}
+	progress := make([]*partitionProgress, len(history))
+	for i, fingerprint := range fingerprints {
+		saved := records[fingerprint]
+		if len(saved) == 0 {
+			return nil, ErrCheckpointMismatch
+		}
+		records[fingerprint] = saved[1:]
+		p, err := readProgress(saved[0], codec, history[i])
+		if err != nil {
+			return nil, fmt.Errorf("porcupine: partition %d of checkpoint: %w", i, err)
+		}
+		progress[i] = p
+	}
+	return progress, nil
+}
+
+var (
+	errCheckpointTruncated = errors.New("porcupine: checkpoint is truncated")
+	errCheckpointMalformed = errors.New("porcupine: checkpoint is malformed")
+)
+
+// readProgress reads the record of a partition with the given history.
+func readProgress(record []byte, codec StateCodec, history []entry) (*partitionProgress, error) {
+	n := len(history) / 2
+	cr := cacheReader{data: record}
+	p := &partitionProgress{result: Unknown}
+	switch cr.uvarint() {
+	case checkpointRunning:
+	case checkpointOk:
+		p.result = Ok
+	case checkpointIllegal:
+		p.result = Illegal
+	default:
+		return nil, errCheckpointMalformed
+	}
+	// readIds reads count ids of operations, each of which is valid and
+	// appears once
+	readIds := func(count uint64) []int {
+		if count > uint64(n) {
+			cr.err = errCheckpointMalformed
+			return nil
+		}
+		ids := make([]int, count)
+		seen := make(map[int]bool, count)
+		for j := range ids {
+			id := cr.uvarint()
+			if id >= uint64(n) || seen[int(id)] {
+				cr.err = errCheckpointMalformed
+				return nil
+			}
+			ids[j] = int(id)
+			seen[int(id)] = true
+		}
+		return ids
+	}
+	count := cr.uvarint()
+	if count > uint64(n) {
+		return nil, errCheckpointMalformed
+	}
+	seqs := make([]*[]int, count)
+	for j := range seqs {
+		seq := readIds(cr.uvarint())
+		seqs[j] = &seq
+	}
+	p.longest = make([]*[]int, n)
+	for j := range p.longest {
+		k := cr.uvarint()
+		if k > uint64(len(seqs)) {
+			return nil, errCheckpointMalformed
+		}
+		if k > 0 {
+			p.longest[j] = seqs[k-1]
+		}
+	}
+	if p.result != Unknown || cr.err != nil {
+		if cr.err == nil && len(cr.data) != 0 {
+			return nil, errCheckpointMalformed
+		}
+		return p, cr.err
+	}
+	p.calls = readIds(cr.uvarint())
+	cursor := cr.uvarint()
+	if cr.err == nil && cursor >= uint64(len(history)) {
+		return nil, errCheckpointMalformed
+	}
+	p.cursor = int(cursor)
+	count = cr.uvarint()
+	if count > uint64(len(cr.data)) {
+		return nil, errCheckpointTruncated
+	}
+	states := make([]interface{}, count)
+	for j := range states {
+		data := cr.bytes()
+		if cr.err != nil {
+			return nil, cr.err
+		}
+		state, err := codec.decode(data)
+		if err != nil {
+			return nil, fmt.Errorf("porcupine: decoding a state: %w", err)
+		}
+		states[j] = state
+	}
+	count = cr.uvarint()
+	if count > uint64(len(cr.data)) {
+		return nil, errCheckpointTruncated
+	}
+	words := len(newBitset(uint(n)))
+	p.cache = make([]cacheEntry, count)
+	for j := range p.cache {
+		linearized := make(bitset, words)
+		for k := range linearized {
+			linearized[k] = cr.uvarint()
+		}
+		state := cr.uvarint()
+		if cr.err != nil {
+			return nil, cr.err
+		}
+		if !validBitset(linearized, uint(n)) || state >= uint64(len(states)) {
+			return nil, errCheckpointMalformed
+		}
+		p.cache[j] = cacheEntry{linearized, states[state]}
+	}
+	if cr.err == nil && len(cr.data) != 0 {
+		return nil, errCheckpointMalformed
+	}
+	return p, cr.err
+}
+
+// restore moves a search that is at the start of a partition, whose linked
+// entries are nodes, to the position saved in a checkpoint, and seeds its
+// cache. It recomputes the states along the path with the model, and leaves
+// the search at the start if the model doesn't accept them.
+func (p *partitionProgress) restore(model Model, nodes []node, linearized *linearizedSet, cache *stateCache, longest []*[]int, calls []callsEntry, state interface{}, entry *node) ([]callsEntry, interface{}, *node) {
+	for _, e := range p.cache {
+		cache.add(cache.order.key(e.linearized), e.state)
+	}
+	copy(longest, p.longest)
+	callNode := make(map[int]*node, len(nodes)/2)
+	for i := range nodes {
+		if nodes[i].match != nil {
+			callNode[nodes[i].id] = &nodes[i]
+		}
+	}
+	// check the path before changing the search
+	path := make([]callsEntry, len(p.calls))
+	s := state
+	for i, id := range p.calls {
+		call := callNode[id]
+		ok, next := model.Step(s, call.value, call.match.value)
+		if !ok {
+			return calls, state, entry
+		}
+		path[i] = callsEntry{call, s}
+		s = next
+	}
+	cursor := &nodes[p.cursor]
+	for _, call := range path {
+		if call.entry.id == cursor.id {
+			return calls, state, entry
+		}
+	}
+	for _, call := range path {
+		linearized.set(call.entry.id)
+		lift(call.entry)
+	}
+	return append(calls, path...), s, cursor
+}
@@ -0,0 +1,195 @@
+package porcupine
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// checkpointBuffer is a CheckpointWriter that keeps every checkpoint.
+type checkpointBuffer struct {
+	checkpoints [][]byte
+}
+
+type checkpointBufferWriter struct {
+	bytes.Buffer
+	c *checkpointBuffer
+}
+
+func (w *checkpointBufferWriter) Close() error {
+	w.c.checkpoints = append(w.c.checkpoints, w.Bytes())
+	return nil
+}
+
+func (c *checkpointBuffer) writer() (io.WriteCloser, error) {
+	return &checkpointBufferWriter{c: c}, nil
+}
+
+func (c *checkpointBuffer) last() []byte {
+	return c.checkpoints[len(c.checkpoints)-1]
+}
+
+func totalSteps(info LinearizationInfo) int {
+	steps := 0
+	for _, p := range info.Partitions() {
+		steps += p.Steps
+	}
+	return steps
+}
+
+// stoppingModel returns a model that cancels a context once it has taken the
+// given number of steps.
+func stoppingModel(model Model, steps int64, cancel context.CancelFunc) Model {
+	var taken int64
+	step := model.Step
+	model.Step = func(state, input, output interface{}) (bool, interface{}) {
+		if atomic.AddInt64(&taken, 1) == steps {
+			cancel()
+		}
+		return step(state, input, output)
+	}
+	return model
+}
+
+func TestCheckpointResume(t *testing.T) {
+	for _, h := range warmCacheHistories() {
+		expected, info := CheckEventsWithOptions(h.model, h.events, CheckOptions{})
+		full := totalSteps(info)
+		ctx, cancel := context.WithCancel(context.Background())
+		var buf checkpointBuffer
+		res, _ := CheckEventsWithOptions(stoppingModel(h.model, int64(full/2), cancel), h.events, CheckOptions{
+			Context:          ctx,
+			CheckpointEvery:  time.Hour,
+			CheckpointWriter: buf.writer,
+		})
+		cancel()
+		if res != Unknown {
+			// the check finished before it noticed the cancellation
+			continue
+		}
+		if len(buf.checkpoints) != 1 {
+			t.Fatalf("%s: expected a checkpoint when the check stopped, got %d", h.name, len(buf.checkpoints))
+		}
+		resumed, info, err := ResumeEventsFromCheckpoint(bytes.NewReader(buf.last()), h.model, h.events, 0)
+		if err != nil {
+			t.Fatalf("%s: %v", h.name, err)
+		}
+		if resumed != expected {
+			t.Fatalf("%s: resumed check says %s, uninterrupted check says %s", h.name, resumed, expected)
+		}
+		if steps := totalSteps(info); steps >= full {
+			t.Fatalf("%s: resumed check took %d steps, uninterrupted check took %d", h.name, steps, full)
+		}
+	}
+}
+
+func TestCheckpointPeriodic(t *testing.T) {
+	history, err := EventsToOperations(parseKvLog("test_data/kv/c10-bad.txt"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := CheckOperations(kvModel, history)
+	model := kvModel
+	model.Step = func(state, input, output interface{}) (bool, interface{}) {
+		time.Sleep(time.Microsecond)
+		return kvModel.Step(state, input, output)
+	}
+	var buf checkpointBuffer
+	_, info := CheckOperationsWithOptions(model, history, CheckOptions{CheckpointEvery: time.Millisecond, CheckpointWriter: buf.writer})
+	if err := info.CheckpointError(); err != nil {
+		t.Fatal(err)
+	}
+	if len(buf.checkpoints) == 0 {
+		t.Skip("check finished before the first checkpoint")
+	}
+	for i, checkpoint := range buf.checkpoints {
+		res, _, err := ResumeFromCheckpoint(bytes.NewReader(checkpoint), kvModel, history, 0)
+		if err != nil {
+			t.Fatalf("checkpoint %d: %v", i, err)
+		}
+		if (res == Ok) != expected {
+			t.Fatalf("checkpoint %d: resumed check says %s, uninterrupted check says %t", i, res, expected)
+		}
+	}
+}
+
+func TestCheckpointFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "checkpoint")
+	events := parseJepsenLog("test_data/jepsen/etcd_002.log")
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	res, info := CheckEventsWithOptions(etcdModel, events, CheckOptions{
+		Context:          ctx,
+		CheckpointEvery:  time.Hour,
+		CheckpointWriter: CheckpointFile(path),
+	})
+	if res != Unknown {
+		t.Skipf("check finished before it noticed the cancellation: %s", res)
+	}
+	if err := info.CheckpointError(); err != nil {
+		t.Fatal(err)
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	if res, _, err := ResumeEventsFromCheckpoint(f, etcdModel, events, 0); err != nil || res != Ok {
+		t.Fatalf("expected the resumed check to say Ok, got %s, %v", res, err)
+	}
+}
+
+func TestCheckpointMismatch(t *testing.T) {
+	events := parseJepsenLog("test_data/jepsen/etcd_000.log")
+	ctx, cancel := context.WithCancel(context.Background())
+	var buf checkpointBuffer
+	CheckEventsWithOptions(stoppingModel(etcdModel, 1000, cancel), events, CheckOptions{
+		Context:          ctx,
+		CheckpointEvery:  time.Hour,
+		CheckpointWriter: buf.writer,
+	})
+	cancel()
+	if len(buf.checkpoints) == 0 {
+		t.Skip("check finished before it noticed the cancellation")
+	}
+	checkpoint := buf.last()
+	resume := func(checkpoint []byte, model Model, events []Event) error {
+		_, _, err := ResumeEventsFromCheckpoint(bytes.NewReader(checkpoint), model, events, 0)
+		return err
+	}
+	if err := resume(checkpoint, etcdModel, parseJepsenLog("test_data/jepsen/etcd_001.log")); !errors.Is(err, ErrCheckpointMismatch) {
+		t.Fatalf("expected a mismatch for a different history, got %v", err)
+	}
+	model := etcdModel
+	model.Init = func() interface{} { return 0 }
+	if err := resume(checkpoint, model, events); !errors.Is(err, ErrCheckpointMismatch) {
+		t.Fatalf("expected a mismatch for a different model, got %v", err)
+	}
+	newer := append([]byte(nil), checkpoint...)
+	newer[len(checkpointMagic)] = checkpointVersion + 1
+	for name, bad := range map[string][]byte{
+		"a truncated checkpoint": checkpoint[:len(checkpoint)/2],
+		"a newer checkpoint":     newer,
+		"a cache":                []byte(cacheMagic),
+		"a corrupted checkpoint": flipByte(checkpoint, len(checkpoint)-1),
+	} {
+		if err := resume(bad, etcdModel, events); err == nil {
+			t.Fatalf("expected an error for %s", name)
+		}
+	}
+}
+
+func TestCheckContext(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	res, _ := CheckEventsWithOptions(etcdModel, parseJepsenLog("test_data/jepsen/etcd_002.log"), CheckOptions{Context: ctx})
+	if res != Unknown {
+		t.Fatalf("expected a canceled check to be Unknown, got %s", res)
+	}
+}
@@ -0,0 +1,82 @@
+package porcupine
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+)
+
+// Types for the Chrome Trace Event Format. See
+// https://docs.google.com/document/d/1CvAClvFfyA5R-PhYUmn5OOQtYMH4h6I0nSsKchNAySU.
+
+type chromeTrace struct {
+	TraceEvents     []chromeTraceEvent `json:"traceEvents"`
+	DisplayTimeUnit string             `json:"displayTimeUnit"`
+}
+
+type chromeTraceEvent struct {
+	Name string                 `json:"name"`
+	Cat  string                 `json:"cat,omitempty"`
+	Ph   string                 `json:"ph"`
+	Ts   float64                `json:"ts"`            // microseconds
+	Dur  *float64               `json:"dur,omitempty"` // microseconds, for complete events
+	Pid  int                    `json:"pid"`
+	Tid  int                    `json:"tid"`
+	Args map[string]interface{} `json:"args,omitempty"`
+}
+
+// ExportChromeTrace exports a history in the Trace Event Format used by
+// chrome://tracing and Perfetto, which handle very large histories well.
+//
+// Each operation is exported as a complete event, with the partition as the
+// process ID and the client as the thread ID, named by the model's
+// DescribeOperation. The event arguments record whether the operation is part
+// of the longest partial linearization of its partition. Metadata events name
+// the processes and threads.
+//
+// The trace format uses microseconds; timestamps are converted according to
+// the ExportOptions.
+//
+// To get the LinearizationInfo that this function requires, you can use
+// [CheckOperationsVerbose] / [CheckEventsVerbose].
+func ExportChromeTrace(model Model, info LinearizationInfo, output io.Writer, opts ExportOptions) error {
+	data, linearized := exportData(model, info)
+	events := []chromeTraceEvent{}
+	for p, partition := range data {
+		events = append(events, chromeTraceEvent{
+			Name: "process_name",
+			Ph:   "M",
+			Pid:  p,
+			Args: map[string]interface{}{"name": fmt.Sprintf("partition %d", p)},
+		})
+		clients := make(map[int]bool)
+		for i, elem := range partition.History {
+			if !clients[elem.ClientId] {
+				clients[elem.ClientId] = true
+				events = append(events, chromeTraceEvent{
+					Name: "thread_name",
+					Ph:   "M",
+					Pid:  p,
+					Tid:  elem.ClientId,
+					Args: map[string]interface{}{"name": fmt.Sprintf("client %d", elem.ClientId)},
+				})
+			}
+			start := float64(opts.exportTime(elem.Start)) / 1000
+			dur := float64(opts.exportTime(elem.End))/1000 - start
+			events = append(events, chromeTraceEvent{
+				Name: elem.Description,
+				Cat:  "operation",
+				Ph:   "X",
+				Ts:   start,
+				Dur:  &dur,
+				Pid:  p,
+				Tid:  elem.ClientId,
+				Args: map[string]interface{}{"linearized": linearized[p][i]},
+			})
+		}
+	}
+	return json.NewEncoder(output).Encode(chromeTrace{
+		TraceEvents:     events,
+		DisplayTimeUnit: "ns",
+	})
+}
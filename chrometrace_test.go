@@ -0,0 +1,123 @@
+package porcupine
+
+import (
+	"bytes"
+	"encoding/json"
+	"testing"
+	"time"
+)
+
+// validateChromeTraceEvent checks an event against the documented schema for
+// the event types that ExportChromeTrace produces.
+func validateChromeTraceEvent(t *testing.T, event map[string]interface{}) {
+	name, ok := event["name"].(string)
+	if !ok {
+		t.Fatalf("event is missing name: %v", event)
+	}
+	for _, field := range []string{"ts", "pid", "tid"} {
+		if _, ok := event[field].(float64); !ok {
+			t.Fatalf("event %q is missing numeric field %q", name, field)
+		}
+	}
+	switch event["ph"] {
+	case "X":
+		dur, ok := event["dur"].(float64)
+		if !ok || dur < 0 {
+			t.Fatalf("complete event %q has invalid duration %v", name, event["dur"])
+		}
+	case "M":
+		if name != "process_name" && name != "thread_name" {
+			t.Fatalf("unexpected metadata event %q", name)
+		}
+		args, ok := event["args"].(map[string]interface{})
+		if !ok {
+			t.Fatalf("metadata event is missing args")
+		}
+		if _, ok := args["name"].(string); !ok {
+			t.Fatalf("metadata event is missing name argument")
+		}
+	default:
+		t.Fatalf("unexpected event phase %v", event["ph"])
+	}
+}
+
+func TestExportChromeTrace(t *testing.T) {
+	ops := []Operation{
+		{0, kvInput{op: 1, key: "x", value: "y"}, 0, kvOutput{}, 10000},
+		{1, kvInput{op: 0, key: "x"}, 20000, kvOutput{"z"}, 30000},
+		{2, kvInput{op: 1, key: "y", value: "a"}, 5000, kvOutput{}, 15000},
+	}
+	res, info := CheckOperationsVerbose(kvModel, ops, 0)
+	if res != Illegal {
+		t.Fatalf("expected output %v, got output %v", Illegal, res)
+	}
+	var buf bytes.Buffer
+	err := ExportChromeTrace(kvModel, info, &buf, ExportOptions{})
+	if err != nil {
+		t.Fatalf("export failed: %v", err)
+	}
+	var trace map[string]interface{}
+	err = json.Unmarshal(buf.Bytes(), &trace)
+	if err != nil {
+		t.Fatalf("failed to parse exported trace: %v", err)
+	}
+	events, ok := trace["traceEvents"].([]interface{})
+	if !ok {
+		t.Fatalf("trace is missing traceEvents")
+	}
+	complete := make(map[string]map[string]interface{})
+	for _, e := range events {
+		event := e.(map[string]interface{})
+		validateChromeTraceEvent(t, event)
+		if event["ph"] == "X" {
+			complete[event["name"].(string)] = event
+		}
+	}
+	if len(complete) != len(ops) {
+		t.Fatalf("expected %d complete events, got %d", len(ops), len(complete))
+	}
+	// nanoseconds are converted to microseconds
+	get := complete["get('x') -> 'z'"]
+	if get["ts"] != 20.0 || get["dur"] != 10.0 || get["pid"] != 0.0 || get["tid"] != 1.0 {
+		t.Fatalf("unexpected event for get: %v", get)
+	}
+	if get["args"].(map[string]interface{})["linearized"] != false {
+		t.Fatalf("expected get not to be linearized: %v", get)
+	}
+	put := complete["put('y', 'a')"]
+	if put["pid"] != 1.0 || put["args"].(map[string]interface{})["linearized"] != true {
+		t.Fatalf("unexpected event for put: %v", put)
+	}
+}
+
+func TestExportChromeTraceLogical(t *testing.T) {
+	events := parseJepsenLog("test_data/jepsen/etcd_070.log")
+	_, info := CheckEventsVerbose(etcdModel, events, 0)
+	var buf bytes.Buffer
+	// event indices as logical timestamps, spaced out by a millisecond
+	err := ExportChromeTrace(etcdModel, info, &buf, ExportOptions{Unit: time.Millisecond})
+	if err != nil {
+		t.Fatalf("export failed: %v", err)
+	}
+	var trace struct {
+		TraceEvents []map[string]interface{} `json:"traceEvents"`
+	}
+	err = json.Unmarshal(buf.Bytes(), &trace)
+	if err != nil {
+		t.Fatalf("failed to parse exported trace: %v", err)
+	}
+	count := 0
+	for _, event := range trace.TraceEvents {
+		validateChromeTraceEvent(t, event)
+		if event["ph"] == "X" {
+			count++
+			ts := event["ts"].(float64)
+			if ts != float64(int64(ts/1000))*1000 {
+				t.Fatalf("expected timestamps to be whole milliseconds, got %v", ts)
+			}
+		}
+	}
+	if count != len(events)/2 {
+		t.Fatalf("expected %d complete events, got %d", len(events)/2, count)
+	}
+}
@@ -0,0 +1,198 @@
+package porcupine
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"sync"
+	"time"
+)
+
+// A Clock reads timestamps for the operations of a history, as nanoseconds
+// since the clock was created. It is safe for concurrent use by multiple
+// goroutines.
+//
+// Timestamps computed from the wall clock, such as with
+// time.Now().UnixNano(), go backwards when the system clock is stepped, such
+// as by NTP, which can make an operation return before it is called, or
+// reorder operations. A Clock instead measures time with the monotonic clock
+// of the time package, and it never goes backwards, even on systems where
+// the monotonic clock isn't available.
+type Clock struct {
+	start time.Time
+	now   func() time.Time
+
+	mu     sync.Mutex
+	last   int64
+	offset int64
+}
+
+// NewClock returns a clock that reads 0 now.
+func NewClock() *Clock {
+	return newClock(time.Now)
+}
+
+func newClock(now func() time.Time) *Clock {
+	return &Clock{start: now(), now: now}
+}
+
+// Now returns the current timestamp. Timestamps returned by Now never
+// decrease: if the time read from the system is before the previous
+// timestamp, which only happens if it lacks a monotonic clock reading, it is
+// treated as a step of the clock, and later timestamps are shifted to
+// continue from the previous one.
+func (c *Clock) Now() int64 {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	now := c.FromTime(c.now()) + c.offset
+	if now < c.last {
+		c.offset += c.last - now
+		now = c.last
+	}
+	c.last = now
+	return now
+}
+
+// FromTime converts a time to a timestamp of the clock, such as a time read
+// with time.Now by code that can't call Now. The conversion uses the
+// monotonic clock readings of t and the clock's creation time if t has one,
+// so that it's unaffected by steps of the system clock; otherwise, it uses
+// the wall clock, like [time.Time.Sub]. Unlike Now, FromTime doesn't prevent
+// timestamps from going backwards, and its result can be negative for times
+// before the clock was created.
+//
+// FromTime panics if t is more than about 292 years away from the clock's
+// creation time, so that the timestamp would overflow an int64.
+func (c *Clock) FromTime(t time.Time) int64 {
+	d := t.Sub(c.start)
+	// Sub saturates instead of overflowing
+	if d == time.Duration(math.MaxInt64) || d == time.Duration(math.MinInt64) {
+		panic(fmt.Sprintf("porcupine: time %v is out of range of the clock", t))
+	}
+	return int64(d)
+}
+
+// Time converts a timestamp of the clock back to a time, by adding it to the
+// wall clock time at which the clock was created. If the system clock was
+// stepped since then, the result differs from the system clock at the time
+// of the timestamp, but it is consistent with the order of the timestamps.
+func (c *Clock) Time(ts int64) time.Time {
+	return c.start.Add(time.Duration(ts)).Round(0)
+}
+
+// Format formats a timestamp of the clock as a wall clock time, in the
+// RFC 3339 format with nanoseconds, such as to show the times of operations
+// in a visualization with [VisualizationOptions].RewriteDescription.
+func (c *Clock) Format(ts int64) string {
+	return c.Time(ts).Format(time.RFC3339Nano)
+}
+
+// A ClockAdjustment is a known step in the clock of a client, such as an NTP
+// step: when the client's clock read Time, it jumped by Step, forward if Step
+// is positive and backward if it is negative.
+//
+// After a backward step, the clock repeats the readings between Time+Step and
+// Time, so timestamps in that window can't be attributed to before or after
+// the step; they are treated as before the step, and the resulting overlap
+// between the client's operations is resolved by [NormalizeClocks].
+type ClockAdjustment struct {
+	ClientId int
+	Time     int64
+	Step     int64
+}
+
+// A NormalizationReport describes the changes made by [NormalizeClocks].
+type NormalizationReport struct {
+	// Shifted lists the indices of the operations whose call time was
+	// changed.
+	Shifted []int
+	// Widened lists the indices of the operations whose duration was
+	// increased.
+	Widened []int
+	// TotalShift is the sum of the absolute changes of the call times of
+	// all operations.
+	TotalShift int64
+	// TotalWidening is the sum of the increases of the durations of all
+	// operations.
+	TotalWidening int64
+}
+
+// NormalizeClocks rewrites the timestamps of a history to undo known clock
+// adjustments, and to make the operations of each client sequential.
+//
+// A timestamp of a client is corrected by subtracting the steps of all of
+// the client's adjustments with a Time at or before the timestamp.
+// Corrections never shrink an operation: if an operation spans a forward
+// step, so that its corrected duration would be shorter than the recorded
+// one, its return time is extended to keep the recorded duration, since the
+// exact time of the step relative to the operation is uncertain.
+//
+// Then, since a client performs one operation at a time, an operation of a
+// client that starts before the client's previous operation returned, which
+// happens when the clock went backward without a known adjustment, is
+// shifted later, keeping its duration, to start when the previous operation
+// returned.
+//
+// The returned history has the operations in their original order. It
+// returns an error if an operation returns before it is called.
+func NormalizeClocks(ops []Operation, adjustments []ClockAdjustment) ([]Operation, NormalizationReport, error) {
+	var report NormalizationReport
+	byClient := make(map[int][]ClockAdjustment)
+	for _, adj := range adjustments {
+		byClient[adj.ClientId] = append(byClient[adj.ClientId], adj)
+	}
+	correct := func(client int, t int64) int64 {
+		for _, adj := range byClient[client] {
+			if adj.Time <= t {
+				t -= adj.Step
+			}
+		}
+		return t
+	}
+
+	normalized := make([]Operation, len(ops))
+	clientOps := make(map[int][]int)
+	for i, op := range ops {
+		if op.Return < op.Call {
+			return nil, NormalizationReport{}, fmt.Errorf("porcupine: operation %d returns at %d, before it is called at %d", i, op.Return, op.Call)
+		}
+		duration := op.Return - op.Call
+		op.Call = correct(op.ClientId, ops[i].Call)
+		op.Return = correct(op.ClientId, ops[i].Return)
+		if op.Return-op.Call < duration {
+			op.Return = op.Call + duration
+		}
+		normalized[i] = op
+		clientOps[op.ClientId] = append(clientOps[op.ClientId], i)
+	}
+
+	for _, indices := range clientOps {
+		sort.SliceStable(indices, func(a, b int) bool {
+			return normalized[indices[a]].Call < normalized[indices[b]].Call
+		})
+		for k := 1; k < len(indices); k++ {
+			prev, op := &normalized[indices[k-1]], &normalized[indices[k]]
+			if op.Call < prev.Return {
+				shift := prev.Return - op.Call
+				op.Call += shift
+				op.Return += shift
+			}
+		}
+	}
+
+	for i, op := range normalized {
+		if op.Call != ops[i].Call {
+			report.Shifted = append(report.Shifted, i)
+			shift := op.Call - ops[i].Call
+			if shift < 0 {
+				shift = -shift
+			}
+			report.TotalShift += shift
+		}
+		if widening := (op.Return - op.Call) - (ops[i].Return - ops[i].Call); widening > 0 {
+			report.Widened = append(report.Widened, i)
+			report.TotalWidening += widening
+		}
+	}
+	return normalized, report, nil
+}
@@ -0,0 +1,175 @@
+package porcupine
+
+import (
+	"fmt"
+	"testing"
+	"time"
+)
+
+func TestNormalizeClocks(t *testing.T) {
+	// client 0's clock jumps forward by 1000 at time 50, so its put seems to
+	// happen after the get that observes it
+	ops := []Operation{
+		{0, registerInput{false, 1}, 1060, 0, 1070},
+		{1, registerInput{true, 0}, 80, 1, 90},
+		{0, registerInput{true, 0}, 10, 0, 20},
+	}
+	if CheckOperations(registerModel, ops) {
+		t.Fatal("expected history with clock step to be non-linearizable")
+	}
+	normalized, report, err := NormalizeClocks(ops, []ClockAdjustment{{ClientId: 0, Time: 50, Step: 1000}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !CheckOperations(registerModel, normalized) {
+		t.Fatal("expected normalized history to be linearizable")
+	}
+	expected := []Operation{
+		{0, registerInput{false, 1}, 60, 0, 70},
+		{1, registerInput{true, 0}, 80, 1, 90},
+		{0, registerInput{true, 0}, 10, 0, 20},
+	}
+	for i := range expected {
+		if normalized[i] != expected[i] {
+			t.Fatalf("expected %v, got %v", expected, normalized)
+		}
+	}
+	if fmt.Sprint(report.Shifted) != "[0]" || report.TotalShift != 1000 || len(report.Widened) != 0 {
+		t.Fatalf("unexpected report %+v", report)
+	}
+}
+
+func TestNormalizeClocksNeverShrinks(t *testing.T) {
+	ops := []Operation{
+		{0, registerInput{false, 1}, 40, 0, 1060}, // spans the step
+		{0, registerInput{true, 0}, 1070, 1, 1080},
+	}
+	normalized, report, err := NormalizeClocks(ops, []ClockAdjustment{{ClientId: 0, Time: 50, Step: 1000}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := range ops {
+		if normalized[i].Return-normalized[i].Call < ops[i].Return-ops[i].Call {
+			t.Fatalf("operation %d was shrunk: %v -> %v", i, ops[i], normalized[i])
+		}
+	}
+	// the spanning operation keeps its duration, so the next operation is
+	// shifted to start after it
+	if normalized[0] != ops[0] || normalized[1].Call != 1060 || normalized[1].Return != 1070 {
+		t.Fatalf("unexpected normalized history %v", normalized)
+	}
+	if fmt.Sprint(report.Shifted) != "[1]" || report.TotalShift != 10 {
+		t.Fatalf("unexpected report %+v", report)
+	}
+}
+
+func TestNormalizeClocksMonotonic(t *testing.T) {
+	// client 0's clock went backward during the put without a known
+	// adjustment, so the get seems to overlap with it
+	ops := []Operation{
+		{0, registerInput{false, 1}, 100, 0, 210},
+		{0, registerInput{true, 0}, 150, 1, 160},
+		{1, registerInput{false, 2}, 300, 0, 310},
+	}
+	normalized, report, err := NormalizeClocks(ops, []ClockAdjustment{{ClientId: 0, Time: 10, Step: -5}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []Operation{
+		{0, registerInput{false, 1}, 105, 0, 215},
+		{0, registerInput{true, 0}, 215, 1, 225},
+		{1, registerInput{false, 2}, 300, 0, 310},
+	}
+	for i := range expected {
+		if normalized[i] != expected[i] {
+			t.Fatalf("expected %v, got %v", expected, normalized)
+		}
+	}
+	if fmt.Sprint(report.Shifted) != "[0 1]" || report.TotalShift != 70 || report.TotalWidening != 0 {
+		t.Fatalf("unexpected report %+v", report)
+	}
+
+	if _, _, err := NormalizeClocks([]Operation{{0, nil, 10, nil, 5}}, nil); err == nil {
+		t.Fatal("expected error for an operation that returns before it is called")
+	}
+}
+
+// steppingClock returns a clock whose readings follow the given offsets from
+// a base time, without monotonic clock readings, like a wall clock that is
+// stepped.
+func steppingClock(offsets ...time.Duration) *Clock {
+	base := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	i := 0
+	return newClock(func() time.Time {
+		t := base.Add(offsets[i])
+		if i < len(offsets)-1 {
+			i++
+		}
+		return t
+	})
+}
+
+func TestClock(t *testing.T) {
+	c := NewClock()
+	before := time.Now()
+	first := c.Now()
+	second := c.Now()
+	if first < 0 || second < first {
+		t.Fatalf("expected increasing timestamps, got %d and %d", first, second)
+	}
+	if ts := c.FromTime(before); ts > first {
+		t.Fatalf("expected time read before %d to convert to at most it, got %d", first, ts)
+	}
+	if d := c.Time(second).Sub(time.Now()); d > time.Second || d < -time.Second {
+		t.Fatalf("expected time of timestamp to be close to now, got %v away", d)
+	}
+
+	c = steppingClock(0, 1500*time.Millisecond)
+	if ts := c.Now(); ts != int64(1500*time.Millisecond) {
+		t.Fatalf("expected 1.5s, got %d", ts)
+	}
+	if s := c.Format(c.Now()); s != "2024-01-01T00:00:01.5Z" {
+		t.Fatalf("unexpected formatted time %s", s)
+	}
+
+	defer func() {
+		if recover() == nil {
+			t.Fatal("expected FromTime to panic on overflow")
+		}
+	}()
+	c.FromTime(c.start.AddDate(300, 0, 0))
+}
+
+func TestClockBackwardStep(t *testing.T) {
+	// the wall clock is stepped back by 1s after 20ns
+	c := steppingClock(0, 10, 20, 20-time.Second, 30-time.Second, 40-time.Second)
+	var readings []int64
+	for i := 0; i < 5; i++ {
+		readings = append(readings, c.Now())
+	}
+	expected := []int64{10, 20, 20, 30, 40}
+	if fmt.Sprint(readings) != fmt.Sprint(expected) {
+		t.Fatalf("expected %v, got %v", expected, readings)
+	}
+
+	// a recorder with the same clock records a well-formed history
+	r := &Recorder{clock: steppingClock(0, 10, 20, 20-time.Second, 30-time.Second, 40-time.Second, 50-time.Second)}
+	h0 := r.Begin(0, registerInput{false, 1})
+	h1 := r.Begin(1, registerInput{true, 0})
+	h0.End(0)
+	h1.End(1)
+	h0 = r.Begin(0, registerInput{true, 0})
+	h0.End(1)
+	ops := r.Operations()
+	for i, op := range ops {
+		if op.Return < op.Call {
+			t.Fatalf("operation %d returns before it is called: %v", i, op)
+		}
+	}
+	if issues := ValidateHistory(ops); len(issues) != 0 {
+		t.Fatalf("expected a well-formed history, got %v", issues)
+	}
+	if !CheckOperations(registerModel, ops) {
+		t.Fatal("expected history to be linearizable")
+	}
+}
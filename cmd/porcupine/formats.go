@@ -0,0 +1,125 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/anishathalye/porcupine"
+	"github.com/anishathalye/porcupine/jepsen"
+)
+
+// formats lists the supported history formats, and their descriptions for
+// the usage message.
+var formats = []struct {
+	name        string
+	extension   string
+	description string
+}{
+	{"json", ".json", "operations, as written by porcupine.MarshalHistory"},
+	{"json-events", "", "events, as written by porcupine.MarshalEvents"},
+	{"jsonl", ".jsonl", "events, one per line, as written by porcupine.WriteJSONL"},
+	{"binary", ".bin", "operations, as written by porcupine.WriteHistory"},
+	{"csv", ".csv", "operations, with the schema of porcupine.MapCSVKVRow (kv model only)"},
+	{"edn", ".edn", "a Jepsen history"},
+}
+
+// detectFormat returns the format for a file based on its extension.
+func detectFormat(path string) (string, error) {
+	ext := strings.ToLower(filepath.Ext(path))
+	for _, f := range formats {
+		if f.extension != "" && f.extension == ext {
+			return f.name, nil
+		}
+	}
+	return "", fmt.Errorf("can't detect the format of %s from its extension, use -format", path)
+}
+
+// A history is either a history of operations or a history of events.
+type history struct {
+	ops    []porcupine.Operation
+	events []porcupine.Event
+}
+
+func (h history) operations() int {
+	if h.ops != nil {
+		return len(h.ops)
+	}
+	return len(h.events) / 2
+}
+
+// readHistory reads a history file in the given format, for the given model.
+func readHistory(path, format string, m builtinModel) (history, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return history{}, err
+	}
+	defer f.Close()
+
+	var h history
+	switch format {
+	case "json", "json-events":
+		data, err := io.ReadAll(f)
+		if err != nil {
+			return history{}, err
+		}
+		if format == "json" {
+			h.ops, err = porcupine.UnmarshalHistory(data)
+		} else {
+			h.events, err = porcupine.UnmarshalEvents(data)
+		}
+		if err != nil {
+			return history{}, m.explain(err)
+		}
+	case "jsonl":
+		if h.events, err = porcupine.ReadJSONL(f); err != nil {
+			return history{}, m.explain(err)
+		}
+	case "binary":
+		if h.ops, err = porcupine.ReadAllHistory(f); err != nil {
+			return history{}, m.explain(err)
+		}
+	case "csv":
+		if m.csvRow == nil {
+			return history{}, fmt.Errorf("the csv format is not supported by this model")
+		}
+		if h.ops, err = porcupine.ReadCSVHistory(f, m.csvRow); err != nil {
+			return history{}, err
+		}
+	case "edn":
+		if h.events, err = jepsen.ParseEDNHistoryWithMapper(f, m.edn); err != nil {
+			return history{}, err
+		}
+	default:
+		return history{}, fmt.Errorf("unknown format %q", format)
+	}
+
+	for i, op := range h.ops {
+		if err := m.checkTypes("operation", i, op.Input, op.Output); err != nil {
+			return history{}, err
+		}
+	}
+	for i, event := range h.events {
+		var err error
+		if event.Kind == porcupine.CallEvent {
+			err = m.checkTypes("event", i, event.Value, nil)
+		} else {
+			err = m.checkTypes("event", i, nil, event.Value)
+		}
+		if err != nil {
+			return history{}, err
+		}
+	}
+	return h, nil
+}
+
+// explain adds the types that the model expects to errors about values of
+// unregistered types.
+func (m builtinModel) explain(err error) error {
+	if strings.Contains(err.Error(), "is not registered") {
+		return fmt.Errorf("%w; the model expects values of types %q and %q", err, m.inputName, m.outputName)
+	}
+	return err
+}
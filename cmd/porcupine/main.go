@@ -0,0 +1,179 @@
+// Command porcupine checks recorded histories for linearizability, without
+// writing a Go program:
+//
+//	porcupine check -model kv -format jsonl history.jsonl -viz out.html -timeout 30s
+//
+// It supports the built-in models and the history formats listed by
+// "porcupine help". The exit code is 0 if every history is linearizable, 1 if
+// any history is not, 2 if the result is unknown because of a timeout, and 3
+// for usage errors and histories that can't be read.
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/anishathalye/porcupine"
+)
+
+const (
+	exitOk      = 0
+	exitIllegal = 1
+	exitUnknown = 2
+	exitUsage   = 3
+)
+
+func main() {
+	os.Exit(run(os.Args[1:], os.Stdout, os.Stderr))
+}
+
+func usage(w io.Writer) {
+	fmt.Fprintf(w, `usage: porcupine check -model MODEL [-format FORMAT] [-timeout DURATION] [-viz PATH] FILE...
+
+Models:
+  %s
+
+Formats (detected from the file extension if -format is not given):
+`, strings.Join(modelNames(), ", "))
+	for _, f := range formats {
+		ext := ""
+		if f.extension != "" {
+			ext = " (" + f.extension + ")"
+		}
+		fmt.Fprintf(w, "  %-12s %s%s\n", f.name, f.description, ext)
+	}
+	fmt.Fprintf(w, `
+Exit codes: 0 linearizable, 1 not linearizable, 2 unknown, 3 usage or read error
+`)
+}
+
+func run(args []string, stdout, stderr io.Writer) int {
+	if len(args) == 0 || args[0] == "help" || args[0] == "-h" || args[0] == "--help" {
+		usage(stderr)
+		if len(args) == 0 {
+			return exitUsage
+		}
+		return exitOk
+	}
+	if args[0] != "check" {
+		fmt.Fprintf(stderr, "porcupine: unknown command %q\n", args[0])
+		usage(stderr)
+		return exitUsage
+	}
+
+	fs := flag.NewFlagSet("check", flag.ContinueOnError)
+	fs.SetOutput(io.Discard)
+	modelName := fs.String("model", "", "model of the system")
+	format := fs.String("format", "", "format of the history files")
+	timeout := fs.Duration("timeout", 0, "timeout for each check (0 for no timeout)")
+	viz := fs.String("viz", "", "path of the visualization to write")
+	// allow flags after the files, like "check history.jsonl -viz out.html"
+	var files []string
+	rest := args[1:]
+	for {
+		if err := fs.Parse(rest); err != nil {
+			fmt.Fprintf(stderr, "porcupine: %v\n", err)
+			usage(stderr)
+			return exitUsage
+		}
+		if fs.NArg() == 0 {
+			break
+		}
+		files = append(files, fs.Arg(0))
+		rest = fs.Args()[1:]
+	}
+
+	m, ok := builtinModels[*modelName]
+	if !ok {
+		if *modelName == "" {
+			fmt.Fprintf(stderr, "porcupine: -model is required\n")
+		} else {
+			fmt.Fprintf(stderr, "porcupine: unknown model %q\n", *modelName)
+		}
+		usage(stderr)
+		return exitUsage
+	}
+	if len(files) == 0 {
+		fmt.Fprintf(stderr, "porcupine: no history files given\n")
+		usage(stderr)
+		return exitUsage
+	}
+	if *viz != "" && len(files) > 1 {
+		fmt.Fprintf(stderr, "porcupine: -viz can only be used with a single history file\n")
+		return exitUsage
+	}
+
+	overall := porcupine.Ok
+	for _, path := range files {
+		f := *format
+		if f == "" {
+			var err error
+			if f, err = detectFormat(path); err != nil {
+				fmt.Fprintf(stderr, "porcupine: %v\n", err)
+				return exitUsage
+			}
+		}
+		h, err := readHistory(path, f, m)
+		if err != nil {
+			fmt.Fprintf(stderr, "porcupine: reading %s: %v\n", path, err)
+			return exitUsage
+		}
+		res, err := check(path, h, m, *timeout, *viz, stdout)
+		if err != nil {
+			fmt.Fprintln(stderr, err)
+			return exitUsage
+		}
+		if res == porcupine.Illegal || (res == porcupine.Unknown && overall == porcupine.Ok) {
+			overall = res
+		}
+	}
+	switch overall {
+	case porcupine.Ok:
+		return exitOk
+	case porcupine.Illegal:
+		return exitIllegal
+	default:
+		return exitUnknown
+	}
+}
+
+// check checks a history, prints a summary of the result for each
+// partition, and writes the visualization if viz is not empty.
+func check(path string, h history, m builtinModel, timeout time.Duration, viz string, w io.Writer) (porcupine.CheckResult, error) {
+	start := time.Now()
+	var res porcupine.CheckResult
+	var info porcupine.LinearizationInfo
+	if h.ops != nil {
+		res, info = porcupine.CheckOperationsVerbose(m.model, h.ops, timeout)
+	} else {
+		res, info = porcupine.CheckEventsVerbose(m.model, h.events, timeout)
+	}
+	duration := time.Since(start)
+
+	partitions := info.Partitions()
+	fmt.Fprintf(w, "%s: %d operations in %d partitions\n", path, h.operations(), len(partitions))
+	for i, p := range partitions {
+		fmt.Fprintf(w, "  partition %d: %d operations, %s", i, p.Operations, p.Result)
+		if p.Result != porcupine.Ok {
+			fmt.Fprintf(w, " (linearized %d operations)", p.Linearized)
+		}
+		fmt.Fprintf(w, " in %v\n", p.Duration.Round(time.Microsecond))
+	}
+	fmt.Fprintf(w, "%s: %s (checked in %v)\n", path, res, duration.Round(time.Millisecond))
+
+	if viz != "" {
+		err := porcupine.VisualizePathWithOptions(m.model, info, viz, porcupine.VisualizationOptions{
+			Result:        res,
+			CheckDuration: duration,
+		})
+		if err != nil {
+			return res, err
+		}
+		fmt.Fprintf(w, "wrote visualization to %s\n", viz)
+	}
+	return res, nil
+}
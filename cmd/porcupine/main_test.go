@@ -0,0 +1,207 @@
+package main
+
+import (
+	"bytes"
+	"encoding/csv"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/anishathalye/porcupine"
+)
+
+// kvHistory is a key-value history where the get on x is linearizable only
+// if ok is true
+func kvHistory(ok bool) []porcupine.Operation {
+	read := "ab"
+	if !ok {
+		read = "b"
+	}
+	return []porcupine.Operation{
+		{ClientId: 0, Input: porcupine.CSVKVInput{Op: "put", Key: "x", Value: "a"}, Call: 0, Output: porcupine.CSVKVOutput{}, Return: 10},
+		{ClientId: 1, Input: porcupine.CSVKVInput{Op: "append", Key: "x", Value: "b"}, Call: 20, Output: porcupine.CSVKVOutput{}, Return: 30},
+		{ClientId: 0, Input: porcupine.CSVKVInput{Op: "get", Key: "x"}, Call: 40, Output: porcupine.CSVKVOutput{Value: read}, Return: 50},
+		{ClientId: 2, Input: porcupine.CSVKVInput{Op: "put", Key: "y", Value: "c"}, Call: 0, Output: porcupine.CSVKVOutput{}, Return: 10},
+	}
+}
+
+func writeFile(t *testing.T, path string, data []byte) {
+	if err := os.WriteFile(path, data, 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// writeFormats writes a history in every format that supports the kv model,
+// and returns the arguments to check each file
+func writeFormats(t *testing.T, dir string, ops []porcupine.Operation) [][]string {
+	events := porcupine.OperationsToEvents(ops)
+
+	data, err := porcupine.MarshalHistory(ops)
+	if err != nil {
+		t.Fatal(err)
+	}
+	writeFile(t, filepath.Join(dir, "history.json"), data)
+
+	data, err = porcupine.MarshalEvents(events)
+	if err != nil {
+		t.Fatal(err)
+	}
+	writeFile(t, filepath.Join(dir, "events.json"), data)
+
+	var b bytes.Buffer
+	if err := porcupine.WriteJSONL(&b, events); err != nil {
+		t.Fatal(err)
+	}
+	writeFile(t, filepath.Join(dir, "history.jsonl"), b.Bytes())
+
+	b.Reset()
+	if err := porcupine.WriteHistory(&b, ops); err != nil {
+		t.Fatal(err)
+	}
+	writeFile(t, filepath.Join(dir, "history.bin"), b.Bytes())
+
+	b.Reset()
+	w := csv.NewWriter(&b)
+	w.Write([]string{"client", "op", "key", "value", "call_ns", "return_ns"})
+	for _, op := range ops {
+		inp := op.Input.(porcupine.CSVKVInput)
+		value := inp.Value
+		if inp.Op == "get" {
+			value = op.Output.(porcupine.CSVKVOutput).Value
+		}
+		w.Write([]string{strconv.Itoa(op.ClientId), inp.Op, inp.Key, value, strconv.FormatInt(op.Call, 10), strconv.FormatInt(op.Return, 10)})
+	}
+	w.Flush()
+	writeFile(t, filepath.Join(dir, "history.csv"), b.Bytes())
+
+	return [][]string{
+		{filepath.Join(dir, "history.json")},
+		{"-format", "json-events", filepath.Join(dir, "events.json")},
+		{filepath.Join(dir, "history.jsonl")},
+		{filepath.Join(dir, "history.bin")},
+		{filepath.Join(dir, "history.csv")},
+	}
+}
+
+func runCLI(args ...string) (int, string, string) {
+	var stdout, stderr bytes.Buffer
+	code := run(args, &stdout, &stderr)
+	return code, stdout.String(), stderr.String()
+}
+
+func TestFormats(t *testing.T) {
+	for _, ok := range []bool{true, false} {
+		for _, args := range writeFormats(t, t.TempDir(), kvHistory(ok)) {
+			code, stdout, stderr := runCLI(append([]string{"check", "-model", "kv"}, args...)...)
+			expected := exitOk
+			if !ok {
+				expected = exitIllegal
+			}
+			if code != expected {
+				t.Fatalf("%v: expected exit code %d, got %d\n%s%s", args, expected, code, stdout, stderr)
+			}
+			if !strings.Contains(stdout, "4 operations in 2 partitions") {
+				t.Fatalf("%v: expected summary, got\n%s", args, stdout)
+			}
+			if !ok && !strings.Contains(stdout, "partition 0: 3 operations, Illegal (linearized 2 operations)") {
+				t.Fatalf("%v: expected illegal partition in summary, got\n%s", args, stdout)
+			}
+		}
+	}
+}
+
+func TestEDN(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "history.edn")
+	writeFile(t, path, []byte(`
+{:type :invoke, :f :write, :value 1, :process 0}
+{:type :ok, :f :write, :value 1, :process 0}
+{:type :invoke, :f :write, :value 2, :process 1}
+{:type :info, :f :write, :value 2, :process 1}
+{:type :invoke, :f :read, :value nil, :process 0}
+{:type :ok, :f :read, :value 2, :process 0}
+`))
+	if code, stdout, stderr := runCLI("check", "-model", "register", path); code != exitOk {
+		t.Fatalf("expected exit code %d, got %d\n%s%s", exitOk, code, stdout, stderr)
+	}
+	kvPath := filepath.Join(dir, "kv.edn")
+	writeFile(t, kvPath, []byte(`
+{:type :invoke, :f :write, :value [:x 1], :process 0}
+{:type :ok, :f :write, :value [:x 1], :process 0}
+{:type :invoke, :f :read, :value [:x nil], :process 0}
+{:type :ok, :f :read, :value [:x 2], :process 0}
+`))
+	if code, stdout, stderr := runCLI("check", "-model", "kv", kvPath); code != exitIllegal {
+		t.Fatalf("expected exit code %d, got %d\n%s%s", exitIllegal, code, stdout, stderr)
+	}
+}
+
+func TestVisualization(t *testing.T) {
+	dir := t.TempDir()
+	args := writeFormats(t, dir, kvHistory(false))[0]
+	viz := filepath.Join(dir, "out.html")
+	code, stdout, stderr := runCLI(append([]string{"check", "-model", "kv"}, append(args, "-viz", viz)...)...)
+	if code != exitIllegal {
+		t.Fatalf("expected exit code %d, got %d\n%s%s", exitIllegal, code, stdout, stderr)
+	}
+	data, err := os.ReadFile(viz)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(data), "append('x', 'b')") {
+		t.Fatal("expected visualization to describe operations")
+	}
+}
+
+func TestTimeout(t *testing.T) {
+	// many concurrent appends, followed by a read that can't be explained
+	var ops []porcupine.Operation
+	for i := 0; i < 16; i++ {
+		ops = append(ops, porcupine.Operation{ClientId: i, Input: porcupine.CSVKVInput{Op: "append", Key: "x", Value: strconv.Itoa(i)}, Call: 0, Output: porcupine.CSVKVOutput{}, Return: 100})
+	}
+	ops = append(ops, porcupine.Operation{ClientId: 16, Input: porcupine.CSVKVInput{Op: "get", Key: "x"}, Call: 200, Output: porcupine.CSVKVOutput{Value: "nope"}, Return: 300})
+	args := writeFormats(t, t.TempDir(), ops)[0]
+	code, stdout, stderr := runCLI(append([]string{"check", "-model", "kv", "-timeout", "1ms"}, args...)...)
+	if code != exitUnknown {
+		t.Fatalf("expected exit code %d, got %d\n%s%s", exitUnknown, code, stdout, stderr)
+	}
+}
+
+func TestErrors(t *testing.T) {
+	dir := t.TempDir()
+	kvArgs := writeFormats(t, dir, kvHistory(true))
+	tests := []struct {
+		args []string
+		err  string
+	}{
+		{[]string{}, "usage"},
+		{[]string{"frob"}, `unknown command "frob"`},
+		{[]string{"check", kvArgs[0][0]}, "-model is required"},
+		{[]string{"check", "-model", "queue", kvArgs[0][0]}, `unknown model "queue"`},
+		{[]string{"check", "-model", "kv"}, "no history files"},
+		{[]string{"check", "-model", "kv", "-bogus", kvArgs[0][0]}, "flag provided but not defined"},
+		{[]string{"check", "-model", "kv", filepath.Join(dir, "missing.json")}, "no such file"},
+		{[]string{"check", "-model", "kv", filepath.Join(dir, "history.txt")}, "can't detect the format"},
+		{[]string{"check", "-model", "register", kvArgs[0][0]}, `operation 0 has an input of type "kv.input", but the model expects "register.input"`},
+		{[]string{"check", "-model", "register", kvArgs[4][0]}, "csv format is not supported"},
+	}
+	for _, test := range tests {
+		code, stdout, stderr := runCLI(test.args...)
+		if code != exitUsage {
+			t.Fatalf("%v: expected exit code %d, got %d\n%s%s", test.args, exitUsage, code, stdout, stderr)
+		}
+		if !strings.Contains(stderr, test.err) {
+			t.Fatalf("%v: expected error containing %q, got\n%s", test.args, test.err, stderr)
+		}
+	}
+
+	// values of unregistered types
+	path := filepath.Join(dir, "other.jsonl")
+	writeFile(t, path, []byte(`{"clientId":0,"kind":"call","value":{"type":"queue.input","value":{}},"id":0}`+"\n"))
+	code, _, stderr := runCLI("check", "-model", "kv", path)
+	if code != exitUsage || !strings.Contains(stderr, `"queue.input" is not registered`) || !strings.Contains(stderr, `"kv.input"`) {
+		t.Fatalf("expected error explaining the expected types, got %d\n%s", code, stderr)
+	}
+}
@@ -0,0 +1,266 @@
+package main
+
+import (
+	"fmt"
+	"reflect"
+	"sort"
+
+	"github.com/anishathalye/porcupine"
+	"github.com/anishathalye/porcupine/jepsen"
+)
+
+// A builtinModel is a model that can be selected with -model, along with the
+// types of its inputs and outputs and the ways to read them from the history
+// formats that need model-specific mapping.
+type builtinModel struct {
+	model      porcupine.Model
+	input      interface{} // a value of the input type
+	output     interface{} // a value of the output type
+	inputName  string      // registered name of the input type
+	outputName string      // registered name of the output type
+	// edn converts Jepsen operations
+	edn jepsen.Mapper
+	// csvRow converts CSV rows, or is nil if the model has no CSV schema
+	csvRow func(record []string) (porcupine.Operation, error)
+}
+
+// registerInput is the input of the register model.
+type registerInput struct {
+	Op    string `json:"op"` // "read" or "write"
+	Value int    `json:"value"`
+}
+
+// registerOutput is the output of the register model.
+type registerOutput struct {
+	Value int `json:"value"` // for reads
+}
+
+var registerModel = porcupine.Model{
+	Init: func() interface{} {
+		return 0
+	},
+	Step: func(state, input, output interface{}) (bool, interface{}) {
+		inp := input.(registerInput)
+		if inp.Op == "write" {
+			return true, inp.Value
+		}
+		// a nil output is a pending read, which can return anything
+		return output == nil || output.(registerOutput).Value == state.(int), state
+	},
+	DescribeOperation: func(input, output interface{}) string {
+		inp := input.(registerInput)
+		if inp.Op == "write" {
+			return fmt.Sprintf("write(%d)", inp.Value)
+		}
+		if output == nil {
+			return "read() -> ?"
+		}
+		return fmt.Sprintf("read() -> %d", output.(registerOutput).Value)
+	},
+}
+
+var registerEDN = jepsen.Mapper{
+	Input: func(invoke jepsen.Op) (interface{}, error) {
+		switch invoke.F {
+		case jepsen.Keyword("read"):
+			return registerInput{Op: "read"}, nil
+		case jepsen.Keyword("write"):
+			v, ok := invoke.Value.(int64)
+			if !ok {
+				return nil, fmt.Errorf("expected an integer value for :write, got %v", invoke.Value)
+			}
+			return registerInput{Op: "write", Value: int(v)}, nil
+		}
+		return nil, fmt.Errorf("unsupported function %v for the register model", invoke.F)
+	},
+	Output: func(invoke, complete jepsen.Op) (interface{}, error) {
+		if complete.Type == "info" {
+			return nil, nil
+		}
+		if complete.F == jepsen.Keyword("read") {
+			v, ok := complete.Value.(int64)
+			if !ok && complete.Value != nil {
+				return nil, fmt.Errorf("expected an integer value for :read, got %v", complete.Value)
+			}
+			return registerOutput{Value: int(v)}, nil
+		}
+		return registerOutput{}, nil
+	},
+}
+
+var kvModel = porcupine.Model{
+	Partition: func(history []porcupine.Operation) [][]porcupine.Operation {
+		m := make(map[string][]porcupine.Operation)
+		for _, op := range history {
+			key := op.Input.(porcupine.CSVKVInput).Key
+			m[key] = append(m[key], op)
+		}
+		keys := make([]string, 0, len(m))
+		for key := range m {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		partitions := make([][]porcupine.Operation, len(keys))
+		for i, key := range keys {
+			partitions[i] = m[key]
+		}
+		return partitions
+	},
+	PartitionEvent: func(history []porcupine.Event) [][]porcupine.Event {
+		m := make(map[string][]porcupine.Event)
+		keys := make(map[int]string) // from id to key
+		for _, event := range history {
+			if event.Kind == porcupine.CallEvent {
+				keys[event.Id] = event.Value.(porcupine.CSVKVInput).Key
+			}
+			key := keys[event.Id]
+			m[key] = append(m[key], event)
+		}
+		sorted := make([]string, 0, len(m))
+		for key := range m {
+			sorted = append(sorted, key)
+		}
+		sort.Strings(sorted)
+		partitions := make([][]porcupine.Event, len(sorted))
+		for i, key := range sorted {
+			partitions[i] = m[key]
+		}
+		return partitions
+	},
+	Init: func() interface{} {
+		// the state of a single key, since histories are partitioned by key
+		return ""
+	},
+	Step: func(state, input, output interface{}) (bool, interface{}) {
+		inp := input.(porcupine.CSVKVInput)
+		st := state.(string)
+		switch inp.Op {
+		case "get":
+			// a nil output is a pending get, which can return anything
+			return output == nil || output.(porcupine.CSVKVOutput).Value == st, st
+		case "put":
+			return true, inp.Value
+		default:
+			return true, st + inp.Value
+		}
+	},
+	DescribeOperation: func(input, output interface{}) string {
+		inp := input.(porcupine.CSVKVInput)
+		switch inp.Op {
+		case "get":
+			if output == nil {
+				return fmt.Sprintf("get('%s') -> ?", inp.Key)
+			}
+			return fmt.Sprintf("get('%s') -> '%s'", inp.Key, output.(porcupine.CSVKVOutput).Value)
+		default:
+			return fmt.Sprintf("%s('%s', '%s')", inp.Op, inp.Key, inp.Value)
+		}
+	},
+}
+
+// kvEDN converts Jepsen key-value operations, whose values are [key value]
+// pairs, with :read, :write, and :append functions.
+var kvEDN = jepsen.Mapper{
+	Input: func(invoke jepsen.Op) (interface{}, error) {
+		key, value, err := kvPair(invoke.Value)
+		if err != nil {
+			return nil, err
+		}
+		switch invoke.F {
+		case jepsen.Keyword("read"):
+			return porcupine.CSVKVInput{Op: "get", Key: key}, nil
+		case jepsen.Keyword("write"):
+			return porcupine.CSVKVInput{Op: "put", Key: key, Value: value}, nil
+		case jepsen.Keyword("append"):
+			return porcupine.CSVKVInput{Op: "append", Key: key, Value: value}, nil
+		}
+		return nil, fmt.Errorf("unsupported function %v for the kv model", invoke.F)
+	},
+	Output: func(invoke, complete jepsen.Op) (interface{}, error) {
+		if complete.Type == "info" {
+			return nil, nil
+		}
+		if complete.F == jepsen.Keyword("read") {
+			_, value, err := kvPair(complete.Value)
+			if err != nil {
+				return nil, err
+			}
+			return porcupine.CSVKVOutput{Value: value}, nil
+		}
+		return porcupine.CSVKVOutput{}, nil
+	},
+}
+
+func kvPair(v interface{}) (string, string, error) {
+	pair, ok := v.([]interface{})
+	if !ok || len(pair) != 2 {
+		return "", "", fmt.Errorf("expected a [key value] pair, got %v", v)
+	}
+	key := fmt.Sprint(pair[0])
+	if pair[1] == nil {
+		return key, "", nil
+	}
+	return key, fmt.Sprint(pair[1]), nil
+}
+
+var builtinModels = map[string]builtinModel{
+	"register": {
+		model:      registerModel,
+		input:      registerInput{},
+		output:     registerOutput{},
+		inputName:  "register.input",
+		outputName: "register.output",
+		edn:        registerEDN,
+	},
+	"kv": {
+		model:      kvModel,
+		input:      porcupine.CSVKVInput{},
+		output:     porcupine.CSVKVOutput{},
+		inputName:  "kv.input",
+		outputName: "kv.output",
+		edn:        kvEDN,
+		csvRow:     porcupine.MapCSVKVRow,
+	},
+}
+
+// typeNames maps the input and output types of all builtin models to their
+// registered names, for error messages.
+var typeNames = make(map[reflect.Type]string)
+
+func init() {
+	for _, m := range builtinModels {
+		porcupine.RegisterType(m.inputName, m.input)
+		porcupine.RegisterType(m.outputName, m.output)
+		typeNames[reflect.TypeOf(m.input)] = m.inputName
+		typeNames[reflect.TypeOf(m.output)] = m.outputName
+	}
+}
+
+func modelNames() []string {
+	var names []string
+	for name := range builtinModels {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func describeType(v interface{}) string {
+	if name, ok := typeNames[reflect.TypeOf(v)]; ok {
+		return fmt.Sprintf("%q", name)
+	}
+	return fmt.Sprintf("%T", v)
+}
+
+// checkTypes makes sure that the inputs and outputs of a history have the
+// types expected by the model, so that a mismatch is reported as an error
+// instead of a panic in the model.
+func (m builtinModel) checkTypes(kind string, i int, input, output interface{}) error {
+	if input != nil && reflect.TypeOf(input) != reflect.TypeOf(m.input) {
+		return fmt.Errorf("%s %d has an input of type %s, but the model expects %q", kind, i, describeType(input), m.inputName)
+	}
+	if output != nil && reflect.TypeOf(output) != reflect.TypeOf(m.output) {
+		return fmt.Errorf("%s %d has an output of type %s, but the model expects %q", kind, i, describeType(output), m.outputName)
+	}
+	return nil
+}
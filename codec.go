@@ -0,0 +1,239 @@
+package porcupine
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"sync"
+)
+
+// The type registry maps between the names used in serialized histories and
+// the concrete types of inputs, outputs, and values.
+var registry = struct {
+	sync.RWMutex
+	types map[string]reflect.Type
+	names map[reflect.Type]string
+}{
+	types: make(map[string]reflect.Type),
+	names: make(map[reflect.Type]string),
+}
+
+// RegisterType records the concrete type of value under the given name, so
+// that values of that type can be serialized with [MarshalHistory] and
+// [MarshalEvents] and reconstructed with [UnmarshalHistory] and
+// [UnmarshalEvents]. Only the type of value is used, not its contents.
+//
+// Values are encoded with encoding/json, so registered types should either
+// have exported fields or implement [json.Marshaler] and [json.Unmarshaler].
+//
+// Like gob.RegisterName, RegisterType is meant to be called during
+// initialization, and it panics if value is nil, or if the name or the type
+// has already been registered with a different type or name.
+func RegisterType(name string, value interface{}) {
+	if value == nil {
+		panic("porcupine: RegisterType called with a nil value")
+	}
+	t := reflect.TypeOf(value)
+	registry.Lock()
+	defer registry.Unlock()
+	if existing, ok := registry.types[name]; ok && existing != t {
+		panic(fmt.Sprintf("porcupine: registering duplicate types for %q: %v != %v", name, existing, t))
+	}
+	if existing, ok := registry.names[t]; ok && existing != name {
+		panic(fmt.Sprintf("porcupine: registering duplicate names for %v: %q != %q", t, existing, name))
+	}
+	registry.types[name] = t
+	registry.names[t] = name
+}
+
+// typedValue is the serialized form of an input, output, or value, tagged
+// with the name of its registered type. A nil value is serialized as null.
+type typedValue struct {
+	Type  string          `json:"type"`
+	Value json.RawMessage `json:"value"`
+}
+
+type serializedOperation struct {
+	ClientId int         `json:"clientId"`
+	Input    *typedValue `json:"input"`
+	Call     int64       `json:"call"`
+	Output   *typedValue `json:"output"`
+	Return   int64       `json:"return"`
+}
+
+type serializedEvent struct {
+	ClientId int         `json:"clientId"`
+	Kind     string      `json:"kind"`
+	Value    *typedValue `json:"value"`
+	Id       int         `json:"id"`
+}
+
+const (
+	serializedCall   = "call"
+	serializedReturn = "return"
+)
+
+func encodeValue(value interface{}) (*typedValue, error) {
+	if value == nil {
+		return nil, nil
+	}
+	registry.RLock()
+	name, ok := registry.names[reflect.TypeOf(value)]
+	registry.RUnlock()
+	if !ok {
+		return nil, fmt.Errorf("porcupine: type %T is not registered", value)
+	}
+	data, err := json.Marshal(value)
+	if err != nil {
+		return nil, fmt.Errorf("porcupine: encoding value of type %T: %w", value, err)
+	}
+	return &typedValue{Type: name, Value: data}, nil
+}
+
+func decodeValue(tv *typedValue) (interface{}, error) {
+	if tv == nil {
+		return nil, nil
+	}
+	registry.RLock()
+	t, ok := registry.types[tv.Type]
+	registry.RUnlock()
+	if !ok {
+		return nil, fmt.Errorf("porcupine: type name %q is not registered", tv.Type)
+	}
+	ptr := reflect.New(t)
+	if err := json.Unmarshal(tv.Value, ptr.Interface()); err != nil {
+		return nil, fmt.Errorf("porcupine: decoding value of type %q: %w", tv.Type, err)
+	}
+	return ptr.Elem().Interface(), nil
+}
+
+// MarshalHistory serializes a history of operations as JSON. Each input and
+// output is tagged with the name of its type, as registered with
+// [RegisterType], so that [UnmarshalHistory] can reconstruct the concrete
+// values. Nil inputs and outputs, such as the outputs of pending operations,
+// are serialized as null.
+//
+// It returns an error naming the offending type if an input or output has a
+// type that has not been registered.
+func MarshalHistory(history []Operation) ([]byte, error) {
+	ops := make([]serializedOperation, len(history))
+	for i, op := range history {
+		input, err := encodeValue(op.Input)
+		if err != nil {
+			return nil, fmt.Errorf("%w (input of operation %d)", err, i)
+		}
+		output, err := encodeValue(op.Output)
+		if err != nil {
+			return nil, fmt.Errorf("%w (output of operation %d)", err, i)
+		}
+		ops[i] = serializedOperation{
+			ClientId: op.ClientId,
+			Input:    input,
+			Call:     op.Call,
+			Output:   output,
+			Return:   op.Return,
+		}
+	}
+	return json.Marshal(ops)
+}
+
+// UnmarshalHistory deserializes a history of operations that was serialized
+// with [MarshalHistory]. The types of all inputs and outputs must have been
+// registered with [RegisterType].
+func UnmarshalHistory(data []byte) ([]Operation, error) {
+	var ops []serializedOperation
+	if err := json.Unmarshal(data, &ops); err != nil {
+		return nil, fmt.Errorf("porcupine: decoding history: %w", err)
+	}
+	history := make([]Operation, len(ops))
+	for i, op := range ops {
+		input, err := decodeValue(op.Input)
+		if err != nil {
+			return nil, fmt.Errorf("%w (input of operation %d)", err, i)
+		}
+		output, err := decodeValue(op.Output)
+		if err != nil {
+			return nil, fmt.Errorf("%w (output of operation %d)", err, i)
+		}
+		history[i] = Operation{
+			ClientId: op.ClientId,
+			Input:    input,
+			Call:     op.Call,
+			Output:   output,
+			Return:   op.Return,
+		}
+	}
+	return history, nil
+}
+
+// MarshalEvents serializes a history of events as JSON, like
+// [MarshalHistory] does for operations.
+func MarshalEvents(history []Event) ([]byte, error) {
+	events := make([]serializedEvent, len(history))
+	for i, event := range history {
+		e, err := encodeEvent(event)
+		if err != nil {
+			return nil, fmt.Errorf("%w (value of event %d)", err, i)
+		}
+		events[i] = e
+	}
+	return json.Marshal(events)
+}
+
+// UnmarshalEvents deserializes a history of events that was serialized with
+// [MarshalEvents]. The types of all values must have been registered with
+// [RegisterType].
+func UnmarshalEvents(data []byte) ([]Event, error) {
+	var events []serializedEvent
+	if err := json.Unmarshal(data, &events); err != nil {
+		return nil, fmt.Errorf("porcupine: decoding events: %w", err)
+	}
+	history := make([]Event, len(events))
+	for i, e := range events {
+		event, err := decodeEvent(e)
+		if err != nil {
+			return nil, fmt.Errorf("%w (event %d)", err, i)
+		}
+		history[i] = event
+	}
+	return history, nil
+}
+
+func encodeEvent(event Event) (serializedEvent, error) {
+	value, err := encodeValue(event.Value)
+	if err != nil {
+		return serializedEvent{}, err
+	}
+	kind := serializedCall
+	if event.Kind == ReturnEvent {
+		kind = serializedReturn
+	}
+	return serializedEvent{
+		ClientId: event.ClientId,
+		Kind:     kind,
+		Value:    value,
+		Id:       event.Id,
+	}, nil
+}
+
+func decodeEvent(e serializedEvent) (Event, error) {
+	value, err := decodeValue(e.Value)
+	if err != nil {
+		return Event{}, err
+	}
+	var kind EventKind
+	switch e.Kind {
+	case serializedCall:
+		kind = CallEvent
+	case serializedReturn:
+		kind = ReturnEvent
+	default:
+		return Event{}, fmt.Errorf("porcupine: unknown event kind %q", e.Kind)
+	}
+	return Event{
+		ClientId: e.ClientId,
+		Kind:     kind,
+		Value:    value,
+		Id:       e.Id,
+	}, nil
+}
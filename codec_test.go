@@ -0,0 +1,153 @@
+package porcupine
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"testing"
+)
+
+// kvInput and kvOutput have unexported fields, so they implement
+// json.Marshaler and json.Unmarshaler to be serializable
+
+type kvInputJSON struct {
+	Op    uint8  `json:"op"`
+	Key   string `json:"key"`
+	Value string `json:"value"`
+}
+
+func (i kvInput) MarshalJSON() ([]byte, error) {
+	return json.Marshal(kvInputJSON{i.op, i.key, i.value})
+}
+
+func (i *kvInput) UnmarshalJSON(data []byte) error {
+	var v kvInputJSON
+	if err := json.Unmarshal(data, &v); err != nil {
+		return err
+	}
+	*i = kvInput{v.Op, v.Key, v.Value}
+	return nil
+}
+
+func (o kvOutput) MarshalJSON() ([]byte, error) {
+	return json.Marshal(o.value)
+}
+
+func (o *kvOutput) UnmarshalJSON(data []byte) error {
+	return json.Unmarshal(data, &o.value)
+}
+
+type codecRegisterInput struct {
+	Get   bool `json:"get"`
+	Value int  `json:"value"`
+}
+
+func init() {
+	RegisterType("kvInput", kvInput{})
+	RegisterType("kvOutput", kvOutput{})
+	RegisterType("codecRegisterInput", codecRegisterInput{})
+	RegisterType("int", 0)
+}
+
+func TestMarshalHistory(t *testing.T) {
+	ops := []Operation{
+		{0, codecRegisterInput{false, 100}, 0, 0, 100},
+		{1, codecRegisterInput{true, 0}, 25, 100, 75},
+		{2, codecRegisterInput{true, 0}, 30, nil, 80}, // pending
+	}
+	data, err := MarshalHistory(ops)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(data), `"input":{"type":"codecRegisterInput","value":{"get":false,"value":100}}`) {
+		t.Fatalf("expected tagged input, got %s", data)
+	}
+	decoded, err := UnmarshalHistory(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(decoded) != len(ops) {
+		t.Fatalf("expected %v, got %v", ops, decoded)
+	}
+	for i := range ops {
+		if decoded[i] != ops[i] {
+			t.Fatalf("expected %v, got %v", ops, decoded)
+		}
+	}
+}
+
+func TestMarshalEventsVerdicts(t *testing.T) {
+	for _, logName := range []string{"c01-bad", "c01-ok", "c10-bad", "c10-ok"} {
+		events := parseKvLog(fmt.Sprintf("test_data/kv/%s.txt", logName))
+		data, err := MarshalEvents(events)
+		if err != nil {
+			t.Fatalf("%s: %v", logName, err)
+		}
+		decoded, err := UnmarshalEvents(data)
+		if err != nil {
+			t.Fatalf("%s: %v", logName, err)
+		}
+		if len(decoded) != len(events) {
+			t.Fatalf("%s: expected %d events, got %d", logName, len(events), len(decoded))
+		}
+		for i := range events {
+			if decoded[i] != events[i] {
+				t.Fatalf("%s: expected event %d to be %+v, got %+v", logName, i, events[i], decoded[i])
+			}
+		}
+		if CheckEvents(kvModel, decoded) != CheckEvents(kvModel, events) {
+			t.Fatalf("%s: expected decoded events to have the same verdict", logName)
+		}
+
+		ops, err := EventsToOperations(events)
+		if err != nil {
+			t.Fatalf("%s: %v", logName, err)
+		}
+		data, err = MarshalHistory(ops)
+		if err != nil {
+			t.Fatalf("%s: %v", logName, err)
+		}
+		decodedOps, err := UnmarshalHistory(data)
+		if err != nil {
+			t.Fatalf("%s: %v", logName, err)
+		}
+		if CheckOperations(kvModel, decodedOps) != CheckOperations(kvModel, ops) {
+			t.Fatalf("%s: expected decoded operations to have the same verdict", logName)
+		}
+	}
+}
+
+func TestMarshalUnregistered(t *testing.T) {
+	ops := []Operation{
+		{0, codecRegisterInput{true, 0}, 0, 0, 10},
+		{0, registerInput{true, 0}, 20, 0, 30},
+	}
+	_, err := MarshalHistory(ops)
+	if err == nil || !strings.Contains(err.Error(), "porcupine.registerInput") {
+		t.Fatalf("expected error naming the unregistered type, got %v", err)
+	}
+	events := []Event{{0, CallEvent, registerInput{true, 0}, 0}}
+	_, err = MarshalEvents(events)
+	if err == nil || !strings.Contains(err.Error(), "porcupine.registerInput") {
+		t.Fatalf("expected error naming the unregistered type, got %v", err)
+	}
+	_, err = UnmarshalHistory([]byte(`[{"clientId":0,"input":{"type":"unknownInput","value":{}},"call":0,"output":null,"return":1}]`))
+	if err == nil || !strings.Contains(err.Error(), `"unknownInput"`) {
+		t.Fatalf("expected error naming the unregistered type, got %v", err)
+	}
+	_, err = UnmarshalEvents([]byte(`[{"clientId":0,"kind":"sideways","value":null,"id":0}]`))
+	if err == nil {
+		t.Fatal("expected error for unknown event kind")
+	}
+}
+
+func TestRegisterTypeDuplicate(t *testing.T) {
+	// registering the same name and type again is allowed
+	RegisterType("kvInput", kvInput{})
+	defer func() {
+		if recover() == nil {
+			t.Fatal("expected RegisterType to panic for a duplicate name")
+		}
+	}()
+	RegisterType("kvInput", kvOutput{})
+}
@@ -0,0 +1,154 @@
+package porcupine
+
+import "sort"
+
+// A ConcurrencySample describes how many operations of a history were open,
+// that is, called but not yet returned, during the times from Start to End,
+// inclusive. An operation is open from its call time to its return time,
+// inclusive.
+type ConcurrencySample struct {
+	Start int64
+	End   int64
+	// Max is the largest number of operations that were open at the same
+	// time.
+	Max int
+	// Mean is the number of open operations averaged over the times of
+	// the sample.
+	Mean float64
+}
+
+// ConcurrencyProfile divides the time spanned by a history into at most
+// buckets samples of equal width, from the first call to the last return,
+// and returns how many operations were open during each one. Checking is
+// exponential in the number of concurrently open operations, so this shows
+// which parts of a history are hard to check. The last sample may be shorter
+// than the others, and there are fewer samples than buckets if the history
+// spans fewer than buckets times.
+//
+// It returns nil if the history is empty or buckets isn't positive.
+func ConcurrencyProfile(ops []Operation, buckets int) []ConcurrencySample {
+	if len(ops) == 0 || buckets <= 0 {
+		return nil
+	}
+	start, end := historySpan(ops)
+	return concurrencyProfile(ops, start, end, buckets)
+}
+
+// PartitionConcurrencyProfiles is like [ConcurrencyProfile], but returns a
+// profile for each partition of the history according to the model, in the
+// order of the partitions returned by the model's Partition function. Since
+// the partitions are checked independently, it is the concurrency within
+// each partition that determines how hard the check is. All profiles span
+// the times of the whole history, so that their samples line up.
+func PartitionConcurrencyProfiles(model Model, ops []Operation, buckets int) [][]ConcurrencySample {
+	if len(ops) == 0 || buckets <= 0 {
+		return nil
+	}
+	model = fillDefault(model)
+	start, end := historySpan(ops)
+	partitions := model.Partition(ops)
+	profiles := make([][]ConcurrencySample, len(partitions))
+	for i, partition := range partitions {
+		profiles[i] = concurrencyProfile(partition, start, end, buckets)
+	}
+	return profiles
+}
+
+// MaxConcurrency returns the largest number of operations of a history that
+// were open at the same time.
+func MaxConcurrency(ops []Operation) int {
+	max := 0
+	open := 0
+	for _, change := range concurrencyChanges(ops) {
+		open += change.delta
+		if open > max {
+			max = open
+		}
+	}
+	return max
+}
+
+// historySpan returns the first call time and the last return time of a
+// non-empty history.
+func historySpan(ops []Operation) (int64, int64) {
+	start, end := ops[0].Call, ops[0].Return
+	for _, op := range ops[1:] {
+		if op.Call < start {
+			start = op.Call
+		}
+		if op.Return > end {
+			end = op.Return
+		}
+	}
+	return start, end
+}
+
+type concurrencyChange struct {
+	time  int64
+	delta int
+}
+
+// concurrencyChanges returns the times at which the number of open
+// operations changes, in increasing order, with the change at each time.
+func concurrencyChanges(ops []Operation) []concurrencyChange {
+	deltas := make(map[int64]int)
+	for _, op := range ops {
+		deltas[op.Call]++
+		// the operation is still open at its return time
+		deltas[op.Return+1]--
+	}
+	changes := make([]concurrencyChange, 0, len(deltas))
+	for time, delta := range deltas {
+		if delta != 0 {
+			changes = append(changes, concurrencyChange{time, delta})
+		}
+	}
+	sort.Slice(changes, func(i, j int) bool {
+		return changes[i].time < changes[j].time
+	})
+	return changes
+}
+
+// concurrencyProfile computes the profile of a history in buckets spanning
+// the times [start, end], like computeOverview does for visualizations.
+func concurrencyProfile(ops []Operation, start, end int64, buckets int) []ConcurrencySample {
+	span := uint64(end-start) + 1
+	width := span / uint64(buckets)
+	if span%uint64(buckets) != 0 {
+		width++
+	}
+	n := int((span + width - 1) / width)
+	samples := make([]ConcurrencySample, n)
+	changes := concurrencyChanges(ops)
+	next := 0
+	open := 0
+	for i := range samples {
+		sample := &samples[i]
+		sample.Start = start + int64(i)*int64(width)
+		sample.End = sample.Start + int64(width) - 1
+		if sample.End > end {
+			sample.End = end
+		}
+		// apply the changes up to the start of the bucket, and then
+		// integrate the number of open operations over the bucket
+		for next < len(changes) && changes[next].time <= sample.Start {
+			open += changes[next].delta
+			next++
+		}
+		sample.Max = open
+		var total float64
+		t := sample.Start
+		for next < len(changes) && changes[next].time <= sample.End {
+			total += float64(open) * float64(changes[next].time-t)
+			t = changes[next].time
+			open += changes[next].delta
+			next++
+			if open > sample.Max {
+				sample.Max = open
+			}
+		}
+		total += float64(open) * float64(sample.End-t+1)
+		sample.Mean = total / float64(sample.End-sample.Start+1)
+	}
+	return samples
+}
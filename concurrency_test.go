@@ -0,0 +1,70 @@
+package porcupine
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestConcurrencyProfile(t *testing.T) {
+	ops := []Operation{
+		{0, kvInput{op: 1, key: "x", value: "a"}, 0, kvOutput{}, 9},
+		{1, kvInput{op: 1, key: "y", value: "b"}, 5, kvOutput{}, 14},
+		{2, kvInput{op: 0, key: "x"}, 10, kvOutput{"a"}, 19},
+		{0, kvInput{op: 0, key: "y"}, 12, kvOutput{"b"}, 13},
+	}
+	if c := MaxConcurrency(ops); c != 3 {
+		t.Fatalf("expected max concurrency 3, got %d", c)
+	}
+	expected := []ConcurrencySample{
+		{Start: 0, End: 9, Max: 2, Mean: 1.5},
+		{Start: 10, End: 19, Max: 3, Mean: 1.7},
+	}
+	if profile := ConcurrencyProfile(ops, 2); !reflect.DeepEqual(profile, expected) {
+		t.Fatalf("expected %v, got %v", expected, profile)
+	}
+	// the last bucket is shorter
+	expected = []ConcurrencySample{
+		{Start: 0, End: 6, Max: 2, Mean: 9.0 / 7},
+		{Start: 7, End: 13, Max: 3, Mean: 16.0 / 7},
+		{Start: 14, End: 19, Max: 2, Mean: 7.0 / 6},
+	}
+	if profile := ConcurrencyProfile(ops, 3); !reflect.DeepEqual(profile, expected) {
+		t.Fatalf("expected %v, got %v", expected, profile)
+	}
+	// there's at most one bucket per time
+	if profile := ConcurrencyProfile(ops, 100); len(profile) != 20 || profile[12].Max != 3 || profile[12].Mean != 3 {
+		t.Fatalf("expected a bucket per time, got %v", profile)
+	}
+	if profile := ConcurrencyProfile(nil, 10); profile != nil {
+		t.Fatalf("expected no profile, got %v", profile)
+	}
+
+	expectedPartitions := [][]ConcurrencySample{
+		{{Start: 0, End: 9, Max: 1, Mean: 1}, {Start: 10, End: 19, Max: 1, Mean: 1}},
+		{{Start: 0, End: 9, Max: 1, Mean: 0.5}, {Start: 10, End: 19, Max: 2, Mean: 0.7}},
+	}
+	if profiles := PartitionConcurrencyProfiles(kvModel, ops, 2); !reflect.DeepEqual(profiles, expectedPartitions) {
+		t.Fatalf("expected %v, got %v", expectedPartitions, profiles)
+	}
+}
+
+func TestConcurrencyProfileJepsen(t *testing.T) {
+	ops, err := EventsToOperations(parseJepsenLog("test_data/jepsen/etcd_000.log"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	max := MaxConcurrency(ops)
+	profile := ConcurrencyProfile(ops, 50)
+	profileMax := 0
+	for _, sample := range profile {
+		if sample.Mean > float64(sample.Max) {
+			t.Fatalf("expected mean to be at most max, got %v", sample)
+		}
+		if sample.Max > profileMax {
+			profileMax = sample.Max
+		}
+	}
+	if profileMax != max {
+		t.Fatalf("expected profile max %d to be max concurrency %d", profileMax, max)
+	}
+}
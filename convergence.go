@@ -0,0 +1,184 @@
+package porcupine
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// ConvergenceOptions configures [CheckConvergence].
+type ConvergenceOptions struct {
+	// Gap is how long no write to an object may be in flight, in the
+	// units of the history's timestamps, for the object to be quiescent:
+	// the time that replicas get to converge after the writes stop.
+	Gap int64
+	// IsWrite returns whether an operation is a write, from its input.
+	// Other operations are reads, whose output is the value they read.
+	IsWrite func(input interface{}) bool
+	// Key returns the key of the object that an operation accesses, from
+	// its input. Convergence is checked for each object. If left nil, the
+	// history is of a single object.
+	Key func(input interface{}) string
+	// Merge returns the value that the object converges to, from the
+	// inputs of the writes to it that were called before it became
+	// quiescent, in the order of their calls. If left nil, reads only
+	// need to agree with each other.
+	Merge func(writes []interface{}) interface{}
+	// Equal compares values that reads returned, and the values that
+	// Merge returns. If left nil, values are compared with ==.
+	Equal func(value1, value2 interface{}) bool
+}
+
+// A Divergence is a pair of reads of a quiescent object that returned
+// different values, or a read whose value isn't the merge of the writes.
+type Divergence struct {
+	Key string
+	// Quiescent is the time when the object became quiescent, Gap after
+	// the writes before it were all done.
+	Quiescent int64
+	// First and Second are the indices in the history of the reads: the
+	// earliest read after the object became quiescent, and a read that
+	// returned a different value. Second is -1 if First returned a value
+	// other than Expected, the merge of the writes.
+	First, Second int
+	Expected      interface{}
+	// Description describes the divergence, with the times of the reads.
+	Description string
+}
+
+func (d Divergence) String() string {
+	return d.Description
+}
+
+// A ConvergenceReport is the result of [CheckConvergence].
+type ConvergenceReport struct {
+	// Quiescent is the number of times that an object became quiescent
+	// and was read before the next write to it.
+	Quiescent int
+	// Divergences lists the reads that didn't converge, by key, and then
+	// in the order of the times the objects became quiescent.
+	Divergences []Divergence
+}
+
+// Ok returns whether the reads converged.
+func (r ConvergenceReport) Ok() bool {
+	return len(r.Divergences) == 0
+}
+
+func (r ConvergenceReport) String() string {
+	if r.Ok() {
+		return fmt.Sprintf("converged at %d quiescent points", r.Quiescent)
+	}
+	var b strings.Builder
+	fmt.Fprintf(&b, "%d divergences at %d quiescent points", len(r.Divergences), r.Quiescent)
+	for _, d := range r.Divergences {
+		fmt.Fprintf(&b, "\n  - %s", d.Description)
+	}
+	return b.String()
+}
+
+// CheckConvergence checks that the reads of an eventually consistent history
+// converge once the writes stop, which is all that systems that stay available
+// under partitions can promise, and much weaker than linearizability.
+//
+// After a write to an object, the object is quiescent once no write to it has
+// been in flight for ConvergenceOptions.Gap, until the next call of a write to
+// it. The reads of the object that are called after it became quiescent, and
+// return before the next write's call, must all return the same value, and the merge of the
+// writes called before, if there's a Merge function. Reads at other times
+// aren't checked, and neither are objects that never become quiescent.
+func CheckConvergence(history []Operation, opts ConvergenceOptions) ConvergenceReport {
+	if opts.IsWrite == nil {
+		panic("porcupine: CheckConvergence needs an IsWrite function")
+	}
+	equal := opts.Equal
+	if equal == nil {
+		equal = func(value1, value2 interface{}) bool { return value1 == value2 }
+	}
+	type object struct{ writes, reads []int }
+	objects := make(map[string]*object)
+	for i, op := range history {
+		key := ""
+		if opts.Key != nil {
+			key = opts.Key(op.Input)
+		}
+		o := objects[key]
+		if o == nil {
+			o = &object{}
+			objects[key] = o
+		}
+		if opts.IsWrite(op.Input) {
+			o.writes = append(o.writes, i)
+		} else {
+			o.reads = append(o.reads, i)
+		}
+	}
+	keys := make([]string, 0, len(objects))
+	for key := range objects {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	byCall := func(ops []int) {
+		sort.SliceStable(ops, func(a, b int) bool { return history[ops[a]].Call < history[ops[b]].Call })
+	}
+	var report ConvergenceReport
+	for _, key := range keys {
+		o := objects[key]
+		byCall(o.writes)
+		byCall(o.reads)
+		// the object is quiescent from Gap after the writes before the
+		// next one are done, until the next one is called
+		var done int64
+		for w := 1; w <= len(o.writes); w++ {
+			if w == 1 || history[o.writes[w-1]].Return > done {
+				done = history[o.writes[w-1]].Return
+			}
+			if w < len(o.writes) && history[o.writes[w]].Call <= done {
+				continue
+			}
+			quiescent := done + opts.Gap
+			var reads []int
+			start := sort.Search(len(o.reads), func(i int) bool { return history[o.reads[i]].Call >= quiescent })
+			for _, r := range o.reads[start:] {
+				op := history[r]
+				if w < len(o.writes) && op.Call >= history[o.writes[w]].Call {
+					break
+				}
+				if w == len(o.writes) || op.Return < history[o.writes[w]].Call {
+					reads = append(reads, r)
+				}
+			}
+			if len(reads) == 0 {
+				continue
+			}
+			report.Quiescent++
+			d := Divergence{Key: key, Quiescent: quiescent, First: reads[0], Second: -1}
+			at := fmt.Sprintf("quiescent at %d", quiescent)
+			if key != "" {
+				at = fmt.Sprintf("%q %s", key, at)
+			}
+			if opts.Merge != nil {
+				inputs := make([]interface{}, w)
+				for i := range inputs {
+					inputs[i] = history[o.writes[i]].Input
+				}
+				d.Expected = opts.Merge(inputs)
+				if first := history[reads[0]]; !equal(first.Output, d.Expected) {
+					d.Description = fmt.Sprintf("%s: read %d, at %d to %d, returned %v, not %v", at, reads[0], first.Call, first.Return, first.Output, d.Expected)
+					report.Divergences = append(report.Divergences, d)
+				}
+			}
+			for _, r := range reads[1:] {
+				first, op := history[reads[0]], history[r]
+				if equal(first.Output, op.Output) {
+					continue
+				}
+				d := d
+				d.Second = r
+				d.Description = fmt.Sprintf("%s: read %d, at %d to %d, returned %v, but read %d, at %d to %d, returned %v", at, reads[0], first.Call, first.Return, first.Output, r, op.Call, op.Return, op.Output)
+				report.Divergences = append(report.Divergences, d)
+			}
+		}
+	}
+	return report
+}
@@ -0,0 +1,104 @@
+package porcupine
+
+import (
+	"sort"
+	"strings"
+	"testing"
+)
+
+func kvPut(client int, key, value string, call, ret int64) Operation {
+	return Operation{client, kvInput{op: 1, key: key, value: value}, call, kvOutput{}, ret}
+}
+
+// kvGet returns a read whose output is the value itself, as CheckConvergence
+// expects.
+func kvGet(client int, key, value string, call, ret int64) Operation {
+	return Operation{client, kvInput{op: 0, key: key}, call, value, ret}
+}
+
+// kvConvergence merges writes into the set of their values, like a
+// grow-only set that reads return as a sorted, comma-separated list.
+var kvConvergence = ConvergenceOptions{
+	Gap:     10,
+	IsWrite: func(input interface{}) bool { return input.(kvInput).op != 0 },
+	Key:     func(input interface{}) string { return input.(kvInput).key },
+	Merge: func(writes []interface{}) interface{} {
+		var values []string
+		for _, w := range writes {
+			values = append(values, w.(kvInput).value)
+		}
+		sort.Strings(values)
+		return strings.Join(values, ",")
+	},
+}
+
+func TestConvergence(t *testing.T) {
+	ops := []Operation{
+		kvPut(0, "x", "a", 0, 10),
+		kvPut(1, "x", "b", 5, 15),
+		// before the gap, reads may diverge
+		kvGet(2, "x", "a", 16, 20),
+		kvGet(2, "x", "a,b", 30, 35),
+		kvGet(3, "x", "a,b", 40, 45),
+		// and they may while a write is in flight
+		kvPut(0, "x", "c", 50, 60),
+		kvGet(3, "x", "a,b", 48, 55),
+		kvGet(2, "x", "a,b,c", 70, 75),
+		kvPut(0, "y", "d", 0, 10),
+		kvGet(1, "y", "d", 100, 110),
+	}
+	report := CheckConvergence(ops, kvConvergence)
+	if !report.Ok() || report.Quiescent != 3 {
+		t.Fatalf("expected the reads to converge at 3 quiescent points, got %s", report)
+	}
+	// without a merge function, reads only need to agree
+	opts := kvConvergence
+	opts.Merge = nil
+	ops[4].Output = "b,a"
+	if report := CheckConvergence(ops, opts); len(report.Divergences) != 1 {
+		t.Fatalf("expected one divergence, got %s", report)
+	}
+	ops[3].Output, ops[7].Output = "b,a", "whatever"
+	if report := CheckConvergence(ops, opts); !report.Ok() {
+		t.Fatalf("expected the reads to converge, got %s", report)
+	}
+}
+
+func TestDivergentReads(t *testing.T) {
+	ops := []Operation{
+		kvPut(0, "x", "a", 0, 10),
+		kvPut(1, "x", "b", 5, 15),
+		kvGet(2, "x", "a,b", 30, 35),
+		kvGet(3, "x", "a", 40, 45),
+		kvGet(4, "x", "a,b", 50, 55),
+	}
+	report := CheckConvergence(ops, kvConvergence)
+	if len(report.Divergences) != 1 {
+		t.Fatalf("expected one divergence, got %s", report)
+	}
+	d := report.Divergences[0]
+	if d.Key != "x" || d.Quiescent != 25 || d.First != 2 || d.Second != 3 {
+		t.Fatalf("unexpected divergence %+v", d)
+	}
+	expected := `"x" quiescent at 25: read 2, at 30 to 35, returned a,b, but read 3, at 40 to 45, returned a`
+	if d.Description != expected {
+		t.Fatalf("expected %q, got %q", expected, d.Description)
+	}
+}
+
+func TestConvergenceToMerge(t *testing.T) {
+	// the reads agree, but lost a write
+	ops := []Operation{
+		kvPut(0, "x", "a", 0, 10),
+		kvPut(1, "x", "b", 20, 30),
+		kvGet(2, "x", "b", 50, 55),
+		kvGet(3, "x", "b", 60, 65),
+	}
+	report := CheckConvergence(ops, kvConvergence)
+	if len(report.Divergences) != 1 {
+		t.Fatalf("expected one divergence, got %s", report)
+	}
+	if d := report.Divergences[0]; d.First != 2 || d.Second != -1 || d.Expected != "a,b" || d.Quiescent != 40 {
+		t.Fatalf("unexpected divergence %+v", d)
+	}
+}
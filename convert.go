@@ -0,0 +1,96 @@
+package porcupine
+
+import (
+	"fmt"
+	"sort"
+)
+
+// EventsToOperations converts a history of events into a history of
+// operations, by pairing each call with the return that has the same Id.
+//
+// Events don't have timestamps, so the Call and Return timestamps of the
+// operations are the positions of the call and return events in the history.
+// This preserves the real-time order of the events, so the converted history
+// is linearizable if and only if the events are. The ClientId of an operation
+// is taken from its call event. Operations are returned in the order of their
+// call events.
+//
+// It returns an error if an Id is used by more than one call or return, or if
+// a call has no matching return or vice versa.
+func EventsToOperations(events []Event) ([]Operation, error) {
+	index := make(map[int]int) // from Id to index in ops
+	returned := make(map[int]bool)
+	var ops []Operation
+	for i, event := range events {
+		switch event.Kind {
+		case CallEvent:
+			if _, ok := index[event.Id]; ok {
+				return nil, fmt.Errorf("porcupine: duplicate call event for id %d at position %d", event.Id, i)
+			}
+			index[event.Id] = len(ops)
+			ops = append(ops, Operation{
+				ClientId: event.ClientId,
+				Input:    event.Value,
+				Call:     int64(i),
+			})
+		case ReturnEvent:
+			j, ok := index[event.Id]
+			if !ok {
+				return nil, fmt.Errorf("porcupine: return event for id %d at position %d has no preceding call", event.Id, i)
+			}
+			if returned[event.Id] {
+				return nil, fmt.Errorf("porcupine: duplicate return event for id %d at position %d", event.Id, i)
+			}
+			returned[event.Id] = true
+			ops[j].Output = event.Value
+			ops[j].Return = int64(i)
+		}
+	}
+	for _, op := range ops {
+		if op.Return == 0 {
+			// a return can't be the first event, so this call has no return
+			return nil, fmt.Errorf("porcupine: call event at position %d has no matching return", op.Call)
+		}
+	}
+	return ops, nil
+}
+
+// OperationsToEvents converts a history of operations into a history of
+// events, ordered by time, with a call and a return event for each
+// operation. The events of the operation at index i in ops have Id i.
+//
+// Events at the same time are ordered so that calls come before returns,
+// which means that operations that return at the same time as others are
+// called are treated as concurrent, like [CheckOperations] does. In
+// particular, an operation with zero duration is called before it returns.
+// Calls at the same time, and returns at the same time, are ordered by the
+// index of their operation. An operation whose Return timestamp is before
+// its Call timestamp is treated as returning at its call time, so a call
+// never comes after its own return.
+func OperationsToEvents(ops []Operation) []Event {
+	type timedEvent struct {
+		time  int64
+		event Event
+	}
+	events := make([]timedEvent, 0, 2*len(ops))
+	for i, op := range ops {
+		ret := op.Return
+		if ret < op.Call {
+			ret = op.Call
+		}
+		events = append(events,
+			timedEvent{op.Call, Event{ClientId: op.ClientId, Kind: CallEvent, Value: op.Input, Id: i}},
+			timedEvent{ret, Event{ClientId: op.ClientId, Kind: ReturnEvent, Value: op.Output, Id: i}})
+	}
+	sort.SliceStable(events, func(i, j int) bool {
+		if events[i].time != events[j].time {
+			return events[i].time < events[j].time
+		}
+		return events[i].event.Kind == CallEvent && events[j].event.Kind == ReturnEvent
+	})
+	result := make([]Event, len(events))
+	for i, e := range events {
+		result[i] = e.event
+	}
+	return result
+}
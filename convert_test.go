@@ -0,0 +1,152 @@
+package porcupine
+
+import (
+	"fmt"
+	"testing"
+)
+
+func TestEventsToOperations(t *testing.T) {
+	events := []Event{
+		{0, CallEvent, registerInput{false, 100}, 0},
+		{1, CallEvent, registerInput{true, 0}, 1},
+		{1, ReturnEvent, 100, 1},
+		{0, ReturnEvent, 0, 0},
+	}
+	ops, err := EventsToOperations(events)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []Operation{
+		{0, registerInput{false, 100}, 0, 0, 3},
+		{1, registerInput{true, 0}, 1, 100, 2},
+	}
+	if len(ops) != len(expected) {
+		t.Fatalf("expected %v, got %v", expected, ops)
+	}
+	for i := range ops {
+		if ops[i] != expected[i] {
+			t.Fatalf("expected %v, got %v", expected, ops)
+		}
+	}
+}
+
+func TestEventsToOperationsErrors(t *testing.T) {
+	tests := []struct {
+		name   string
+		events []Event
+	}{
+		{"duplicate call", []Event{
+			{0, CallEvent, registerInput{true, 0}, 0},
+			{1, CallEvent, registerInput{true, 0}, 0},
+			{0, ReturnEvent, 0, 0},
+		}},
+		{"duplicate return", []Event{
+			{0, CallEvent, registerInput{true, 0}, 0},
+			{0, ReturnEvent, 0, 0},
+			{0, ReturnEvent, 0, 0},
+		}},
+		{"return without call", []Event{
+			{0, ReturnEvent, 0, 0},
+		}},
+		{"call without return", []Event{
+			{0, CallEvent, registerInput{true, 0}, 0},
+			{1, CallEvent, registerInput{true, 0}, 1},
+			{1, ReturnEvent, 0, 1},
+		}},
+	}
+	for _, test := range tests {
+		_, err := EventsToOperations(test.events)
+		if err == nil {
+			t.Fatalf("expected error for %s", test.name)
+		}
+	}
+}
+
+func TestEventsToOperationsVerdicts(t *testing.T) {
+	for _, logNum := range []int{0, 1, 2, 3, 4, 5, 6, 7, 8, 9} {
+		events := parseJepsenLog(fmt.Sprintf("test_data/jepsen/etcd_%03d.log", logNum))
+		ops, err := EventsToOperations(events)
+		if err != nil {
+			t.Fatalf("etcd_%03d: %v", logNum, err)
+		}
+		if CheckEvents(etcdModel, events) != CheckOperations(etcdModel, ops) {
+			t.Fatalf("etcd_%03d: expected converted operations to have the same verdict", logNum)
+		}
+	}
+	for _, logName := range []string{"c01-bad", "c01-ok", "c10-bad", "c10-ok"} {
+		events := parseKvLog(fmt.Sprintf("test_data/kv/%s.txt", logName))
+		ops, err := EventsToOperations(events)
+		if err != nil {
+			t.Fatalf("%s: %v", logName, err)
+		}
+		if CheckEvents(kvModel, events) != CheckOperations(kvModel, ops) {
+			t.Fatalf("%s: expected converted operations to have the same verdict", logName)
+		}
+	}
+}
+
+func TestOperationsToEvents(t *testing.T) {
+	ops := []Operation{
+		{0, registerInput{false, 100}, 0, 0, 100},
+		{1, registerInput{true, 0}, 25, 100, 75},
+		{2, registerInput{true, 0}, 30, 0, 30},  // zero duration
+		{3, registerInput{true, 0}, 30, 0, 30},  // same times
+		{4, registerInput{true, 0}, 100, 0, 90}, // returns before it's called
+	}
+	events := OperationsToEvents(ops)
+	expected := []struct {
+		kind EventKind
+		id   int
+	}{
+		{CallEvent, 0},
+		{CallEvent, 1},
+		{CallEvent, 2},
+		{CallEvent, 3},
+		{ReturnEvent, 2},
+		{ReturnEvent, 3},
+		{ReturnEvent, 1},
+		{CallEvent, 4},
+		{ReturnEvent, 0},
+		{ReturnEvent, 4},
+	}
+	if len(events) != len(expected) {
+		t.Fatalf("expected %d events, got %d", len(expected), len(events))
+	}
+	for i, e := range expected {
+		if events[i].Kind != e.kind || events[i].Id != e.id || events[i].ClientId != e.id {
+			t.Fatalf("expected event %d to be %v of %d, got %+v", i, e.kind, e.id, events[i])
+		}
+	}
+}
+
+func TestOperationsToEventsVerdicts(t *testing.T) {
+	for _, logNum := range []int{0, 1, 2, 3, 4, 5, 6, 7, 8, 9} {
+		ops, err := EventsToOperations(parseJepsenLog(fmt.Sprintf("test_data/jepsen/etcd_%03d.log", logNum)))
+		if err != nil {
+			t.Fatalf("etcd_%03d: %v", logNum, err)
+		}
+		if CheckOperations(etcdModel, ops) != CheckEvents(etcdModel, OperationsToEvents(ops)) {
+			t.Fatalf("etcd_%03d: expected converted events to have the same verdict", logNum)
+		}
+	}
+	histories := [][]Operation{{
+		{0, registerInput{false, 100}, 0, 0, 100},
+		{1, registerInput{true, 0}, 25, 100, 75},
+		{2, registerInput{true, 0}, 30, 0, 30},
+		{3, registerInput{true, 0}, 30, 0, 30},
+	}, {
+		{0, registerInput{false, 200}, 0, 0, 100},
+		{1, registerInput{true, 0}, 10, 200, 10},
+		{2, registerInput{true, 0}, 10, 200, 10},
+		{3, registerInput{true, 0}, 40, 0, 90},
+	}, {
+		// returns at the same time as the next operation is called
+		{0, registerInput{false, 100}, 0, 0, 10},
+		{1, registerInput{true, 0}, 10, 0, 20},
+	}}
+	for i, ops := range histories {
+		if CheckOperations(registerModel, ops) != CheckEvents(registerModel, OperationsToEvents(ops)) {
+			t.Fatalf("history %d: expected converted events to have the same verdict", i)
+		}
+	}
+}
@@ -0,0 +1,132 @@
+package porcupine
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"text/tabwriter"
+)
+
+// A CoverageCount counts the operations of one class that a check observed,
+// as recorded with the RecordCoverage option. Operations are classified with
+// the model's ClassifyOperation function.
+type CoverageCount struct {
+	Class string
+	// Legal is true for operations in the longest linearization that was
+	// found. For partitions that are not linearizable, the operations that
+	// are not in the longest linearization are counted too, with Legal set
+	// to whether the model accepts them right after it.
+	Legal bool
+	Count int
+}
+
+// defaultClassifyOperation classifies operations by the type of their input.
+func defaultClassifyOperation(input interface{}, output interface{}) string {
+	return fmt.Sprintf("%T", input)
+}
+
+// computeCoverage counts the classes of the operations along the longest
+// partial linearization of each partition.
+func computeCoverage(model Model, history [][]entry, partialLinearizations [][][]int) [][]CoverageCount {
+	classify := model.ClassifyOperation
+	if classify == nil {
+		classify = defaultClassifyOperation
+	}
+	coverage := make([][]CoverageCount, len(history))
+	for i, entries := range history {
+		callValue := make(map[int]interface{})
+		returnValue := make(map[int]interface{})
+		for _, e := range entries {
+			if e.kind == callEntry {
+				callValue[e.id] = e.value
+			} else {
+				returnValue[e.id] = e.value
+			}
+		}
+		type key struct {
+			class string
+			legal bool
+		}
+		counts := make(map[key]int)
+		included := make(map[int]bool)
+		state := model.Init()
+		if longest := longestLinearization(partialLinearizations[i]); longest != -1 {
+			for _, id := range partialLinearizations[i][longest] {
+				included[id] = true
+				_, state = model.Step(state, callValue[id], returnValue[id])
+				counts[key{classify(callValue[id], returnValue[id]), true}]++
+			}
+		}
+		for id := 0; id < len(entries)/2; id++ {
+			if included[id] {
+				continue
+			}
+			legal, _ := model.Step(state, callValue[id], returnValue[id])
+			counts[key{classify(callValue[id], returnValue[id]), legal}]++
+		}
+		for k, n := range counts {
+			coverage[i] = append(coverage[i], CoverageCount{Class: k.class, Legal: k.legal, Count: n})
+		}
+		sortCoverage(coverage[i])
+	}
+	return coverage
+}
+
+func sortCoverage(coverage []CoverageCount) {
+	sort.Slice(coverage, func(i, j int) bool {
+		if coverage[i].Class != coverage[j].Class {
+			return coverage[i].Class < coverage[j].Class
+		}
+		return coverage[i].Legal && !coverage[j].Legal
+	})
+}
+
+// Coverage returns the classes of operations that the check observed, over
+// all partitions, or nil if the check did not record coverage (see
+// CheckOptions.RecordCoverage).
+func (li LinearizationInfo) Coverage() []CoverageCount {
+	if li.coverage == nil {
+		return nil
+	}
+	type key struct {
+		class string
+		legal bool
+	}
+	counts := make(map[key]int)
+	for _, partition := range li.coverage {
+		for _, c := range partition {
+			counts[key{c.Class, c.Legal}] += c.Count
+		}
+	}
+	coverage := make([]CoverageCount, 0, len(counts))
+	for k, n := range counts {
+		coverage = append(coverage, CoverageCount{Class: k.class, Legal: k.legal, Count: n})
+	}
+	sortCoverage(coverage)
+	return coverage
+}
+
+// WriteCoverageReport writes a table of the classes of operations that the
+// check observed, over all partitions, to w. Classes that were never observed
+// don't appear in the table, so it's worth looking for the ones that are
+// missing.
+func (li LinearizationInfo) WriteCoverageReport(w io.Writer) error {
+	if li.coverage == nil {
+		_, err := fmt.Fprintln(w, "porcupine: no coverage was recorded")
+		return err
+	}
+	tw := tabwriter.NewWriter(w, 0, 8, 2, ' ', 0)
+	fmt.Fprintln(tw, "CLASS\tLEGAL\tCOUNT\tPARTITIONS")
+	for _, c := range li.Coverage() {
+		partitions := 0
+		for _, partition := range li.coverage {
+			for _, pc := range partition {
+				if pc.Class == c.Class && pc.Legal == c.Legal {
+					partitions++
+				}
+			}
+		}
+		fmt.Fprintf(tw, "%s\t%t\t%d\t%d\n", c.Class, c.Legal, c.Count, partitions)
+	}
+	return tw.Flush()
+}
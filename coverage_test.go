@@ -0,0 +1,73 @@
+package porcupine
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestCoverage(t *testing.T) {
+	model := registerModel
+	model.ClassifyOperation = func(input, output interface{}) string {
+		if input.(registerInput).op {
+			if output.(int) == 0 {
+				return "get-initial"
+			}
+			return "get"
+		}
+		return "put"
+	}
+	ops := []Operation{
+		{0, registerInput{true, 0}, 0, 0, 10},
+		{1, registerInput{false, 100}, 20, 0, 30},
+		{2, registerInput{true, 0}, 40, 100, 50},
+	}
+	res, info := CheckOperationsWithOptions(model, ops, CheckOptions{RecordCoverage: true})
+	if res != Ok {
+		t.Fatalf("expected output %v, got output %v", Ok, res)
+	}
+	expected := []CoverageCount{
+		{Class: "get", Legal: true, Count: 1},
+		{Class: "get-initial", Legal: true, Count: 1},
+		{Class: "put", Legal: true, Count: 1},
+	}
+	if coverage := info.Partitions()[0].Coverage; !reflect.DeepEqual(coverage, expected) {
+		t.Fatalf("expected coverage %v, got %v", expected, coverage)
+	}
+
+	// the operation that can't be linearized is counted as illegal
+	ops[2].Output = 200
+	res, info = CheckOperationsWithOptions(model, ops, CheckOptions{RecordCoverage: true})
+	if res != Illegal {
+		t.Fatalf("expected output %v, got output %v", Illegal, res)
+	}
+	expected[0].Legal = false
+	if coverage := info.Coverage(); !reflect.DeepEqual(coverage, expected) {
+		t.Fatalf("expected coverage %v, got %v", expected, coverage)
+	}
+	var b strings.Builder
+	if err := info.WriteCoverageReport(&b); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(b.String(), "get-initial  true   1      1") {
+		t.Fatalf("unexpected report:\n%s", b.String())
+	}
+
+	// without the option, nothing is recorded
+	_, info = CheckOperationsWithOptions(model, ops, CheckOptions{})
+	if info.Coverage() != nil || info.Partitions()[0].Coverage != nil {
+		t.Fatal("expected no coverage")
+	}
+}
+
+func TestCoverageDefaultClassify(t *testing.T) {
+	events := parseKvLog("test_data/kv/c01-ok.txt")
+	res, info := CheckEventsWithOptions(kvModel, events, CheckOptions{RecordCoverage: true})
+	if res != Ok {
+		t.Fatalf("expected output %v, got output %v", Ok, res)
+	}
+	coverage := info.Coverage()
+	if len(coverage) != 1 || coverage[0].Class != "porcupine.kvInput" || coverage[0].Count != len(events)/2 {
+		t.Fatalf("unexpected coverage %v", coverage)
+	}
+}
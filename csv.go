@@ -0,0 +1,192 @@
+package porcupine
+
+import (
+	"bufio"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// A CSVError reports a malformed row in a CSV history.
+type CSVError struct {
+	Line int
+	Err  error
+}
+
+func (e *CSVError) Error() string {
+	return fmt.Sprintf("porcupine: line %d: %v", e.Line, e.Err)
+}
+
+func (e *CSVError) Unwrap() error {
+	return e.Err
+}
+
+// CSVOptions configures [ReadCSVHistoryWithOptions].
+type CSVOptions struct {
+	// If Lenient is set, malformed rows are skipped instead of stopping
+	// the import.
+	Lenient bool
+	// If Skipped is set, it is called with a [CSVError] for each row that
+	// is skipped in lenient mode.
+	Skipped func(err error)
+}
+
+// ReadCSVHistory reads a history of operations from CSV, with one operation
+// per row. It handles the CSV syntax, and calls mapRow to convert each row
+// into an operation; [MapCSVKVRow] implements a default schema for key-value
+// stores.
+//
+// The first row is treated as a header, and skipped, if none of its fields
+// are numbers. Rows may have different numbers of fields. Errors, including
+// the ones returned by mapRow, are reported as a [CSVError] with the line
+// number of the row.
+func ReadCSVHistory(r io.Reader, mapRow func(record []string) (Operation, error)) ([]Operation, error) {
+	return ReadCSVHistoryWithOptions(r, mapRow, CSVOptions{})
+}
+
+// ReadCSVHistoryWithOptions is like [ReadCSVHistory], with the given options.
+func ReadCSVHistoryWithOptions(r io.Reader, mapRow func(record []string) (Operation, error), opts CSVOptions) ([]Operation, error) {
+	lr := &lineReader{r: bufio.NewReader(r)}
+	cr := csv.NewReader(lr)
+	cr.FieldsPerRecord = -1
+	var history []Operation
+	for first := true; ; first = false {
+		record, err := cr.Read()
+		if err == io.EOF {
+			return history, nil
+		}
+		var line int
+		var parseErr *csv.ParseError
+		if errors.As(err, &parseErr) {
+			line = parseErr.StartLine
+			err = parseErr.Err
+		} else if err != nil {
+			return nil, fmt.Errorf("porcupine: reading CSV: %w", err)
+		} else {
+			// the record ends on the line that was read last, and
+			// starts before the newlines in its quoted fields
+			line = lr.line()
+			for _, field := range record {
+				line -= strings.Count(field, "\n")
+			}
+			if first && isCSVHeader(record) {
+				continue
+			}
+			var op Operation
+			if op, err = mapRow(record); err == nil {
+				history = append(history, op)
+				continue
+			}
+		}
+		csvErr := &CSVError{Line: line, Err: err}
+		if !opts.Lenient {
+			return nil, csvErr
+		}
+		if opts.Skipped != nil {
+			opts.Skipped(csvErr)
+		}
+	}
+}
+
+// A lineReader counts the lines read from it, and returns at most one line
+// from each call to Read, so that a csv.Reader that reads from it doesn't
+// read past the end of the record that it returns.
+type lineReader struct {
+	r        *bufio.Reader
+	newlines int
+	last     byte // the last byte read, or 0
+}
+
+func (l *lineReader) Read(p []byte) (int, error) {
+	n := 0
+	for n < len(p) {
+		b, err := l.r.ReadByte()
+		if err != nil {
+			return n, err
+		}
+		p[n] = b
+		n++
+		l.last = b
+		if b == '\n' {
+			l.newlines++
+			break
+		}
+	}
+	return n, nil
+}
+
+// line returns the number of the last line that was read from, counting
+// from 1.
+func (l *lineReader) line() int {
+	if l.last != 0 && l.last != '\n' {
+		return l.newlines + 1
+	}
+	return l.newlines
+}
+
+func isCSVHeader(record []string) bool {
+	for _, field := range record {
+		if _, err := strconv.ParseFloat(strings.TrimSpace(field), 64); err == nil {
+			return false
+		}
+	}
+	return true
+}
+
+// CSVKVInput is the input of an operation read by [MapCSVKVRow].
+type CSVKVInput struct {
+	Op    string // "get", "put", or "append"
+	Key   string
+	Value string // for put and append
+}
+
+// CSVKVOutput is the output of an operation read by [MapCSVKVRow].
+type CSVKVOutput struct {
+	Value string // for get
+}
+
+// MapCSVKVRow maps a row of a CSV history of a key-value store, for use with
+// [ReadCSVHistory]. The schema has six columns:
+//
+//	client,op,key,value,call_ns,return_ns
+//
+// where client is the integer client id, op is get, put, or append, value is
+// the value that was read by a get or written by a put or append, and call_ns
+// and return_ns are integer timestamps. The input of each operation is a
+// [CSVKVInput], and the output is a [CSVKVOutput].
+func MapCSVKVRow(record []string) (Operation, error) {
+	if len(record) != 6 {
+		return Operation{}, fmt.Errorf("expected 6 fields, got %d", len(record))
+	}
+	client, err := strconv.Atoi(strings.TrimSpace(record[0]))
+	if err != nil {
+		return Operation{}, fmt.Errorf("invalid client %q", record[0])
+	}
+	call, err := strconv.ParseInt(strings.TrimSpace(record[4]), 10, 64)
+	if err != nil {
+		return Operation{}, fmt.Errorf("invalid call time %q", record[4])
+	}
+	ret, err := strconv.ParseInt(strings.TrimSpace(record[5]), 10, 64)
+	if err != nil {
+		return Operation{}, fmt.Errorf("invalid return time %q", record[5])
+	}
+	if ret < call {
+		return Operation{}, fmt.Errorf("return time %d is before call time %d", ret, call)
+	}
+	op := Operation{ClientId: client, Call: call, Return: ret}
+	key, value := record[2], record[3]
+	switch strings.TrimSpace(record[1]) {
+	case "get":
+		op.Input = CSVKVInput{Op: "get", Key: key}
+		op.Output = CSVKVOutput{Value: value}
+	case "put", "append":
+		op.Input = CSVKVInput{Op: strings.TrimSpace(record[1]), Key: key, Value: value}
+		op.Output = CSVKVOutput{}
+	default:
+		return Operation{}, fmt.Errorf("unknown op %q", record[1])
+	}
+	return op, nil
+}
@@ -0,0 +1,150 @@
+package porcupine
+
+import (
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+)
+
+// csvKvModel is kvModel, for the inputs and outputs produced by MapCSVKVRow
+var csvKvModel = Model{
+	Partition: func(history []Operation) [][]Operation {
+		m := make(map[string][]Operation)
+		var keys []string
+		for _, op := range history {
+			key := op.Input.(CSVKVInput).Key
+			if _, ok := m[key]; !ok {
+				keys = append(keys, key)
+			}
+			m[key] = append(m[key], op)
+		}
+		partitions := make([][]Operation, len(keys))
+		for i, key := range keys {
+			partitions[i] = m[key]
+		}
+		return partitions
+	},
+	Init: kvModel.Init,
+	Step: func(state, input, output interface{}) (bool, interface{}) {
+		inp := input.(CSVKVInput)
+		out := output.(CSVKVOutput)
+		ops := map[string]uint8{"get": 0, "put": 1, "append": 2}
+		return kvModel.Step(state, kvInput{ops[inp.Op], inp.Key, inp.Value}, kvOutput{out.Value})
+	},
+}
+
+func TestReadCSVHistory(t *testing.T) {
+	input := `client,op,key,value,call_ns,return_ns
+0,put,x,"a, b",0,10
+1,get,x,"a, b",5,20
+2,append,"x","""c""",30,40
+`
+	ops, err := ReadCSVHistory(strings.NewReader(input), MapCSVKVRow)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []Operation{
+		{0, CSVKVInput{"put", "x", "a, b"}, 0, CSVKVOutput{}, 10},
+		{1, CSVKVInput{"get", "x", ""}, 5, CSVKVOutput{"a, b"}, 20},
+		{2, CSVKVInput{"append", "x", `"c"`}, 30, CSVKVOutput{}, 40},
+	}
+	if len(ops) != len(expected) {
+		t.Fatalf("expected %v, got %v", expected, ops)
+	}
+	for i := range ops {
+		if ops[i] != expected[i] {
+			t.Fatalf("expected %v, got %v", expected, ops)
+		}
+	}
+
+	// without a header
+	ops, err = ReadCSVHistory(strings.NewReader("0,get,x,,0,10\n"), MapCSVKVRow)
+	if err != nil || len(ops) != 1 {
+		t.Fatalf("expected 1 operation, got %v (%v)", ops, err)
+	}
+}
+
+func TestReadCSVHistoryVerdicts(t *testing.T) {
+	for _, logName := range []string{"c01-bad", "c01-ok", "c10-bad", "c10-ok"} {
+		ops, err := EventsToOperations(parseKvLog(fmt.Sprintf("test_data/kv/%s.txt", logName)))
+		if err != nil {
+			t.Fatalf("%s: %v", logName, err)
+		}
+		var b strings.Builder
+		w := csv.NewWriter(&b)
+		w.Write([]string{"client", "op", "key", "value", "call_ns", "return_ns"})
+		for _, op := range ops {
+			inp := op.Input.(kvInput)
+			value := inp.value
+			if inp.op == 0 {
+				value = op.Output.(kvOutput).value
+			}
+			name := []string{"get", "put", "append"}[inp.op]
+			w.Write([]string{fmt.Sprint(op.ClientId), name, inp.key, value, fmt.Sprint(op.Call), fmt.Sprint(op.Return)})
+		}
+		w.Flush()
+		csvOps, err := ReadCSVHistory(strings.NewReader(b.String()), MapCSVKVRow)
+		if err != nil {
+			t.Fatalf("%s: %v", logName, err)
+		}
+		if CheckOperations(csvKvModel, csvOps) != CheckOperations(kvModel, ops) {
+			t.Fatalf("%s: expected CSV history to have the same verdict", logName)
+		}
+	}
+}
+
+func TestReadCSVHistoryErrors(t *testing.T) {
+	input := `client,op,key,value,call_ns,return_ns
+0,put,x,a,0,10
+1,frob,x,a,5,20
+2,get,"x
+y",a,30,40
+3,get,x,a,50
+4,get,x,"a"b,60,70
+5,get,x,a,80,70
+6,get,x,a,90,100
+`
+	_, err := ReadCSVHistory(strings.NewReader(input), MapCSVKVRow)
+	var csvErr *CSVError
+	if !errors.As(err, &csvErr) || csvErr.Line != 3 || !strings.Contains(err.Error(), "line 3: unknown op") {
+		t.Fatalf("expected error on line 3, got %v", err)
+	}
+
+	var skipped []int
+	ops, err := ReadCSVHistoryWithOptions(strings.NewReader(input), MapCSVKVRow, CSVOptions{
+		Lenient: true,
+		Skipped: func(err error) {
+			skipped = append(skipped, err.(*CSVError).Line)
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(ops) != 3 || ops[0].ClientId != 0 || ops[1].ClientId != 2 || ops[2].ClientId != 6 {
+		t.Fatalf("expected operations of clients 0, 2, and 6, got %v", ops)
+	}
+	if fmt.Sprint(skipped) != "[3 6 7 8]" {
+		t.Fatalf("expected lines 3, 6, 7, and 8 to be skipped, got %v", skipped)
+	}
+}
+
+func TestReadCSVHistoryErrorLines(t *testing.T) {
+	// blank lines are skipped, a record spanning lines is reported at its
+	// first one, and the last line needs no newline
+	input := "0,put,x,a,0,10\n\n1,frob,\"x\ny\",a,5,20\n2,get,x,a,30\n\n3,get,x,a,40"
+	var skipped []int
+	_, err := ReadCSVHistoryWithOptions(strings.NewReader(input), MapCSVKVRow, CSVOptions{
+		Lenient: true,
+		Skipped: func(err error) {
+			skipped = append(skipped, err.(*CSVError).Line)
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if fmt.Sprint(skipped) != "[3 5 7]" {
+		t.Fatalf("expected lines 3, 5, and 7 to be skipped, got %v", skipped)
+	}
+}
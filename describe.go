@@ -0,0 +1,180 @@
+package porcupine
+
+import (
+	"fmt"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// DescribeOptions configures [DescribeValue].
+type DescribeOptions struct {
+	// OmitZero leaves out the struct fields that have their zero value.
+	OmitZero bool
+	// MaxLength is the maximum length of a description, in runes; longer
+	// descriptions are truncated with an ellipsis. A MaxLength of 0 means
+	// that descriptions are not truncated.
+	MaxLength int
+}
+
+// defaultDescribeOptions are the options used to describe operations and
+// states of models that don't have description functions.
+var defaultDescribeOptions = DescribeOptions{MaxLength: 200}
+
+// describeDefault describes a value for models that don't have description
+// functions. Structs, maps, and slices, and pointers to them, are rendered
+// with DescribeValue, so that their fields are named, and other values with
+// the "%v" format specifier, so that strings and numbers render as they
+// always have.
+func describeDefault(v interface{}) string {
+	if t := reflect.TypeOf(v); t != nil {
+		if t.Kind() == reflect.Ptr {
+			t = t.Elem()
+		}
+		switch t.Kind() {
+		case reflect.Struct, reflect.Map, reflect.Slice:
+			return DescribeValue(v, defaultDescribeOptions)
+		}
+	}
+	return fmt.Sprintf("%v", v)
+}
+
+// maxDescribeDepth limits how deeply DescribeValue descends into nested
+// values, which also stops it at cycles.
+const maxDescribeDepth = 10
+
+// DescribeValue renders a value as a string for visualizations, like the
+// "%v" format specifier but with the names of struct fields, so that a value
+// renders as kvInput{op:0, key:"x", value:""} rather than {0 x }. Values that
+// implement fmt.Stringer or error are rendered with their String or Error
+// methods.
+//
+// DescribeValue is used to describe structs, maps, and slices in operations
+// and states of models that don't have DescribeOperation or DescribeState
+// functions; it can be used to write description functions that only render
+// part of a value.
+func DescribeValue(v interface{}, opts DescribeOptions) string {
+	var b strings.Builder
+	describeValue(&b, reflect.ValueOf(v), opts, 0)
+	s, _ := truncateDescription(b.String(), opts.MaxLength)
+	return s
+}
+
+func describeValue(b *strings.Builder, v reflect.Value, opts DescribeOptions, depth int) {
+	if !v.IsValid() {
+		b.WriteString("nil")
+		return
+	}
+	if depth > maxDescribeDepth {
+		b.WriteString("…")
+		return
+	}
+	if v.CanInterface() {
+		switch x := v.Interface().(type) {
+		case error:
+			if !isNilPointer(v) {
+				b.WriteString(x.Error())
+				return
+			}
+		case fmt.Stringer:
+			if !isNilPointer(v) {
+				b.WriteString(x.String())
+				return
+			}
+		}
+	}
+	switch v.Kind() {
+	case reflect.Bool:
+		b.WriteString(strconv.FormatBool(v.Bool()))
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		b.WriteString(strconv.FormatInt(v.Int(), 10))
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		b.WriteString(strconv.FormatUint(v.Uint(), 10))
+	case reflect.Float32, reflect.Float64:
+		b.WriteString(strconv.FormatFloat(v.Float(), 'g', -1, v.Type().Bits()))
+	case reflect.Complex64, reflect.Complex128:
+		fmt.Fprintf(b, "%v", v.Complex())
+	case reflect.String:
+		b.WriteString(strconv.Quote(v.String()))
+	case reflect.Ptr:
+		if v.IsNil() {
+			b.WriteString("nil")
+			return
+		}
+		b.WriteByte('&')
+		describeValue(b, v.Elem(), opts, depth+1)
+	case reflect.Interface:
+		if v.IsNil() {
+			b.WriteString("nil")
+			return
+		}
+		describeValue(b, v.Elem(), opts, depth)
+	case reflect.Slice, reflect.Array:
+		if v.Kind() == reflect.Slice && v.IsNil() {
+			b.WriteString("nil")
+			return
+		}
+		b.WriteByte('[')
+		for i := 0; i < v.Len(); i++ {
+			if i > 0 {
+				b.WriteString(", ")
+			}
+			describeValue(b, v.Index(i), opts, depth+1)
+		}
+		b.WriteByte(']')
+	case reflect.Map:
+		if v.IsNil() {
+			b.WriteString("nil")
+			return
+		}
+		// map iteration order is random, so entries are sorted by their
+		// descriptions
+		entries := make([]string, 0, v.Len())
+		iter := v.MapRange()
+		for iter.Next() {
+			var entry strings.Builder
+			describeValue(&entry, iter.Key(), opts, depth+1)
+			entry.WriteByte(':')
+			describeValue(&entry, iter.Value(), opts, depth+1)
+			entries = append(entries, entry.String())
+		}
+		sort.Strings(entries)
+		b.WriteString("map[")
+		b.WriteString(strings.Join(entries, ", "))
+		b.WriteByte(']')
+	case reflect.Struct:
+		t := v.Type()
+		if t.Name() != "" {
+			b.WriteString(t.Name())
+		}
+		b.WriteByte('{')
+		first := true
+		for i := 0; i < v.NumField(); i++ {
+			if opts.OmitZero && v.Field(i).IsZero() {
+				continue
+			}
+			if !first {
+				b.WriteString(", ")
+			}
+			first = false
+			b.WriteString(t.Field(i).Name)
+			b.WriteByte(':')
+			describeValue(b, v.Field(i), opts, depth+1)
+		}
+		b.WriteByte('}')
+	default:
+		// functions, channels, and unsafe pointers
+		if v.CanInterface() {
+			fmt.Fprintf(b, "%v", v.Interface())
+		} else {
+			fmt.Fprintf(b, "<%s>", v.Type())
+		}
+	}
+}
+
+// isNilPointer returns whether v is a nil pointer, whose methods can't
+// necessarily be called.
+func isNilPointer(v reflect.Value) bool {
+	return v.Kind() == reflect.Ptr && v.IsNil()
+}
@@ -0,0 +1,53 @@
+package porcupine
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestDefaultDescribeOperation(t *testing.T) {
+	tests := []struct {
+		input    interface{}
+		output   interface{}
+		expected string
+	}{
+		{kvInput{op: 0, key: "x"}, kvOutput{"y"}, `kvInput{op:0, key:"x", value:""} -> kvOutput{value:"y"}`},
+		{&kvInput{op: 1, key: "x", value: "z"}, nil, `&kvInput{op:1, key:"x", value:"z"} -> <nil>`},
+		{(*kvInput)(nil), []int{1, 2}, `nil -> [1, 2]`},
+		{registerInput{true, 0}, 3, `registerInput{op:true, value:0} -> 3`},
+		{map[string]int{"b": 2, "a": 1}, errors.New("timeout"), `map["a":1, "b":2] -> timeout`},
+		{struct{ A []interface{} }{[]interface{}{nil, 1.5}}, CheckResult("Ok"), `{A:[nil, 1.5]} -> Ok`},
+		{"x", 'y', `x -> 121`},
+	}
+	for _, test := range tests {
+		if d := defaultDescribeOperation(test.input, test.output); d != test.expected {
+			t.Errorf("expected %s, got %s", test.expected, d)
+		}
+	}
+}
+
+func TestDescribeValueOptions(t *testing.T) {
+	input := kvInput{op: 0, key: "x"}
+	if d := DescribeValue(input, DescribeOptions{OmitZero: true}); d != `kvInput{key:"x"}` {
+		t.Fatalf("unexpected description %s", d)
+	}
+	long := kvInput{op: 1, key: "x", value: strings.Repeat("y", 100)}
+	d := DescribeValue(long, DescribeOptions{MaxLength: 20})
+	if d != `kvInput{op:1, key:"…` {
+		t.Fatalf("unexpected description %s", d)
+	}
+	if d := defaultDescribeState(long); len(d) > 300 || !strings.HasSuffix(d, `"}`) {
+		t.Fatalf("unexpected description %s", d)
+	}
+
+	// cycles are cut off
+	type node struct {
+		Next *node
+	}
+	cycle := &node{}
+	cycle.Next = cycle
+	if d := DescribeValue(cycle, DescribeOptions{}); !strings.HasSuffix(d, "…}}}}}") {
+		t.Fatalf("unexpected description %s", d)
+	}
+}
@@ -0,0 +1,202 @@
+package porcupine
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+)
+
+// A Difficulty is a rough classification of how hard a history is to check,
+// as estimated by [EstimateDifficulty].
+type Difficulty int
+
+const (
+	// DifficultyEasy histories check quickly.
+	DifficultyEasy Difficulty = iota
+	// DifficultyModerate histories may take a while to check if they
+	// aren't linearizable, or if the model has many states.
+	DifficultyModerate
+	// DifficultyHard histories can take a very long time to check,
+	// unless the model prunes the search well.
+	DifficultyHard
+	// DifficultyHopeless histories are unlikely to finish checking in
+	// any reasonable amount of time.
+	DifficultyHopeless
+)
+
+func (d Difficulty) String() string {
+	switch d {
+	case DifficultyEasy:
+		return "easy"
+	case DifficultyModerate:
+		return "moderate"
+	case DifficultyHard:
+		return "hard"
+	case DifficultyHopeless:
+		return "hopeless"
+	default:
+		return fmt.Sprintf("Difficulty(%d)", int(d))
+	}
+}
+
+// difficultyThresholds are the largest numbers of concurrent operations in a
+// partition for each difficulty, below DifficultyHopeless.
+var difficultyThresholds = [...]int{
+	DifficultyEasy:     8,
+	DifficultyModerate: 16,
+	DifficultyHard:     32,
+}
+
+// A PartitionDifficulty describes the structure of one partition of a history,
+// as estimated by [EstimateDifficulty].
+type PartitionDifficulty struct {
+	Operations int
+	// MaxConcurrency is the largest number of operations in the partition
+	// that were open at the same time, which the time it takes to check
+	// the partition is exponential in.
+	MaxConcurrency int
+}
+
+// A DifficultyReport is the result of [EstimateDifficulty].
+type DifficultyReport struct {
+	Difficulty Difficulty
+	// Partitioned is whether the model has a partition function.
+	Partitioned bool
+	// ComparableState is whether the model's initial state can be
+	// compared with ==, which the checker does if the model doesn't have
+	// an Equal function.
+	ComparableState bool
+	// Partitions describes each partition, in the order of the model's
+	// partition function.
+	Partitions []PartitionDifficulty
+	// Hardest is the index of the partition with the largest
+	// MaxConcurrency, or -1 if there are no operations.
+	Hardest int
+	// Suggestions are specific changes that may make the check faster,
+	// or make it work at all.
+	Suggestions []string
+}
+
+func (r DifficultyReport) String() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "difficulty: %s", r.Difficulty)
+	if r.Hardest >= 0 {
+		fmt.Fprintf(&b, " (max concurrency %d in partition %d of %d)", r.Partitions[r.Hardest].MaxConcurrency, r.Hardest, len(r.Partitions))
+	}
+	for _, s := range r.Suggestions {
+		fmt.Fprintf(&b, "\n  - %s", s)
+	}
+	return b.String()
+}
+
+// EstimateDifficulty estimates how hard a history is to check with a model,
+// from cheap structural metrics, without checking it: mainly the largest
+// number of operations that are open at the same time within a partition,
+// since checking is exponential in it. It also suggests changes that would
+// help, such as defining a partition function.
+//
+// The estimate is a heuristic: a model whose states quickly rule out most
+// orders can make a hard history easy to check, and a history that isn't
+// linearizable usually takes longer to check than one that is.
+func EstimateDifficulty(model Model, ops []Operation) DifficultyReport {
+	partitioned := model.Partition != nil
+	hasEqual := model.Equal != nil
+	model = fillDefault(model)
+	partitions := model.Partition(ops)
+	entries := make([][]entry, len(partitions))
+	for i, partition := range partitions {
+		entries[i] = makeEntries(partition)
+	}
+	return estimateDifficulty(model, entries, partitioned, hasEqual)
+}
+
+// estimateDifficulty estimates the difficulty of checking the partitions of a
+// history, given as entries ordered by time, with a model that was filled in
+// with fillDefault; partitioned and hasEqual are whether it had partition and
+// Equal functions before that.
+func estimateDifficulty(model Model, partitions [][]entry, partitioned, hasEqual bool) DifficultyReport {
+	r := DifficultyReport{
+		Partitioned: partitioned,
+		Partitions:  make([]PartitionDifficulty, len(partitions)),
+		Hardest:     -1,
+	}
+	if model.Init != nil {
+		r.ComparableState = isComparable(model.Init())
+	}
+	for i, entries := range partitions {
+		p := &r.Partitions[i]
+		p.Operations = len(entries) / 2
+		open := 0
+		for _, e := range entries {
+			if e.kind == callEntry {
+				open++
+				if open > p.MaxConcurrency {
+					p.MaxConcurrency = open
+				}
+			} else {
+				open--
+			}
+		}
+		if p.Operations > 0 && (r.Hardest == -1 || p.MaxConcurrency > r.Partitions[r.Hardest].MaxConcurrency) {
+			r.Hardest = i
+		}
+	}
+
+	r.Difficulty = DifficultyHopeless
+	maxConcurrency := 0
+	if r.Hardest >= 0 {
+		maxConcurrency = r.Partitions[r.Hardest].MaxConcurrency
+	}
+	for d, threshold := range difficultyThresholds {
+		if maxConcurrency <= threshold {
+			r.Difficulty = Difficulty(d)
+			break
+		}
+	}
+	if r.Difficulty > DifficultyEasy {
+		if !partitioned {
+			r.Suggestions = append(r.Suggestions, fmt.Sprintf("define Partition, if operations act on independent parts of the state; max concurrency %d in the unpartitioned history will dominate", maxConcurrency))
+		} else {
+			r.Suggestions = append(r.Suggestions, fmt.Sprintf("max concurrency %d in partition %d will dominate; partition more finely, or record histories with fewer concurrent clients", maxConcurrency, r.Hardest))
+		}
+	}
+	if model.Init != nil && !r.ComparableState && !hasEqual {
+		r.Suggestions = append(r.Suggestions, "define Equal: the model's states can't be compared with ==, so the check will panic")
+	}
+	return r
+}
+
+// isComparable returns whether a value can be compared with == without
+// panicking, which is not the case for values that are or contain slices,
+// maps, or functions.
+func isComparable(v interface{}) bool {
+	return comparableValue(reflect.ValueOf(v))
+}
+
+func comparableValue(v reflect.Value) bool {
+	if !v.IsValid() {
+		return true
+	}
+	if !v.Type().Comparable() {
+		return false
+	}
+	// values of comparable types can still hold incomparable values in
+	// interfaces
+	switch v.Kind() {
+	case reflect.Interface:
+		return v.IsNil() || comparableValue(v.Elem())
+	case reflect.Struct:
+		for i := 0; i < v.NumField(); i++ {
+			if !comparableValue(v.Field(i)) {
+				return false
+			}
+		}
+	case reflect.Array:
+		for i := 0; i < v.Len(); i++ {
+			if !comparableValue(v.Index(i)) {
+				return false
+			}
+		}
+	}
+	return true
+}
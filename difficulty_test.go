@@ -0,0 +1,67 @@
+package porcupine
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestEstimateDifficulty(t *testing.T) {
+	ops, err := EventsToOperations(parseKvLog("test_data/kv/c50-ok.txt"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	r := EstimateDifficulty(kvNoPartitionModel, ops)
+	if r.Difficulty != DifficultyHopeless || r.Partitioned || len(r.Partitions) != 1 || r.Partitions[0].MaxConcurrency <= 32 {
+		t.Fatalf("unexpected report %+v", r)
+	}
+	if len(r.Suggestions) != 1 || !strings.HasPrefix(r.Suggestions[0], "define Partition") {
+		t.Fatalf("unexpected suggestions %v", r.Suggestions)
+	}
+
+	// partitioning by key makes it tractable
+	p := EstimateDifficulty(kvModel, ops)
+	if !p.Partitioned || len(p.Partitions) < 2 || p.Difficulty >= r.Difficulty || p.Hardest < 0 {
+		t.Fatalf("unexpected report %+v", p)
+	}
+	if c := p.Partitions[p.Hardest].MaxConcurrency; c >= r.Partitions[0].MaxConcurrency || !strings.Contains(p.String(), "max concurrency") {
+		t.Fatalf("unexpected report %v", p)
+	}
+
+	// a sequential history is easy, but states that are maps need Equal
+	model := Model{
+		Init: func() interface{} { return map[string]int{} },
+		Step: func(state, input, output interface{}) (bool, interface{}) { return true, state },
+	}
+	ops = []Operation{{0, 1, 0, 1, 10}, {0, 2, 20, 2, 30}}
+	r = EstimateDifficulty(model, ops)
+	if r.Difficulty != DifficultyEasy || r.ComparableState || len(r.Suggestions) != 1 || !strings.HasPrefix(r.Suggestions[0], "define Equal") {
+		t.Fatalf("unexpected report %+v", r)
+	}
+	if r := EstimateDifficulty(registerModel, nil); r.Difficulty != DifficultyEasy || r.Hardest != -1 || !r.ComparableState || r.Suggestions != nil {
+		t.Fatalf("unexpected report %+v", r)
+	}
+	if !isComparable(struct{ x interface{} }{1}) || isComparable(struct{ x interface{} }{[]int{}}) {
+		t.Fatal("unexpected comparability")
+	}
+}
+
+func TestDifficultyWarning(t *testing.T) {
+	events := parseKvLog("test_data/kv/c50-ok.txt")
+	var warnings []DifficultyReport
+	opts := CheckOptions{
+		Timeout: time.Millisecond,
+		DifficultyWarning: func(report DifficultyReport) {
+			warnings = append(warnings, report)
+		},
+	}
+	CheckEventsWithOptions(kvNoPartitionModel, events, opts)
+	if len(warnings) != 1 || warnings[0].Difficulty != DifficultyHopeless {
+		t.Fatalf("expected a warning, got %v", warnings)
+	}
+	// the warning isn't given for histories that are easy to check
+	CheckEventsWithOptions(kvModel, parseKvLog("test_data/kv/c01-ok.txt"), opts)
+	if len(warnings) != 1 {
+		t.Fatalf("expected no more warnings, got %v", warnings)
+	}
+}
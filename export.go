@@ -0,0 +1,50 @@
+package porcupine
+
+import "time"
+
+// ExportOptions configures how the exporters ([ExportOTLP],
+// [ExportChromeTrace]) interpret the timestamps of a history.
+type ExportOptions struct {
+	// Time corresponding to a timestamp of 0 in the history. If zero,
+	// timestamps are interpreted relative to the Unix epoch, which is
+	// appropriate for histories recorded with time.Now().UnixNano().
+	Epoch time.Time
+	// Duration of one unit of time in the history. If zero, timestamps
+	// are interpreted as nanoseconds. Histories with logical timestamps
+	// (such as histories checked with [CheckEventsVerbose], where times
+	// are event indices) can use any unit to space out operations.
+	Unit time.Duration
+}
+
+// exportTime converts a timestamp from a history to nanoseconds since the
+// Unix epoch.
+func (opts ExportOptions) exportTime(t int64) int64 {
+	unit := opts.Unit
+	if unit == 0 {
+		unit = time.Nanosecond
+	}
+	var base int64
+	if !opts.Epoch.IsZero() {
+		base = opts.Epoch.UnixNano()
+	}
+	return base + t*int64(unit)
+}
+
+// exportData computes the data shared by the exporters: the history of each
+// partition, in the canonical order used by the visualization, along with
+// whether each operation is part of the longest (partial) linearization of
+// its partition.
+func exportData(model Model, info LinearizationInfo) ([]partitionVisualizationData, [][]bool) {
+	data := computeVisualizationData(model, info, VisualizationOptions{OverviewBuckets: -1}).Partitions
+	linearized := make([][]bool, len(data))
+	for i, partition := range data {
+		linearized[i] = make([]bool, len(partition.History))
+		if len(partition.PartialLinearizations) > 0 {
+			// the longest linearization is first
+			for _, step := range partition.PartialLinearizations[0] {
+				linearized[i][step.Index] = true
+			}
+		}
+	}
+	return data, linearized
+}
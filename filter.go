@@ -0,0 +1,83 @@
+package porcupine
+
+import "time"
+
+// FilterHistory returns the operations of a history for which keep returns
+// true, in their original order, such as to find out whether a history is
+// still not linearizable when only considering some clients or keys.
+//
+// Removing operations can only make a history easier to linearize, so if a
+// filtered history is not linearizable, neither is the original one, and the
+// filtered history is a smaller reproduction of the problem. A filtered
+// history that is linearizable proves nothing about the original one.
+func FilterHistory(ops []Operation, keep func(Operation) bool) []Operation {
+	var filtered []Operation
+	for _, op := range ops {
+		if keep(op) {
+			filtered = append(filtered, op)
+		}
+	}
+	return filtered
+}
+
+// FilterEvents is the equivalent of [FilterHistory] for a history of events.
+// Each call is passed to keep as an operation, with the call's client id and
+// value as the input, the value of its return, if any, as the output, and
+// the positions of the events as the timestamps. The call and return of an
+// operation are kept or dropped together.
+func FilterEvents(events []Event, keep func(Operation) bool) []Event {
+	returns := make(map[int]int) // from id to position of return
+	for i, event := range events {
+		if event.Kind == ReturnEvent {
+			returns[event.Id] = i
+		}
+	}
+	kept := make(map[int]bool)
+	var filtered []Event
+	for i, event := range events {
+		if event.Kind == CallEvent {
+			op := Operation{ClientId: event.ClientId, Input: event.Value, Call: int64(i), Return: int64(len(events))}
+			if j, ok := returns[event.Id]; ok {
+				op.Output = events[j].Value
+				op.Return = int64(j)
+			}
+			kept[event.Id] = keep(op)
+		}
+		if kept[event.Id] {
+			filtered = append(filtered, event)
+		}
+	}
+	return filtered
+}
+
+// ByClients returns a filter for [FilterHistory] and [FilterEvents] that
+// keeps the operations of the given clients.
+func ByClients(clientIds ...int) func(Operation) bool {
+	clients := make(map[int]bool, len(clientIds))
+	for _, id := range clientIds {
+		clients[id] = true
+	}
+	return func(op Operation) bool {
+		return clients[op.ClientId]
+	}
+}
+
+// ByInput returns a filter for [FilterHistory] and [FilterEvents] that keeps
+// the operations whose input satisfies keep, such as the operations on some
+// keys.
+func ByInput(keep func(input interface{}) bool) func(Operation) bool {
+	return func(op Operation) bool {
+		return keep(op.Input)
+	}
+}
+
+// CheckFilteredHistory filters a history with [FilterHistory], and checks
+// the filtered history with the model, with the given timeout (0 for no
+// timeout). It returns the filtered history and its verdict. As explained in
+// FilterHistory, an Illegal verdict means that the original history is not
+// linearizable either, while an Ok verdict says nothing about the original
+// history.
+func CheckFilteredHistory(model Model, ops []Operation, keep func(Operation) bool, timeout time.Duration) ([]Operation, CheckResult) {
+	filtered := FilterHistory(ops, keep)
+	return filtered, CheckOperationsTimeout(model, filtered, timeout)
+}
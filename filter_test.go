@@ -0,0 +1,82 @@
+package porcupine
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestFilterHistory(t *testing.T) {
+	ops := []Operation{
+		{0, kvInput{op: 1, key: "x", value: "a"}, 0, kvOutput{}, 10},
+		{1, kvInput{op: 1, key: "y", value: "b"}, 5, kvOutput{}, 15},
+		{2, kvInput{op: 0, key: "x"}, 20, kvOutput{"b"}, 30},
+		{3, kvInput{op: 0, key: "y"}, 20, kvOutput{"b"}, 30},
+	}
+	if filtered := FilterHistory(ops, ByClients(0, 3)); !reflect.DeepEqual(filtered, []Operation{ops[0], ops[3]}) {
+		t.Fatalf("unexpected filtered history %v", filtered)
+	}
+	byKey := func(key string) func(Operation) bool {
+		return ByInput(func(input interface{}) bool {
+			return input.(kvInput).key == key
+		})
+	}
+	filtered, res := CheckFilteredHistory(kvModel, ops, byKey("x"), 0)
+	if res != Illegal || !reflect.DeepEqual(filtered, []Operation{ops[0], ops[2]}) {
+		t.Fatalf("expected operations on x to not be linearizable, got %v, %v", res, filtered)
+	}
+	if _, res := CheckFilteredHistory(kvModel, ops, byKey("y"), 0); res != Ok {
+		t.Fatalf("expected operations on y to be linearizable, got %v", res)
+	}
+	if filtered := FilterHistory(ops, func(Operation) bool { return false }); len(filtered) != 0 {
+		t.Fatalf("expected an empty history, got %v", filtered)
+	}
+}
+
+func TestFilterEvents(t *testing.T) {
+	for _, test := range []struct {
+		name string
+		ok   bool
+	}{{"c10-ok", true}, {"c10-bad", false}} {
+		events := parseKvLog("test_data/kv/" + test.name + ".txt")
+		keys := make(map[string]bool)
+		for _, event := range events {
+			if event.Kind == CallEvent {
+				keys[event.Value.(kvInput).key] = true
+			}
+		}
+		illegal := 0
+		for key := range keys {
+			filtered := FilterEvents(events, ByInput(func(input interface{}) bool {
+				return input.(kvInput).key == key
+			}))
+			if issues := ValidateEvents(filtered); len(issues) != 0 {
+				t.Fatalf("%s: expected matched calls and returns, got %v", test.name, issues)
+			}
+			for _, event := range filtered {
+				if event.Kind == CallEvent && event.Value.(kvInput).key != key {
+					t.Fatalf("%s: unexpected event %v for key %q", test.name, event, key)
+				}
+			}
+			if !CheckEvents(kvNoPartitionModel, filtered) {
+				illegal++
+			}
+		}
+		if test.ok && illegal != 0 || !test.ok && illegal == 0 {
+			t.Fatalf("%s: unexpected number of keys with a violation %d", test.name, illegal)
+		}
+	}
+
+	// the return value is available to filters
+	events := parseKvLog("test_data/kv/c01-ok.txt")
+	reads := FilterEvents(events, func(op Operation) bool {
+		return op.Input.(kvInput).op == 0 && op.Output.(kvOutput).value != ""
+	})
+	if len(reads) == 0 {
+		t.Fatal("expected reads")
+	}
+	for _, event := range reads {
+		if event.Kind == ReturnEvent && event.Value.(kvOutput).value == "" {
+			t.Fatalf("unexpected read %v", event)
+		}
+	}
+}
@@ -0,0 +1,321 @@
+package porcupine
+
+import (
+	"reflect"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// The incremental checker keeps the search of checkSingle for each partition
+// between checks: the cache of the states that it reached, and its path.
+//
+// Operations that are appended to a history can only be linearized after the
+// operations that returned before they were called, so the events before the
+// earliest call of the new operations stay the same. The search can't move
+// past the earliest pending return without linearizing its operation, so from
+// a state whose earliest pending return comes before the new events, it makes
+// the same moves as before. A state from which the search never reached one
+// whose earliest pending return is one of the new events, or comes after
+// them, is still a dead end, so the cache records the latest earliest pending
+// return that the search reached from each state, and the checker drops the
+// states that reached the new events. The path of the search is cut at the
+// first state whose earliest pending return doesn't come before the new
+// events, and the search continues from there, exploring every move from the
+// states on the path again, with the cache skipping the dead ends.
+
+// A CheckHandle holds the state of a check of a history, so that operations
+// appended to the history can be checked without checking it again from
+// scratch. It's returned by [CheckOperationsIncremental]. A CheckHandle is not
+// safe for concurrent use.
+type CheckHandle struct {
+	model      Model
+	fastType   reflect.Type
+	history    []Operation
+	partitions []*incrementalPartition
+}
+
+// An incrementalPartition is the state of the check of one partition.
+type incrementalPartition struct {
+	ops     []Operation // the operations, whose ids are their indices
+	events  []entry     // the events, sorted by time
+	result  CheckResult // the result of the last search, or Unknown
+	search  incrementalSearch
+	longest []*[]int // from the last search, for partial linearizations
+}
+
+// An incrementalSearch is what checkSingle keeps of the search of a partition
+// between checks.
+type incrementalSearch struct {
+	alloc  searchAllocator // of the cache
+	cache  *stateCache
+	path   []int         // the operations linearized on the path of the search
+	states []interface{} // the state before each of them, and after the last
+}
+
+// CheckOperationsIncremental checks whether a history is linearizable, like
+// [CheckOperationsVerbose], and returns a handle with which operations that
+// are appended to the history later can be checked with
+// [CheckHandle.Extend], without checking the history again from scratch.
+func CheckOperationsIncremental(model Model, history []Operation, timeout time.Duration) (CheckResult, LinearizationInfo, *CheckHandle) {
+	h := &CheckHandle{model: fillDefault(model), fastType: fastStateType(model)}
+	res, info := h.Extend(history, timeout)
+	return res, info, h
+}
+
+// Extend appends operations to the history, and checks whether the history
+// with them is linearizable, with a timeout, where 0 means no timeout. Only
+// the partitions with new operations are checked again, and in them, the
+// search continues from the earliest call of the new operations. New
+// operations may overlap with operations that were already checked, but the
+// closer the new operations are to the end of the history, the less work
+// there is to do.
+//
+// If the check times out, the progress made is kept, so a later call to
+// Extend, with or without new operations, continues from where it stopped.
+func (h *CheckHandle) Extend(newOps []Operation, timeout time.Duration) (CheckResult, LinearizationInfo) {
+	h.history = append(h.history, newOps...)
+	h.repartition()
+
+	kill := int32(0)
+	if timeout > 0 {
+		timer := time.AfterFunc(timeout, func() { atomic.StoreInt32(&kill, 1) })
+		defer timer.Stop()
+	}
+	var wg sync.WaitGroup
+	for _, p := range h.partitions {
+		if p.result != Unknown {
+			continue
+		}
+		wg.Add(1)
+		go func(p *incrementalPartition) {
+			defer wg.Done()
+			ok, longest := checkSingle(h.model, p.events, searchOptions{
+				fastType:       h.fastType,
+				computePartial: true,
+				kill:           &kill,
+				stats:          &searchStats{},
+				incr:           &p.search,
+			})
+			p.longest = longest
+			switch {
+			case ok:
+				p.result = Ok
+			case atomic.LoadInt32(&kill) != 0:
+				p.result = Unknown
+			default:
+				p.result = Illegal
+			}
+		}(p)
+	}
+	wg.Wait()
+
+	result := Ok
+	for _, p := range h.partitions {
+		if p.result == Illegal {
+			result = Illegal
+			break
+		}
+		if p.result == Unknown {
+			result = Unknown
+		}
+	}
+	return result, h.info()
+}
+
+// opIdentity is the part of an operation by which repartition looks up the
+// partitions that might match; inputs and outputs aren't necessarily
+// comparable with ==, so samePrefix compares them separately.
+type opIdentity struct {
+	clientId      int
+	call, return_ int64
+}
+
+func identify(op Operation) opIdentity {
+	return opIdentity{op.ClientId, op.Call, op.Return}
+}
+
+// repartition partitions the history, and matches the partitions with the
+// ones checked before: a partition that starts with the operations of a
+// previous partition extends it, and any other partition is checked from
+// scratch.
+func (h *CheckHandle) repartition() {
+	previous := make(map[opIdentity][]*incrementalPartition, len(h.partitions))
+	for _, p := range h.partitions {
+		id := identify(p.ops[0])
+		previous[id] = append(previous[id], p)
+	}
+	partitions := h.model.Partition(h.history)
+	h.partitions = h.partitions[:0]
+	for _, ops := range partitions {
+		if len(ops) == 0 {
+			continue
+		}
+		var p *incrementalPartition
+		candidates := previous[identify(ops[0])]
+		for i, c := range candidates {
+			if len(c.ops) <= len(ops) && samePrefix(c.ops, ops) {
+				p = c
+				previous[identify(ops[0])] = append(candidates[:i:i], candidates[i+1:]...)
+				break
+			}
+		}
+		if p == nil {
+			p = &incrementalPartition{result: Unknown}
+		}
+		p.append(ops[len(p.ops):])
+		h.partitions = append(h.partitions, p)
+	}
+}
+
+func samePrefix(prefix, ops []Operation) bool {
+	for i, op := range prefix {
+		if identify(op) != identify(ops[i]) || !reflect.DeepEqual(op.Input, ops[i].Input) || !reflect.DeepEqual(op.Output, ops[i].Output) {
+			return false
+		}
+	}
+	return true
+}
+
+// append adds operations to the partition. The events before the earliest
+// call of the new operations stay the same, and the search keeps what it
+// learned from them.
+func (p *incrementalPartition) append(ops []Operation) {
+	if len(ops) == 0 {
+		return
+	}
+	minCall := ops[0].Call
+	for _, op := range ops {
+		if op.Call < minCall {
+			minCall = op.Call
+		}
+	}
+	kept := sort.Search(len(p.events), func(i int) bool { return p.events[i].time >= minCall })
+	keptReturns := 0
+	for _, e := range p.events[:kept] {
+		if e.kind == returnEntry {
+			keptReturns++
+		}
+	}
+	tail := append([]entry(nil), p.events[kept:]...)
+	for _, op := range ops {
+		id := len(p.ops)
+		p.ops = append(p.ops, op)
+		tail = append(tail,
+			entry{callEntry, op.Input, id, op.Call, op.ClientId},
+			entry{returnEntry, op.Output, id, op.Return, op.ClientId})
+	}
+	sort.Sort(byTime(tail))
+	// the events may be in a LinearizationInfo that was returned before,
+	// so they're copied rather than overwritten
+	p.events = append(p.events[:kept:kept], tail...)
+	p.result = Unknown
+	p.search.rewind(p.events, len(p.ops), keptReturns)
+}
+
+// rewind prepares the search to continue after the events from the return
+// with the given rank on changed: it drops the states from which the search
+// reached that return, and cuts the path at the first state whose earliest
+// pending return isn't before it.
+func (s *incrementalSearch) rewind(events []entry, n, keptReturns int) {
+	if s.cache != nil {
+		s.cache.prune(uint32(keptReturns))
+	}
+	returns := make([]int, 0, keptReturns) // ids of the kept returns, in order
+	for _, e := range events {
+		if len(returns) == keptReturns {
+			break
+		}
+		if e.kind == returnEntry {
+			returns = append(returns, e.id)
+		}
+	}
+	linearized := make([]bool, n)
+	earliest := 0 // index in returns of the earliest pending return
+	for i, id := range s.path {
+		for earliest < len(returns) && linearized[returns[earliest]] {
+			earliest++
+		}
+		if earliest == len(returns) {
+			s.path, s.states = s.path[:i], s.states[:i+1]
+			return
+		}
+		linearized[id] = true
+	}
+}
+
+// cacheFor returns the cache of the search, which the search of a partition
+// with the given order of operations uses. The states that remain after
+// rewind only hold operations called before the new ones, whose ranks in the
+// order stay the same, so their keys do too.
+func (s *incrementalSearch) cacheFor(model Model, fastType reflect.Type, order *opOrder) *stateCache {
+	if s.cache == nil {
+		s.cache = newStateCache(model, &s.alloc, fastType, order)
+	} else {
+		s.cache.order = order
+	}
+	return s.cache
+}
+
+// restore moves a search that is at the start of a partition, whose linked
+// entries are nodes, along the path of the last search.
+func (s *incrementalSearch) restore(nodes []node, linearized *linearizedSet, calls []callsEntry, state interface{}) ([]callsEntry, interface{}) {
+	if len(s.states) == 0 {
+		return calls, state
+	}
+	callNode := make([]*node, len(nodes)/2)
+	for i := range nodes {
+		if nodes[i].match != nil {
+			callNode[nodes[i].id] = &nodes[i]
+		}
+	}
+	for i, id := range s.path {
+		linearized.set(id)
+		lift(callNode[id])
+		calls = append(calls, callsEntry{callNode[id], s.states[i]})
+	}
+	return calls, s.states[len(s.path)]
+}
+
+// save records the path of the search.
+func (s *incrementalSearch) save(calls []callsEntry, state interface{}) {
+	s.path, s.states = s.path[:0], s.states[:0]
+	for _, call := range calls {
+		s.path = append(s.path, call.entry.id)
+		s.states = append(s.states, call.state)
+	}
+	s.states = append(s.states, state)
+}
+
+// returnRanks returns the rank of the return of each operation of a
+// partition, by id, among the returns.
+func returnRanks(history []entry) []uint32 {
+	ranks := make([]uint32, len(history)/2)
+	rank := uint32(0)
+	for _, e := range history {
+		if e.kind == returnEntry {
+			ranks[e.id] = rank
+			rank++
+		}
+	}
+	return ranks
+}
+
+// info returns the information for visualizing the current state of the
+// check: a linearization of each partition that is linearizable, and the
+// longest partial linearizations otherwise.
+func (h *CheckHandle) info() LinearizationInfo {
+	info := LinearizationInfo{
+		history: make([][]entry, len(h.partitions)),
+		results: make([]CheckResult, len(h.partitions)),
+	}
+	longest := make([][]*[]int, len(h.partitions))
+	for i, p := range h.partitions {
+		info.history[i] = p.events
+		info.results[i] = p.result
+		longest[i] = p.longest
+	}
+	info.partialLinearizations = collectPartialLinearizations(longest)
+	return info
+}
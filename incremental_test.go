@@ -0,0 +1,243 @@
+package porcupine
+
+import (
+	"io/ioutil"
+	"math/rand"
+	"sort"
+	"strconv"
+	"testing"
+	"time"
+)
+
+// randomKvHistory returns a random history of a key-value store, where each
+// operation takes effect at a random time between its call and return. With
+// probability bad, a get returns a wrong value, so that the history is
+// unlikely to be linearizable.
+func randomKvHistory(rng *rand.Rand, clients, ops int, keys []string, bad float64) []Operation {
+	type op struct {
+		Operation
+		at int64
+	}
+	var history []op
+	now := make([]int64, clients)
+	for i := 0; i < ops; i++ {
+		client := rng.Intn(clients)
+		call := now[client] + int64(rng.Intn(5))
+		ret := call + 1 + int64(rng.Intn(20))
+		now[client] = ret + 1
+		input := kvInput{op: uint8(rng.Intn(3)), key: keys[rng.Intn(len(keys))], value: strconv.Itoa(rng.Intn(3))}
+		at := call + rng.Int63n(ret-call+1)
+		history = append(history, op{Operation{ClientId: client, Input: input, Call: call, Return: ret}, at})
+	}
+	// apply the operations in the order in which they take effect, breaking
+	// ties by call time so that no operation takes effect before one that
+	// returned before it was called
+	sort.SliceStable(history, func(i, j int) bool {
+		if history[i].at != history[j].at {
+			return history[i].at < history[j].at
+		}
+		return history[i].Call < history[j].Call
+	})
+	state := make(map[string]string)
+	for i := range history {
+		input := history[i].Input.(kvInput)
+		switch input.op {
+		case 0:
+			value := state[input.key]
+			if rng.Float64() < bad {
+				value += "x"
+			}
+			history[i].Output = kvOutput{value}
+		case 1:
+			state[input.key] = input.value
+			history[i].Output = kvOutput{}
+		case 2:
+			state[input.key] += input.value
+			history[i].Output = kvOutput{}
+		}
+	}
+	result := make([]Operation, len(history))
+	for i, op := range history {
+		result[i] = op.Operation
+	}
+	rng.Shuffle(len(result), func(i, j int) { result[i], result[j] = result[j], result[i] })
+	return result
+}
+
+// growingBatches splits a history into the batches of operations that return
+// in successive windows of time, in order of return, as a test that records
+// operations as they complete would see them.
+func growingBatches(rng *rand.Rand, history []Operation) [][]Operation {
+	ops := append([]Operation(nil), history...)
+	sort.SliceStable(ops, func(i, j int) bool { return ops[i].Return < ops[j].Return })
+	var batches [][]Operation
+	for len(ops) > 0 {
+		end := ops[0].Return + int64(rng.Intn(40))
+		n := sort.Search(len(ops), func(i int) bool { return ops[i].Return > end })
+		batches = append(batches, ops[:n])
+		ops = ops[n:]
+	}
+	return batches
+}
+
+// checkIncrementalInfo checks that the linearization reported for each
+// partition that is linearizable is a linearization of it.
+func checkIncrementalInfo(t *testing.T, model Model, info LinearizationInfo) {
+	t.Helper()
+	for i, result := range info.results {
+		if result != Ok {
+			continue
+		}
+		ops := make(map[int]entry)
+		for _, e := range info.history[i] {
+			if e.kind == callEntry {
+				ops[e.id] = e
+			}
+		}
+		outputs := make(map[int]entry)
+		for _, e := range info.history[i] {
+			if e.kind == returnEntry {
+				outputs[e.id] = e
+			}
+		}
+		linearization := info.partialLinearizations[i][0]
+		if len(linearization) != len(ops) {
+			t.Fatalf("partition %d: linearization has %d operations, expected %d", i, len(linearization), len(ops))
+		}
+		state := model.Init()
+		for j, id := range linearization {
+			var ok bool
+			ok, state = model.Step(state, ops[id].value, outputs[id].value)
+			if !ok {
+				t.Fatalf("partition %d: operation %d of the linearization is illegal", i, j)
+			}
+			for _, later := range linearization[j+1:] {
+				if outputs[later].time < ops[id].time {
+					t.Fatalf("partition %d: operation %d is linearized before %d, which returned before it was called", i, id, later)
+				}
+			}
+		}
+	}
+}
+
+func testIncrementalDifferential(t *testing.T, model Model, keys []string, bad float64) {
+	for seed := int64(1); seed <= 30; seed++ {
+		rng := rand.New(rand.NewSource(seed))
+		history := randomKvHistory(rng, 1+rng.Intn(5), 20+rng.Intn(100), keys, bad)
+		var handle *CheckHandle
+		var checked []Operation
+		for _, batch := range growingBatches(rng, history) {
+			var res CheckResult
+			var info LinearizationInfo
+			checked = append(checked, batch...)
+			if handle == nil {
+				res, info, handle = CheckOperationsIncremental(model, batch, 0)
+			} else {
+				res, info = handle.Extend(batch, 0)
+			}
+			if expected := CheckOperations(model, checked); (res == Ok) != expected {
+				t.Fatalf("seed %d: incremental check says %s after %d operations, full check says %t", seed, res, len(checked), expected)
+			}
+			checkIncrementalInfo(t, model, info)
+		}
+	}
+}
+
+func TestIncrementalRegister(t *testing.T) {
+	testIncrementalDifferential(t, kvNoPartitionModel, []string{"x"}, 0)
+}
+
+func TestIncrementalRegisterBad(t *testing.T) {
+	testIncrementalDifferential(t, kvNoPartitionModel, []string{"x"}, 0.05)
+}
+
+func TestIncrementalKv(t *testing.T) {
+	testIncrementalDifferential(t, kvModel, []string{"x", "y", "z"}, 0)
+}
+
+func TestIncrementalKvBad(t *testing.T) {
+	testIncrementalDifferential(t, kvModel, []string{"x", "y", "z"}, 0.02)
+}
+
+func TestIncrementalKvLogs(t *testing.T) {
+	for _, log := range []string{"c01-ok", "c01-bad", "c10-ok", "c10-bad"} {
+		history, err := EventsToOperations(parseKvLog("test_data/kv/" + log + ".txt"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		expected := CheckOperations(kvModel, history)
+		rng := rand.New(rand.NewSource(1))
+		var handle *CheckHandle
+		var res CheckResult
+		var info LinearizationInfo
+		for _, batch := range growingBatches(rng, history) {
+			if handle == nil {
+				res, info, handle = CheckOperationsIncremental(kvModel, batch, 0)
+			} else {
+				res, info = handle.Extend(batch, 0)
+			}
+		}
+		if (res == Ok) != expected {
+			t.Fatalf("%s: incremental check says %s, full check says %t", log, res, expected)
+		}
+		checkIncrementalInfo(t, kvModel, info)
+		if err := Visualize(kvModel, info, ioutil.Discard); err != nil {
+			t.Fatalf("%s: %v", log, err)
+		}
+	}
+}
+
+func TestIncrementalMatchesInputs(t *testing.T) {
+	// the first operations of the partitions differ only in their inputs
+	put := Operation{ClientId: 0, Input: kvInput{op: 1, key: "x", value: "1"}, Call: 0, Output: kvOutput{}, Return: 10}
+	res, _, handle := CheckOperationsIncremental(kvModel, []Operation{put}, 0)
+	if res != Ok {
+		t.Fatalf("expected the history to be linearizable, got %s", res)
+	}
+	get := Operation{ClientId: 0, Input: kvInput{op: 0, key: "y"}, Call: 0, Output: kvOutput{"1"}, Return: 10}
+	if res, _ := handle.Extend([]Operation{get}, 0); res != Illegal {
+		t.Fatalf("expected the history not to be linearizable, got %s", res)
+	}
+}
+
+func TestIncrementalExtendIsIncremental(t *testing.T) {
+	rng := rand.New(rand.NewSource(1))
+	history := randomKvHistory(rng, 4, 2000, []string{"x"}, 0)
+	sort.Slice(history, func(i, j int) bool { return history[i].Return < history[j].Return })
+	steps := 0
+	model := kvModel
+	model.Step = func(state, input, output interface{}) (bool, interface{}) {
+		steps++
+		return kvModel.Step(state, input, output)
+	}
+	res, _, handle := CheckOperationsIncremental(model, history[:len(history)-10], 0)
+	if res != Ok {
+		t.Fatalf("expected the history to be linearizable, got %s", res)
+	}
+	full := steps
+	steps = 0
+	if res, _ := handle.Extend(history[len(history)-10:], 0); res != Ok {
+		t.Fatalf("expected the history to be linearizable, got %s", res)
+	}
+	if steps*20 > full {
+		t.Fatalf("extending the history by 10 operations took %d steps, checking it took %d", steps, full)
+	}
+}
+
+func TestIncrementalTimeout(t *testing.T) {
+	history, err := EventsToOperations(parseKvLog("test_data/kv/c10-ok.txt"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	res, _, handle := CheckOperationsIncremental(kvModel, history, time.Nanosecond)
+	if res != Unknown {
+		t.Skipf("check finished before the timeout: %s", res)
+	}
+	// the check continues from where it stopped
+	for res == Unknown {
+		res, _ = handle.Extend(nil, time.Second)
+	}
+	if res != Ok {
+		t.Fatalf("expected the history to be linearizable, got %s", res)
+	}
+}
@@ -0,0 +1,501 @@
+package jepsen
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// A Keyword is an EDN keyword, such as :invoke, without the leading colon.
+type Keyword string
+
+func (k Keyword) String() string {
+	return ":" + string(k)
+}
+
+// A Symbol is an EDN symbol other than nil, true, and false.
+type Symbol string
+
+// A Set is an EDN set, with its elements in the order in which they appear.
+type Set []interface{}
+
+// A Tagged value is an EDN tagged element, such as #inst "2020-01-01".
+type Tagged struct {
+	Tag   Symbol
+	Value interface{}
+}
+
+// A Decoder reads EDN values from an input stream.
+//
+// Values are decoded as follows: nil as nil, booleans as bool, integers as
+// int64, floating-point numbers as float64, strings as string, characters as
+// rune, keywords as [Keyword], symbols as [Symbol], vectors and lists as
+// []interface{}, maps as map[interface{}]interface{}, sets as [Set], and
+// tagged elements as [Tagged]. Maps with keys that are not comparable, such
+// as vectors, are not supported.
+type Decoder struct {
+	r     *bufio.Reader
+	line  int
+	depth int
+}
+
+// maximum nesting depth of collections, to bound the recursion
+const maxDepth = 10000
+
+var errUnexpectedEOF = errors.New("unexpected end of input")
+
+// NewDecoder returns a decoder that reads from r.
+func NewDecoder(r io.Reader) *Decoder {
+	return &Decoder{r: bufio.NewReader(r), line: 1}
+}
+
+// Decode reads the next EDN value from the input. It returns io.EOF when
+// there are no more values.
+func (d *Decoder) Decode() (interface{}, error) {
+	for {
+		if err := d.skipSpace(); err != nil {
+			return nil, err
+		}
+		v, err := d.value()
+		if err != nil {
+			if err == io.EOF {
+				err = errUnexpectedEOF
+			}
+			return nil, fmt.Errorf("jepsen: line %d: %w", d.line, err)
+		}
+		if _, ok := v.(discarded); !ok {
+			return v, nil
+		}
+	}
+}
+
+func (d *Decoder) read() (rune, error) {
+	c, _, err := d.r.ReadRune()
+	if c == '\n' {
+		d.line++
+	}
+	return c, err
+}
+
+func (d *Decoder) unread(c rune) {
+	d.r.UnreadRune()
+	if c == '\n' {
+		d.line--
+	}
+}
+
+func isSpace(c rune) bool {
+	return unicode.IsSpace(c) || c == ','
+}
+
+func isDelimiter(c rune) bool {
+	return isSpace(c) || strings.ContainsRune(`()[]{}";`, c)
+}
+
+// skipSpace skips whitespace and comments, and returns io.EOF if it reaches
+// the end of the input.
+func (d *Decoder) skipSpace() error {
+	for {
+		c, err := d.read()
+		if err != nil {
+			return err
+		}
+		if c == ';' {
+			for c != '\n' {
+				if c, err = d.read(); err != nil {
+					return err
+				}
+			}
+			continue
+		}
+		if !isSpace(c) {
+			d.unread(c)
+			return nil
+		}
+	}
+}
+
+// token reads the rest of a token, up to the next delimiter.
+func (d *Decoder) token() (string, error) {
+	var b strings.Builder
+	for {
+		c, err := d.read()
+		if err == io.EOF {
+			return b.String(), nil
+		} else if err != nil {
+			return "", err
+		}
+		if isDelimiter(c) {
+			d.unread(c)
+			return b.String(), nil
+		}
+		b.WriteRune(c)
+	}
+}
+
+func (d *Decoder) value() (interface{}, error) {
+	c, err := d.read()
+	if err != nil {
+		return nil, err
+	}
+	switch {
+	case c == '[':
+		return d.collection(']')
+	case c == '(':
+		return d.collection(')')
+	case c == '{':
+		return d.mapValue()
+	case c == '"':
+		return d.stringValue()
+	case c == ':':
+		tok, err := d.token()
+		if err != nil {
+			return nil, err
+		}
+		if tok == "" {
+			return nil, errors.New("empty keyword")
+		}
+		return Keyword(tok), nil
+	case c == '\\':
+		return d.char()
+	case c == '#':
+		return d.dispatch()
+	case c == ']' || c == ')' || c == '}':
+		return nil, fmt.Errorf("unexpected %q", c)
+	}
+	d.unread(c)
+	tok, err := d.token()
+	if err != nil {
+		return nil, err
+	}
+	return atom(tok)
+}
+
+func atom(tok string) (interface{}, error) {
+	switch tok {
+	case "nil":
+		return nil, nil
+	case "true":
+		return true, nil
+	case "false":
+		return false, nil
+	}
+	if tok == "" {
+		return nil, errors.New("empty token")
+	}
+	start := tok
+	if len(start) > 1 && (start[0] == '-' || start[0] == '+') {
+		start = start[1:]
+	}
+	if start[0] < '0' || start[0] > '9' {
+		return Symbol(tok), nil
+	}
+	if strings.HasSuffix(tok, "M") {
+		tok = strings.TrimSuffix(tok, "M")
+		f, err := strconv.ParseFloat(tok, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid number %q", tok)
+		}
+		return f, nil
+	}
+	if strings.ContainsAny(tok, ".eE") {
+		f, err := strconv.ParseFloat(tok, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid number %q", tok)
+		}
+		return f, nil
+	}
+	i, err := strconv.ParseInt(strings.TrimSuffix(tok, "N"), 10, 64)
+	if err != nil {
+		return nil, fmt.Errorf("invalid integer %q", tok)
+	}
+	return i, nil
+}
+
+func (d *Decoder) collection(end rune) ([]interface{}, error) {
+	d.depth++
+	defer func() { d.depth-- }()
+	if d.depth > maxDepth {
+		return nil, errors.New("collections are nested too deeply")
+	}
+	values := []interface{}{}
+	for {
+		if err := d.skipSpace(); err != nil {
+			return nil, err
+		}
+		c, err := d.read()
+		if err != nil {
+			return nil, err
+		}
+		if c == end {
+			return values, nil
+		}
+		d.unread(c)
+		v, err := d.value()
+		if err != nil {
+			return nil, err
+		}
+		if _, ok := v.(discarded); ok {
+			continue
+		}
+		values = append(values, v)
+	}
+}
+
+func (d *Decoder) mapValue() (map[interface{}]interface{}, error) {
+	values, err := d.collection('}')
+	if err != nil {
+		return nil, err
+	}
+	if len(values)%2 != 0 {
+		return nil, errors.New("map literal must contain an even number of forms")
+	}
+	m := make(map[interface{}]interface{}, len(values)/2)
+	for i := 0; i < len(values); i += 2 {
+		switch values[i].(type) {
+		case []interface{}, map[interface{}]interface{}, Set, Tagged:
+			return nil, fmt.Errorf("unsupported map key %v", values[i])
+		}
+		m[values[i]] = values[i+1]
+	}
+	return m, nil
+}
+
+func (d *Decoder) stringValue() (string, error) {
+	var b strings.Builder
+	for {
+		c, err := d.read()
+		if err != nil {
+			return "", err
+		}
+		switch c {
+		case '"':
+			return b.String(), nil
+		case '\\':
+			c, err = d.read()
+			if err != nil {
+				return "", err
+			}
+			switch c {
+			case 't':
+				b.WriteRune('\t')
+			case 'r':
+				b.WriteRune('\r')
+			case 'n':
+				b.WriteRune('\n')
+			case '\\', '"':
+				b.WriteRune(c)
+			case 'u':
+				var hex [4]rune
+				for i := range hex {
+					if hex[i], err = d.read(); err != nil {
+						return "", err
+					}
+				}
+				code, err := strconv.ParseUint(string(hex[:]), 16, 16)
+				if err != nil {
+					return "", fmt.Errorf("invalid unicode escape \\u%s", string(hex[:]))
+				}
+				b.WriteRune(rune(code))
+			default:
+				return "", fmt.Errorf("invalid escape \\%c", c)
+			}
+		default:
+			b.WriteRune(c)
+		}
+	}
+}
+
+var namedChars = map[string]rune{
+	"newline": '\n',
+	"return":  '\r',
+	"space":   ' ',
+	"tab":     '\t',
+}
+
+func (d *Decoder) char() (rune, error) {
+	c, err := d.read()
+	if err != nil {
+		return 0, err
+	}
+	rest, err := d.token()
+	if err != nil {
+		return 0, err
+	}
+	if rest == "" {
+		return c, nil
+	}
+	name := string(c) + rest
+	if named, ok := namedChars[name]; ok {
+		return named, nil
+	}
+	if c == 'u' && len(rest) == 4 {
+		code, err := strconv.ParseUint(rest, 16, 16)
+		if err == nil {
+			return rune(code), nil
+		}
+	}
+	return 0, fmt.Errorf("invalid character \\%s", name)
+}
+
+// discarded is the value of a #_ form, which is skipped inside collections.
+type discarded struct{}
+
+func (d *Decoder) dispatch() (interface{}, error) {
+	c, err := d.read()
+	if err != nil {
+		return nil, err
+	}
+	switch c {
+	case '{':
+		values, err := d.collection('}')
+		if err != nil {
+			return nil, err
+		}
+		return Set(values), nil
+	case '_':
+		if err := d.skipSpace(); err != nil {
+			return nil, err
+		}
+		if _, err := d.value(); err != nil {
+			return nil, err
+		}
+		return discarded{}, nil
+	}
+	d.unread(c)
+	tag, err := d.token()
+	if err != nil {
+		return nil, err
+	}
+	if tag == "" {
+		return nil, fmt.Errorf("invalid dispatch character %q", c)
+	}
+	if err := d.skipSpace(); err != nil {
+		return nil, err
+	}
+	v, err := d.value()
+	if err != nil {
+		return nil, err
+	}
+	return Tagged{Tag: Symbol(tag), Value: v}, nil
+}
+
+// MarshalEDN returns the EDN encoding of v. It supports the types produced
+// by [Decoder], along with all integer, floating-point, slice, array, and map
+// types. Characters decoded as runes are encoded as integers.
+func MarshalEDN(v interface{}) ([]byte, error) {
+	var b bytes.Buffer
+	if err := encodeEDN(&b, v); err != nil {
+		return nil, err
+	}
+	return b.Bytes(), nil
+}
+
+func encodeEDN(b *bytes.Buffer, v interface{}) error {
+	switch v := v.(type) {
+	case nil:
+		b.WriteString("nil")
+		return nil
+	case Keyword:
+		b.WriteString(v.String())
+		return nil
+	case Symbol:
+		b.WriteString(string(v))
+		return nil
+	case Set:
+		b.WriteString("#")
+		return encodeEDNSeq(b, '{', '}', len(v), func(i int) interface{} { return v[i] })
+	case Tagged:
+		fmt.Fprintf(b, "#%s ", v.Tag)
+		return encodeEDN(b, v.Value)
+	}
+	rv := reflect.ValueOf(v)
+	switch rv.Kind() {
+	case reflect.Bool:
+		b.WriteString(strconv.FormatBool(rv.Bool()))
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		b.WriteString(strconv.FormatInt(rv.Int(), 10))
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		b.WriteString(strconv.FormatUint(rv.Uint(), 10))
+	case reflect.Float32, reflect.Float64:
+		f := rv.Float()
+		if math.IsInf(f, 0) || math.IsNaN(f) {
+			return fmt.Errorf("jepsen: can't encode %v in EDN", f)
+		}
+		s := strconv.FormatFloat(f, 'g', -1, 64)
+		if !strings.ContainsAny(s, ".eE") {
+			s += ".0"
+		}
+		b.WriteString(s)
+	case reflect.String:
+		quoteEDN(b, rv.String())
+	case reflect.Slice, reflect.Array:
+		return encodeEDNSeq(b, '[', ']', rv.Len(), func(i int) interface{} { return rv.Index(i).Interface() })
+	case reflect.Map:
+		// sort the encoded entries, so the output is deterministic
+		entries := make([]string, 0, rv.Len())
+		iter := rv.MapRange()
+		for iter.Next() {
+			var entry bytes.Buffer
+			if err := encodeEDN(&entry, iter.Key().Interface()); err != nil {
+				return err
+			}
+			entry.WriteByte(' ')
+			if err := encodeEDN(&entry, iter.Value().Interface()); err != nil {
+				return err
+			}
+			entries = append(entries, entry.String())
+		}
+		sort.Strings(entries)
+		b.WriteString("{" + strings.Join(entries, ", ") + "}")
+	default:
+		return fmt.Errorf("jepsen: can't encode value of type %T in EDN", v)
+	}
+	return nil
+}
+
+func encodeEDNSeq(b *bytes.Buffer, open, close byte, n int, elem func(i int) interface{}) error {
+	b.WriteByte(open)
+	for i := 0; i < n; i++ {
+		if i > 0 {
+			b.WriteByte(' ')
+		}
+		if err := encodeEDN(b, elem(i)); err != nil {
+			return err
+		}
+	}
+	b.WriteByte(close)
+	return nil
+}
+
+func quoteEDN(b *bytes.Buffer, s string) {
+	b.WriteByte('"')
+	for _, c := range s {
+		switch c {
+		case '"', '\\':
+			b.WriteByte('\\')
+			b.WriteRune(c)
+		case '\n':
+			b.WriteString(`\n`)
+		case '\r':
+			b.WriteString(`\r`)
+		case '\t':
+			b.WriteString(`\t`)
+		default:
+			if c < 0x20 || c == 0x7f {
+				fmt.Fprintf(b, `\u%04x`, c)
+			} else {
+				b.WriteRune(c)
+			}
+		}
+	}
+	b.WriteByte('"')
+}
@@ -0,0 +1,99 @@
+package jepsen
+
+import (
+	"io"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestDecode(t *testing.T) {
+	input := `
+		nil true false 42 -7 +3 12N 1.5 -2e3 3.25M
+		"a \"quoted\"\n string é" \a \newline
+		:invoke :jepsen.history/op sym
+		[1 [2 3] ()] {:a 1, "b" [nil]} #{1 2}
+		#inst "2020-01-01T00:00:00Z"
+		; a comment
+		[1 #_ 2 3] #_ :discarded :last`
+	expected := []interface{}{
+		nil, true, false, int64(42), int64(-7), int64(3), int64(12), 1.5, -2000.0, 3.25,
+		"a \"quoted\"\n string é", 'a', '\n',
+		Keyword("invoke"), Keyword("jepsen.history/op"), Symbol("sym"),
+		[]interface{}{int64(1), []interface{}{int64(2), int64(3)}, []interface{}{}},
+		map[interface{}]interface{}{Keyword("a"): int64(1), "b": []interface{}{nil}},
+		Set{int64(1), int64(2)},
+		Tagged{Symbol("inst"), "2020-01-01T00:00:00Z"},
+		[]interface{}{int64(1), int64(3)},
+		Keyword("last"),
+	}
+	d := NewDecoder(strings.NewReader(input))
+	for i, e := range expected {
+		v, err := d.Decode()
+		if err != nil {
+			t.Fatalf("value %d: %v", i, err)
+		}
+		if !reflect.DeepEqual(v, e) {
+			t.Fatalf("value %d: expected %#v, got %#v", i, e, v)
+		}
+	}
+	if _, err := d.Decode(); err != io.EOF {
+		t.Fatalf("expected EOF, got %v", err)
+	}
+}
+
+func TestDecodeErrors(t *testing.T) {
+	for _, input := range []string{
+		`[1 2`,
+		`{:a 1`,
+		`"unterminated`,
+		`{:a}`,
+		`{[1] 2}`,
+		`)`,
+		`12x`,
+		`"\q"`,
+		`:`,
+		`\bogus`,
+		strings.Repeat("[", maxDepth+1),
+	} {
+		d := NewDecoder(strings.NewReader(input))
+		if _, err := d.Decode(); err == nil || err == io.EOF {
+			t.Fatalf("expected error for %q, got %v", input, err)
+		}
+	}
+}
+
+func TestMarshalEDN(t *testing.T) {
+	tests := []struct {
+		value    interface{}
+		expected string
+	}{
+		{nil, "nil"},
+		{42, "42"},
+		{int32(-7), "-7"},
+		{uint8(3), "3"},
+		{2.0, "2.0"},
+		{true, "true"},
+		{"a \"b\"\n\x01", `"a \"b\"\n\u0001"`},
+		{Keyword("ok"), ":ok"},
+		{[]int{1, 2}, "[1 2]"},
+		{[]interface{}{nil, "x", []string{}}, `[nil "x" []]`},
+		{map[string]int{"b": 2, "a": 1}, `{"a" 1, "b" 2}`},
+		{Set{int64(1)}, "#{1}"},
+	}
+	for _, test := range tests {
+		b, err := MarshalEDN(test.value)
+		if err != nil {
+			t.Fatalf("%v: %v", test.value, err)
+		}
+		if string(b) != test.expected {
+			t.Fatalf("expected %s, got %s", test.expected, b)
+		}
+		if _, err := NewDecoder(strings.NewReader(string(b))).Decode(); err != nil {
+			t.Fatalf("%s: %v", b, err)
+		}
+	}
+	if _, err := MarshalEDN(struct{}{}); err == nil {
+		t.Fatal("expected error for unsupported type")
+	}
+}
@@ -0,0 +1,244 @@
+// Package jepsen reads histories recorded by Jepsen, so that they can be
+// checked with porcupine.
+//
+// Jepsen records a history as a sequence of operation maps, written in EDN:
+//
+//	{:type :invoke, :f :write, :value 3, :process 0, :time 1000, :index 0}
+//	{:type :ok, :f :write, :value 3, :process 0, :time 2000, :index 1}
+//
+// Each operation is invoked by a process and completes with :ok if it took
+// effect, :fail if it did not, or :info if its outcome is unknown.
+package jepsen
+
+import (
+	"fmt"
+	"io"
+
+	"github.com/anishathalye/porcupine"
+)
+
+// An Op is an operation in a Jepsen history: either an invocation or a
+// completion.
+type Op struct {
+	// Type is "invoke", "ok", "fail", or "info".
+	Type string
+	// Process is the process that performed the operation: an int64 for
+	// clients, or a keyword such as :nemesis for other processes.
+	Process interface{}
+	// F is the function of the operation, usually a [Keyword] such as
+	// :read.
+	F     interface{}
+	Value interface{}
+	// Time is the time of the operation in nanoseconds, or 0 if it was not
+	// recorded.
+	Time int64
+	// Index is the index of the operation in the history, or -1 if it was
+	// not recorded.
+	Index int64
+	// Fields contains all the fields of the operation map, including ones
+	// that are not covered above.
+	Fields map[interface{}]interface{}
+}
+
+// ReadOps reads a Jepsen history in EDN, either as a sequence of operation
+// maps (like history.edn) or as a single vector of operation maps.
+func ReadOps(r io.Reader) ([]Op, error) {
+	d := NewDecoder(r)
+	var ops []Op
+	for {
+		v, err := d.Decode()
+		if err == io.EOF {
+			return ops, nil
+		} else if err != nil {
+			return nil, err
+		}
+		values := []interface{}{v}
+		if vector, ok := v.([]interface{}); ok {
+			values = vector
+		}
+		for _, v := range values {
+			op, err := parseOp(v)
+			if err != nil {
+				return nil, fmt.Errorf("jepsen: operation %d: %w", len(ops), err)
+			}
+			ops = append(ops, op)
+		}
+	}
+}
+
+func parseOp(v interface{}) (Op, error) {
+	m, ok := v.(map[interface{}]interface{})
+	if !ok {
+		return Op{}, fmt.Errorf("expected a map, got %v", v)
+	}
+	op := Op{
+		Process: m[Keyword("process")],
+		F:       m[Keyword("f")],
+		Value:   m[Keyword("value")],
+		Index:   -1,
+		Fields:  m,
+	}
+	typ, ok := m[Keyword("type")].(Keyword)
+	if !ok {
+		return Op{}, fmt.Errorf("missing or invalid :type %v", m[Keyword("type")])
+	}
+	switch typ {
+	case "invoke", "ok", "fail", "info":
+		op.Type = string(typ)
+	default:
+		return Op{}, fmt.Errorf("unknown :type %v", typ)
+	}
+	if t, ok := m[Keyword("time")]; ok {
+		if op.Time, ok = t.(int64); !ok {
+			return Op{}, fmt.Errorf("invalid :time %v", t)
+		}
+	}
+	if i, ok := m[Keyword("index")]; ok {
+		if op.Index, ok = i.(int64); !ok {
+			return Op{}, fmt.Errorf("invalid :index %v", i)
+		}
+	}
+	return op, nil
+}
+
+// A Mapper converts Jepsen operations into the inputs and outputs of a
+// porcupine model.
+type Mapper struct {
+	// Input returns the input of the operation with the given invocation.
+	// If nil, the input is the invocation itself, an [Op].
+	Input func(invoke Op) (interface{}, error)
+	// Output returns the output of the operation with the given
+	// invocation and completion. The completion has type "ok", or "info"
+	// if the outcome of the operation is unknown: either the history
+	// recorded an :info completion, or it ended before the operation
+	// completed, in which case the completion is a copy of the invocation
+	// with type "info". If nil, the output is the completion for
+	// operations that completed with "ok", and nil for operations with an
+	// unknown outcome.
+	Output func(invoke, complete Op) (interface{}, error)
+}
+
+func (m Mapper) input(invoke Op) (interface{}, error) {
+	if m.Input == nil {
+		return invoke, nil
+	}
+	return m.Input(invoke)
+}
+
+func (m Mapper) output(invoke, complete Op) (interface{}, error) {
+	if m.Output == nil {
+		if complete.Type == "info" {
+			return nil, nil
+		}
+		return complete, nil
+	}
+	return m.Output(invoke, complete)
+}
+
+// ParseEDNHistory reads a Jepsen history in EDN and converts it into a
+// history of events, where the inputs and outputs are the [Op] values of the
+// invocations and completions, and operations with an unknown outcome have a
+// nil output. See [ToEvents] for how the history is converted.
+func ParseEDNHistory(r io.Reader) ([]porcupine.Event, error) {
+	return ParseEDNHistoryWithMapper(r, Mapper{})
+}
+
+// ParseEDNHistoryWithMapper is like [ParseEDNHistory], but it converts
+// operations with the given mapper.
+func ParseEDNHistoryWithMapper(r io.Reader, m Mapper) ([]porcupine.Event, error) {
+	ops, err := ReadOps(r)
+	if err != nil {
+		return nil, err
+	}
+	return ToEvents(ops, m)
+}
+
+// ToEvents converts a Jepsen history into a history of events, following
+// Jepsen's semantics for the outcomes of operations:
+//
+//   - Operations that complete with :ok took effect, and their return event
+//     is placed at the position of the completion.
+//   - Operations that complete with :fail did not take effect, so they are
+//     left out of the history.
+//   - Operations that complete with :info, or never complete, may or may not
+//     have taken effect, at any point after they were invoked, so their
+//     return events are placed at the end of the history. Models must
+//     accept their outputs, as produced by the mapper, as any outcome.
+//
+// Operations of processes that are not clients, such as the nemesis, are
+// left out of the history. Client ids are the process numbers, and event
+// ids are assigned in the order of invocation.
+func ToEvents(ops []Op, m Mapper) ([]porcupine.Event, error) {
+	// first, find the completion of each invocation
+	completion := make(map[int]int) // from invocation index to completion index
+	invocation := make(map[int]int) // from completion index to invocation index
+	pending := make(map[int64]int)  // from process to invocation index
+	for i, op := range ops {
+		process, ok := op.Process.(int64)
+		if !ok {
+			continue
+		}
+		if op.Type == "invoke" {
+			if j, ok := pending[process]; ok {
+				return nil, fmt.Errorf("jepsen: operation %d: process %d invoked an operation while operation %d is pending", i, process, j)
+			}
+			pending[process] = i
+			continue
+		}
+		j, ok := pending[process]
+		if !ok {
+			return nil, fmt.Errorf("jepsen: operation %d: process %d completed an operation that was not invoked", i, process)
+		}
+		delete(pending, process)
+		completion[j] = i
+		invocation[i] = j
+	}
+
+	var events []porcupine.Event
+	var unknown []porcupine.Event
+	ids := make(map[int]int) // from invocation index to event id
+	for i, op := range ops {
+		process, ok := op.Process.(int64)
+		if !ok {
+			continue
+		}
+		if op.Type == "invoke" {
+			j, completed := completion[i]
+			if completed && ops[j].Type == "fail" {
+				continue
+			}
+			input, err := m.input(op)
+			if err != nil {
+				return nil, fmt.Errorf("jepsen: operation %d: %w", i, err)
+			}
+			id := len(ids)
+			ids[i] = id
+			events = append(events, porcupine.Event{ClientId: int(process), Kind: porcupine.CallEvent, Value: input, Id: id})
+			if !completed {
+				complete := op
+				complete.Type = "info"
+				output, err := m.output(op, complete)
+				if err != nil {
+					return nil, fmt.Errorf("jepsen: operation %d: %w", i, err)
+				}
+				unknown = append(unknown, porcupine.Event{ClientId: int(process), Kind: porcupine.ReturnEvent, Value: output, Id: id})
+			}
+			continue
+		}
+		if op.Type == "fail" {
+			continue
+		}
+		invoke := invocation[i]
+		output, err := m.output(ops[invoke], op)
+		if err != nil {
+			return nil, fmt.Errorf("jepsen: operation %d: %w", i, err)
+		}
+		event := porcupine.Event{ClientId: int(process), Kind: porcupine.ReturnEvent, Value: output, Id: ids[invoke]}
+		if op.Type == "info" {
+			unknown = append(unknown, event)
+		} else {
+			events = append(events, event)
+		}
+	}
+	return append(events, unknown...), nil
+}
@@ -0,0 +1,156 @@
+package jepsen
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/anishathalye/porcupine"
+)
+
+type etcdInput struct {
+	op   uint8 // 0 => read, 1 => write, 2 => cas
+	arg1 int   // used for write, or for CAS from argument
+	arg2 int   // used for CAS to argument
+}
+
+type etcdOutput struct {
+	exists  bool // used for read
+	value   int  // used for read
+	unknown bool // used when the outcome is unknown
+}
+
+var etcdModel = porcupine.Model{
+	Init: func() interface{} { return -1000000 }, // -1000000 corresponds with nil
+	Step: func(state interface{}, input interface{}, output interface{}) (bool, interface{}) {
+		st := state.(int)
+		inp := input.(etcdInput)
+		out := output.(etcdOutput)
+		switch inp.op {
+		case 0:
+			ok := (!out.exists && st == -1000000) || (out.exists && st == out.value) || out.unknown
+			return ok, st
+		case 1:
+			return true, inp.arg1
+		default:
+			// a cas that completes with :ok succeeded, since a failed cas
+			// completes with :fail and is left out of the history
+			if out.unknown {
+				if inp.arg1 == st {
+					return true, inp.arg2
+				}
+				return true, st
+			}
+			return inp.arg1 == st, inp.arg2
+		}
+	},
+}
+
+// etcdMapper converts etcd operations into the inputs and outputs of
+// etcdModel
+var etcdMapper = Mapper{
+	Input: func(invoke Op) (interface{}, error) {
+		switch invoke.F {
+		case Keyword("read"):
+			return etcdInput{op: 0}, nil
+		case Keyword("write"):
+			return etcdInput{op: 1, arg1: int(invoke.Value.(int64))}, nil
+		case Keyword("cas"):
+			args := invoke.Value.([]interface{})
+			return etcdInput{op: 2, arg1: int(args[0].(int64)), arg2: int(args[1].(int64))}, nil
+		}
+		return nil, fmt.Errorf("unknown function %v", invoke.F)
+	},
+	Output: func(invoke, complete Op) (interface{}, error) {
+		if complete.Type == "info" {
+			return etcdOutput{unknown: true}, nil
+		}
+		if complete.F == Keyword("read") && complete.Value != nil {
+			return etcdOutput{exists: true, value: int(complete.Value.(int64))}, nil
+		}
+		return etcdOutput{}, nil
+	},
+}
+
+func TestParseEDNHistoryEtcd(t *testing.T) {
+	// verdicts from the corresponding .log files, checked in the main package
+	for logNum, expected := range map[int]bool{0: false, 2: true, 5: true, 7: true} {
+		f, err := os.Open(fmt.Sprintf("../test_data/jepsen/etcd_%03d.edn", logNum))
+		if err != nil {
+			t.Fatal(err)
+		}
+		events, err := ParseEDNHistoryWithMapper(f, etcdMapper)
+		f.Close()
+		if err != nil {
+			t.Fatalf("etcd_%03d: %v", logNum, err)
+		}
+		if res := porcupine.CheckEvents(etcdModel, events); res != expected {
+			t.Fatalf("etcd_%03d: expected output %t, got output %t", logNum, expected, res)
+		}
+	}
+}
+
+func TestParseEDNHistory(t *testing.T) {
+	f, err := os.Open("../test_data/jepsen/register.edn")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	events, err := ParseEDNHistory(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// the nemesis and the failed write are left out, and the crashed cas and
+	// the write that never completes return at the end
+	expected := []struct {
+		kind  porcupine.EventKind
+		id    int
+		index int64 // of the invocation or completion, -1 for unknown
+	}{
+		{porcupine.CallEvent, 0, 0},
+		{porcupine.ReturnEvent, 0, 3},
+		{porcupine.CallEvent, 1, 6},
+		{porcupine.CallEvent, 2, 8},
+		{porcupine.ReturnEvent, 2, 9},
+		{porcupine.CallEvent, 3, 10},
+		{porcupine.ReturnEvent, 1, -1},
+		{porcupine.ReturnEvent, 3, -1},
+	}
+	if len(events) != len(expected) {
+		t.Fatalf("expected %d events, got %d: %v", len(expected), len(events), events)
+	}
+	for i, e := range expected {
+		event := events[i]
+		if event.Kind != e.kind || event.Id != e.id {
+			t.Fatalf("event %d: expected %v of %d, got %+v", i, e.kind, e.id, event)
+		}
+		if e.index == -1 {
+			if event.Value != nil {
+				t.Fatalf("event %d: expected nil output for unknown outcome, got %v", i, event.Value)
+			}
+			continue
+		}
+		if op := event.Value.(Op); op.Index != e.index {
+			t.Fatalf("event %d: expected op with index %d, got %+v", i, e.index, op)
+		}
+	}
+	if cas := events[2].Value.(Op); cas.F != Keyword("cas") || cas.Fields[Keyword("time")] != int64(40) {
+		t.Fatalf("unexpected cas invocation %+v", cas)
+	}
+}
+
+func TestToEventsErrors(t *testing.T) {
+	for _, input := range []string{
+		`{:type :invoke, :process 0} {:type :invoke, :process 0}`,
+		`{:type :ok, :process 0}`,
+		`{:type :sideways, :process 0}`,
+		`{:process 0}`,
+		`[1 2]`,
+		`{:type :invoke, :process 0, :time "now"}`,
+	} {
+		if _, err := ParseEDNHistory(strings.NewReader(input)); err == nil {
+			t.Fatalf("expected error for %q", input)
+		}
+	}
+}
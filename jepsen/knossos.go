@@ -0,0 +1,80 @@
+package jepsen
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+
+	"github.com/anishathalye/porcupine"
+)
+
+// ExportKnossos writes a history of operations as a Jepsen history in EDN,
+// one operation map per line, which can be checked with Knossos, for example
+// to cross-check porcupine's verdicts. It can be read back with [ReadOps].
+//
+// Each operation is written as an :invoke followed by an :ok completion,
+// ordered by their Call and Return timestamps like
+// [porcupine.OperationsToEvents] does, with the function and value returned
+// by describe. The value is used for both the invocation and the
+// completion; Knossos only looks at the completion value of reads. Values
+// can be nil, integers, strings, [Keyword] values, and slices and maps of
+// such values, which are written as vectors and maps.
+//
+// Operations with a nil Output are pending, as recorded by
+// [porcupine.Recorder], and are completed with :info instead. Since Jepsen
+// processes perform one operation at a time, and never again after an :info
+// completion, operations of a client that overlap with a pending operation
+// of the same client are assigned new process numbers, starting after the
+// largest client id.
+func ExportKnossos(w io.Writer, ops []porcupine.Operation, describe func(porcupine.Operation) (f string, value interface{})) error {
+	bw := bufio.NewWriter(w)
+	maxClient := -1
+	for _, op := range ops {
+		if op.ClientId > maxClient {
+			maxClient = op.ClientId
+		}
+	}
+	nextProcess := maxClient + 1
+	process := make(map[int]int) // from client to its current process
+	busy := make(map[int]bool)   // processes with an operation in progress
+	opProcess := make([]int, len(ops))
+	for i, event := range porcupine.OperationsToEvents(ops) {
+		op := ops[event.Id]
+		if event.Kind == porcupine.CallEvent {
+			p, ok := process[op.ClientId]
+			if !ok {
+				p = op.ClientId
+			}
+			if busy[p] {
+				p = nextProcess
+				nextProcess++
+			}
+			process[op.ClientId] = p
+			busy[p] = true
+			opProcess[event.Id] = p
+		} else if op.Output != nil {
+			// after an :info completion, the process stays busy forever
+			busy[opProcess[event.Id]] = false
+		}
+		f, value := describe(op)
+		typ := Keyword("invoke")
+		time := op.Call
+		if event.Kind == porcupine.ReturnEvent {
+			typ = Keyword("ok")
+			if op.Output == nil {
+				typ = Keyword("info")
+			}
+			time = op.Return
+			if time < op.Call {
+				time = op.Call
+			}
+		}
+		encoded, err := MarshalEDN(value)
+		if err != nil {
+			return fmt.Errorf("%w (operation %d)", err, event.Id)
+		}
+		fmt.Fprintf(bw, "{:type %s, :f %s, :value %s, :process %d, :time %d, :index %d}\n",
+			typ, Keyword(f), encoded, opProcess[event.Id], time, i)
+	}
+	return bw.Flush()
+}
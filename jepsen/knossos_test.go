@@ -0,0 +1,128 @@
+package jepsen
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/anishathalye/porcupine"
+)
+
+type registerInput struct {
+	op    bool // false = put, true = get
+	value int
+}
+
+// describeRegister describes register operations as Knossos register
+// operations
+func describeRegister(op porcupine.Operation) (string, interface{}) {
+	inp := op.Input.(registerInput)
+	if inp.op {
+		if op.Output == nil {
+			return "read", nil
+		}
+		return "read", op.Output
+	}
+	return "write", inp.value
+}
+
+// registerMapper converts Knossos register operations back
+var registerMapper = Mapper{
+	Input: func(invoke Op) (interface{}, error) {
+		if invoke.F == Keyword("read") {
+			return registerInput{true, 0}, nil
+		}
+		return registerInput{false, int(invoke.Value.(int64))}, nil
+	},
+	Output: func(invoke, complete Op) (interface{}, error) {
+		if complete.Type == "info" {
+			return nil, nil
+		}
+		if complete.F == Keyword("read") {
+			return int(complete.Value.(int64)), nil
+		}
+		return 0, nil
+	},
+}
+
+// a register where a nil output is a pending operation
+var registerModel = porcupine.Model{
+	Init: func() interface{} {
+		return 0
+	},
+	Step: func(state, input, output interface{}) (bool, interface{}) {
+		inp := input.(registerInput)
+		if !inp.op {
+			return true, inp.value
+		}
+		return output == nil || output.(int) == state.(int), state
+	},
+}
+
+func TestExportKnossos(t *testing.T) {
+	histories := [][]porcupine.Operation{{
+		{ClientId: 0, Input: registerInput{false, 100}, Call: 0, Output: 0, Return: 100},
+		{ClientId: 1, Input: registerInput{true, 0}, Call: 25, Output: 100, Return: 75},
+		{ClientId: 2, Input: registerInput{true, 0}, Call: 30, Output: 0, Return: 60},
+	}, {
+		{ClientId: 0, Input: registerInput{false, 200}, Call: 0, Output: 0, Return: 100},
+		{ClientId: 1, Input: registerInput{true, 0}, Call: 10, Output: 200, Return: 30},
+		{ClientId: 1, Input: registerInput{true, 0}, Call: 40, Output: 0, Return: 90},
+	}, {
+		// a pending write, after which the client continues
+		{ClientId: 0, Input: registerInput{false, 1}, Call: 0, Output: 0, Return: 10},
+		{ClientId: 1, Input: registerInput{false, 2}, Call: 20, Output: nil, Return: 1000},
+		{ClientId: 1, Input: registerInput{true, 0}, Call: 30, Output: 2, Return: 40},
+		{ClientId: 0, Input: registerInput{true, 0}, Call: 50, Output: 1, Return: 60},
+	}}
+	for i, ops := range histories {
+		var b bytes.Buffer
+		if err := ExportKnossos(&b, ops, describeRegister); err != nil {
+			t.Fatalf("history %d: %v", i, err)
+		}
+		events, err := ParseEDNHistoryWithMapper(bytes.NewReader(b.Bytes()), registerMapper)
+		if err != nil {
+			t.Fatalf("history %d: %v\n%s", i, err, b.String())
+		}
+		if porcupine.CheckOperations(registerModel, ops) != porcupine.CheckEvents(registerModel, events) {
+			t.Fatalf("history %d: expected exported history to have the same verdict", i)
+		}
+	}
+}
+
+func TestExportKnossosProcesses(t *testing.T) {
+	ops := []porcupine.Operation{
+		{ClientId: 0, Input: registerInput{false, 1}, Call: 0, Output: nil, Return: 1000},
+		{ClientId: 0, Input: registerInput{true, 0}, Call: 10, Output: 1, Return: 20},
+		{ClientId: 0, Input: registerInput{true, 0}, Call: 30, Output: 1, Return: 40},
+		{ClientId: 1, Input: registerInput{true, 0}, Call: 50, Output: 1, Return: 60},
+	}
+	var b bytes.Buffer
+	if err := ExportKnossos(&b, ops, describeRegister); err != nil {
+		t.Fatal(err)
+	}
+	parsed, err := ReadOps(&b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got []string
+	for _, op := range parsed {
+		got = append(got, fmt.Sprintf("%s %v %d", op.Type, op.F, op.Process))
+	}
+	// the pending write keeps process 0 busy, so client 0 continues as
+	// process 2, and client 1 keeps process 1
+	expected := []string{
+		"invoke :write 0",
+		"invoke :read 2",
+		"ok :read 2",
+		"invoke :read 2",
+		"ok :read 2",
+		"invoke :read 1",
+		"ok :read 1",
+		"info :write 0",
+	}
+	if strings.Join(got, "\n") != strings.Join(expected, "\n") {
+		t.Fatalf("expected\n%s\ngot\n%s", strings.Join(expected, "\n"), strings.Join(got, "\n"))
+	}
+}
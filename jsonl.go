@@ -0,0 +1,98 @@
+package porcupine
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+)
+
+// WriteJSONL writes a history of events in the JSON Lines format, with one
+// JSON object per line, which is convenient for tools like jq:
+//
+//	{"clientId":0,"kind":"call","value":{"type":"input","value":...},"id":0}
+//
+// Values are encoded like [MarshalEvents] does, so their types must be
+// registered with [RegisterType].
+func WriteJSONL(w io.Writer, history []Event) error {
+	bw := bufio.NewWriter(w)
+	enc := json.NewEncoder(bw)
+	for i, event := range history {
+		e, err := encodeEvent(event)
+		if err != nil {
+			return fmt.Errorf("%w (value of event %d)", err, i)
+		}
+		// Encode terminates each object with a newline
+		if err := enc.Encode(e); err != nil {
+			return err
+		}
+	}
+	return bw.Flush()
+}
+
+// ReadJSONL reads a history of events written by [WriteJSONL]. Blank lines
+// are skipped, and fields other than the ones written by WriteJSONL, such as
+// timestamps added by other tools, are ignored.
+func ReadJSONL(r io.Reader) ([]Event, error) {
+	var history []Event
+	err := ReadJSONLFunc(r, func(event Event) error {
+		history = append(history, event)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return history, nil
+}
+
+// ReadJSONLFunc is like [ReadJSONL], but it calls fn with each event as it is
+// read, instead of loading the entire history into memory. If fn returns an
+// error, ReadJSONLFunc stops and returns that error.
+func ReadJSONLFunc(r io.Reader, fn func(Event) error) error {
+	jr := newJSONLReader(r)
+	for {
+		event, ok, err := jr.next()
+		if err != nil || !ok {
+			return err
+		}
+		if err := fn(event); err != nil {
+			return err
+		}
+	}
+}
+
+// A jsonlReader reads the events written by WriteJSONL one at a time.
+type jsonlReader struct {
+	br   *bufio.Reader
+	line int
+	eof  bool
+}
+
+func newJSONLReader(r io.Reader) *jsonlReader {
+	return &jsonlReader{br: bufio.NewReader(r)}
+}
+
+// next returns the next event and true, or false at the end of the input.
+func (jr *jsonlReader) next() (Event, bool, error) {
+	for !jr.eof {
+		jr.line++
+		data, err := jr.br.ReadBytes('\n')
+		if err != nil && err != io.EOF {
+			return Event{}, false, fmt.Errorf("porcupine: line %d: %w", jr.line, err)
+		}
+		jr.eof = err == io.EOF
+		if trimmed := bytes.TrimSpace(data); len(trimmed) > 0 {
+			var e serializedEvent
+			if err := json.Unmarshal(trimmed, &e); err != nil {
+				return Event{}, false, fmt.Errorf("porcupine: line %d: %w", jr.line, err)
+			}
+			event, err := decodeEvent(e)
+			if err != nil {
+				return Event{}, false, fmt.Errorf("%w (line %d)", err, jr.line)
+			}
+			return event, true, nil
+		}
+	}
+	return Event{}, false, nil
+}
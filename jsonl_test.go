@@ -0,0 +1,82 @@
+package porcupine
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+)
+
+func TestJSONL(t *testing.T) {
+	ops := []Operation{
+		{0, codecRegisterInput{false, 100}, 0, 0, 100},
+		{1, codecRegisterInput{true, 0}, 25, 100, 75},
+		{2, codecRegisterInput{true, 0}, 30, 0, 60},
+	}
+	events := OperationsToEvents(ops)
+	var b bytes.Buffer
+	if err := WriteJSONL(&b, events); err != nil {
+		t.Fatal(err)
+	}
+	lines := strings.Split(strings.TrimSuffix(b.String(), "\n"), "\n")
+	if len(lines) != len(events) {
+		t.Fatalf("expected one line per event, got %q", b.String())
+	}
+	// blank lines and trailing newlines are fine
+	decoded, err := ReadJSONL(strings.NewReader("\n" + strings.Join(lines, "\n\n") + "\n\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(decoded) != len(events) {
+		t.Fatalf("expected %v, got %v", events, decoded)
+	}
+	for i := range events {
+		if decoded[i] != events[i] {
+			t.Fatalf("expected %v, got %v", events, decoded)
+		}
+	}
+}
+
+func TestJSONLVerdicts(t *testing.T) {
+	for _, logName := range []string{"c01-bad", "c01-ok", "c10-bad", "c10-ok"} {
+		events := parseKvLog(fmt.Sprintf("test_data/kv/%s.txt", logName))
+		var b bytes.Buffer
+		if err := WriteJSONL(&b, events); err != nil {
+			t.Fatalf("%s: %v", logName, err)
+		}
+		decoded, err := ReadJSONL(&b)
+		if err != nil {
+			t.Fatalf("%s: %v", logName, err)
+		}
+		if CheckEvents(kvModel, decoded) != CheckEvents(kvModel, events) {
+			t.Fatalf("%s: expected decoded events to have the same verdict", logName)
+		}
+	}
+}
+
+func TestJSONLErrors(t *testing.T) {
+	input := `{"clientId":0,"kind":"call","value":{"type":"int","value":1},"id":0,"time":12}
+
+{"clientId":0,"kind":"return","value":{"type":"int","value":1},"id":0}
+{"clientId":0,"kind":"call",`
+	_, err := ReadJSONL(strings.NewReader(input))
+	if err == nil || !strings.Contains(err.Error(), "line 4") {
+		t.Fatalf("expected error on line 4, got %v", err)
+	}
+	_, err = ReadJSONL(strings.NewReader(`{"clientId":0,"kind":"call","value":{"type":"missing","value":1},"id":0}`))
+	if err == nil || !strings.Contains(err.Error(), "line 1") || !strings.Contains(err.Error(), `"missing"`) {
+		t.Fatalf("expected error naming the type on line 1, got %v", err)
+	}
+
+	// the callback can stop reading early
+	stop := errors.New("stop")
+	calls := 0
+	err = ReadJSONLFunc(strings.NewReader(input), func(Event) error {
+		calls++
+		return stop
+	})
+	if err != stop || calls != 1 {
+		t.Fatalf("expected callback error after 1 call, got %v after %d calls", err, calls)
+	}
+}
@@ -0,0 +1,177 @@
+package porcupine
+
+import (
+	"fmt"
+	"math"
+	"math/bits"
+)
+
+// The cache of checkSingle identifies each state by the set of operations
+// that were linearized to reach it. Copying, hashing, and comparing a bitset
+// of those operations takes time linear in the number of operations in the
+// partition, at every step, which makes checking a partition with hundreds of
+// thousands of operations quadratic, and its cache too large to fit in
+// memory.
+//
+// The search linearizes operations roughly in the order of their calls,
+// though. Every operation that was called before the earliest one that isn't
+// linearized has been linearized, and the operations called after it that
+// have been linearized were called before it returned, since its return
+// comes before their calls otherwise, and the search can't move past its
+// return without linearizing it. So a linearizedSet numbers operations in the
+// order of their calls, and keeps track of the earliest one that isn't
+// linearized; the cache keys each state by that operation and the words of
+// the bitset from it to the latest operation that is linearized, which takes
+// time and space proportional to the number of operations that are
+// concurrent with it, rather than to the length of the partition. Operations
+// that never returned are concurrent with everything after them, so with
+// those, keys are as large as bitsets of the rest of the partition.
+
+// maxPartitionOperations is the most operations that a partition can have:
+// an opOrder numbers them with uint32s, and the rank of the earliest operation
+// that isn't linearized goes up to the number of operations.
+const maxPartitionOperations = math.MaxUint32
+
+// checkPartitionSizes returns an error if a partition has more operations
+// than the checker supports, before the search makes allocations that would
+// overflow or fail.
+func checkPartitionSizes(history [][]entry) error {
+	for i, subhistory := range history {
+		if n := uint64(len(subhistory) / 2); n > maxPartitionOperations {
+			return fmt.Errorf("porcupine: partition %d has %d operations, more than the %d that the checker supports", i, n, uint64(maxPartitionOperations))
+		}
+	}
+	return nil
+}
+
+// An opOrder numbers the operations of a partition in the order of their
+// calls.
+type opOrder struct {
+	rank []uint32 // of each operation, by id
+	id   []uint32 // of each operation, by rank
+}
+
+func newOpOrder(history []entry) *opOrder {
+	n := len(history) / 2
+	o := &opOrder{rank: make([]uint32, n), id: make([]uint32, 0, n)}
+	for _, e := range history {
+		if e.kind == callEntry {
+			o.rank[e.id] = uint32(len(o.id))
+			o.id = append(o.id, uint32(e.id))
+		}
+	}
+	return o
+}
+
+// A linearizedKey identifies a set of linearized operations, by the rank of
+// the earliest operation that isn't in it, and the words of the bitset of
+// ranks from the one that holds it up to the last one with an operation that
+// is in the set. The bits below it are all set, so they are the same in
+// every key with the same rank.
+type linearizedKey struct {
+	low   uint32
+	words []uint64
+}
+
+func (k linearizedKey) hash() uint64 {
+	hash := uint64(k.low)
+	for _, word := range k.words {
+		hash = mixHash(hash, word)
+	}
+	return hash
+}
+
+func (k linearizedKey) equals(k2 linearizedKey) bool {
+	if k.low != k2.low || len(k.words) != len(k2.words) {
+		return false
+	}
+	for i := range k.words {
+		if k.words[i] != k2.words[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// bitset returns the set of operations of a key as a bitset of their ids.
+func (o *opOrder) bitset(k linearizedKey) bitset {
+	b := newBitset(uint(len(o.id)))
+	for r := uint32(0); r < k.low; r++ {
+		b.set(uint(o.id[r]))
+	}
+	for i, word := range k.words {
+		for ; word != 0; word &= word - 1 {
+			r := (uint(k.low)/64+uint(i))*64 + uint(bits.TrailingZeros64(word))
+			b.set(uint(o.id[r]))
+		}
+	}
+	return b
+}
+
+// key returns the key of a set of operations given as a bitset of their ids.
+func (o *opOrder) key(b bitset) linearizedKey {
+	s := newLinearizedSet(o)
+	for i, word := range b {
+		for ; word != 0; word &= word - 1 {
+			s.set(i*64 + bits.TrailingZeros64(word))
+		}
+	}
+	k := s.key()
+	k.words = append([]uint64(nil), k.words...)
+	return k
+}
+
+// A linearizedSet is the set of operations that the search has linearized.
+type linearizedSet struct {
+	order *opOrder
+	bits  pagedBitset // by rank
+	count uint32
+	low   uint32   // rank of the earliest operation that isn't linearized
+	buf   []uint64 // the words of a key that spans pages
+}
+
+func newLinearizedSet(order *opOrder) *linearizedSet {
+	return &linearizedSet{order: order, bits: newPagedBitset(uint(len(order.id)), bitsetPageShift)}
+}
+
+func (s *linearizedSet) set(id int) {
+	r := s.order.rank[id]
+	s.bits.set(uint(r))
+	s.count++
+	if r == s.low {
+		// move low to the next bit that isn't set
+		i := uint(r / 64)
+		word := ^s.bits.word(i) &^ (1<<(r%64) - 1)
+		for word == 0 && i+1 < s.bits.words {
+			i++
+			word = ^s.bits.word(i)
+		}
+		low := i*64 + uint(bits.TrailingZeros64(word))
+		if n := uint(len(s.order.id)); low > n {
+			low = n
+		}
+		s.low = uint32(low)
+	}
+}
+
+func (s *linearizedSet) clear(id int) {
+	r := s.order.rank[id]
+	s.bits.clear(uint(r))
+	s.count--
+	if r < s.low {
+		s.low = r
+	}
+}
+
+// key returns the key of the set, which is valid until the set changes.
+func (s *linearizedSet) key() linearizedKey {
+	first := uint(s.low) / 64
+	// the bits in the words before first are all set
+	need := int(s.count) - int(first)*64
+	end := first
+	for need > 0 {
+		need -= bits.OnesCount64(s.bits.word(end))
+		end++
+	}
+	return linearizedKey{s.low, s.bits.slice(first, end, &s.buf)}
+}
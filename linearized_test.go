@@ -0,0 +1,163 @@
+package porcupine
+
+import (
+	"fmt"
+	"math/rand"
+	"os"
+	"sort"
+	"testing"
+	"time"
+)
+
+func TestLinearizedSet(t *testing.T) {
+	rng := rand.New(rand.NewSource(1))
+	for trial := 0; trial < 100; trial++ {
+		n := 1 + rng.Intn(300)
+		// number operations in a random order of their calls
+		order := &opOrder{rank: make([]uint32, n)}
+		for _, id := range rng.Perm(n) {
+			order.rank[id] = uint32(len(order.id))
+			order.id = append(order.id, uint32(id))
+		}
+		s := newLinearizedSet(order)
+		if trial%2 == 1 {
+			// pages of a few words, so keys span them
+			s.bits = newPagedBitset(uint(n), uint(trial/2%3))
+		}
+		linearized := newBitset(uint(n))
+		type saved struct {
+			bits bitset
+			key  linearizedKey
+		}
+		var seen []saved
+		for step := 0; step < 500; step++ {
+			id := rng.Intn(n)
+			// favor the earliest operations, as the search does
+			if r := rng.Intn(n); rng.Intn(2) == 0 && r < int(s.low)+8 {
+				id = int(order.id[r])
+			}
+			if linearized[id/64]&(1<<(id%64)) == 0 {
+				s.set(id)
+				linearized.set(uint(id))
+			} else {
+				s.clear(id)
+				linearized.clear(uint(id))
+			}
+			key := s.key()
+			if got := order.bitset(key); !bitsetEquals(got, linearized) {
+				t.Fatalf("trial %d, step %d: key holds %v, expected %v", trial, step, got, linearized)
+			}
+			if other := order.key(linearized); !other.equals(key) || other.hash() != key.hash() {
+				t.Fatalf("trial %d, step %d: key of the bitset differs from the key of the set", trial, step)
+			}
+			for _, old := range seen {
+				if old.key.equals(key) != bitsetEquals(old.bits, linearized) {
+					t.Fatalf("trial %d, step %d: keys compare differently from their sets", trial, step)
+				}
+			}
+			words := append([]uint64(nil), key.words...)
+			seen = append(seen, saved{linearized.clone(), linearizedKey{key.low, words}})
+		}
+	}
+}
+
+func bitsetEquals(a, b bitset) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// randomRegisterHistory returns a linearizable history of a register, with
+// operations from a few clients that overlap a few others at a time.
+func randomRegisterHistory(rng *rand.Rand, clients, ops int) []Operation {
+	type op struct {
+		Operation
+		at int64
+	}
+	history := make([]op, ops)
+	now := make([]int64, clients)
+	for i := range history {
+		client := rng.Intn(clients)
+		call := now[client] + int64(rng.Intn(3))
+		ret := call + 1 + int64(rng.Intn(10))
+		now[client] = ret + 1
+		input := registerInput{op: rng.Intn(2) == 0, value: rng.Intn(100)}
+		history[i] = op{Operation{ClientId: client, Input: input, Call: call, Return: ret}, call + rng.Int63n(ret-call+1)}
+	}
+	sort.SliceStable(history, func(i, j int) bool {
+		if history[i].at != history[j].at {
+			return history[i].at < history[j].at
+		}
+		return history[i].Call < history[j].Call
+	})
+	state := 0
+	result := make([]Operation, ops)
+	for i, op := range history {
+		input := op.Input.(registerInput)
+		if input.op {
+			op.Output = state
+		} else {
+			state = input.value
+			op.Output = 0
+		}
+		result[i] = op.Operation
+	}
+	return result
+}
+
+// TestHugePartition checks a single client's history of 20 million
+// operations, whose bitset of linearized operations spans several pages. It
+// takes a few minutes and about 12 GB of memory, so it only runs when the
+// PORCUPINE_HUGE_TESTS environment variable is set.
+func TestHugePartition(t *testing.T) {
+	if os.Getenv("PORCUPINE_HUGE_TESTS") == "" {
+		t.Skip("set PORCUPINE_HUGE_TESTS to run")
+	}
+	const ops = 20000000
+	history := make([]Operation, ops)
+	state := 0
+	for i := range history {
+		op := Operation{ClientId: 0, Call: int64(2 * i), Return: int64(2*i + 1)}
+		if i%3 == 2 {
+			op.Input, op.Output = registerInput{true, 0}, state
+		} else {
+			state = i % 100
+			op.Input, op.Output = registerInput{false, state}, 0
+		}
+		history[i] = op
+	}
+	if res := CheckOperationsTimeout(registerModel, history, 0); res != Ok {
+		t.Fatalf("expected output %v, got output %v", Ok, res)
+	}
+	// the last operation reads a value other than the one written before it
+	history[ops-1].Input, history[ops-1].Output = registerInput{true, 0}, (state+1)%100
+	if res := CheckOperationsTimeout(registerModel, history, 0); res != Illegal {
+		t.Fatalf("expected output %v, got output %v", Illegal, res)
+	}
+}
+
+// BenchmarkLargePartition checks a single register with many operations. Its
+// cache is keyed by the operations since the earliest one that isn't
+// linearized, so the time per operation stays about the same as the
+// partition grows, where it grew with the length of the partition when the
+// cache held a bitset of every operation.
+func BenchmarkLargePartition(b *testing.B) {
+	for _, ops := range []int{50000, 500000} {
+		history := randomRegisterHistory(rand.New(rand.NewSource(1)), 5, ops)
+		b.Run(fmt.Sprintf("ops=%d", ops), func(b *testing.B) {
+			start := time.Now()
+			for i := 0; i < b.N; i++ {
+				if !CheckOperations(registerModel, history) {
+					b.Fatal("expected the history to be linearizable")
+				}
+			}
+			b.ReportMetric(float64(time.Since(start).Nanoseconds())/float64(b.N*ops), "ns/operation")
+		})
+	}
+}
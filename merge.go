@@ -0,0 +1,80 @@
+package porcupine
+
+import (
+	"fmt"
+	"sort"
+)
+
+// A RecordedHistory is a history recorded on one node, with timestamps from
+// the node's local clock, to be merged with [MergeHistories].
+type RecordedHistory struct {
+	// Node identifies the node that recorded the history.
+	Node       string
+	Operations []Operation
+	// Offset is the estimated offset of the node's clock from the common
+	// time axis: a local timestamp t corresponds to t - Offset on the
+	// common axis.
+	Offset int64
+	// Uncertainty bounds the error of Offset: the true offset is within
+	// Offset ± Uncertainty.
+	Uncertainty int64
+}
+
+// A NodeClient identifies a client of a node in a merged history.
+type NodeClient struct {
+	Node     string
+	ClientId int
+}
+
+// MergeHistories merges histories recorded on multiple nodes into a single
+// history. The timestamps of each node are rebased onto a common axis by
+// subtracting the node's Offset, and then each operation is widened by the
+// node's Uncertainty on both sides, so that the merged history only orders
+// operations of different nodes if their clocks justify it, no matter where
+// the true offsets lie within their bounds.
+//
+// Clients of different nodes get distinct client ids in the merged history.
+// The returned slice maps each new client id to the node and client id it
+// came from; clients are numbered in the order of the nodes, and by their
+// original client id within each node. Operations appear in the order of the
+// nodes, and in their original order within each node.
+//
+// It returns an error if two histories have the same node, or if an
+// uncertainty is negative.
+func MergeHistories(parts []RecordedHistory) ([]Operation, []NodeClient, error) {
+	nodes := make(map[string]bool)
+	var history []Operation
+	var clients []NodeClient
+	for _, part := range parts {
+		if nodes[part.Node] {
+			return nil, nil, fmt.Errorf("porcupine: duplicate node %q", part.Node)
+		}
+		nodes[part.Node] = true
+		if part.Uncertainty < 0 {
+			return nil, nil, fmt.Errorf("porcupine: node %q has negative uncertainty %d", part.Node, part.Uncertainty)
+		}
+
+		var ids []int
+		seen := make(map[int]bool)
+		for _, op := range part.Operations {
+			if !seen[op.ClientId] {
+				seen[op.ClientId] = true
+				ids = append(ids, op.ClientId)
+			}
+		}
+		sort.Ints(ids)
+		mapping := make(map[int]int, len(ids))
+		for _, id := range ids {
+			mapping[id] = len(clients)
+			clients = append(clients, NodeClient{Node: part.Node, ClientId: id})
+		}
+
+		for _, op := range part.Operations {
+			op.ClientId = mapping[op.ClientId]
+			op.Call = op.Call - part.Offset - part.Uncertainty
+			op.Return = op.Return - part.Offset + part.Uncertainty
+			history = append(history, op)
+		}
+	}
+	return history, clients, nil
+}
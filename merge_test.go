@@ -0,0 +1,90 @@
+package porcupine
+
+import "testing"
+
+func TestMergeHistories(t *testing.T) {
+	// node b's clock is 1000 ahead of node a's, so the get on a appears to
+	// happen before the put on b that it observes
+	a := RecordedHistory{
+		Node: "a",
+		Operations: []Operation{
+			{5, registerInput{true, 0}, 20, 1, 30},
+		},
+	}
+	b := RecordedHistory{
+		Node: "b",
+		Operations: []Operation{
+			{3, registerInput{false, 1}, 1000, 0, 1010},
+			{5, registerInput{false, 2}, 1100, 0, 1110},
+		},
+		Offset: 1000,
+	}
+	naive := append(append([]Operation{}, a.Operations...), b.Operations...)
+	if CheckOperations(registerModel, naive) {
+		t.Fatal("expected naive merge to be non-linearizable")
+	}
+	merged, clients, err := MergeHistories([]RecordedHistory{a, b})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !CheckOperations(registerModel, merged) {
+		t.Fatal("expected merged history to be linearizable")
+	}
+	expectedClients := []NodeClient{{"a", 5}, {"b", 3}, {"b", 5}}
+	if len(clients) != len(expectedClients) {
+		t.Fatalf("expected clients %v, got %v", expectedClients, clients)
+	}
+	for i := range clients {
+		if clients[i] != expectedClients[i] {
+			t.Fatalf("expected clients %v, got %v", expectedClients, clients)
+		}
+	}
+	expected := []Operation{
+		{0, registerInput{true, 0}, 20, 1, 30},
+		{1, registerInput{false, 1}, 0, 0, 10},
+		{2, registerInput{false, 2}, 100, 0, 110},
+	}
+	for i := range expected {
+		if merged[i] != expected[i] {
+			t.Fatalf("expected %v, got %v", expected, merged)
+		}
+	}
+}
+
+func TestMergeHistoriesUncertainty(t *testing.T) {
+	// the offset estimate for b is off by 25, so without widening, the get
+	// on a still appears to happen before the put it observes
+	a := RecordedHistory{
+		Node:       "a",
+		Operations: []Operation{{0, registerInput{true, 0}, 20, 1, 30}},
+	}
+	b := RecordedHistory{
+		Node:       "b",
+		Operations: []Operation{{0, registerInput{false, 1}, 1010, 0, 1020}},
+		Offset:     975,
+	}
+	merged, _, err := MergeHistories([]RecordedHistory{a, b})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if CheckOperations(registerModel, merged) {
+		t.Fatal("expected merged history without uncertainty to be non-linearizable")
+	}
+	b.Uncertainty = 25
+	merged, _, err = MergeHistories([]RecordedHistory{a, b})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !CheckOperations(registerModel, merged) {
+		t.Fatal("expected merged history with uncertainty to be linearizable")
+	}
+}
+
+func TestMergeHistoriesErrors(t *testing.T) {
+	if _, _, err := MergeHistories([]RecordedHistory{{Node: "a"}, {Node: "a"}}); err == nil {
+		t.Fatal("expected error for duplicate nodes")
+	}
+	if _, _, err := MergeHistories([]RecordedHistory{{Node: "a", Uncertainty: -1}}); err == nil {
+		t.Fatal("expected error for negative uncertainty")
+	}
+}
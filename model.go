@@ -1,6 +1,10 @@
 package porcupine
 
-import "fmt"
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+)
 
 // An Operation is an element of a history.
 //
@@ -57,12 +61,15 @@ type Event struct {
 // representation can just be a single value rather than a map.
 //
 // Implementing DescribeOperation and DescribeState will produce nicer
-// visualizations.
+// visualizations, and DescribeOperationColor can be used to color-code
+// operations in the visualization.
 //
 // It may be helpful to look at this package's [test code] for examples of how
-// to write models, including models that include partition functions.
+// to write models, including models that include partition functions. The
+// [models] package provides models of common systems.
 //
 // [test code]: https://github.com/anishathalye/porcupine/blob/master/porcupine_test.go
+// [models]: https://pkg.go.dev/github.com/anishathalye/porcupine/models
 type Model struct {
 	// Partition functions, such that a history is linearizable if and only
 	// if each partition is linearizable. If left nil, this package will
@@ -77,7 +84,14 @@ type Model struct {
 	// cannot mutate the given state.
 	Step func(state interface{}, input interface{}, output interface{}) (bool, interface{})
 	// Equality on states. If left nil, this package will use == as a
-	// fallback ([ShallowEqual]).
+	// fallback ([ShallowEqual]), and if the initial state is of a type
+	// that can always be compared with ==, such as an int, a string, or
+	// a struct of them, the checker also hashes states, which makes
+	// checks much faster when many states are reached with the same
+	// operations. So Equal is best left nil for such states. It must be
+	// reflexive: if the initial state is of such a type, or a pointer,
+	// the checker doesn't call it for states of that type that are ==,
+	// such as a state that Step returned unchanged.
 	Equal func(state1, state2 interface{}) bool
 	// For visualization, describe an operation as a string. For example,
 	// "Get('x') -> 'y'". Can be omitted if you're not producing
@@ -87,6 +101,228 @@ type Model struct {
 	// example, "{'x' -> 'y', 'z' -> 'w'}". Can be omitted if you're not
 	// producing visualizations.
 	DescribeState func(state interface{}) string
+	// For visualization purposes, choose a color for an operation. The
+	// returned string can be any CSS color, such as "red" or "#ccc"; an
+	// empty string uses the default color. Can be omitted if you're not
+	// producing visualizations.
+	DescribeOperationColor func(input interface{}, output interface{}) string
+	// For visualization purposes, serialize an operation's input and
+	// output as JSON, so the full details of an operation can be shown
+	// when it's selected. A nil result omits the details. Can be omitted
+	// if you're not producing visualizations.
+	SerializeOperation func(input interface{}, output interface{}) json.RawMessage
+	// For coverage reports, classify an operation, for example as
+	// "cas-fail" or "get-absent", so the report shows which kinds of
+	// behavior a history exercised (see CheckOptions.RecordCoverage). If
+	// left nil, operations are classified by the type of their input.
+	ClassifyOperation func(input interface{}, output interface{}) string
+	// For checking session guarantees, describe the objects that an
+	// operation reads and writes, and the values it reads and writes
+	// (see CheckSessionGuarantees). Can be omitted otherwise.
+	Accesses func(input interface{}, output interface{}) []Access
+}
+
+// A NondeterministicModel is a nondeterministic sequential specification of a
+// system.
+//
+// For basics on models, see the documentation for [Model]. In contrast to
+// Model, NondeterministicModel has a step function that returns a set of
+// states, indicating all possible next states. This is useful for systems
+// where the effect of an operation isn't determined by its input and output,
+// for example a write that timed out, which may or may not have taken effect.
+//
+// A NondeterministicModel can be converted to a Model using
+// [NondeterministicModel.ToModel]; the resulting model's states are sets of
+// candidate states of the nondeterministic model.
+type NondeterministicModel struct {
+	// Partition functions, such that a history is linearizable if and only
+	// if each partition is linearizable, as for [Model]. If left nil, this
+	// package will skip partitioning.
+	Partition      func(history []Operation) [][]Operation
+	PartitionEvent func(history []Event) [][]Event
+	// Initial states of the system.
+	Init func() []interface{}
+	// Step function for the system. Returns all possible next states for
+	// the given state, input, and output. If the system cannot step with
+	// the given state and input to produce the given output, this function
+	// should return an empty slice. This function must be a pure function:
+	// it cannot mutate the given state.
+	Step func(state interface{}, input interface{}, output interface{}) []interface{}
+	// Equality on states. If left nil, this package will use == as a
+	// fallback.
+	Equal func(state1, state2 interface{}) bool
+	// Hash function on states, consistent with Equal: states that are
+	// equal must have the same hash. If set, sets of candidate states are
+	// deduplicated and compared in linear rather than quadratic time,
+	// which matters for models where an operation can lead to many
+	// states. Can be omitted.
+	Hash func(state interface{}) uint64
+	// For visualization, describe an operation as a string. Can be omitted
+	// if you're not producing visualizations.
+	DescribeOperation func(input interface{}, output interface{}) string
+	// For visualization purposes, describe a single state as a string.
+	// Can be omitted if you're not producing visualizations.
+	DescribeState func(state interface{}) string
+	// For visualization purposes, describe a set of candidate states as a
+	// string. If left nil, the set is described by listing the
+	// descriptions of the individual states (see DescribeState).
+	DescribeStates func(states []interface{}) string
+}
+
+// nondeterministicState is the state of a Model produced by
+// [NondeterministicModel.ToModel]: the set of candidate states of the
+// nondeterministic model.
+type nondeterministicState []interface{}
+
+// candidateCount returns the number of candidate states if the given state is
+// a state of a model produced by [NondeterministicModel.ToModel], and 0
+// otherwise.
+func candidateCount(state interface{}) int {
+	if states, ok := state.(nondeterministicState); ok {
+		return len(states)
+	}
+	return 0
+}
+
+// A stateSet is a set of states, without duplicates according to an equality
+// function. If there's a hash function, states are only compared with the
+// states that have the same hash.
+type stateSet struct {
+	equal   func(state1, state2 interface{}) bool
+	hash    func(state interface{}) uint64
+	states  nondeterministicState
+	buckets map[uint64][]int // indices into states, by hash
+}
+
+func newStateSet(equal func(state1, state2 interface{}) bool, hash func(state interface{}) uint64) *stateSet {
+	s := &stateSet{equal: equal, hash: hash}
+	if hash != nil {
+		s.buckets = make(map[uint64][]int)
+	}
+	return s
+}
+
+// find returns the hash of a state, if there's a hash function, and whether
+// the set contains the state.
+func (s *stateSet) find(state interface{}) (uint64, bool) {
+	if s.hash == nil {
+		for _, u := range s.states {
+			if s.equal(state, u) {
+				return 0, true
+			}
+		}
+		return 0, false
+	}
+	h := s.hash(state)
+	for _, i := range s.buckets[h] {
+		if s.equal(state, s.states[i]) {
+			return h, true
+		}
+	}
+	return h, false
+}
+
+// add adds a state to the set, unless the set already contains it.
+func (s *stateSet) add(state interface{}) {
+	h, found := s.find(state)
+	if found {
+		return
+	}
+	if s.buckets != nil {
+		s.buckets[h] = append(s.buckets[h], len(s.states))
+	}
+	s.states = append(s.states, state)
+}
+
+// merge removes duplicates from a set of states.
+func merge(states []interface{}, equal func(state1, state2 interface{}) bool, hash func(state interface{}) uint64) nondeterministicState {
+	set := newStateSet(equal, hash)
+	for _, state := range states {
+		set.add(state)
+	}
+	return set.states
+}
+
+// sameStates returns whether two sets of states without duplicates contain
+// the same states.
+func sameStates(states1, states2 nondeterministicState, equal func(state1, state2 interface{}) bool, hash func(state interface{}) uint64) bool {
+	if len(states1) != len(states2) {
+		return false
+	}
+	// with no duplicates, states2 contains states1 if and only if they're
+	// the same
+	set := newStateSet(equal, hash)
+	if hash == nil {
+		set.states = states2
+	} else {
+		for _, s2 := range states2 {
+			set.add(s2)
+		}
+	}
+	for _, s1 := range states1 {
+		if _, found := set.find(s1); !found {
+			return false
+		}
+	}
+	return true
+}
+
+// ToModel converts a [NondeterministicModel] to a [Model] using a power set
+// construction: the states of the resulting model are sets of states of the
+// nondeterministic model, and an operation is legal if it is legal from any of
+// the candidate states.
+//
+// This makes it possible to use nondeterministic models with the checker and
+// the visualization, which shows the number of candidate states at every
+// linearization point. The partition functions are passed through unchanged,
+// so that each partition is checked with its own sets of candidate states.
+func (nm NondeterministicModel) ToModel() Model {
+	equal := nm.Equal
+	if equal == nil {
+		equal = shallowEqual
+	}
+	describeOperation := nm.DescribeOperation
+	if describeOperation == nil {
+		describeOperation = defaultDescribeOperation
+	}
+	describeState := nm.DescribeState
+	if describeState == nil {
+		describeState = defaultDescribeState
+	}
+	describeStates := nm.DescribeStates
+	if describeStates == nil {
+		describeStates = func(states []interface{}) string {
+			descriptions := make([]string, len(states))
+			for i, state := range states {
+				descriptions[i] = describeState(state)
+			}
+			return fmt.Sprintf("{%s}", strings.Join(descriptions, ", "))
+		}
+	}
+	return Model{
+		Partition:      nm.Partition,
+		PartitionEvent: nm.PartitionEvent,
+		Init: func() interface{} {
+			return merge(nm.Init(), equal, nm.Hash)
+		},
+		Step: func(state, input, output interface{}) (bool, interface{}) {
+			var next []interface{}
+			for _, s := range state.(nondeterministicState) {
+				next = append(next, nm.Step(s, input, output)...)
+			}
+			unique := merge(next, equal, nm.Hash)
+			return len(unique) > 0, unique
+		},
+		Equal: func(state1, state2 interface{}) bool {
+			states1 := state1.(nondeterministicState)
+			states2 := state2.(nondeterministicState)
+			return sameStates(states1, states2, equal, nm.Hash)
+		},
+		DescribeOperation: describeOperation,
+		DescribeState: func(state interface{}) string {
+			return describeStates(state.(nondeterministicState))
+		},
+	}
 }
 
 // noPartition is a fallback partition function that partitions the history
@@ -108,15 +344,16 @@ func shallowEqual(state1, state2 interface{}) bool {
 }
 
 // defaultDescribeOperation is a fallback to convert an operation to a string.
-// It renders inputs and outputs using the "%v" format specifier.
+// It renders inputs and outputs using the "%v" format specifier, or
+// [DescribeValue] for structs, maps, and slices (see describeDefault).
 func defaultDescribeOperation(input interface{}, output interface{}) string {
-	return fmt.Sprintf("%v -> %v", input, output)
+	return describeDefault(input) + " -> " + describeDefault(output)
 }
 
 // defaultDescribeState is a fallback to convert a state to a string. It
-// renders the state using the "%v" format specifier.
+// renders the state like defaultDescribeOperation renders inputs.
 func defaultDescribeState(state interface{}) string {
-	return fmt.Sprintf("%v", state)
+	return describeDefault(state)
 }
 
 // A CheckResult is the result of a linearizability check.
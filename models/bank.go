@@ -0,0 +1,170 @@
+package models
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/anishathalye/porcupine"
+)
+
+// A BankOp is the kind of an operation of the [Bank] model.
+type BankOp int
+
+const (
+	BankRead BankOp = iota
+	BankTransfer
+)
+
+// BankInput is the input of an operation of the [Bank] model.
+type BankInput struct {
+	Op     BankOp
+	From   string // for transfers
+	To     string // for transfers
+	Amount int    // for transfers
+}
+
+// BankOutput is the output of an operation of the [Bank] model.
+type BankOutput struct {
+	Balances map[string]int // for reads, the balance of every account
+	// Failed is set for transfers that failed because the source account
+	// had insufficient funds.
+	Failed bool
+	// Unknown is set if the outcome of the operation is unknown: a
+	// transfer that timed out may or may not have taken effect, and a read
+	// may have returned anything.
+	Unknown bool
+}
+
+// bankOutput returns the output of an operation, with a nil output, from an
+// operation that never returned, treated as an unknown outcome.
+func bankOutput(output interface{}) BankOutput {
+	if output == nil {
+		return BankOutput{Unknown: true}
+	}
+	return output.(BankOutput)
+}
+
+// Bank returns a model of bank accounts with the given names, each with the
+// given initial balance, as in Jepsen's bank test. The inputs of its
+// operations are [BankInput] values, and the outputs are [BankOutput] values.
+//
+// A transfer moves an amount from one account to another, and fails, with no
+// effect, exactly when the source account's balance is less than the amount.
+// A read returns the balances of all accounts at a single point in time, so a
+// read that sees only one half of a transfer, and so a total balance that
+// isn't conserved, is not legal. Operations on accounts that don't exist are
+// not legal either.
+//
+// The model can't partition histories by account, because transfers involve
+// two accounts and reads involve all of them, so the whole history is checked
+// at once. Its states are lists of balances, in the order of accounts, which
+// are cheap to compare.
+//
+// Transfers with an unknown outcome make the model nondeterministic, so its
+// states are sets of possible lists of balances, as for models converted with
+// [porcupine.NondeterministicModel.ToModel].
+func Bank(accounts []string, initial int) porcupine.Model {
+	index := make(map[string]int, len(accounts))
+	for i, account := range accounts {
+		index[account] = i
+	}
+	describeState := func(state interface{}) string {
+		balances := state.([]int)
+		descriptions := make([]string, len(accounts))
+		for i, account := range accounts {
+			descriptions[i] = fmt.Sprintf("%s: %d", account, balances[i])
+		}
+		return fmt.Sprintf("{%s}", strings.Join(descriptions, ", "))
+	}
+	return porcupine.NondeterministicModel{
+		Init: func() []interface{} {
+			balances := make([]int, len(accounts))
+			for i := range balances {
+				balances[i] = initial
+			}
+			return []interface{}{balances}
+		},
+		Step: func(state, input, output interface{}) []interface{} {
+			inp := input.(BankInput)
+			out := bankOutput(output)
+			st := state.([]int)
+			if inp.Op == BankTransfer {
+				from, ok1 := index[inp.From]
+				to, ok2 := index[inp.To]
+				if !ok1 || !ok2 {
+					return nil
+				}
+				insufficient := st[from] < inp.Amount
+				if out.Unknown && insufficient {
+					return []interface{}{st}
+				}
+				if !out.Unknown && out.Failed != insufficient {
+					return nil
+				}
+				if out.Failed {
+					return []interface{}{st}
+				}
+				next := make([]int, len(st))
+				copy(next, st)
+				next[from] -= inp.Amount
+				next[to] += inp.Amount
+				if out.Unknown {
+					return []interface{}{st, next}
+				}
+				return []interface{}{next}
+			}
+			if out.Unknown {
+				return []interface{}{st}
+			}
+			if len(out.Balances) != len(accounts) {
+				return nil
+			}
+			for account, balance := range out.Balances {
+				if i, ok := index[account]; !ok || st[i] != balance {
+					return nil
+				}
+			}
+			return []interface{}{st}
+		},
+		Equal: func(state1, state2 interface{}) bool {
+			return equalInts(state1.([]int), state2.([]int))
+		},
+		DescribeOperation: func(input, output interface{}) string {
+			inp := input.(BankInput)
+			out := bankOutput(output)
+			if inp.Op == BankTransfer {
+				desc := fmt.Sprintf("transfer(%s, %s, %d)", inp.From, inp.To, inp.Amount)
+				switch {
+				case out.Unknown:
+					return desc + " -> unknown"
+				case out.Failed:
+					return desc + " -> failed"
+				}
+				return desc
+			}
+			if out.Unknown {
+				return "read() -> ?"
+			}
+			var descriptions []string
+			for _, account := range accounts {
+				if balance, ok := out.Balances[account]; ok {
+					descriptions = append(descriptions, fmt.Sprintf("%s: %d", account, balance))
+				}
+			}
+			var others []string
+			for account := range out.Balances {
+				if _, ok := index[account]; !ok {
+					others = append(others, account)
+				}
+			}
+			sort.Strings(others)
+			for _, account := range others {
+				descriptions = append(descriptions, fmt.Sprintf("%s: %d", account, out.Balances[account]))
+			}
+			return fmt.Sprintf("read() -> {%s}", strings.Join(descriptions, ", "))
+		},
+		DescribeState:  describeState,
+		DescribeStates: describeStates(describeState),
+	}.ToModel()
+}
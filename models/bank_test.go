@@ -0,0 +1,111 @@
+package models
+
+import (
+	"testing"
+
+	"github.com/anishathalye/porcupine"
+)
+
+func transfer(from, to string, amount int) BankInput {
+	return BankInput{Op: BankTransfer, From: from, To: to, Amount: amount}
+}
+
+var readBank = BankInput{Op: BankRead}
+
+func balances(a, b int) BankOutput {
+	return BankOutput{Balances: map[string]int{"a": a, "b": b}}
+}
+
+var accounts = []string{"a", "b"}
+
+func TestBank(t *testing.T) {
+	ops := []porcupine.Operation{
+		op(0, transfer("a", "b", 3), 0, BankOutput{}, 10),
+		op(1, readBank, 5, balances(10, 10), 15),
+		op(1, readBank, 20, balances(7, 13), 30),
+		op(0, transfer("a", "b", 8), 40, BankOutput{Failed: true}, 50),
+		op(0, transfer("b", "a", 13), 60, BankOutput{}, 70),
+		op(1, readBank, 80, balances(20, 0), 90),
+	}
+	if !porcupine.CheckOperations(Bank(accounts, 10), ops) {
+		t.Fatal("expected operations to be linearizable")
+	}
+
+	// a transfer fails exactly when there are insufficient funds
+	ops[3].Output = BankOutput{}
+	if porcupine.CheckOperations(Bank(accounts, 10), ops) {
+		t.Fatal("expected operations not to be linearizable")
+	}
+	ops[3].Output = BankOutput{Failed: true}
+	ops[4].Output = BankOutput{Failed: true}
+	if porcupine.CheckOperations(Bank(accounts, 10), ops) {
+		t.Fatal("expected operations not to be linearizable")
+	}
+}
+
+func TestBankLostTransfer(t *testing.T) {
+	// a transfer that completed, but that a later read doesn't see
+	ops := []porcupine.Operation{
+		op(0, transfer("a", "b", 3), 0, BankOutput{}, 10),
+		op(1, readBank, 20, balances(10, 10), 30),
+	}
+	if porcupine.CheckOperations(Bank(accounts, 10), ops) {
+		t.Fatal("expected operations not to be linearizable")
+	}
+
+	// unless its outcome is unknown
+	ops[0].Output = BankOutput{Unknown: true}
+	if !porcupine.CheckOperations(Bank(accounts, 10), ops) {
+		t.Fatal("expected operations to be linearizable")
+	}
+}
+
+func TestBankFracturedRead(t *testing.T) {
+	// a read concurrent with a transfer sees the debit but not the credit,
+	// so the total isn't conserved
+	ops := []porcupine.Operation{
+		op(0, transfer("a", "b", 3), 0, BankOutput{}, 30),
+		op(1, readBank, 10, balances(7, 10), 20),
+	}
+	if porcupine.CheckOperations(Bank(accounts, 10), ops) {
+		t.Fatal("expected operations not to be linearizable")
+	}
+
+	// even if the transfer never returned
+	ops[0].Output = nil
+	if porcupine.CheckOperations(Bank(accounts, 10), ops) {
+		t.Fatal("expected operations not to be linearizable")
+	}
+
+	// reads must include every account
+	ops = []porcupine.Operation{
+		op(1, readBank, 0, BankOutput{Balances: map[string]int{"a": 10}}, 10),
+	}
+	if porcupine.CheckOperations(Bank(accounts, 10), ops) {
+		t.Fatal("expected operations not to be linearizable")
+	}
+}
+
+func TestBankDescribe(t *testing.T) {
+	model := Bank(accounts, 10)
+	descriptions := []struct {
+		input  BankInput
+		output interface{}
+		desc   string
+	}{
+		{transfer("a", "b", 3), BankOutput{}, "transfer(a, b, 3)"},
+		{transfer("a", "b", 3), BankOutput{Failed: true}, "transfer(a, b, 3) -> failed"},
+		{transfer("a", "b", 3), nil, "transfer(a, b, 3) -> unknown"},
+		{readBank, balances(7, 13), "read() -> {a: 7, b: 13}"},
+		{readBank, BankOutput{Balances: map[string]int{"c": 1, "a": 7}}, "read() -> {a: 7, c: 1}"},
+		{readBank, BankOutput{Unknown: true}, "read() -> ?"},
+	}
+	for _, d := range descriptions {
+		if desc := model.DescribeOperation(d.input, d.output); desc != d.desc {
+			t.Errorf("expected %q, got %q", d.desc, desc)
+		}
+	}
+	if desc := model.DescribeState(model.Init()); desc != "{a: 10, b: 10}" {
+		t.Errorf("unexpected initial state %q", desc)
+	}
+}
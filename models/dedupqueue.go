@@ -0,0 +1,258 @@
+package models
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/anishathalye/porcupine"
+)
+
+// A DedupQueueOp is the kind of an operation of the [DedupQueue] and
+// [AtLeastOnceQueue] models.
+type DedupQueueOp int
+
+const (
+	DedupEnqueue DedupQueueOp = iota
+	DedupDequeue
+	DedupAck
+)
+
+// DedupQueueInput is the input of an operation of the [DedupQueue] and
+// [AtLeastOnceQueue] models.
+type DedupQueueInput struct {
+	Op    DedupQueueOp
+	Key   string // for enqueues, the idempotency key of the message, and for acks, the key to acknowledge
+	Value string // for enqueues
+}
+
+// DedupQueueOutput is the output of an operation of the [DedupQueue] and
+// [AtLeastOnceQueue] models.
+type DedupQueueOutput struct {
+	Key   string // for dequeues that aren't empty
+	Value string // for dequeues that aren't empty
+	Empty bool   // for dequeues that found no message to deliver
+	// Unknown is set if the outcome of the operation is unknown: an
+	// enqueue, dequeue, or ack that timed out may or may not have taken
+	// effect.
+	Unknown bool
+}
+
+// dedupQueueOutput returns the output of an operation, with a nil output,
+// from an operation that never returned, treated as an unknown outcome.
+func dedupQueueOutput(output interface{}) DedupQueueOutput {
+	if output == nil {
+		return DedupQueueOutput{Unknown: true}
+	}
+	return output.(DedupQueueOutput)
+}
+
+type dedupMessage struct {
+	Key   string
+	Value string
+	Acked bool
+}
+
+// A dedupQueueState is the messages waiting to be delivered, in order, and
+// those that were delivered, sorted by key. States are never modified, so
+// that they can share their lists.
+type dedupQueueState struct {
+	pending   []dedupMessage
+	delivered []dedupMessage
+}
+
+func (s dedupQueueState) findDelivered(key string) (int, bool) {
+	i := sort.Search(len(s.delivered), func(i int) bool { return s.delivered[i].Key >= key })
+	return i, i < len(s.delivered) && s.delivered[i].Key == key
+}
+
+// enqueued returns whether a message with the given key was ever enqueued.
+func (s dedupQueueState) enqueued(key string) bool {
+	if _, ok := s.findDelivered(key); ok {
+		return true
+	}
+	for _, m := range s.pending {
+		if m.Key == key {
+			return true
+		}
+	}
+	return false
+}
+
+// deliver returns the state after the message at the head of the queue is
+// delivered.
+func (s dedupQueueState) deliver() dedupQueueState {
+	i, _ := s.findDelivered(s.pending[0].Key)
+	delivered := make([]dedupMessage, 0, len(s.delivered)+1)
+	delivered = append(delivered, s.delivered[:i]...)
+	delivered = append(delivered, s.pending[0])
+	delivered = append(delivered, s.delivered[i:]...)
+	return dedupQueueState{pending: s.pending[1:], delivered: delivered}
+}
+
+func equalDedupMessages(messages1, messages2 []dedupMessage) bool {
+	if len(messages1) != len(messages2) {
+		return false
+	}
+	for i := range messages1 {
+		if messages1[i] != messages2[i] {
+			return false
+		}
+	}
+	return true
+}
+
+func describeDedupKeys(messages []dedupMessage) string {
+	keys := make([]string, len(messages))
+	for i, m := range messages {
+		keys[i] = fmt.Sprintf("'%s'", m.Key)
+	}
+	return fmt.Sprintf("[%s]", strings.Join(keys, ", "))
+}
+
+// newDedupQueue returns a model of a queue with idempotent enqueues, which
+// may redeliver messages that weren't acknowledged if atLeastOnce is set.
+func newDedupQueue(atLeastOnce bool) porcupine.Model {
+	describeState := func(state interface{}) string {
+		st := state.(dedupQueueState)
+		if !atLeastOnce {
+			return fmt.Sprintf("pending %s, delivered %s", describeDedupKeys(st.pending), describeDedupKeys(st.delivered))
+		}
+		var unacked, acked []dedupMessage
+		for _, m := range st.delivered {
+			if m.Acked {
+				acked = append(acked, m)
+			} else {
+				unacked = append(unacked, m)
+			}
+		}
+		return fmt.Sprintf("pending %s, unacked %s, acked %s", describeDedupKeys(st.pending), describeDedupKeys(unacked), describeDedupKeys(acked))
+	}
+	return porcupine.NondeterministicModel{
+		Init: func() []interface{} {
+			return []interface{}{dedupQueueState{}}
+		},
+		Step: func(state, input, output interface{}) []interface{} {
+			inp := input.(DedupQueueInput)
+			out := dedupQueueOutput(output)
+			st := state.(dedupQueueState)
+			switch inp.Op {
+			case DedupEnqueue:
+				if st.enqueued(inp.Key) {
+					// a duplicate has no effect
+					return []interface{}{st}
+				}
+				pending := make([]dedupMessage, len(st.pending)+1)
+				copy(pending, st.pending)
+				pending[len(st.pending)] = dedupMessage{Key: inp.Key, Value: inp.Value}
+				next := dedupQueueState{pending: pending, delivered: st.delivered}
+				if out.Unknown {
+					return []interface{}{st, next}
+				}
+				return []interface{}{next}
+			case DedupDequeue:
+				if out.Unknown {
+					if len(st.pending) == 0 {
+						return []interface{}{st}
+					}
+					return []interface{}{st, st.deliver()}
+				}
+				if out.Empty {
+					if len(st.pending) == 0 {
+						return []interface{}{st}
+					}
+					return nil
+				}
+				if len(st.pending) > 0 && out.Key == st.pending[0].Key {
+					if out.Value != st.pending[0].Value {
+						return nil
+					}
+					return []interface{}{st.deliver()}
+				}
+				if i, ok := st.findDelivered(out.Key); atLeastOnce && ok && !st.delivered[i].Acked && out.Value == st.delivered[i].Value {
+					// a redelivery
+					return []interface{}{st}
+				}
+				return nil
+			case DedupAck:
+				i, ok := st.findDelivered(inp.Key)
+				if !atLeastOnce || !ok || st.delivered[i].Acked {
+					return []interface{}{st}
+				}
+				delivered := make([]dedupMessage, len(st.delivered))
+				copy(delivered, st.delivered)
+				delivered[i].Acked = true
+				next := dedupQueueState{pending: st.pending, delivered: delivered}
+				if out.Unknown {
+					return []interface{}{st, next}
+				}
+				return []interface{}{next}
+			}
+			return nil
+		},
+		Equal: func(state1, state2 interface{}) bool {
+			st1 := state1.(dedupQueueState)
+			st2 := state2.(dedupQueueState)
+			return equalDedupMessages(st1.pending, st2.pending) && equalDedupMessages(st1.delivered, st2.delivered)
+		},
+		DescribeOperation: func(input, output interface{}) string {
+			inp := input.(DedupQueueInput)
+			out := dedupQueueOutput(output)
+			var desc string
+			switch inp.Op {
+			case DedupEnqueue:
+				desc = fmt.Sprintf("enqueue('%s', '%s')", inp.Key, inp.Value)
+			case DedupAck:
+				desc = fmt.Sprintf("ack('%s')", inp.Key)
+			case DedupDequeue:
+				switch {
+				case out.Unknown:
+					return "dequeue() -> ?"
+				case out.Empty:
+					return "dequeue() -> empty"
+				}
+				return fmt.Sprintf("dequeue() -> '%s': '%s'", out.Key, out.Value)
+			default:
+				return "<invalid>"
+			}
+			if out.Unknown {
+				desc += " -> unknown"
+			}
+			return desc
+		},
+		DescribeState:  describeState,
+		DescribeStates: describeStates(describeState),
+	}.ToModel()
+}
+
+// DedupQueue returns a model of a FIFO queue with exactly-once delivery,
+// keyed by an idempotency key that producers supply with every message. The
+// inputs of its operations are [DedupQueueInput] values, and the outputs are
+// [DedupQueueOutput] values.
+//
+// An enqueue of a key that was enqueued before, whether or not its message
+// was delivered, has no effect, so producers can retry enqueues safely. A
+// dequeue delivers the message at the head of the queue, and fails with
+// Empty exactly when there is none; a key must never be delivered twice, and
+// a dequeue must never deliver a key that wasn't enqueued. Acks have no
+// effect. An enqueue with an unknown outcome may or may not have added its
+// message, and a dequeue with an unknown outcome may or may not have
+// consumed the message at the head.
+//
+// Unknown outcomes make the model nondeterministic, so its states are sets of
+// possible queues, as for models converted with
+// [porcupine.NondeterministicModel.ToModel].
+func DedupQueue() porcupine.Model {
+	return newDedupQueue(false)
+}
+
+// AtLeastOnceQueue returns a model of a queue like [DedupQueue], except that
+// delivery is at least once: a message that was delivered but not yet
+// acknowledged by an ack of its key may be delivered again, by any dequeue,
+// as if its consumer had crashed. Once acknowledged, a message must never be
+// delivered again. Messages that may be redelivered don't make a dequeue
+// succeed: it fails with Empty exactly when no message is waiting for its
+// first delivery.
+func AtLeastOnceQueue() porcupine.Model {
+	return newDedupQueue(true)
+}
@@ -0,0 +1,170 @@
+package models
+
+import (
+	"testing"
+
+	"github.com/anishathalye/porcupine"
+)
+
+func produce(key, value string) DedupQueueInput {
+	return DedupQueueInput{Op: DedupEnqueue, Key: key, Value: value}
+}
+
+var consume = DedupQueueInput{Op: DedupDequeue}
+
+func ack(key string) DedupQueueInput {
+	return DedupQueueInput{Op: DedupAck, Key: key}
+}
+
+func delivered(key, value string) DedupQueueOutput {
+	return DedupQueueOutput{Key: key, Value: value}
+}
+
+func TestDedupQueue(t *testing.T) {
+	// a producer retries an enqueue, which has no effect the second time
+	ops := []porcupine.Operation{
+		op(0, produce("a", "1"), 0, DedupQueueOutput{}, 10),
+		op(0, produce("b", "2"), 20, DedupQueueOutput{}, 30),
+		op(0, produce("a", "1"), 40, DedupQueueOutput{}, 50),
+		op(1, consume, 60, delivered("a", "1"), 70),
+		op(1, consume, 80, delivered("b", "2"), 90),
+		op(0, produce("a", "1"), 100, DedupQueueOutput{}, 110),
+		op(1, consume, 120, DedupQueueOutput{Empty: true}, 130),
+	}
+	if !porcupine.CheckOperations(DedupQueue(), ops) {
+		t.Fatal("expected operations to be linearizable")
+	}
+
+	// a key that was never enqueued can't be delivered
+	ops[6].Output = delivered("c", "3")
+	if porcupine.CheckOperations(DedupQueue(), ops) {
+		t.Fatal("expected operations not to be linearizable")
+	}
+
+	// and a message is delivered with the value it was first enqueued with
+	ops[2].Input = produce("a", "3")
+	ops[6].Output = DedupQueueOutput{Empty: true}
+	if !porcupine.CheckOperations(DedupQueue(), ops) {
+		t.Fatal("expected operations to be linearizable")
+	}
+	ops[3].Output = delivered("a", "3")
+	if porcupine.CheckOperations(DedupQueue(), ops) {
+		t.Fatal("expected operations not to be linearizable")
+	}
+}
+
+func TestDedupQueueDoubleDelivery(t *testing.T) {
+	ops := []porcupine.Operation{
+		op(0, produce("a", "1"), 0, DedupQueueOutput{}, 10),
+		op(1, consume, 20, delivered("a", "1"), 30),
+		op(2, consume, 25, delivered("a", "1"), 35),
+	}
+	if porcupine.CheckOperations(DedupQueue(), ops) {
+		t.Fatal("expected operations not to be linearizable")
+	}
+
+	// even with a retried enqueue in between
+	ops = append(ops, op(0, produce("a", "1"), 21, DedupQueueOutput{}, 24))
+	if porcupine.CheckOperations(DedupQueue(), ops) {
+		t.Fatal("expected operations not to be linearizable")
+	}
+
+	// but it may be redelivered if delivery is at least once
+	if !porcupine.CheckOperations(AtLeastOnceQueue(), ops) {
+		t.Fatal("expected operations to be linearizable")
+	}
+}
+
+func TestAtLeastOnceQueue(t *testing.T) {
+	// a message that wasn't acknowledged is redelivered
+	ops := []porcupine.Operation{
+		op(0, produce("a", "1"), 0, DedupQueueOutput{}, 10),
+		op(0, produce("b", "2"), 20, DedupQueueOutput{}, 30),
+		op(1, consume, 40, delivered("a", "1"), 50),
+		op(2, consume, 60, delivered("b", "2"), 70),
+		op(2, ack("b"), 80, DedupQueueOutput{}, 90),
+		op(2, consume, 100, delivered("a", "1"), 110),
+		op(2, ack("a"), 120, DedupQueueOutput{}, 130),
+		op(2, consume, 140, DedupQueueOutput{Empty: true}, 150),
+	}
+	if !porcupine.CheckOperations(AtLeastOnceQueue(), ops) {
+		t.Fatal("expected operations to be linearizable")
+	}
+	if porcupine.CheckOperations(DedupQueue(), ops) {
+		t.Fatal("expected operations not to be exactly once")
+	}
+
+	// but not after it was acknowledged
+	ops[7].Output = delivered("b", "2")
+	if porcupine.CheckOperations(AtLeastOnceQueue(), ops) {
+		t.Fatal("expected operations not to be linearizable")
+	}
+
+	// unless the ack's outcome is unknown
+	ops[4].Output = nil
+	if !porcupine.CheckOperations(AtLeastOnceQueue(), ops) {
+		t.Fatal("expected operations to be linearizable")
+	}
+}
+
+func TestDedupQueueUnknown(t *testing.T) {
+	// an enqueue that timed out may or may not have added its message
+	ops := []porcupine.Operation{
+		op(0, produce("a", "1"), 0, nil, 1000),
+		op(1, consume, 20, DedupQueueOutput{Empty: true}, 30),
+		op(1, consume, 40, delivered("a", "1"), 50),
+	}
+	if !porcupine.CheckOperations(DedupQueue(), ops) {
+		t.Fatal("expected operations to be linearizable")
+	}
+
+	// and a dequeue that timed out may have consumed the message
+	ops = append(ops, op(2, consume, 45, nil, 1000))
+	if !porcupine.CheckOperations(DedupQueue(), ops) {
+		t.Fatal("expected operations to be linearizable")
+	}
+	ops = append(ops, op(1, consume, 60, DedupQueueOutput{Empty: true}, 70))
+	if !porcupine.CheckOperations(DedupQueue(), ops) {
+		t.Fatal("expected operations to be linearizable")
+	}
+
+	// but it can't deliver it again
+	ops[4].Output = delivered("a", "1")
+	if porcupine.CheckOperations(DedupQueue(), ops) {
+		t.Fatal("expected operations not to be linearizable")
+	}
+}
+
+func TestDedupQueueDescribe(t *testing.T) {
+	model := DedupQueue()
+	descriptions := []struct {
+		input  DedupQueueInput
+		output interface{}
+		desc   string
+	}{
+		{produce("a", "1"), DedupQueueOutput{}, "enqueue('a', '1')"},
+		{produce("a", "1"), nil, "enqueue('a', '1') -> unknown"},
+		{consume, delivered("a", "1"), "dequeue() -> 'a': '1'"},
+		{consume, DedupQueueOutput{Empty: true}, "dequeue() -> empty"},
+		{consume, nil, "dequeue() -> ?"},
+		{ack("a"), DedupQueueOutput{}, "ack('a')"},
+	}
+	for _, d := range descriptions {
+		if desc := model.DescribeOperation(d.input, d.output); desc != d.desc {
+			t.Errorf("expected %q, got %q", d.desc, desc)
+		}
+	}
+	_, state := model.Step(model.Init(), produce("a", "1"), DedupQueueOutput{})
+	_, state = model.Step(state, produce("b", "2"), DedupQueueOutput{})
+	_, state = model.Step(state, consume, delivered("a", "1"))
+	if desc := model.DescribeState(state); desc != "pending ['b'], delivered ['a']" {
+		t.Errorf("unexpected state %q", desc)
+	}
+	model = AtLeastOnceQueue()
+	_, state = model.Step(model.Init(), produce("a", "1"), DedupQueueOutput{})
+	_, state = model.Step(state, consume, delivered("a", "1"))
+	_, state = model.Step(state, ack("a"), nil)
+	if desc := model.DescribeState(state); desc != "one of {pending [], unacked ['a'], acked [], pending [], unacked [], acked ['a']}" {
+		t.Errorf("unexpected state %q", desc)
+	}
+}
@@ -0,0 +1,162 @@
+package models
+
+import (
+	"fmt"
+
+	"github.com/anishathalye/porcupine"
+)
+
+// IDInput is the input of a request for an ID, the only operation of the
+// [IDGenerator] model.
+type IDInput struct{}
+
+// IDOutput is the output of an operation of the [IDGenerator] model.
+type IDOutput struct {
+	ID int64
+	// Unknown is set if the outcome of the request is unknown, because it
+	// timed out: it may or may not have been assigned an ID.
+	Unknown bool
+}
+
+// idOutput returns the output of an operation, with a nil output, from an
+// operation that never returned, treated as an unknown outcome.
+func idOutput(output interface{}) IDOutput {
+	if output == nil {
+		return IDOutput{Unknown: true}
+	}
+	return output.(IDOutput)
+}
+
+// An idSet is an immutable set of IDs, as a linked list that shares its tail
+// with the set it was created from, so that adding an ID doesn't copy the set.
+// It keeps the number of IDs and a hash of them, so that sets can be compared
+// quickly.
+type idSet struct {
+	id    int64
+	next  *idSet
+	count int
+	hash  uint64
+}
+
+// mix is the finalizer of SplitMix64, which spreads the bits of an ID so that
+// the sum of the mixed IDs of a set is a good hash of the set.
+func mix(id int64) uint64 {
+	x := uint64(id)
+	x ^= x >> 30
+	x *= 0xbf58476d1ce4e5b9
+	x ^= x >> 27
+	x *= 0x94d049bb133111eb
+	x ^= x >> 31
+	return x
+}
+
+func (s *idSet) contains(id int64) bool {
+	for ; s != nil; s = s.next {
+		if s.id == id {
+			return true
+		}
+	}
+	return false
+}
+
+func (s *idSet) add(id int64) *idSet {
+	next := &idSet{id: id, next: s, count: 1, hash: mix(id)}
+	if s != nil {
+		next.count += s.count
+		next.hash += s.hash
+	}
+	return next
+}
+
+func (s *idSet) size() int {
+	if s == nil {
+		return 0
+	}
+	return s.count
+}
+
+func (s *idSet) equal(other *idSet) bool {
+	if s == other {
+		return true
+	}
+	if s.size() != other.size() || s.hash != other.hash {
+		return false
+	}
+	ids := make(map[int64]bool, s.count)
+	for ; s != nil; s = s.next {
+		ids[s.id] = true
+	}
+	for ; other != nil; other = other.next {
+		if !ids[other.id] {
+			return false
+		}
+	}
+	return true
+}
+
+// An idState is the state of the [IDGenerator] model: the IDs issued so far,
+// for a generator that need not be monotonic, or the last one, for one that
+// must, since then a new ID can't have been issued before.
+type idState struct {
+	issued *idSet
+	last   int64
+	any    bool // whether any ID was issued, so that last is set
+}
+
+// IDGenerator returns a model of a service that issues unique IDs. The inputs
+// of its operations are [IDInput] values, and the outputs are [IDOutput]
+// values. Every ID must be different from those issued before it, and if
+// monotonic is set, greater than them, in the order in which the requests
+// take effect.
+//
+// A request with an unknown outcome may have consumed an ID, but since the ID
+// isn't known, it doesn't constrain the IDs issued to other requests. The
+// model is deterministic, and its states are the issued IDs, shared between
+// states, so that adding one takes constant time; if monotonic is set, the
+// state is just the last ID.
+func IDGenerator(monotonic bool) porcupine.Model {
+	return porcupine.Model{
+		Init: func() interface{} {
+			return idState{}
+		},
+		Step: func(state, input, output interface{}) (bool, interface{}) {
+			out := idOutput(output)
+			st := state.(idState)
+			if out.Unknown {
+				return true, st
+			}
+			if monotonic {
+				if st.any && out.ID <= st.last {
+					return false, st
+				}
+				return true, idState{last: out.ID, any: true}
+			}
+			if st.issued.contains(out.ID) {
+				return false, st
+			}
+			return true, idState{issued: st.issued.add(out.ID)}
+		},
+		Equal: func(state1, state2 interface{}) bool {
+			st1 := state1.(idState)
+			st2 := state2.(idState)
+			return st1.last == st2.last && st1.any == st2.any && st1.issued.equal(st2.issued)
+		},
+		DescribeOperation: func(input, output interface{}) string {
+			out := idOutput(output)
+			if out.Unknown {
+				return "next() -> ?"
+			}
+			return fmt.Sprintf("next() -> %d", out.ID)
+		},
+		DescribeState: func(state interface{}) string {
+			st := state.(idState)
+			if monotonic {
+				if !st.any {
+					return "none issued"
+				}
+				return fmt.Sprintf("last %d", st.last)
+			}
+			return fmt.Sprintf("%d issued", st.issued.size())
+		},
+	}
+}
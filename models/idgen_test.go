@@ -0,0 +1,97 @@
+package models
+
+import (
+	"testing"
+
+	"github.com/anishathalye/porcupine"
+)
+
+func id(id int64) IDOutput {
+	return IDOutput{ID: id}
+}
+
+func TestIDGenerator(t *testing.T) {
+	ops := []porcupine.Operation{
+		op(0, IDInput{}, 0, id(2), 10),
+		op(1, IDInput{}, 5, id(1), 15),
+		op(0, IDInput{}, 20, id(3), 30),
+		op(1, IDInput{}, 20, IDOutput{Unknown: true}, 30),
+		op(1, IDInput{}, 40, id(4), 50),
+	}
+	for _, monotonic := range []bool{false, true} {
+		if !porcupine.CheckOperations(IDGenerator(monotonic), ops) {
+			t.Fatalf("expected operations to be linearizable with monotonic %t", monotonic)
+		}
+	}
+}
+
+func TestIDGeneratorDuplicate(t *testing.T) {
+	ops := []porcupine.Operation{
+		op(0, IDInput{}, 0, id(1), 10),
+		op(1, IDInput{}, 20, id(2), 30),
+		op(2, IDInput{}, 40, id(1), 50),
+	}
+	for _, monotonic := range []bool{false, true} {
+		if porcupine.CheckOperations(IDGenerator(monotonic), ops) {
+			t.Fatalf("expected operations not to be linearizable with monotonic %t", monotonic)
+		}
+	}
+}
+
+func TestIDGeneratorNonMonotonic(t *testing.T) {
+	// a smaller ID after a larger one
+	ops := []porcupine.Operation{
+		op(0, IDInput{}, 0, id(5), 10),
+		op(1, IDInput{}, 20, id(3), 30),
+	}
+	if !porcupine.CheckOperations(IDGenerator(false), ops) {
+		t.Fatal("expected operations to be linearizable")
+	}
+	if porcupine.CheckOperations(IDGenerator(true), ops) {
+		t.Fatal("expected operations not to be monotonic")
+	}
+
+	// which is fine if they're concurrent
+	ops[1].Call = 5
+	if !porcupine.CheckOperations(IDGenerator(true), ops) {
+		t.Fatal("expected operations to be monotonic")
+	}
+}
+
+func TestIDGeneratorLongHistory(t *testing.T) {
+	// IDs handed out in batches to clients, so they are unique but not
+	// monotonic across clients
+	var ops []porcupine.Operation
+	for i := 0; i < 300; i++ {
+		for c := 0; c < 3; c++ {
+			call := int64(10 * (3*i + c))
+			ops = append(ops, op(c, IDInput{}, call, id(int64(c*1000+i)), call+15))
+		}
+	}
+	if !porcupine.CheckOperations(IDGenerator(false), ops) {
+		t.Fatal("expected operations to be linearizable")
+	}
+	ops[len(ops)-1].Output = id(0)
+	if porcupine.CheckOperations(IDGenerator(false), ops) {
+		t.Fatal("expected operations not to be linearizable")
+	}
+}
+
+func TestIDGeneratorDescribe(t *testing.T) {
+	model := IDGenerator(false)
+	if desc := model.DescribeOperation(IDInput{}, id(3)); desc != "next() -> 3" {
+		t.Errorf("unexpected description %q", desc)
+	}
+	if desc := model.DescribeOperation(IDInput{}, nil); desc != "next() -> ?" {
+		t.Errorf("unexpected description %q", desc)
+	}
+	_, state := model.Step(model.Init(), IDInput{}, id(3))
+	if desc := model.DescribeState(state); desc != "1 issued" {
+		t.Errorf("unexpected state %q", desc)
+	}
+	model = IDGenerator(true)
+	_, state = model.Step(model.Init(), IDInput{}, id(3))
+	if desc := model.DescribeState(state); desc != "last 3" {
+		t.Errorf("unexpected state %q", desc)
+	}
+}
@@ -0,0 +1,67 @@
+package models
+
+import (
+	"sync"
+
+	"github.com/anishathalye/porcupine"
+)
+
+// WithInvariant returns the model m, with a Step function that also rejects
+// an operation if the state it leads to violates an invariant: inv returns an
+// error describing the violation for a state that violates it, and nil
+// otherwise. This enforces global properties, such as a value that is never
+// negative, at every state the checker reaches, on top of the legality of
+// each operation.
+//
+// Since a state that violates the invariant is never reached, a history is
+// linearizable with the returned model if and only if it has a linearization
+// in which no state violates the invariant, which is stronger than being
+// linearizable with m. The checker still tries other orders of concurrent
+// operations, so an operation that violates the invariant in one order
+// doesn't make the history illegal if there's an order in which it doesn't.
+//
+// The message of the first violation found for an operation is appended to
+// its description, such as "decrement() [invariant: value is -1]", so that
+// it shows up in visualizations and in reports that describe operations. The
+// invariant is applied to the states of m: for a model converted from a
+// [porcupine.NondeterministicModel], whose states are sets of candidate
+// states, apply the invariant in the Step function of the nondeterministic
+// model instead.
+func WithInvariant(m porcupine.Model, inv func(state interface{}) error) porcupine.Model {
+	describe := m.DescribeOperation
+	if describe == nil {
+		describe = func(input, output interface{}) string {
+			return porcupine.DescribeValue(input, porcupine.DescribeOptions{}) + " -> " + porcupine.DescribeValue(output, porcupine.DescribeOptions{})
+		}
+	}
+	var mu sync.Mutex
+	violations := make(map[string]string) // from the description of an operation to its first violation
+	step := m.Step
+	m.Step = func(state, input, output interface{}) (bool, interface{}) {
+		ok, next := step(state, input, output)
+		if !ok {
+			return false, next
+		}
+		if err := inv(next); err != nil {
+			desc := describe(input, output)
+			mu.Lock()
+			if _, found := violations[desc]; !found {
+				violations[desc] = err.Error()
+			}
+			mu.Unlock()
+			return false, state
+		}
+		return true, next
+	}
+	m.DescribeOperation = func(input, output interface{}) string {
+		desc := describe(input, output)
+		mu.Lock()
+		violation, found := violations[desc]
+		mu.Unlock()
+		if found {
+			return desc + " [invariant: " + violation + "]"
+		}
+		return desc
+	}
+	return m
+}
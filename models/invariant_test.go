@@ -0,0 +1,79 @@
+package models
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/anishathalye/porcupine"
+)
+
+type counterInput struct {
+	delta int // 0 for reads
+}
+
+// counter is a counter that can be incremented, decremented, and read.
+var counter = porcupine.Model{
+	Init: func() interface{} { return 0 },
+	Step: func(state, input, output interface{}) (bool, interface{}) {
+		inp := input.(counterInput)
+		if inp.delta == 0 {
+			return output == state, state
+		}
+		return true, state.(int) + inp.delta
+	},
+	DescribeOperation: func(input, output interface{}) string {
+		switch delta := input.(counterInput).delta; {
+		case delta > 0:
+			return "increment()"
+		case delta < 0:
+			return "decrement()"
+		}
+		return fmt.Sprintf("read() -> %v", output)
+	},
+}
+
+func nonNegative(state interface{}) error {
+	if v := state.(int); v < 0 {
+		return fmt.Errorf("value is %d", v)
+	}
+	return nil
+}
+
+func TestWithInvariant(t *testing.T) {
+	model := WithInvariant(counter, nonNegative)
+
+	// the decrement can take effect after the concurrent increment
+	ops := []porcupine.Operation{
+		op(0, counterInput{-1}, 0, nil, 10),
+		op(1, counterInput{1}, 5, nil, 15),
+		op(2, counterInput{0}, 20, 0, 30),
+	}
+	if !porcupine.CheckOperations(model, ops) {
+		t.Fatal("expected operations to be linearizable")
+	}
+
+	// but not before it
+	ops[1].Call, ops[1].Return = 12, 15
+	if !porcupine.CheckOperations(counter, ops) {
+		t.Fatal("expected operations to be linearizable without the invariant")
+	}
+	res, info := porcupine.CheckOperationsVerbose(model, ops, 0)
+	if res != porcupine.Illegal {
+		t.Fatalf("expected output %v, got output %v", porcupine.Illegal, res)
+	}
+	if desc := model.DescribeOperation(counterInput{-1}, nil); desc != "decrement() [invariant: value is -1]" {
+		t.Fatalf("unexpected description %q", desc)
+	}
+	if desc := model.DescribeOperation(counterInput{1}, nil); desc != "increment()" {
+		t.Fatalf("unexpected description %q", desc)
+	}
+	var buf bytes.Buffer
+	if err := porcupine.Visualize(model, info, &buf); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(buf.String(), "[invariant: value is -1]") {
+		t.Fatal("expected the violation in the visualization")
+	}
+}
@@ -0,0 +1,164 @@
+package models
+
+import (
+	"fmt"
+
+	"github.com/anishathalye/porcupine"
+)
+
+// A KVOp is the kind of an operation on a key-value store.
+type KVOp int
+
+const (
+	KVGet KVOp = iota
+	KVPut
+	KVAppend
+	KVDelete
+)
+
+// KVInput is the input of an operation of the [KV] and [StrictKV] models.
+type KVInput struct {
+	Op    KVOp
+	Key   string
+	Value string // for puts and appends
+}
+
+// KVOutput is the output of an operation of the [KV] and [StrictKV] models.
+type KVOutput struct {
+	Value string // for gets
+	// Found is set for gets that found the key, for the [StrictKV] model,
+	// which distinguishes keys that don't exist from keys whose value is
+	// the empty string.
+	Found bool
+	// Unknown is set if the outcome of the operation is unknown: a put,
+	// append, or delete that timed out may or may not have taken effect,
+	// and a get may have returned any value.
+	Unknown bool
+}
+
+// kvOutput returns the output of an operation, with a nil output, from an
+// operation that never returned, treated as an unknown outcome.
+func kvOutput(output interface{}) KVOutput {
+	if output == nil {
+		return KVOutput{Unknown: true}
+	}
+	return output.(KVOutput)
+}
+
+// A kvState is the value of a single key, since histories are partitioned by
+// key, and whether the key exists.
+type kvState struct {
+	Value  string
+	Exists bool
+}
+
+// newKV returns a model of a key-value store, where gets observe whether a key
+// exists if strict is set.
+func newKV(strict bool) porcupine.Model {
+	describeState := func(state interface{}) string {
+		st := state.(kvState)
+		if strict && !st.Exists {
+			return "absent"
+		}
+		return fmt.Sprintf("'%s'", st.Value)
+	}
+	model := porcupine.NondeterministicModel{
+		Init: func() []interface{} {
+			return []interface{}{kvState{}}
+		},
+		Step: func(state, input, output interface{}) []interface{} {
+			inp := input.(KVInput)
+			out := kvOutput(output)
+			st := state.(kvState)
+			var next kvState
+			switch inp.Op {
+			case KVGet:
+				if out.Unknown || out.Value == st.Value && (!strict || out.Found == st.Exists) {
+					return []interface{}{st}
+				}
+				return nil
+			case KVPut:
+				next = kvState{Value: inp.Value, Exists: true}
+			case KVAppend:
+				next = kvState{Value: st.Value + inp.Value, Exists: true}
+			case KVDelete:
+				next = kvState{}
+			}
+			if out.Unknown {
+				return []interface{}{st, next}
+			}
+			return []interface{}{next}
+		},
+		Equal: func(state1, state2 interface{}) bool {
+			st1 := state1.(kvState)
+			st2 := state2.(kvState)
+			return st1.Value == st2.Value && (!strict || st1.Exists == st2.Exists)
+		},
+		DescribeOperation: func(input, output interface{}) string {
+			inp := input.(KVInput)
+			out := kvOutput(output)
+			var desc string
+			switch inp.Op {
+			case KVGet:
+				switch {
+				case out.Unknown:
+					return fmt.Sprintf("get('%s') -> ?", inp.Key)
+				case strict && !out.Found:
+					return fmt.Sprintf("get('%s') -> not found", inp.Key)
+				}
+				return fmt.Sprintf("get('%s') -> '%s'", inp.Key, out.Value)
+			case KVPut:
+				desc = fmt.Sprintf("put('%s', '%s')", inp.Key, inp.Value)
+			case KVAppend:
+				desc = fmt.Sprintf("append('%s', '%s')", inp.Key, inp.Value)
+			case KVDelete:
+				desc = fmt.Sprintf("delete('%s')", inp.Key)
+			default:
+				return "<invalid>"
+			}
+			if out.Unknown {
+				desc += " -> unknown"
+			}
+			return desc
+		},
+		DescribeState:  describeState,
+		DescribeStates: describeStates(describeState),
+	}.ToModel()
+	return PartitionByKey(model, kvKey)
+}
+
+// KV returns a model of a key-value store with string keys and values, where
+// a key that was never written, or was deleted, has the empty string as its
+// value. The inputs of its operations are [KVInput] values, and the outputs
+// are [KVOutput] values, whose Found field is ignored.
+//
+// The model partitions histories by key, which is sound because every
+// operation reads or writes a single key, so that a history is linearizable
+// if and only if the operations on each key are. Its states are the values
+// of a single key.
+//
+// Writes with an unknown outcome make the model nondeterministic, so its
+// states are sets of possible values, as for models converted with
+// [porcupine.NondeterministicModel.ToModel].
+func KV() porcupine.Model {
+	return newKV(false)
+}
+
+// StrictKV returns a model of a key-value store like [KV], except that a key
+// that was never written, or was deleted, doesn't exist, which is different
+// from having the empty string as its value: a get of the key must return an
+// output whose Found field is unset, and a get of a key that exists must set
+// it. A put or append creates the key, and a delete removes it. This is the
+// model for stores where deletion is a first-class operation, such as etcd,
+// and catches bugs that [KV] can't, such as a deleted key that comes back with
+// an empty value.
+//
+// Like [KV], the model partitions histories by key, and its states are sets of
+// possible values of a single key, including whether it exists.
+func StrictKV() porcupine.Model {
+	return newKV(true)
+}
+
+func kvKey(input interface{}) string {
+	return input.(KVInput).Key
+}
@@ -0,0 +1,283 @@
+package models
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"regexp"
+	"strconv"
+	"testing"
+
+	"github.com/anishathalye/porcupine"
+)
+
+var kvLogLine = regexp.MustCompile(`{:process (\d+), :type :(invoke|ok), :f :(get|put|append), :key "(.*)", :value (nil|"(.*)")}`)
+
+// parseKVLog reads a history of a key-value store from the logs in
+// test_data/kv, completing operations that never returned with a nil output.
+func parseKVLog(t *testing.T, name string) []porcupine.Event {
+	file, err := os.Open(fmt.Sprintf("../test_data/kv/%s.txt", name))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+	ops := map[string]KVOp{"get": KVGet, "put": KVPut, "append": KVAppend}
+	var events []porcupine.Event
+	ids := make(map[int]int) // from process to id of its pending call
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		args := kvLogLine.FindStringSubmatch(scanner.Text())
+		if args == nil {
+			continue
+		}
+		proc, _ := strconv.Atoi(args[1])
+		op := ops[args[3]]
+		if args[2] == "invoke" {
+			ids[proc] = len(events)
+			events = append(events, call(proc, KVInput{Op: op, Key: args[4], Value: args[6]}, len(events)))
+			continue
+		}
+		var out KVOutput
+		if op == KVGet {
+			out.Value = args[6]
+		}
+		events = append(events, ret(proc, out, ids[proc]))
+		delete(ids, proc)
+	}
+	if err := scanner.Err(); err != nil {
+		t.Fatal(err)
+	}
+	return porcupine.CompletePending(events, func(porcupine.Event) (interface{}, bool) {
+		return nil, true
+	})
+}
+
+func checkKVLog(t *testing.T, name string, expected bool) {
+	events := parseKVLog(t, name)
+	if res := porcupine.CheckEvents(KV(), events); res != expected {
+		t.Fatalf("expected output %t, got output %t", expected, res)
+	}
+}
+
+func TestKV1ClientOk(t *testing.T) {
+	checkKVLog(t, "c01-ok", true)
+}
+
+func TestKV1ClientBad(t *testing.T) {
+	checkKVLog(t, "c01-bad", false)
+}
+
+func TestKV10ClientsOk(t *testing.T) {
+	checkKVLog(t, "c10-ok", true)
+}
+
+func TestKV10ClientsBad(t *testing.T) {
+	checkKVLog(t, "c10-bad", false)
+}
+
+func TestKV50ClientsOk(t *testing.T) {
+	checkKVLog(t, "c50-ok", true)
+}
+
+func TestKV50ClientsBad(t *testing.T) {
+	checkKVLog(t, "c50-bad", false)
+}
+
+func TestKVDelete(t *testing.T) {
+	ops := []porcupine.Operation{
+		op(0, KVInput{Op: KVPut, Key: "x", Value: "a"}, 0, KVOutput{}, 10),
+		op(0, KVInput{Op: KVDelete, Key: "x"}, 20, KVOutput{}, 30),
+		op(1, KVInput{Op: KVGet, Key: "x"}, 40, KVOutput{Value: ""}, 50),
+		op(1, KVInput{Op: KVAppend, Key: "x", Value: "b"}, 60, KVOutput{}, 70),
+		op(0, KVInput{Op: KVGet, Key: "x"}, 80, KVOutput{Value: "b"}, 90),
+	}
+	if !porcupine.CheckOperations(KV(), ops) {
+		t.Fatal("expected operations to be linearizable")
+	}
+
+	// the deleted value can't be read afterwards
+	ops[2].Output = KVOutput{Value: "a"}
+	if porcupine.CheckOperations(KV(), ops) {
+		t.Fatal("expected operations not to be linearizable")
+	}
+}
+
+func TestKVUnknown(t *testing.T) {
+	// an append with an unknown outcome may or may not have taken effect,
+	// independently for each key
+	ops := []porcupine.Operation{
+		op(0, KVInput{Op: KVAppend, Key: "x", Value: "a"}, 0, KVOutput{Unknown: true}, 10),
+		op(0, KVInput{Op: KVAppend, Key: "y", Value: "a"}, 20, nil, 1000),
+		op(1, KVInput{Op: KVGet, Key: "x"}, 30, KVOutput{Value: "a"}, 40),
+		op(1, KVInput{Op: KVGet, Key: "y"}, 50, KVOutput{Value: ""}, 60),
+		op(1, KVInput{Op: KVAppend, Key: "x", Value: "b"}, 70, KVOutput{}, 80),
+		op(1, KVInput{Op: KVGet, Key: "x"}, 90, KVOutput{Value: "ab"}, 100),
+	}
+	if !porcupine.CheckOperations(KV(), ops) {
+		t.Fatal("expected operations to be linearizable")
+	}
+
+	// but it can't take effect after a read saw that it hadn't
+	ops[2].Output = KVOutput{Value: ""}
+	if porcupine.CheckOperations(KV(), ops) {
+		t.Fatal("expected operations not to be linearizable")
+	}
+}
+
+func TestKVPartition(t *testing.T) {
+	ops := []porcupine.Operation{
+		op(0, KVInput{Op: KVPut, Key: "y", Value: "a"}, 0, KVOutput{}, 10),
+		op(1, KVInput{Op: KVPut, Key: "x", Value: "b"}, 0, KVOutput{}, 10),
+		op(0, KVInput{Op: KVGet, Key: "y"}, 20, KVOutput{Value: "a"}, 30),
+	}
+	partitions := KV().Partition(ops)
+	if len(partitions) != 2 || len(partitions[0]) != 1 || len(partitions[1]) != 2 {
+		t.Fatalf("expected partitions for x and y, got %v", partitions)
+	}
+	events := []porcupine.Event{
+		call(0, KVInput{Op: KVPut, Key: "y", Value: "a"}, 0),
+		call(1, KVInput{Op: KVPut, Key: "x", Value: "b"}, 1),
+		ret(0, KVOutput{}, 0),
+		ret(1, KVOutput{}, 1),
+	}
+	eventPartitions := KV().PartitionEvent(events)
+	if len(eventPartitions) != 2 || eventPartitions[0][0].Id != 1 || eventPartitions[0][1].Id != 1 {
+		t.Fatalf("expected partitions for x and y, got %v", eventPartitions)
+	}
+}
+
+func TestKVDescribe(t *testing.T) {
+	model := KV()
+	descriptions := []struct {
+		input  KVInput
+		output interface{}
+		desc   string
+	}{
+		{KVInput{Op: KVGet, Key: "x"}, KVOutput{Value: "a"}, "get('x') -> 'a'"},
+		{KVInput{Op: KVGet, Key: "x"}, nil, "get('x') -> ?"},
+		{KVInput{Op: KVPut, Key: "x", Value: "a"}, KVOutput{}, "put('x', 'a')"},
+		{KVInput{Op: KVAppend, Key: "x", Value: "a"}, KVOutput{Unknown: true}, "append('x', 'a') -> unknown"},
+		{KVInput{Op: KVDelete, Key: "x"}, KVOutput{}, "delete('x')"},
+	}
+	for _, d := range descriptions {
+		if desc := model.DescribeOperation(d.input, d.output); desc != d.desc {
+			t.Errorf("expected %q, got %q", d.desc, desc)
+		}
+	}
+}
+
+func TestStrictKV(t *testing.T) {
+	ops := []porcupine.Operation{
+		op(0, KVInput{Op: KVGet, Key: "x"}, 0, KVOutput{}, 10),
+		op(0, KVInput{Op: KVPut, Key: "x", Value: ""}, 20, KVOutput{}, 30),
+		op(1, KVInput{Op: KVGet, Key: "x"}, 40, KVOutput{Value: "", Found: true}, 50),
+		op(1, KVInput{Op: KVDelete, Key: "x"}, 60, KVOutput{}, 70),
+		op(0, KVInput{Op: KVAppend, Key: "x", Value: "a"}, 80, KVOutput{}, 90),
+		op(1, KVInput{Op: KVGet, Key: "x"}, 100, KVOutput{Value: "a", Found: true}, 110),
+	}
+	if !porcupine.CheckOperations(StrictKV(), ops) {
+		t.Fatal("expected operations to be linearizable")
+	}
+
+	// a key that was never written doesn't exist
+	ops[0].Output = KVOutput{Value: "", Found: true}
+	if porcupine.CheckOperations(StrictKV(), ops) {
+		t.Fatal("expected operations not to be linearizable")
+	}
+	// which KV can't tell
+	if !porcupine.CheckOperations(KV(), ops) {
+		t.Fatal("expected operations to be linearizable")
+	}
+
+	// and a key whose value is empty does
+	ops[0].Output = KVOutput{}
+	ops[2].Output = KVOutput{}
+	if porcupine.CheckOperations(StrictKV(), ops) {
+		t.Fatal("expected operations not to be linearizable")
+	}
+}
+
+func TestStrictKVResurrection(t *testing.T) {
+	// a read sees the key after a completed delete, with no put in between
+	ops := []porcupine.Operation{
+		op(0, KVInput{Op: KVPut, Key: "x", Value: "a"}, 0, KVOutput{}, 10),
+		op(0, KVInput{Op: KVDelete, Key: "x"}, 20, KVOutput{}, 30),
+		op(1, KVInput{Op: KVGet, Key: "x"}, 40, KVOutput{}, 50),
+		op(2, KVInput{Op: KVGet, Key: "x"}, 60, KVOutput{Value: "a", Found: true}, 70),
+	}
+	if porcupine.CheckOperations(StrictKV(), ops) {
+		t.Fatal("expected operations not to be linearizable")
+	}
+
+	// even with an empty value, which KV accepts
+	ops[3].Output = KVOutput{Value: "", Found: true}
+	if porcupine.CheckOperations(StrictKV(), ops) {
+		t.Fatal("expected operations not to be linearizable")
+	}
+	if !porcupine.CheckOperations(KV(), ops) {
+		t.Fatal("expected operations to be linearizable")
+	}
+
+	// unless a put was concurrent with the read
+	ops = append(ops, op(0, KVInput{Op: KVPut, Key: "x", Value: ""}, 55, KVOutput{}, 65))
+	if !porcupine.CheckOperations(StrictKV(), ops) {
+		t.Fatal("expected operations to be linearizable")
+	}
+}
+
+func TestStrictKVUnknown(t *testing.T) {
+	// a delete with an unknown outcome may or may not have removed the key
+	ops := []porcupine.Operation{
+		op(0, KVInput{Op: KVPut, Key: "x", Value: "a"}, 0, KVOutput{}, 10),
+		op(0, KVInput{Op: KVDelete, Key: "x"}, 20, nil, 1000),
+		op(1, KVInput{Op: KVGet, Key: "x"}, 30, KVOutput{Value: "a", Found: true}, 40),
+		op(1, KVInput{Op: KVGet, Key: "x"}, 50, KVOutput{}, 60),
+	}
+	if !porcupine.CheckOperations(StrictKV(), ops) {
+		t.Fatal("expected operations to be linearizable")
+	}
+
+	// but it can't be undone
+	ops = append(ops, op(1, KVInput{Op: KVGet, Key: "x"}, 70, KVOutput{Value: "a", Found: true}, 80))
+	if porcupine.CheckOperations(StrictKV(), ops) {
+		t.Fatal("expected operations not to be linearizable")
+	}
+
+	// and a put with an unknown outcome may or may not have created the key
+	ops = []porcupine.Operation{
+		op(0, KVInput{Op: KVPut, Key: "x", Value: ""}, 0, KVOutput{Unknown: true}, 10),
+		op(1, KVInput{Op: KVGet, Key: "x"}, 20, KVOutput{}, 30),
+		op(1, KVInput{Op: KVGet, Key: "y"}, 20, KVOutput{}, 30),
+	}
+	if !porcupine.CheckOperations(StrictKV(), ops) {
+		t.Fatal("expected operations to be linearizable")
+	}
+	ops[1].Output = KVOutput{Found: true}
+	if !porcupine.CheckOperations(StrictKV(), ops) {
+		t.Fatal("expected operations to be linearizable")
+	}
+}
+
+func TestStrictKVDescribe(t *testing.T) {
+	model := StrictKV()
+	descriptions := []struct {
+		input  KVInput
+		output interface{}
+		desc   string
+	}{
+		{KVInput{Op: KVGet, Key: "x"}, KVOutput{Value: "a", Found: true}, "get('x') -> 'a'"},
+		{KVInput{Op: KVGet, Key: "x"}, KVOutput{Found: true}, "get('x') -> ''"},
+		{KVInput{Op: KVGet, Key: "x"}, KVOutput{}, "get('x') -> not found"},
+		{KVInput{Op: KVGet, Key: "x"}, nil, "get('x') -> ?"},
+		{KVInput{Op: KVDelete, Key: "x"}, KVOutput{Unknown: true}, "delete('x') -> unknown"},
+	}
+	for _, d := range descriptions {
+		if desc := model.DescribeOperation(d.input, d.output); desc != d.desc {
+			t.Errorf("expected %q, got %q", d.desc, desc)
+		}
+	}
+	_, state := model.Step(model.Init(), KVInput{Op: KVPut, Key: "x", Value: ""}, KVOutput{Unknown: true})
+	if desc := model.DescribeState(state); desc != "one of {absent, ''}" {
+		t.Errorf("unexpected state %q", desc)
+	}
+}
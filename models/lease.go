@@ -0,0 +1,148 @@
+package models
+
+import (
+	"fmt"
+	"math"
+
+	"github.com/anishathalye/porcupine"
+)
+
+// A LeaseOp is the kind of an operation of the [LeaseRegister] model.
+type LeaseOp int
+
+const (
+	LeaseGet LeaseOp = iota
+	LeasePut
+)
+
+// LeaseInput is the input of an operation of the [LeaseRegister] model.
+type LeaseInput struct {
+	Op    LeaseOp
+	Value int   // for puts
+	TTL   int64 // for puts, how long the value lives, or 0 if it doesn't expire
+	// At is the time of the operation, by the clock that TTLs are measured
+	// with, such as the time the client called it.
+	At int64
+}
+
+// LeaseOutput is the output of an operation of the [LeaseRegister] model.
+type LeaseOutput struct {
+	Value int  // for gets that found a value
+	Found bool // for gets, whether the register held an unexpired value
+	// Unknown is set if the outcome of the operation is unknown: a put
+	// that timed out may or may not have taken effect, and a get may have
+	// returned anything.
+	Unknown bool
+}
+
+// leaseOutput returns the output of an operation, with a nil output, from an
+// operation that never returned, treated as an unknown outcome.
+func leaseOutput(output interface{}) LeaseOutput {
+	if output == nil {
+		return LeaseOutput{Unknown: true}
+	}
+	return output.(LeaseOutput)
+}
+
+// A leaseState is the value of a lease register and its nominal expiry. All
+// the states of a register without a value are the zero leaseState, however
+// it lost its value, so that they collapse into one.
+type leaseState struct {
+	Value  int
+	Expiry int64 // math.MaxInt64 if the value doesn't expire
+	Live   bool
+}
+
+// LeaseRegister returns a model of a register of integers whose puts set a
+// value with a TTL, like a key with a lease in etcd or a TTL in Redis,
+// initially without a value. The inputs of its operations are [LeaseInput]
+// values, and the outputs are [LeaseOutput] values.
+//
+// A value expires TTL after the put's At, by the clock of the store, which
+// clients can only know to within uncertainty: a get up to uncertainty before
+// the nominal expiry may already see the value gone, and a get up to
+// uncertainty after it may still see the value. Once a get sees it gone, it
+// has expired for good, until the next put. A put replaces the value and its
+// lease, whether or not the old value expired.
+//
+// When the value expires within the window is only decided by the first get
+// that sees it gone, so the model doesn't need a state for each operation in
+// the window that it could have expired after. Puts with an unknown outcome
+// make the model nondeterministic, so its states are sets of possible values
+// and expiries, as for models converted with
+// [porcupine.NondeterministicModel.ToModel].
+func LeaseRegister(uncertainty int64) porcupine.Model {
+	return porcupine.NondeterministicModel{
+		Init: func() []interface{} {
+			return []interface{}{leaseState{}}
+		},
+		Step: func(state, input, output interface{}) []interface{} {
+			inp := input.(LeaseInput)
+			out := leaseOutput(output)
+			st := state.(leaseState)
+			if inp.Op == LeasePut {
+				expiry := int64(math.MaxInt64)
+				if inp.TTL > 0 {
+					expiry = inp.At + inp.TTL
+				}
+				next := leaseState{Value: inp.Value, Expiry: expiry, Live: true}
+				if out.Unknown {
+					return []interface{}{st, next}
+				}
+				return []interface{}{next}
+			}
+			if !st.Live {
+				if out.Unknown || !out.Found {
+					return []interface{}{st}
+				}
+				return nil
+			}
+			mayHaveExpired := inp.At >= st.Expiry-uncertainty
+			mustHaveExpired := inp.At-uncertainty >= st.Expiry
+			switch {
+			case out.Unknown:
+				return []interface{}{st}
+			case !out.Found && mayHaveExpired:
+				return []interface{}{leaseState{}}
+			case out.Found && out.Value == st.Value && !mustHaveExpired:
+				return []interface{}{st}
+			default:
+				return nil
+			}
+		},
+		DescribeOperation: func(input, output interface{}) string {
+			inp := input.(LeaseInput)
+			out := leaseOutput(output)
+			if inp.Op == LeasePut {
+				desc := fmt.Sprintf("put('%d', ttl %d) @%d", inp.Value, inp.TTL, inp.At)
+				if inp.TTL == 0 {
+					desc = fmt.Sprintf("put('%d') @%d", inp.Value, inp.At)
+				}
+				if out.Unknown {
+					return desc + " -> unknown"
+				}
+				return desc
+			}
+			switch {
+			case out.Unknown:
+				return fmt.Sprintf("get() @%d -> ?", inp.At)
+			case !out.Found:
+				return fmt.Sprintf("get() @%d -> none", inp.At)
+			}
+			return fmt.Sprintf("get() @%d -> '%d'", inp.At, out.Value)
+		},
+		DescribeState:  describeLeaseState,
+		DescribeStates: describeStates(describeLeaseState),
+	}.ToModel()
+}
+
+func describeLeaseState(state interface{}) string {
+	st := state.(leaseState)
+	switch {
+	case !st.Live:
+		return "none"
+	case st.Expiry == math.MaxInt64:
+		return fmt.Sprintf("'%d'", st.Value)
+	}
+	return fmt.Sprintf("'%d' until %d", st.Value, st.Expiry)
+}
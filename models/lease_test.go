@@ -0,0 +1,173 @@
+package models
+
+import (
+	"testing"
+
+	"github.com/anishathalye/porcupine"
+)
+
+func putLease(value int, ttl, at int64) LeaseInput {
+	return LeaseInput{Op: LeasePut, Value: value, TTL: ttl, At: at}
+}
+
+func getLease(at int64) LeaseInput {
+	return LeaseInput{Op: LeaseGet, At: at}
+}
+
+var (
+	leaseOk      = LeaseOutput{}
+	leaseMissing = LeaseOutput{}
+	leaseUnknown = LeaseOutput{Unknown: true}
+)
+
+func leaseRead(value int) LeaseOutput {
+	return LeaseOutput{Value: value, Found: true}
+}
+
+func TestLeaseRegister(t *testing.T) {
+	ops := []porcupine.Operation{
+		op(0, getLease(0), 0, leaseMissing, 5),
+		op(0, putLease(1, 100, 10), 10, leaseOk, 20),
+		op(1, getLease(30), 30, leaseRead(1), 40),
+		op(1, getLease(200), 200, leaseMissing, 210),
+		op(0, putLease(2, 0, 220), 220, leaseOk, 230),
+		op(1, getLease(1000), 1000, leaseRead(2), 1010),
+	}
+	if !porcupine.CheckOperations(LeaseRegister(10), ops) {
+		t.Fatal("expected operations to be linearizable")
+	}
+
+	// a value can't expire long before its TTL is up
+	ops[2].Output = leaseMissing
+	if porcupine.CheckOperations(LeaseRegister(10), ops) {
+		t.Fatal("expected operations not to be linearizable")
+	}
+
+	// or be read long after
+	ops[2].Output = leaseRead(1)
+	ops[3].Output = leaseRead(1)
+	if porcupine.CheckOperations(LeaseRegister(10), ops) {
+		t.Fatal("expected operations not to be linearizable")
+	}
+}
+
+func TestLeaseRegisterUncertainty(t *testing.T) {
+	// the value is gone a little before its nominal expiry at 110, and
+	// still there a little after, on another replica
+	ops := []porcupine.Operation{
+		op(0, putLease(1, 100, 10), 10, leaseOk, 20),
+		op(1, getLease(105), 105, leaseMissing, 106),
+		op(2, getLease(103), 103, leaseRead(1), 115),
+	}
+	if !porcupine.CheckOperations(LeaseRegister(10), ops) {
+		t.Fatal("expected operations to be linearizable")
+	}
+	// which only the window allows
+	if porcupine.CheckOperations(LeaseRegister(0), ops) {
+		t.Fatal("expected operations not to be linearizable")
+	}
+	ops = []porcupine.Operation{
+		op(0, putLease(1, 100, 10), 10, leaseOk, 20),
+		op(1, getLease(115), 115, leaseRead(1), 120),
+	}
+	if !porcupine.CheckOperations(LeaseRegister(10), ops) {
+		t.Fatal("expected operations to be linearizable")
+	}
+	if porcupine.CheckOperations(LeaseRegister(0), ops) {
+		t.Fatal("expected operations not to be linearizable")
+	}
+	if porcupine.CheckOperations(LeaseRegister(4), ops) {
+		t.Fatal("expected operations not to be linearizable")
+	}
+}
+
+func TestLeaseRegisterExpiryIsFinal(t *testing.T) {
+	// once a get sees the value gone, later gets can't see it, even in the
+	// window
+	ops := []porcupine.Operation{
+		op(0, putLease(1, 100, 10), 10, leaseOk, 20),
+		op(1, getLease(105), 105, leaseMissing, 106),
+		op(2, getLease(107), 107, leaseRead(1), 108),
+	}
+	if porcupine.CheckOperations(LeaseRegister(10), ops) {
+		t.Fatal("expected operations not to be linearizable")
+	}
+
+	// until a put renews it
+	ops = []porcupine.Operation{
+		op(0, putLease(1, 100, 10), 10, leaseOk, 20),
+		op(1, getLease(105), 105, leaseMissing, 106),
+		op(0, putLease(1, 100, 106), 106, leaseOk, 107),
+		op(2, getLease(150), 150, leaseRead(1), 160),
+	}
+	if !porcupine.CheckOperations(LeaseRegister(10), ops) {
+		t.Fatal("expected operations to be linearizable")
+	}
+}
+
+func TestLeaseRegisterUnknown(t *testing.T) {
+	// a put with an unknown outcome may have renewed the lease
+	ops := []porcupine.Operation{
+		op(0, putLease(1, 100, 10), 10, leaseOk, 20),
+		op(0, putLease(1, 100, 50), 50, leaseUnknown, 60),
+		op(1, getLease(130), 130, leaseRead(1), 131),
+	}
+	if !porcupine.CheckOperations(LeaseRegister(10), ops) {
+		t.Fatal("expected operations to be linearizable")
+	}
+
+	// or not
+	ops[2].Output = leaseMissing
+	if !porcupine.CheckOperations(LeaseRegister(10), ops) {
+		t.Fatal("expected operations to be linearizable")
+	}
+
+	// but not both
+	ops = append(ops, op(1, getLease(135), 135, leaseRead(1), 136))
+	if porcupine.CheckOperations(LeaseRegister(10), ops) {
+		t.Fatal("expected operations not to be linearizable")
+	}
+
+	// a get that never returned tells nothing
+	ops = []porcupine.Operation{
+		op(0, putLease(1, 100, 10), 10, leaseOk, 20),
+		op(1, getLease(30), 30, nil, 1000),
+		op(2, getLease(40), 40, leaseRead(1), 50),
+	}
+	if !porcupine.CheckOperations(LeaseRegister(10), ops) {
+		t.Fatal("expected operations to be linearizable")
+	}
+}
+
+func TestLeaseRegisterDescribe(t *testing.T) {
+	model := LeaseRegister(10)
+	descriptions := []struct {
+		input  LeaseInput
+		output interface{}
+		desc   string
+	}{
+		{putLease(1, 100, 10), leaseOk, "put('1', ttl 100) @10"},
+		{putLease(1, 0, 10), leaseOk, "put('1') @10"},
+		{putLease(1, 100, 10), nil, "put('1', ttl 100) @10 -> unknown"},
+		{getLease(20), leaseRead(1), "get() @20 -> '1'"},
+		{getLease(20), leaseMissing, "get() @20 -> none"},
+		{getLease(20), leaseUnknown, "get() @20 -> ?"},
+	}
+	for _, d := range descriptions {
+		if desc := model.DescribeOperation(d.input, d.output); desc != d.desc {
+			t.Errorf("expected %q, got %q", d.desc, desc)
+		}
+	}
+	state := model.Init()
+	if desc := model.DescribeState(state); desc != "none" {
+		t.Errorf("unexpected state %q", desc)
+	}
+	_, state = model.Step(state, putLease(1, 100, 10), leaseOk)
+	if desc := model.DescribeState(state); desc != "'1' until 110" {
+		t.Errorf("unexpected state %q", desc)
+	}
+	_, state = model.Step(state, putLease(2, 0, 20), nil)
+	if desc := model.DescribeState(state); desc != "one of {'1' until 110, '2'}" {
+		t.Errorf("unexpected state %q", desc)
+	}
+}
@@ -0,0 +1,139 @@
+package models
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/anishathalye/porcupine"
+)
+
+// A ListOp is the kind of an operation of the [ListAppend] model.
+type ListOp int
+
+const (
+	ListReadOp ListOp = iota
+	ListAppendOp
+)
+
+// ListInput is the input of an operation of the [ListAppend] model.
+type ListInput struct {
+	Op    ListOp
+	Key   string
+	Value string // for appends
+}
+
+// ListOutput is the output of an operation of the [ListAppend] model.
+type ListOutput struct {
+	Values []string // for reads, the whole list
+	// Unknown is set if the outcome of the operation is unknown: an append
+	// that timed out may or may not have taken effect, and a read may have
+	// returned anything.
+	Unknown bool
+}
+
+// listOutput returns the output of an operation, with a nil output, from an
+// operation that never returned, treated as an unknown outcome.
+func listOutput(output interface{}) ListOutput {
+	if output == nil {
+		return ListOutput{Unknown: true}
+	}
+	return output.(ListOutput)
+}
+
+// maxDescribedValues is the number of values of a list beyond which
+// descriptions of the list are truncated.
+const maxDescribedValues = 6
+
+// describeList describes a list, showing only its first and last few values
+// if it's long.
+func describeList(values []string) string {
+	if len(values) > maxDescribedValues {
+		head := values[:maxDescribedValues/2]
+		tail := values[len(values)-maxDescribedValues/2:]
+		return fmt.Sprintf("[%s, … %d more, %s]", strings.Join(head, ", "), len(values)-maxDescribedValues, strings.Join(tail, ", "))
+	}
+	return fmt.Sprintf("[%s]", strings.Join(values, ", "))
+}
+
+func equalLists(list1, list2 []string) bool {
+	if len(list1) != len(list2) {
+		return false
+	}
+	for i := range list1 {
+		if list1[i] != list2[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// listAppend models the list of a single key, since histories are partitioned
+// by key.
+var listAppend = porcupine.NondeterministicModel{
+	Init: func() []interface{} {
+		return []interface{}{[]string{}}
+	},
+	Step: func(state, input, output interface{}) []interface{} {
+		inp := input.(ListInput)
+		out := listOutput(output)
+		st := state.([]string)
+		if inp.Op == ListAppendOp {
+			// copy, since other states may share st's backing array
+			next := make([]string, len(st)+1)
+			copy(next, st)
+			next[len(st)] = inp.Value
+			if out.Unknown {
+				return []interface{}{st, next}
+			}
+			return []interface{}{next}
+		}
+		if out.Unknown || equalLists(out.Values, st) {
+			return []interface{}{st}
+		}
+		return nil
+	},
+	Equal: func(state1, state2 interface{}) bool {
+		return equalLists(state1.([]string), state2.([]string))
+	},
+	DescribeOperation: func(input, output interface{}) string {
+		inp := input.(ListInput)
+		out := listOutput(output)
+		if inp.Op == ListAppendOp {
+			if out.Unknown {
+				return fmt.Sprintf("append('%s', %s) -> unknown", inp.Key, inp.Value)
+			}
+			return fmt.Sprintf("append('%s', %s)", inp.Key, inp.Value)
+		}
+		if out.Unknown {
+			return fmt.Sprintf("read('%s') -> ?", inp.Key)
+		}
+		return fmt.Sprintf("read('%s') -> %s", inp.Key, describeList(out.Values))
+	},
+	DescribeState:  describeListState,
+	DescribeStates: describeStates(describeListState),
+}
+
+func describeListState(state interface{}) string {
+	return describeList(state.([]string))
+}
+
+// ListAppend returns a model of a store of lists, as in Elle's list-append
+// workload: each key holds a list, initially empty, and operations append a
+// value to the list of a key, or read the whole list. The inputs of its
+// operations are [ListInput] values, and the outputs are [ListOutput] values.
+//
+// A read must return exactly the values that were appended to the key, in
+// order. Like [KV], the model partitions histories by key, which is sound
+// because every operation is on a single key; its states are the lists of a
+// single key.
+//
+// Appends with an unknown outcome make the model nondeterministic, so its
+// states are sets of possible lists, as for models converted with
+// [porcupine.NondeterministicModel.ToModel].
+func ListAppend() porcupine.Model {
+	return PartitionByKey(listAppend.ToModel(), listKey)
+}
+
+func listKey(input interface{}) string {
+	return input.(ListInput).Key
+}
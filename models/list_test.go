@@ -0,0 +1,136 @@
+package models
+
+import (
+	"regexp"
+	"testing"
+
+	"github.com/anishathalye/porcupine"
+)
+
+func appendList(key, value string) ListInput {
+	return ListInput{Op: ListAppendOp, Key: key, Value: value}
+}
+
+func readList(key string) ListInput {
+	return ListInput{Op: ListReadOp, Key: key}
+}
+
+func list(values ...string) ListOutput {
+	return ListOutput{Values: values}
+}
+
+func TestListAppend(t *testing.T) {
+	ops := []porcupine.Operation{
+		op(0, appendList("x", "1"), 0, ListOutput{}, 10),
+		op(1, appendList("x", "2"), 5, ListOutput{}, 15),
+		op(2, appendList("y", "3"), 0, ListOutput{}, 10),
+		op(0, readList("x"), 20, list("2", "1"), 30),
+		op(2, readList("y"), 20, list("3"), 30),
+	}
+	if !porcupine.CheckOperations(ListAppend(), ops) {
+		t.Fatal("expected operations to be linearizable")
+	}
+
+	// reads must agree on the order of concurrent appends
+	ops = append(ops, op(1, readList("x"), 40, list("1", "2"), 50))
+	if porcupine.CheckOperations(ListAppend(), ops) {
+		t.Fatal("expected operations not to be linearizable")
+	}
+
+	// a read must return the whole list
+	ops = []porcupine.Operation{
+		op(0, appendList("x", "1"), 0, ListOutput{}, 10),
+		op(0, appendList("x", "2"), 20, ListOutput{}, 30),
+		op(1, readList("x"), 40, list("2"), 50),
+	}
+	if porcupine.CheckOperations(ListAppend(), ops) {
+		t.Fatal("expected operations not to be linearizable")
+	}
+}
+
+func TestListAppendUnknown(t *testing.T) {
+	ops := []porcupine.Operation{
+		op(0, appendList("x", "1"), 0, ListOutput{Unknown: true}, 10),
+		op(0, appendList("x", "2"), 20, ListOutput{}, 30),
+		op(1, readList("x"), 40, list("2"), 50),
+	}
+	if !porcupine.CheckOperations(ListAppend(), ops) {
+		t.Fatal("expected operations to be linearizable")
+	}
+	ops[2].Output = list("1", "2")
+	if !porcupine.CheckOperations(ListAppend(), ops) {
+		t.Fatal("expected operations to be linearizable")
+	}
+
+	// an append that timed out can't take effect after it returned
+	ops[2].Output = list("2", "1")
+	if porcupine.CheckOperations(ListAppend(), ops) {
+		t.Fatal("expected operations not to be linearizable")
+	}
+
+	// but one that never returned can
+	ops[0].Output = nil
+	ops[0].Return = 1000
+	if !porcupine.CheckOperations(ListAppend(), ops) {
+		t.Fatal("expected operations to be linearizable")
+	}
+}
+
+func TestListAppendDescribe(t *testing.T) {
+	model := ListAppend()
+	descriptions := []struct {
+		input  ListInput
+		output interface{}
+		desc   string
+	}{
+		{appendList("x", "1"), ListOutput{}, "append('x', 1)"},
+		{appendList("x", "1"), nil, "append('x', 1) -> unknown"},
+		{readList("x"), list("1", "2"), "read('x') -> [1, 2]"},
+		{readList("x"), list("1", "2", "3", "4", "5", "6", "7", "8"), "read('x') -> [1, 2, 3, … 2 more, 6, 7, 8]"},
+		{readList("x"), ListOutput{Unknown: true}, "read('x') -> ?"},
+	}
+	for _, d := range descriptions {
+		if desc := model.DescribeOperation(d.input, d.output); desc != d.desc {
+			t.Errorf("expected %q, got %q", d.desc, desc)
+		}
+	}
+}
+
+// kvLogValue matches a value appended in the logs in test_data/kv.
+var kvLogValue = regexp.MustCompile(`x \d+ \d+ y`)
+
+// TestListAppendKVLogs checks that the list-append model agrees with the
+// key-value model on the keys of the logs in test_data/kv that are only
+// appended to, where a get reads the concatenation of the appended values.
+func TestListAppendKVLogs(t *testing.T) {
+	for _, name := range []string{"c01-ok", "c01-bad", "c10-ok", "c10-bad", "c50-ok", "c50-bad"} {
+		events := parseKVLog(t, name)
+		put := make(map[string]bool)
+		for _, event := range events {
+			if event.Kind == porcupine.CallEvent && event.Value.(KVInput).Op == KVPut {
+				put[event.Value.(KVInput).Key] = true
+			}
+		}
+		events = porcupine.FilterEvents(events, porcupine.ByInput(func(input interface{}) bool {
+			return !put[input.(KVInput).Key]
+		}))
+		lists := make([]porcupine.Event, len(events))
+		for i, event := range events {
+			lists[i] = event
+			switch v := event.Value.(type) {
+			case KVInput:
+				if v.Op == KVAppend {
+					lists[i].Value = appendList(v.Key, v.Value)
+				} else {
+					lists[i].Value = readList(v.Key)
+				}
+			case KVOutput:
+				lists[i].Value = ListOutput{Values: kvLogValue.FindAllString(v.Value, -1)}
+			}
+		}
+		expected := porcupine.CheckEvents(KV(), events)
+		if res := porcupine.CheckEvents(ListAppend(), lists); res != expected {
+			t.Errorf("%s: expected output %t, got output %t", name, expected, res)
+		}
+	}
+}
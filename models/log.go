@@ -0,0 +1,115 @@
+package models
+
+import (
+	"fmt"
+
+	"github.com/anishathalye/porcupine"
+)
+
+// A LogOp is the kind of an operation of the [Log] model.
+type LogOp int
+
+const (
+	LogRead LogOp = iota
+	LogAppend
+)
+
+// LogInput is the input of an operation of the [Log] model.
+type LogInput struct {
+	Op    LogOp
+	Index int    // for reads
+	Entry string // for appends
+}
+
+// LogOutput is the output of an operation of the [Log] model.
+type LogOutput struct {
+	Index int    // for appends, the index the entry was assigned
+	Entry string // for reads that found an entry
+	Found bool   // for reads
+	// Unknown is set if the outcome of the operation is unknown: an append
+	// that timed out may or may not have been committed, and a read may
+	// have returned anything.
+	Unknown bool
+}
+
+// logOutput returns the output of an operation, with a nil output, from an
+// operation that never returned, treated as an unknown outcome.
+func logOutput(output interface{}) LogOutput {
+	if output == nil {
+		return LogOutput{Unknown: true}
+	}
+	return output.(LogOutput)
+}
+
+func describeLogState(state interface{}) string {
+	return describeList(state.([]string))
+}
+
+var replicatedLog = porcupine.NondeterministicModel{
+	Init: func() []interface{} {
+		return []interface{}{[]string{}}
+	},
+	Step: func(state, input, output interface{}) []interface{} {
+		inp := input.(LogInput)
+		out := logOutput(output)
+		st := state.([]string)
+		if inp.Op == LogAppend {
+			if !out.Unknown && out.Index != len(st)+1 {
+				return nil
+			}
+			next := make([]string, len(st)+1)
+			copy(next, st)
+			next[len(st)] = inp.Entry
+			if out.Unknown {
+				return []interface{}{st, next}
+			}
+			return []interface{}{next}
+		}
+		found := inp.Index >= 1 && inp.Index <= len(st)
+		if out.Unknown || out.Found == found && (!found || out.Entry == st[inp.Index-1]) {
+			return []interface{}{st}
+		}
+		return nil
+	},
+	Equal: func(state1, state2 interface{}) bool {
+		return equalLists(state1.([]string), state2.([]string))
+	},
+	DescribeOperation: func(input, output interface{}) string {
+		inp := input.(LogInput)
+		out := logOutput(output)
+		if inp.Op == LogAppend {
+			if out.Unknown {
+				return fmt.Sprintf("append(%s) -> unknown", inp.Entry)
+			}
+			return fmt.Sprintf("append(%s) -> %d", inp.Entry, out.Index)
+		}
+		switch {
+		case out.Unknown:
+			return fmt.Sprintf("read(%d) -> ?", inp.Index)
+		case !out.Found:
+			return fmt.Sprintf("read(%d) -> not found", inp.Index)
+		}
+		return fmt.Sprintf("read(%d) -> %s", inp.Index, out.Entry)
+	},
+	DescribeState:  describeLogState,
+	DescribeStates: describeStates(describeLogState),
+}
+
+// Log returns a model of a replicated log, such as the log of a consensus
+// implementation, initially empty. The inputs of its operations are
+// [LogInput] values, and the outputs are [LogOutput] values.
+//
+// An append commits an entry at the end of the log and returns its index,
+// starting at 1 as in Raft, so successful appends must be assigned
+// consecutive indices in the order they take effect. A read of an index
+// returns the entry committed there, or that there is none yet.
+//
+// Appends with an unknown outcome make the model nondeterministic, so its
+// states are sets of possible logs, as for models converted with
+// [porcupine.NondeterministicModel.ToModel]. Such an append may be committed
+// at any time until it returns, so an entry that wasn't committed by then
+// must not appear later; an append that never returned may be committed at
+// any time.
+func Log() porcupine.Model {
+	return replicatedLog.ToModel()
+}
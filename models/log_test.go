@@ -0,0 +1,105 @@
+package models
+
+import (
+	"testing"
+
+	"github.com/anishathalye/porcupine"
+)
+
+func logAppend(entry string) LogInput {
+	return LogInput{Op: LogAppend, Entry: entry}
+}
+
+func logRead(index int) LogInput {
+	return LogInput{Op: LogRead, Index: index}
+}
+
+func appended(index int) LogOutput {
+	return LogOutput{Index: index}
+}
+
+func entry(entry string) LogOutput {
+	return LogOutput{Entry: entry, Found: true}
+}
+
+var notFound = LogOutput{}
+
+func TestLog(t *testing.T) {
+	ops := []porcupine.Operation{
+		op(0, logAppend("x"), 0, appended(2), 10),
+		op(1, logAppend("y"), 0, appended(1), 10),
+		op(2, logRead(1), 5, notFound, 8),
+		op(2, logRead(1), 20, entry("y"), 30),
+		op(2, logRead(2), 20, entry("x"), 30),
+		op(2, logRead(3), 20, notFound, 30),
+	}
+	if !porcupine.CheckOperations(Log(), ops) {
+		t.Fatal("expected operations to be linearizable")
+	}
+
+	// indices are assigned in the order appends take effect
+	ops[0].Output = appended(1)
+	if porcupine.CheckOperations(Log(), ops) {
+		t.Fatal("expected operations not to be linearizable")
+	}
+
+	// without gaps
+	ops = []porcupine.Operation{
+		op(0, logAppend("x"), 0, appended(1), 10),
+		op(0, logAppend("y"), 20, appended(3), 30),
+	}
+	if porcupine.CheckOperations(Log(), ops) {
+		t.Fatal("expected operations not to be linearizable")
+	}
+}
+
+func TestLogGhostWrite(t *testing.T) {
+	// an append times out, a read after that doesn't find it, another
+	// append takes its index, and then the timed-out entry reappears
+	ops := []porcupine.Operation{
+		op(0, logAppend("x"), 0, LogOutput{Unknown: true}, 10),
+		op(1, logRead(1), 20, notFound, 30),
+		op(1, logAppend("y"), 40, appended(1), 50),
+		op(1, logRead(2), 60, entry("x"), 70),
+	}
+	if porcupine.CheckOperations(Log(), ops) {
+		t.Fatal("expected operations not to be linearizable")
+	}
+
+	// without the reappearance, the append simply failed
+	if !porcupine.CheckOperations(Log(), ops[:3]) {
+		t.Fatal("expected operations to be linearizable")
+	}
+
+	// and if the append never returned, it can be committed late
+	ops[0].Output = nil
+	ops[0].Return = 1000
+	if !porcupine.CheckOperations(Log(), ops) {
+		t.Fatal("expected operations to be linearizable")
+	}
+}
+
+func TestLogDescribe(t *testing.T) {
+	model := Log()
+	descriptions := []struct {
+		input  LogInput
+		output interface{}
+		desc   string
+	}{
+		{logAppend("x"), appended(3), "append(x) -> 3"},
+		{logAppend("x"), nil, "append(x) -> unknown"},
+		{logRead(3), entry("x"), "read(3) -> x"},
+		{logRead(3), notFound, "read(3) -> not found"},
+		{logRead(3), LogOutput{Unknown: true}, "read(3) -> ?"},
+	}
+	for _, d := range descriptions {
+		if desc := model.DescribeOperation(d.input, d.output); desc != d.desc {
+			t.Errorf("expected %q, got %q", d.desc, desc)
+		}
+	}
+	_, state := model.Step(model.Init(), logAppend("x"), appended(1))
+	_, state = model.Step(state, logAppend("y"), nil)
+	if desc := model.DescribeState(state); desc != "one of {[x], [x, y]}" {
+		t.Errorf("unexpected state %q", desc)
+	}
+}
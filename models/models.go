@@ -0,0 +1,132 @@
+// Package models provides models of common systems, such as registers, for
+// checking histories with porcupine.
+//
+// Each model comes with exported types for the inputs and outputs of its
+// operations, and describes operations and states for visualizations. Models
+// accept operations whose outcome is unknown, such as a write that timed out,
+// which may or may not have taken effect: their outputs have an Unknown
+// field, and a nil output, as recorded by [porcupine.Recorder] for an
+// operation that never returned, is treated the same way.
+package models
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/anishathalye/porcupine"
+)
+
+// describeStates returns a function that describes a set of candidate states
+// of a nondeterministic model, as the description of the state if there is
+// only one.
+func describeStates(describeState func(state interface{}) string) func(states []interface{}) string {
+	return func(states []interface{}) string {
+		if len(states) == 1 {
+			return describeState(states[0])
+		}
+		descriptions := make([]string, len(states))
+		for i, state := range states {
+			descriptions[i] = describeState(state)
+		}
+		return fmt.Sprintf("one of {%s}", strings.Join(descriptions, ", "))
+	}
+}
+
+// equalInts returns whether two lists of integers are equal.
+func equalInts(values1, values2 []int) bool {
+	if len(values1) != len(values2) {
+		return false
+	}
+	for i := range values1 {
+		if values1[i] != values2[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// describeIntList describes a state that is a list of integers.
+func describeIntList(state interface{}) string {
+	values := state.([]int)
+	descriptions := make([]string, len(values))
+	for i, v := range values {
+		descriptions[i] = fmt.Sprint(v)
+	}
+	return fmt.Sprintf("[%s]", strings.Join(descriptions, ", "))
+}
+
+// PartitionByKey returns the model m, with Partition and PartitionEvent
+// functions that split a history into a partition for each key, as returned
+// by keyOf for the inputs of its operations, in sorted order. For events,
+// a return event goes to the partition of the key of its call.
+//
+// Partitioning by key is only sound if every operation reads or writes
+// exactly one key, and m models the state of a single key, so that a history
+// is linearizable if and only if the operations on each key are. A model
+// where an operation can involve several keys, such as a range read or a
+// transaction, must not be partitioned this way, since that would hide
+// violations between keys. PartitionByKey panics if m already has a Partition
+// or PartitionEvent function, and the PartitionEvent function panics if a
+// return event has no matching call, which would otherwise be assigned to
+// the wrong key.
+func PartitionByKey(m porcupine.Model, keyOf func(input interface{}) string) porcupine.Model {
+	if m.Partition != nil || m.PartitionEvent != nil {
+		panic("models: PartitionByKey called with a model that is already partitioned")
+	}
+	m.Partition = partitionByKey(keyOf)
+	m.PartitionEvent = partitionEventsByKey(keyOf)
+	return m
+}
+
+// partitionByKey returns a partition function for models where every
+// operation is on a single key, as returned by key for its input, with a
+// partition for each key, in sorted order.
+func partitionByKey(key func(input interface{}) string) func(history []porcupine.Operation) [][]porcupine.Operation {
+	return func(history []porcupine.Operation) [][]porcupine.Operation {
+		m := make(map[string][]porcupine.Operation)
+		for _, op := range history {
+			k := key(op.Input)
+			m[k] = append(m[k], op)
+		}
+		keys := make([]string, 0, len(m))
+		for k := range m {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		partitions := make([][]porcupine.Operation, len(keys))
+		for i, k := range keys {
+			partitions[i] = m[k]
+		}
+		return partitions
+	}
+}
+
+// partitionEventsByKey is the equivalent of [partitionByKey] for histories of
+// events.
+func partitionEventsByKey(key func(input interface{}) string) func(history []porcupine.Event) [][]porcupine.Event {
+	return func(history []porcupine.Event) [][]porcupine.Event {
+		m := make(map[string][]porcupine.Event)
+		keys := make(map[int]string) // from id to key
+		for _, event := range history {
+			if event.Kind == porcupine.CallEvent {
+				keys[event.Id] = key(event.Value)
+			}
+			k, ok := keys[event.Id]
+			if !ok {
+				panic(fmt.Sprintf("models: return event with id %d has no matching call", event.Id))
+			}
+			m[k] = append(m[k], event)
+		}
+		sorted := make([]string, 0, len(m))
+		for k := range m {
+			sorted = append(sorted, k)
+		}
+		sort.Strings(sorted)
+		partitions := make([][]porcupine.Event, len(sorted))
+		for i, k := range sorted {
+			partitions[i] = m[k]
+		}
+		return partitions
+	}
+}
@@ -0,0 +1,105 @@
+package models
+
+import (
+	"testing"
+
+	"github.com/anishathalye/porcupine"
+)
+
+// op, call, and ret build operations and events, which can't be written
+// with unkeyed fields outside the porcupine package.
+func op(client int, input interface{}, call int64, output interface{}, ret int64) porcupine.Operation {
+	return porcupine.Operation{ClientId: client, Input: input, Call: call, Output: output, Return: ret}
+}
+
+func call(client int, input interface{}, id int) porcupine.Event {
+	return porcupine.Event{ClientId: client, Kind: porcupine.CallEvent, Value: input, Id: id}
+}
+
+func ret(client int, output interface{}, id int) porcupine.Event {
+	return porcupine.Event{ClientId: client, Kind: porcupine.ReturnEvent, Value: output, Id: id}
+}
+
+// manualKV is the KV model, partitioned by hand, like the key-value model in
+// the tests of the porcupine package.
+func manualKV() porcupine.Model {
+	model := KV()
+	model.Partition = func(history []porcupine.Operation) [][]porcupine.Operation {
+		m := make(map[string][]porcupine.Operation)
+		for _, v := range history {
+			key := v.Input.(KVInput).Key
+			m[key] = append(m[key], v)
+		}
+		var ret [][]porcupine.Operation
+		for _, v := range m {
+			ret = append(ret, v)
+		}
+		return ret
+	}
+	model.PartitionEvent = func(history []porcupine.Event) [][]porcupine.Event {
+		m := make(map[string][]porcupine.Event)
+		match := make(map[int]string) // id -> key
+		for _, v := range history {
+			if v.Kind == porcupine.CallEvent {
+				match[v.Id] = v.Value.(KVInput).Key
+			}
+			key := match[v.Id]
+			m[key] = append(m[key], v)
+		}
+		var ret [][]porcupine.Event
+		for _, v := range m {
+			ret = append(ret, v)
+		}
+		return ret
+	}
+	return model
+}
+
+func TestPartitionByKey(t *testing.T) {
+	model := KV()
+	model.Partition = nil
+	model.PartitionEvent = nil
+	wrapped := PartitionByKey(model, kvKey)
+	names := []string{"c01-ok", "c01-bad", "c10-ok", "c10-bad", "c50-ok", "c50-bad"}
+	if testing.Short() {
+		names = names[:4]
+	}
+	for _, name := range names {
+		events := parseKVLog(t, name)
+		expected := porcupine.CheckEvents(manualKV(), events)
+		if res := porcupine.CheckEvents(wrapped, events); res != expected {
+			t.Errorf("%s: expected output %t, got output %t", name, expected, res)
+		}
+		ops, err := porcupine.EventsToOperations(events)
+		if err != nil {
+			t.Fatal(err)
+		}
+		expected = porcupine.CheckOperations(manualKV(), ops)
+		if res := porcupine.CheckOperations(wrapped, ops); res != expected {
+			t.Errorf("%s: expected output %t for operations, got output %t", name, expected, res)
+		}
+	}
+}
+
+func TestPartitionByKeyPanics(t *testing.T) {
+	expectPanic := func(f func()) {
+		t.Helper()
+		defer func() {
+			if recover() == nil {
+				t.Error("expected a panic")
+			}
+		}()
+		f()
+	}
+
+	// the model is already partitioned
+	expectPanic(func() { PartitionByKey(KV(), kvKey) })
+
+	// a return event has no call
+	events := []porcupine.Event{
+		call(0, KVInput{Op: KVPut, Key: "x", Value: "a"}, 0),
+		ret(0, KVOutput{}, 0),
+		ret(1, KVOutput{}, 1),
+	}
+	expectPanic(func() { KV().PartitionEvent(events) })
+}
@@ -0,0 +1,129 @@
+package models
+
+import (
+	"fmt"
+
+	"github.com/anishathalye/porcupine"
+)
+
+// A QueueOp is the kind of an operation of the [BoundedQueue] model.
+type QueueOp int
+
+const (
+	QueueEnqueue QueueOp = iota
+	QueueDequeue
+)
+
+// QueueInput is the input of an operation of the [BoundedQueue] model.
+type QueueInput struct {
+	Op    QueueOp
+	Value int // for enqueues
+}
+
+// QueueOutput is the output of an operation of the [BoundedQueue] model.
+type QueueOutput struct {
+	Value int  // for dequeues that aren't empty
+	Full  bool // for enqueues that failed because the queue was full
+	Empty bool // for dequeues that failed because the queue was empty
+	// Unknown is set if the outcome of the operation is unknown: an
+	// enqueue that timed out may or may not have added its value, and a
+	// dequeue that timed out may or may not have removed one.
+	Unknown bool
+}
+
+// queueOutput returns the output of an operation, with a nil output, from an
+// operation that never returned, treated as an unknown outcome.
+func queueOutput(output interface{}) QueueOutput {
+	if output == nil {
+		return QueueOutput{Unknown: true}
+	}
+	return output.(QueueOutput)
+}
+
+// BoundedQueue returns a model of a FIFO queue of integers that holds at most
+// capacity values, initially empty. The inputs of its operations are
+// [QueueInput] values, and the outputs are [QueueOutput] values.
+//
+// An enqueue fails with Full exactly when the queue holds capacity values, and
+// a dequeue fails with Empty exactly when it holds none. An enqueue with an
+// unknown outcome may have taken a slot in the queue, if there was one, and a
+// dequeue with an unknown outcome may have removed the value at its head.
+// Unknown outcomes make the model nondeterministic, so its states are sets of
+// possible queues, as for models converted with
+// [porcupine.NondeterministicModel.ToModel].
+func BoundedQueue(capacity int) porcupine.Model {
+	return porcupine.NondeterministicModel{
+		Init: func() []interface{} {
+			return []interface{}{[]int{}}
+		},
+		Step: func(state, input, output interface{}) []interface{} {
+			inp := input.(QueueInput)
+			out := queueOutput(output)
+			st := state.([]int)
+			if inp.Op == QueueEnqueue {
+				full := len(st) >= capacity
+				switch {
+				case out.Unknown && full:
+					return []interface{}{st}
+				case out.Unknown:
+					return []interface{}{st, enqueue(st, inp.Value)}
+				case out.Full != full:
+					return nil
+				case full:
+					return []interface{}{st}
+				default:
+					return []interface{}{enqueue(st, inp.Value)}
+				}
+			}
+			empty := len(st) == 0
+			switch {
+			case out.Unknown && empty:
+				return []interface{}{st}
+			case out.Unknown:
+				return []interface{}{st, st[1:]}
+			case out.Empty != empty:
+				return nil
+			case empty:
+				return []interface{}{st}
+			case out.Value != st[0]:
+				return nil
+			default:
+				return []interface{}{st[1:]}
+			}
+		},
+		Equal: func(state1, state2 interface{}) bool {
+			return equalInts(state1.([]int), state2.([]int))
+		},
+		DescribeOperation: func(input, output interface{}) string {
+			inp := input.(QueueInput)
+			out := queueOutput(output)
+			if inp.Op == QueueEnqueue {
+				switch {
+				case out.Unknown:
+					return fmt.Sprintf("enqueue(%d) -> unknown", inp.Value)
+				case out.Full:
+					return fmt.Sprintf("enqueue(%d) -> full", inp.Value)
+				}
+				return fmt.Sprintf("enqueue(%d)", inp.Value)
+			}
+			switch {
+			case out.Unknown:
+				return "dequeue() -> ?"
+			case out.Empty:
+				return "dequeue() -> empty"
+			}
+			return fmt.Sprintf("dequeue() -> %d", out.Value)
+		},
+		DescribeState:  describeIntList,
+		DescribeStates: describeStates(describeIntList),
+	}.ToModel()
+}
+
+// enqueue returns the queue with the given value added at its tail, without
+// modifying queue.
+func enqueue(queue []int, value int) []int {
+	next := make([]int, len(queue)+1)
+	copy(next, queue)
+	next[len(queue)] = value
+	return next
+}
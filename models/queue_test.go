@@ -0,0 +1,175 @@
+package models
+
+import (
+	"testing"
+
+	"github.com/anishathalye/porcupine"
+)
+
+func enq(value int) QueueInput {
+	return QueueInput{Op: QueueEnqueue, Value: value}
+}
+
+var deq = QueueInput{Op: QueueDequeue}
+
+var (
+	enqueued = QueueOutput{}
+	full     = QueueOutput{Full: true}
+	empty    = QueueOutput{Empty: true}
+)
+
+func dequeued(value int) QueueOutput {
+	return QueueOutput{Value: value}
+}
+
+func TestBoundedQueue(t *testing.T) {
+	ops := []porcupine.Operation{
+		op(0, enq(1), 0, enqueued, 10),
+		op(1, enq(2), 5, enqueued, 15),
+		op(2, deq, 20, dequeued(2), 30),
+		op(0, deq, 40, dequeued(1), 50),
+		op(1, deq, 60, empty, 70),
+	}
+	if !porcupine.CheckOperations(BoundedQueue(2), ops) {
+		t.Fatal("expected operations to be linearizable")
+	}
+
+	// values come out in the order they went in
+	ops[3].Output = dequeued(2)
+	if porcupine.CheckOperations(BoundedQueue(2), ops) {
+		t.Fatal("expected operations not to be linearizable")
+	}
+
+	// an empty queue can't be dequeued from successfully
+	ops = []porcupine.Operation{
+		op(0, deq, 0, dequeued(0), 10),
+	}
+	if porcupine.CheckOperations(BoundedQueue(2), ops) {
+		t.Fatal("expected operations not to be linearizable")
+	}
+}
+
+func TestBoundedQueueFull(t *testing.T) {
+	// the third enqueue fails, since the queue is full
+	ops := []porcupine.Operation{
+		op(0, enq(1), 0, enqueued, 10),
+		op(0, enq(2), 20, enqueued, 30),
+		op(0, enq(3), 40, full, 50),
+		op(1, deq, 60, dequeued(1), 70),
+		op(0, enq(4), 80, enqueued, 90),
+		op(1, deq, 100, dequeued(2), 110),
+		op(1, deq, 120, dequeued(4), 130),
+	}
+	if !porcupine.CheckOperations(BoundedQueue(2), ops) {
+		t.Fatal("expected operations to be linearizable")
+	}
+
+	// it can't succeed
+	ops[2].Output = enqueued
+	if porcupine.CheckOperations(BoundedQueue(2), ops) {
+		t.Fatal("expected operations not to be linearizable")
+	}
+
+	// and an enqueue into a queue with room can't fail
+	ops[2].Output = full
+	ops[4].Output = full
+	if porcupine.CheckOperations(BoundedQueue(2), ops) {
+		t.Fatal("expected operations not to be linearizable")
+	}
+
+	// unless it's concurrent with an enqueue that fills the queue
+	ops = []porcupine.Operation{
+		op(0, enq(1), 0, enqueued, 10),
+		op(0, enq(2), 20, enqueued, 50),
+		op(1, enq(3), 30, full, 40),
+	}
+	if !porcupine.CheckOperations(BoundedQueue(2), ops) {
+		t.Fatal("expected operations to be linearizable")
+	}
+}
+
+func TestBoundedQueueUnknown(t *testing.T) {
+	// an enqueue that timed out may have taken the last slot
+	ops := []porcupine.Operation{
+		op(0, enq(1), 0, enqueued, 10),
+		op(1, enq(2), 20, QueueOutput{Unknown: true}, 30),
+		op(0, enq(3), 40, full, 50),
+		op(0, deq, 60, dequeued(1), 70),
+		op(0, deq, 80, dequeued(2), 90),
+	}
+	if !porcupine.CheckOperations(BoundedQueue(2), ops) {
+		t.Fatal("expected operations to be linearizable")
+	}
+
+	// or not, in which case the queue had room
+	ops = []porcupine.Operation{
+		op(0, enq(1), 0, enqueued, 10),
+		op(1, enq(2), 20, QueueOutput{Unknown: true}, 30),
+		op(0, enq(3), 40, enqueued, 50),
+		op(0, deq, 60, dequeued(1), 70),
+		op(0, deq, 80, dequeued(3), 90),
+	}
+	if !porcupine.CheckOperations(BoundedQueue(2), ops) {
+		t.Fatal("expected operations to be linearizable")
+	}
+
+	// but not both: if the queue was full, the value must be there
+	ops = []porcupine.Operation{
+		op(0, enq(1), 0, enqueued, 10),
+		op(1, enq(2), 20, QueueOutput{Unknown: true}, 30),
+		op(0, enq(3), 40, full, 50),
+		op(0, deq, 60, dequeued(1), 70),
+		op(0, deq, 80, empty, 90),
+	}
+	if porcupine.CheckOperations(BoundedQueue(2), ops) {
+		t.Fatal("expected operations not to be linearizable")
+	}
+
+	// an enqueue into a full queue has no effect, whatever its outcome
+	ops = []porcupine.Operation{
+		op(0, enq(1), 0, enqueued, 10),
+		op(1, enq(2), 20, nil, 1000),
+		op(0, deq, 30, dequeued(1), 40),
+		op(0, deq, 50, empty, 60),
+	}
+	if !porcupine.CheckOperations(BoundedQueue(1), ops) {
+		t.Fatal("expected operations to be linearizable")
+	}
+
+	// a dequeue that timed out may have removed the head
+	ops = []porcupine.Operation{
+		op(0, enq(1), 0, enqueued, 10),
+		op(0, enq(2), 20, enqueued, 30),
+		op(1, deq, 40, QueueOutput{Unknown: true}, 50),
+		op(0, deq, 60, dequeued(2), 70),
+	}
+	if !porcupine.CheckOperations(BoundedQueue(2), ops) {
+		t.Fatal("expected operations to be linearizable")
+	}
+}
+
+func TestBoundedQueueDescribe(t *testing.T) {
+	model := BoundedQueue(2)
+	descriptions := []struct {
+		input  QueueInput
+		output interface{}
+		desc   string
+	}{
+		{enq(1), enqueued, "enqueue(1)"},
+		{enq(1), full, "enqueue(1) -> full"},
+		{enq(1), nil, "enqueue(1) -> unknown"},
+		{deq, dequeued(1), "dequeue() -> 1"},
+		{deq, empty, "dequeue() -> empty"},
+		{deq, QueueOutput{Unknown: true}, "dequeue() -> ?"},
+	}
+	for _, d := range descriptions {
+		if desc := model.DescribeOperation(d.input, d.output); desc != d.desc {
+			t.Errorf("expected %q, got %q", d.desc, desc)
+		}
+	}
+	_, state := model.Step(model.Init(), enq(1), enqueued)
+	_, state = model.Step(state, enq(2), QueueOutput{Unknown: true})
+	if desc := model.DescribeState(state); desc != "one of {[1], [1, 2]}" {
+		t.Errorf("unexpected state %q", desc)
+	}
+}
@@ -0,0 +1,90 @@
+package models
+
+import (
+	"fmt"
+
+	"github.com/anishathalye/porcupine"
+)
+
+// A RegisterOp is the kind of an operation on a register.
+type RegisterOp int
+
+const (
+	RegisterGet RegisterOp = iota
+	RegisterPut
+)
+
+// RegisterInput is the input of an operation of the [Register] model.
+type RegisterInput struct {
+	Op    RegisterOp
+	Value int // for puts
+}
+
+// RegisterOutput is the output of an operation of the [Register] model.
+type RegisterOutput struct {
+	Value int // for gets
+	// Unknown is set if the outcome of the operation is unknown: a put
+	// that timed out may or may not have taken effect, and a get may have
+	// returned any value.
+	Unknown bool
+}
+
+// registerOutput returns the output of an operation, with a nil output, from
+// an operation that never returned, treated as an unknown outcome.
+func registerOutput(output interface{}) RegisterOutput {
+	if output == nil {
+		return RegisterOutput{Unknown: true}
+	}
+	return output.(RegisterOutput)
+}
+
+var register = porcupine.NondeterministicModel{
+	Init: func() []interface{} {
+		return []interface{}{0}
+	},
+	Step: func(state, input, output interface{}) []interface{} {
+		inp := input.(RegisterInput)
+		out := registerOutput(output)
+		if inp.Op == RegisterPut {
+			if out.Unknown {
+				return []interface{}{state, inp.Value}
+			}
+			return []interface{}{inp.Value}
+		}
+		if out.Unknown || out.Value == state.(int) {
+			return []interface{}{state}
+		}
+		return nil
+	},
+	DescribeOperation: func(input, output interface{}) string {
+		inp := input.(RegisterInput)
+		out := registerOutput(output)
+		if inp.Op == RegisterPut {
+			if out.Unknown {
+				return fmt.Sprintf("put('%d') -> unknown", inp.Value)
+			}
+			return fmt.Sprintf("put('%d')", inp.Value)
+		}
+		if out.Unknown {
+			return "get() -> ?"
+		}
+		return fmt.Sprintf("get() -> '%d'", out.Value)
+	},
+	DescribeState:  describeRegisterState,
+	DescribeStates: describeStates(describeRegisterState),
+}
+
+func describeRegisterState(state interface{}) string {
+	return fmt.Sprintf("'%d'", state.(int))
+}
+
+// Register returns a model of a read/write register of integers, initialized
+// to 0. The inputs of its operations are [RegisterInput] values, and the
+// outputs are [RegisterOutput] values.
+//
+// Puts with an unknown outcome make the model nondeterministic, so its states
+// are sets of possible values of the register, as for models converted with
+// [porcupine.NondeterministicModel.ToModel].
+func Register() porcupine.Model {
+	return register.ToModel()
+}
@@ -0,0 +1,139 @@
+package models
+
+import (
+	"testing"
+
+	"github.com/anishathalye/porcupine"
+)
+
+func put(value int) RegisterInput {
+	return RegisterInput{Op: RegisterPut, Value: value}
+}
+
+var get = RegisterInput{Op: RegisterGet}
+
+func read(value int) RegisterOutput {
+	return RegisterOutput{Value: value}
+}
+
+var (
+	ok      = RegisterOutput{}
+	unknown = RegisterOutput{Unknown: true}
+)
+
+func TestRegister(t *testing.T) {
+	// examples taken from http://nil.csail.mit.edu/6.824/2017/quizzes/q2-17-ans.pdf
+	// section VII, as in the README
+
+	ops := []porcupine.Operation{
+		op(0, put(100), 0, ok, 100),
+		op(1, get, 25, read(100), 75),
+		op(2, get, 30, read(0), 60),
+	}
+	if !porcupine.CheckOperations(Register(), ops) {
+		t.Fatal("expected operations to be linearizable")
+	}
+
+	// same example as above, but with Event
+	events := []porcupine.Event{
+		call(0, put(100), 0),
+		call(1, get, 1),
+		call(2, get, 2),
+		ret(2, read(0), 2),
+		ret(1, read(100), 1),
+		ret(0, ok, 0),
+	}
+	if !porcupine.CheckEvents(Register(), events) {
+		t.Fatal("expected operations to be linearizable")
+	}
+
+	ops = []porcupine.Operation{
+		op(0, put(200), 0, ok, 100),
+		op(1, get, 10, read(200), 30),
+		op(2, get, 40, read(0), 90),
+	}
+	if porcupine.CheckOperations(Register(), ops) {
+		t.Fatal("expected operations to not be linearizable")
+	}
+
+	// same example as above, but with Event
+	events = []porcupine.Event{
+		call(0, put(200), 0),
+		call(1, get, 1),
+		ret(1, read(200), 1),
+		call(2, get, 2),
+		ret(2, read(0), 2),
+		ret(0, ok, 0),
+	}
+	if porcupine.CheckEvents(Register(), events) {
+		t.Fatal("expected operations to not be linearizable")
+	}
+}
+
+func TestRegisterUnknown(t *testing.T) {
+	// a put with an unknown outcome may not have taken effect
+	ops := []porcupine.Operation{
+		op(0, put(100), 0, unknown, 5),
+		op(1, get, 10, read(0), 20),
+	}
+	if !porcupine.CheckOperations(Register(), ops) {
+		t.Fatal("expected operations to be linearizable")
+	}
+
+	// or it may have, even if it never returned
+	ops = []porcupine.Operation{
+		op(0, put(100), 0, nil, 1000),
+		op(1, get, 10, read(100), 20),
+	}
+	if !porcupine.CheckOperations(Register(), ops) {
+		t.Fatal("expected operations to be linearizable")
+	}
+
+	// but not both
+	ops = []porcupine.Operation{
+		op(0, put(100), 0, unknown, 5),
+		op(1, get, 10, read(100), 20),
+		op(1, get, 30, read(0), 40),
+	}
+	if porcupine.CheckOperations(Register(), ops) {
+		t.Fatal("expected operations not to be linearizable")
+	}
+
+	// a get with an unknown outcome doesn't constrain the value
+	ops = []porcupine.Operation{
+		op(0, put(100), 0, ok, 5),
+		op(1, get, 10, unknown, 20),
+		op(1, get, 30, read(100), 40),
+	}
+	if !porcupine.CheckOperations(Register(), ops) {
+		t.Fatal("expected operations to be linearizable")
+	}
+}
+
+func TestRegisterDescribe(t *testing.T) {
+	model := Register()
+	descriptions := []struct {
+		input  RegisterInput
+		output interface{}
+		desc   string
+	}{
+		{put(100), ok, "put('100')"},
+		{put(100), unknown, "put('100') -> unknown"},
+		{get, read(100), "get() -> '100'"},
+		{get, nil, "get() -> ?"},
+	}
+	for _, d := range descriptions {
+		if desc := model.DescribeOperation(d.input, d.output); desc != d.desc {
+			t.Errorf("expected %q, got %q", d.desc, desc)
+		}
+	}
+
+	state := model.Init()
+	if desc := model.DescribeState(state); desc != "'0'" {
+		t.Errorf("expected initial state '0', got %q", desc)
+	}
+	_, state = model.Step(state, put(100), unknown)
+	if desc := model.DescribeState(state); desc != "one of {'0', '100'}" {
+		t.Errorf("unexpected state %q", desc)
+	}
+}
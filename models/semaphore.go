@@ -0,0 +1,197 @@
+package models
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/anishathalye/porcupine"
+)
+
+// A SemaphoreOp is the kind of an operation of the [Semaphore] model.
+type SemaphoreOp int
+
+const (
+	SemaphoreAcquire SemaphoreOp = iota
+	SemaphoreRelease
+	SemaphoreAvailable
+)
+
+// SemaphoreInput is the input of an operation of the [Semaphore] model.
+type SemaphoreInput struct {
+	Op    SemaphoreOp
+	Owner string // for acquires and releases, such as the name of the client
+	Units int    // for acquires and releases
+}
+
+// SemaphoreOutput is the output of an operation of the [Semaphore] model.
+type SemaphoreOutput struct {
+	// Acquired is set for acquires that succeeded; an acquire fails if
+	// fewer units than it asked for are available.
+	Acquired  bool
+	Available int // for reads of the number of available units
+	// Unknown is set if the outcome of the operation is unknown: an
+	// acquire or release that timed out may or may not have taken effect,
+	// and a read may have returned anything.
+	Unknown bool
+}
+
+// semaphoreOutput returns the output of an operation, with a nil output, from
+// an operation that never returned, treated as an unknown outcome.
+func semaphoreOutput(output interface{}) SemaphoreOutput {
+	if output == nil {
+		return SemaphoreOutput{Unknown: true}
+	}
+	return output.(SemaphoreOutput)
+}
+
+// A semaphoreHolding is the number of units held by an owner.
+type semaphoreHolding struct {
+	owner string
+	units int
+}
+
+// A semaphoreState is the units held by each owner that holds any, sorted by
+// owner, and the number of units available.
+type semaphoreState struct {
+	holdings  []semaphoreHolding
+	available int
+}
+
+func (s semaphoreState) held(owner string) int {
+	i := sort.Search(len(s.holdings), func(i int) bool { return s.holdings[i].owner >= owner })
+	if i < len(s.holdings) && s.holdings[i].owner == owner {
+		return s.holdings[i].units
+	}
+	return 0
+}
+
+// hold returns the state with the units held by owner changed by delta,
+// without modifying s.
+func (s semaphoreState) hold(owner string, delta int) semaphoreState {
+	units := s.held(owner) + delta
+	next := semaphoreState{available: s.available - delta}
+	added := false
+	for _, h := range s.holdings {
+		if !added && h.owner >= owner {
+			if units > 0 {
+				next.holdings = append(next.holdings, semaphoreHolding{owner, units})
+			}
+			added = true
+			if h.owner == owner {
+				continue
+			}
+		}
+		next.holdings = append(next.holdings, h)
+	}
+	if !added && units > 0 {
+		next.holdings = append(next.holdings, semaphoreHolding{owner, units})
+	}
+	return next
+}
+
+func (s semaphoreState) equal(other semaphoreState) bool {
+	if s.available != other.available || len(s.holdings) != len(other.holdings) {
+		return false
+	}
+	for i := range s.holdings {
+		if s.holdings[i] != other.holdings[i] {
+			return false
+		}
+	}
+	return true
+}
+
+func describeSemaphoreState(state interface{}) string {
+	st := state.(semaphoreState)
+	descriptions := make([]string, len(st.holdings))
+	for i, h := range st.holdings {
+		descriptions[i] = fmt.Sprintf("%s: %d", h.owner, h.units)
+	}
+	return fmt.Sprintf("%d available, held {%s}", st.available, strings.Join(descriptions, ", "))
+}
+
+// Semaphore returns a model of a counting semaphore with n units, all
+// initially available, that tracks which owner holds them. The inputs of its
+// operations are [SemaphoreInput] values, and the outputs are
+// [SemaphoreOutput] values.
+//
+// An acquire succeeds, taking the units it asked for, exactly when that many
+// units are available. A release returns units that its owner holds, and a
+// release of more units than the owner holds is not legal. A read returns the
+// number of available units.
+//
+// Acquires and releases with an unknown outcome make the model
+// nondeterministic, so its states are sets of possible holdings, as for
+// models converted with [porcupine.NondeterministicModel.ToModel]: an
+// acquire that timed out may still hold units.
+func Semaphore(n int) porcupine.Model {
+	return porcupine.NondeterministicModel{
+		Init: func() []interface{} {
+			return []interface{}{semaphoreState{available: n}}
+		},
+		Step: func(state, input, output interface{}) []interface{} {
+			inp := input.(SemaphoreInput)
+			out := semaphoreOutput(output)
+			st := state.(semaphoreState)
+			switch inp.Op {
+			case SemaphoreAcquire:
+				enough := st.available >= inp.Units
+				switch {
+				case out.Unknown && enough:
+					return []interface{}{st, st.hold(inp.Owner, inp.Units)}
+				case out.Unknown || !out.Acquired && !enough:
+					return []interface{}{st}
+				case out.Acquired && enough:
+					return []interface{}{st.hold(inp.Owner, inp.Units)}
+				}
+				return nil
+			case SemaphoreRelease:
+				held := st.held(inp.Owner) >= inp.Units
+				switch {
+				case out.Unknown && held:
+					return []interface{}{st, st.hold(inp.Owner, -inp.Units)}
+				case out.Unknown:
+					return []interface{}{st}
+				case held:
+					return []interface{}{st.hold(inp.Owner, -inp.Units)}
+				}
+				return nil
+			}
+			if out.Unknown || out.Available == st.available {
+				return []interface{}{st}
+			}
+			return nil
+		},
+		Equal: func(state1, state2 interface{}) bool {
+			return state1.(semaphoreState).equal(state2.(semaphoreState))
+		},
+		DescribeOperation: func(input, output interface{}) string {
+			inp := input.(SemaphoreInput)
+			out := semaphoreOutput(output)
+			var desc string
+			switch inp.Op {
+			case SemaphoreAcquire:
+				desc = fmt.Sprintf("acquire(%s, %d)", inp.Owner, inp.Units)
+				if !out.Unknown && !out.Acquired {
+					return desc + " -> failed"
+				}
+			case SemaphoreRelease:
+				desc = fmt.Sprintf("release(%s, %d)", inp.Owner, inp.Units)
+			case SemaphoreAvailable:
+				if out.Unknown {
+					return "available() -> ?"
+				}
+				return fmt.Sprintf("available() -> %d", out.Available)
+			default:
+				return "<invalid>"
+			}
+			if out.Unknown {
+				desc += " -> unknown"
+			}
+			return desc
+		},
+		DescribeState:  describeSemaphoreState,
+		DescribeStates: describeStates(describeSemaphoreState),
+	}.ToModel()
+}
@@ -0,0 +1,156 @@
+package models
+
+import (
+	"testing"
+
+	"github.com/anishathalye/porcupine"
+)
+
+func acquire(owner string, units int) SemaphoreInput {
+	return SemaphoreInput{Op: SemaphoreAcquire, Owner: owner, Units: units}
+}
+
+func release(owner string, units int) SemaphoreInput {
+	return SemaphoreInput{Op: SemaphoreRelease, Owner: owner, Units: units}
+}
+
+var availableUnits = SemaphoreInput{Op: SemaphoreAvailable}
+
+var (
+	acquired = SemaphoreOutput{Acquired: true}
+	failed   = SemaphoreOutput{}
+	released = SemaphoreOutput{}
+)
+
+func available(units int) SemaphoreOutput {
+	return SemaphoreOutput{Available: units}
+}
+
+func TestSemaphore(t *testing.T) {
+	ops := []porcupine.Operation{
+		op(0, acquire("a", 2), 0, acquired, 10),
+		op(1, acquire("b", 2), 5, failed, 15),
+		op(1, acquire("b", 1), 20, acquired, 30),
+		op(2, availableUnits, 40, available(0), 50),
+		op(0, release("a", 1), 60, released, 70),
+		op(2, availableUnits, 80, available(1), 90),
+	}
+	if !porcupine.CheckOperations(Semaphore(3), ops) {
+		t.Fatal("expected operations to be linearizable")
+	}
+
+	// an owner can't release units it doesn't hold
+	ops[4].Input = release("c", 1)
+	if porcupine.CheckOperations(Semaphore(3), ops) {
+		t.Fatal("expected operations not to be linearizable")
+	}
+	ops[4].Input = release("b", 2)
+	if porcupine.CheckOperations(Semaphore(3), ops) {
+		t.Fatal("expected operations not to be linearizable")
+	}
+}
+
+func TestSemaphoreOverGrant(t *testing.T) {
+	// both acquires succeed, holding 3 of 2 units
+	ops := []porcupine.Operation{
+		op(0, acquire("a", 2), 0, acquired, 10),
+		op(1, acquire("b", 1), 5, acquired, 15),
+	}
+	if porcupine.CheckOperations(Semaphore(2), ops) {
+		t.Fatal("expected operations not to be linearizable")
+	}
+
+	// unless a release is concurrent with them
+	ops = append(ops, op(2, release("a", 2), 5, released, 15))
+	if !porcupine.CheckOperations(Semaphore(2), ops) {
+		t.Fatal("expected operations to be linearizable")
+	}
+
+	// an acquire can't fail while enough units are available
+	ops = []porcupine.Operation{
+		op(0, acquire("a", 1), 0, acquired, 10),
+		op(1, acquire("b", 1), 20, failed, 30),
+	}
+	if porcupine.CheckOperations(Semaphore(2), ops) {
+		t.Fatal("expected operations not to be linearizable")
+	}
+}
+
+func TestSemaphoreAvailable(t *testing.T) {
+	// the read happens after the acquire
+	ops := []porcupine.Operation{
+		op(0, acquire("a", 1), 0, acquired, 10),
+		op(1, availableUnits, 20, available(2), 30),
+	}
+	if porcupine.CheckOperations(Semaphore(2), ops) {
+		t.Fatal("expected operations not to be linearizable")
+	}
+
+	// concurrent reads see the acquire in different orders
+	ops = []porcupine.Operation{
+		op(0, acquire("a", 1), 0, acquired, 100),
+		op(1, availableUnits, 10, available(1), 20),
+		op(1, availableUnits, 30, available(2), 40),
+	}
+	if porcupine.CheckOperations(Semaphore(2), ops) {
+		t.Fatal("expected operations not to be linearizable")
+	}
+}
+
+func TestSemaphoreUnknown(t *testing.T) {
+	// an acquire that timed out may hold units
+	ops := []porcupine.Operation{
+		op(0, acquire("a", 2), 0, SemaphoreOutput{Unknown: true}, 10),
+		op(1, acquire("b", 1), 20, failed, 30),
+		op(2, availableUnits, 40, available(0), 50),
+		op(0, release("a", 2), 60, released, 70),
+		op(1, acquire("b", 1), 80, acquired, 90),
+	}
+	if !porcupine.CheckOperations(Semaphore(2), ops) {
+		t.Fatal("expected operations to be linearizable")
+	}
+	// or not
+	ops = []porcupine.Operation{
+		op(0, acquire("a", 2), 0, nil, 1000),
+		op(1, acquire("b", 2), 20, acquired, 30),
+	}
+	if !porcupine.CheckOperations(Semaphore(2), ops) {
+		t.Fatal("expected operations to be linearizable")
+	}
+	// but only if the units were available
+	ops = []porcupine.Operation{
+		op(0, acquire("a", 2), 0, SemaphoreOutput{Unknown: true}, 10),
+		op(1, release("a", 1), 20, released, 30),
+	}
+	if !porcupine.CheckOperations(Semaphore(2), ops) {
+		t.Fatal("expected operations to be linearizable")
+	}
+	if porcupine.CheckOperations(Semaphore(1), ops) {
+		t.Fatal("expected operations not to be linearizable")
+	}
+}
+
+func TestSemaphoreDescribe(t *testing.T) {
+	model := Semaphore(3)
+	descriptions := []struct {
+		input  SemaphoreInput
+		output interface{}
+		desc   string
+	}{
+		{acquire("a", 2), acquired, "acquire(a, 2)"},
+		{acquire("a", 2), failed, "acquire(a, 2) -> failed"},
+		{acquire("a", 2), nil, "acquire(a, 2) -> unknown"},
+		{release("a", 2), released, "release(a, 2)"},
+		{availableUnits, available(1), "available() -> 1"},
+	}
+	for _, d := range descriptions {
+		if desc := model.DescribeOperation(d.input, d.output); desc != d.desc {
+			t.Errorf("expected %q, got %q", d.desc, desc)
+		}
+	}
+	_, state := model.Step(model.Init(), acquire("b", 1), acquired)
+	_, state = model.Step(state, acquire("a", 1), acquired)
+	if desc := model.DescribeState(state); desc != "1 available, held {a: 1, b: 1}" {
+		t.Errorf("unexpected state %q", desc)
+	}
+}
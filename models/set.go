@@ -0,0 +1,145 @@
+package models
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/anishathalye/porcupine"
+)
+
+// A SetOp is the kind of an operation on a set.
+type SetOp int
+
+const (
+	SetAdd SetOp = iota
+	SetRead
+)
+
+// SetInput is the input of an operation of the [Set] model.
+type SetInput struct {
+	Op    SetOp
+	Value int // for adds
+}
+
+// SetOutput is the output of an operation of the [Set] model.
+type SetOutput struct {
+	Values []int // for reads, in any order
+	// Unknown is set if the outcome of the operation is unknown: an add
+	// that timed out may or may not have taken effect, and a read may
+	// have returned anything.
+	Unknown bool
+}
+
+// setOutput returns the output of an operation, with a nil output, from an
+// operation that never returned, treated as an unknown outcome.
+func setOutput(output interface{}) SetOutput {
+	if output == nil {
+		return SetOutput{Unknown: true}
+	}
+	return output.(SetOutput)
+}
+
+// A setState is a sorted slice of the elements of a set, without duplicates.
+type setState []int
+
+// add returns the set with the given value added to it, without modifying s.
+func (s setState) add(value int) setState {
+	i := sort.SearchInts(s, value)
+	if i < len(s) && s[i] == value {
+		return s
+	}
+	next := make(setState, len(s)+1)
+	copy(next, s[:i])
+	next[i] = value
+	copy(next[i+1:], s[i:])
+	return next
+}
+
+// equals returns whether values, in any order, are the elements of the set,
+// each appearing once.
+func (s setState) equals(values []int) bool {
+	if len(values) != len(s) {
+		return false
+	}
+	sorted := append([]int(nil), values...)
+	sort.Ints(sorted)
+	for i := range s {
+		if sorted[i] != s[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// NondeterministicSet returns the nondeterministic model underlying [Set],
+// whose states are single sets, for use with other nondeterministic models or
+// with a customized description of candidate states.
+func NondeterministicSet() porcupine.NondeterministicModel {
+	return porcupine.NondeterministicModel{
+		Init: func() []interface{} {
+			return []interface{}{setState{}}
+		},
+		Step: func(state, input, output interface{}) []interface{} {
+			inp := input.(SetInput)
+			out := setOutput(output)
+			st := state.(setState)
+			if inp.Op == SetAdd {
+				if out.Unknown {
+					return []interface{}{st, st.add(inp.Value)}
+				}
+				return []interface{}{st.add(inp.Value)}
+			}
+			if out.Unknown || st.equals(out.Values) {
+				return []interface{}{st}
+			}
+			return nil
+		},
+		Equal: func(state1, state2 interface{}) bool {
+			return state1.(setState).equals(state2.(setState))
+		},
+		DescribeOperation: func(input, output interface{}) string {
+			inp := input.(SetInput)
+			out := setOutput(output)
+			if inp.Op == SetAdd {
+				if out.Unknown {
+					return fmt.Sprintf("add(%d) -> unknown", inp.Value)
+				}
+				return fmt.Sprintf("add(%d)", inp.Value)
+			}
+			if out.Unknown {
+				return "read() -> ?"
+			}
+			return fmt.Sprintf("read() -> %s", describeInts(out.Values))
+		},
+		DescribeState:  describeSetState,
+		DescribeStates: describeStates(describeSetState),
+	}
+}
+
+func describeSetState(state interface{}) string {
+	return describeInts(state.(setState))
+}
+
+func describeInts(values []int) string {
+	descriptions := make([]string, len(values))
+	for i, v := range values {
+		descriptions[i] = fmt.Sprint(v)
+	}
+	return fmt.Sprintf("{%s}", strings.Join(descriptions, ", "))
+}
+
+// Set returns a model of a set of integers, initially empty, as in Jepsen's
+// set test. The inputs of its operations are [SetInput] values, and the
+// outputs are [SetOutput] values.
+//
+// A read must return every element of the set exactly once, so reads that
+// return an element twice, or an element that was never added, are not
+// legal.
+//
+// Adds with an unknown outcome make the model nondeterministic, so its states
+// are sets of possible sets, as for models converted with
+// [porcupine.NondeterministicModel.ToModel].
+func Set() porcupine.Model {
+	return NondeterministicSet().ToModel()
+}
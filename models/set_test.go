@@ -0,0 +1,142 @@
+package models
+
+import (
+	"testing"
+
+	"github.com/anishathalye/porcupine"
+)
+
+func add(value int) SetInput {
+	return SetInput{Op: SetAdd, Value: value}
+}
+
+var readSet = SetInput{Op: SetRead}
+
+func values(values ...int) SetOutput {
+	return SetOutput{Values: values}
+}
+
+func TestSet(t *testing.T) {
+	events := []porcupine.Event{
+		call(0, add(100), 0),
+		call(1, add(0), 1),
+		call(2, readSet, 2),
+		ret(2, values(100), 2),
+		ret(1, SetOutput{}, 1),
+		ret(0, SetOutput{}, 0),
+	}
+	if !porcupine.CheckEvents(Set(), events) {
+		t.Fatal("expected operations to be linearizable")
+	}
+
+	// reads can return elements in any order
+	events = []porcupine.Event{
+		call(0, add(100), 0),
+		call(1, add(110), 1),
+		call(2, readSet, 2),
+		ret(2, values(110, 100), 2),
+		ret(1, SetOutput{}, 1),
+		ret(0, SetOutput{}, 0),
+	}
+	if !porcupine.CheckEvents(Set(), events) {
+		t.Fatal("expected operations to be linearizable")
+	}
+
+	events = []porcupine.Event{
+		call(0, add(100), 0),
+		call(1, add(110), 1),
+		call(2, readSet, 2),
+		ret(2, SetOutput{Unknown: true}, 2),
+		ret(1, SetOutput{}, 1),
+		ret(0, SetOutput{}, 0),
+	}
+	if !porcupine.CheckEvents(Set(), events) {
+		t.Fatal("expected operations to be linearizable")
+	}
+
+	// duplicate elements
+	events = []porcupine.Event{
+		call(0, add(100), 0),
+		call(1, add(110), 1),
+		call(2, readSet, 2),
+		ret(2, values(100, 100, 110), 2),
+		ret(1, SetOutput{}, 1),
+		ret(0, SetOutput{}, 0),
+	}
+	if porcupine.CheckEvents(Set(), events) {
+		t.Fatal("expected operations not to be linearizable")
+	}
+
+	// an element that was never added
+	events = []porcupine.Event{
+		call(0, add(100), 0),
+		call(2, readSet, 1),
+		ret(2, values(100, 120), 1),
+		ret(0, SetOutput{}, 0),
+	}
+	if porcupine.CheckEvents(Set(), events) {
+		t.Fatal("expected operations not to be linearizable")
+	}
+}
+
+func TestSetUnknown(t *testing.T) {
+	// an add with an unknown outcome may or may not have taken effect
+	ops := []porcupine.Operation{
+		op(0, add(1), 0, SetOutput{}, 10),
+		op(0, add(2), 20, SetOutput{Unknown: true}, 30),
+		op(1, readSet, 40, values(1), 50),
+	}
+	if !porcupine.CheckOperations(Set(), ops) {
+		t.Fatal("expected operations to be linearizable")
+	}
+	ops[2].Output = values(2, 1)
+	if !porcupine.CheckOperations(Set(), ops) {
+		t.Fatal("expected operations to be linearizable")
+	}
+
+	// but an element can't disappear once it's been read
+	ops = append(ops, op(1, readSet, 60, values(1), 70))
+	if porcupine.CheckOperations(Set(), ops) {
+		t.Fatal("expected operations not to be linearizable")
+	}
+
+	// an add that never returned can take effect at any later point
+	ops = []porcupine.Operation{
+		op(0, add(1), 0, nil, 1000),
+		op(1, readSet, 10, values(), 20),
+		op(1, readSet, 30, values(1), 40),
+	}
+	if !porcupine.CheckOperations(Set(), ops) {
+		t.Fatal("expected operations to be linearizable")
+	}
+}
+
+func TestSetDescribe(t *testing.T) {
+	model := Set()
+	descriptions := []struct {
+		input  SetInput
+		output interface{}
+		desc   string
+	}{
+		{add(1), SetOutput{}, "add(1)"},
+		{add(1), SetOutput{Unknown: true}, "add(1) -> unknown"},
+		{readSet, values(2, 1), "read() -> {2, 1}"},
+		{readSet, nil, "read() -> ?"},
+	}
+	for _, d := range descriptions {
+		if desc := model.DescribeOperation(d.input, d.output); desc != d.desc {
+			t.Errorf("expected %q, got %q", d.desc, desc)
+		}
+	}
+
+	state := model.Init()
+	_, state = model.Step(state, add(2), SetOutput{})
+	_, state = model.Step(state, add(1), SetOutput{})
+	if desc := model.DescribeState(state); desc != "{1, 2}" {
+		t.Errorf("unexpected state %q", desc)
+	}
+	_, state = model.Step(state, add(3), SetOutput{Unknown: true})
+	if desc := model.DescribeState(state); desc != "one of {{1, 2}, {1, 2, 3}}" {
+		t.Errorf("unexpected state %q", desc)
+	}
+}
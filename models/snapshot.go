@@ -0,0 +1,103 @@
+package models
+
+import (
+	"fmt"
+
+	"github.com/anishathalye/porcupine"
+)
+
+// A SnapshotOp is the kind of an operation of the [Snapshot] model.
+type SnapshotOp int
+
+const (
+	SnapshotScan SnapshotOp = iota
+	SnapshotWrite
+)
+
+// SnapshotInput is the input of an operation of the [Snapshot] model.
+type SnapshotInput struct {
+	Op    SnapshotOp
+	Index int // for writes, the register to write
+	Value int // for writes
+}
+
+// SnapshotOutput is the output of an operation of the [Snapshot] model.
+type SnapshotOutput struct {
+	Values []int // for scans, the values of all registers
+	// Unknown is set if the outcome of the operation is unknown: a write
+	// that timed out may or may not have taken effect, and a scan may have
+	// returned anything.
+	Unknown bool
+}
+
+// snapshotOutput returns the output of an operation, with a nil output, from
+// an operation that never returned, treated as an unknown outcome.
+func snapshotOutput(output interface{}) SnapshotOutput {
+	if output == nil {
+		return SnapshotOutput{Unknown: true}
+	}
+	return output.(SnapshotOutput)
+}
+
+// Snapshot returns a model of n integer registers, initialized to 0, that can
+// be written individually and scanned atomically, such as an atomic snapshot
+// object or a store with consistent multi-key reads. The inputs of its
+// operations are [SnapshotInput] values, and the outputs are [SnapshotOutput]
+// values. A scan must return the values of all n registers at a single point
+// in time.
+//
+// Unlike [KV], the model can't partition histories by register, because a
+// scan reads all of them, so the whole history is checked at once. The time
+// this takes grows quickly with the number of operations that are concurrent
+// with each other, as reported by [porcupine.MaxConcurrency], rather than with
+// the length of the history: histories of hundreds of operations from a
+// handful of clients check quickly, while many clients with long timeouts
+// may not.
+//
+// Writes with an unknown outcome make the model nondeterministic, so its
+// states are sets of possible vectors of values, as for models converted with
+// [porcupine.NondeterministicModel.ToModel].
+func Snapshot(n int) porcupine.Model {
+	return porcupine.NondeterministicModel{
+		Init: func() []interface{} {
+			return []interface{}{make([]int, n)}
+		},
+		Step: func(state, input, output interface{}) []interface{} {
+			inp := input.(SnapshotInput)
+			out := snapshotOutput(output)
+			st := state.([]int)
+			if inp.Op == SnapshotWrite {
+				next := make([]int, n)
+				copy(next, st)
+				next[inp.Index] = inp.Value
+				if out.Unknown {
+					return []interface{}{st, next}
+				}
+				return []interface{}{next}
+			}
+			if out.Unknown || equalInts(out.Values, st) {
+				return []interface{}{st}
+			}
+			return nil
+		},
+		Equal: func(state1, state2 interface{}) bool {
+			return equalInts(state1.([]int), state2.([]int))
+		},
+		DescribeOperation: func(input, output interface{}) string {
+			inp := input.(SnapshotInput)
+			out := snapshotOutput(output)
+			if inp.Op == SnapshotWrite {
+				if out.Unknown {
+					return fmt.Sprintf("write(%d, %d) -> unknown", inp.Index, inp.Value)
+				}
+				return fmt.Sprintf("write(%d, %d)", inp.Index, inp.Value)
+			}
+			if out.Unknown {
+				return "scan() -> ?"
+			}
+			return fmt.Sprintf("scan() -> %s", describeIntList(out.Values))
+		},
+		DescribeState:  describeIntList,
+		DescribeStates: describeStates(describeIntList),
+	}.ToModel()
+}
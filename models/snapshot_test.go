@@ -0,0 +1,151 @@
+package models
+
+import (
+	"math/rand"
+	"sort"
+	"testing"
+
+	"github.com/anishathalye/porcupine"
+)
+
+func write(index, value int) SnapshotInput {
+	return SnapshotInput{Op: SnapshotWrite, Index: index, Value: value}
+}
+
+var scan = SnapshotInput{Op: SnapshotScan}
+
+func scanned(values ...int) SnapshotOutput {
+	return SnapshotOutput{Values: values}
+}
+
+func TestSnapshot(t *testing.T) {
+	ops := []porcupine.Operation{
+		op(0, write(0, 1), 0, SnapshotOutput{}, 10),
+		op(1, write(1, 2), 5, SnapshotOutput{}, 15),
+		op(2, scan, 0, scanned(0, 2), 20),
+		op(2, scan, 30, scanned(1, 2), 40),
+	}
+	if !porcupine.CheckOperations(Snapshot(2), ops) {
+		t.Fatal("expected operations to be linearizable")
+	}
+
+	// the classic violation of a non-atomic scan, which reads the registers
+	// one at a time: the scan sees the second write but not the first, which
+	// finished before the second one started
+	ops = []porcupine.Operation{
+		op(0, write(0, 1), 10, SnapshotOutput{}, 20),
+		op(1, write(1, 1), 30, SnapshotOutput{}, 40),
+		op(2, scan, 0, scanned(0, 1), 50),
+	}
+	if porcupine.CheckOperations(Snapshot(2), ops) {
+		t.Fatal("expected operations not to be linearizable")
+	}
+	// each register on its own is fine
+	for i := 0; i < 2; i++ {
+		var register []porcupine.Operation
+		for _, o := range ops {
+			inp := o.Input.(SnapshotInput)
+			if inp.Op == SnapshotWrite && inp.Index == i {
+				register = append(register, op(o.ClientId, put(inp.Value), o.Call, ok, o.Return))
+			} else if inp.Op == SnapshotScan {
+				register = append(register, op(o.ClientId, get, o.Call, read(o.Output.(SnapshotOutput).Values[i]), o.Return))
+			}
+		}
+		if !porcupine.CheckOperations(Register(), register) {
+			t.Fatalf("expected register %d to be linearizable", i)
+		}
+	}
+
+	// unless the first write's outcome is unknown, so it may not have taken
+	// effect
+	ops[0].Output = SnapshotOutput{Unknown: true}
+	if !porcupine.CheckOperations(Snapshot(2), ops) {
+		t.Fatal("expected operations to be linearizable")
+	}
+}
+
+// snapshotHistory generates a linearizable history of a snapshot object, with
+// the given number of registers, clients, and operations per client, by
+// executing each operation atomically at a random point between its call and
+// its return.
+func snapshotHistory(rng *rand.Rand, registers, clients, length int) []porcupine.Operation {
+	type point struct {
+		at int64
+		op int
+	}
+	var ops []porcupine.Operation
+	var points []point
+	for c := 0; c < clients; c++ {
+		var now int64
+		for i := 0; i < length; i++ {
+			call := now + rng.Int63n(10)
+			ret := call + 1 + rng.Int63n(30)
+			now = ret
+			input := scan
+			if rng.Intn(2) == 0 {
+				input = write(rng.Intn(registers), len(ops)+1)
+			}
+			points = append(points, point{call + rng.Int63n(ret-call), len(ops)})
+			ops = append(ops, op(c, input, call, SnapshotOutput{}, ret))
+		}
+	}
+	sort.Slice(points, func(i, j int) bool {
+		return points[i].at < points[j].at
+	})
+	state := make([]int, registers)
+	for _, p := range points {
+		inp := ops[p.op].Input.(SnapshotInput)
+		if inp.Op == SnapshotWrite {
+			state[inp.Index] = inp.Value
+		} else {
+			ops[p.op].Output = scanned(append([]int(nil), state...)...)
+		}
+	}
+	return ops
+}
+
+func TestSnapshotLongHistory(t *testing.T) {
+	rng := rand.New(rand.NewSource(1))
+	ops := snapshotHistory(rng, 4, 5, 60)
+	if !porcupine.CheckOperations(Snapshot(4), ops) {
+		t.Fatal("expected operations to be linearizable")
+	}
+
+	// a scan that misses a write that finished before the scan was called
+	for i, o := range ops {
+		if o.Input.(SnapshotInput).Op == SnapshotScan && o.Call > 500 {
+			values := o.Output.(SnapshotOutput).Values
+			stale := append([]int(nil), values...)
+			for j := range stale {
+				stale[j] = 0
+			}
+			ops[i].Output = scanned(stale...)
+			break
+		}
+	}
+	if porcupine.CheckOperations(Snapshot(4), ops) {
+		t.Fatal("expected operations not to be linearizable")
+	}
+}
+
+func TestSnapshotDescribe(t *testing.T) {
+	model := Snapshot(3)
+	descriptions := []struct {
+		input  SnapshotInput
+		output interface{}
+		desc   string
+	}{
+		{write(1, 5), SnapshotOutput{}, "write(1, 5)"},
+		{write(1, 5), nil, "write(1, 5) -> unknown"},
+		{scan, scanned(0, 5, 0), "scan() -> [0, 5, 0]"},
+		{scan, SnapshotOutput{Unknown: true}, "scan() -> ?"},
+	}
+	for _, d := range descriptions {
+		if desc := model.DescribeOperation(d.input, d.output); desc != d.desc {
+			t.Errorf("expected %q, got %q", d.desc, desc)
+		}
+	}
+	if desc := model.DescribeState(model.Init()); desc != "[0, 0, 0]" {
+		t.Errorf("unexpected initial state %q", desc)
+	}
+}
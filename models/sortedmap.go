@@ -0,0 +1,320 @@
+package models
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/anishathalye/porcupine"
+)
+
+// A SortedMapOp is the kind of an operation of the [SortedMap] model.
+type SortedMapOp int
+
+const (
+	SortedMapGet SortedMapOp = iota
+	SortedMapPut
+	SortedMapDelete
+	SortedMapRange
+)
+
+// SortedMapInput is the input of an operation of the [SortedMap] model.
+type SortedMapInput struct {
+	Op    SortedMapOp
+	Key   string // for ranges, the first key of the range
+	Value string // for puts
+	// End is the end of a range, which includes the keys from Key up to,
+	// but not including, End, or all keys from Key on if End is empty.
+	End string
+}
+
+// A SortedMapEntry is a key and its value.
+type SortedMapEntry struct {
+	Key   string
+	Value string
+}
+
+// SortedMapOutput is the output of an operation of the [SortedMap] model.
+type SortedMapOutput struct {
+	Value   string           // for gets that found the key
+	Found   bool             // for gets
+	Entries []SortedMapEntry // for ranges, sorted by key
+	// Unknown is set if the outcome of the operation is unknown: a put or
+	// delete that timed out may or may not have taken effect, and a get or
+	// range may have returned anything.
+	Unknown bool
+}
+
+// sortedMapOutput returns the output of an operation, with a nil output, from
+// an operation that never returned, treated as an unknown outcome.
+func sortedMapOutput(output interface{}) SortedMapOutput {
+	if output == nil {
+		return SortedMapOutput{Unknown: true}
+	}
+	return output.(SortedMapOutput)
+}
+
+// A sortedMapState is the entries of a sorted map, sorted by key.
+type sortedMapState []SortedMapEntry
+
+func (s sortedMapState) find(key string) (int, bool) {
+	i := sort.Search(len(s), func(i int) bool { return s[i].Key >= key })
+	return i, i < len(s) && s[i].Key == key
+}
+
+// put returns the map with the given value for key, without modifying s.
+func (s sortedMapState) put(key, value string) sortedMapState {
+	i, found := s.find(key)
+	if found {
+		next := make(sortedMapState, len(s))
+		copy(next, s)
+		next[i].Value = value
+		return next
+	}
+	next := make(sortedMapState, len(s)+1)
+	copy(next, s[:i])
+	next[i] = SortedMapEntry{key, value}
+	copy(next[i+1:], s[i:])
+	return next
+}
+
+// delete returns the map without key, without modifying s.
+func (s sortedMapState) delete(key string) sortedMapState {
+	i, found := s.find(key)
+	if !found {
+		return s
+	}
+	next := make(sortedMapState, 0, len(s)-1)
+	next = append(next, s[:i]...)
+	return append(next, s[i+1:]...)
+}
+
+// span returns the entries from key up to end, or to the end of the map if end
+// is empty.
+func (s sortedMapState) span(key, end string) sortedMapState {
+	i, _ := s.find(key)
+	j := len(s)
+	if end != "" {
+		j, _ = s.find(end)
+	}
+	if j < i {
+		j = i
+	}
+	return s[i:j]
+}
+
+func equalEntries(entries1, entries2 []SortedMapEntry) bool {
+	if len(entries1) != len(entries2) {
+		return false
+	}
+	for i := range entries1 {
+		if entries1[i] != entries2[i] {
+			return false
+		}
+	}
+	return true
+}
+
+func describeEntries(entries []SortedMapEntry) string {
+	descriptions := make([]string, len(entries))
+	for i, e := range entries {
+		descriptions[i] = fmt.Sprintf("'%s': '%s'", e.Key, e.Value)
+	}
+	return fmt.Sprintf("{%s}", strings.Join(descriptions, ", "))
+}
+
+func describeSortedMapState(state interface{}) string {
+	return describeEntries(state.(sortedMapState))
+}
+
+var sortedMap = porcupine.NondeterministicModel{
+	Init: func() []interface{} {
+		return []interface{}{sortedMapState{}}
+	},
+	Step: func(state, input, output interface{}) []interface{} {
+		inp := input.(SortedMapInput)
+		out := sortedMapOutput(output)
+		st := state.(sortedMapState)
+		var next sortedMapState
+		switch inp.Op {
+		case SortedMapGet:
+			i, found := st.find(inp.Key)
+			if out.Unknown || out.Found == found && (!found || out.Value == st[i].Value) {
+				return []interface{}{st}
+			}
+			return nil
+		case SortedMapRange:
+			if out.Unknown || equalEntries(out.Entries, st.span(inp.Key, inp.End)) {
+				return []interface{}{st}
+			}
+			return nil
+		case SortedMapPut:
+			next = st.put(inp.Key, inp.Value)
+		case SortedMapDelete:
+			next = st.delete(inp.Key)
+		}
+		if out.Unknown {
+			return []interface{}{st, next}
+		}
+		return []interface{}{next}
+	},
+	Equal: func(state1, state2 interface{}) bool {
+		return equalEntries(state1.(sortedMapState), state2.(sortedMapState))
+	},
+	DescribeOperation: func(input, output interface{}) string {
+		inp := input.(SortedMapInput)
+		out := sortedMapOutput(output)
+		var desc string
+		switch inp.Op {
+		case SortedMapGet:
+			switch {
+			case out.Unknown:
+				return fmt.Sprintf("get('%s') -> ?", inp.Key)
+			case !out.Found:
+				return fmt.Sprintf("get('%s') -> not found", inp.Key)
+			}
+			return fmt.Sprintf("get('%s') -> '%s'", inp.Key, out.Value)
+		case SortedMapRange:
+			desc = fmt.Sprintf("range('%s', '%s')", inp.Key, inp.End)
+			if inp.End == "" {
+				desc = fmt.Sprintf("range('%s', ∞)", inp.Key)
+			}
+			if out.Unknown {
+				return desc + " -> ?"
+			}
+			return fmt.Sprintf("%s -> %s", desc, describeEntries(out.Entries))
+		case SortedMapPut:
+			desc = fmt.Sprintf("put('%s', '%s')", inp.Key, inp.Value)
+		case SortedMapDelete:
+			desc = fmt.Sprintf("delete('%s')", inp.Key)
+		default:
+			return "<invalid>"
+		}
+		if out.Unknown {
+			desc += " -> unknown"
+		}
+		return desc
+	},
+	DescribeState:  describeSortedMapState,
+	DescribeStates: describeStates(describeSortedMapState),
+}
+
+// SortedMap returns a model of a sorted map from strings to strings, initially
+// empty, with gets, puts, deletes, and range reads, like etcd's. The inputs of
+// its operations are [SortedMapInput] values, and the outputs are
+// [SortedMapOutput] values. A range must return exactly the entries of the map
+// in the range at a single point in time, sorted by key.
+//
+// Since range reads span many keys, the model can't partition histories by
+// key, as [KV] does. Instead, it partitions them by disjoint ranges of keys:
+// operations whose keys or ranges overlap, directly or through other
+// operations, are in the same partition. This is sound, because operations in
+// different partitions never involve the same keys, but a range over all keys
+// puts the whole history in a single partition.
+//
+// Puts and deletes with an unknown outcome make the model nondeterministic,
+// so its states are sets of possible maps, as for models converted with
+// [porcupine.NondeterministicModel.ToModel].
+func SortedMap() porcupine.Model {
+	model := sortedMap.ToModel()
+	model.Partition = partitionSortedMap
+	model.PartitionEvent = partitionSortedMapEvents
+	return model
+}
+
+// A keyInterval is the keys that an operation of the [SortedMap] model
+// involves: the single key lo if point is set, and otherwise the keys from lo
+// up to, but not including, hi, or all keys from lo on if hi is empty.
+type keyInterval struct {
+	lo, hi string
+	point  bool
+}
+
+func sortedMapInterval(input interface{}) keyInterval {
+	inp := input.(SortedMapInput)
+	if inp.Op == SortedMapRange {
+		return keyInterval{lo: inp.Key, hi: inp.End}
+	}
+	return keyInterval{lo: inp.Key, point: true}
+}
+
+// empty returns whether an interval has no keys.
+func (iv keyInterval) empty() bool {
+	return !iv.point && iv.hi != "" && iv.hi <= iv.lo
+}
+
+// groupIntervals returns a group for each interval, such that intervals that
+// overlap, directly or through other intervals, are in the same group, and
+// the number of groups.
+func groupIntervals(intervals []keyInterval) ([]int, int) {
+	order := make([]int, len(intervals))
+	for i := range order {
+		order[i] = i
+	}
+	sort.SliceStable(order, func(i, j int) bool {
+		return intervals[order[i]].lo < intervals[order[j]].lo
+	})
+	groups := make([]int, len(intervals))
+	n := 0
+	current := -1 // the group of the intervals seen so far with keys
+	var (
+		end       string // the end of the keys of the current group
+		inclusive bool   // whether end is one of them
+		unbounded bool   // whether the current group has all keys from its start on
+	)
+	for _, i := range order {
+		iv := intervals[i]
+		if iv.empty() {
+			// an empty interval has no keys in common with anything
+			groups[i] = n
+			n++
+			continue
+		}
+		if current < 0 || !unbounded && (iv.lo > end || iv.lo == end && !inclusive) {
+			current = n
+			n++
+			end, inclusive, unbounded = iv.lo, true, false
+		}
+		groups[i] = current
+		switch {
+		case iv.point:
+			// iv.lo <= end, since iv overlaps the group
+		case iv.hi == "":
+			unbounded = true
+		case iv.hi > end:
+			end, inclusive = iv.hi, false
+		}
+	}
+	return groups, n
+}
+
+func partitionSortedMap(history []porcupine.Operation) [][]porcupine.Operation {
+	intervals := make([]keyInterval, len(history))
+	for i, op := range history {
+		intervals[i] = sortedMapInterval(op.Input)
+	}
+	groups, n := groupIntervals(intervals)
+	partitions := make([][]porcupine.Operation, n)
+	for i, op := range history {
+		partitions[groups[i]] = append(partitions[groups[i]], op)
+	}
+	return partitions
+}
+
+func partitionSortedMapEvents(history []porcupine.Event) [][]porcupine.Event {
+	var intervals []keyInterval
+	calls := make(map[int]int) // from id to index in intervals
+	for _, event := range history {
+		if event.Kind == porcupine.CallEvent {
+			calls[event.Id] = len(intervals)
+			intervals = append(intervals, sortedMapInterval(event.Value))
+		}
+	}
+	groups, n := groupIntervals(intervals)
+	partitions := make([][]porcupine.Event, n)
+	for _, event := range history {
+		g := groups[calls[event.Id]]
+		partitions[g] = append(partitions[g], event)
+	}
+	return partitions
+}
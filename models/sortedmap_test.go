@@ -0,0 +1,242 @@
+package models
+
+import (
+	"math/rand"
+	"sort"
+	"testing"
+
+	"github.com/anishathalye/porcupine"
+)
+
+func mapPut(key, value string) SortedMapInput {
+	return SortedMapInput{Op: SortedMapPut, Key: key, Value: value}
+}
+
+func mapDelete(key string) SortedMapInput {
+	return SortedMapInput{Op: SortedMapDelete, Key: key}
+}
+
+func mapGet(key string) SortedMapInput {
+	return SortedMapInput{Op: SortedMapGet, Key: key}
+}
+
+func mapRange(key, end string) SortedMapInput {
+	return SortedMapInput{Op: SortedMapRange, Key: key, End: end}
+}
+
+func entries(kvs ...string) SortedMapOutput {
+	out := SortedMapOutput{Entries: []SortedMapEntry{}}
+	for i := 0; i < len(kvs); i += 2 {
+		out.Entries = append(out.Entries, SortedMapEntry{kvs[i], kvs[i+1]})
+	}
+	return out
+}
+
+func TestSortedMap(t *testing.T) {
+	ops := []porcupine.Operation{
+		op(0, mapPut("b", "1"), 0, SortedMapOutput{}, 10),
+		op(1, mapPut("a", "2"), 0, SortedMapOutput{}, 10),
+		op(0, mapPut("d", "3"), 20, SortedMapOutput{}, 30),
+		op(1, mapRange("a", "c"), 40, entries("a", "2", "b", "1"), 50),
+		op(1, mapRange("b", ""), 60, entries("b", "1", "d", "3"), 70),
+		op(0, mapDelete("b"), 80, SortedMapOutput{}, 90),
+		op(1, mapGet("b"), 100, SortedMapOutput{}, 110),
+		op(1, mapGet("d"), 100, SortedMapOutput{Value: "3", Found: true}, 110),
+	}
+	if !porcupine.CheckOperations(SortedMap(), ops) {
+		t.Fatal("expected operations to be linearizable")
+	}
+
+	// a range must return every key in it
+	ops[3].Output = entries("b", "1")
+	if porcupine.CheckOperations(SortedMap(), ops) {
+		t.Fatal("expected operations not to be linearizable")
+	}
+
+	// and no key outside it
+	ops[3].Output = entries("a", "2", "b", "1", "d", "3")
+	if porcupine.CheckOperations(SortedMap(), ops) {
+		t.Fatal("expected operations not to be linearizable")
+	}
+}
+
+func TestSortedMapUnknown(t *testing.T) {
+	// a range concurrent with puts to two keys can see either, but a range
+	// after a put with an unknown outcome must agree with earlier ranges
+	ops := []porcupine.Operation{
+		op(0, mapPut("a", "1"), 0, SortedMapOutput{Unknown: true}, 10),
+		op(1, mapPut("b", "2"), 0, SortedMapOutput{}, 10),
+		op(2, mapRange("a", "z"), 20, entries("b", "2"), 30),
+	}
+	if !porcupine.CheckOperations(SortedMap(), ops) {
+		t.Fatal("expected operations to be linearizable")
+	}
+	ops = append(ops, op(2, mapRange("a", "z"), 40, entries("a", "1", "b", "2"), 50))
+	if porcupine.CheckOperations(SortedMap(), ops) {
+		t.Fatal("expected operations not to be linearizable")
+	}
+	ops[0].Output = nil
+	ops[0].Return = 1000
+	if !porcupine.CheckOperations(SortedMap(), ops) {
+		t.Fatal("expected operations to be linearizable")
+	}
+}
+
+func TestSortedMapPartition(t *testing.T) {
+	ops := []porcupine.Operation{
+		op(0, mapPut("m", "1"), 0, SortedMapOutput{}, 10),
+		op(0, mapPut("a", "1"), 0, SortedMapOutput{}, 10),
+		op(0, mapRange("c", "f"), 0, entries(), 10),
+		op(0, mapPut("e", "1"), 0, SortedMapOutput{}, 10),
+		op(0, mapPut("f", "1"), 0, SortedMapOutput{}, 10),
+		op(0, mapRange("x", "x"), 0, entries(), 10),
+		op(0, mapRange("g", "k"), 0, entries(), 10),
+		op(0, mapGet("k"), 0, SortedMapOutput{}, 10),
+		op(0, mapRange("j", "n"), 0, entries(), 10),
+	}
+	var groups [][]string
+	for _, partition := range SortedMap().Partition(ops) {
+		var keys []string
+		for _, o := range partition {
+			keys = append(keys, o.Input.(SortedMapInput).Key)
+		}
+		groups = append(groups, keys)
+	}
+	expected := [][]string{{"a"}, {"c", "e"}, {"f"}, {"m", "g", "k", "j"}, {"x"}}
+	if len(groups) != len(expected) {
+		t.Fatalf("expected partitions %v, got %v", expected, groups)
+	}
+	for i := range groups {
+		if len(groups[i]) != len(expected[i]) {
+			t.Fatalf("expected partitions %v, got %v", expected, groups)
+		}
+		for j := range groups[i] {
+			if groups[i][j] != expected[i][j] {
+				t.Fatalf("expected partitions %v, got %v", expected, groups)
+			}
+		}
+	}
+
+	// an unbounded range joins everything after it
+	ops = append(ops, op(0, mapRange("b", ""), 0, entries(), 10))
+	if n := len(SortedMap().Partition(ops)); n != 3 {
+		t.Fatalf("expected 3 partitions, got %d", n)
+	}
+}
+
+// sortedMapHistory generates a linearizable history of a sorted map with keys
+// "a" to "h", by executing each operation atomically at a random point
+// between its call and its return.
+func sortedMapHistory(rng *rand.Rand, clients, length int) []porcupine.Operation {
+	keys := "abcdefgh"
+	key := func() string {
+		return string(keys[rng.Intn(len(keys))])
+	}
+	type point struct {
+		at int64
+		op int
+	}
+	var ops []porcupine.Operation
+	var points []point
+	for c := 0; c < clients; c++ {
+		var now int64
+		for i := 0; i < length; i++ {
+			call := now + rng.Int63n(10)
+			ret := call + 1 + rng.Int63n(30)
+			now = ret
+			var input SortedMapInput
+			switch rng.Intn(4) {
+			case 0:
+				input = mapPut(key(), string(rune('0'+len(ops)%10)))
+			case 1:
+				input = mapDelete(key())
+			case 2:
+				input = mapGet(key())
+			case 3:
+				// short ranges, so that there are several partitions
+				lo := key()
+				input = mapRange(lo, string(lo[0]+byte(rng.Intn(3))))
+			}
+			points = append(points, point{call + rng.Int63n(ret-call), len(ops)})
+			ops = append(ops, op(c, input, call, SortedMapOutput{}, ret))
+		}
+	}
+	sort.Slice(points, func(i, j int) bool {
+		return points[i].at < points[j].at
+	})
+	state := sortedMapState{}
+	for _, p := range points {
+		inp := ops[p.op].Input.(SortedMapInput)
+		switch inp.Op {
+		case SortedMapPut:
+			state = state.put(inp.Key, inp.Value)
+		case SortedMapDelete:
+			state = state.delete(inp.Key)
+		case SortedMapGet:
+			if i, found := state.find(inp.Key); found {
+				ops[p.op].Output = SortedMapOutput{Value: state[i].Value, Found: true}
+			}
+		case SortedMapRange:
+			ops[p.op].Output = SortedMapOutput{Entries: append([]SortedMapEntry{}, state.span(inp.Key, inp.End)...)}
+		}
+	}
+	return ops
+}
+
+// TestSortedMapPartitionSound checks that partitioning doesn't change the
+// verdict on random histories, some of which are made non-linearizable.
+func TestSortedMapPartitionSound(t *testing.T) {
+	rng := rand.New(rand.NewSource(1))
+	unpartitioned := SortedMap()
+	unpartitioned.Partition = nil
+	unpartitioned.PartitionEvent = nil
+	bad := 0
+	for i := 0; i < 50; i++ {
+		ops := sortedMapHistory(rng, 3, 10)
+		if i%2 == 1 {
+			// break a random get
+			for _, j := range rng.Perm(len(ops)) {
+				if ops[j].Input.(SortedMapInput).Op == SortedMapGet {
+					out := ops[j].Output.(SortedMapOutput)
+					ops[j].Output = SortedMapOutput{Value: "x", Found: !out.Found}
+					break
+				}
+			}
+		}
+		expected := porcupine.CheckOperations(unpartitioned, ops)
+		if !expected {
+			bad++
+		}
+		if res := porcupine.CheckOperations(SortedMap(), ops); res != expected {
+			t.Fatalf("history %d: expected output %t with partitioning, got %t", i, expected, res)
+		}
+		events := porcupine.OperationsToEvents(ops)
+		if res := porcupine.CheckEvents(SortedMap(), events); res != expected {
+			t.Fatalf("history %d: expected output %t with partitioning events, got %t", i, expected, res)
+		}
+	}
+	if bad == 0 {
+		t.Fatal("expected some histories not to be linearizable")
+	}
+}
+
+func TestSortedMapDescribe(t *testing.T) {
+	model := SortedMap()
+	descriptions := []struct {
+		input  SortedMapInput
+		output interface{}
+		desc   string
+	}{
+		{mapPut("a", "1"), SortedMapOutput{}, "put('a', '1')"},
+		{mapDelete("a"), nil, "delete('a') -> unknown"},
+		{mapGet("a"), SortedMapOutput{}, "get('a') -> not found"},
+		{mapGet("a"), SortedMapOutput{Value: "1", Found: true}, "get('a') -> '1'"},
+		{mapRange("a", "c"), entries("a", "1", "b", "2"), "range('a', 'c') -> {'a': '1', 'b': '2'}"},
+		{mapRange("a", ""), nil, "range('a', ∞) -> ?"},
+	}
+	for _, d := range descriptions {
+		if desc := model.DescribeOperation(d.input, d.output); desc != d.desc {
+			t.Errorf("expected %q, got %q", d.desc, desc)
+		}
+	}
+}
@@ -0,0 +1,262 @@
+package models
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/anishathalye/porcupine"
+)
+
+// A TxnCompareOp is the kind of a comparison in the guard of a transaction
+// of the [Txn] model.
+type TxnCompareOp int
+
+const (
+	TxnEqual TxnCompareOp = iota
+	TxnNotEqual
+	TxnLess
+	TxnGreater
+	// TxnMissing holds if the key doesn't exist, like a comparison of its
+	// version with 0 in etcd.
+	TxnMissing
+)
+
+// A TxnCompare is a comparison of the value of a key with Value, which
+// doesn't hold if the key doesn't exist, except for TxnMissing. Values are
+// compared as strings.
+type TxnCompare struct {
+	Op    TxnCompareOp
+	Key   string
+	Value string
+}
+
+// A TxnOpType is the kind of an operation in a transaction of the [Txn]
+// model.
+type TxnOpType int
+
+const (
+	TxnGet TxnOpType = iota
+	TxnPut
+	TxnDelete
+)
+
+// A TxnOp is an operation in a transaction of the [Txn] model.
+type TxnOp struct {
+	Type  TxnOpType
+	Key   string
+	Value string // for puts
+}
+
+// TxnInput is the input of an operation of the [Txn] model: a transaction
+// that applies the operations of Then if all of Compares hold, and those of
+// Else otherwise.
+type TxnInput struct {
+	Compares []TxnCompare
+	Then     []TxnOp
+	Else     []TxnOp
+}
+
+// A TxnResult is the result of an operation in a transaction of the [Txn]
+// model.
+type TxnResult struct {
+	Value string // for gets that found the key
+	Found bool   // for gets
+}
+
+// TxnOutput is the output of an operation of the [Txn] model.
+type TxnOutput struct {
+	// Succeeded is set if the compares held, so that the operations of
+	// Then were applied.
+	Succeeded bool
+	// Results has a result for each operation of the branch that was
+	// applied, in order, of which only those of gets are checked.
+	Results []TxnResult
+	// Unknown is set if the outcome of the transaction is unknown: a
+	// transaction that timed out may or may not have taken effect.
+	Unknown bool
+}
+
+// txnOutput returns the output of an operation, with a nil output, from an
+// operation that never returned, treated as an unknown outcome.
+func txnOutput(output interface{}) TxnOutput {
+	if output == nil {
+		return TxnOutput{Unknown: true}
+	}
+	return output.(TxnOutput)
+}
+
+func (c TxnCompare) holds(st sortedMapState) bool {
+	i, found := st.find(c.Key)
+	if c.Op == TxnMissing {
+		return !found
+	}
+	if !found {
+		return false
+	}
+	switch c.Op {
+	case TxnEqual:
+		return st[i].Value == c.Value
+	case TxnNotEqual:
+		return st[i].Value != c.Value
+	case TxnLess:
+		return st[i].Value < c.Value
+	case TxnGreater:
+		return st[i].Value > c.Value
+	}
+	return false
+}
+
+// apply applies the operations of a transaction to a keyspace, without
+// modifying st, and returns whether the compares held, the results of the
+// operations, and the new keyspace.
+func (inp TxnInput) apply(st sortedMapState) (bool, []TxnResult, sortedMapState) {
+	succeeded := true
+	for _, c := range inp.Compares {
+		if !c.holds(st) {
+			succeeded = false
+			break
+		}
+	}
+	ops := inp.Else
+	if succeeded {
+		ops = inp.Then
+	}
+	results := make([]TxnResult, len(ops))
+	for i, op := range ops {
+		switch op.Type {
+		case TxnGet:
+			if j, found := st.find(op.Key); found {
+				results[i] = TxnResult{Value: st[j].Value, Found: true}
+			}
+		case TxnPut:
+			st = st.put(op.Key, op.Value)
+		case TxnDelete:
+			st = st.delete(op.Key)
+		}
+	}
+	return succeeded, results, st
+}
+
+func (c TxnCompare) String() string {
+	switch c.Op {
+	case TxnEqual:
+		return fmt.Sprintf("'%s' = '%s'", c.Key, c.Value)
+	case TxnNotEqual:
+		return fmt.Sprintf("'%s' != '%s'", c.Key, c.Value)
+	case TxnLess:
+		return fmt.Sprintf("'%s' < '%s'", c.Key, c.Value)
+	case TxnGreater:
+		return fmt.Sprintf("'%s' > '%s'", c.Key, c.Value)
+	case TxnMissing:
+		return fmt.Sprintf("'%s' missing", c.Key)
+	}
+	return "<invalid>"
+}
+
+func (op TxnOp) String() string {
+	switch op.Type {
+	case TxnGet:
+		return fmt.Sprintf("get('%s')", op.Key)
+	case TxnPut:
+		return fmt.Sprintf("put('%s', '%s')", op.Key, op.Value)
+	case TxnDelete:
+		return fmt.Sprintf("delete('%s')", op.Key)
+	}
+	return "<invalid>"
+}
+
+func describeTxnOps(ops []TxnOp) string {
+	descriptions := make([]string, len(ops))
+	for i, op := range ops {
+		descriptions[i] = op.String()
+	}
+	return fmt.Sprintf("{%s}", strings.Join(descriptions, ", "))
+}
+
+var txn = porcupine.NondeterministicModel{
+	Init: func() []interface{} {
+		return []interface{}{sortedMapState{}}
+	},
+	Step: func(state, input, output interface{}) []interface{} {
+		inp := input.(TxnInput)
+		out := txnOutput(output)
+		st := state.(sortedMapState)
+		succeeded, results, next := inp.apply(st)
+		if out.Unknown {
+			return []interface{}{st, next}
+		}
+		if out.Succeeded != succeeded || len(out.Results) != len(results) {
+			return nil
+		}
+		ops := inp.Else
+		if succeeded {
+			ops = inp.Then
+		}
+		for i, op := range ops {
+			if op.Type == TxnGet && out.Results[i] != results[i] {
+				return nil
+			}
+		}
+		return []interface{}{next}
+	},
+	Equal: func(state1, state2 interface{}) bool {
+		return equalEntries(state1.(sortedMapState), state2.(sortedMapState))
+	},
+	DescribeOperation: func(input, output interface{}) string {
+		inp := input.(TxnInput)
+		out := txnOutput(output)
+		compares := make([]string, len(inp.Compares))
+		for i, c := range inp.Compares {
+			compares[i] = c.String()
+		}
+		desc := fmt.Sprintf("txn(if {%s} then %s else %s)", strings.Join(compares, ", "), describeTxnOps(inp.Then), describeTxnOps(inp.Else))
+		if out.Unknown {
+			return desc + " -> unknown"
+		}
+		branch, ops := "else", inp.Else
+		if out.Succeeded {
+			branch, ops = "then", inp.Then
+		}
+		var reads []string
+		for i, op := range ops {
+			if op.Type != TxnGet || i >= len(out.Results) {
+				continue
+			}
+			if out.Results[i].Found {
+				reads = append(reads, fmt.Sprintf("'%s'", out.Results[i].Value))
+			} else {
+				reads = append(reads, "not found")
+			}
+		}
+		if len(reads) == 0 {
+			return fmt.Sprintf("%s -> %s", desc, branch)
+		}
+		return fmt.Sprintf("%s -> %s [%s]", desc, branch, strings.Join(reads, ", "))
+	},
+	DescribeState:  describeSortedMapState,
+	DescribeStates: describeStates(describeSortedMapState),
+}
+
+// Txn returns a model of a key-value store with mini-transactions, like
+// etcd's Txn: a transaction atomically evaluates a list of compares against
+// the store and applies one of two lists of gets, puts, and deletes,
+// depending on whether they all held. The inputs of its operations are
+// [TxnInput] values, and the outputs are [TxnOutput] values, which say which
+// branch was applied and what its gets returned. Operations within a branch
+// see the effects of those before them.
+//
+// Since a transaction may involve any number of keys, the model can't
+// partition histories, so the whole history is checked at once, which is
+// only practical for a small keyspace and short histories: at most a few
+// thousand transactions, with low concurrency. When possible, split the
+// keyspace into groups that no transaction spans, and check a history for
+// each group separately. Its states are the contents of the store, sorted by
+// key, which are cheap to compare, and copied only by transactions that
+// modify them.
+//
+// Transactions with an unknown outcome make the model nondeterministic, so
+// its states are sets of possible stores, as for models converted with
+// [porcupine.NondeterministicModel.ToModel].
+func Txn() porcupine.Model {
+	return txn.ToModel()
+}
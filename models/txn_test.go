@@ -0,0 +1,153 @@
+package models
+
+import (
+	"testing"
+
+	"github.com/anishathalye/porcupine"
+)
+
+func txnPut(key, value string) TxnOp {
+	return TxnOp{Type: TxnPut, Key: key, Value: value}
+}
+
+func txnGet(key string) TxnOp {
+	return TxnOp{Type: TxnGet, Key: key}
+}
+
+func found(value string) TxnResult {
+	return TxnResult{Value: value, Found: true}
+}
+
+func TestTxn(t *testing.T) {
+	// compare-and-swaps on x, and a transaction that creates y only if it's
+	// missing
+	ops := []porcupine.Operation{
+		op(0, TxnInput{Then: []TxnOp{txnPut("x", "a")}}, 0, TxnOutput{Succeeded: true, Results: []TxnResult{{}}}, 10),
+		op(1, TxnInput{
+			Compares: []TxnCompare{{Op: TxnEqual, Key: "x", Value: "a"}},
+			Then:     []TxnOp{txnPut("x", "b"), txnGet("x")},
+			Else:     []TxnOp{txnGet("x")},
+		}, 20, TxnOutput{Succeeded: true, Results: []TxnResult{{}, found("b")}}, 30),
+		op(2, TxnInput{
+			Compares: []TxnCompare{{Op: TxnEqual, Key: "x", Value: "a"}},
+			Then:     []TxnOp{txnPut("x", "c")},
+			Else:     []TxnOp{txnGet("x")},
+		}, 25, TxnOutput{Results: []TxnResult{found("b")}}, 35),
+		op(0, TxnInput{
+			Compares: []TxnCompare{{Op: TxnMissing, Key: "y"}, {Op: TxnGreater, Key: "x", Value: "a"}},
+			Then:     []TxnOp{txnPut("y", "x"), {Type: TxnDelete, Key: "x"}},
+			Else:     []TxnOp{txnGet("y")},
+		}, 40, TxnOutput{Succeeded: true, Results: make([]TxnResult, 2)}, 50),
+		op(1, TxnInput{Then: []TxnOp{txnGet("x"), txnGet("y")}}, 60, TxnOutput{Succeeded: true, Results: []TxnResult{{}, found("x")}}, 70),
+	}
+	if !porcupine.CheckOperations(Txn(), ops) {
+		t.Fatal("expected operations to be linearizable")
+	}
+
+	// the compare-and-swaps can't both succeed
+	ops[2].Output = TxnOutput{Succeeded: true, Results: make([]TxnResult, 1)}
+	if porcupine.CheckOperations(Txn(), ops) {
+		t.Fatal("expected operations not to be linearizable")
+	}
+	ops[2].Output = TxnOutput{Results: []TxnResult{found("b")}}
+
+	// and a compare of a missing key doesn't hold
+	ops[3].Input = TxnInput{
+		Compares: []TxnCompare{{Op: TxnNotEqual, Key: "y", Value: "a"}},
+		Then:     []TxnOp{txnPut("y", "x")},
+	}
+	ops[3].Output = TxnOutput{Succeeded: true, Results: make([]TxnResult, 1)}
+	if porcupine.CheckOperations(Txn(), ops) {
+		t.Fatal("expected operations not to be linearizable")
+	}
+}
+
+// tornTxnHistory is a history where a transaction moves a token from x to y,
+// and a read-only transaction sees only half of it.
+func tornTxnHistory() []porcupine.Operation {
+	move := TxnInput{
+		Compares: []TxnCompare{{Op: TxnEqual, Key: "x", Value: "token"}},
+		Then:     []TxnOp{{Type: TxnDelete, Key: "x"}, txnPut("y", "token")},
+	}
+	read := TxnInput{Then: []TxnOp{txnGet("x"), txnGet("y")}}
+	return []porcupine.Operation{
+		op(0, TxnInput{Then: []TxnOp{txnPut("x", "token")}}, 0, TxnOutput{Succeeded: true, Results: make([]TxnResult, 1)}, 10),
+		op(0, move, 20, TxnOutput{Succeeded: true, Results: make([]TxnResult, 2)}, 50),
+		op(1, read, 30, TxnOutput{Succeeded: true, Results: []TxnResult{found("token"), found("token")}}, 40),
+		op(2, read, 60, TxnOutput{Succeeded: true, Results: []TxnResult{{}, found("token")}}, 70),
+	}
+}
+
+func TestTxnTorn(t *testing.T) {
+	ops := tornTxnHistory()
+	if porcupine.CheckOperations(Txn(), ops) {
+		t.Fatal("expected operations not to be linearizable")
+	}
+
+	// the read may see the token in either place, but not in both
+	ops[2].Output = TxnOutput{Succeeded: true, Results: []TxnResult{found("token"), {}}}
+	if !porcupine.CheckOperations(Txn(), ops) {
+		t.Fatal("expected operations to be linearizable")
+	}
+	ops[2].Output = TxnOutput{Succeeded: true, Results: []TxnResult{{}, found("token")}}
+	if !porcupine.CheckOperations(Txn(), ops) {
+		t.Fatal("expected operations to be linearizable")
+	}
+	ops[2].Output = TxnOutput{Succeeded: true, Results: []TxnResult{{}, {}}}
+	if porcupine.CheckOperations(Txn(), ops) {
+		t.Fatal("expected operations not to be linearizable")
+	}
+}
+
+func TestTxnUnknown(t *testing.T) {
+	// a transaction that timed out may have taken effect
+	ops := tornTxnHistory()
+	ops[1].Output = nil
+	ops[1].Return = 1000
+	ops[2].Output = TxnOutput{Succeeded: true, Results: []TxnResult{{}, found("token")}}
+	if !porcupine.CheckOperations(Txn(), ops) {
+		t.Fatal("expected operations to be linearizable")
+	}
+
+	// or not
+	ops[2].Output = TxnOutput{Succeeded: true, Results: []TxnResult{found("token"), {}}}
+	ops[3].Output = TxnOutput{Succeeded: true, Results: []TxnResult{found("token"), {}}}
+	if !porcupine.CheckOperations(Txn(), ops) {
+		t.Fatal("expected operations to be linearizable")
+	}
+
+	// but not by halves
+	ops[2].Output = TxnOutput{Succeeded: true, Results: []TxnResult{{}, {}}}
+	if porcupine.CheckOperations(Txn(), ops) {
+		t.Fatal("expected operations not to be linearizable")
+	}
+}
+
+func TestTxnDescribe(t *testing.T) {
+	model := Txn()
+	input := TxnInput{
+		Compares: []TxnCompare{{Op: TxnEqual, Key: "x", Value: "a"}, {Op: TxnMissing, Key: "y"}},
+		Then:     []TxnOp{txnPut("y", "b"), txnGet("x")},
+		Else:     []TxnOp{txnGet("y")},
+	}
+	descriptions := []struct {
+		output interface{}
+		desc   string
+	}{
+		{TxnOutput{Succeeded: true, Results: []TxnResult{{}, found("a")}}, "txn(if {'x' = 'a', 'y' missing} then {put('y', 'b'), get('x')} else {get('y')}) -> then ['a']"},
+		{TxnOutput{Results: []TxnResult{{}}}, "txn(if {'x' = 'a', 'y' missing} then {put('y', 'b'), get('x')} else {get('y')}) -> else [not found]"},
+		{nil, "txn(if {'x' = 'a', 'y' missing} then {put('y', 'b'), get('x')} else {get('y')}) -> unknown"},
+	}
+	for _, d := range descriptions {
+		if desc := model.DescribeOperation(input, d.output); desc != d.desc {
+			t.Errorf("expected %q, got %q", d.desc, desc)
+		}
+	}
+	if desc := model.DescribeOperation(TxnInput{Then: []TxnOp{txnPut("x", "a")}}, TxnOutput{Succeeded: true, Results: []TxnResult{{}}}); desc != "txn(if {} then {put('x', 'a')} else {}) -> then" {
+		t.Errorf("unexpected description %q", desc)
+	}
+	_, state := model.Step(model.Init(), TxnInput{Then: []TxnOp{txnPut("x", "a")}}, nil)
+	if desc := model.DescribeState(state); desc != "one of {{}, {'x': 'a'}}" {
+		t.Errorf("unexpected state %q", desc)
+	}
+}
@@ -0,0 +1,118 @@
+package models
+
+import (
+	"fmt"
+
+	"github.com/anishathalye/porcupine"
+)
+
+// VersionedRegisterOutput is the output of an operation of the
+// [VersionedRegister] model.
+type VersionedRegisterOutput struct {
+	Value    int   // for gets
+	Revision int64 // for puts, the revision they created, and for gets, the revision of the value
+	// Unknown is set if the outcome of the operation is unknown: a put
+	// that timed out may or may not have taken effect, with an unknown
+	// revision, and a get may have returned anything.
+	Unknown bool
+}
+
+// versionedRegisterOutput returns the output of an operation, with a nil
+// output, from an operation that never returned, treated as an unknown
+// outcome.
+func versionedRegisterOutput(output interface{}) VersionedRegisterOutput {
+	if output == nil {
+		return VersionedRegisterOutput{Unknown: true}
+	}
+	return output.(VersionedRegisterOutput)
+}
+
+// A versionedState is the value of a versioned register and its revision. If
+// the value was written by a put with an unknown outcome, the revision isn't
+// known until it's read: it's only known to be greater than Revision.
+type versionedState struct {
+	Value    int
+	Revision int64
+	Exact    bool
+}
+
+// matches returns whether the register can have the given revision.
+func (s versionedState) matches(revision int64) bool {
+	if s.Exact {
+		return revision == s.Revision
+	}
+	return revision > s.Revision
+}
+
+var versionedRegister = porcupine.NondeterministicModel{
+	Init: func() []interface{} {
+		return []interface{}{versionedState{Exact: true}}
+	},
+	Step: func(state, input, output interface{}) []interface{} {
+		inp := input.(RegisterInput)
+		out := versionedRegisterOutput(output)
+		st := state.(versionedState)
+		if inp.Op == RegisterPut {
+			if out.Unknown {
+				return []interface{}{st, versionedState{Value: inp.Value, Revision: st.Revision}}
+			}
+			// revisions increase, whether or not st's is exact
+			if out.Revision <= st.Revision {
+				return nil
+			}
+			return []interface{}{versionedState{Value: inp.Value, Revision: out.Revision, Exact: true}}
+		}
+		if out.Unknown {
+			return []interface{}{st}
+		}
+		if out.Value != st.Value || !st.matches(out.Revision) {
+			return nil
+		}
+		return []interface{}{versionedState{Value: st.Value, Revision: out.Revision, Exact: true}}
+	},
+	DescribeOperation: func(input, output interface{}) string {
+		inp := input.(RegisterInput)
+		out := versionedRegisterOutput(output)
+		if inp.Op == RegisterPut {
+			if out.Unknown {
+				return fmt.Sprintf("put('%d') -> unknown", inp.Value)
+			}
+			return fmt.Sprintf("put('%d') -> @%d", inp.Value, out.Revision)
+		}
+		if out.Unknown {
+			return "get() -> ?"
+		}
+		return fmt.Sprintf("get() -> '%d'@%d", out.Value, out.Revision)
+	},
+	DescribeState:  describeVersionedState,
+	DescribeStates: describeStates(describeVersionedState),
+}
+
+func describeVersionedState(state interface{}) string {
+	st := state.(versionedState)
+	if st.Exact {
+		return fmt.Sprintf("'%d'@%d", st.Value, st.Revision)
+	}
+	return fmt.Sprintf("'%d'@>%d", st.Value, st.Revision)
+}
+
+// VersionedRegister returns a model of a read/write register of integers,
+// initialized to 0 at revision 0, that tracks revisions like etcd: every put
+// creates a new revision, which it returns, and a get returns the value along
+// with the revision of the put that wrote it. The inputs of its operations
+// are [RegisterInput] values, and the outputs are [VersionedRegisterOutput]
+// values.
+//
+// Revisions must increase along the linearization, but need not be
+// consecutive, since a store may share revisions between registers. Checking
+// revisions finds bugs that values alone miss, such as two concurrent puts
+// whose revisions are ordered one way while reads saw them take effect the
+// other way.
+//
+// Puts with an unknown outcome make the model nondeterministic, so its states
+// are sets of possible values and revisions, as for models converted with
+// [porcupine.NondeterministicModel.ToModel]. The revision of such a put is
+// learned from the first get that reads its value.
+func VersionedRegister() porcupine.Model {
+	return versionedRegister.ToModel()
+}
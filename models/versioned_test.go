@@ -0,0 +1,131 @@
+package models
+
+import (
+	"testing"
+
+	"github.com/anishathalye/porcupine"
+)
+
+func wrote(revision int64) VersionedRegisterOutput {
+	return VersionedRegisterOutput{Revision: revision}
+}
+
+func readAt(value int, revision int64) VersionedRegisterOutput {
+	return VersionedRegisterOutput{Value: value, Revision: revision}
+}
+
+func TestVersionedRegister(t *testing.T) {
+	ops := []porcupine.Operation{
+		op(0, put(1), 0, wrote(5), 10),
+		op(1, get, 5, readAt(0, 0), 15),
+		op(1, get, 20, readAt(1, 5), 30),
+		op(0, put(2), 40, wrote(9), 50),
+		op(1, get, 60, readAt(2, 9), 70),
+	}
+	if !porcupine.CheckOperations(VersionedRegister(), ops) {
+		t.Fatal("expected operations to be linearizable")
+	}
+
+	// a get must return the revision of the put it reads
+	ops[2].Output = readAt(1, 6)
+	if porcupine.CheckOperations(VersionedRegister(), ops) {
+		t.Fatal("expected operations not to be linearizable")
+	}
+
+	// revisions must increase
+	ops[2].Output = readAt(1, 5)
+	ops[3].Output = wrote(5)
+	ops[4].Output = readAt(2, 5)
+	if porcupine.CheckOperations(VersionedRegister(), ops) {
+		t.Fatal("expected operations not to be linearizable")
+	}
+}
+
+func TestVersionedRegisterReordering(t *testing.T) {
+	// concurrent puts, and a get after both that reads the first one
+	ops := []porcupine.Operation{
+		op(0, put(1), 0, wrote(5), 10),
+		op(1, put(2), 0, wrote(6), 10),
+		op(2, get, 20, readAt(1, 5), 30),
+	}
+	// the values alone are linearizable, with put(2) before put(1)
+	values := []porcupine.Operation{
+		op(0, put(1), 0, ok, 10),
+		op(1, put(2), 0, ok, 10),
+		op(2, get, 20, read(1), 30),
+	}
+	if !porcupine.CheckOperations(Register(), values) {
+		t.Fatal("expected values to be linearizable")
+	}
+	// but the revisions say that put(1) came first
+	if porcupine.CheckOperations(VersionedRegister(), ops) {
+		t.Fatal("expected operations not to be linearizable")
+	}
+	ops[2].Output = readAt(2, 6)
+	if !porcupine.CheckOperations(VersionedRegister(), ops) {
+		t.Fatal("expected operations to be linearizable")
+	}
+}
+
+func TestVersionedRegisterUnknown(t *testing.T) {
+	// a put with an unknown outcome may not have taken effect
+	ops := []porcupine.Operation{
+		op(0, put(1), 0, wrote(3), 10),
+		op(0, put(2), 20, VersionedRegisterOutput{Unknown: true}, 30),
+		op(1, get, 40, readAt(1, 3), 50),
+	}
+	if !porcupine.CheckOperations(VersionedRegister(), ops) {
+		t.Fatal("expected operations to be linearizable")
+	}
+
+	// or it may have, with any later revision
+	ops[2].Output = readAt(2, 8)
+	if !porcupine.CheckOperations(VersionedRegister(), ops) {
+		t.Fatal("expected operations to be linearizable")
+	}
+
+	// which is then known
+	ops = append(ops,
+		op(1, get, 60, readAt(2, 7), 70),
+	)
+	if porcupine.CheckOperations(VersionedRegister(), ops) {
+		t.Fatal("expected operations not to be linearizable")
+	}
+
+	// but not an earlier one
+	ops = []porcupine.Operation{
+		op(0, put(1), 0, wrote(3), 10),
+		op(0, put(2), 20, nil, 1000),
+		op(1, get, 40, readAt(2, 3), 50),
+	}
+	if porcupine.CheckOperations(VersionedRegister(), ops) {
+		t.Fatal("expected operations not to be linearizable")
+	}
+}
+
+func TestVersionedRegisterDescribe(t *testing.T) {
+	model := VersionedRegister()
+	descriptions := []struct {
+		input  RegisterInput
+		output interface{}
+		desc   string
+	}{
+		{put(1), wrote(5), "put('1') -> @5"},
+		{put(1), nil, "put('1') -> unknown"},
+		{get, readAt(1, 5), "get() -> '1'@5"},
+		{get, VersionedRegisterOutput{Unknown: true}, "get() -> ?"},
+	}
+	for _, d := range descriptions {
+		if desc := model.DescribeOperation(d.input, d.output); desc != d.desc {
+			t.Errorf("expected %q, got %q", d.desc, desc)
+		}
+	}
+	_, state := model.Step(model.Init(), put(1), wrote(5))
+	if desc := model.DescribeState(state); desc != "'1'@5" {
+		t.Errorf("unexpected state %q", desc)
+	}
+	_, state = model.Step(state, put(2), nil)
+	if desc := model.DescribeState(state); desc != "one of {'1'@5, '2'@>5}" {
+		t.Errorf("unexpected state %q", desc)
+	}
+}
@@ -0,0 +1,68 @@
+package modeltest
+
+import "github.com/anishathalye/porcupine"
+
+// CheckOperationsBruteForce checks whether a history is linearizable, like
+// [porcupine.CheckOperations], by enumerating every order of its operations
+// that is consistent with real time, where an operation comes before another
+// if it returned before the other was called, and running each order through
+// the model's Step function from its initial state. Orders are built one
+// operation at a time, and abandoned as soon as the model rejects a
+// prefix, but there is no other cleverness, so it takes time exponential in
+// the number of operations, and it's only practical for histories of up to
+// about a dozen operations.
+//
+// Its purpose is to cross-validate the checker, and models, on small
+// histories: any disagreement between the two is a bug in one of them. If
+// the model has a Partition function, each partition is checked separately,
+// since the model's Step function may only apply to a single partition. The
+// operations of a client are assumed not to overlap, so that real-time order
+// includes the order of each client's operations.
+func CheckOperationsBruteForce(model porcupine.Model, ops []porcupine.Operation) bool {
+	partitions := [][]porcupine.Operation{ops}
+	if model.Partition != nil {
+		partitions = model.Partition(ops)
+	}
+	for _, partition := range partitions {
+		done := make([]bool, len(partition))
+		if !bruteForce(model, partition, done, len(partition), model.Init()) {
+			return false
+		}
+	}
+	return true
+}
+
+// bruteForce returns whether the remaining operations, those that aren't
+// done, can be ordered after those that are, starting from state.
+func bruteForce(model porcupine.Model, ops []porcupine.Operation, done []bool, remaining int, state interface{}) bool {
+	if remaining == 0 {
+		return true
+	}
+	for i, op := range ops {
+		if done[i] || !minimal(ops, done, i) {
+			continue
+		}
+		ok, next := model.Step(state, op.Input, op.Output)
+		if !ok {
+			continue
+		}
+		done[i] = true
+		found := bruteForce(model, ops, done, remaining-1, next)
+		done[i] = false
+		if found {
+			return true
+		}
+	}
+	return false
+}
+
+// minimal returns whether no remaining operation must come before operation
+// i in real time.
+func minimal(ops []porcupine.Operation, done []bool, i int) bool {
+	for j, op := range ops {
+		if !done[j] && op.Return < ops[i].Call {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,100 @@
+package modeltest
+
+import (
+	"math/rand"
+	"testing"
+
+	"github.com/anishathalye/porcupine"
+	"github.com/anishathalye/porcupine/models"
+)
+
+// setExecutor returns an executor for a set of small integers.
+func setExecutor() SequentialExecutor {
+	set := make(map[int]bool)
+	return SequentialExecutor{
+		Inputs: []func(rng *rand.Rand) interface{}{
+			func(rng *rand.Rand) interface{} { return models.SetInput{Op: models.SetAdd, Value: rng.Intn(4)} },
+			func(rng *rand.Rand) interface{} { return models.SetInput{Op: models.SetRead} },
+		},
+		Apply: func(input interface{}) interface{} {
+			inp := input.(models.SetInput)
+			if inp.Op == models.SetAdd {
+				set[inp.Value] = true
+				return models.SetOutput{}
+			}
+			values := []int{}
+			for v := range set {
+				values = append(values, v)
+			}
+			return models.SetOutput{Values: values}
+		},
+	}
+}
+
+func TestCheckOperationsBruteForce(t *testing.T) {
+	ops := []porcupine.Operation{
+		{ClientId: 0, Input: put(1), Call: 0, Output: models.RegisterOutput{}, Return: 10},
+		{ClientId: 1, Input: get, Call: 5, Output: value(1), Return: 15},
+		{ClientId: 2, Input: get, Call: 12, Output: value(0), Return: 20},
+	}
+	if CheckOperationsBruteForce(models.Register(), ops) {
+		t.Fatal("expected operations not to be linearizable")
+	}
+	ops[2].Call = 3
+	if !CheckOperationsBruteForce(models.Register(), ops) {
+		t.Fatal("expected operations to be linearizable")
+	}
+	if !CheckOperationsBruteForce(models.Register(), nil) {
+		t.Fatal("expected an empty history to be linearizable")
+	}
+}
+
+// TestBruteForceAgreement compares the checker with the brute-force checker
+// on many small random histories, half of them mutated, of several models.
+func TestBruteForceAgreement(t *testing.T) {
+	cases := []struct {
+		name   string
+		model  porcupine.Model
+		exec   func() SequentialExecutor
+		mutate func(rng *rand.Rand, input, output interface{}) interface{}
+	}{
+		{"register", models.Register(), registerExecutor, func(rng *rand.Rand, input, output interface{}) interface{} {
+			return models.RegisterOutput{Value: rng.Intn(5)}
+		}},
+		{"kv", models.KV(), kvExecutor, func(rng *rand.Rand, input, output interface{}) interface{} {
+			out := output.(models.KVOutput)
+			out.Value += string(rune('0' + rng.Intn(10)))
+			return out
+		}},
+		{"set", models.Set(), setExecutor, func(rng *rand.Rand, input, output interface{}) interface{} {
+			out := output.(models.SetOutput)
+			values := append([]int{rng.Intn(4)}, out.Values...)
+			return models.SetOutput{Values: values[:rng.Intn(len(values)+1)]}
+		}},
+	}
+	n := 1000
+	if testing.Short() {
+		n = 200
+	}
+	rng := rand.New(rand.NewSource(0))
+	for _, c := range cases {
+		illegal := 0
+		for i := 0; i < n; i++ {
+			cfg := GenConfig{Operations: 1 + rng.Intn(10), Clients: 1 + rng.Intn(4), Concurrency: rng.Intn(4), Pending: 0.1}
+			history := GenerateHistory(rng, cfg, c.exec())
+			if i%2 == 1 {
+				history = MutateHistory(rng, history, 1, c.mutate)
+			}
+			expected := CheckOperationsBruteForce(c.model, history)
+			if res := porcupine.CheckOperations(c.model, history); res != expected {
+				t.Fatalf("%s: checker returned %t, but brute force returned %t on %+v", c.name, res, expected, history)
+			}
+			if !expected {
+				illegal++
+			}
+		}
+		if illegal == 0 {
+			t.Errorf("%s: expected some histories not to be linearizable", c.name)
+		}
+	}
+}
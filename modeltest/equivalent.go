@@ -0,0 +1,141 @@
+package modeltest
+
+import (
+	"fmt"
+	"math/rand"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/anishathalye/porcupine"
+)
+
+// maxShrinkOps is the largest number of operations in a history that
+// [AssertEquivalent] shrinks when the models disagree on it.
+const maxShrinkOps = 64
+
+// AssertEquivalent checks that two formulations of a model, typically one
+// that partitions histories and one that doesn't, agree on whether each of the
+// histories is linearizable, and fails the test for every history they
+// disagree on, reporting its index. Partitioning a model in a way that isn't
+// sound is an easy way to make the checker accept histories that aren't
+// linearizable, and comparing the partitioned model with a straightforward
+// unpartitioned one catches it.
+//
+// Each history is checked with each model with the given timeout, where 0
+// means no timeout, and histories for which either check times out are
+// skipped. For a disagreement on a history of at most a few dozen
+// operations, it also reports a smaller history that the models disagree on,
+// found by removing operations one at a time for as long as the models still
+// disagree.
+func AssertEquivalent(t testing.TB, partitioned, unpartitioned porcupine.Model, histories [][]porcupine.Operation, timeout time.Duration) {
+	t.Helper()
+	for i, history := range histories {
+		r1, r2, ok := disagree(partitioned, unpartitioned, history, timeout)
+		if !ok {
+			continue
+		}
+		msg := fmt.Sprintf("modeltest: history %d of %d operations is %v for the partitioned model but %v for the unpartitioned one", i, len(history), r1, r2)
+		if len(history) <= maxShrinkOps {
+			shrunk := shrinkDisagreement(partitioned, unpartitioned, history, timeout)
+			msg += fmt.Sprintf("; they also disagree on these %d operations:\n%s", len(shrunk), describeOperations(partitioned, shrunk))
+		}
+		t.Errorf("%s", msg)
+	}
+}
+
+// A HistoryGenerator generates random histories for
+// [AssertModelsEquivalent], with [GenerateHistory].
+type HistoryGenerator struct {
+	Config GenConfig
+	// NewExecutor returns the executor to generate a history with; a new
+	// one is needed for every history, since executors keep the state of
+	// their reference implementation.
+	NewExecutor func() SequentialExecutor
+	// Mutators are used to mutate half of the histories, so that they're
+	// likely not linearizable. If nil, [DefaultMutators] are used.
+	Mutators []Mutator
+	// Seed seeds the random generation of histories.
+	Seed int64
+}
+
+// AssertModelsEquivalent checks that two models accept the same histories,
+// such as a model and a refactored version of it: it generates n random
+// histories with gen, half of which are mutated, and fails the test for the
+// first history that the models disagree on, with a history shrunk from it
+// that they still disagree on, like [AssertEquivalent]. Each history is
+// checked with the given timeout, where 0 means no timeout; histories for
+// which a check times out are skipped, and the number of them is logged.
+func AssertModelsEquivalent(t testing.TB, a, b porcupine.Model, gen HistoryGenerator, n int, timeout time.Duration) {
+	t.Helper()
+	mutators := gen.Mutators
+	if mutators == nil {
+		mutators = DefaultMutators()
+	}
+	rng := rand.New(rand.NewSource(gen.Seed))
+	unknown := 0
+	for i := 0; i < n; i++ {
+		history := GenerateHistory(rng, gen.Config, gen.NewExecutor())
+		if i%2 == 1 {
+			history = Mutate(history, mutators, rng)
+		}
+		r1, r2, ok := disagree(a, b, history, timeout)
+		if r1 == porcupine.Unknown || r2 == porcupine.Unknown {
+			unknown++
+			continue
+		}
+		if ok {
+			shrunk := shrinkDisagreement(a, b, history, timeout)
+			t.Errorf("modeltest: history %d of %d operations, generated with seed %d, is %v for the first model but %v for the second one; they also disagree on these %d operations:\n%s", i, len(history), gen.Seed, r1, r2, len(shrunk), describeOperations(a, shrunk))
+			return
+		}
+	}
+	if unknown > 0 {
+		t.Logf("modeltest: %d of %d histories timed out", unknown, n)
+	}
+}
+
+// disagree checks a history with both models, and returns their results and
+// whether they disagree, which they don't if either timed out.
+func disagree(model1, model2 porcupine.Model, history []porcupine.Operation, timeout time.Duration) (porcupine.CheckResult, porcupine.CheckResult, bool) {
+	r1 := porcupine.CheckOperationsTimeout(model1, history, timeout)
+	if r1 == porcupine.Unknown {
+		return r1, r1, false
+	}
+	r2 := porcupine.CheckOperationsTimeout(model2, history, timeout)
+	return r1, r2, r2 != porcupine.Unknown && r1 != r2
+}
+
+// shrinkDisagreement removes operations from a history that two models
+// disagree on, one at a time, as long as they still disagree, until no single
+// operation can be removed.
+func shrinkDisagreement(model1, model2 porcupine.Model, history []porcupine.Operation, timeout time.Duration) []porcupine.Operation {
+	shrunk := append([]porcupine.Operation(nil), history...)
+	for removed := true; removed; {
+		removed = false
+		for i := 0; i < len(shrunk); {
+			candidate := append(append([]porcupine.Operation(nil), shrunk[:i]...), shrunk[i+1:]...)
+			if _, _, ok := disagree(model1, model2, candidate, timeout); ok {
+				shrunk = candidate
+				removed = true
+			} else {
+				i++
+			}
+		}
+	}
+	return shrunk
+}
+
+func describeOperations(model porcupine.Model, ops []porcupine.Operation) string {
+	var b strings.Builder
+	for _, op := range ops {
+		var desc string
+		if model.DescribeOperation != nil {
+			desc = model.DescribeOperation(op.Input, op.Output)
+		} else {
+			desc = porcupine.DescribeValue(op.Input, porcupine.DescribeOptions{}) + " -> " + porcupine.DescribeValue(op.Output, porcupine.DescribeOptions{})
+		}
+		fmt.Fprintf(&b, "\tclient %d, [%d, %d]: %s\n", op.ClientId, op.Call, op.Return, desc)
+	}
+	return b.String()
+}
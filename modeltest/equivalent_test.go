@@ -0,0 +1,127 @@
+package modeltest
+
+import (
+	"math/rand"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/anishathalye/porcupine"
+	"github.com/anishathalye/porcupine/models"
+)
+
+// mapKV is an unpartitioned model of a key-value store, whose states are maps
+// of all of the keys.
+var mapKV = porcupine.Model{
+	Init: func() interface{} { return map[string]string{} },
+	Step: func(state, input, output interface{}) (bool, interface{}) {
+		inp := input.(models.KVInput)
+		st := state.(map[string]string)
+		if inp.Op == models.KVGet {
+			return output.(models.KVOutput).Value == st[inp.Key], st
+		}
+		next := make(map[string]string, len(st))
+		for k, v := range st {
+			next[k] = v
+		}
+		switch inp.Op {
+		case models.KVPut:
+			next[inp.Key] = inp.Value
+		case models.KVAppend:
+			next[inp.Key] += inp.Value
+		case models.KVDelete:
+			delete(next, inp.Key)
+		}
+		return true, next
+	},
+	Equal: func(state1, state2 interface{}) bool {
+		st1, st2 := state1.(map[string]string), state2.(map[string]string)
+		if len(st1) != len(st2) {
+			return false
+		}
+		for k, v := range st1 {
+			if v2, ok := st2[k]; !ok || v != v2 {
+				return false
+			}
+		}
+		return true
+	},
+}
+
+func kvHistories(n int) [][]porcupine.Operation {
+	rng := rand.New(rand.NewSource(0))
+	var histories [][]porcupine.Operation
+	for i := 0; i < n; i++ {
+		history := GenerateHistory(rng, GenConfig{Operations: 30, Clients: 3, Concurrency: 2}, kvExecutor())
+		histories = append(histories, history, MutateHistory(rng, history, 1, func(rng *rand.Rand, input, output interface{}) interface{} {
+			return models.KVOutput{Value: "x"}
+		}))
+	}
+	return histories
+}
+
+func TestAssertEquivalent(t *testing.T) {
+	AssertEquivalent(t, models.KV(), mapKV, kvHistories(10), 0)
+
+	// partitioning by client isn't sound
+	byClient := mapKV
+	byClient.Partition = func(history []porcupine.Operation) [][]porcupine.Operation {
+		partitions := make(map[int][]porcupine.Operation)
+		for _, op := range history {
+			partitions[op.ClientId] = append(partitions[op.ClientId], op)
+		}
+		var result [][]porcupine.Operation
+		for _, p := range partitions {
+			result = append(result, p)
+		}
+		return result
+	}
+	r := &recordingTB{TB: t}
+	AssertEquivalent(r, byClient, mapKV, kvHistories(10), 0)
+	if !r.failed {
+		t.Fatal("expected the models to disagree")
+	}
+	if !strings.Contains(r.logs[0], "history 0 of 30 operations is Illegal for the partitioned model but Ok") {
+		t.Fatalf("unexpected report: %s", r.logs[0])
+	}
+	// the shrunk history is a get of a value written by other clients,
+	// along with the writes
+	if shrunk := strings.Count(r.logs[0], "\tclient "); shrunk < 2 || shrunk > 10 {
+		t.Fatalf("expected the history to be shrunk, got: %s", r.logs[0])
+	}
+}
+
+func TestAssertModelsEquivalent(t *testing.T) {
+	gen := HistoryGenerator{
+		Config:      GenConfig{Operations: 20, Clients: 3, Concurrency: 2},
+		NewExecutor: kvExecutor,
+	}
+	AssertModelsEquivalent(t, models.KV(), mapKV, gen, 20, 0)
+
+	// a refactoring that treats appends as puts
+	broken := mapKV
+	broken.Step = func(state, input, output interface{}) (bool, interface{}) {
+		inp := input.(models.KVInput)
+		if inp.Op == models.KVAppend {
+			inp.Op = models.KVPut
+		}
+		return mapKV.Step(state, inp, output)
+	}
+	r := &recordingTB{TB: t}
+	AssertModelsEquivalent(r, mapKV, broken, gen, 20, 0)
+	if !r.failed || len(r.logs) != 1 || !strings.Contains(r.logs[0], "for the first model but") || !strings.Contains(r.logs[0], "Op:2") {
+		t.Fatalf("expected a disagreement on an append, got %v", r.logs)
+	}
+
+	// timeouts are logged, but aren't failures
+	slow := mapKV
+	slow.Step = func(state, input, output interface{}) (bool, interface{}) {
+		time.Sleep(time.Millisecond)
+		return mapKV.Step(state, input, output)
+	}
+	r = &recordingTB{TB: t}
+	AssertModelsEquivalent(r, slow, mapKV, gen, 2, time.Millisecond)
+	if r.failed || len(r.logs) != 1 || !strings.Contains(r.logs[0], "2 of 2 histories timed out") {
+		t.Fatalf("expected the timeouts to be logged, got %v", r.logs)
+	}
+}
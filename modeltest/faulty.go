@@ -0,0 +1,264 @@
+package modeltest
+
+import (
+	"fmt"
+	"math/rand"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/anishathalye/porcupine"
+	"github.com/anishathalye/porcupine/models"
+)
+
+// A Fault is a kind of consistency bug that a [FaultyStore] injects.
+type Fault string
+
+const (
+	// StaleRead is a get that returns a previous value of its key.
+	StaleRead Fault = "stale read"
+	// LostWrite is a put, append, or delete that is acknowledged but
+	// doesn't take effect.
+	LostWrite Fault = "lost write"
+	// DuplicateAppend is an append that takes effect twice.
+	DuplicateAppend Fault = "duplicate append"
+	// SplitBrain is a window during which the clients with odd ids see
+	// a diverging copy of the store, whose writes are lost when the window
+	// ends.
+	SplitBrain Fault = "split brain"
+)
+
+// FaultConfig configures the faults that a [FaultyStore] injects. Each
+// probability is per operation, and a fault is injected only when it can
+// change the outcome of the operation, such as a stale read of a key that had
+// a different value before.
+type FaultConfig struct {
+	StaleRead       float64 // probability that a get is a stale read
+	LostWrite       float64 // probability that a write is lost
+	DuplicateAppend float64 // probability that an append is duplicated
+	SplitBrain      float64 // probability that a split brain starts, if there isn't one
+	// SplitBrainOps is the number of operations that a split brain lasts.
+	// If 0, it defaults to 10.
+	SplitBrainOps int
+}
+
+// A FaultyStore is an in-process key-value store, with the operations of the
+// [models.KV] model, that injects consistency bugs, to test that a model and
+// the checker catch them. It is safe for concurrent use by multiple
+// goroutines.
+//
+// Alongside the faulty store, it keeps a correct one, to which operations
+// are applied in the same order, to tell whether a fault was visible: whether
+// a get returned a value that differs from the correct one. In a history
+// where no operations are concurrent, such as those that [RunFaulty]
+// records, a visible fault always makes the history not linearizable.
+type FaultyStore struct {
+	cfg      FaultConfig
+	seed     int64
+	mu       sync.Mutex
+	rng      *rand.Rand
+	values   map[string]string
+	past     map[string][]string // the previous values of each key, for stale reads
+	correct  map[string]string   // the values without faults
+	replica  map[string]string   // the values seen by odd clients during a split brain, or nil
+	split    int                 // the number of operations left in the split brain
+	injected map[Fault]int
+	visible  bool
+}
+
+// NewFaultyStore returns an empty faulty store, whose random choices of when
+// to inject faults are seeded with seed.
+func NewFaultyStore(cfg FaultConfig, seed int64) *FaultyStore {
+	if cfg.SplitBrainOps == 0 {
+		cfg.SplitBrainOps = 10
+	}
+	return &FaultyStore{
+		cfg:      cfg,
+		seed:     seed,
+		rng:      rand.New(rand.NewSource(seed)),
+		values:   make(map[string]string),
+		past:     make(map[string][]string),
+		correct:  make(map[string]string),
+		injected: make(map[Fault]int),
+	}
+}
+
+func (s *FaultyStore) inject(fault Fault, p float64) bool {
+	if p > 0 && s.rng.Float64() < p {
+		s.injected[fault]++
+		return true
+	}
+	return false
+}
+
+// Apply executes an operation by a client on the store, and returns its
+// output.
+func (s *FaultyStore) Apply(client int, input models.KVInput) models.KVOutput {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.replica == nil && s.inject(SplitBrain, s.cfg.SplitBrain) {
+		s.replica = make(map[string]string, len(s.values))
+		for k, v := range s.values {
+			s.replica[k] = v
+		}
+		s.split = s.cfg.SplitBrainOps
+	}
+	values := s.values
+	if s.replica != nil {
+		if client%2 == 1 {
+			values = s.replica
+		}
+		s.split--
+		if s.split <= 0 {
+			defer func() { s.replica = nil }()
+		}
+	}
+
+	key := input.Key
+	var output models.KVOutput
+	switch input.Op {
+	case models.KVGet:
+		output.Value = values[key]
+		if output.Value != s.correct[key] {
+			// the split brain is visible already, so a stale read
+			// isn't injected on top of it
+			s.visible = true
+			break
+		}
+		var stale []string
+		for _, v := range s.past[key] {
+			if v != output.Value {
+				stale = append(stale, v)
+			}
+		}
+		if len(stale) > 0 && s.inject(StaleRead, s.cfg.StaleRead) {
+			output.Value = stale[s.rng.Intn(len(stale))]
+		}
+		if output.Value != s.correct[key] {
+			s.visible = true
+		}
+	case models.KVPut, models.KVAppend, models.KVDelete:
+		next := func(v string) string {
+			switch input.Op {
+			case models.KVPut:
+				return input.Value
+			case models.KVAppend:
+				return v + input.Value
+			}
+			return ""
+		}
+		s.correct[key] = next(s.correct[key])
+		if input.Op == models.KVAppend && input.Value != "" && s.inject(DuplicateAppend, s.cfg.DuplicateAppend) {
+			values[key] = next(next(values[key]))
+		} else if next(values[key]) == values[key] || !s.inject(LostWrite, s.cfg.LostWrite) {
+			values[key] = next(values[key])
+		}
+		s.past[key] = append(s.past[key], values[key])
+	}
+	return output
+}
+
+// Injected returns the number of times that each kind of fault was injected.
+func (s *FaultyStore) Injected() map[Fault]int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	injected := make(map[Fault]int, len(s.injected))
+	for f, n := range s.injected {
+		injected[f] = n
+	}
+	return injected
+}
+
+// Visible returns whether a fault was visible: whether a get returned a value
+// that differs from the one a correct store would have returned.
+func (s *FaultyStore) Visible() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.visible
+}
+
+// A FaultyHistory is a history recorded by [RunFaulty], labeled with the
+// faults that were injected while it was recorded.
+type FaultyHistory struct {
+	Operations []porcupine.Operation
+	// Injected is the number of times that each kind of fault was
+	// injected.
+	Injected map[Fault]int
+	// Visible is whether a fault was visible, which means that the
+	// history is not linearizable.
+	Visible bool
+	// StoreSeed and WorkloadSeed are the seeds of the store and of the
+	// workload that recorded the history.
+	StoreSeed    int64
+	WorkloadSeed int64
+}
+
+// String describes the faults that were injected, and the seeds.
+func (h FaultyHistory) String() string {
+	var faults []string
+	for f, n := range h.Injected {
+		faults = append(faults, fmt.Sprintf("%s x%d", f, n))
+	}
+	sort.Strings(faults)
+	if len(faults) == 0 {
+		faults = []string{"no faults"}
+	}
+	visibility := "invisible"
+	if h.Visible {
+		visibility = "visible"
+	}
+	return fmt.Sprintf("%d operations with %s (%s; store seed %d, workload seed %d)", len(h.Operations), strings.Join(faults, ", "), visibility, h.StoreSeed, h.WorkloadSeed)
+}
+
+// RunFaulty runs a workload against a faulty store, like [Run], with inputs
+// chosen by pickInput, and returns the recorded history labeled with the
+// faults that were injected. The clients take turns, so that no operations
+// in the history are concurrent, and the history is linearizable with
+// respect to [models.KV] if and only if no fault was visible.
+func RunFaulty(store *FaultyStore, cfg WorkloadConfig, pickInput func(rng *rand.Rand) models.KVInput) FaultyHistory {
+	recorder := porcupine.NewRecorder()
+	var mu sync.Mutex // held while an operation runs, so clients take turns
+	runClients(cfg, func(client int, rng *rand.Rand) bool {
+		input := pickInput(rng)
+		mu.Lock()
+		defer mu.Unlock()
+		h := recorder.Begin(client, input)
+		h.End(store.Apply(client, input))
+		return true
+	})
+	// the clock may return the same timestamp twice, which would make
+	// consecutive operations concurrent, so ties are broken in the order
+	// in which the operations ran
+	ops := recorder.Operations()
+	last := int64(-1)
+	for i := range ops {
+		if ops[i].Call <= last {
+			ops[i].Call = last + 1
+		}
+		if ops[i].Return <= ops[i].Call {
+			ops[i].Return = ops[i].Call + 1
+		}
+		last = ops[i].Return
+	}
+	return FaultyHistory{
+		Operations:   ops,
+		Injected:     store.Injected(),
+		Visible:      store.Visible(),
+		StoreSeed:    store.seed,
+		WorkloadSeed: cfg.Seed,
+	}
+}
+
+// AssertFaultsDetected fails the test if a faulty history had a visible fault
+// but the model finds it linearizable, or if it had no visible fault but the
+// model finds it not linearizable.
+func AssertFaultsDetected(t testing.TB, model porcupine.Model, h FaultyHistory) {
+	t.Helper()
+	ok := porcupine.CheckOperations(model, h.Operations)
+	if h.Visible && ok {
+		t.Errorf("modeltest: a history with a visible fault is linearizable: %v", h)
+	} else if !h.Visible && !ok {
+		t.Errorf("modeltest: a history without a visible fault is not linearizable: %v", h)
+	}
+}
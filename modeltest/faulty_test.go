@@ -0,0 +1,75 @@
+package modeltest
+
+import (
+	"math/rand"
+	"testing"
+	"time"
+
+	"github.com/anishathalye/porcupine"
+	"github.com/anishathalye/porcupine/models"
+)
+
+func pickKVInput(rng *rand.Rand) models.KVInput {
+	input := models.KVInput{
+		Op:    []models.KVOp{models.KVGet, models.KVGet, models.KVPut, models.KVAppend, models.KVDelete}[rng.Intn(5)],
+		Key:   string(rune('a' + rng.Intn(2))),
+		Value: string(rune('0' + rng.Intn(10))),
+	}
+	if input.Op == models.KVGet || input.Op == models.KVDelete {
+		input.Value = ""
+	}
+	return input
+}
+
+func TestRunFaulty(t *testing.T) {
+	cfg := WorkloadConfig{Duration: 10 * time.Second, MaxOperations: 200, Clients: 4}
+	h := RunFaulty(NewFaultyStore(FaultConfig{}, 0), cfg, pickKVInput)
+	if len(h.Operations) != 200 || len(h.Injected) != 0 || h.Visible {
+		t.Fatalf("expected a history without faults, got %v", h)
+	}
+	AssertFaultsDetected(t, models.KV(), h)
+
+	for _, test := range []struct {
+		fault Fault
+		cfg   FaultConfig
+	}{
+		{StaleRead, FaultConfig{StaleRead: 0.1}},
+		{LostWrite, FaultConfig{LostWrite: 0.1}},
+		{DuplicateAppend, FaultConfig{DuplicateAppend: 0.1}},
+		{SplitBrain, FaultConfig{SplitBrain: 0.05, SplitBrainOps: 20}},
+	} {
+		visible := 0
+		for seed := int64(0); seed < 10; seed++ {
+			cfg.Seed = seed
+			h := RunFaulty(NewFaultyStore(test.cfg, seed), cfg, pickKVInput)
+			if h.Injected[test.fault] == 0 || len(h.Injected) != 1 {
+				t.Fatalf("expected only %s to be injected, got %v", test.fault, h)
+			}
+			if h.Visible {
+				visible++
+			}
+			AssertFaultsDetected(t, models.KV(), h)
+		}
+		if visible == 0 {
+			t.Errorf("expected %s to be visible in some histories", test.fault)
+		}
+	}
+}
+
+func TestAssertFaultsDetected(t *testing.T) {
+	// a history that is labeled as having a visible fault, but is
+	// linearizable
+	h := FaultyHistory{
+		Operations: []porcupine.Operation{
+			{ClientId: 0, Input: models.KVInput{Op: models.KVPut, Key: "a", Value: "1"}, Call: 0, Output: models.KVOutput{}, Return: 10},
+			{ClientId: 1, Input: models.KVInput{Op: models.KVGet, Key: "a"}, Call: 20, Output: models.KVOutput{Value: "1"}, Return: 30},
+		},
+		Injected: map[Fault]int{StaleRead: 1},
+		Visible:  true,
+	}
+	r := &recordingTB{TB: t}
+	AssertFaultsDetected(r, models.KV(), h)
+	if !r.failed {
+		t.Fatal("expected the assertion to fail")
+	}
+}
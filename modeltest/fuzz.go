@@ -0,0 +1,130 @@
+package modeltest
+
+import (
+	"errors"
+	"strings"
+
+	"github.com/anishathalye/porcupine"
+	"github.com/anishathalye/porcupine/models"
+)
+
+// maxKVEvents is the largest number of events that [DecodeKVEvents] decodes.
+const maxKVEvents = 256
+
+// kvDigits are the characters of values in encoded histories.
+const kvDigits = "0123"
+
+var kvOps = []models.KVOp{models.KVGet, models.KVPut, models.KVAppend, models.KVDelete}
+
+// DecodeKVEvents decodes a history of events of the [models.KV] model from a
+// compact encoding, for fuzzing: every two bytes are an event, of up to 8
+// clients, 4 keys, and values of up to 3 characters. Any input decodes into a
+// well-formed history: a call by a client with a pending call, or a return
+// by a client without one, is dropped, and calls that are still pending at
+// the end are completed with a nil output, as operations whose outcome is
+// unknown. It returns an error for inputs of more than 256 events.
+//
+// The first byte of an event is a call if its lowest bit is 0, and a return
+// otherwise; its next 3 bits are the client, and for calls, the 2 bits after
+// that the kind of operation, as a [models.KVOp], and the 2 highest bits the
+// key, from "0" to "3". The second byte is a value, the input of a put or
+// append, or the output of a get: its 2 highest bits are the length, and its
+// lowest 6 bits are up to 3 characters from "0" to "3", 2 bits each.
+func DecodeKVEvents(data []byte) ([]porcupine.Event, error) {
+	if len(data) > 2*maxKVEvents {
+		return nil, errors.New("modeltest: too many events")
+	}
+	var events []porcupine.Event
+	id := 0
+	pending := make(map[int]porcupine.Event) // from client to its pending call
+	for i := 0; i+1 < len(data); i += 2 {
+		b, value := data[i], decodeKVValue(data[i+1])
+		client := int(b>>1) & 7
+		call, ok := pending[client]
+		if b&1 == 0 {
+			if ok {
+				continue
+			}
+			input := models.KVInput{Op: kvOps[(b>>4)&3], Key: string(kvDigits[b>>6])}
+			if input.Op == models.KVPut || input.Op == models.KVAppend {
+				input.Value = value
+			}
+			call = porcupine.Event{ClientId: client, Kind: porcupine.CallEvent, Value: input, Id: id}
+			id++
+			pending[client] = call
+			events = append(events, call)
+			continue
+		}
+		if !ok {
+			continue
+		}
+		var output models.KVOutput
+		if call.Value.(models.KVInput).Op == models.KVGet {
+			output.Value = value
+		}
+		events = append(events, porcupine.Event{ClientId: client, Kind: porcupine.ReturnEvent, Value: output, Id: call.Id})
+		delete(pending, client)
+	}
+	return porcupine.CompletePending(events, func(porcupine.Event) (interface{}, bool) {
+		return nil, true
+	}), nil
+}
+
+func decodeKVValue(b byte) string {
+	var value strings.Builder
+	for i := 0; i < int(b>>6); i++ {
+		value.WriteByte(kvDigits[(b>>(2*i))&3])
+	}
+	return value.String()
+}
+
+// EncodeKVEvents encodes a history of events of the [models.KV] model for
+// [DecodeKVEvents], to seed a fuzz test from an existing history. Since the
+// encoding is compact, the encoded history is only an approximation: clients
+// and keys are numbered in the order in which they first appear, modulo the
+// number that the encoding supports, and values are replaced by codes of up to
+// 3 characters, one for each different value, in the order in which they
+// first appear, modulo 64. Returns with a nil output are left out, so that
+// their operations stay pending.
+func EncodeKVEvents(events []porcupine.Event) []byte {
+	clients := make(map[int]byte)
+	keys := make(map[string]byte)
+	values := make(map[string]byte)
+	code := func(m map[string]byte, s string, n int) byte {
+		if c, ok := m[s]; ok {
+			return c
+		}
+		c := byte(len(m) % n)
+		m[s] = c
+		return c
+	}
+	encodeValue := func(s string) byte {
+		if len(s) <= 3 && strings.Trim(s, kvDigits) == "" {
+			var b byte
+			for i := 0; i < len(s); i++ {
+				b |= byte(strings.IndexByte(kvDigits, s[i])) << (2 * i)
+			}
+			return b | byte(len(s))<<6
+		}
+		return 3<<6 | code(values, s, 64)
+	}
+	var data []byte
+	for _, event := range events {
+		client, ok := clients[event.ClientId]
+		if !ok {
+			client = byte(len(clients) % 8)
+			clients[event.ClientId] = client
+		}
+		if event.Kind == porcupine.CallEvent {
+			input := event.Value.(models.KVInput)
+			key := code(keys, input.Key, 4)
+			data = append(data, client<<1|byte(input.Op)<<4|key<<6, encodeValue(input.Value))
+			continue
+		}
+		if event.Value == nil {
+			continue
+		}
+		data = append(data, client<<1|1, encodeValue(event.Value.(models.KVOutput).Value))
+	}
+	return data
+}
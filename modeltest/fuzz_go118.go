@@ -0,0 +1,63 @@
+//go:build go1.18
+// +build go1.18
+
+package modeltest
+
+import (
+	"testing"
+
+	"github.com/anishathalye/porcupine"
+)
+
+// maxBruteForceOps is the largest number of operations in a history that
+// [FuzzHistory] also checks with [CheckOperationsBruteForce].
+const maxBruteForceOps = 8
+
+// FuzzHistory runs a fuzz test that decodes fuzz inputs into histories of
+// events with decode, and checks them with model. Inputs that decode returns
+// an error for, or that decode into malformed histories, as found by
+// [porcupine.ValidateEvents], are skipped. The test fails if checking a
+// history panics, if checking it twice gives different results, or if the
+// result for a history of at most a few operations disagrees with
+// [CheckOperationsBruteForce].
+//
+// Seeds must be added with f.Add before calling FuzzHistory; for the default
+// decoder, [DecodeKVEvents], seeds can be made from existing histories with
+// [EncodeKVEvents]. FuzzHistory needs Go 1.18 or later, for native fuzzing.
+func FuzzHistory(f *testing.F, model porcupine.Model, decode func([]byte) ([]porcupine.Event, error)) {
+	f.Fuzz(func(t *testing.T, data []byte) {
+		events, err := decode(data)
+		if err != nil {
+			t.Skip(err)
+		}
+		for _, issue := range porcupine.ValidateEvents(events) {
+			if issue.Severity == porcupine.SeverityError {
+				t.Skip(issue)
+			}
+		}
+		res := checkWithoutPanic(t, model, events)
+		if again := checkWithoutPanic(t, model, events); again != res {
+			t.Fatalf("checking the history twice returned %t and then %t: %v", res, again, events)
+		}
+		ops, err := porcupine.EventsToOperations(events)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(ops) > maxBruteForceOps {
+			return
+		}
+		if expected := CheckOperationsBruteForce(model, ops); res != expected {
+			t.Fatalf("checker returned %t, but brute force returned %t: %v", res, expected, events)
+		}
+	})
+}
+
+func checkWithoutPanic(t *testing.T, model porcupine.Model, events []porcupine.Event) (ok bool) {
+	t.Helper()
+	defer func() {
+		if r := recover(); r != nil {
+			t.Fatalf("checking the history panicked: %v: %v", r, events)
+		}
+	}()
+	return porcupine.CheckEvents(model, events)
+}
@@ -0,0 +1,24 @@
+//go:build go1.18
+// +build go1.18
+
+package modeltest
+
+import (
+	"testing"
+
+	"github.com/anishathalye/porcupine/models"
+)
+
+func init() {
+	entryPoints["FuzzHistory"] = entryPoint{FuzzHistory, false}
+}
+
+func FuzzKV(f *testing.F) {
+	for _, name := range []string{"c01-ok", "c01-bad", "c10-ok", "c10-bad"} {
+		events := readKVLog(f, name)
+		for _, n := range []int{8, 16, 64} {
+			f.Add(EncodeKVEvents(events[:n]))
+		}
+	}
+	FuzzHistory(f, models.KV(), DecodeKVEvents)
+}
@@ -0,0 +1,108 @@
+package modeltest
+
+import (
+	"fmt"
+	"os"
+	"testing"
+
+	"github.com/anishathalye/porcupine"
+	"github.com/anishathalye/porcupine/jepsen"
+	"github.com/anishathalye/porcupine/models"
+)
+
+// kvMapper converts the operations of the logs in test_data/kv.
+var kvMapper = jepsen.Mapper{
+	Input: func(invoke jepsen.Op) (interface{}, error) {
+		ops := map[jepsen.Keyword]models.KVOp{"get": models.KVGet, "put": models.KVPut, "append": models.KVAppend}
+		value, _ := invoke.Value.(string)
+		return models.KVInput{Op: ops[invoke.F.(jepsen.Keyword)], Key: invoke.Fields[jepsen.Keyword("key")].(string), Value: value}, nil
+	},
+	Output: func(invoke, complete jepsen.Op) (interface{}, error) {
+		if complete.Type == "info" {
+			return nil, nil
+		}
+		value, _ := complete.Value.(string)
+		if invoke.F != jepsen.Keyword("get") {
+			value = ""
+		}
+		return models.KVOutput{Value: value}, nil
+	},
+}
+
+func readKVLog(t testing.TB, name string) []porcupine.Event {
+	file, err := os.Open(fmt.Sprintf("../test_data/kv/%s.txt", name))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+	events, err := jepsen.ParseEDNHistoryWithMapper(file, kvMapper)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return events
+}
+
+func TestDecodeKVEvents(t *testing.T) {
+	data := []byte{
+		0 | 0<<1 | 1<<4 | 2<<6, 2<<6 | 1 | 3<<2, // client 0 calls put('2', '13')
+		0 | 1<<1 | 0<<4 | 2<<6, 0, // client 1 calls get('2')
+		0 | 0<<1, 0, // client 0 calls again, which is dropped
+		1 | 1<<1, 2<<6 | 1 | 3<<2, // client 1 returns '13'
+		1 | 2<<1, 0, // client 2 returns without a call, which is dropped
+		1, // a trailing byte is ignored
+	}
+	events, err := DecodeKVEvents(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []porcupine.Event{
+		{ClientId: 0, Kind: porcupine.CallEvent, Value: models.KVInput{Op: models.KVPut, Key: "2", Value: "13"}, Id: 0},
+		{ClientId: 1, Kind: porcupine.CallEvent, Value: models.KVInput{Op: models.KVGet, Key: "2"}, Id: 1},
+		{ClientId: 1, Kind: porcupine.ReturnEvent, Value: models.KVOutput{Value: "13"}, Id: 1},
+		{ClientId: 0, Kind: porcupine.ReturnEvent, Value: nil, Id: 0},
+	}
+	if len(events) != len(expected) {
+		t.Fatalf("expected %v, got %v", expected, events)
+	}
+	for i := range expected {
+		if events[i] != expected[i] {
+			t.Fatalf("expected %v, got %v", expected, events)
+		}
+	}
+
+	if _, err := DecodeKVEvents(make([]byte, 2*maxKVEvents+2)); err == nil {
+		t.Fatal("expected an error")
+	}
+}
+
+func TestEncodeKVEvents(t *testing.T) {
+	events := readKVLog(t, "c10-ok")[:64]
+	decoded, err := DecodeKVEvents(EncodeKVEvents(events))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(decoded) == 0 {
+		t.Fatal("expected events")
+	}
+	for _, issue := range porcupine.ValidateEvents(decoded) {
+		if issue.Severity == porcupine.SeverityError {
+			t.Fatalf("decoded history is malformed: %v", issue)
+		}
+	}
+
+	// short values round-trip exactly
+	events = []porcupine.Event{
+		{ClientId: 5, Kind: porcupine.CallEvent, Value: models.KVInput{Op: models.KVAppend, Key: "x", Value: "012"}, Id: 0},
+		{ClientId: 5, Kind: porcupine.ReturnEvent, Value: models.KVOutput{}, Id: 0},
+		{ClientId: 7, Kind: porcupine.CallEvent, Value: models.KVInput{Op: models.KVGet, Key: "y"}, Id: 1},
+		{ClientId: 7, Kind: porcupine.ReturnEvent, Value: models.KVOutput{Value: "3"}, Id: 1},
+	}
+	decoded, err = DecodeKVEvents(EncodeKVEvents(events))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(decoded) != 4 || decoded[0].Value != (models.KVInput{Op: models.KVAppend, Key: "0", Value: "012"}) ||
+		decoded[3].Value != (models.KVOutput{Value: "3"}) || decoded[2].ClientId != 1 {
+		t.Fatalf("unexpected events %v", decoded)
+	}
+}
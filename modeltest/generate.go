@@ -0,0 +1,166 @@
+package modeltest
+
+import (
+	"math/rand"
+
+	"github.com/anishathalye/porcupine"
+)
+
+// A SequentialExecutor generates operations and executes them on a reference
+// implementation of a system, for [GenerateHistory].
+type SequentialExecutor struct {
+	// Inputs are functions that return random inputs, one for each kind
+	// of operation, such as gets and puts.
+	Inputs []func(rng *rand.Rand) interface{}
+	// Apply applies an operation to the reference implementation, which
+	// it may modify, and returns its output.
+	Apply func(input interface{}) interface{}
+}
+
+// GenConfig configures [GenerateHistory].
+type GenConfig struct {
+	// Operations is the number of operations in the history.
+	Operations int
+	// Clients is the number of clients that are active at the same time,
+	// at least 1.
+	Clients int
+	// Mix weights the kinds of operations of the executor, in the order
+	// of its Inputs: each operation is of a kind with a probability
+	// proportional to its weight. If Mix is nil, all kinds are equally
+	// likely.
+	Mix []int
+	// Concurrency is how far the interval of an operation may extend
+	// around the point where it takes effect, in operations on either
+	// side, so that it's concurrent with them. With 0, the history is
+	// sequential.
+	Concurrency int
+	// Pending is the probability that an operation never returns, so
+	// that its output is nil and its return is at the end of the history.
+	// Its client crashes, and is replaced by a client with a new id. A
+	// pending operation may or may not have taken effect.
+	Pending float64
+}
+
+// genSpacing is the time between the points where consecutive operations take
+// effect.
+const genSpacing = 10
+
+// GenerateHistory returns a random history that is linearizable by
+// construction: it executes random operations one at a time on the reference
+// implementation of exec, and then widens each operation's interval around
+// the point where it took effect, without overlapping the operations of the
+// same client. The history is linearizable with respect to any model that
+// agrees with the reference implementation and accepts a nil output as an
+// operation whose outcome is unknown, such as those of the models package;
+// with Pending 0, the model needn't handle nil outputs.
+//
+// Histories that aren't linearizable can be made from generated ones with
+// [MutateHistory].
+func GenerateHistory(rng *rand.Rand, cfg GenConfig, exec SequentialExecutor) []porcupine.Operation {
+	clients := cfg.Clients
+	if clients < 1 {
+		clients = 1
+	}
+	active := make([]int, clients)
+	for i := range active {
+		active[i] = i
+	}
+	nextClient := clients
+	totalWeight := 0
+	for _, w := range cfg.Mix {
+		totalWeight += w
+	}
+
+	history := make([]porcupine.Operation, cfg.Operations)
+	pending := make([]bool, cfg.Operations)
+	for i := range history {
+		kind := rng.Intn(len(exec.Inputs))
+		if totalWeight > 0 {
+			r := rng.Intn(totalWeight)
+			for kind = 0; r >= cfg.Mix[kind]; kind++ {
+				r -= cfg.Mix[kind]
+			}
+		}
+		input := exec.Inputs[kind](rng)
+		slot := rng.Intn(clients)
+		op := porcupine.Operation{ClientId: active[slot], Input: input, Call: int64(i+1) * genSpacing}
+		if rng.Float64() < cfg.Pending {
+			if rng.Intn(2) == 0 {
+				exec.Apply(input)
+			}
+			pending[i] = true
+			active[slot] = nextClient
+			nextClient++
+		} else {
+			op.Output = exec.Apply(input)
+		}
+		history[i] = op
+	}
+
+	// each operation takes effect at its call time, which is now widened
+	// into an interval
+	width := int64(cfg.Concurrency) * genSpacing
+	next := make([]int, len(history)) // the index of the next operation of the same client
+	last := make(map[int]int)         // from client to the index of its last operation seen
+	for i := len(history) - 1; i >= 0; i-- {
+		next[i] = -1
+		if j, ok := last[history[i].ClientId]; ok {
+			next[i] = j
+		}
+		last[history[i].ClientId] = i
+	}
+	lastReturn := make(map[int]int64) // from client to the return of its last operation
+	end := int64(len(history)+1) * genSpacing
+	for i := range history {
+		op := &history[i]
+		point := op.Call
+		op.Call = point - rng.Int63n(width+1)
+		if r, ok := lastReturn[op.ClientId]; ok && op.Call <= r {
+			op.Call = r + 1
+		}
+		if op.Call < 0 {
+			op.Call = 0
+		}
+		if pending[i] {
+			op.Return = end + width
+			continue
+		}
+		op.Return = point + rng.Int63n(width+1)
+		if j := next[i]; j >= 0 && op.Return >= int64(j+1)*genSpacing {
+			op.Return = int64(j+1)*genSpacing - 1
+		}
+		lastReturn[op.ClientId] = op.Return
+	}
+	return history
+}
+
+// MutateHistory returns a copy of a history where the outputs of count random
+// operations that returned are replaced by the outputs that mutate returns
+// for them, which should differ from the original ones.
+//
+// A mutated history is often not linearizable, but it may be, for example if
+// the mutated output is one that a different linearization of concurrent
+// operations could produce. The result of checking it must be compared with
+// an independent verdict, such as that of [TestSequential] on the operations
+// of a history generated with Concurrency 0 and Pending 0, which is
+// linearizable if and only if they're legal in order.
+func MutateHistory(rng *rand.Rand, history []porcupine.Operation, count int, mutate func(rng *rand.Rand, input, output interface{}) interface{}) []porcupine.Operation {
+	mutated := make([]porcupine.Operation, len(history))
+	copy(mutated, history)
+	var returned []int
+	for i, op := range history {
+		if op.Output != nil {
+			returned = append(returned, i)
+		}
+	}
+	rng.Shuffle(len(returned), func(i, j int) {
+		returned[i], returned[j] = returned[j], returned[i]
+	})
+	if count > len(returned) {
+		count = len(returned)
+	}
+	for _, i := range returned[:count] {
+		mutated[i].Output = mutate(rng, mutated[i].Input, mutated[i].Output)
+	}
+	return mutated
+}
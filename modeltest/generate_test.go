@@ -0,0 +1,151 @@
+package modeltest
+
+import (
+	"math/rand"
+	"testing"
+
+	"github.com/anishathalye/porcupine"
+	"github.com/anishathalye/porcupine/models"
+)
+
+// registerExecutor returns an executor for a register of integers, with puts
+// and gets.
+func registerExecutor() SequentialExecutor {
+	value := 0
+	return SequentialExecutor{
+		Inputs: []func(rng *rand.Rand) interface{}{
+			func(rng *rand.Rand) interface{} { return put(rng.Intn(5)) },
+			func(rng *rand.Rand) interface{} { return get },
+		},
+		Apply: func(input interface{}) interface{} {
+			inp := input.(models.RegisterInput)
+			if inp.Op == models.RegisterPut {
+				value = inp.Value
+				return models.RegisterOutput{}
+			}
+			return models.RegisterOutput{Value: value}
+		},
+	}
+}
+
+// kvExecutor returns an executor for a key-value store with a few keys.
+func kvExecutor() SequentialExecutor {
+	store := make(map[string]string)
+	key := func(rng *rand.Rand) string {
+		return string(rune('a' + rng.Intn(3)))
+	}
+	value := func(rng *rand.Rand) string {
+		return string(rune('0' + rng.Intn(10)))
+	}
+	return SequentialExecutor{
+		Inputs: []func(rng *rand.Rand) interface{}{
+			func(rng *rand.Rand) interface{} { return models.KVInput{Op: models.KVGet, Key: key(rng)} },
+			func(rng *rand.Rand) interface{} {
+				return models.KVInput{Op: models.KVPut, Key: key(rng), Value: value(rng)}
+			},
+			func(rng *rand.Rand) interface{} {
+				return models.KVInput{Op: models.KVAppend, Key: key(rng), Value: value(rng)}
+			},
+			func(rng *rand.Rand) interface{} { return models.KVInput{Op: models.KVDelete, Key: key(rng)} },
+		},
+		Apply: func(input interface{}) interface{} {
+			inp := input.(models.KVInput)
+			switch inp.Op {
+			case models.KVGet:
+				return models.KVOutput{Value: store[inp.Key]}
+			case models.KVPut:
+				store[inp.Key] = inp.Value
+			case models.KVAppend:
+				store[inp.Key] += inp.Value
+			case models.KVDelete:
+				delete(store, inp.Key)
+			}
+			return models.KVOutput{}
+		},
+	}
+}
+
+func TestGenerateHistory(t *testing.T) {
+	rng := rand.New(rand.NewSource(0))
+	for i := 0; i < 50; i++ {
+		cfg := GenConfig{Operations: 40, Clients: 4, Concurrency: 3, Pending: 0.1}
+		history := GenerateHistory(rng, cfg, registerExecutor())
+		for _, issue := range porcupine.ValidateHistory(history) {
+			if issue.Severity > porcupine.SeverityInfo {
+				t.Fatalf("generated history is malformed: %v", issue)
+			}
+		}
+		if porcupine.MaxConcurrency(history) < 2 {
+			t.Fatalf("expected generated history %d to be concurrent", i)
+		}
+		if !porcupine.CheckOperations(models.Register(), history) {
+			t.Fatalf("expected generated history %d to be linearizable", i)
+		}
+	}
+	for i := 0; i < 20; i++ {
+		cfg := GenConfig{Operations: 300, Clients: 8, Mix: []int{4, 2, 2, 1}, Concurrency: 4, Pending: 0.02}
+		history := GenerateHistory(rng, cfg, kvExecutor())
+		if !porcupine.CheckOperations(models.KV(), history) {
+			t.Fatalf("expected generated history %d to be linearizable", i)
+		}
+	}
+}
+
+func TestGenerateHistoryConfig(t *testing.T) {
+	rng := rand.New(rand.NewSource(0))
+	history := GenerateHistory(rng, GenConfig{Operations: 100, Clients: 3}, registerExecutor())
+	if len(history) != 100 {
+		t.Fatalf("expected 100 operations, got %d", len(history))
+	}
+	for i := 1; i < len(history); i++ {
+		if history[i].Call <= history[i-1].Return {
+			t.Fatal("expected a sequential history")
+		}
+	}
+
+	// only puts
+	history = GenerateHistory(rng, GenConfig{Operations: 100, Mix: []int{1, 0}}, registerExecutor())
+	for _, op := range history {
+		if op.Input.(models.RegisterInput).Op != models.RegisterPut {
+			t.Fatalf("unexpected operation %v", op.Input)
+		}
+	}
+
+	// every operation is pending, from a new client
+	history = GenerateHistory(rng, GenConfig{Operations: 10, Clients: 2, Pending: 1}, registerExecutor())
+	clients := make(map[int]bool)
+	for _, op := range history {
+		if op.Output != nil || clients[op.ClientId] {
+			t.Fatalf("unexpected operation %+v", op)
+		}
+		clients[op.ClientId] = true
+	}
+}
+
+func TestMutateHistory(t *testing.T) {
+	rng := rand.New(rand.NewSource(0))
+	mutate := func(rng *rand.Rand, input, output interface{}) interface{} {
+		out := output.(models.RegisterOutput)
+		out.Value += 1 + rng.Intn(2)
+		return out
+	}
+	illegal := 0
+	for i := 0; i < 50; i++ {
+		history := GenerateHistory(rng, GenConfig{Operations: 20, Clients: 2}, registerExecutor())
+		mutated := MutateHistory(rng, history, 1, mutate)
+		trace := make([]SequentialOp, len(mutated))
+		for j, op := range mutated {
+			trace[j] = SequentialOp{Input: op.Input, Output: op.Output, Legal: true}
+		}
+		expected := TestSequential(models.Register(), trace) == nil
+		if res := porcupine.CheckOperations(models.Register(), mutated); res != expected {
+			t.Fatalf("expected output %t, got output %t", expected, res)
+		}
+		if !expected {
+			illegal++
+		}
+	}
+	if illegal == 0 {
+		t.Fatal("expected some mutated histories not to be linearizable")
+	}
+}
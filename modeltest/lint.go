@@ -0,0 +1,214 @@
+package modeltest
+
+import (
+	"fmt"
+	"reflect"
+
+	"github.com/anishathalye/porcupine"
+)
+
+// A LintIssue is a problem with a model found by [Lint].
+type LintIssue struct {
+	// Property is the property of models that is violated, such as
+	// "equal-reflexive".
+	Property string
+	// Index is the index of the sample operation that triggered the
+	// issue, or -1 if none did.
+	Index   int
+	Message string
+}
+
+func (i LintIssue) String() string {
+	if i.Index < 0 {
+		return fmt.Sprintf("%s: %s", i.Property, i.Message)
+	}
+	return fmt.Sprintf("%s: %d: %s", i.Property, i.Index, i.Message)
+}
+
+// maxLintStates is the largest number of states that [Lint] explores.
+const maxLintStates = 64
+
+// Lint looks for common mistakes in a model, by exercising it with sample
+// operations: it applies each of them, in order, to the initial state and to
+// every state reached by the samples before it, up to a limit, and reports:
+//
+//   - Init returning states that aren't Equal, or that share a pointer, map,
+//     or slice, which the checker may use for several partitions at once
+//     (init-equal, init-fresh)
+//   - Equal not being reflexive, as with a NaN in a state, or symmetric, or
+//     panicking, as == does for states that are maps or slices when Equal
+//     is nil (equal-reflexive, equal-symmetric, equal-panics)
+//   - Step giving different results for the same state, input, and output
+//     (step-deterministic)
+//   - Step modifying the state it's given, which is detected by comparing
+//     the state with one reached again by the same operations
+//     (step-mutates-state)
+//   - Step, DescribeOperation, or DescribeState panicking (step-panics,
+//     describe-operation-panics, describe-state-panics)
+//
+// Each property is reported at most once for each sample operation. The
+// issues are ordered by the order in which they were found.
+func Lint(model porcupine.Model, samples []porcupine.Operation) []LintIssue {
+	l := &linter{model: model, samples: samples, seen: make(map[LintIssue]bool)}
+	l.lint()
+	return l.issues
+}
+
+type linter struct {
+	model   porcupine.Model
+	samples []porcupine.Operation
+	issues  []LintIssue
+	seen    map[LintIssue]bool // properties reported, by property and index
+}
+
+// reached is a state reached by a path of sample operations from the initial
+// state.
+type reached struct {
+	state interface{}
+	path  []int
+}
+
+func (l *linter) report(property string, index int, format string, args ...interface{}) {
+	key := LintIssue{Property: property, Index: index}
+	if l.seen[key] {
+		return
+	}
+	l.seen[key] = true
+	l.issues = append(l.issues, LintIssue{Property: property, Index: index, Message: fmt.Sprintf(format, args...)})
+}
+
+// describe describes a sample operation, without calling the model.
+func (l *linter) describe(i int) string {
+	return fmt.Sprintf("input %v, output %v", l.samples[i].Input, l.samples[i].Output)
+}
+
+// equal compares two states, reporting a panic, in which case they're
+// considered equal, so that other properties aren't reported because of it.
+func (l *linter) equal(state1, state2 interface{}, index int) (eq bool) {
+	defer func() {
+		if r := recover(); r != nil {
+			l.report("equal-panics", index, "Equal panicked: %v", r)
+			eq = true
+		}
+	}()
+	if l.model.Equal == nil {
+		return state1 == state2
+	}
+	return l.model.Equal(state1, state2)
+}
+
+// step applies a sample operation to a state, reporting a panic.
+func (l *linter) step(state interface{}, index int) (ok bool, next interface{}, panicked bool) {
+	defer func() {
+		if r := recover(); r != nil {
+			l.report("step-panics", index, "Step panicked with %s: %v", l.describe(index), r)
+			panicked = true
+		}
+	}()
+	op := l.samples[index]
+	ok, next = l.model.Step(state, op.Input, op.Output)
+	return ok, next, false
+}
+
+// replay returns the state reached by a path of sample operations from a new
+// initial state.
+func (l *linter) replay(path []int) interface{} {
+	state := l.model.Init()
+	for _, i := range path {
+		_, state, _ = l.step(state, i)
+	}
+	return state
+}
+
+// shared returns whether two values share a pointer, map, or slice.
+func shared(v1, v2 interface{}) bool {
+	r1, r2 := reflect.ValueOf(v1), reflect.ValueOf(v2)
+	if !r1.IsValid() || !r2.IsValid() || r1.Kind() != r2.Kind() {
+		return false
+	}
+	switch r1.Kind() {
+	case reflect.Ptr, reflect.Map, reflect.Chan:
+		return !r1.IsNil() && r1.Pointer() == r2.Pointer()
+	case reflect.Slice:
+		return r1.Cap() > 0 && r1.Pointer() == r2.Pointer()
+	}
+	return false
+}
+
+func (l *linter) lint() {
+	init1, init2 := l.model.Init(), l.model.Init()
+	if !l.equal(init1, init2, -1) {
+		l.report("init-equal", -1, "two calls of Init returned states that aren't Equal: %v and %v", init1, init2)
+	}
+	if shared(init1, init2) {
+		l.report("init-fresh", -1, "two calls of Init returned the same %T, which must not be shared", init1)
+	}
+
+	states := []reached{{state: init1}}
+	for i := range l.samples {
+		var added []reached
+		for _, r := range states {
+			ok, next, panicked := l.step(r.state, i)
+			if panicked {
+				continue
+			}
+			if again := l.replay(r.path); !l.equal(r.state, again, i) {
+				l.report("step-mutates-state", i, "Step modified the state it was given, with %s", l.describe(i))
+				r.state = again
+			}
+			ok2, next2, _ := l.step(r.state, i)
+			if ok != ok2 || ok && !l.equal(next, next2, i) {
+				l.report("step-deterministic", i, "Step returned different results for the same state, with %s", l.describe(i))
+			}
+			if ok && len(states)+len(added) < maxLintStates {
+				path := make([]int, len(r.path)+1)
+				copy(path, r.path)
+				path[len(r.path)] = i
+				added = append(added, reached{state: next, path: path})
+			}
+		}
+		states = append(states, added...)
+	}
+
+	for i, r := range states {
+		index := -1
+		if len(r.path) > 0 {
+			index = r.path[len(r.path)-1]
+		}
+		if !l.equal(r.state, r.state, index) {
+			l.report("equal-reflexive", index, "a state isn't Equal to itself: %v", r.state)
+		}
+		for _, other := range states[:i] {
+			if l.equal(r.state, other.state, index) != l.equal(other.state, r.state, index) {
+				l.report("equal-symmetric", index, "Equal isn't symmetric for states %v and %v", r.state, other.state)
+			}
+		}
+		if l.model.DescribeState != nil {
+			l.checkDescribeState(r.state, index)
+		}
+	}
+	if l.model.DescribeOperation != nil {
+		for i := range l.samples {
+			l.checkDescribeOperation(i)
+		}
+	}
+}
+
+func (l *linter) checkDescribeState(state interface{}, index int) {
+	defer func() {
+		if r := recover(); r != nil {
+			l.report("describe-state-panics", index, "DescribeState panicked for state %v: %v", state, r)
+		}
+	}()
+	l.model.DescribeState(state)
+}
+
+func (l *linter) checkDescribeOperation(index int) {
+	defer func() {
+		if r := recover(); r != nil {
+			l.report("describe-operation-panics", index, "DescribeOperation panicked with %s: %v", l.describe(index), r)
+		}
+	}()
+	op := l.samples[index]
+	l.model.DescribeOperation(op.Input, op.Output)
+}
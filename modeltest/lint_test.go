@@ -0,0 +1,138 @@
+package modeltest
+
+import (
+	"math"
+	"math/rand"
+	"testing"
+
+	"github.com/anishathalye/porcupine"
+	"github.com/anishathalye/porcupine/models"
+)
+
+func properties(issues []LintIssue) map[string]bool {
+	m := make(map[string]bool)
+	for _, issue := range issues {
+		m[issue.Property] = true
+	}
+	return m
+}
+
+func TestLint(t *testing.T) {
+	rng := rand.New(rand.NewSource(0))
+	samples := GenerateHistory(rng, GenConfig{Operations: 20, Pending: 0.2}, kvExecutor())
+	if issues := Lint(models.KV(), samples); len(issues) > 0 {
+		t.Fatalf("unexpected issues %v", issues)
+	}
+	samples = GenerateHistory(rng, GenConfig{Operations: 20, Pending: 0.2}, registerExecutor())
+	if issues := Lint(models.Register(), samples); len(issues) > 0 {
+		t.Fatalf("unexpected issues %v", issues)
+	}
+}
+
+// mapRegister is a register whose states are maps, built with the given
+// Init and Step functions.
+func mapRegister(init func() interface{}, step func(state, input, output interface{}) (bool, interface{})) porcupine.Model {
+	return porcupine.Model{
+		Init: init,
+		Step: step,
+		Equal: func(state1, state2 interface{}) bool {
+			return state1.(map[string]int)["value"] == state2.(map[string]int)["value"]
+		},
+	}
+}
+
+func registerStep(state, input, output interface{}) (bool, interface{}) {
+	inp := input.(models.RegisterInput)
+	st := state.(map[string]int)
+	if inp.Op == models.RegisterPut {
+		return true, map[string]int{"value": inp.Value}
+	}
+	return output.(models.RegisterOutput).Value == st["value"], st
+}
+
+func TestLintIssues(t *testing.T) {
+	samples := []porcupine.Operation{
+		{Input: put(1), Output: models.RegisterOutput{}},
+		{Input: get, Output: value(1)},
+		{Input: put(2), Output: models.RegisterOutput{}},
+	}
+	newMap := func() interface{} { return map[string]int{"value": 0} }
+	shared := map[string]int{"value": 0}
+	calls := 0
+	cases := []struct {
+		name     string
+		model    porcupine.Model
+		property string
+	}{
+		{"shared init", mapRegister(func() interface{} { return shared }, registerStep), "init-fresh"},
+		{"mutating step", mapRegister(newMap, func(state, input, output interface{}) (bool, interface{}) {
+			inp := input.(models.RegisterInput)
+			st := state.(map[string]int)
+			if inp.Op == models.RegisterPut {
+				st["value"] = inp.Value
+				return true, st
+			}
+			return output.(models.RegisterOutput).Value == st["value"], st
+		}), "step-mutates-state"},
+		{"nondeterministic step", mapRegister(newMap, func(state, input, output interface{}) (bool, interface{}) {
+			calls++
+			if calls%2 == 0 {
+				return false, state
+			}
+			return registerStep(state, input, output)
+		}), "step-deterministic"},
+		{"NaN", porcupine.Model{
+			Init: func() interface{} { return math.NaN() },
+			Step: func(state, input, output interface{}) (bool, interface{}) {
+				return true, state
+			},
+		}, "equal-reflexive"},
+		{"uncomparable states", porcupine.Model{
+			Init: newMap,
+			Step: registerStep,
+		}, "equal-panics"},
+		{"asymmetric equal", porcupine.Model{
+			Init: func() interface{} { return 0 },
+			Step: func(state, input, output interface{}) (bool, interface{}) {
+				inp := input.(models.RegisterInput)
+				if inp.Op == models.RegisterPut {
+					return true, inp.Value
+				}
+				return true, state
+			},
+			Equal: func(state1, state2 interface{}) bool {
+				return state1.(int) <= state2.(int)
+			},
+		}, "equal-symmetric"},
+		{"panicking step", mapRegister(newMap, func(state, input, output interface{}) (bool, interface{}) {
+			if input.(models.RegisterInput).Value == 2 {
+				panic("oops")
+			}
+			return registerStep(state, input, output)
+		}), "step-panics"},
+		{"panicking description", porcupine.Model{
+			Init: func() interface{} { return 0 },
+			Step: func(state, input, output interface{}) (bool, interface{}) {
+				return true, state
+			},
+			DescribeOperation: func(input, output interface{}) string {
+				return output.(models.KVOutput).Value
+			},
+			DescribeState: func(state interface{}) string {
+				return state.(string)
+			},
+		}, "describe-operation-panics"},
+	}
+	for _, c := range cases {
+		issues := Lint(c.model, samples)
+		if !properties(issues)[c.property] {
+			t.Errorf("%s: expected %s, got %v", c.name, c.property, issues)
+		}
+	}
+
+	issues := Lint(cases[len(cases)-1].model, samples)
+	// every state and every sample operation
+	if len(issues) != 7 || issues[0].String() != "describe-state-panics: DescribeState panicked for state 0: interface conversion: interface {} is int, not string" {
+		t.Fatalf("unexpected issues %v", issues)
+	}
+}
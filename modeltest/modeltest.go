@@ -0,0 +1,110 @@
+// Package modeltest helps validate porcupine models against sequential
+// traces that are known to be correct, before trusting them to judge
+// concurrent histories.
+//
+// A trace is a sequence of operations, each marked as legal or not, that are
+// run through a model one at a time, starting from its initial state:
+//
+//	trace := []modeltest.SequentialOp{
+//		{Input: put(1), Output: ok, Legal: true},
+//		{Input: get(), Output: value(1), Legal: true},
+//		{Input: get(), Output: value(2), Legal: false},
+//	}
+//	if err := modeltest.TestSequential(model, trace); err != nil {
+//		t.Fatal(err)
+//	}
+//
+// Traces of legal operations can be produced by running a reference
+// implementation of the system with [GenerateTrace].
+//
+// Everything in the package that makes random choices takes either a
+// *rand.Rand or a seed, and never uses the global random number generator,
+// so that any failure can be reproduced; failures that the package reports
+// include the seed when it knows it. [ReplaySeed] picks the seed for a test,
+// and lets a failure in CI be replayed locally.
+package modeltest
+
+import (
+	"fmt"
+
+	"github.com/anishathalye/porcupine"
+)
+
+// A SequentialOp is an operation in a sequential trace.
+type SequentialOp struct {
+	Input  interface{}
+	Output interface{}
+	// Legal is whether the model must accept the operation in the state
+	// reached by the legal operations before it. The model must reject
+	// an operation that isn't legal, which then has no effect on the
+	// state.
+	Legal bool
+}
+
+// A DivergenceError is returned by [TestSequential] when a model doesn't
+// agree with a trace.
+type DivergenceError struct {
+	// Index is the index of the operation in the trace.
+	Index int
+	Op    SequentialOp
+	// Operation and State describe the operation and the state of the
+	// model before it, with the model's DescribeOperation and
+	// DescribeState functions.
+	Operation string
+	State     string
+}
+
+func (e *DivergenceError) Error() string {
+	if e.Op.Legal {
+		return fmt.Sprintf("modeltest: operation %d, %s, is legal, but the model rejected it in state %s", e.Index, e.Operation, e.State)
+	}
+	return fmt.Sprintf("modeltest: operation %d, %s, is not legal, but the model accepted it in state %s", e.Index, e.Operation, e.State)
+}
+
+// TestSequential runs a trace through the Step function of a model, starting
+// from its initial state, and returns a [*DivergenceError] for the first
+// operation that the model accepts but isn't legal, or that it rejects but
+// is, or nil if the model agrees with the whole trace. Operations that are
+// legal advance the state, and those that aren't leave it unchanged.
+func TestSequential(model porcupine.Model, trace []SequentialOp) error {
+	describeOperation := model.DescribeOperation
+	if describeOperation == nil {
+		describeOperation = func(input, output interface{}) string {
+			return fmt.Sprintf("%v -> %v", input, output)
+		}
+	}
+	describeState := model.DescribeState
+	if describeState == nil {
+		describeState = func(state interface{}) string {
+			return fmt.Sprintf("%v", state)
+		}
+	}
+	state := model.Init()
+	for i, op := range trace {
+		ok, next := model.Step(state, op.Input, op.Output)
+		if ok != op.Legal {
+			return &DivergenceError{
+				Index:     i,
+				Op:        op,
+				Operation: describeOperation(op.Input, op.Output),
+				State:     describeState(state),
+			}
+		}
+		if ok {
+			state = next
+		}
+	}
+	return nil
+}
+
+// GenerateTrace returns a trace of legal operations with the given inputs, in
+// order, and the outputs that a reference implementation of the system
+// returns for them. The reference function applies an operation to the
+// implementation, which it may modify, and returns its output.
+func GenerateTrace(inputs []interface{}, reference func(input interface{}) interface{}) []SequentialOp {
+	trace := make([]SequentialOp, len(inputs))
+	for i, input := range inputs {
+		trace[i] = SequentialOp{Input: input, Output: reference(input), Legal: true}
+	}
+	return trace
+}
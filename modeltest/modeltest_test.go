@@ -0,0 +1,112 @@
+package modeltest
+
+import (
+	"errors"
+	"math/rand"
+	"testing"
+
+	"github.com/anishathalye/porcupine"
+	"github.com/anishathalye/porcupine/models"
+)
+
+func put(value int) models.RegisterInput {
+	return models.RegisterInput{Op: models.RegisterPut, Value: value}
+}
+
+var get = models.RegisterInput{Op: models.RegisterGet}
+
+func value(v int) models.RegisterOutput {
+	return models.RegisterOutput{Value: v}
+}
+
+func TestTestSequential(t *testing.T) {
+	trace := []SequentialOp{
+		{Input: get, Output: value(0), Legal: true},
+		{Input: put(1), Output: models.RegisterOutput{}, Legal: true},
+		{Input: get, Output: value(0), Legal: false},
+		{Input: get, Output: value(1), Legal: true},
+		{Input: put(2), Output: nil, Legal: true},
+		{Input: get, Output: value(2), Legal: true},
+		{Input: get, Output: value(1), Legal: false},
+	}
+	if err := TestSequential(models.Register(), trace); err != nil {
+		t.Fatal(err)
+	}
+
+	// a register that ignores puts
+	broken := porcupine.Model{
+		Init: func() interface{} { return 0 },
+		Step: func(state, input, output interface{}) (bool, interface{}) {
+			if input.(models.RegisterInput).Op == models.RegisterPut {
+				return true, state
+			}
+			return output.(models.RegisterOutput).Value == state.(int), state
+		},
+		DescribeState: func(state interface{}) string { return "stuck" },
+	}
+	err := TestSequential(broken, trace)
+	var divergence *DivergenceError
+	if !errors.As(err, &divergence) {
+		t.Fatalf("expected a divergence, got %v", err)
+	}
+	if divergence.Index != 2 || divergence.State != "stuck" || divergence.Operation != "{0 0} -> {0 false}" {
+		t.Fatalf("unexpected divergence %+v", divergence)
+	}
+	expected := "modeltest: operation 2, {0 0} -> {0 false}, is not legal, but the model accepted it in state stuck"
+	if err.Error() != expected {
+		t.Fatalf("expected %q, got %q", expected, err.Error())
+	}
+}
+
+func TestGenerateTrace(t *testing.T) {
+	// a reference implementation of Jepsen's bank, checked against the
+	// model
+	accounts := []string{"a", "b", "c"}
+	balances := map[string]int{"a": 10, "b": 10, "c": 10}
+	reference := func(input interface{}) interface{} {
+		inp := input.(models.BankInput)
+		if inp.Op == models.BankRead {
+			read := make(map[string]int, len(balances))
+			for account, balance := range balances {
+				read[account] = balance
+			}
+			return models.BankOutput{Balances: read}
+		}
+		if balances[inp.From] < inp.Amount {
+			return models.BankOutput{Failed: true}
+		}
+		balances[inp.From] -= inp.Amount
+		balances[inp.To] += inp.Amount
+		return models.BankOutput{}
+	}
+	rng := rand.New(rand.NewSource(0))
+	inputs := make([]interface{}, 200)
+	for i := range inputs {
+		if rng.Intn(3) == 0 {
+			inputs[i] = models.BankInput{Op: models.BankRead}
+			continue
+		}
+		inputs[i] = models.BankInput{
+			Op:     models.BankTransfer,
+			From:   accounts[rng.Intn(len(accounts))],
+			To:     accounts[rng.Intn(len(accounts))],
+			Amount: rng.Intn(8),
+		}
+	}
+	trace := GenerateTrace(inputs, reference)
+	if err := TestSequential(models.Bank(accounts, 10), trace); err != nil {
+		t.Fatal(err)
+	}
+
+	// a read that doesn't conserve the total is caught
+	trace = append(trace, SequentialOp{
+		Input:  models.BankInput{Op: models.BankRead},
+		Output: models.BankOutput{Balances: map[string]int{"a": 0, "b": 0, "c": 0}},
+		Legal:  true,
+	})
+	err := TestSequential(models.Bank(accounts, 10), trace)
+	var divergence *DivergenceError
+	if !errors.As(err, &divergence) || divergence.Index != len(inputs) {
+		t.Fatalf("expected a divergence at the end, got %v", err)
+	}
+}
@@ -0,0 +1,206 @@
+package modeltest
+
+import (
+	"fmt"
+	"math/rand"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/anishathalye/porcupine"
+)
+
+// A Mutator corrupts a history, to check that a model rejects it.
+type Mutator struct {
+	// Name identifies the mutator in reports.
+	Name string
+	// Apply mutates the operations in place, and returns whether it could:
+	// if it returns false, it must leave them unchanged.
+	Apply func(rng *rand.Rand, ops []porcupine.Operation) bool
+}
+
+// sameKind returns whether two operations are of the same kind, with inputs
+// of the same type, and both returned with different outputs.
+func sameKind(op1, op2 porcupine.Operation) bool {
+	return op1.Output != nil && op2.Output != nil &&
+		reflect.TypeOf(op1.Input) == reflect.TypeOf(op2.Input) &&
+		!reflect.DeepEqual(op1.Output, op2.Output)
+}
+
+// pickPair calls f with random pairs of different operations until it
+// returns true, and returns whether it did.
+func pickPair(rng *rand.Rand, ops []porcupine.Operation, f func(i, j int) bool) bool {
+	others := rng.Perm(len(ops))
+	for _, i := range rng.Perm(len(ops)) {
+		for _, j := range others {
+			if i != j && f(i, j) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// FlipRead returns a mutator that changes the output of a read, as
+// identified by isRead, to the different output of another read, so that it
+// observes a value that was observed elsewhere in the history.
+func FlipRead(isRead func(input interface{}) bool) Mutator {
+	return Mutator{Name: "flip-read", Apply: func(rng *rand.Rand, ops []porcupine.Operation) bool {
+		return pickPair(rng, ops, func(i, j int) bool {
+			if !isRead(ops[i].Input) || !isRead(ops[j].Input) || !sameKind(ops[i], ops[j]) {
+				return false
+			}
+			ops[i].Output = ops[j].Output
+			return true
+		})
+	}}
+}
+
+// SwapOutputs returns a mutator that swaps the different outputs of two
+// operations with inputs of the same type.
+func SwapOutputs() Mutator {
+	return Mutator{Name: "swap-outputs", Apply: func(rng *rand.Rand, ops []porcupine.Operation) bool {
+		return pickPair(rng, ops, func(i, j int) bool {
+			if !sameKind(ops[i], ops[j]) {
+				return false
+			}
+			ops[i].Output, ops[j].Output = ops[j].Output, ops[i].Output
+			return true
+		})
+	}}
+}
+
+// DropWrite returns a mutator that drops the effect of a write, by changing
+// its output to one that says it failed, as returned by fail. For operations
+// that aren't writes, or that can't fail, fail returns false.
+func DropWrite(fail func(input, output interface{}) (interface{}, bool)) Mutator {
+	return Mutator{Name: "drop-write", Apply: func(rng *rand.Rand, ops []porcupine.Operation) bool {
+		for _, i := range rng.Perm(len(ops)) {
+			if ops[i].Output == nil {
+				continue
+			}
+			if failed, ok := fail(ops[i].Input, ops[i].Output); ok && !reflect.DeepEqual(failed, ops[i].Output) {
+				ops[i].Output = failed
+				return true
+			}
+		}
+		return false
+	}}
+}
+
+// DuplicateOutput returns a mutator that copies the output of an operation to
+// another operation with an input of the same type and a different output.
+func DuplicateOutput() Mutator {
+	return Mutator{Name: "duplicate-output", Apply: func(rng *rand.Rand, ops []porcupine.Operation) bool {
+		return pickPair(rng, ops, func(i, j int) bool {
+			if !sameKind(ops[i], ops[j]) {
+				return false
+			}
+			ops[j].Output = ops[i].Output
+			return true
+		})
+	}}
+}
+
+// DefaultMutators returns the mutators that apply to any model, without
+// knowing which operations are reads or writes.
+func DefaultMutators() []Mutator {
+	return []Mutator{SwapOutputs(), DuplicateOutput()}
+}
+
+// Mutate returns a copy of a history, mutated by one of the mutators, chosen
+// at random among those that apply to it. If none of them apply, the copy is
+// unchanged.
+func Mutate(ops []porcupine.Operation, mutators []Mutator, rng *rand.Rand) []porcupine.Operation {
+	mutated, _ := mutate(ops, mutators, rng)
+	return mutated
+}
+
+// mutate is like [Mutate], and also returns the index of the mutator that was
+// applied, or -1 if none.
+func mutate(ops []porcupine.Operation, mutators []Mutator, rng *rand.Rand) ([]porcupine.Operation, int) {
+	mutated := make([]porcupine.Operation, len(ops))
+	copy(mutated, ops)
+	for _, m := range rng.Perm(len(mutators)) {
+		if mutators[m].Apply(rng, mutated) {
+			return mutated, m
+		}
+	}
+	return mutated, -1
+}
+
+// MutationOptions configures [AssertDetectsMutationsWithOptions].
+type MutationOptions struct {
+	// Mutators are the mutators to apply. If nil, [DefaultMutators] are
+	// used.
+	Mutators []Mutator
+	// MinDetected is the fraction of mutated histories that the model
+	// must reject. If 0, it defaults to 0.5: some mutations are harmless,
+	// such as swapping the outputs of concurrent reads.
+	MinDetected float64
+	// Seed seeds the random choice of mutations.
+	Seed int64
+}
+
+// AssertDetectsMutations is [AssertDetectsMutationsWithOptions] with default
+// options.
+func AssertDetectsMutations(t testing.TB, model porcupine.Model, base []porcupine.Operation, n int) {
+	t.Helper()
+	AssertDetectsMutationsWithOptions(t, model, base, n, MutationOptions{})
+}
+
+// AssertDetectsMutationsWithOptions checks that a model rejects corrupted
+// histories: it mutates a linearizable base history n times, independently,
+// and fails the test if the checker finds fewer than a fraction of the
+// mutated histories to be illegal, or if the base history itself isn't
+// linearizable. It logs, for each mutator, how many of its mutations escaped
+// detection.
+func AssertDetectsMutationsWithOptions(t testing.TB, model porcupine.Model, base []porcupine.Operation, n int, opts MutationOptions) {
+	t.Helper()
+	mutators := opts.Mutators
+	if mutators == nil {
+		mutators = DefaultMutators()
+	}
+	minDetected := opts.MinDetected
+	if minDetected == 0 {
+		minDetected = 0.5
+	}
+	if !porcupine.CheckOperations(model, base) {
+		t.Fatal("modeltest: the base history is not linearizable")
+		return
+	}
+	rng := rand.New(rand.NewSource(opts.Seed))
+	applied := make([]int, len(mutators))
+	escaped := make([]int, len(mutators))
+	total, detected := 0, 0
+	for i := 0; i < n; i++ {
+		mutated, m := mutate(base, mutators, rng)
+		if m < 0 {
+			break
+		}
+		total++
+		applied[m]++
+		if porcupine.CheckOperations(model, mutated) {
+			escaped[m]++
+		} else {
+			detected++
+		}
+	}
+	if total == 0 {
+		t.Fatal("modeltest: no mutator applies to the base history")
+		return
+	}
+	var report []string
+	for m, mutator := range mutators {
+		if applied[m] > 0 {
+			report = append(report, fmt.Sprintf("%s: %d of %d escaped", mutator.Name, escaped[m], applied[m]))
+		}
+	}
+	sort.Strings(report)
+	if float64(detected) < minDetected*float64(total) {
+		t.Errorf("modeltest: the model detected %d of %d mutations, fewer than %g of them (%s; seed %d)", detected, total, minDetected, strings.Join(report, ", "), opts.Seed)
+		return
+	}
+	t.Logf("modeltest: the model detected %d of %d mutations (%s)", detected, total, strings.Join(report, ", "))
+}
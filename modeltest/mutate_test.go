@@ -0,0 +1,151 @@
+package modeltest
+
+import (
+	"fmt"
+	"math/rand"
+	"strings"
+	"testing"
+
+	"github.com/anishathalye/porcupine"
+	"github.com/anishathalye/porcupine/models"
+)
+
+// recordingTB records the failures and logs of a test, so that tests can
+// check them.
+type recordingTB struct {
+	testing.TB
+	failed   bool
+	logs     []string
+	cleanups []func()
+}
+
+func (r *recordingTB) Helper() {}
+
+func (r *recordingTB) Failed() bool {
+	return r.failed
+}
+
+func (r *recordingTB) Cleanup(f func()) {
+	r.cleanups = append(r.cleanups, f)
+}
+
+func (r *recordingTB) Fatal(args ...interface{}) {
+	r.failed = true
+	r.logs = append(r.logs, fmt.Sprint(args...))
+}
+
+func (r *recordingTB) Fatalf(format string, args ...interface{}) {
+	r.failed = true
+	r.logs = append(r.logs, fmt.Sprintf(format, args...))
+}
+
+func (r *recordingTB) Errorf(format string, args ...interface{}) {
+	r.failed = true
+	r.logs = append(r.logs, fmt.Sprintf(format, args...))
+}
+
+func (r *recordingTB) Logf(format string, args ...interface{}) {
+	r.logs = append(r.logs, fmt.Sprintf(format, args...))
+}
+
+func isGet(input interface{}) bool {
+	return input.(models.RegisterInput).Op == models.RegisterGet
+}
+
+func registerHistory() []porcupine.Operation {
+	rng := rand.New(rand.NewSource(0))
+	return GenerateHistory(rng, GenConfig{Operations: 30, Clients: 3, Concurrency: 1}, registerExecutor())
+}
+
+func TestMutate(t *testing.T) {
+	base := registerHistory()
+	rng := rand.New(rand.NewSource(0))
+	for _, mutator := range []Mutator{FlipRead(isGet), SwapOutputs(), DuplicateOutput()} {
+		mutated := Mutate(base, []Mutator{mutator}, rng)
+		changed := 0
+		for i := range base {
+			if base[i].Output != mutated[i].Output {
+				changed++
+				if mutator.Name == "flip-read" && !isGet(base[i].Input) {
+					t.Errorf("%s: mutated a put", mutator.Name)
+				}
+			}
+		}
+		if changed == 0 || changed > 2 {
+			t.Errorf("%s: expected one or two outputs to change, got %d", mutator.Name, changed)
+		}
+	}
+
+	// a history with a single operation can't be mutated
+	mutated := Mutate(base[:1], DefaultMutators(), rng)
+	if len(mutated) != 1 || mutated[0] != base[0] {
+		t.Fatal("expected the history to be unchanged")
+	}
+}
+
+func TestAssertDetectsMutations(t *testing.T) {
+	base := registerHistory()
+	opts := MutationOptions{Mutators: append(DefaultMutators(), FlipRead(isGet))}
+	AssertDetectsMutationsWithOptions(t, models.Register(), base, 100, opts)
+
+	// a model that accepts everything is caught
+	permissive := porcupine.Model{
+		Init: func() interface{} { return nil },
+		Step: func(state, input, output interface{}) (bool, interface{}) {
+			return true, state
+		},
+	}
+	r := &recordingTB{}
+	AssertDetectsMutationsWithOptions(r, permissive, base, 100, opts)
+	if !r.failed || len(r.logs) != 1 || !strings.Contains(r.logs[0], "flip-read: ") || !strings.Contains(r.logs[0], "seed 0") {
+		t.Fatalf("expected a failure reporting escaped mutations and the seed, got %q", r.logs)
+	}
+
+	// and so is a base history that isn't linearizable
+	r = &recordingTB{}
+	broken := append([]porcupine.Operation{}, base...)
+	broken = append(broken, porcupine.Operation{ClientId: 0, Input: get, Call: 10000, Output: value(7), Return: 10001})
+	AssertDetectsMutations(r, models.Register(), broken, 10)
+	if !r.failed {
+		t.Fatal("expected a failure")
+	}
+}
+
+func TestDropWrite(t *testing.T) {
+	// transfers that fail can't explain the balances that reads see
+	accounts := []string{"a", "b"}
+	balances := map[string]int{"a": 10, "b": 10}
+	exec := SequentialExecutor{
+		Inputs: []func(rng *rand.Rand) interface{}{
+			func(rng *rand.Rand) interface{} {
+				from, to := "a", "b"
+				if rng.Intn(2) == 0 {
+					from, to = to, from
+				}
+				return models.BankInput{Op: models.BankTransfer, From: from, To: to, Amount: 1 + rng.Intn(5)}
+			},
+			func(rng *rand.Rand) interface{} { return models.BankInput{Op: models.BankRead} },
+		},
+		Apply: func(input interface{}) interface{} {
+			inp := input.(models.BankInput)
+			if inp.Op == models.BankRead {
+				return models.BankOutput{Balances: map[string]int{"a": balances["a"], "b": balances["b"]}}
+			}
+			if balances[inp.From] < inp.Amount {
+				return models.BankOutput{Failed: true}
+			}
+			balances[inp.From] -= inp.Amount
+			balances[inp.To] += inp.Amount
+			return models.BankOutput{}
+		},
+	}
+	rng := rand.New(rand.NewSource(0))
+	base := GenerateHistory(rng, GenConfig{Operations: 30, Clients: 3, Concurrency: 1}, exec)
+	dropWrite := DropWrite(func(input, output interface{}) (interface{}, bool) {
+		return models.BankOutput{Failed: true}, input.(models.BankInput).Op == models.BankTransfer
+	})
+	AssertDetectsMutationsWithOptions(t, models.Bank(accounts, 10), base, 50, MutationOptions{
+		Mutators:    []Mutator{dropWrite},
+		MinDetected: 0.8,
+	})
+}
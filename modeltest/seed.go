@@ -0,0 +1,40 @@
+package modeltest
+
+import (
+	"os"
+	"strconv"
+	"testing"
+	"time"
+)
+
+// SeedEnv is the environment variable from which [ReplaySeed] reads a seed.
+const SeedEnv = "MODELTEST_SEED"
+
+// ReplaySeed returns the seed for a randomized test: the one in the
+// MODELTEST_SEED environment variable, if it's set, and a new one that
+// differs from run to run otherwise. If the test fails, it logs the seed,
+// along with how to replay it, so that a failure in CI can be reproduced
+// locally by running the test again with the same seed:
+//
+//	MODELTEST_SEED=1234 go test -run TestModel
+//
+// ReplaySeed fails the test if the environment variable isn't an integer.
+func ReplaySeed(t testing.TB) int64 {
+	t.Helper()
+	var seed int64
+	if s, ok := os.LookupEnv(SeedEnv); ok {
+		var err error
+		seed, err = strconv.ParseInt(s, 10, 64)
+		if err != nil {
+			t.Fatalf("modeltest: invalid %s: %v", SeedEnv, err)
+		}
+	} else {
+		seed = time.Now().UnixNano()
+	}
+	t.Cleanup(func() {
+		if t.Failed() {
+			t.Logf("modeltest: to replay this failure, run the test with %s=%d", SeedEnv, seed)
+		}
+	})
+	return seed
+}
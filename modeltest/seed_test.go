@@ -0,0 +1,160 @@
+package modeltest
+
+import (
+	"go/ast"
+	"go/build"
+	"go/parser"
+	"go/token"
+	"io/fs"
+	"math/rand"
+	"os"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+type entryPoint struct {
+	fn         interface{}
+	randomized bool
+}
+
+// entryPoints are the exported functions of the package, and whether they
+// make random choices. Functions that need a newer version of Go than the
+// package are added by the test files built with them.
+var entryPoints = map[string]entryPoint{
+	"AssertDetectsMutations":            {AssertDetectsMutations, false}, // always uses seed 0
+	"AssertDetectsMutationsWithOptions": {AssertDetectsMutationsWithOptions, true},
+	"AssertEquivalent":                  {AssertEquivalent, false},
+	"AssertFaultsDetected":              {AssertFaultsDetected, false},
+	"AssertModelsEquivalent":            {AssertModelsEquivalent, true},
+	"CheckOperationsBruteForce":         {CheckOperationsBruteForce, false},
+	"DecodeKVEvents":                    {DecodeKVEvents, false},
+	"DefaultMutators":                   {DefaultMutators, false},
+	"DropWrite":                         {DropWrite, false},
+	"DuplicateOutput":                   {DuplicateOutput, false},
+	"EncodeKVEvents":                    {EncodeKVEvents, false},
+	"FlipRead":                          {FlipRead, false},
+	"GenerateHistory":                   {GenerateHistory, true},
+	"GenerateTrace":                     {GenerateTrace, false},
+	"Lint":                              {Lint, false},
+	"Mutate":                            {Mutate, true},
+	"MutateHistory":                     {MutateHistory, true},
+	"NewFaultyStore":                    {NewFaultyStore, true},
+	"ReplaySeed":                        {ReplaySeed, false},
+	"Run":                               {Run, true},
+	"RunFaulty":                         {RunFaulty, true},
+	"SwapOutputs":                       {SwapOutputs, false},
+	"TestSequential":                    {TestSequential, false},
+}
+
+// TestRandomizedEntryPointsTakeSeed checks that every exported function that
+// makes random choices takes a *rand.Rand, a seed, or a configuration with a
+// Seed field, so that its randomness can be reproduced.
+func TestRandomizedEntryPointsTakeSeed(t *testing.T) {
+	fset := token.NewFileSet()
+	pkgs, err := parser.ParseDir(fset, ".", func(fi fs.FileInfo) bool {
+		// files that this version of Go doesn't build don't count
+		match, err := build.Default.MatchFile(".", fi.Name())
+		return err == nil && match && !strings.HasSuffix(fi.Name(), "_test.go")
+	}, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	decls := make(map[string]*ast.FuncDecl)
+	for _, file := range pkgs["modeltest"].Files {
+		for _, decl := range file.Decls {
+			if fn, ok := decl.(*ast.FuncDecl); ok && fn.Recv == nil && fn.Name.IsExported() {
+				decls[fn.Name.Name] = fn
+			}
+		}
+	}
+	for name := range decls {
+		if _, ok := entryPoints[name]; !ok {
+			t.Errorf("%s is not in entryPoints: add it, and say whether it makes random choices", name)
+		}
+	}
+	for name, e := range entryPoints {
+		decl, ok := decls[name]
+		if !ok {
+			t.Errorf("%s is in entryPoints, but it's not an exported function", name)
+			continue
+		}
+		if e.randomized && !takesSeed(reflect.TypeOf(e.fn), paramNames(decl)) {
+			t.Errorf("%s makes random choices, but it takes no *rand.Rand, seed, or configuration with a Seed", name)
+		}
+	}
+}
+
+// paramNames returns the names of the parameters of a function, in order.
+func paramNames(decl *ast.FuncDecl) []string {
+	var names []string
+	for _, field := range decl.Type.Params.List {
+		for _, name := range field.Names {
+			names = append(names, name.Name)
+		}
+	}
+	return names
+}
+
+func takesSeed(fn reflect.Type, names []string) bool {
+	rng := reflect.TypeOf((*rand.Rand)(nil))
+	for i := 0; i < fn.NumIn(); i++ {
+		param := fn.In(i)
+		switch {
+		case param == rng:
+			return true
+		case param.Kind() == reflect.Int64 && i < len(names) && names[i] == "seed":
+			return true
+		case param.Kind() == reflect.Struct:
+			if f, ok := param.FieldByName("Seed"); ok && f.Type.Kind() == reflect.Int64 {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// setenv sets an environment variable for the rest of a test, like t.Setenv,
+// which needs Go 1.17.
+func setenv(t *testing.T, key, value string) {
+	t.Helper()
+	old, ok := os.LookupEnv(key)
+	if err := os.Setenv(key, value); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		if ok {
+			os.Setenv(key, old)
+		} else {
+			os.Unsetenv(key)
+		}
+	})
+}
+
+func TestReplaySeed(t *testing.T) {
+	setenv(t, SeedEnv, "42")
+	r := &recordingTB{TB: t}
+	if seed := ReplaySeed(r); seed != 42 || r.failed {
+		t.Fatalf("expected seed 42, got %d (%v)", seed, r.logs)
+	}
+	// the seed is logged only if the test fails
+	for _, f := range r.cleanups {
+		f()
+	}
+	if len(r.logs) != 0 {
+		t.Fatalf("expected no logs, got %q", r.logs)
+	}
+	r.failed = true
+	for _, f := range r.cleanups {
+		f()
+	}
+	if len(r.logs) != 1 || !strings.Contains(r.logs[0], "MODELTEST_SEED=42") {
+		t.Fatalf("expected the seed to be logged, got %q", r.logs)
+	}
+
+	setenv(t, SeedEnv, "forty-two")
+	r = &recordingTB{TB: t}
+	if ReplaySeed(r); !r.failed {
+		t.Fatal("expected an invalid seed to fail the test")
+	}
+}
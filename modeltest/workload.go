@@ -0,0 +1,109 @@
+package modeltest
+
+import (
+	"fmt"
+	"math/rand"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/anishathalye/porcupine"
+)
+
+// WorkloadConfig configures [Run].
+type WorkloadConfig struct {
+	// Duration is how long the clients issue operations for.
+	Duration time.Duration
+	// MaxOperations, if positive, stops the workload early once the
+	// clients have issued this many operations in total.
+	MaxOperations int
+	// Clients is the number of concurrent clients, at least 1.
+	Clients int
+	// ThinkTime is the longest that a client pauses between its
+	// operations; each pause is random, up to ThinkTime.
+	ThinkTime time.Duration
+	// Seed seeds the random number generators of the clients, each of
+	// which has its own.
+	Seed int64
+}
+
+// Run runs a workload against an in-process store whose behavior is defined
+// by a model, and returns the history recorded with a [porcupine.Recorder].
+// The store holds a single state of the model, and it applies operations one
+// at a time, under a mutex, with the model's Step function.
+//
+// Each client repeatedly calls pickOp to choose an operation: pickOp returns
+// its input, and a function that computes its output from the state of the
+// store right before the operation takes effect. The operation then moves the
+// store to the state that Step returns. Run panics if Step rejects an output,
+// which means that pickOp disagrees with the model.
+//
+// The store keeps one state for the whole system, so the model's Init and
+// Step functions must describe the whole system rather than a partition of
+// it, and the model must be deterministic. The returned history is always
+// linearizable with respect to the model, so checking it tests the plumbing
+// of a test harness end to end, and it makes a realistic benchmark for the
+// checker.
+func Run(model porcupine.Model, cfg WorkloadConfig, pickOp func(rng *rand.Rand) (input interface{}, output func(state interface{}) interface{})) []porcupine.Operation {
+	recorder := porcupine.NewRecorder()
+	var mu sync.Mutex
+	state := model.Init()
+	var rejected string // the first operation that Step rejected
+	runClients(cfg, func(client int, rng *rand.Rand) bool {
+		mu.Lock()
+		stop := rejected != ""
+		mu.Unlock()
+		if stop {
+			return false
+		}
+		input, apply := pickOp(rng)
+		h := recorder.Begin(client, input)
+		mu.Lock()
+		output := apply(state)
+		ok, next := model.Step(state, input, output)
+		if ok {
+			state = next
+		} else if rejected == "" {
+			rejected = fmt.Sprintf("%v -> %v", input, output)
+		}
+		mu.Unlock()
+		h.End(output)
+		return ok
+	})
+	if rejected != "" {
+		panic(fmt.Sprintf("modeltest: model rejected operation %s in the state its output was computed from (seed %d)", rejected, cfg.Seed))
+	}
+	return recorder.Operations()
+}
+
+// runClients runs the clients of a workload, each of which repeatedly calls
+// op with its id and its own random number generator, pausing for up to the
+// think time in between, until the workload is over or op returns false.
+func runClients(cfg WorkloadConfig, op func(client int, rng *rand.Rand) bool) {
+	clients := cfg.Clients
+	if clients < 1 {
+		clients = 1
+	}
+	var issued int64
+	deadline := time.Now().Add(cfg.Duration)
+	var wg sync.WaitGroup
+	for c := 0; c < clients; c++ {
+		wg.Add(1)
+		go func(client int) {
+			defer wg.Done()
+			rng := rand.New(rand.NewSource(cfg.Seed + int64(client)))
+			for time.Now().Before(deadline) {
+				if cfg.MaxOperations > 0 && atomic.AddInt64(&issued, 1) > int64(cfg.MaxOperations) {
+					return
+				}
+				if !op(client, rng) {
+					return
+				}
+				if cfg.ThinkTime > 0 {
+					time.Sleep(time.Duration(rng.Int63n(int64(cfg.ThinkTime) + 1)))
+				}
+			}
+		}(c)
+	}
+	wg.Wait()
+}
@@ -0,0 +1,66 @@
+package modeltest
+
+import (
+	"math/rand"
+	"testing"
+	"time"
+
+	"github.com/anishathalye/porcupine"
+)
+
+type counterInput struct {
+	add bool // false = read
+}
+
+// counterModel is a counter that can be incremented and read.
+var counterModel = porcupine.Model{
+	Init: func() interface{} { return 0 },
+	Step: func(state, input, output interface{}) (bool, interface{}) {
+		if input.(counterInput).add {
+			return true, state.(int) + 1
+		}
+		return output.(int) == state.(int), state
+	},
+}
+
+func pickCounterOp(rng *rand.Rand) (interface{}, func(state interface{}) interface{}) {
+	if rng.Intn(2) == 0 {
+		return counterInput{add: true}, func(state interface{}) interface{} { return 0 }
+	}
+	return counterInput{}, func(state interface{}) interface{} { return state }
+}
+
+func TestRun(t *testing.T) {
+	cfg := WorkloadConfig{Duration: time.Second, MaxOperations: 200, Clients: 4, ThinkTime: 100 * time.Microsecond}
+	ops := Run(counterModel, cfg, pickCounterOp)
+	if len(ops) != 200 {
+		t.Fatalf("expected 200 operations, got %d", len(ops))
+	}
+	clients := make(map[int]bool)
+	for _, op := range ops {
+		clients[op.ClientId] = true
+	}
+	if len(clients) != 4 {
+		t.Fatalf("expected 4 clients, got %d", len(clients))
+	}
+	if !porcupine.CheckOperations(counterModel, ops) {
+		t.Fatal("expected the history to be linearizable")
+	}
+
+	// the workload stops after its duration
+	ops = Run(counterModel, WorkloadConfig{Duration: 20 * time.Millisecond, Clients: 2, ThinkTime: time.Millisecond}, pickCounterOp)
+	if len(ops) == 0 || !porcupine.CheckOperations(counterModel, ops) {
+		t.Fatalf("expected a linearizable history, got %d operations", len(ops))
+	}
+}
+
+func TestRunRejected(t *testing.T) {
+	defer func() {
+		if recover() == nil {
+			t.Fatal("expected a panic")
+		}
+	}()
+	Run(counterModel, WorkloadConfig{Duration: time.Second, Clients: 2}, func(rng *rand.Rand) (interface{}, func(state interface{}) interface{}) {
+		return counterInput{}, func(state interface{}) interface{} { return state.(int) + 1 }
+	})
+}
@@ -0,0 +1,191 @@
+package porcupine
+
+import (
+	"fmt"
+	"math"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+)
+
+// A StateMutationError reports that a model's Step function modified the
+// state it was given, which it must not do: the checker keeps states to
+// backtrack to, and compares them with Equal to prune the search, so a Step
+// function that modifies them makes results wrong, and often
+// nondeterministic. Checks with the DetectStateMutation option stop with an
+// Unknown result when they find one, and report it from
+// [LinearizationInfo.Err].
+type StateMutationError struct {
+	// Partition is the index of the partition that was being checked.
+	Partition int
+	// Input and Output are the input and output of the operation that
+	// Step was called with.
+	Input  interface{}
+	Output interface{}
+	// Operation describes the operation, and State describes the state
+	// after Step modified it, with the model's description functions.
+	Operation string
+	State     string
+}
+
+func (e *StateMutationError) Error() string {
+	return fmt.Sprintf("porcupine: Step modified the state it was given, in partition %d, for operation %s, leaving state %s", e.Partition, e.Operation, e.State)
+}
+
+// A mutationDetector records the first state mutation found by any of the
+// goroutines of a check.
+type mutationDetector struct {
+	mu  sync.Mutex
+	err *StateMutationError
+}
+
+// wrap returns a model whose Step function checks that the model's Step
+// function doesn't modify the state it's given, by comparing fingerprints of
+// the state from before and after it. When it does, the detector records it
+// and kills the check.
+func (d *mutationDetector) wrap(model Model, partition int, kill *int32) Model {
+	step := model.Step
+	model.Step = func(state, input, output interface{}) (bool, interface{}) {
+		before := fingerprint(state)
+		ok, next := step(state, input, output)
+		if fingerprint(state) != before {
+			d.mu.Lock()
+			if d.err == nil {
+				d.err = &StateMutationError{
+					Partition: partition,
+					Input:     input,
+					Output:    output,
+					Operation: model.DescribeOperation(input, output),
+					State:     model.DescribeState(state),
+				}
+			}
+			d.mu.Unlock()
+			atomic.StoreInt32(kill, 1)
+			return false, state
+		}
+		return ok, next
+	}
+	return model
+}
+
+// fingerprint returns a string that captures all of the data reachable from
+// v, so that two fingerprints of the same value differ if and only if the
+// data changed in between. Slices are fingerprinted up to their capacity, so
+// that appending to a slice in place, which changes the data of other slices
+// that share its array, is detected.
+func fingerprint(v interface{}) string {
+	var b strings.Builder
+	f := fingerprinter{b: &b, visiting: make(map[uintptr]bool)}
+	f.write(reflect.ValueOf(v))
+	return b.String()
+}
+
+type fingerprinter struct {
+	b        *strings.Builder
+	visiting map[uintptr]bool // pointers on the current path, to stop at cycles
+}
+
+func (f *fingerprinter) write(v reflect.Value) {
+	b := f.b
+	if !v.IsValid() {
+		b.WriteString("nil")
+		return
+	}
+	switch v.Kind() {
+	case reflect.Bool:
+		b.WriteString(strconv.FormatBool(v.Bool()))
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		b.WriteString(strconv.FormatInt(v.Int(), 10))
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		b.WriteString(strconv.FormatUint(v.Uint(), 10))
+	case reflect.Float32, reflect.Float64:
+		b.WriteString(strconv.FormatUint(math.Float64bits(v.Float()), 16))
+	case reflect.Complex64, reflect.Complex128:
+		c := v.Complex()
+		fmt.Fprintf(b, "%x+%xi", math.Float64bits(real(c)), math.Float64bits(imag(c)))
+	case reflect.String:
+		b.WriteString(strconv.Quote(v.String()))
+	case reflect.Ptr:
+		if v.IsNil() {
+			b.WriteString("nil")
+			return
+		}
+		if f.visiting[v.Pointer()] {
+			b.WriteString("cycle")
+			return
+		}
+		f.visiting[v.Pointer()] = true
+		b.WriteByte('&')
+		f.write(v.Elem())
+		delete(f.visiting, v.Pointer())
+	case reflect.Interface:
+		if v.IsNil() {
+			b.WriteString("nil")
+			return
+		}
+		b.WriteString(v.Elem().Type().String())
+		b.WriteByte('(')
+		f.write(v.Elem())
+		b.WriteByte(')')
+	case reflect.Slice:
+		if v.IsNil() {
+			b.WriteString("nil")
+			return
+		}
+		fmt.Fprintf(b, "[%d:", v.Len())
+		full := v.Slice3(0, v.Cap(), v.Cap())
+		for i := 0; i < full.Len(); i++ {
+			if i > 0 {
+				b.WriteByte(',')
+			}
+			f.write(full.Index(i))
+		}
+		b.WriteByte(']')
+	case reflect.Array:
+		b.WriteByte('[')
+		for i := 0; i < v.Len(); i++ {
+			if i > 0 {
+				b.WriteByte(',')
+			}
+			f.write(v.Index(i))
+		}
+		b.WriteByte(']')
+	case reflect.Struct:
+		b.WriteByte('{')
+		for i := 0; i < v.NumField(); i++ {
+			if i > 0 {
+				b.WriteByte(',')
+			}
+			f.write(v.Field(i))
+		}
+		b.WriteByte('}')
+	case reflect.Map:
+		if v.IsNil() {
+			b.WriteString("nil")
+			return
+		}
+		// map iteration order is random, so entries are sorted by
+		// their fingerprints
+		entries := make([]string, 0, v.Len())
+		iter := v.MapRange()
+		for iter.Next() {
+			var entry strings.Builder
+			g := fingerprinter{b: &entry, visiting: f.visiting}
+			g.write(iter.Key())
+			entry.WriteByte(':')
+			g.write(iter.Value())
+			entries = append(entries, entry.String())
+		}
+		sort.Strings(entries)
+		b.WriteString("map[")
+		b.WriteString(strings.Join(entries, ","))
+		b.WriteByte(']')
+	default:
+		// functions, channels, and unsafe pointers are compared by
+		// identity
+		fmt.Fprintf(b, "%s@%x", v.Kind(), v.Pointer())
+	}
+}
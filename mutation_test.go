@@ -0,0 +1,112 @@
+package porcupine
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestDetectStateMutation(t *testing.T) {
+	// a model that doesn't mutate its state passes
+	events := parseKvLog("test_data/kv/c01-ok.txt")
+	res, info := CheckEventsWithOptions(kvNoPartitionModel, events, CheckOptions{DetectStateMutation: true})
+	if res != Ok || info.Err() != nil {
+		t.Fatalf("expected output %v, got output %v, %v", Ok, res, info.Err())
+	}
+
+	// but one that puts into its map in place is caught
+	mutating := kvNoPartitionModel
+	mutating.Step = func(state, input, output interface{}) (bool, interface{}) {
+		inp := input.(kvInput)
+		st := state.(map[string]string)
+		switch inp.op {
+		case 1:
+			st[inp.key] = inp.value
+			return true, st
+		case 2:
+			st[inp.key] += inp.value
+			return true, st
+		}
+		return output.(kvOutput).value == st[inp.key], st
+	}
+	res, info = CheckEventsWithOptions(mutating, events, CheckOptions{DetectStateMutation: true})
+	err := mutationError(t, res, info)
+	if err.Input != (kvInput{op: 2, key: "0", value: "x 0 0 y"}) || err.Partition != 0 || err.Operation == "" {
+		t.Fatalf("unexpected error %v", err)
+	}
+}
+
+func TestDetectStateMutationAppend(t *testing.T) {
+	// appending to a slice in place doesn't change the elements of the
+	// slice that Step is given, but it writes to its spare capacity, which
+	// the states created from it by other calls share
+	model := Model{
+		Init: func() interface{} {
+			return make([]int, 0, 8)
+		},
+		Step: func(state, input, output interface{}) (bool, interface{}) {
+			st := state.([]int)
+			if input.(int) >= 0 {
+				return true, append(st, input.(int))
+			}
+			return len(st) == output.(int), st
+		},
+		Equal: func(state1, state2 interface{}) bool {
+			return len(state1.([]int)) == len(state2.([]int))
+		},
+	}
+	ops := []Operation{
+		{0, 1, 0, nil, 10},
+		{1, 2, 0, nil, 10},
+		{2, -1, 20, 2, 30},
+	}
+	if res, _ := CheckOperationsWithOptions(model, ops, CheckOptions{}); res != Ok {
+		t.Fatalf("expected output %v, got output %v", Ok, res)
+	}
+	res, info := CheckOperationsWithOptions(model, ops, CheckOptions{DetectStateMutation: true})
+	err := mutationError(t, res, info)
+	if in := err.Input.(int); in != 1 && in != 2 {
+		t.Fatalf("unexpected error %v", err)
+	}
+}
+
+// mutationError returns the StateMutationError that stopped a check, whose
+// result must be Unknown.
+func mutationError(t *testing.T, res CheckResult, info LinearizationInfo) *StateMutationError {
+	t.Helper()
+	if res != Unknown {
+		t.Fatalf("expected output %v, got output %v", Unknown, res)
+	}
+	var err *StateMutationError
+	if !errors.As(info.Err(), &err) {
+		t.Fatalf("expected a StateMutationError, got %v", info.Err())
+	}
+	return err
+}
+
+func TestFingerprint(t *testing.T) {
+	type node struct {
+		value int
+		next  *node
+	}
+	cycle := &node{value: 1}
+	cycle.next = cycle
+	m1 := map[string]int{"a": 1, "b": 2, "c": 3}
+	m2 := map[string]int{"c": 3, "b": 2, "a": 1}
+	if fingerprint(m1) != fingerprint(m2) {
+		t.Fatal("expected maps with the same entries to have the same fingerprint")
+	}
+	before := fingerprint(cycle)
+	cycle.value = 2
+	if fingerprint(cycle) == before {
+		t.Fatal("expected the fingerprint to change")
+	}
+	s := make([]int, 1, 2)
+	before = fingerprint(s)
+	_ = append(s, 1)
+	if fingerprint(s) == before {
+		t.Fatal("expected the fingerprint to change")
+	}
+	if fingerprint(nil) != "nil" || fingerprint([]interface{}{nil, 1.5, "x"}) == fingerprint([]interface{}{nil, 1.5, "y"}) {
+		t.Fatal("unexpected fingerprints")
+	}
+}
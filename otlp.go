@@ -0,0 +1,205 @@
+package porcupine
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+)
+
+// Types for the OTLP/JSON encoding of traces. Only the fields used by this
+// package are included. See
+// https://opentelemetry.io/docs/specs/otlp/#json-protobuf-encoding.
+
+type otlpTraces struct {
+	ResourceSpans []otlpResourceSpans `json:"resourceSpans"`
+}
+
+type otlpResourceSpans struct {
+	Resource   otlpResource     `json:"resource"`
+	ScopeSpans []otlpScopeSpans `json:"scopeSpans"`
+}
+
+type otlpResource struct {
+	Attributes []otlpKeyValue `json:"attributes,omitempty"`
+}
+
+type otlpScopeSpans struct {
+	Scope otlpScope  `json:"scope"`
+	Spans []otlpSpan `json:"spans"`
+}
+
+type otlpScope struct {
+	Name string `json:"name"`
+}
+
+type otlpSpan struct {
+	TraceId           string         `json:"traceId"`
+	SpanId            string         `json:"spanId"`
+	ParentSpanId      string         `json:"parentSpanId,omitempty"`
+	Name              string         `json:"name"`
+	Kind              int            `json:"kind"`
+	StartTimeUnixNano otlpInt64      `json:"startTimeUnixNano"`
+	EndTimeUnixNano   otlpInt64      `json:"endTimeUnixNano"`
+	Attributes        []otlpKeyValue `json:"attributes,omitempty"`
+	Events            []otlpEvent    `json:"events,omitempty"`
+	Status            *otlpStatus    `json:"status,omitempty"`
+}
+
+type otlpEvent struct {
+	TimeUnixNano otlpInt64      `json:"timeUnixNano"`
+	Name         string         `json:"name"`
+	Attributes   []otlpKeyValue `json:"attributes,omitempty"`
+}
+
+type otlpKeyValue struct {
+	Key   string       `json:"key"`
+	Value otlpAnyValue `json:"value"`
+}
+
+type otlpAnyValue struct {
+	StringValue *string         `json:"stringValue,omitempty"`
+	BoolValue   *bool           `json:"boolValue,omitempty"`
+	IntValue    *otlpInt64      `json:"intValue,omitempty"`
+	DoubleValue *float64        `json:"doubleValue,omitempty"`
+	ArrayValue  *otlpArrayValue `json:"arrayValue,omitempty"`
+}
+
+type otlpArrayValue struct {
+	Values []otlpAnyValue `json:"values"`
+}
+
+// otlpInt64 is a 64-bit integer, which OTLP/JSON encodes as a decimal string,
+// though some producers encode it as a number, which is accepted too.
+type otlpInt64 string
+
+func (i *otlpInt64) UnmarshalJSON(data []byte) error {
+	var s string
+	if err := json.Unmarshal(data, &s); err == nil {
+		*i = otlpInt64(s)
+		return nil
+	}
+	var n json.Number
+	if err := json.Unmarshal(data, &n); err != nil {
+		return fmt.Errorf("invalid integer %s", data)
+	}
+	*i = otlpInt64(n)
+	return nil
+}
+
+func (i otlpInt64) int64() (int64, error) {
+	return strconv.ParseInt(string(i), 10, 64)
+}
+
+type otlpStatus struct {
+	Code    int    `json:"code"`
+	Message string `json:"message,omitempty"`
+}
+
+const (
+	otlpSpanKindInternal = 1
+	otlpSpanKindClient   = 3
+	otlpStatusError      = 2
+)
+
+func otlpString(key, value string) otlpKeyValue {
+	return otlpKeyValue{Key: key, Value: otlpAnyValue{StringValue: &value}}
+}
+
+func otlpBool(key string, value bool) otlpKeyValue {
+	return otlpKeyValue{Key: key, Value: otlpAnyValue{BoolValue: &value}}
+}
+
+func otlpInt(key string, value int64) otlpKeyValue {
+	s := otlpInt64(strconv.FormatInt(value, 10))
+	return otlpKeyValue{Key: key, Value: otlpAnyValue{IntValue: &s}}
+}
+
+func otlpTime(t int64) otlpInt64 {
+	return otlpInt64(strconv.FormatInt(t, 10))
+}
+
+// ExportOTLP exports a history as OpenTelemetry traces in the OTLP/JSON
+// format, which can be imported into tracing tools such as Jaeger.
+//
+// Each partition is exported as one trace, with a root span covering the
+// entire partition, and each operation is exported as a child span of the
+// root, named by the model's DescribeOperation. Operation spans have the
+// attributes "porcupine.client_id", "porcupine.partition", and
+// "porcupine.linearized"; the latter is false for operations that are not part
+// of the longest partial linearization of a non-linearizable partition, and
+// those spans also have an error status. Trace and span IDs are derived from
+// partition and operation indices, so the output is deterministic.
+//
+// To get the LinearizationInfo that this function requires, you can use
+// [CheckOperationsVerbose] / [CheckEventsVerbose].
+func ExportOTLP(model Model, info LinearizationInfo, output io.Writer, opts ExportOptions) error {
+	data, linearized := exportData(model, info)
+	spans := []otlpSpan{}
+	for p, partition := range data {
+		if len(partition.History) == 0 {
+			continue
+		}
+		traceId := fmt.Sprintf("%032x", p+1)
+		rootId := fmt.Sprintf("%016x", 1)
+		start, end := partition.History[0].Start, partition.History[0].End
+		allLinearized := true
+		for i, elem := range partition.History {
+			if elem.Start < start {
+				start = elem.Start
+			}
+			if elem.End > end {
+				end = elem.End
+			}
+			allLinearized = allLinearized && linearized[p][i]
+		}
+		root := otlpSpan{
+			TraceId:           traceId,
+			SpanId:            rootId,
+			Name:              fmt.Sprintf("partition %d", p),
+			Kind:              otlpSpanKindInternal,
+			StartTimeUnixNano: otlpTime(opts.exportTime(start)),
+			EndTimeUnixNano:   otlpTime(opts.exportTime(end)),
+			Attributes: []otlpKeyValue{
+				otlpInt("porcupine.partition", int64(p)),
+				otlpBool("porcupine.linearized", allLinearized),
+			},
+		}
+		if !allLinearized {
+			root.Status = &otlpStatus{Code: otlpStatusError, Message: "not linearizable"}
+		}
+		spans = append(spans, root)
+		for i, elem := range partition.History {
+			span := otlpSpan{
+				TraceId:           traceId,
+				SpanId:            fmt.Sprintf("%016x", i+2),
+				ParentSpanId:      rootId,
+				Name:              elem.Description,
+				Kind:              otlpSpanKindClient,
+				StartTimeUnixNano: otlpTime(opts.exportTime(elem.Start)),
+				EndTimeUnixNano:   otlpTime(opts.exportTime(elem.End)),
+				Attributes: []otlpKeyValue{
+					otlpInt("porcupine.client_id", int64(elem.ClientId)),
+					otlpInt("porcupine.partition", int64(p)),
+					otlpBool("porcupine.linearized", linearized[p][i]),
+				},
+			}
+			if !linearized[p][i] {
+				span.Status = &otlpStatus{Code: otlpStatusError, Message: "not part of the longest partial linearization"}
+			}
+			spans = append(spans, span)
+		}
+	}
+	traces := otlpTraces{
+		ResourceSpans: []otlpResourceSpans{{
+			Resource: otlpResource{
+				Attributes: []otlpKeyValue{otlpString("service.name", "porcupine")},
+			},
+			ScopeSpans: []otlpScopeSpans{{
+				Scope: otlpScope{Name: "github.com/anishathalye/porcupine"},
+				Spans: spans,
+			}},
+		}},
+	}
+	return json.NewEncoder(output).Encode(traces)
+}
@@ -0,0 +1,102 @@
+package porcupine
+
+import (
+	"bytes"
+	"encoding/json"
+	"testing"
+	"time"
+)
+
+func otlpAttributes(span otlpSpan) map[string]otlpAnyValue {
+	attrs := make(map[string]otlpAnyValue)
+	for _, kv := range span.Attributes {
+		attrs[kv.Key] = kv.Value
+	}
+	return attrs
+}
+
+func TestExportOTLP(t *testing.T) {
+	ops := []Operation{
+		{0, kvInput{op: 1, key: "x", value: "y"}, 0, kvOutput{}, 10},
+		{1, kvInput{op: 0, key: "x"}, 20, kvOutput{"z"}, 30},
+		{2, kvInput{op: 1, key: "y", value: "a"}, 5, kvOutput{}, 15},
+	}
+	res, info := CheckOperationsVerbose(kvModel, ops, 0)
+	if res != Illegal {
+		t.Fatalf("expected output %v, got output %v", Illegal, res)
+	}
+	epoch := time.Unix(1700000000, 0)
+	var buf bytes.Buffer
+	err := ExportOTLP(kvModel, info, &buf, ExportOptions{Epoch: epoch, Unit: time.Millisecond})
+	if err != nil {
+		t.Fatalf("export failed: %v", err)
+	}
+
+	var traces otlpTraces
+	err = json.Unmarshal(buf.Bytes(), &traces)
+	if err != nil {
+		t.Fatalf("failed to parse exported traces: %v", err)
+	}
+	if len(traces.ResourceSpans) != 1 || len(traces.ResourceSpans[0].ScopeSpans) != 1 {
+		t.Fatalf("unexpected structure: %s", buf.String())
+	}
+	spans := traces.ResourceSpans[0].ScopeSpans[0].Spans
+	// one root span per partition plus one span per operation
+	if len(spans) != 2+len(ops) {
+		t.Fatalf("expected %d spans, got %d", 2+len(ops), len(spans))
+	}
+	traceIds := make(map[string]bool)
+	byName := make(map[string]otlpSpan)
+	for _, span := range spans {
+		traceIds[span.TraceId] = true
+		byName[span.Name] = span
+		if len(span.TraceId) != 32 || len(span.SpanId) != 16 {
+			t.Fatalf("invalid ids in span %+v", span)
+		}
+	}
+	if len(traceIds) != 2 {
+		t.Fatalf("expected one trace per partition, got %d traces", len(traceIds))
+	}
+
+	put := byName["put('x', 'y')"]
+	attrs := otlpAttributes(put)
+	if *attrs["porcupine.client_id"].IntValue != "0" || !*attrs["porcupine.linearized"].BoolValue || put.Status != nil {
+		t.Fatalf("unexpected attributes for put: %+v", put)
+	}
+	if put.StartTimeUnixNano != "1700000000000000000" || put.EndTimeUnixNano != "1700000000010000000" {
+		t.Fatalf("unexpected times for put: %s - %s", put.StartTimeUnixNano, put.EndTimeUnixNano)
+	}
+	if put.ParentSpanId != byName["partition 0"].SpanId || put.TraceId != byName["partition 0"].TraceId {
+		t.Fatalf("expected put to be a child of the partition span")
+	}
+
+	get := byName["get('x') -> 'z'"]
+	attrs = otlpAttributes(get)
+	if *attrs["porcupine.client_id"].IntValue != "1" || *attrs["porcupine.linearized"].BoolValue || get.Status == nil || get.Status.Code != otlpStatusError {
+		t.Fatalf("unexpected attributes for get: %+v", get)
+	}
+
+	root := byName["partition 1"]
+	if !*otlpAttributes(root)["porcupine.linearized"].BoolValue || root.Status != nil {
+		t.Fatalf("expected partition 1 to be linearized: %+v", root)
+	}
+}
+
+func TestExportOTLPEvents(t *testing.T) {
+	events := parseJepsenLog("test_data/jepsen/etcd_070.log")
+	_, info := CheckEventsVerbose(etcdModel, events, 0)
+	var buf bytes.Buffer
+	err := ExportOTLP(etcdModel, info, &buf, ExportOptions{Unit: time.Microsecond})
+	if err != nil {
+		t.Fatalf("export failed: %v", err)
+	}
+	var traces otlpTraces
+	err = json.Unmarshal(buf.Bytes(), &traces)
+	if err != nil {
+		t.Fatalf("failed to parse exported traces: %v", err)
+	}
+	spans := traces.ResourceSpans[0].ScopeSpans[0].Spans
+	if len(spans) != 1+len(events)/2 {
+		t.Fatalf("expected %d spans, got %d", 1+len(events)/2, len(spans))
+	}
+}
@@ -0,0 +1,249 @@
+package porcupine
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+)
+
+// A Span is a span of a trace, with the fields needed to build an operation
+// from it.
+type Span struct {
+	TraceId      string
+	SpanId       string
+	ParentSpanId string
+	Name         string
+	// Start and End are in nanoseconds since the Unix epoch. End is 0 for
+	// spans that never ended.
+	Start int64
+	End   int64
+	// Attributes maps attribute keys to values, which are strings, bools,
+	// int64s, float64s, or []interface{} of those.
+	Attributes map[string]interface{}
+	Events     []SpanEvent
+}
+
+// A SpanEvent is an event recorded during a [Span].
+type SpanEvent struct {
+	Name string
+	// Time is in nanoseconds since the Unix epoch.
+	Time       int64
+	Attributes map[string]interface{}
+}
+
+// SpanImportOptions configure how [ImportOTLP] and [SpansToOperations] build
+// operations from spans.
+type SpanImportOptions struct {
+	// ClientAttribute is the attribute that holds the client id of a span,
+	// as an integer or a string containing an integer. If it is empty,
+	// "porcupine.client_id" is used, as written by [ExportOTLP].
+	ClientAttribute string
+	// Convert extracts the input and output of an operation from a span.
+	// If it returns an error, the span is skipped, with the error as the
+	// reason. It is required.
+	Convert func(span Span) (input interface{}, output interface{}, err error)
+}
+
+// A SkippedSpan is a span that didn't produce an operation.
+type SkippedSpan struct {
+	TraceId string
+	SpanId  string
+	Name    string
+	Reason  string
+}
+
+// A SpanImportReport describes the spans that [ImportOTLP] and
+// [SpansToOperations] couldn't turn into complete operations.
+type SpanImportReport struct {
+	Skipped []SkippedSpan
+	// Pending lists the indices of the operations built from spans that
+	// never ended.
+	Pending []int
+}
+
+// ImportOTLP reads traces in the OTLP/JSON format, as written by OpenTelemetry
+// exporters, and builds a history with an operation for each span, using
+// [SpansToOperations].
+func ImportOTLP(input io.Reader, opts SpanImportOptions) ([]Operation, SpanImportReport, error) {
+	var traces otlpTraces
+	if err := json.NewDecoder(input).Decode(&traces); err != nil {
+		return nil, SpanImportReport{}, fmt.Errorf("porcupine: %w", err)
+	}
+	var spans []Span
+	for _, rs := range traces.ResourceSpans {
+		for _, ss := range rs.ScopeSpans {
+			for _, s := range ss.Spans {
+				span, err := s.span()
+				if err != nil {
+					return nil, SpanImportReport{}, fmt.Errorf("porcupine: %w (span %s)", err, s.SpanId)
+				}
+				spans = append(spans, span)
+			}
+		}
+	}
+	return SpansToOperations(spans, opts)
+}
+
+// SpansToOperations builds a history with an operation for each span, in the
+// order of the spans. The call and return times of an operation are the start
+// and end of its span, its client id is the value of the span's client
+// attribute, and its input and output are extracted by opts.Convert.
+//
+// Spans without the client attribute, with an invalid one, that end before
+// they start, or that Convert rejects are skipped and listed in the report,
+// so unrelated spans in the same traces are ignored.
+//
+// A span that never ended becomes a pending operation: its output is nil, no
+// matter what Convert returns, and it returns after every other operation in
+// the history. The model must accept a nil output for such operations.
+//
+// It returns an error if opts.Convert is nil.
+func SpansToOperations(spans []Span, opts SpanImportOptions) ([]Operation, SpanImportReport, error) {
+	var report SpanImportReport
+	if opts.Convert == nil {
+		return nil, report, fmt.Errorf("porcupine: SpanImportOptions.Convert is required")
+	}
+	attribute := opts.ClientAttribute
+	if attribute == "" {
+		attribute = "porcupine.client_id"
+	}
+	skip := func(span Span, format string, args ...interface{}) {
+		report.Skipped = append(report.Skipped, SkippedSpan{
+			TraceId: span.TraceId,
+			SpanId:  span.SpanId,
+			Name:    span.Name,
+			Reason:  fmt.Sprintf(format, args...),
+		})
+	}
+
+	var ops []Operation
+	var last int64
+	for _, span := range spans {
+		value, ok := span.Attributes[attribute]
+		if !ok {
+			skip(span, "missing attribute %q", attribute)
+			continue
+		}
+		client, ok := spanClientId(value)
+		if !ok {
+			skip(span, "attribute %q has an invalid client id %v", attribute, value)
+			continue
+		}
+		pending := span.End == 0
+		if !pending && span.End < span.Start {
+			skip(span, "span ends at %d, before it starts at %d", span.End, span.Start)
+			continue
+		}
+		input, output, err := opts.Convert(span)
+		if err != nil {
+			skip(span, "%v", err)
+			continue
+		}
+		if span.Start > last {
+			last = span.Start
+		}
+		if pending {
+			report.Pending = append(report.Pending, len(ops))
+			output = nil
+		} else if span.End > last {
+			last = span.End
+		}
+		ops = append(ops, Operation{ClientId: client, Input: input, Call: span.Start, Output: output, Return: span.End})
+	}
+	for _, i := range report.Pending {
+		ops[i].Return = last + 1
+	}
+	return ops, report, nil
+}
+
+func spanClientId(value interface{}) (int, bool) {
+	switch v := value.(type) {
+	case int64:
+		return int(v), true
+	case string:
+		n, err := strconv.Atoi(v)
+		return n, err == nil
+	default:
+		return 0, false
+	}
+}
+
+func (s otlpSpan) span() (Span, error) {
+	start, err := s.StartTimeUnixNano.int64()
+	if err != nil {
+		return Span{}, fmt.Errorf("invalid start time %q", s.StartTimeUnixNano)
+	}
+	var end int64
+	if s.EndTimeUnixNano != "" {
+		if end, err = s.EndTimeUnixNano.int64(); err != nil {
+			return Span{}, fmt.Errorf("invalid end time %q", s.EndTimeUnixNano)
+		}
+	}
+	attributes, err := otlpAttributeMap(s.Attributes)
+	if err != nil {
+		return Span{}, err
+	}
+	span := Span{
+		TraceId:      s.TraceId,
+		SpanId:       s.SpanId,
+		ParentSpanId: s.ParentSpanId,
+		Name:         s.Name,
+		Start:        start,
+		End:          end,
+		Attributes:   attributes,
+	}
+	for _, e := range s.Events {
+		t, err := e.TimeUnixNano.int64()
+		if err != nil {
+			return Span{}, fmt.Errorf("invalid time %q of event %q", e.TimeUnixNano, e.Name)
+		}
+		attributes, err := otlpAttributeMap(e.Attributes)
+		if err != nil {
+			return Span{}, err
+		}
+		span.Events = append(span.Events, SpanEvent{Name: e.Name, Time: t, Attributes: attributes})
+	}
+	return span, nil
+}
+
+func otlpAttributeMap(kvs []otlpKeyValue) (map[string]interface{}, error) {
+	attributes := make(map[string]interface{}, len(kvs))
+	for _, kv := range kvs {
+		v, err := kv.Value.value()
+		if err != nil {
+			return nil, fmt.Errorf("%w (attribute %q)", err, kv.Key)
+		}
+		attributes[kv.Key] = v
+	}
+	return attributes, nil
+}
+
+func (v otlpAnyValue) value() (interface{}, error) {
+	switch {
+	case v.StringValue != nil:
+		return *v.StringValue, nil
+	case v.BoolValue != nil:
+		return *v.BoolValue, nil
+	case v.IntValue != nil:
+		n, err := v.IntValue.int64()
+		if err != nil {
+			return nil, fmt.Errorf("invalid integer %q", *v.IntValue)
+		}
+		return n, nil
+	case v.DoubleValue != nil:
+		return *v.DoubleValue, nil
+	case v.ArrayValue != nil:
+		values := make([]interface{}, len(v.ArrayValue.Values))
+		for i, elem := range v.ArrayValue.Values {
+			var err error
+			if values[i], err = elem.value(); err != nil {
+				return nil, err
+			}
+		}
+		return values, nil
+	default:
+		// unsupported kinds, such as kvlistValue and bytesValue
+		return nil, nil
+	}
+}
@@ -0,0 +1,138 @@
+package porcupine
+
+import (
+	"bytes"
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestImportOTLPRoundTrip(t *testing.T) {
+	ops := []Operation{
+		{0, kvInput{op: 1, key: "x", value: "y"}, 0, kvOutput{}, 10},
+		{1, kvInput{op: 0, key: "x"}, 20, kvOutput{"y"}, 30},
+		{2, kvInput{op: 1, key: "y", value: "a"}, 5, kvOutput{}, 15},
+	}
+	_, info := CheckOperationsVerbose(kvModel, ops, 0)
+	var buf bytes.Buffer
+	if err := ExportOTLP(kvModel, info, &buf, ExportOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	imported, report, err := ImportOTLP(&buf, SpanImportOptions{
+		Convert: func(span Span) (interface{}, interface{}, error) {
+			return span.Name, nil, nil
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// the partition spans have no client id
+	if len(report.Skipped) != 2 || report.Skipped[0].Reason != `missing attribute "porcupine.client_id"` {
+		t.Fatalf("expected partition spans to be skipped, got %+v", report.Skipped)
+	}
+	if len(imported) != len(ops) {
+		t.Fatalf("expected %d operations, got %d", len(ops), len(imported))
+	}
+	expected := map[string]Operation{
+		"put('x', 'y')":   ops[0],
+		"get('x') -> 'y'": ops[1],
+		"put('y', 'a')":   ops[2],
+	}
+	for _, op := range imported {
+		e, ok := expected[op.Input.(string)]
+		if !ok {
+			t.Fatalf("unexpected operation %+v", op)
+		}
+		if op.ClientId != e.ClientId || op.Call != e.Call || op.Return != e.Return {
+			t.Fatalf("expected %+v, got %+v", e, op)
+		}
+	}
+}
+
+func TestImportOTLP(t *testing.T) {
+	input := `{"resourceSpans": [{"scopeSpans": [{"spans": [
+		{"spanId": "01", "name": "request", "startTimeUnixNano": "0", "endTimeUnixNano": "1000"},
+		{"spanId": "02", "name": "write", "startTimeUnixNano": "100", "endTimeUnixNano": "200",
+		 "attributes": [{"key": "client", "value": {"stringValue": "0"}}, {"key": "value", "value": {"intValue": "1"}}]},
+		{"spanId": "03", "name": "write", "startTimeUnixNano": 300,
+		 "attributes": [{"key": "client", "value": {"intValue": 1}}, {"key": "value", "value": {"intValue": 2}}]},
+		{"spanId": "04", "name": "read", "startTimeUnixNano": "400", "endTimeUnixNano": "500",
+		 "attributes": [{"key": "client", "value": {"intValue": "2"}}],
+		 "events": [{"name": "response", "timeUnixNano": "490", "attributes": [{"key": "value", "value": {"intValue": "2"}}]}]},
+		{"spanId": "05", "name": "cas", "startTimeUnixNano": "600", "endTimeUnixNano": "700",
+		 "attributes": [{"key": "client", "value": {"intValue": "3"}}]},
+		{"spanId": "06", "name": "read", "startTimeUnixNano": "800", "endTimeUnixNano": "700",
+		 "attributes": [{"key": "client", "value": {"intValue": "4"}}]},
+		{"spanId": "07", "name": "read", "startTimeUnixNano": "800", "endTimeUnixNano": "900",
+		 "attributes": [{"key": "client", "value": {"doubleValue": 1.5}}]}
+	]}]}]}`
+	ops, report, err := ImportOTLP(strings.NewReader(input), SpanImportOptions{
+		ClientAttribute: "client",
+		Convert: func(span Span) (interface{}, interface{}, error) {
+			switch span.Name {
+			case "write":
+				v := int(span.Attributes["value"].(int64))
+				return registerInput{false, v}, 0, nil
+			case "read":
+				for _, e := range span.Events {
+					if e.Name == "response" {
+						return registerInput{true, 0}, int(e.Attributes["value"].(int64)), nil
+					}
+				}
+				return nil, nil, errors.New("no response")
+			default:
+				return nil, nil, errors.New("unknown operation")
+			}
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(ops) != 3 {
+		t.Fatalf("expected 3 operations, got %+v", ops)
+	}
+	reasons := []string{
+		`missing attribute "client"`,
+		"unknown operation",
+		"span ends at 700, before it starts at 800",
+		`attribute "client" has an invalid client id 1.5`,
+	}
+	if len(report.Skipped) != len(reasons) {
+		t.Fatalf("expected %d skipped spans, got %+v", len(reasons), report.Skipped)
+	}
+	for i, reason := range reasons {
+		if report.Skipped[i].Reason != reason {
+			t.Fatalf("expected reason %q, got %q", reason, report.Skipped[i].Reason)
+		}
+	}
+	if len(report.Pending) != 1 || report.Pending[0] != 1 {
+		t.Fatalf("expected operation 1 to be pending, got %v", report.Pending)
+	}
+	if pending := ops[1]; pending.Output != nil || pending.Call != 300 || pending.Return != 501 {
+		t.Fatalf("unexpected pending operation %+v", pending)
+	}
+	if ops[0].ClientId != 0 || ops[2].ClientId != 2 || ops[2].Output != 2 {
+		t.Fatalf("unexpected operations %+v", ops)
+	}
+	// the read can only be explained by the pending write
+	if !CheckOperations(pendingRegisterModel, ops) {
+		t.Fatal("expected history to be linearizable")
+	}
+}
+
+func TestImportOTLPErrors(t *testing.T) {
+	convert := func(span Span) (interface{}, interface{}, error) { return nil, nil, nil }
+	if _, _, err := SpansToOperations(nil, SpanImportOptions{}); err == nil {
+		t.Fatal("expected an error without Convert")
+	}
+	_, _, err := ImportOTLP(strings.NewReader(`{"resourceSpans": [{"scopeSpans": [{"spans": [
+		{"spanId": "01", "startTimeUnixNano": "soon"}]}]}]}`), SpanImportOptions{Convert: convert})
+	if err == nil || !strings.Contains(err.Error(), `invalid start time "soon" (span 01)`) {
+		t.Fatalf("expected an invalid time error, got %v", err)
+	}
+	_, _, err = ImportOTLP(strings.NewReader(`{"resourceSpans": [{"scopeSpans": [{"spans": [
+		{"spanId": "01", "startTimeUnixNano": "0", "attributes": [{"key": "n", "value": {"intValue": "x"}}]}]}]}]}`), SpanImportOptions{Convert: convert})
+	if err == nil || !strings.Contains(err.Error(), `invalid integer "x" (attribute "n")`) {
+		t.Fatalf("expected an invalid attribute error, got %v", err)
+	}
+}
@@ -0,0 +1,49 @@
+package porcupine
+
+// CompletePending completes a history of events that has calls without
+// returns, such as a history recorded by a test that stopped while some
+// operations were still in progress. For each such call, in the order of the
+// calls, makeReturn returns the value of its return event, and whether to
+// include the operation: if include is true, a return event with the value is
+// appended at the end of the history, so that the operation may take effect
+// at any point after its call, and otherwise the call is removed from the
+// history.
+//
+// The value of the return event must be accepted by the model as any
+// possible outcome of the operation. Models that support pending operations
+// accept a nil output for this, while other models can encode an unknown
+// outcome in their output type; a zero value of the output type is often
+// the wrong choice, since the model may interpret it as a specific outcome.
+//
+// Calls are matched with returns by their Id. The result has a return for
+// every call, so it's well-formed, as checked by [ValidateEvents], unless
+// events has other problems. The events are not modified.
+func CompletePending(events []Event, makeReturn func(call Event) (value interface{}, include bool)) []Event {
+	returned := make(map[int]bool)
+	for _, event := range events {
+		if event.Kind == ReturnEvent {
+			returned[event.Id] = true
+		}
+	}
+	dropped := make(map[int]bool)
+	var returns []Event
+	for _, event := range events {
+		if event.Kind != CallEvent || returned[event.Id] {
+			continue
+		}
+		value, include := makeReturn(event)
+		if !include {
+			dropped[event.Id] = true
+			continue
+		}
+		returns = append(returns, Event{ClientId: event.ClientId, Kind: ReturnEvent, Value: value, Id: event.Id})
+	}
+	completed := make([]Event, 0, len(events)+len(returns))
+	for _, event := range events {
+		if event.Kind == CallEvent && dropped[event.Id] {
+			continue
+		}
+		completed = append(completed, event)
+	}
+	return append(completed, returns...)
+}
@@ -0,0 +1,54 @@
+package porcupine
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestCompletePending(t *testing.T) {
+	events := []Event{
+		{0, CallEvent, registerInput{false, 1}, 0},
+		{1, CallEvent, registerInput{true, 0}, 1},
+		{2, CallEvent, registerInput{false, 2}, 2},
+		{0, ReturnEvent, 0, 0},
+		{3, CallEvent, registerInput{true, 0}, 3},
+	}
+	var calls []int
+	completed := CompletePending(events, func(call Event) (interface{}, bool) {
+		calls = append(calls, call.Id)
+		// reads without a return can be left out
+		if call.Value.(registerInput).op {
+			return nil, false
+		}
+		return 0, true
+	})
+	expected := []Event{
+		{0, CallEvent, registerInput{false, 1}, 0},
+		{2, CallEvent, registerInput{false, 2}, 2},
+		{0, ReturnEvent, 0, 0},
+		{2, ReturnEvent, 0, 2},
+	}
+	if !reflect.DeepEqual(completed, expected) {
+		t.Fatalf("expected %v, got %v", expected, completed)
+	}
+	if !reflect.DeepEqual(calls, []int{1, 2, 3}) {
+		t.Fatalf("expected makeReturn to be called for pending calls in order, got %v", calls)
+	}
+	if issues := ValidateEvents(completed); len(issues) != 0 {
+		t.Fatalf("expected a well-formed history, got %v", issues)
+	}
+	if len(events) != 5 || events[1].Id != 1 {
+		t.Fatal("expected events to be unchanged")
+	}
+}
+
+func TestCompletePendingJepsen(t *testing.T) {
+	// the parser completes pending calls with CompletePending
+	events := parseJepsenLog("test_data/jepsen/etcd_002.log")
+	if issues := ValidateEvents(events); len(issues) != 0 {
+		t.Fatalf("expected a well-formed history, got %v", issues)
+	}
+	if again := CompletePending(events, nil); !reflect.DeepEqual(again, events) {
+		t.Fatal("expected a complete history to be unchanged")
+	}
+}
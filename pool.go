@@ -0,0 +1,119 @@
+package porcupine
+
+import "sync"
+
+// The cache of checkSingle holds a set of operations and a state for every
+// state that the search reaches. Allocating each one separately makes long
+// checks spend much of their time in GC, so the search allocates them from
+// large chunks, and returns the chunks to pools when it's done, so that later
+// checks, and other partitions, reuse them.
+
+// chunkSize is the number of elements in a pooled chunk.
+const chunkSize = 4096
+
+var (
+	wordChunks  = sync.Pool{New: func() interface{} { c := make([]uint64, chunkSize); return &c }}
+	entryChunks = sync.Pool{New: func() interface{} { c := make([]cachedState, chunkSize); return &c }}
+	nodeSlices  = sync.Pool{New: func() interface{} { return new([]node) }}
+)
+
+// A searchAllocator allocates the sets of operations and cache entries of one
+// search, and the nodes of its history. In arena mode, the cache allocates
+// its entries from slabs instead (see cacheSlab), which are released along
+// with the rest.
+type searchAllocator struct {
+	arena           bool
+	words           []uint64 // the rest of the current chunk of words
+	entries         []cachedState
+	wordChunks      []*[]uint64
+	entryChunks     []*[]cachedState
+	slabEntryChunks []*[]slabEntry
+	slabStateChunks []*[]interface{}
+	nodes           *[]node
+}
+
+// newNodes returns n zeroed nodes.
+func (a *searchAllocator) newNodes(n int) []node {
+	a.nodes = nodeSlices.Get().(*[]node)
+	if cap(*a.nodes) < n {
+		*a.nodes = make([]node, n)
+	}
+	return (*a.nodes)[:n]
+}
+
+// cloneWords returns a copy of words, which is valid until release is called.
+func (a *searchAllocator) cloneWords(words []uint64) []uint64 {
+	if len(words) == 0 {
+		return nil
+	}
+	if len(words) > chunkSize {
+		return append([]uint64(nil), words...)
+	}
+	if len(a.words) < len(words) {
+		chunk := wordChunks.Get().(*[]uint64)
+		a.wordChunks = append(a.wordChunks, chunk)
+		a.words = *chunk
+	}
+	c := a.words[:len(words):len(words)]
+	a.words = a.words[len(words):]
+	copy(c, words)
+	return c
+}
+
+// appendCacheEntry appends e to a cache bucket, like append, but when the
+// bucket is full, it moves it to a larger space in a chunk, which is valid
+// until release is called. Buckets double in size, like with append, so at
+// most half of the space in chunks is left over from buckets that moved.
+func (a *searchAllocator) appendCacheEntry(bucket []cachedState, e cachedState) []cachedState {
+	if len(bucket) < cap(bucket) {
+		return append(bucket, e)
+	}
+	size := 2 * cap(bucket)
+	if size == 0 {
+		size = 1
+	}
+	if size > chunkSize {
+		return append(bucket, e)
+	}
+	if len(a.entries) < size {
+		chunk := entryChunks.Get().(*[]cachedState)
+		a.entryChunks = append(a.entryChunks, chunk)
+		a.entries = *chunk
+	}
+	moved := a.entries[:len(bucket):size]
+	a.entries = a.entries[size:]
+	copy(moved, bucket)
+	return append(moved, e)
+}
+
+// release returns everything that was allocated to the pools. Chunks that
+// hold pointers are cleared first, so that pooled chunks don't keep states
+// and values alive.
+func (a *searchAllocator) release() {
+	for _, chunk := range a.wordChunks {
+		wordChunks.Put(chunk)
+	}
+	for _, chunk := range a.entryChunks {
+		for i := range *chunk {
+			(*chunk)[i] = cachedState{}
+		}
+		entryChunks.Put(chunk)
+	}
+	for _, chunk := range a.slabEntryChunks {
+		slabEntryChunks.Put(chunk)
+	}
+	for _, chunk := range a.slabStateChunks {
+		for i := range *chunk {
+			(*chunk)[i] = nil
+		}
+		slabStateChunks.Put(chunk)
+	}
+	if a.nodes != nil {
+		nodes := (*a.nodes)[:cap(*a.nodes)]
+		for i := range nodes {
+			nodes[i] = node{}
+		}
+		nodeSlices.Put(a.nodes)
+	}
+	*a = searchAllocator{}
+}
@@ -1,10 +1,124 @@
 package porcupine
 
-import "time"
+import (
+	"context"
+	"io"
+	"time"
+)
+
+// CheckOptions configures [CheckOperationsWithOptions] and
+// [CheckEventsWithOptions]. The zero value checks without a timeout.
+type CheckOptions struct {
+	// Timeout for the check. A timeout of 0 is interpreted as an
+	// unlimited timeout.
+	Timeout time.Duration
+	// If SnapshotFunc is set and SnapshotEvery is positive, SnapshotFunc
+	// is called every SnapshotEvery with a snapshot of the progress of
+	// the check so far: the longest partial linearizations that have been
+	// found for each partition. Snapshots can be passed to [Visualize]
+	// to inspect long-running checks before they finish.
+	//
+	// SnapshotFunc is called from the goroutine that runs the check, and
+	// it does not race with the search, which continues in the
+	// background while SnapshotFunc runs.
+	SnapshotEvery time.Duration
+	SnapshotFunc  func(info LinearizationInfo)
+	// DetectStateMutation makes the check verify that the model's Step
+	// function doesn't modify the state it's given, by fingerprinting all
+	// of the data reachable from the state before and after every call.
+	// If Step modifies it, the check stops with an Unknown result, and
+	// [LinearizationInfo.Err] returns a [*StateMutationError] that
+	// identifies the operation. This makes
+	// checks much slower, so it's meant for debugging: it's the first
+	// thing to try when the result of checking the same history changes
+	// from run to run.
+	DetectStateMutation bool
+	// LabelCallbacks makes the check label every call to the model's Step
+	// and Equal functions with the profiler label [CallbackLabel], so
+	// that a CPU profile separates the time spent in the model from the
+	// time spent in the search. The goroutine that checks each partition
+	// is always labeled with [PartitionLabel] and [OperationsLabel], but
+	// labeling every call has a cost, which is significant for models
+	// whose functions are cheap, so it is off by default.
+	LabelCallbacks bool
+	// ArenaAllocation makes the search of each partition keep its cache
+	// in large slabs, whose entries refer to each other by index rather
+	// than by pointer, instead of in a map. The entries are smaller, and
+	// the garbage collector doesn't scan them, which makes checks that
+	// reach millions of states use less memory and spend less time in
+	// GC, and the slabs are released together when the partition is
+	// done. Walking the entries is slower than walking the map, though,
+	// which shows when many states share a hash, such as long strings
+	// that differ only in the middle. The result of the check is the same
+	// either way.
+	ArenaAllocation bool
+	// RecordCoverage makes the check count the classes of operations
+	// along the longest linearization of each partition, as classified by
+	// the model's ClassifyOperation function, to show how much of the
+	// model's behavior the history exercised. The counts are available
+	// from [LinearizationInfo.Partitions] and
+	// [LinearizationInfo.Coverage], and as a text report from
+	// [LinearizationInfo.WriteCoverageReport].
+	RecordCoverage bool
+	// If DifficultyWarning is set, it is called before the check starts,
+	// with the estimate of [EstimateDifficulty], if the history is
+	// estimated to be DifficultyHard or worse to check, so that hopeless
+	// checks can be reported, or skipped, before the timeout expires.
+	DifficultyWarning func(report DifficultyReport)
+	// TraceSearch makes the check record the tree of decisions that the
+	// checker made while searching for a linearization of the partition
+	// with index TracePartition: each operation that it tried to
+	// linearize next, the state it tried it in, and whether the model
+	// accepted it, rejected it, or led to a state that had already been
+	// explored. The trace is available from
+	// [LinearizationInfo.SearchTrace], and shows why a history that was
+	// expected to be linearizable was rejected. At most TraceLimit
+	// decisions are recorded, or 10000 if TraceLimit is 0, since the
+	// search can make many more, and each decision describes two states.
+	TraceSearch    bool
+	TracePartition int
+	TraceLimit     int
+	// RecordCache makes the check keep the states that its search found
+	// to be dead ends, so that [LinearizationInfo.SaveCache] can save
+	// them for a later check of the same history.
+	RecordCache bool
+	// If WarmCache is set, the check reads a cache saved by
+	// [LinearizationInfo.SaveCache] from it, and seeds the search of each
+	// partition with the dead ends that were saved for a partition with
+	// the same history, so that checking the same history again, such as
+	// one recorded by a workload that is replayed, doesn't explore them
+	// again. Partitions are matched by a fingerprint of their operations,
+	// which must be plain values or of types registered with
+	// [RegisterType], and the cache is ignored if it was saved for a
+	// model with a different initial state. Entries that don't match or
+	// can't be decoded are dropped, which never changes the result of the
+	// check, but a cache saved with a different model that has the same
+	// initial state can.
+	WarmCache io.Reader
+	// CacheCodec serializes states for RecordCache and WarmCache. The
+	// zero value uses the type registry (see [StateCodec]).
+	CacheCodec StateCodec
+	// If CheckpointWriter is set and CheckpointEvery is positive, the check
+	// writes a checkpoint of its progress every CheckpointEvery, and when
+	// it times out or Context is done, so that it can be resumed with
+	// [ResumeFromCheckpoint] or [ResumeEventsFromCheckpoint], in this
+	// process or another one. CheckpointWriter is called for each
+	// checkpoint, which is complete when the writer it returns is closed
+	// without an error; [CheckpointFile] keeps the latest checkpoint in a
+	// file. States are encoded with CacheCodec, and the inputs and outputs
+	// of the history must be fingerprintable, as for WarmCache. Errors
+	// don't stop the check, and the first one is available from
+	// [LinearizationInfo.CheckpointError].
+	CheckpointEvery  time.Duration
+	CheckpointWriter func() (io.WriteCloser, error)
+	// If Context is set, the check stops when it is done, like it does
+	// when it times out.
+	Context context.Context
+}
 
 // CheckOperations checks whether a history is linearizable.
 func CheckOperations(model Model, history []Operation) bool {
-	res, _ := checkOperations(model, history, false, 0)
+	res, _ := checkOperations(model, history, false, CheckOptions{})
 	return res == Ok
 }
 
@@ -13,7 +127,7 @@ func CheckOperations(model Model, history []Operation) bool {
 //
 // A timeout of 0 is interpreted as an unlimited timeout.
 func CheckOperationsTimeout(model Model, history []Operation, timeout time.Duration) CheckResult {
-	res, _ := checkOperations(model, history, false, timeout)
+	res, _ := checkOperations(model, history, false, CheckOptions{Timeout: timeout})
 	return res
 }
 
@@ -22,12 +136,18 @@ func CheckOperationsTimeout(model Model, history []Operation, timeout time.Durat
 //
 // The returned LinearizationInfo can be used with [Visualize].
 func CheckOperationsVerbose(model Model, history []Operation, timeout time.Duration) (CheckResult, LinearizationInfo) {
-	return checkOperations(model, history, true, timeout)
+	return checkOperations(model, history, true, CheckOptions{Timeout: timeout})
+}
+
+// CheckOperationsWithOptions checks whether a history is linearizable, like
+// [CheckOperationsVerbose], with the given options.
+func CheckOperationsWithOptions(model Model, history []Operation, opts CheckOptions) (CheckResult, LinearizationInfo) {
+	return checkOperations(model, history, true, opts)
 }
 
 // CheckEvents checks whether a history is linearizable.
 func CheckEvents(model Model, history []Event) bool {
-	res, _ := checkEvents(model, history, false, 0)
+	res, _ := checkEvents(model, history, false, CheckOptions{})
 	return res == Ok
 }
 
@@ -35,7 +155,7 @@ func CheckEvents(model Model, history []Event) bool {
 //
 // A timeout of 0 is interpreted as an unlimited timeout.
 func CheckEventsTimeout(model Model, history []Event, timeout time.Duration) CheckResult {
-	res, _ := checkEvents(model, history, false, timeout)
+	res, _ := checkEvents(model, history, false, CheckOptions{Timeout: timeout})
 	return res
 }
 
@@ -44,5 +164,11 @@ func CheckEventsTimeout(model Model, history []Event, timeout time.Duration) Che
 //
 // The returned LinearizationInfo can be used with [Visualize].
 func CheckEventsVerbose(model Model, history []Event, timeout time.Duration) (CheckResult, LinearizationInfo) {
-	return checkEvents(model, history, true, timeout)
+	return checkEvents(model, history, true, CheckOptions{Timeout: timeout})
+}
+
+// CheckEventsWithOptions checks whether a history is linearizable, like
+// [CheckEventsVerbose], with the given options.
+func CheckEventsWithOptions(model Model, history []Event, opts CheckOptions) (CheckResult, LinearizationInfo) {
+	return checkEvents(model, history, true, opts)
 }
@@ -2,14 +2,17 @@ package porcupine
 
 import (
 	"bufio"
+	"bytes"
 	"fmt"
 	"io"
 	"os"
 	"reflect"
 	"regexp"
+	"runtime"
 	"sort"
 	"strconv"
 	"testing"
+	"time"
 )
 
 type registerInput struct {
@@ -47,7 +50,8 @@ var registerModel = Model{
 
 func TestRegisterModel(t *testing.T) {
 	// examples taken from http://nil.csail.mit.edu/6.824/2017/quizzes/q2-17-ans.pdf
-	// section VII
+	// section VII; models/register_test.go checks models.Register against
+	// the same ones
 
 	ops := []Operation{
 		{0, registerInput{false, 100}, 0, 0, 100},
@@ -98,6 +102,279 @@ func TestRegisterModel(t *testing.T) {
 	}
 }
 
+type ndRegisterOutput struct {
+	value    int  // for get
+	timedOut bool // for put
+}
+
+// a register where a put can time out, in which case it may or may not have
+// taken effect
+var ndRegisterModel = NondeterministicModel{
+	Init: func() []interface{} {
+		return []interface{}{0}
+	},
+	Step: func(state, input, output interface{}) []interface{} {
+		inp := input.(registerInput)
+		out := output.(ndRegisterOutput)
+		if inp.op == false {
+			// put
+			if out.timedOut {
+				return []interface{}{state, inp.value}
+			}
+			return []interface{}{inp.value}
+		}
+		// get
+		if out.value == state {
+			return []interface{}{state}
+		}
+		return nil
+	},
+	DescribeOperation: func(input, output interface{}) string {
+		inp := input.(registerInput)
+		out := output.(ndRegisterOutput)
+		if inp.op == false {
+			if out.timedOut {
+				return fmt.Sprintf("put('%d') -> timeout", inp.value)
+			}
+			return fmt.Sprintf("put('%d')", inp.value)
+		}
+		return fmt.Sprintf("get() -> '%d'", out.value)
+	},
+}
+
+func TestNondeterministicRegisterModel(t *testing.T) {
+	model := ndRegisterModel.ToModel()
+
+	// the timed-out put may not have taken effect
+	ops := []Operation{
+		{0, registerInput{false, 100}, 0, ndRegisterOutput{timedOut: true}, 5},
+		{1, registerInput{true, 0}, 10, ndRegisterOutput{value: 0}, 20},
+	}
+	if !CheckOperations(model, ops) {
+		t.Fatal("expected operations to be linearizable")
+	}
+
+	// or it may have
+	ops = []Operation{
+		{0, registerInput{false, 100}, 0, ndRegisterOutput{timedOut: true}, 5},
+		{1, registerInput{true, 0}, 10, ndRegisterOutput{value: 100}, 20},
+	}
+	if !CheckOperations(model, ops) {
+		t.Fatal("expected operations to be linearizable")
+	}
+
+	// but not both
+	ops = []Operation{
+		{0, registerInput{false, 100}, 0, ndRegisterOutput{timedOut: true}, 5},
+		{1, registerInput{true, 0}, 10, ndRegisterOutput{value: 100}, 20},
+		{1, registerInput{true, 0}, 30, ndRegisterOutput{value: 0}, 40},
+	}
+	if CheckOperations(model, ops) {
+		t.Fatal("expected operations not to be linearizable")
+	}
+
+	// a put that didn't time out must have taken effect
+	ops = []Operation{
+		{0, registerInput{false, 100}, 0, ndRegisterOutput{}, 5},
+		{1, registerInput{true, 0}, 10, ndRegisterOutput{value: 0}, 20},
+	}
+	if CheckOperations(model, ops) {
+		t.Fatal("expected operations not to be linearizable")
+	}
+}
+
+type ndKvInput struct {
+	key   string
+	op    bool // false = put, true = get
+	value int
+}
+
+// a key-value store where a put can time out, like ndRegisterModel; its
+// states are maps from keys to values, so it can be used with or without
+// partitioning by key
+var ndKvModel = NondeterministicModel{
+	Partition: func(history []Operation) [][]Operation {
+		m := make(map[string][]Operation)
+		var keys []string
+		for _, v := range history {
+			key := v.Input.(ndKvInput).key
+			if _, ok := m[key]; !ok {
+				keys = append(keys, key)
+			}
+			m[key] = append(m[key], v)
+		}
+		var ret [][]Operation
+		for _, key := range keys {
+			ret = append(ret, m[key])
+		}
+		return ret
+	},
+	Init: func() []interface{} {
+		return []interface{}{map[string]int{}}
+	},
+	Step: func(state, input, output interface{}) []interface{} {
+		st := state.(map[string]int)
+		inp := input.(ndKvInput)
+		out := output.(ndRegisterOutput)
+		if inp.op {
+			if out.value == st[inp.key] {
+				return []interface{}{st}
+			}
+			return nil
+		}
+		next := make(map[string]int, len(st)+1)
+		for k, v := range st {
+			next[k] = v
+		}
+		next[inp.key] = inp.value
+		if out.timedOut {
+			return []interface{}{st, next}
+		}
+		return []interface{}{next}
+	},
+	Equal: func(state1, state2 interface{}) bool {
+		return reflect.DeepEqual(state1, state2)
+	},
+}
+
+// ndKvHistory returns a history of operations on keys that are all
+// concurrent with each other, where the last get of the last key reads
+// lastRead.
+func ndKvHistory(keys int, lastRead int) []Operation {
+	var ops []Operation
+	for k := 0; k < keys; k++ {
+		key := strconv.Itoa(k)
+		last := 1
+		if k == keys-1 {
+			last = lastRead
+		}
+		ops = append(ops,
+			Operation{3 * k, ndKvInput{key, false, 1}, 0, ndRegisterOutput{timedOut: true}, 1000},
+			Operation{3*k + 1, ndKvInput{key, false, 2}, 10, ndRegisterOutput{}, 50},
+			Operation{3*k + 2, ndKvInput{key, true, 0}, 20, ndRegisterOutput{value: 2}, 60},
+			Operation{3*k + 1, ndKvInput{key, true, 0}, 70, ndRegisterOutput{value: last}, 80},
+		)
+	}
+	return ops
+}
+
+func TestNondeterministicPartition(t *testing.T) {
+	partitioned := ndKvModel.ToModel()
+	unpartitioned := ndKvModel
+	unpartitioned.Partition = nil
+	for _, lastRead := range []int{1, 2, 3} {
+		ops := ndKvHistory(3, lastRead)
+		res1, info := CheckOperationsVerbose(partitioned, ops, 0)
+		res2 := CheckOperationsTimeout(unpartitioned.ToModel(), ops, 0)
+		if res1 != res2 || (res1 == Ok) != (lastRead != 3) {
+			t.Fatalf("expected the same result, got %v partitioned and %v unpartitioned", res1, res2)
+		}
+		if len(info.Partitions()) != 3 {
+			t.Fatalf("expected 3 partitions, got %d", len(info.Partitions()))
+		}
+	}
+}
+
+func BenchmarkNondeterministicPartitioned(b *testing.B) {
+	model := ndKvModel.ToModel()
+	ops := ndKvHistory(4, 3)
+	for i := 0; i < b.N; i++ {
+		CheckOperations(model, ops)
+	}
+}
+
+func BenchmarkNondeterministicUnpartitioned(b *testing.B) {
+	unpartitioned := ndKvModel
+	unpartitioned.Partition = nil
+	model := unpartitioned.ToModel()
+	ops := ndKvHistory(4, 3)
+	for i := 0; i < b.N; i++ {
+		CheckOperations(model, ops)
+	}
+}
+
+// a register with puts of a value that isn't known, other than that it's
+// less than n, so that every put leads to n candidate states
+func putAnyModel(hash bool) NondeterministicModel {
+	model := NondeterministicModel{
+		Init: func() []interface{} {
+			return []interface{}{0}
+		},
+		Step: func(state, input, output interface{}) []interface{} {
+			inp := input.(registerInput)
+			if inp.op {
+				if output == state {
+					return []interface{}{state}
+				}
+				return nil
+			}
+			next := make([]interface{}, inp.value)
+			for i := range next {
+				next[i] = i
+			}
+			return next
+		},
+	}
+	if hash {
+		model.Hash = func(state interface{}) uint64 {
+			return uint64(state.(int))
+		}
+	}
+	return model
+}
+
+func TestNondeterministicDeduplication(t *testing.T) {
+	for _, hash := range []bool{false, true} {
+		model := putAnyModel(hash).ToModel()
+		state := model.Init()
+		for i := 0; i < 5; i++ {
+			var ok bool
+			// the candidates of every put are the same values
+			ok, state = model.Step(state, registerInput{false, 100}, nil)
+			if !ok || candidateCount(state) != 100 {
+				t.Fatalf("expected 100 candidates, got %d", candidateCount(state))
+			}
+			ok, state = model.Step(state, registerInput{true, 0}, 7)
+			if !ok || candidateCount(state) != 1 {
+				t.Fatalf("expected 1 candidate, got %d", candidateCount(state))
+			}
+			_, state = model.Step(state, registerInput{false, 100}, nil)
+		}
+		_, other := model.Step(model.Init(), registerInput{false, 100}, nil)
+		reversed := append(nondeterministicState(nil), other.(nondeterministicState)...)
+		for i, j := 0, len(reversed)-1; i < j; i, j = i+1, j-1 {
+			reversed[i], reversed[j] = reversed[j], reversed[i]
+		}
+		if !model.Equal(state, reversed) || model.Equal(state, other.(nondeterministicState)[1:]) {
+			t.Fatal("expected sets of candidates to be compared regardless of order")
+		}
+	}
+}
+
+func benchmarkPutAny(b *testing.B, hash bool) {
+	model := putAnyModel(hash).ToModel()
+	var ops []Operation
+	for i := 0; i < 20; i++ {
+		ops = append(ops,
+			Operation{0, registerInput{false, 1000}, int64(10 * i), nil, int64(10*i + 5)},
+			Operation{1, registerInput{true, 0}, int64(10*i + 2), i, int64(10*i + 8)},
+		)
+	}
+	for i := 0; i < b.N; i++ {
+		if !CheckOperations(model, ops) {
+			b.Fatal("expected operations to be linearizable")
+		}
+	}
+}
+
+func BenchmarkPutAnyEqual(b *testing.B) {
+	benchmarkPutAny(b, false)
+}
+
+func BenchmarkPutAnyHash(b *testing.B) {
+	benchmarkPutAny(b, true)
+}
+
 func TestZeroDuration(t *testing.T) {
 	ops := []Operation{
 		{0, registerInput{false, 100}, 0, 0, 100},
@@ -282,11 +559,9 @@ func parseJepsenLog(filename string) []Event {
 		}
 	}
 
-	for proc, matchId := range procIdMap {
-		events = append(events, Event{proc, ReturnEvent, etcdOutput{unknown: true}, matchId})
-	}
-
-	return events
+	return CompletePending(events, func(Event) (interface{}, bool) {
+		return etcdOutput{unknown: true}, true
+	})
 }
 
 func checkJepsen(t *testing.T, logNum int, correct bool) {
@@ -1323,11 +1598,9 @@ func parseKvLog(filename string) []Event {
 		}
 	}
 
-	for proc, matchId := range procIdMap {
-		events = append(events, Event{proc, ReturnEvent, kvOutput{}, matchId})
-	}
-
-	return events
+	return CompletePending(events, func(Event) (interface{}, bool) {
+		return kvOutput{}, true
+	})
 }
 
 func checkKv(t *testing.T, logName string, correct bool, partition bool) {
@@ -1433,6 +1706,35 @@ func BenchmarkKv50ClientsBad(b *testing.B) {
 	benchKv(b, "c50-bad", false, true)
 }
 
+// benchAllocs checks a history repeatedly, reporting the allocations per
+// check and per operation of the history, since allocations in the inner
+// loop of the checker make long checks spend much of their time in GC
+func benchAllocs(b *testing.B, model Model, events []Event) {
+	b.ReportAllocs()
+	var before, after runtime.MemStats
+	runtime.ReadMemStats(&before)
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		CheckEvents(model, events)
+	}
+	b.StopTimer()
+	runtime.ReadMemStats(&after)
+	b.ReportMetric(float64(after.Mallocs-before.Mallocs)/float64(b.N*len(events)/2), "allocs/histop")
+}
+
+func BenchmarkAllocsEtcdJepsen(b *testing.B) {
+	for i := 0; i < 10; i++ {
+		events := parseJepsenLog(fmt.Sprintf("test_data/jepsen/etcd_%03d.log", i))
+		b.Run(fmt.Sprintf("etcd_%03d", i), func(b *testing.B) {
+			benchAllocs(b, etcdModel, events)
+		})
+	}
+}
+
+func BenchmarkAllocsKv50Clients(b *testing.B) {
+	benchAllocs(b, kvModel, parseKvLog("test_data/kv/c50-ok.txt"))
+}
+
 func BenchmarkKvNoPartition1ClientOk(b *testing.B) {
 	benchKv(b, "c01-ok", true, false)
 }
@@ -1553,3 +1855,138 @@ func TestSetModel(t *testing.T) {
 		t.Fatal("expected operations not to be linearizable")
 	}
 }
+
+func TestSnapshots(t *testing.T) {
+	// a slow model, so that the check takes a while
+	model := registerModel
+	model.Step = func(state, input, output interface{}) (bool, interface{}) {
+		time.Sleep(time.Millisecond)
+		return registerModel.Step(state, input, output)
+	}
+	var ops []Operation
+	for i := 0; i < 50; i++ {
+		ops = append(ops, Operation{0, registerInput{false, i}, int64(2 * i), 0, int64(2*i + 1)})
+	}
+	var snapshots []LinearizationInfo
+	res, info := CheckOperationsWithOptions(model, ops, CheckOptions{
+		SnapshotEvery: 5 * time.Millisecond,
+		SnapshotFunc: func(info LinearizationInfo) {
+			snapshots = append(snapshots, info)
+		},
+	})
+	if res != Ok {
+		t.Fatal("expected operations to be linearizable")
+	}
+	if len(snapshots) == 0 {
+		t.Fatal("expected at least one snapshot")
+	}
+	prev := 0
+	for _, snapshot := range snapshots {
+		partials := snapshot.partialLinearizations[0]
+		if len(partials) == 0 {
+			continue
+		}
+		longest := len(partials[0])
+		for _, partial := range partials {
+			if len(partial) > longest {
+				longest = len(partial)
+			}
+		}
+		if longest < prev {
+			t.Fatalf("expected snapshots to make progress, got %d after %d", longest, prev)
+		}
+		prev = longest
+		var buf bytes.Buffer
+		err := Visualize(model, snapshot, &buf)
+		if err != nil {
+			t.Fatalf("failed to visualize snapshot: %v", err)
+		}
+	}
+	if prev == 0 {
+		t.Fatal("expected snapshots of partial progress")
+	}
+	if len(info.partialLinearizations[0][0]) != len(ops) {
+		t.Fatal("expected complete linearization")
+	}
+}
+
+func TestSnapshotsVerdict(t *testing.T) {
+	for _, logName := range []string{"c10-bad", "c10-ok"} {
+		events := parseKvLog(fmt.Sprintf("test_data/kv/%s.txt", logName))
+		expected := CheckEventsTimeout(kvModel, events, 0)
+		calls := 0
+		res, info := CheckEventsWithOptions(kvModel, events, CheckOptions{
+			SnapshotEvery: time.Microsecond,
+			SnapshotFunc: func(info LinearizationInfo) {
+				calls++
+				if len(info.partialLinearizations) != len(info.history) {
+					t.Errorf("expected partial linearizations for every partition")
+				}
+			},
+		})
+		if res != expected {
+			t.Fatalf("expected %v for %s with snapshots, got %v", expected, logName, res)
+		}
+		if calls == 0 {
+			t.Fatalf("expected snapshots for %s", logName)
+		}
+		var buf bytes.Buffer
+		err := Visualize(kvModel, info, &buf)
+		if err != nil {
+			t.Fatalf("visualization failed: %v", err)
+		}
+	}
+}
+
+func TestPartitionInfo(t *testing.T) {
+	events := parseKvLog("test_data/kv/c10-bad.txt")
+	res, info := CheckEventsVerbose(kvModel, events, 0)
+	if res != Illegal {
+		t.Fatalf("expected illegal, got %v", res)
+	}
+	partitions := info.Partitions()
+	if len(partitions) != len(info.history) {
+		t.Fatalf("expected %d partitions, got %d", len(info.history), len(partitions))
+	}
+	operations, illegal := 0, 0
+	for _, p := range partitions {
+		operations += p.Operations
+		if p.States == 0 || p.Steps < p.States {
+			t.Fatalf("expected the search to have reached states, got %+v", p)
+		}
+		switch p.Result {
+		case Ok:
+			if p.Linearized != p.Operations {
+				t.Fatalf("expected linearizable partition to be fully linearized, got %+v", p)
+			}
+		case Illegal:
+			illegal++
+			if p.Linearized >= p.Operations {
+				t.Fatalf("expected illegal partition to be partially linearized, got %+v", p)
+			}
+		default:
+			t.Fatalf("expected every partition to be checked, got %+v", p)
+		}
+	}
+	if operations != len(events)/2 || illegal == 0 {
+		t.Fatalf("expected %d operations with an illegal partition, got %d operations and %d illegal partitions", len(events)/2, operations, illegal)
+	}
+
+	// a partition that doesn't finish is unknown
+	ops := make([]Operation, 50)
+	for i := range ops {
+		ops[i] = Operation{i, registerInput{false, i}, 0, 0, 100}
+	}
+	slowModel := registerModel
+	slowModel.Step = func(state, input, output interface{}) (bool, interface{}) {
+		time.Sleep(time.Millisecond)
+		return registerModel.Step(state, input, output)
+	}
+	res, info = CheckOperationsVerbose(slowModel, ops, 10*time.Millisecond)
+	if res != Unknown {
+		t.Fatalf("expected unknown, got %v", res)
+	}
+	if p := info.Partitions(); len(p) != 1 || p[0].Result != Unknown || p[0].Operations != 50 {
+		t.Fatalf("expected an unknown partition, got %+v", p)
+	}
+}
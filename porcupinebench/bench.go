@@ -0,0 +1,137 @@
+// Package porcupinebench measures how checking histories with a model scales
+// with the number of clients and the length of the history, to find out
+// whether a model is fast enough before relying on it in CI.
+//
+// A benchmark runs the checker over a grid of history sizes:
+//
+//	func BenchmarkModel(b *testing.B) {
+//		gen := porcupinebench.Generator(newExecutor, 2, 0)
+//		porcupinebench.Run(b, model, gen, porcupinebench.Grid([]int{2, 4, 8}, []int{100, 1000}))
+//	}
+//
+// Each size is a sub-benchmark named like clients=4/ops=1000, which
+// benchstat understands as two configuration keys, and reports ns/op along
+// with the work done by the checker, from [porcupine.PartitionInfo].
+package porcupinebench
+
+import (
+	"fmt"
+	"io"
+	"math/rand"
+	"testing"
+	"time"
+
+	"github.com/anishathalye/porcupine"
+	"github.com/anishathalye/porcupine/modeltest"
+)
+
+// A Point is a size of history to benchmark.
+type Point struct {
+	Clients    int
+	Operations int
+}
+
+func (p Point) String() string {
+	return fmt.Sprintf("clients=%d/ops=%d", p.Clients, p.Operations)
+}
+
+// Grid returns the points for every combination of the given numbers of
+// clients and operations.
+func Grid(clients []int, operations []int) []Point {
+	var grid []Point
+	for _, c := range clients {
+		for _, n := range operations {
+			grid = append(grid, Point{Clients: c, Operations: n})
+		}
+	}
+	return grid
+}
+
+// A Result is the measurement of a [Point].
+type Result struct {
+	Point Point
+	// Result is the result of checking the history.
+	Result porcupine.CheckResult
+	// Iterations is the number of times that the history was checked.
+	Iterations int
+	// NsPerOp is the time it took to check the history, in nanoseconds.
+	NsPerOp float64
+	// Steps is the number of times that the checker called the model's
+	// Step function, over all partitions, and States is the number of
+	// states that it reached, which is also the total peak size of its
+	// caches.
+	Steps  int
+	States int
+}
+
+// Generator returns a function that generates histories for [Run] with
+// [modeltest.GenerateHistory], from random operations executed on a
+// reference implementation, where each operation is concurrent with up to
+// concurrency operations on either side. The generated histories are
+// linearizable, so checking them measures the common case. Each history is
+// generated with a new executor, returned by newExecutor, since executors
+// keep the state of their reference implementation, and with the given seed,
+// so that runs of a benchmark measure the same histories.
+func Generator(newExecutor func() modeltest.SequentialExecutor, concurrency int, seed int64) func(clients, ops int) []porcupine.Operation {
+	return func(clients, ops int) []porcupine.Operation {
+		rng := rand.New(rand.NewSource(seed))
+		return modeltest.GenerateHistory(rng, modeltest.GenConfig{
+			Operations:  ops,
+			Clients:     clients,
+			Concurrency: concurrency,
+		}, newExecutor())
+	}
+}
+
+// Run runs a sub-benchmark of checking a history with model for each point
+// of grid, with a history generated by gen for the point's numbers of
+// clients and operations. Besides ns/op, each sub-benchmark reports the
+// metrics steps/op and states/op, the number of calls to the model's Step
+// function and the number of states reached by the checker, which grows
+// with the peak size of its cache.
+//
+// It returns the final measurement of each point, which can be written with
+// [WriteSummary].
+func Run(b *testing.B, model porcupine.Model, gen func(clients, ops int) []porcupine.Operation, grid []Point) []Result {
+	b.Helper()
+	results := make([]Result, len(grid))
+	for i, point := range grid {
+		history := gen(point.Clients, point.Operations)
+		b.Run(point.String(), func(b *testing.B) {
+			r := Result{Point: point, Iterations: b.N}
+			b.ResetTimer()
+			start := time.Now()
+			for j := 0; j < b.N; j++ {
+				res, info := porcupine.CheckOperationsVerbose(model, history, 0)
+				r.Result = res
+				r.Steps, r.States = 0, 0
+				for _, p := range info.Partitions() {
+					r.Steps += p.Steps
+					r.States += p.States
+				}
+			}
+			elapsed := time.Since(start)
+			b.StopTimer()
+			if b.N > 0 {
+				r.NsPerOp = float64(elapsed.Nanoseconds()) / float64(b.N)
+			}
+			b.ReportMetric(float64(r.Steps), "steps/op")
+			b.ReportMetric(float64(r.States), "states/op")
+			results[i] = r
+		})
+	}
+	return results
+}
+
+// WriteSummary writes results in the Go benchmark format that benchstat
+// reads, one line per point, with the given benchmark name, such as
+// "BenchmarkModel".
+func WriteSummary(w io.Writer, name string, results []Result) error {
+	for _, r := range results {
+		_, err := fmt.Fprintf(w, "%s/%v %d %.0f ns/op %d steps/op %d states/op\n", name, r.Point, r.Iterations, r.NsPerOp, r.Steps, r.States)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
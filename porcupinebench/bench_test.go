@@ -0,0 +1,70 @@
+package porcupinebench
+
+import (
+	"math/rand"
+	"strings"
+	"testing"
+
+	"github.com/anishathalye/porcupine"
+	"github.com/anishathalye/porcupine/models"
+	"github.com/anishathalye/porcupine/modeltest"
+)
+
+// newKVExecutor returns an executor for a key-value store with a few keys.
+func newKVExecutor() modeltest.SequentialExecutor {
+	store := make(map[string]string)
+	key := func(rng *rand.Rand) string {
+		return string(rune('a' + rng.Intn(3)))
+	}
+	return modeltest.SequentialExecutor{
+		Inputs: []func(rng *rand.Rand) interface{}{
+			func(rng *rand.Rand) interface{} { return models.KVInput{Op: models.KVGet, Key: key(rng)} },
+			func(rng *rand.Rand) interface{} {
+				return models.KVInput{Op: models.KVPut, Key: key(rng), Value: string(rune('0' + rng.Intn(10)))}
+			},
+		},
+		Apply: func(input interface{}) interface{} {
+			inp := input.(models.KVInput)
+			if inp.Op == models.KVPut {
+				store[inp.Key] = inp.Value
+				return models.KVOutput{}
+			}
+			return models.KVOutput{Value: store[inp.Key]}
+		},
+	}
+}
+
+func TestRun(t *testing.T) {
+	grid := Grid([]int{2, 4}, []int{10, 50})
+	if len(grid) != 4 || grid[1] != (Point{2, 50}) || grid[1].String() != "clients=2/ops=50" {
+		t.Fatalf("unexpected grid %v", grid)
+	}
+	var results []Result
+	testing.Benchmark(func(b *testing.B) {
+		results = Run(b, models.KV(), Generator(newKVExecutor, 2, 0), grid)
+	})
+	if len(results) != len(grid) {
+		t.Fatalf("expected %d results, got %d", len(grid), len(results))
+	}
+	for i, r := range results {
+		if r.Point != grid[i] || r.Result != porcupine.Ok || r.Iterations == 0 || r.NsPerOp <= 0 || r.States < r.Point.Operations || r.Steps < r.States {
+			t.Fatalf("unexpected result %+v", r)
+		}
+	}
+	if results[3].States <= results[2].States {
+		t.Fatalf("expected longer histories to reach more states, got %+v", results)
+	}
+
+	var b strings.Builder
+	if err := WriteSummary(&b, "BenchmarkKV", results); err != nil {
+		t.Fatal(err)
+	}
+	lines := strings.Split(strings.TrimSuffix(b.String(), "\n"), "\n")
+	if len(lines) != 4 || !strings.HasPrefix(lines[0], "BenchmarkKV/clients=2/ops=10 ") || !strings.HasSuffix(lines[0], " states/op") {
+		t.Fatalf("unexpected summary:\n%s", b.String())
+	}
+}
+
+func BenchmarkKV(b *testing.B) {
+	Run(b, models.KV(), Generator(newKVExecutor, 2, 0), Grid([]int{2, 8}, []int{100, 1000}))
+}
@@ -0,0 +1,73 @@
+//go:build integration
+// +build integration
+
+package porcupineetcd
+
+import (
+	"context"
+	"fmt"
+	"math/rand"
+	"os"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/anishathalye/porcupine"
+	clientv3 "go.etcd.io/etcd/client/v3"
+)
+
+// TestIntegration runs concurrent clients against the etcd cluster at
+// ETCD_ENDPOINTS (a comma-separated list, localhost:2379 by default), and
+// checks that the recorded history is linearizable. Run it with
+//
+//	go test -tags integration
+func TestIntegration(t *testing.T) {
+	endpoints := []string{"localhost:2379"}
+	if e := os.Getenv("ETCD_ENDPOINTS"); e != "" {
+		endpoints = strings.Split(e, ",")
+	}
+	client, err := clientv3.New(clientv3.Config{Endpoints: endpoints, DialTimeout: 5 * time.Second})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+
+	prefix := fmt.Sprintf("porcupine-%d/", time.Now().UnixNano())
+	r := porcupine.NewRecorder()
+	var wg sync.WaitGroup
+	for c := 0; c < 8; c++ {
+		wg.Add(1)
+		go func(clientId int) {
+			defer wg.Done()
+			kv := NewKV(client, r, clientId)
+			rng := rand.New(rand.NewSource(int64(clientId)))
+			for i := 0; i < 200; i++ {
+				key := prefix + fmt.Sprint(rng.Intn(3))
+				value := fmt.Sprint(rng.Intn(5))
+				// short timeouts, so that some operations have an
+				// unknown outcome
+				ctx, cancel := context.WithTimeout(context.Background(), time.Duration(rng.Intn(20))*time.Millisecond)
+				switch rng.Intn(4) {
+				case 0:
+					kv.Get(ctx, key)
+				case 1:
+					kv.Put(ctx, key, value)
+				case 2:
+					kv.Delete(ctx, key)
+				case 3:
+					kv.Txn(ctx).If(clientv3.Compare(clientv3.Value(key), "=", fmt.Sprint(rng.Intn(5)))).Then(clientv3.OpPut(key, value)).Commit()
+				}
+				cancel()
+			}
+		}(c)
+	}
+	wg.Wait()
+
+	ops := r.Operations()
+	t.Logf("recorded %d operations, %d pending", len(ops), r.Pending())
+	res, _ := porcupine.CheckOperationsVerbose(Model, ops, time.Minute)
+	if res != porcupine.Ok {
+		t.Fatalf("expected history to be linearizable, got %v", res)
+	}
+}
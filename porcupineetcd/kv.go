@@ -0,0 +1,208 @@
+// Package porcupineetcd records histories of operations on etcd, for checking
+// with porcupine.
+//
+// It is a separate module, so that the porcupine package itself doesn't
+// depend on the etcd client.
+package porcupineetcd
+
+import (
+	"context"
+	"errors"
+
+	"github.com/anishathalye/porcupine"
+	pb "go.etcd.io/etcd/api/v3/etcdserverpb"
+	"go.etcd.io/etcd/api/v3/v3rpc/rpctypes"
+	clientv3 "go.etcd.io/etcd/client/v3"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// KV is a [clientv3.KV] that records the operations it executes in a
+// porcupine Recorder, as operations of one client, with [Input] and [Output]
+// values for [Model]. Since a client performs one operation at a time, each
+// goroutine that issues operations concurrently needs its own KV.
+//
+// The following operations are recorded:
+//
+//   - a Get of a single key, without a revision, that is not serializable,
+//     count only, or keys only
+//   - a Put
+//   - a Delete of a single key
+//   - a Txn that compares the value of a key with "=", puts a new value into
+//     the same key if the comparison succeeds, and does nothing otherwise,
+//     as a compare-and-swap
+//
+// Other operations, such as range reads and serializable reads, which etcd
+// doesn't promise to be linearizable, are executed without being recorded;
+// a history is only meaningful if every write to the keys it covers is
+// recorded. Puts with the WithIgnoreValue option are not supported.
+//
+// Operations that fail with an error for which [IsUnknownOutcome] returns
+// true, such as a deadline being exceeded, are left pending in the Recorder,
+// since they may or may not have taken effect. Operations that fail with
+// other errors are recorded with a Failed output.
+type KV struct {
+	kv       clientv3.KV
+	recorder *porcupine.Recorder
+	clientId int
+}
+
+var _ clientv3.KV = (*KV)(nil)
+
+// NewKV returns a KV that executes operations with kv, and records them in r
+// as operations of the given client.
+func NewKV(kv clientv3.KV, r *porcupine.Recorder, clientId int) *KV {
+	return &KV{kv: kv, recorder: r, clientId: clientId}
+}
+
+// IsUnknownOutcome reports whether an operation that failed with err may or
+// may not have taken effect. This is the case when its context was canceled
+// or its deadline exceeded, and for errors with the DeadlineExceeded,
+// Canceled, Unavailable, and Unknown codes, such as timeouts and lost
+// connections.
+func IsUnknownOutcome(err error) bool {
+	if errors.Is(err, context.DeadlineExceeded) || errors.Is(err, context.Canceled) {
+		return true
+	}
+	var code codes.Code
+	var etcdErr rpctypes.EtcdError
+	if errors.As(err, &etcdErr) {
+		code = etcdErr.Code()
+	} else {
+		code = status.Code(err)
+	}
+	switch code {
+	case codes.DeadlineExceeded, codes.Canceled, codes.Unavailable, codes.Unknown:
+		return true
+	default:
+		return false
+	}
+}
+
+func (k *KV) Put(ctx context.Context, key, val string, opts ...clientv3.OpOption) (*clientv3.PutResponse, error) {
+	resp, err := k.Do(ctx, clientv3.OpPut(key, val, opts...))
+	return resp.Put(), err
+}
+
+func (k *KV) Get(ctx context.Context, key string, opts ...clientv3.OpOption) (*clientv3.GetResponse, error) {
+	resp, err := k.Do(ctx, clientv3.OpGet(key, opts...))
+	return resp.Get(), err
+}
+
+// GetStream executes a streaming get without recording it.
+func (k *KV) GetStream(ctx context.Context, key string, opts ...clientv3.OpOption) (clientv3.GetStreamChan, error) {
+	return k.kv.GetStream(ctx, key, opts...)
+}
+
+func (k *KV) Delete(ctx context.Context, key string, opts ...clientv3.OpOption) (*clientv3.DeleteResponse, error) {
+	resp, err := k.Do(ctx, clientv3.OpDelete(key, opts...))
+	return resp.Del(), err
+}
+
+// Compact compacts the history of the store without recording it, since it
+// doesn't change the values of keys.
+func (k *KV) Compact(ctx context.Context, rev int64, opts ...clientv3.CompactOption) (*clientv3.CompactResponse, error) {
+	return k.kv.Compact(ctx, rev, opts...)
+}
+
+func (k *KV) Do(ctx context.Context, op clientv3.Op) (clientv3.OpResponse, error) {
+	input, ok := opInput(op)
+	if !ok {
+		return k.kv.Do(ctx, op)
+	}
+	h := k.recorder.Begin(k.clientId, input)
+	resp, err := k.kv.Do(ctx, op)
+	if err != nil {
+		if !IsUnknownOutcome(err) {
+			h.End(Output{Failed: true})
+		}
+		return resp, err
+	}
+	h.End(opOutput(input, resp))
+	return resp, nil
+}
+
+func (k *KV) Txn(ctx context.Context) clientv3.Txn {
+	return &txn{kv: k, ctx: ctx}
+}
+
+// txn collects the parts of a transaction, so that it can be executed with
+// Do when it is committed.
+type txn struct {
+	kv      *KV
+	ctx     context.Context
+	cmps    []clientv3.Cmp
+	thenOps []clientv3.Op
+	elseOps []clientv3.Op
+}
+
+func (t *txn) If(cs ...clientv3.Cmp) clientv3.Txn {
+	t.cmps = append(t.cmps, cs...)
+	return t
+}
+
+func (t *txn) Then(ops ...clientv3.Op) clientv3.Txn {
+	t.thenOps = append(t.thenOps, ops...)
+	return t
+}
+
+func (t *txn) Else(ops ...clientv3.Op) clientv3.Txn {
+	t.elseOps = append(t.elseOps, ops...)
+	return t
+}
+
+func (t *txn) Commit() (*clientv3.TxnResponse, error) {
+	resp, err := t.kv.Do(t.ctx, clientv3.OpTxn(t.cmps, t.thenOps, t.elseOps))
+	return resp.Txn(), err
+}
+
+// opInput returns the input of an operation that is recorded, and false for
+// operations that are not.
+func opInput(op clientv3.Op) (Input, bool) {
+	key := string(op.KeyBytes())
+	switch {
+	case op.IsGet():
+		if op.RangeBytes() != nil || op.Rev() != 0 || op.IsSerializable() || op.IsCountOnly() || op.IsKeysOnly() ||
+			op.MinModRev() != 0 || op.MaxModRev() != 0 || op.MinCreateRev() != 0 || op.MaxCreateRev() != 0 {
+			return Input{}, false
+		}
+		return Input{Op: OpGet, Key: key}, true
+	case op.IsPut():
+		return Input{Op: OpPut, Key: key, Value: string(op.ValueBytes())}, true
+	case op.IsDelete():
+		if op.RangeBytes() != nil {
+			return Input{}, false
+		}
+		return Input{Op: OpDelete, Key: key}, true
+	case op.IsTxn():
+		cmps, thenOps, elseOps := op.Txn()
+		if len(cmps) != 1 || len(thenOps) != 1 || len(elseOps) != 0 {
+			return Input{}, false
+		}
+		cmp := cmps[0].GetCompare()
+		put := thenOps[0]
+		if cmp.Target != pb.Compare_VALUE || cmp.Result != pb.Compare_EQUAL || cmp.RangeEnd != nil ||
+			!put.IsPut() || string(put.KeyBytes()) != string(cmp.Key) {
+			return Input{}, false
+		}
+		return Input{Op: OpCompareAndSwap, Key: string(cmp.Key), Value: string(put.ValueBytes()), Expected: string(cmp.GetValue())}, true
+	default:
+		return Input{}, false
+	}
+}
+
+func opOutput(input Input, resp clientv3.OpResponse) Output {
+	switch input.Op {
+	case OpGet:
+		if kvs := resp.Get().Kvs; len(kvs) > 0 {
+			return Output{Exists: true, Value: string(kvs[0].Value)}
+		}
+		return Output{}
+	case OpDelete:
+		return Output{Exists: resp.Del().Deleted > 0}
+	case OpCompareAndSwap:
+		return Output{Succeeded: resp.Txn().Succeeded}
+	default:
+		return Output{}
+	}
+}
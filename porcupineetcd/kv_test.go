@@ -0,0 +1,180 @@
+package porcupineetcd
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+
+	"github.com/anishathalye/porcupine"
+	"go.etcd.io/etcd/api/v3/mvccpb"
+	"go.etcd.io/etcd/api/v3/v3rpc/rpctypes"
+	clientv3 "go.etcd.io/etcd/client/v3"
+)
+
+// memoryKV is an in-memory clientv3.KV that supports the operations recorded
+// by KV. Puts to the key "timeout" take effect, but then fail with a
+// deadline exceeded error, and operations on the key "invalid" fail without
+// taking effect.
+type memoryKV struct {
+	clientv3.KV
+	mu   sync.Mutex
+	data map[string]string
+}
+
+func (m *memoryKV) Do(ctx context.Context, op clientv3.Op) (clientv3.OpResponse, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	key := string(op.KeyBytes())
+	if key == "invalid" {
+		return clientv3.OpResponse{}, rpctypes.ErrEmptyKey
+	}
+	var resp clientv3.OpResponse
+	switch {
+	case op.IsGet():
+		r := &clientv3.GetResponse{}
+		if v, ok := m.data[key]; ok {
+			r.Kvs = []*mvccpb.KeyValue{{Key: []byte(key), Value: []byte(v)}}
+		}
+		resp = r.OpResponse()
+	case op.IsPut():
+		m.data[key] = string(op.ValueBytes())
+		resp = (&clientv3.PutResponse{}).OpResponse()
+	case op.IsDelete():
+		r := &clientv3.DeleteResponse{}
+		if _, ok := m.data[key]; ok {
+			r.Deleted = 1
+			delete(m.data, key)
+		}
+		resp = r.OpResponse()
+	case op.IsTxn():
+		cmps, thenOps, _ := op.Txn()
+		cmp := cmps[0].GetCompare()
+		key = string(cmp.Key)
+		r := &clientv3.TxnResponse{}
+		if v, ok := m.data[key]; ok && v == string(cmp.GetValue()) {
+			r.Succeeded = true
+			m.data[key] = string(thenOps[0].ValueBytes())
+		}
+		resp = r.OpResponse()
+	}
+	if key == "timeout" && op.IsPut() {
+		return clientv3.OpResponse{}, context.DeadlineExceeded
+	}
+	return resp, nil
+}
+
+func TestKV(t *testing.T) {
+	r := porcupine.NewRecorder()
+	kv := NewKV(&memoryKV{data: make(map[string]string)}, r, 0)
+	ctx := context.Background()
+	mustSucceed := func(err error) {
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	_, err := kv.Put(ctx, "x", "a")
+	mustSucceed(err)
+	resp, err := kv.Get(ctx, "x")
+	mustSucceed(err)
+	if len(resp.Kvs) != 1 || string(resp.Kvs[0].Value) != "a" {
+		t.Fatalf("unexpected get response %+v", resp)
+	}
+	txn, err := kv.Txn(ctx).If(clientv3.Compare(clientv3.Value("x"), "=", "a")).Then(clientv3.OpPut("x", "b")).Commit()
+	mustSucceed(err)
+	if !txn.Succeeded {
+		t.Fatal("expected compare-and-swap to succeed")
+	}
+	_, err = kv.Txn(ctx).If(clientv3.Compare(clientv3.Value("x"), "=", "a")).Then(clientv3.OpPut("x", "c")).Commit()
+	mustSucceed(err)
+	_, err = kv.Delete(ctx, "x")
+	mustSucceed(err)
+	_, err = kv.Get(ctx, "x")
+	mustSucceed(err)
+	// not recorded
+	_, err = kv.Get(ctx, "x", clientv3.WithPrefix())
+	mustSucceed(err)
+	_, err = kv.Get(ctx, "x", clientv3.WithSerializable())
+	mustSucceed(err)
+	_, err = kv.Txn(ctx).If(clientv3.Compare(clientv3.Version("x"), "=", 0)).Then(clientv3.OpPut("x", "d")).Commit()
+	mustSucceed(err)
+
+	if _, err := kv.Put(ctx, "timeout", "a"); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("expected deadline exceeded, got %v", err)
+	}
+	if _, err := kv.Put(ctx, "invalid", "a"); err == nil {
+		t.Fatal("expected an error")
+	}
+	_, err = kv.Get(ctx, "timeout")
+	mustSucceed(err)
+
+	ops := r.Operations()
+	expected := []porcupine.Operation{
+		{Input: Input{Op: OpPut, Key: "x", Value: "a"}, Output: Output{}},
+		{Input: Input{Op: OpGet, Key: "x"}, Output: Output{Exists: true, Value: "a"}},
+		{Input: Input{Op: OpCompareAndSwap, Key: "x", Value: "b", Expected: "a"}, Output: Output{Succeeded: true}},
+		{Input: Input{Op: OpCompareAndSwap, Key: "x", Value: "c", Expected: "a"}, Output: Output{}},
+		{Input: Input{Op: OpDelete, Key: "x"}, Output: Output{Exists: true}},
+		{Input: Input{Op: OpGet, Key: "x"}, Output: Output{}},
+		{Input: Input{Op: OpPut, Key: "timeout", Value: "a"}, Output: nil},
+		{Input: Input{Op: OpPut, Key: "invalid", Value: "a"}, Output: Output{Failed: true}},
+		{Input: Input{Op: OpGet, Key: "timeout"}, Output: Output{Exists: true, Value: "a"}},
+	}
+	if len(ops) != len(expected) {
+		t.Fatalf("expected %d operations, got %+v", len(expected), ops)
+	}
+	for i, e := range expected {
+		if ops[i].Input != e.Input || ops[i].Output != e.Output {
+			t.Fatalf("expected operation %d to be %+v -> %+v, got %+v -> %+v", i, e.Input, e.Output, ops[i].Input, ops[i].Output)
+		}
+	}
+	if !porcupine.CheckOperations(Model, ops) {
+		t.Fatal("expected history to be linearizable")
+	}
+}
+
+func TestModel(t *testing.T) {
+	// a stale read after a compare-and-swap
+	ops := []porcupine.Operation{
+		{ClientId: 0, Input: Input{Op: OpPut, Key: "x", Value: "a"}, Call: 0, Output: Output{}, Return: 10},
+		{ClientId: 1, Input: Input{Op: OpCompareAndSwap, Key: "x", Value: "b", Expected: "a"}, Call: 20, Output: Output{Succeeded: true}, Return: 30},
+		{ClientId: 0, Input: Input{Op: OpGet, Key: "x"}, Call: 40, Output: Output{Exists: true, Value: "a"}, Return: 50},
+		{ClientId: 2, Input: Input{Op: OpGet, Key: "y"}, Call: 0, Output: Output{}, Return: 100},
+	}
+	res, info := porcupine.CheckOperationsVerbose(Model, ops, 0)
+	if res != porcupine.Illegal {
+		t.Fatalf("expected history to not be linearizable, got %v", res)
+	}
+	if len(info.Partitions()) != 2 {
+		t.Fatalf("expected a partition per key, got %d", len(info.Partitions()))
+	}
+	// a failed or pending compare-and-swap explains the read
+	ops[1].Output = Output{Failed: true}
+	if !porcupine.CheckOperations(Model, ops) {
+		t.Fatal("expected history with failed compare-and-swap to be linearizable")
+	}
+	ops[1].Output = nil
+	ops[1].Return = 100
+	if !porcupine.CheckOperations(Model, ops) {
+		t.Fatal("expected history with pending compare-and-swap to be linearizable")
+	}
+	if got := Model.DescribeOperation(ops[1].Input, ops[1].Output); got != "cas('x', 'a', 'b') -> unknown" {
+		t.Fatalf("unexpected description %q", got)
+	}
+}
+
+func TestIsUnknownOutcome(t *testing.T) {
+	unknown := []error{context.DeadlineExceeded, context.Canceled, rpctypes.ErrTimeout, rpctypes.ErrGRPCTimeout, rpctypes.ErrTimeoutDueToConnectionLost}
+	for _, err := range unknown {
+		if !IsUnknownOutcome(err) {
+			t.Fatalf("expected %v to have an unknown outcome", err)
+		}
+	}
+	known := []error{rpctypes.ErrEmptyKey, rpctypes.ErrCompacted, rpctypes.ErrGRPCPermissionDenied}
+	for _, err := range known {
+		if IsUnknownOutcome(err) {
+			t.Fatalf("expected %v to have a known outcome", err)
+		}
+	}
+}
@@ -0,0 +1,159 @@
+package porcupineetcd
+
+import (
+	"fmt"
+
+	"github.com/anishathalye/porcupine"
+)
+
+// An OpType is the type of an operation on a key.
+type OpType uint8
+
+const (
+	OpGet OpType = iota
+	OpPut
+	OpDelete
+	// OpCompareAndSwap is a transaction that puts a value if the key's
+	// current value is equal to an expected one.
+	OpCompareAndSwap
+)
+
+func (t OpType) String() string {
+	switch t {
+	case OpGet:
+		return "get"
+	case OpPut:
+		return "put"
+	case OpDelete:
+		return "delete"
+	case OpCompareAndSwap:
+		return "cas"
+	default:
+		return fmt.Sprintf("OpType(%d)", uint8(t))
+	}
+}
+
+// An Input is the input of an operation recorded by [KV].
+type Input struct {
+	Op  OpType
+	Key string
+	// Value is the value written by a put or a compare-and-swap.
+	Value string
+	// Expected is the value a compare-and-swap compares against.
+	Expected string
+}
+
+// An Output is the output of an operation recorded by [KV]. Operations whose
+// outcome is unknown are pending, with a nil output.
+type Output struct {
+	// Exists is whether the key existed, for a get or a delete.
+	Exists bool
+	// Value is the value read by a get.
+	Value string
+	// Succeeded is whether the comparison of a compare-and-swap succeeded.
+	Succeeded bool
+	// Failed is whether the operation failed with an error that means it
+	// had no effect.
+	Failed bool
+}
+
+type state struct {
+	exists bool
+	value  string
+}
+
+// Model is a model of an etcd key-value store, for the operations recorded by
+// [KV]. Histories are partitioned by key. It accepts a nil output, from an
+// operation whose outcome is unknown, as any outcome.
+var Model = porcupine.Model{
+	Partition: func(history []porcupine.Operation) [][]porcupine.Operation {
+		m := make(map[string][]porcupine.Operation)
+		var keys []string
+		for _, op := range history {
+			key := op.Input.(Input).Key
+			if _, ok := m[key]; !ok {
+				keys = append(keys, key)
+			}
+			m[key] = append(m[key], op)
+		}
+		partitions := make([][]porcupine.Operation, len(keys))
+		for i, key := range keys {
+			partitions[i] = m[key]
+		}
+		return partitions
+	},
+	Init: func() interface{} { return state{} },
+	Step: func(st, input, output interface{}) (bool, interface{}) {
+		s := st.(state)
+		inp := input.(Input)
+		if output == nil {
+			return true, apply(s, inp)
+		}
+		out := output.(Output)
+		if out.Failed {
+			return true, s
+		}
+		switch inp.Op {
+		case OpGet:
+			return out.Exists == s.exists && out.Value == s.value, s
+		case OpPut:
+			return true, apply(s, inp)
+		case OpDelete:
+			return out.Exists == s.exists, apply(s, inp)
+		case OpCompareAndSwap:
+			return out.Succeeded == (s.exists && s.value == inp.Expected), apply(s, inp)
+		default:
+			return false, s
+		}
+	},
+	DescribeOperation: func(input, output interface{}) string {
+		inp := input.(Input)
+		var result string
+		if output == nil {
+			result = "unknown"
+		} else if out := output.(Output); out.Failed {
+			result = "failed"
+		} else {
+			switch inp.Op {
+			case OpGet:
+				if out.Exists {
+					result = fmt.Sprintf("'%s'", out.Value)
+				} else {
+					result = "null"
+				}
+			case OpDelete:
+				result = fmt.Sprintf("%t", out.Exists)
+			case OpCompareAndSwap:
+				result = fmt.Sprintf("%t", out.Succeeded)
+			}
+		}
+		var call string
+		switch inp.Op {
+		case OpGet, OpDelete:
+			call = fmt.Sprintf("%s('%s')", inp.Op, inp.Key)
+		case OpPut:
+			call = fmt.Sprintf("put('%s', '%s')", inp.Key, inp.Value)
+		case OpCompareAndSwap:
+			call = fmt.Sprintf("cas('%s', '%s', '%s')", inp.Key, inp.Expected, inp.Value)
+		}
+		if result == "" {
+			return call
+		}
+		return call + " -> " + result
+	},
+}
+
+// apply returns the state after an operation takes effect.
+func apply(s state, inp Input) state {
+	switch inp.Op {
+	case OpPut:
+		return state{true, inp.Value}
+	case OpDelete:
+		return state{}
+	case OpCompareAndSwap:
+		if s.exists && s.value == inp.Expected {
+			return state{true, inp.Value}
+		}
+	}
+	return s
+}
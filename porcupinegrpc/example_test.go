@@ -0,0 +1,186 @@
+package porcupinegrpc_test
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/anishathalye/porcupine"
+	"github.com/anishathalye/porcupine/porcupinegrpc"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/encoding"
+	"google.golang.org/grpc/test/bufconn"
+)
+
+// A tiny key-value service, with JSON messages so that it doesn't need
+// generated code.
+
+type putRequest struct {
+	Key   string
+	Value string
+	// Delay makes the server wait after applying the put, before replying
+	Delay time.Duration
+}
+
+type putReply struct{}
+
+type getRequest struct {
+	Key string
+}
+
+type getReply struct {
+	Value string
+}
+
+type jsonCodec struct{}
+
+func (jsonCodec) Marshal(v interface{}) ([]byte, error)      { return json.Marshal(v) }
+func (jsonCodec) Unmarshal(data []byte, v interface{}) error { return json.Unmarshal(data, v) }
+func (jsonCodec) Name() string                               { return "json" }
+
+func init() {
+	encoding.RegisterCodec(jsonCodec{})
+}
+
+type kvServer struct {
+	mu   sync.Mutex
+	data map[string]string
+}
+
+func (s *kvServer) put(ctx context.Context, req *putRequest) (*putReply, error) {
+	s.mu.Lock()
+	s.data[req.Key] = req.Value
+	s.mu.Unlock()
+	time.Sleep(req.Delay)
+	return &putReply{}, nil
+}
+
+func (s *kvServer) get(ctx context.Context, req *getRequest) (*getReply, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return &getReply{Value: s.data[req.Key]}, nil
+}
+
+var kvServiceDesc = grpc.ServiceDesc{
+	ServiceName: "kv.KV",
+	HandlerType: (*interface{})(nil),
+	Methods: []grpc.MethodDesc{
+		{
+			MethodName: "Put",
+			Handler: func(srv interface{}, ctx context.Context, dec func(interface{}) error, _ grpc.UnaryServerInterceptor) (interface{}, error) {
+				req := new(putRequest)
+				if err := dec(req); err != nil {
+					return nil, err
+				}
+				return srv.(*kvServer).put(ctx, req)
+			},
+		},
+		{
+			MethodName: "Get",
+			Handler: func(srv interface{}, ctx context.Context, dec func(interface{}) error, _ grpc.UnaryServerInterceptor) (interface{}, error) {
+				req := new(getRequest)
+				if err := dec(req); err != nil {
+					return nil, err
+				}
+				return srv.(*kvServer).get(ctx, req)
+			},
+		},
+	},
+}
+
+type kvInput struct {
+	op    string
+	key   string
+	value string
+}
+
+// kvModel is a key-value model that accepts a nil output from a pending
+// operation as any outcome
+var kvModel = porcupine.Model{
+	Init: func() interface{} { return map[string]string{} },
+	Step: func(state, input, output interface{}) (bool, interface{}) {
+		st := state.(map[string]string)
+		inp := input.(kvInput)
+		if inp.op == "get" {
+			return output == nil || output.(string) == st[inp.key], st
+		}
+		next := make(map[string]string, len(st)+1)
+		for k, v := range st {
+			next[k] = v
+		}
+		next[inp.key] = inp.value
+		return true, next
+	},
+	Equal: func(a, b interface{}) bool {
+		return fmt.Sprint(a) == fmt.Sprint(b)
+	},
+}
+
+func Example() {
+	lis := bufconn.Listen(1 << 20)
+	server := grpc.NewServer()
+	server.RegisterService(&kvServiceDesc, &kvServer{data: make(map[string]string)})
+	go server.Serve(lis)
+	defer server.Stop()
+
+	recorder := porcupine.NewRecorder()
+	interceptor := porcupinegrpc.UnaryClientInterceptor(recorder, porcupinegrpc.Options{
+		Input: func(method string, req interface{}) (interface{}, bool) {
+			switch req := req.(type) {
+			case *putRequest:
+				return kvInput{op: "put", key: req.Key, value: req.Value}, true
+			case *getRequest:
+				return kvInput{op: "get", key: req.Key}, true
+			}
+			return nil, false
+		},
+		Output: func(method string, req, reply interface{}, err error) interface{} {
+			if reply, ok := reply.(*getReply); ok {
+				return reply.Value
+			}
+			return ""
+		},
+	})
+	conn, err := grpc.NewClient("passthrough:///bufnet",
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) {
+			return lis.DialContext(ctx)
+		}),
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+		grpc.WithDefaultCallOptions(grpc.CallContentSubtype("json")),
+		grpc.WithUnaryInterceptor(interceptor),
+	)
+	if err != nil {
+		panic(err)
+	}
+	defer conn.Close()
+
+	// client 0 writes x, and client 1 overwrites it, but times out before
+	// the server replies, so the outcome of its put is unknown
+	ctx := context.Background()
+	if err := conn.Invoke(porcupinegrpc.WithClientId(ctx, 0), "/kv.KV/Put", &putRequest{Key: "x", Value: "a"}, &putReply{}); err != nil {
+		panic(err)
+	}
+	timeoutCtx, cancel := context.WithTimeout(porcupinegrpc.WithClientId(ctx, 1), 50*time.Millisecond)
+	err = conn.Invoke(timeoutCtx, "/kv.KV/Put", &putRequest{Key: "x", Value: "b", Delay: time.Second}, &putReply{})
+	cancel()
+	fmt.Println("put error:", err != nil)
+	var reply getReply
+	if err := conn.Invoke(porcupinegrpc.WithClientId(ctx, 0), "/kv.KV/Get", &getRequest{Key: "x"}, &reply); err != nil {
+		panic(err)
+	}
+	fmt.Println("get:", reply.Value)
+
+	// the get is only linearizable because the timed out put is recorded
+	// as pending
+	fmt.Println("pending:", recorder.Pending())
+	fmt.Println("linearizable:", porcupine.CheckOperations(kvModel, recorder.Operations()))
+	// Output:
+	// put error: true
+	// get: b
+	// pending: 1
+	// linearizable: true
+}
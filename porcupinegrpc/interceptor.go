@@ -0,0 +1,112 @@
+// Package porcupinegrpc records histories of gRPC calls to a system under
+// test, for checking with porcupine.
+//
+// It is a separate module, so that the porcupine package itself doesn't
+// depend on gRPC.
+package porcupinegrpc
+
+import (
+	"context"
+	"sync"
+
+	"github.com/anishathalye/porcupine"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// Options configure how [UnaryClientInterceptor] records calls as
+// operations.
+type Options struct {
+	// Input maps the request of a call to the input of an operation. If ok
+	// is false, the call isn't part of the history, and it isn't recorded.
+	// It is required.
+	Input func(method string, req interface{}) (input interface{}, ok bool)
+	// Output maps the reply or error of a call that completed with a known
+	// outcome to the output of its operation. It is required.
+	Output func(method string, req, reply interface{}, err error) interface{}
+	// ClientId returns the client id of a call. If it is nil, the id set
+	// with [WithClientId] is used, and calls without one get an id for
+	// their connection, assigned in order of first use starting at 0.
+	ClientId func(ctx context.Context, cc *grpc.ClientConn) int
+	// Unknown reports whether an error leaves the outcome of a call unknown.
+	// If it is nil, [IsUnknownOutcome] is used.
+	Unknown func(err error) bool
+}
+
+type clientIdKey struct{}
+
+// WithClientId returns a context that makes calls made with it recorded as
+// operations of the given client.
+func WithClientId(ctx context.Context, clientId int) context.Context {
+	return context.WithValue(ctx, clientIdKey{}, clientId)
+}
+
+// ClientIdFromContext returns the client id set with [WithClientId], if any.
+func ClientIdFromContext(ctx context.Context) (int, bool) {
+	id, ok := ctx.Value(clientIdKey{}).(int)
+	return id, ok
+}
+
+// IsUnknownOutcome reports whether a call that failed with err may or may not
+// have taken effect. This is the case for errors with the DeadlineExceeded,
+// Canceled, Unavailable, and Unknown codes, which include transport errors,
+// since the request may have reached the server before the failure.
+func IsUnknownOutcome(err error) bool {
+	switch status.Code(err) {
+	case codes.DeadlineExceeded, codes.Canceled, codes.Unavailable, codes.Unknown:
+		return true
+	default:
+		return false
+	}
+}
+
+// UnaryClientInterceptor returns an interceptor that records the unary calls
+// made through it in r, as operations that are called when the call is
+// invoked and return when it completes.
+//
+// Calls that fail with an error for which opts.Unknown returns true are left
+// pending in r, rather than dropped, because they may have taken effect at any
+// point after they were invoked; see [porcupine.Recorder] for how pending
+// operations appear in the history.
+//
+// A client performs one operation at a time, so if calls are made
+// concurrently through the same connection, opts.ClientId or [WithClientId]
+// must give them distinct client ids.
+func UnaryClientInterceptor(r *porcupine.Recorder, opts Options) grpc.UnaryClientInterceptor {
+	unknown := opts.Unknown
+	if unknown == nil {
+		unknown = IsUnknownOutcome
+	}
+	var mu sync.Mutex
+	conns := make(map[*grpc.ClientConn]int)
+	clientId := opts.ClientId
+	if clientId == nil {
+		clientId = func(ctx context.Context, cc *grpc.ClientConn) int {
+			if id, ok := ClientIdFromContext(ctx); ok {
+				return id
+			}
+			mu.Lock()
+			defer mu.Unlock()
+			id, ok := conns[cc]
+			if !ok {
+				id = len(conns)
+				conns[cc] = id
+			}
+			return id
+		}
+	}
+	return func(ctx context.Context, method string, req, reply interface{}, cc *grpc.ClientConn, invoker grpc.UnaryInvoker, callOpts ...grpc.CallOption) error {
+		input, ok := opts.Input(method, req)
+		if !ok {
+			return invoker(ctx, method, req, reply, cc, callOpts...)
+		}
+		h := r.Begin(clientId(ctx, cc), input)
+		err := invoker(ctx, method, req, reply, cc, callOpts...)
+		if err != nil && unknown(err) {
+			return err
+		}
+		h.End(opts.Output(method, req, reply, err))
+		return err
+	}
+}
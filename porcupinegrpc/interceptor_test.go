@@ -0,0 +1,67 @@
+package porcupinegrpc
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/anishathalye/porcupine"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func TestUnaryClientInterceptor(t *testing.T) {
+	r := porcupine.NewRecorder()
+	interceptor := UnaryClientInterceptor(r, Options{
+		Input: func(method string, req interface{}) (interface{}, bool) {
+			return req, method != "/health"
+		},
+		Output: func(method string, req, reply interface{}, err error) interface{} {
+			if err != nil {
+				return status.Code(err).String()
+			}
+			return "ok"
+		},
+	})
+	invoke := func(ctx context.Context, method string, cc *grpc.ClientConn, err error) {
+		invoker := func(context.Context, string, interface{}, interface{}, *grpc.ClientConn, ...grpc.CallOption) error {
+			return err
+		}
+		if got := interceptor(ctx, method, method, nil, cc, invoker); got != err {
+			t.Fatalf("expected error %v, got %v", err, got)
+		}
+	}
+	a, b := &grpc.ClientConn{}, &grpc.ClientConn{}
+	ctx := context.Background()
+	invoke(ctx, "/a", a, nil)
+	invoke(ctx, "/b", b, status.Error(codes.NotFound, "missing"))
+	invoke(ctx, "/health", a, nil)
+	invoke(WithClientId(ctx, 7), "/c", a, status.Error(codes.DeadlineExceeded, "timeout"))
+	invoke(ctx, "/d", a, status.Error(codes.Unavailable, "connection reset"))
+	invoke(ctx, "/e", b, errors.New("not a status"))
+
+	ops := r.Operations()
+	expected := []struct {
+		clientId int
+		input    string
+		output   interface{}
+	}{
+		{0, "/a", "ok"},
+		{1, "/b", "NotFound"},
+		{7, "/c", nil},
+		{0, "/d", nil},
+		{1, "/e", nil},
+	}
+	if len(ops) != len(expected) {
+		t.Fatalf("expected %d operations, got %+v", len(expected), ops)
+	}
+	for i, e := range expected {
+		if ops[i].ClientId != e.clientId || ops[i].Input != e.input || ops[i].Output != e.output {
+			t.Fatalf("expected operation %d to be %+v, got %+v", i, e, ops[i])
+		}
+	}
+	if r.Pending() != 3 {
+		t.Fatalf("expected 3 pending operations, got %d", r.Pending())
+	}
+}
@@ -0,0 +1,162 @@
+// Package porcupinehttp records histories of operations on services exposed
+// over HTTP, for checking with porcupine, either from the client side, with
+// [NewTransport], or from the service's side, with [Middleware].
+package porcupinehttp
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"net/http"
+	"net/url"
+	"sync"
+)
+
+// DefaultMaxBodySize is the default limit on the size of the request and
+// response bodies that are buffered for the mappings in [Options].
+const DefaultMaxBodySize = 1 << 20
+
+// A Request is an HTTP request, as seen by the mappings in [Options].
+type Request struct {
+	Method string
+	URL    *url.URL
+	Header http.Header
+	// Body holds the request body, up to the limit on the body size.
+	Body []byte
+	// BodyTruncated is whether the body was larger than the limit, so that
+	// Body only holds its beginning.
+	BodyTruncated bool
+}
+
+// A Response is an HTTP response, as seen by the mappings in [Options].
+type Response struct {
+	StatusCode int
+	Header     http.Header
+	// Body holds the response body, up to the limit on the body size.
+	Body []byte
+	// BodyTruncated is whether the body was larger than the limit, or, on
+	// the client side, whether it was closed before being read completely,
+	// so that Body only holds its beginning.
+	BodyTruncated bool
+	// Err is the error of a request that failed with a known outcome, as
+	// reported by Options.Unknown, in which case there is no status, header
+	// or body.
+	Err error
+}
+
+// Options configure how requests are recorded as operations.
+type Options struct {
+	// Input maps a request to the input of an operation. If ok is false,
+	// the request isn't part of the history, and it isn't recorded. It is
+	// required.
+	Input func(req Request) (input interface{}, ok bool)
+	// Output maps the response to a request to the output of its
+	// operation. It is required.
+	Output func(req Request, resp Response) interface{}
+	// ClientId returns the client id of a request. If it is nil, the id
+	// set with [WithClientId] is used, and requests without one are given
+	// the smallest id that is not used by another request in progress, so
+	// that concurrent requests have distinct ids.
+	ClientId func(req *http.Request) int
+	// MaxBodySize limits the size of the bodies that are buffered for
+	// Input and Output, so that large payloads don't use too much memory;
+	// bodies are still sent in full. If it is 0, DefaultMaxBodySize is
+	// used, and if it is negative, bodies are not buffered.
+	MaxBodySize int64
+	// Unknown reports whether an error leaves the outcome of a request
+	// unknown, in which case it is left pending. If it is nil, every error
+	// is treated as an unknown outcome, since the request may have reached
+	// the service before the failure. It is only used by [NewTransport].
+	Unknown func(err error) bool
+}
+
+func (opts Options) maxBodySize() int64 {
+	switch {
+	case opts.MaxBodySize == 0:
+		return DefaultMaxBodySize
+	case opts.MaxBodySize < 0:
+		return 0
+	default:
+		return opts.MaxBodySize
+	}
+}
+
+type clientIdKey struct{}
+
+// WithClientId returns a context that makes requests made with it recorded
+// as operations of the given client.
+func WithClientId(ctx context.Context, clientId int) context.Context {
+	return context.WithValue(ctx, clientIdKey{}, clientId)
+}
+
+// ClientIdFromContext returns the client id set with [WithClientId], if any.
+func ClientIdFromContext(ctx context.Context) (int, bool) {
+	id, ok := ctx.Value(clientIdKey{}).(int)
+	return id, ok
+}
+
+// clientIds assigns client ids to requests, as described in Options.
+type clientIds struct {
+	get func(req *http.Request) int
+	mu  sync.Mutex
+	// inUse holds the ids assigned to requests in progress
+	inUse map[int]bool
+}
+
+func newClientIds(opts Options) *clientIds {
+	return &clientIds{get: opts.ClientId, inUse: make(map[int]bool)}
+}
+
+// acquire returns the client id of a request, and a function to call when the
+// request is done.
+func (c *clientIds) acquire(req *http.Request) (int, func()) {
+	if c.get != nil {
+		return c.get(req), func() {}
+	}
+	if id, ok := ClientIdFromContext(req.Context()); ok {
+		return id, func() {}
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	id := 0
+	for c.inUse[id] {
+		id++
+	}
+	c.inUse[id] = true
+	return id, func() {
+		c.mu.Lock()
+		defer c.mu.Unlock()
+		delete(c.inUse, id)
+	}
+}
+
+// readPrefix reads up to limit bytes from r, and returns them, whether r has
+// more data, and a reader for all of r's data, including the bytes read.
+func readPrefix(r io.Reader, limit int64) ([]byte, bool, io.Reader, error) {
+	prefix, err := io.ReadAll(io.LimitReader(r, limit+1))
+	if err != nil {
+		return nil, false, nil, err
+	}
+	full := io.MultiReader(bytes.NewReader(prefix), r)
+	if int64(len(prefix)) > limit {
+		return prefix[:limit], true, full, nil
+	}
+	return prefix, false, full, nil
+}
+
+// limitedBuffer keeps the first limit bytes written to it.
+type limitedBuffer struct {
+	data      []byte
+	limit     int64
+	truncated bool
+}
+
+func (b *limitedBuffer) Write(p []byte) (int, error) {
+	if room := b.limit - int64(len(b.data)); int64(len(p)) > room {
+		b.data = append(b.data, p[:room]...)
+		b.truncated = true
+	} else {
+		b.data = append(b.data, p...)
+	}
+	return len(p), nil
+}
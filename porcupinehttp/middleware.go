@@ -0,0 +1,86 @@
+package porcupinehttp
+
+import (
+	"io"
+	"net/http"
+
+	"github.com/anishathalye/porcupine"
+)
+
+// Middleware returns a handler that calls next and records the requests it
+// handles in r, to record a history from the service's perspective. An
+// operation is called when the request body has been read, before next is
+// called, and returns when next returns.
+//
+// The request body is buffered for Options.Input up to the limit on the body
+// size, and the rest is streamed to next. If next panics, the operation is
+// left pending, since it may have taken effect. Options.Unknown is not used.
+func Middleware(r *porcupine.Recorder, opts Options, next http.Handler) http.Handler {
+	ids := newClientIds(opts)
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		rec := Request{Method: req.Method, URL: req.URL, Header: req.Header}
+		if req.Body != nil && req.Body != http.NoBody {
+			body, truncated, full, err := readPrefix(req.Body, opts.maxBodySize())
+			if err != nil {
+				http.Error(w, "error reading request body", http.StatusBadRequest)
+				return
+			}
+			rec.Body, rec.BodyTruncated = body, truncated
+			req.Body = struct {
+				io.Reader
+				io.Closer
+			}{full, req.Body}
+		}
+		input, ok := opts.Input(rec)
+		if !ok {
+			next.ServeHTTP(w, req)
+			return
+		}
+
+		clientId, release := ids.acquire(req)
+		defer release()
+		h := r.Begin(clientId, input)
+		rw := &recordingWriter{ResponseWriter: w, buf: limitedBuffer{limit: opts.maxBodySize()}}
+		next.ServeHTTP(rw, req)
+		status := rw.status
+		if status == 0 {
+			status = http.StatusOK
+		}
+		h.End(opts.Output(rec, Response{
+			StatusCode:    status,
+			Header:        w.Header(),
+			Body:          rw.buf.data,
+			BodyTruncated: rw.buf.truncated,
+		}))
+	})
+}
+
+// recordingWriter is a response writer that keeps the status and the
+// beginning of the body.
+type recordingWriter struct {
+	http.ResponseWriter
+	status int
+	buf    limitedBuffer
+}
+
+func (w *recordingWriter) WriteHeader(status int) {
+	if w.status == 0 {
+		w.status = status
+	}
+	w.ResponseWriter.WriteHeader(status)
+}
+
+func (w *recordingWriter) Write(p []byte) (int, error) {
+	if w.status == 0 {
+		w.status = http.StatusOK
+	}
+	w.buf.Write(p)
+	return w.ResponseWriter.Write(p)
+}
+
+// Flush flushes the underlying writer, if it supports flushing.
+func (w *recordingWriter) Flush() {
+	if f, ok := w.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
@@ -0,0 +1,65 @@
+package porcupinehttp
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/anishathalye/porcupine"
+)
+
+func TestMiddleware(t *testing.T) {
+	r := porcupine.NewRecorder()
+	handler := Middleware(r, registerOptions, &registerServer{})
+	serve := func(method, path, body string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, httptest.NewRequest(method, path, strings.NewReader(body)))
+		return w
+	}
+
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			serve(http.MethodPut, "/register", "a")
+			serve(http.MethodGet, "/register", "")
+		}()
+	}
+	wg.Wait()
+	if w := serve(http.MethodGet, "/other", ""); w.Code != http.StatusOK || w.Body.String() != "a" {
+		t.Fatalf("unexpected response %d %q", w.Code, w.Body.String())
+	}
+
+	ops := r.Operations()
+	if len(ops) != 8 {
+		t.Fatalf("expected 8 operations, got %d", len(ops))
+	}
+	for _, op := range ops {
+		if op.ClientId < 0 || op.ClientId >= 4 {
+			t.Fatalf("expected client ids to be reused, got %d", op.ClientId)
+		}
+		if op.Input.(registerInput).write && op.Output != "" || !op.Input.(registerInput).write && op.Output != "a" {
+			t.Fatalf("unexpected operation %+v", op)
+		}
+	}
+	if !porcupine.CheckOperations(registerModel, ops) {
+		t.Fatal("expected history to be linearizable")
+	}
+}
+
+func TestMiddlewarePanic(t *testing.T) {
+	r := porcupine.NewRecorder()
+	handler := Middleware(r, registerOptions, http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		panic("crash")
+	}))
+	func() {
+		defer func() { recover() }()
+		handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodPut, "/register", strings.NewReader("a")))
+	}()
+	if r.Pending() != 1 {
+		t.Fatal("expected operation to be pending")
+	}
+}
@@ -0,0 +1,124 @@
+package porcupinehttp
+
+import (
+	"io"
+	"net/http"
+	"sync"
+
+	"github.com/anishathalye/porcupine"
+)
+
+type transport struct {
+	base     http.RoundTripper
+	recorder *porcupine.Recorder
+	opts     Options
+	ids      *clientIds
+}
+
+// NewTransport returns an [http.RoundTripper] that sends requests with base,
+// or with [http.DefaultTransport] if base is nil, and records them in r. An
+// operation is called right before its request is sent, and returns when its
+// response body has been read completely, or closed.
+//
+// Requests that fail, such as because of a timeout or a reset connection, and
+// responses whose body can't be read completely, are left pending in r,
+// rather than dropped, because they may have taken effect at any point after
+// they were sent; see [porcupine.Recorder] for how pending operations appear
+// in the history. Failed requests can be recorded with a known outcome
+// instead with Options.Unknown.
+func NewTransport(base http.RoundTripper, r *porcupine.Recorder, opts Options) http.RoundTripper {
+	if base == nil {
+		base = http.DefaultTransport
+	}
+	return &transport{base: base, recorder: r, opts: opts, ids: newClientIds(opts)}
+}
+
+func (t *transport) RoundTrip(req *http.Request) (*http.Response, error) {
+	rec := Request{Method: req.Method, URL: req.URL, Header: req.Header}
+	if req.Body != nil && req.Body != http.NoBody {
+		body, truncated, full, err := readPrefix(req.Body, t.opts.maxBodySize())
+		if err != nil {
+			req.Body.Close()
+			return nil, err
+		}
+		rec.Body, rec.BodyTruncated = body, truncated
+		// RoundTrip must not modify the request
+		orig := req
+		req = orig.Clone(orig.Context())
+		req.Body = struct {
+			io.Reader
+			io.Closer
+		}{full, orig.Body}
+	}
+	input, ok := t.opts.Input(rec)
+	if !ok {
+		return t.base.RoundTrip(req)
+	}
+
+	clientId, release := t.ids.acquire(req)
+	h := t.recorder.Begin(clientId, input)
+	resp, err := t.base.RoundTrip(req)
+	if err != nil {
+		release()
+		if t.opts.Unknown != nil && !t.opts.Unknown(err) {
+			h.End(t.opts.Output(rec, Response{Err: err}))
+		}
+		return nil, err
+	}
+	resp.Body = &recordingBody{
+		body: resp.Body,
+		buf:  limitedBuffer{limit: t.opts.maxBodySize()},
+		resp: resp,
+		end: func(output Response) {
+			release()
+			h.End(t.opts.Output(rec, output))
+		},
+		release: release,
+	}
+	return resp, nil
+}
+
+// recordingBody is a response body that ends its operation when it has been
+// read completely, or closed.
+type recordingBody struct {
+	body io.ReadCloser
+	buf  limitedBuffer
+	// read is the number of bytes read from body
+	read int64
+	resp *http.Response
+	end  func(Response)
+	// release is called instead of end if the operation is left pending
+	release func()
+	once    sync.Once
+}
+
+func (b *recordingBody) Read(p []byte) (int, error) {
+	n, err := b.body.Read(p)
+	b.buf.Write(p[:n])
+	b.read += int64(n)
+	if err == io.EOF {
+		b.finish(false)
+	} else if err != nil {
+		// the response was cut off, so its outcome is unknown
+		b.once.Do(b.release)
+	}
+	return n, err
+}
+
+func (b *recordingBody) Close() error {
+	// a body that is closed before EOF is complete only if it has a known
+	// length, and all of it was read
+	b.finish(b.resp.ContentLength < 0 || b.read < b.resp.ContentLength)
+	return b.body.Close()
+}
+
+func (b *recordingBody) finish(incomplete bool) {
+	b.once.Do(func() {
+		b.end(Response{
+			StatusCode:    b.resp.StatusCode,
+			Header:        b.resp.Header,
+			Body:          b.buf.data,
+			BodyTruncated: b.buf.truncated || incomplete,
+		})
+	})
+}
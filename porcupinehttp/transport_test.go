@@ -0,0 +1,211 @@
+package porcupinehttp
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/anishathalye/porcupine"
+)
+
+// registerServer is a register service: a PUT sets the value to the request
+// body, and a GET returns it. A PUT with a "delay" query parameter sleeps
+// after setting the value, and a GET of /reset resets the connection.
+type registerServer struct {
+	mu    sync.Mutex
+	value string
+}
+
+func (s *registerServer) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	switch {
+	case req.URL.Path == "/reset":
+		conn, _, err := w.(http.Hijacker).Hijack()
+		if err == nil {
+			conn.Close()
+		}
+	case req.Method == http.MethodPut:
+		body, _ := io.ReadAll(req.Body)
+		s.mu.Lock()
+		s.value = string(body)
+		s.mu.Unlock()
+		if d, err := time.ParseDuration(req.URL.Query().Get("delay")); err == nil {
+			time.Sleep(d)
+		}
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		io.WriteString(w, s.value)
+	}
+}
+
+type registerInput struct {
+	write bool
+	value string
+}
+
+// registerModel is a register model that accepts a nil output from a pending
+// operation as any outcome
+var registerModel = porcupine.Model{
+	Init: func() interface{} { return "" },
+	Step: func(state, input, output interface{}) (bool, interface{}) {
+		inp := input.(registerInput)
+		if inp.write {
+			return true, inp.value
+		}
+		return output == nil || output.(string) == state.(string), state
+	},
+}
+
+var registerOptions = Options{
+	Input: func(req Request) (interface{}, bool) {
+		if req.URL.Path != "/register" {
+			return nil, false
+		}
+		return registerInput{write: req.Method == http.MethodPut, value: string(req.Body)}, true
+	},
+	Output: func(req Request, resp Response) interface{} {
+		return string(resp.Body)
+	},
+}
+
+func TestTransport(t *testing.T) {
+	server := httptest.NewServer(&registerServer{})
+	defer server.Close()
+	r := porcupine.NewRecorder()
+	client := &http.Client{Transport: NewTransport(nil, r, registerOptions)}
+
+	do := func(method, path, body string) (string, error) {
+		req, err := http.NewRequest(method, server.URL+path, strings.NewReader(body))
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp, err := client.Do(req)
+		if err != nil {
+			return "", err
+		}
+		defer resp.Body.Close()
+		data, err := io.ReadAll(resp.Body)
+		return string(data), err
+	}
+
+	if _, err := do(http.MethodPut, "/register", "a"); err != nil {
+		t.Fatal(err)
+	}
+	// the put takes effect, but the client times out
+	client.Timeout = 50 * time.Millisecond
+	if _, err := do(http.MethodPut, "/register?delay=200ms", "b"); err == nil {
+		t.Fatal("expected a timeout")
+	}
+	client.Timeout = 0
+	if _, err := do(http.MethodGet, "/reset", ""); err == nil {
+		t.Fatal("expected a reset connection")
+	}
+	if v, err := do(http.MethodGet, "/register", ""); err != nil || v != "b" {
+		t.Fatalf("expected to read b, got %q, %v", v, err)
+	}
+
+	ops := r.Operations()
+	if len(ops) != 3 {
+		t.Fatalf("expected 3 operations, got %+v", ops)
+	}
+	if ops[0].Input != (registerInput{true, "a"}) || ops[0].Output != "" {
+		t.Fatalf("unexpected operation %+v", ops[0])
+	}
+	if ops[1].Input != (registerInput{true, "b"}) || ops[1].Output != nil {
+		t.Fatalf("expected timed out put to be pending, got %+v", ops[1])
+	}
+	if ops[2].Output != "b" {
+		t.Fatalf("unexpected operation %+v", ops[2])
+	}
+	// the read is only explained by the pending put
+	if !porcupine.CheckOperations(registerModel, ops) {
+		t.Fatal("expected history to be linearizable")
+	}
+}
+
+func TestTransportKnownOutcome(t *testing.T) {
+	r := porcupine.NewRecorder()
+	failure := errors.New("connection refused")
+	opts := registerOptions
+	opts.Unknown = func(err error) bool { return false }
+	opts.Output = func(req Request, resp Response) interface{} {
+		return resp.Err
+	}
+	base := roundTripperFunc(func(req *http.Request) (*http.Response, error) {
+		return nil, failure
+	})
+	client := &http.Client{Transport: NewTransport(base, r, opts)}
+	if _, err := client.Get("http://example.com/register"); err == nil {
+		t.Fatal("expected an error")
+	}
+	ops := r.Operations()
+	if len(ops) != 1 || ops[0].Output != failure {
+		t.Fatalf("expected a failed operation, got %+v", ops)
+	}
+}
+
+type roundTripperFunc func(req *http.Request) (*http.Response, error)
+
+func (f roundTripperFunc) RoundTrip(req *http.Request) (*http.Response, error) {
+	return f(req)
+}
+
+func TestTransportBodies(t *testing.T) {
+	var received []byte
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		received, _ = io.ReadAll(req.Body)
+		w.Write(received)
+	}))
+	defer server.Close()
+
+	r := porcupine.NewRecorder()
+	var requests []Request
+	var responses []Response
+	client := &http.Client{Transport: NewTransport(nil, r, Options{
+		Input: func(req Request) (interface{}, bool) {
+			requests = append(requests, req)
+			return len(requests), true
+		},
+		Output: func(req Request, resp Response) interface{} {
+			responses = append(responses, resp)
+			return resp.StatusCode
+		},
+		MaxBodySize: 4,
+	})}
+	payload := bytes.Repeat([]byte("x"), 100)
+	resp, err := client.Post(server.URL, "text/plain", bytes.NewReader(payload))
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if !bytes.Equal(received, payload) || !bytes.Equal(data, payload) {
+		t.Fatal("expected the full bodies to be sent")
+	}
+	if string(requests[0].Body) != "xxxx" || !requests[0].BodyTruncated {
+		t.Fatalf("expected a truncated request body, got %+v", requests[0])
+	}
+	if string(responses[0].Body) != "xxxx" || !responses[0].BodyTruncated || responses[0].StatusCode != http.StatusOK {
+		t.Fatalf("expected a truncated response body, got %+v", responses[0])
+	}
+
+	// closing a body before reading it ends the operation
+	resp, err = client.Post(server.URL, "text/plain", strings.NewReader("ab"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if r.Pending() != 1 {
+		t.Fatalf("expected operation to be in progress until the body is read")
+	}
+	resp.Body.Close()
+	if r.Pending() != 0 || !responses[1].BodyTruncated || string(requests[1].Body) != "ab" || requests[1].BodyTruncated {
+		t.Fatalf("unexpected request %+v and response %+v", requests[1], responses[1])
+	}
+}
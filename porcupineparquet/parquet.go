@@ -0,0 +1,279 @@
+// Package porcupineparquet reads histories of operations from Parquet files,
+// for checking with porcupine.
+//
+// It is a separate module, so that the porcupine package itself doesn't
+// depend on a Parquet implementation.
+package porcupineparquet
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/anishathalye/porcupine"
+	"github.com/parquet-go/parquet-go"
+	"github.com/parquet-go/parquet-go/format"
+)
+
+// A Row is a row of a Parquet file, from column name to value. Columns nested
+// in groups are named by their path, joined with ".".
+//
+// Values have the Go type corresponding to the physical type of their
+// column: bool, int32, int64, float32, float64, or []byte, except that
+// values of byte array columns annotated as strings, enums, or JSON are
+// strings. Null values are nil.
+type Row map[string]interface{}
+
+// Int64 returns the value of an integer column, which must not be null.
+func (r Row) Int64(column string) (int64, error) {
+	switch v := r[column].(type) {
+	case int64:
+		return v, nil
+	case int32:
+		return int64(v), nil
+	case nil:
+		if _, ok := r[column]; !ok {
+			return 0, fmt.Errorf("no column %q", column)
+		}
+		return 0, fmt.Errorf("column %q is null", column)
+	default:
+		return 0, fmt.Errorf("column %q is a %T, not an integer", column, v)
+	}
+}
+
+// String returns the value of a string or byte array column, which must not
+// be null.
+func (r Row) String(column string) (string, error) {
+	switch v := r[column].(type) {
+	case string:
+		return v, nil
+	case []byte:
+		return string(v), nil
+	case nil:
+		if _, ok := r[column]; !ok {
+			return "", fmt.Errorf("no column %q", column)
+		}
+		return "", fmt.Errorf("column %q is null", column)
+	default:
+		return "", fmt.Errorf("column %q is a %T, not a string", column, v)
+	}
+}
+
+// rowBatchSize is the number of rows read from a row group at a time.
+const rowBatchSize = 1024
+
+// A HistoryReader reads operations one at a time from a Parquet file, like
+// [porcupine.HistoryReader]:
+//
+//	hr, err := porcupineparquet.ReadParquetHistory(path, mapRow)
+//	if err != nil {
+//		...
+//	}
+//	defer hr.Close()
+//	for hr.Next() {
+//		op := hr.Operation()
+//		...
+//	}
+//	if err := hr.Err(); err != nil {
+//		...
+//	}
+//
+// The file is read one row group at a time, and rows are read from a row
+// group in small batches, so the memory used doesn't depend on the size of
+// the file.
+type HistoryReader struct {
+	file      *os.File
+	columns   []string
+	strings   []bool // whether each column holds strings
+	rowGroups []parquet.RowGroup
+	rows      parquet.Rows
+	buf       []parquet.Row
+	n, i      int   // number of rows in buf, and index of the next one
+	row       int64 // index of the next row in the file
+	mapRow    func(Row) (porcupine.Operation, error)
+	op        porcupine.Operation
+	err       error
+}
+
+// ReadParquetHistory opens a Parquet file, and returns a reader for the
+// history it contains, with one operation per row, as converted by mapRow.
+// For example, for a file with the columns "client", "input", "output",
+// "call_ns", and "return_ns":
+//
+//	func mapRow(row porcupineparquet.Row) (porcupine.Operation, error) {
+//		var op porcupine.Operation
+//		client, err := row.Int64("client")
+//		if err != nil {
+//			return op, err
+//		}
+//		...
+//	}
+//
+// Pending operations, such as rows with a null return time, must be mapped to
+// operations that the model accepts as pending, as described in
+// [porcupine.Recorder].
+//
+// It returns an error if the file can't be read, or if it has repeated
+// columns, such as lists, which can't be represented in a Row. The reader
+// must be closed to close the file.
+func ReadParquetHistory(path string, mapRow func(Row) (porcupine.Operation, error)) (*HistoryReader, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("porcupineparquet: %w", err)
+	}
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return nil, fmt.Errorf("porcupineparquet: %w", err)
+	}
+	pf, err := parquet.OpenFile(file, info.Size())
+	if err != nil {
+		file.Close()
+		return nil, fmt.Errorf("porcupineparquet: opening %s: %w", path, err)
+	}
+	hr := &HistoryReader{
+		file:      file,
+		rowGroups: pf.RowGroups(),
+		buf:       make([]parquet.Row, rowBatchSize),
+		mapRow:    mapRow,
+	}
+	schema := pf.Schema()
+	for _, path := range schema.Columns() {
+		leaf, _ := schema.Lookup(path...)
+		name := strings.Join(path, ".")
+		if leaf.MaxRepetitionLevel > 0 {
+			file.Close()
+			return nil, fmt.Errorf("porcupineparquet: column %q is repeated", name)
+		}
+		hr.columns = append(hr.columns, name)
+		hr.strings = append(hr.strings, isString(leaf.Node.Type()))
+	}
+	return hr, nil
+}
+
+func isString(t parquet.Type) bool {
+	if t.Kind() != parquet.ByteArray || t.LogicalType() == nil {
+		return false
+	}
+	switch t.LogicalType().Value.(type) {
+	case *format.StringType, *format.EnumType, *format.JsonType:
+		return true
+	}
+	return false
+}
+
+// Next reads the next operation, which is then available through
+// [HistoryReader.Operation]. It returns false when it reaches the end of the
+// file or an error, after which [HistoryReader.Err] returns the error, if
+// any.
+func (hr *HistoryReader) Next() bool {
+	for hr.err == nil && hr.i == hr.n {
+		hr.err = hr.fill()
+	}
+	if hr.err != nil {
+		return false
+	}
+	row := make(Row, len(hr.columns))
+	for _, v := range hr.buf[hr.i] {
+		row[hr.columns[v.Column()]] = hr.value(v)
+	}
+	hr.i++
+	hr.row++
+	op, err := hr.mapRow(row)
+	if err != nil {
+		hr.err = fmt.Errorf("porcupineparquet: row %d: %w", hr.row-1, err)
+		return false
+	}
+	hr.op = op
+	return true
+}
+
+// fill reads the next batch of rows, moving on to the next row group if the
+// current one has no more rows. It returns io.EOF after the last row group.
+func (hr *HistoryReader) fill() error {
+	if hr.rows == nil {
+		if len(hr.rowGroups) == 0 {
+			return io.EOF
+		}
+		hr.rows = hr.rowGroups[0].Rows()
+		hr.rowGroups = hr.rowGroups[1:]
+	}
+	n, err := hr.rows.ReadRows(hr.buf)
+	hr.n, hr.i = n, 0
+	if err == io.EOF {
+		err = hr.rows.Close()
+		hr.rows = nil
+	}
+	if err != nil {
+		return fmt.Errorf("porcupineparquet: reading row %d: %w", hr.row, err)
+	}
+	return nil
+}
+
+func (hr *HistoryReader) value(v parquet.Value) interface{} {
+	if v.IsNull() {
+		return nil
+	}
+	switch v.Kind() {
+	case parquet.Boolean:
+		return v.Boolean()
+	case parquet.Int32:
+		return v.Int32()
+	case parquet.Int64:
+		return v.Int64()
+	case parquet.Float:
+		return v.Float()
+	case parquet.Double:
+		return v.Double()
+	case parquet.ByteArray, parquet.FixedLenByteArray:
+		if hr.strings[v.Column()] {
+			return string(v.ByteArray())
+		}
+		// the reader reuses the memory of byte arrays
+		return append([]byte(nil), v.ByteArray()...)
+	default:
+		// 96-bit integers are deprecated
+		return v.Bytes()
+	}
+}
+
+// Operation returns the operation read by the most recent call to
+// [HistoryReader.Next].
+func (hr *HistoryReader) Operation() porcupine.Operation {
+	return hr.op
+}
+
+// ReadBatch reads up to max operations, for processing a history in batches.
+// It returns io.EOF, and no operations, at the end of the file.
+func (hr *HistoryReader) ReadBatch(max int) ([]porcupine.Operation, error) {
+	var ops []porcupine.Operation
+	for len(ops) < max && hr.Next() {
+		ops = append(ops, hr.Operation())
+	}
+	if err := hr.Err(); err != nil {
+		return ops, err
+	}
+	if len(ops) == 0 {
+		return nil, io.EOF
+	}
+	return ops, nil
+}
+
+// Err returns the first error that was encountered by the reader, or nil if
+// it reached the end of the file.
+func (hr *HistoryReader) Err() error {
+	if hr.err == io.EOF {
+		return nil
+	}
+	return hr.err
+}
+
+// Close closes the file.
+func (hr *HistoryReader) Close() error {
+	if hr.rows != nil {
+		hr.rows.Close()
+		hr.rows = nil
+	}
+	return hr.file.Close()
+}
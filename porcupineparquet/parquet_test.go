@@ -0,0 +1,226 @@
+package porcupineparquet
+
+import (
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/anishathalye/porcupine"
+	"github.com/parquet-go/parquet-go"
+)
+
+// record is a row of a history of operations on a key-value store, with a
+// null return time for pending operations.
+type record struct {
+	Client   int64  `parquet:"client"`
+	Op       string `parquet:"op"`
+	Key      string `parquet:"key"`
+	Value    string `parquet:"value"`
+	CallNs   int64  `parquet:"call_ns"`
+	ReturnNs *int64 `parquet:"return_ns,optional"`
+}
+
+type kvInput struct {
+	op    string
+	key   string
+	value string
+}
+
+// kvModel is a key-value store with gets and puts, where a get's output is
+// the value it read, and a nil output is a pending operation.
+var kvModel = porcupine.Model{
+	Init: func() interface{} { return map[string]string{} },
+	Step: func(state, input, output interface{}) (bool, interface{}) {
+		st := state.(map[string]string)
+		in := input.(kvInput)
+		if in.op == "get" {
+			return output == nil || output.(string) == st[in.key], state
+		}
+		next := make(map[string]string, len(st)+1)
+		for k, v := range st {
+			next[k] = v
+		}
+		next[in.key] = in.value
+		return true, next
+	},
+	Equal: func(a, b interface{}) bool {
+		return reflect.DeepEqual(a, b)
+	},
+}
+
+func mapRecord(row Row) (porcupine.Operation, error) {
+	var op porcupine.Operation
+	client, err := row.Int64("client")
+	if err != nil {
+		return op, err
+	}
+	var in kvInput
+	if in.op, err = row.String("op"); err != nil {
+		return op, err
+	}
+	if in.key, err = row.String("key"); err != nil {
+		return op, err
+	}
+	if in.value, err = row.String("value"); err != nil {
+		return op, err
+	}
+	if op.Call, err = row.Int64("call_ns"); err != nil {
+		return op, err
+	}
+	op.ClientId = int(client)
+	op.Input = in
+	if row["return_ns"] == nil {
+		// pending, with a return time after every other operation
+		op.Return = 1 << 62
+		return op, nil
+	}
+	if op.Return, err = row.Int64("return_ns"); err != nil {
+		return op, err
+	}
+	if in.op == "get" {
+		op.Output = in.value
+	} else {
+		op.Output = ""
+	}
+	return op, nil
+}
+
+func writeFixture(t *testing.T, records []record) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "history.parquet")
+	f, err := os.Create(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// small row groups, so that the history spans several of them
+	w := parquet.NewGenericWriter[record](f, parquet.MaxRowsPerRowGroup(2))
+	if _, err := w.Write(records); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := f.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func ret(t int64) *int64 {
+	return &t
+}
+
+var records = []record{
+	{0, "put", "x", "1", 0, ret(10)},
+	{1, "get", "x", "1", 5, ret(15)},
+	{2, "put", "y", "2", 6, nil},
+	{0, "get", "y", "2", 20, ret(30)},
+	{1, "get", "x", "", 25, ret(35)},
+}
+
+func TestReadParquetHistory(t *testing.T) {
+	path := writeFixture(t, records)
+	hr, err := ReadParquetHistory(path, mapRecord)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer hr.Close()
+	var ops []porcupine.Operation
+	for hr.Next() {
+		ops = append(ops, hr.Operation())
+	}
+	if err := hr.Err(); err != nil {
+		t.Fatal(err)
+	}
+	expected := []porcupine.Operation{
+		{ClientId: 0, Input: kvInput{"put", "x", "1"}, Call: 0, Output: "", Return: 10},
+		{ClientId: 1, Input: kvInput{"get", "x", "1"}, Call: 5, Output: "1", Return: 15},
+		{ClientId: 2, Input: kvInput{"put", "y", "2"}, Call: 6, Output: nil, Return: 1 << 62},
+		{ClientId: 0, Input: kvInput{"get", "y", "2"}, Call: 20, Output: "2", Return: 30},
+		{ClientId: 1, Input: kvInput{"get", "x", ""}, Call: 25, Output: "", Return: 35},
+	}
+	if !reflect.DeepEqual(ops, expected) {
+		t.Fatalf("expected %v, got %v", expected, ops)
+	}
+	// the last get misses the first put
+	if porcupine.CheckOperations(kvModel, ops) {
+		t.Fatal("expected history to not be linearizable")
+	}
+	if !porcupine.CheckOperations(kvModel, ops[:4]) {
+		t.Fatal("expected history without the last get to be linearizable")
+	}
+	if hr.Next() {
+		t.Fatal("expected no more operations")
+	}
+}
+
+func TestReadBatch(t *testing.T) {
+	path := writeFixture(t, records)
+	hr, err := ReadParquetHistory(path, mapRecord)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer hr.Close()
+	var sizes []int
+	for {
+		batch, err := hr.ReadBatch(2)
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		sizes = append(sizes, len(batch))
+	}
+	if !reflect.DeepEqual(sizes, []int{2, 2, 1}) {
+		t.Fatalf("unexpected batch sizes %v", sizes)
+	}
+}
+
+func TestReadParquetHistoryErrors(t *testing.T) {
+	path := writeFixture(t, records)
+	failure := errors.New("bad row")
+	hr, err := ReadParquetHistory(path, func(row Row) (porcupine.Operation, error) {
+		if row["call_ns"] == int64(6) {
+			return porcupine.Operation{}, failure
+		}
+		return mapRecord(row)
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer hr.Close()
+	n := 0
+	for hr.Next() {
+		n++
+	}
+	if n != 2 || !errors.Is(hr.Err(), failure) || !strings.Contains(hr.Err().Error(), "row 2") {
+		t.Fatalf("expected an error for row 2 after 2 operations, got %d and %v", n, hr.Err())
+	}
+
+	// a missing column
+	hr, err = ReadParquetHistory(path, func(row Row) (porcupine.Operation, error) {
+		_, err := row.Int64("process")
+		return porcupine.Operation{}, err
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer hr.Close()
+	if hr.Next() || hr.Err() == nil || !strings.Contains(hr.Err().Error(), `no column "process"`) {
+		t.Fatalf("expected an error for a missing column, got %v", hr.Err())
+	}
+
+	// not a Parquet file
+	other := filepath.Join(t.TempDir(), "history.txt")
+	if err := os.WriteFile(other, []byte("not parquet"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := ReadParquetHistory(other, mapRecord); err == nil {
+		t.Fatal("expected an error for a file that isn't Parquet")
+	}
+}
@@ -0,0 +1,160 @@
+package porcupine
+
+import "sort"
+
+// CheckPrefix checks whether a history is prefix consistent: whether there is
+// a single order of all the writes, in which each write comes after the writes
+// that returned before it was called, such that every read returns what the
+// model would after some prefix of that order, and the prefixes that each
+// client's reads see, in the order of their calls, don't get shorter. This is
+// weaker than linearizability, since a read can see an old prefix, however
+// long after the writes it missed; it is stronger than eventual consistency,
+// since all clients see the writes in the same order.
+//
+// The model's Accesses function says which operations are writes, those with
+// a write access, and which are reads. Reads must leave the model's state
+// unchanged. The model's partition functions aren't used, since there is one
+// order of all the writes; to check each partition's writes separately, as
+// for timeline consistency, check each partition's operations on their own.
+// If the model has no Accesses function, the writes can't be told apart from
+// the reads, and the result is Unknown.
+//
+// Like checking linearizability, this searches orders of the writes, and
+// takes time exponential in the number of writes that are concurrent with
+// each other.
+func CheckPrefix(model Model, history []Operation) CheckResult {
+	if model.Accesses == nil {
+		return Unknown
+	}
+	model = fillDefault(model)
+	s := &prefixSearch{model: model, history: history}
+	clients := make(map[int]int)
+	for i, op := range history {
+		write := false
+		for _, a := range model.Accesses(op.Input, op.Output) {
+			write = write || a.Write
+		}
+		if write {
+			s.writes = append(s.writes, i)
+			continue
+		}
+		c, ok := clients[op.ClientId]
+		if !ok {
+			c = len(s.reads)
+			clients[op.ClientId] = c
+			s.reads = append(s.reads, nil)
+		}
+		s.reads[c] = append(s.reads[c], i)
+	}
+	byCall := func(ops []int) {
+		sort.SliceStable(ops, func(a, b int) bool { return history[ops[a]].Call < history[ops[b]].Call })
+	}
+	byCall(s.writes)
+	for _, reads := range s.reads {
+		byCall(reads)
+	}
+	s.seen = make(map[uint64][]prefixPosition)
+	placed := newBitset(uint(len(s.writes)))
+	if s.search(placed, 0, model.Init(), make([]int, len(s.reads))) {
+		return Ok
+	}
+	return Illegal
+}
+
+type prefixSearch struct {
+	model   Model
+	history []Operation
+	writes  []int   // indices in the history, in the order of their calls
+	reads   [][]int // of each client, in the order of their calls
+	seen    map[uint64][]prefixPosition
+}
+
+// A prefixPosition is a point in the search that led nowhere: the writes
+// placed so far, the state they lead to, and the next read of each client.
+type prefixPosition struct {
+	placed bitset
+	state  interface{}
+	next   []int
+}
+
+// search places the rest of the writes after the ones in placed, which lead to
+// state, and returns whether the reads from next on can all see prefixes of
+// the order.
+func (s *prefixSearch) search(placed bitset, count int, state interface{}, next []int) bool {
+	// a read that can see this prefix might as well, since the reads
+	// after it can only see longer ones
+	next = append([]int(nil), next...)
+	done := true
+	for c, reads := range s.reads {
+		for next[c] < len(reads) {
+			read := s.history[reads[next[c]]]
+			if ok, _ := s.model.Step(state, read.Input, read.Output); !ok {
+				break
+			}
+			next[c]++
+		}
+		done = done && next[c] == len(reads)
+	}
+	if count == len(s.writes) {
+		return done
+	}
+	hash := uint64(count)
+	for _, word := range placed {
+		hash = mixHash(hash, word)
+	}
+	for _, n := range next {
+		hash = mixHash(hash, uint64(n))
+	}
+	for _, p := range s.seen[hash] {
+		if p.placed.equals(placed) && sameIds(p.next, next) && s.model.Equal(p.state, state) {
+			return false
+		}
+	}
+	for i, w := range s.writes {
+		if placed.get(uint(i)) || !s.ready(placed, i) {
+			continue
+		}
+		write := s.history[w]
+		ok, nextState := s.model.Step(state, write.Input, write.Output)
+		if !ok {
+			continue
+		}
+		placed.set(uint(i))
+		found := s.search(placed, count+1, nextState, next)
+		placed.clear(uint(i))
+		if found {
+			return true
+		}
+	}
+	s.seen[hash] = append(s.seen[hash], prefixPosition{placed.clone(), state, next})
+	return false
+}
+
+// ready returns whether every write that returned before the call of the
+// write with index i in s.writes has been placed.
+func (s *prefixSearch) ready(placed bitset, i int) bool {
+	call := s.history[s.writes[i]].Call
+	for j, w := range s.writes {
+		if s.history[w].Call >= call {
+			// the writes after this one in s.writes were called
+			// after it too
+			break
+		}
+		if s.history[w].Return < call && !placed.get(uint(j)) {
+			return false
+		}
+	}
+	return true
+}
+
+func sameIds(a, b []int) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
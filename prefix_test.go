@@ -0,0 +1,123 @@
+package porcupine
+
+import (
+	"math/rand"
+	"testing"
+)
+
+func checkPrefixAndLinearizable(t *testing.T, model Model, ops []Operation, prefix, linearizable CheckResult) {
+	t.Helper()
+	if res := CheckPrefix(model, ops); res != prefix {
+		t.Fatalf("expected prefix consistency %v, got %v", prefix, res)
+	}
+	if res := CheckOperationsTimeout(model, ops, 0); res != linearizable {
+		t.Fatalf("expected linearizability %v, got %v", linearizable, res)
+	}
+}
+
+func TestPrefixStaleReads(t *testing.T) {
+	// reads may see old prefixes, long after the writes they missed
+	ops := []Operation{
+		sessionPut(0, 1, 0, 10),
+		sessionPut(0, 2, 20, 30),
+		sessionGet(1, 0, 40, 50),
+		sessionGet(1, 1, 60, 70),
+		sessionGet(2, 2, 40, 50),
+		sessionGet(3, 1, 80, 90),
+	}
+	checkPrefixAndLinearizable(t, sessionRegisterModel(), ops, Ok, Illegal)
+}
+
+func TestPrefixMonotonicPerClient(t *testing.T) {
+	// a client's reads can't see a shorter prefix than before
+	ops := []Operation{
+		sessionPut(0, 1, 0, 10),
+		sessionGet(1, 1, 20, 30),
+		sessionGet(1, 0, 40, 50),
+	}
+	checkPrefixAndLinearizable(t, sessionRegisterModel(), ops, Illegal, Illegal)
+	// but another client's can
+	ops[2].ClientId = 2
+	checkPrefixAndLinearizable(t, sessionRegisterModel(), ops, Ok, Illegal)
+}
+
+func TestPrefixSingleOrder(t *testing.T) {
+	// two clients see concurrent writes in different orders
+	ops := []Operation{
+		sessionPut(0, 1, 0, 100),
+		sessionPut(1, 2, 0, 100),
+		sessionGet(2, 1, 10, 20),
+		sessionGet(2, 2, 30, 40),
+		sessionGet(3, 2, 10, 20),
+		sessionGet(3, 1, 30, 40),
+	}
+	checkPrefixAndLinearizable(t, sessionRegisterModel(), ops, Illegal, Illegal)
+	// in the same order, they agree
+	ops[4].Output, ops[5].Output = 1, 2
+	checkPrefixAndLinearizable(t, sessionRegisterModel(), ops, Ok, Ok)
+}
+
+func TestPrefixWriteOrder(t *testing.T) {
+	// writes are ordered by real time, so no client may see the second
+	// write before the first
+	ops := []Operation{
+		sessionPut(0, 1, 0, 10),
+		sessionPut(1, 2, 20, 30),
+		sessionGet(2, 2, 40, 50),
+		sessionGet(2, 1, 60, 70),
+	}
+	checkPrefixAndLinearizable(t, sessionRegisterModel(), ops, Illegal, Illegal)
+	// a value that was never written is never seen
+	ops = []Operation{
+		sessionPut(0, 1, 0, 10),
+		sessionGet(1, 3, 20, 30),
+	}
+	checkPrefixAndLinearizable(t, sessionRegisterModel(), ops, Illegal, Illegal)
+}
+
+func TestPrefixKv(t *testing.T) {
+	// there is one order of the writes to all the keys: client 2 sees x
+	// written before y, so client 3 can't see y without x
+	model := kvModel
+	model.Accesses = kvAccesses
+	ops := []Operation{
+		{0, kvInput{op: 1, key: "x", value: "a"}, 0, kvOutput{}, 100},
+		{1, kvInput{op: 1, key: "y", value: "b"}, 0, kvOutput{}, 100},
+		{2, kvInput{op: 0, key: "x"}, 10, kvOutput{"a"}, 20},
+		{2, kvInput{op: 0, key: "y"}, 30, kvOutput{""}, 40},
+		{3, kvInput{op: 0, key: "y"}, 10, kvOutput{"b"}, 20},
+		{3, kvInput{op: 0, key: "x"}, 30, kvOutput{""}, 40},
+	}
+	if res := CheckPrefix(model, ops); res != Illegal {
+		t.Fatalf("expected output %v, got output %v", Illegal, res)
+	}
+	// checked separately, each key is consistent
+	for _, partition := range model.Partition(ops) {
+		if res := CheckPrefix(model, partition); res != Ok {
+			t.Fatalf("expected output %v, got output %v", Ok, res)
+		}
+	}
+}
+
+func TestPrefixNoAccesses(t *testing.T) {
+	// without Accesses, the writes are unknown
+	ops := []Operation{
+		{0, kvInput{op: 1, key: "x", value: "a"}, 0, kvOutput{}, 10},
+		{1, kvInput{op: 0, key: "x"}, 20, kvOutput{"a"}, 30},
+	}
+	if res := CheckPrefix(kvModel, ops); res != Unknown {
+		t.Fatalf("expected output %v, got output %v", Unknown, res)
+	}
+}
+
+func TestPrefixRandomLinearizable(t *testing.T) {
+	// linearizable histories are prefix consistent
+	model := sessionRegisterModel()
+	rng := rand.New(rand.NewSource(1))
+	for i := 0; i < 20; i++ {
+		ops := randomRegisterHistory(rng, 4, 50)
+		if res := CheckPrefix(model, ops); res != Ok {
+			t.Fatalf("expected output %v, got output %v for %v", Ok, res, ops)
+		}
+	}
+}
@@ -0,0 +1,49 @@
+package porcupine
+
+import (
+	"context"
+	"runtime/pprof"
+	"strconv"
+)
+
+// Profiler labels that the checker sets, so that a CPU profile of a slow
+// check shows which partition, and which of the model's functions, the time
+// went to. Every goroutine that checks a partition is labeled with the
+// partition and its number of operations, and with
+// CheckOptions.LabelCallbacks, calls to the model's Step and Equal functions
+// are labeled with the function.
+const (
+	PartitionLabel  = "porcupine_partition"
+	OperationsLabel = "porcupine_operations"
+	CallbackLabel   = "porcupine_callback"
+)
+
+// partitionLabels returns the labels of the goroutine that checks a
+// partition.
+func partitionLabels(partition int, history []entry) pprof.LabelSet {
+	return pprof.Labels(PartitionLabel, strconv.Itoa(partition), OperationsLabel, strconv.Itoa(len(history)/2))
+}
+
+// labelCallbacks wraps the Step and Equal functions of a model so that
+// their calls are labeled on top of the labels of ctx, which must be those
+// of the goroutine that calls them. The labeled contexts are built once, so
+// that each call only swaps the labels of the goroutine, which doesn't
+// allocate, but is still much slower than a Step that only compares values.
+func labelCallbacks(ctx context.Context, model Model) Model {
+	step, equal := model.Step, model.Equal
+	stepCtx := pprof.WithLabels(ctx, pprof.Labels(CallbackLabel, "Step"))
+	equalCtx := pprof.WithLabels(ctx, pprof.Labels(CallbackLabel, "Equal"))
+	model.Step = func(state, input, output interface{}) (bool, interface{}) {
+		pprof.SetGoroutineLabels(stepCtx)
+		ok, next := step(state, input, output)
+		pprof.SetGoroutineLabels(ctx)
+		return ok, next
+	}
+	model.Equal = func(state1, state2 interface{}) bool {
+		pprof.SetGoroutineLabels(equalCtx)
+		eq := equal(state1, state2)
+		pprof.SetGoroutineLabels(ctx)
+		return eq
+	}
+	return model
+}
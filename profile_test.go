@@ -0,0 +1,167 @@
+package porcupine
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/binary"
+	"io"
+	"math/rand"
+	"runtime/pprof"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func TestProfileLabels(t *testing.T) {
+	// two registers, with a Step function that is slow enough for the
+	// profiler to sample it often
+	type keyedInput struct {
+		key   int
+		input registerInput
+	}
+	model := Model{
+		Partition: func(history []Operation) [][]Operation {
+			partitions := make([][]Operation, 2)
+			for _, op := range history {
+				key := op.Input.(keyedInput).key
+				partitions[key] = append(partitions[key], op)
+			}
+			return partitions
+		},
+		Init: registerModel.Init,
+		Step: func(state, input, output interface{}) (bool, interface{}) {
+			for start := time.Now(); time.Since(start) < 2*time.Millisecond; {
+			}
+			return registerModel.Step(state, input.(keyedInput).input, output)
+		},
+	}
+	rng := rand.New(rand.NewSource(1))
+	var history []Operation
+	for key, ops := range []int{200, 300} {
+		for _, op := range randomRegisterHistory(rng, 3, ops) {
+			op.Input = keyedInput{key, op.Input.(registerInput)}
+			history = append(history, op)
+		}
+	}
+
+	var profile bytes.Buffer
+	if err := pprof.StartCPUProfile(&profile); err != nil {
+		t.Skip("can't profile the check:", err)
+	}
+	res, info := CheckOperationsWithOptions(model, history, CheckOptions{LabelCallbacks: true})
+	pprof.StopCPUProfile()
+	if res != Ok {
+		t.Fatalf("expected output %v, got output %v", Ok, res)
+	}
+	partitions := info.Partitions()
+	for i, p := range partitions {
+		if p.Duration < time.Duration(p.Steps)*2*time.Millisecond {
+			t.Errorf("partition %d: expected a duration of at least %d steps of 2ms, got %v", i, p.Steps, p.Duration)
+		}
+	}
+
+	// every sample in Step is labeled with its partition
+	steps := make([]int, len(partitions))
+	for _, labels := range readProfileLabels(t, profile.Bytes()) {
+		if labels[CallbackLabel] != "Step" {
+			continue
+		}
+		partition, err := strconv.Atoi(labels[PartitionLabel])
+		if err != nil || partition < 0 || partition >= len(partitions) {
+			t.Fatalf("sample in Step has labels %v, expected a partition", labels)
+		}
+		if ops := strconv.Itoa(partitions[partition].Operations); labels[OperationsLabel] != ops {
+			t.Errorf("sample in Step has labels %v, expected %s operations", labels, ops)
+		}
+		steps[partition]++
+	}
+	for i, n := range steps {
+		if n == 0 {
+			t.Errorf("partition %d: expected samples in Step", i)
+		}
+	}
+}
+
+// readProfileLabels returns the labels of each sample of a profile in the
+// gzipped protobuf format that runtime/pprof writes.
+func readProfileLabels(t *testing.T, profile []byte) []map[string]string {
+	r, err := gzip.NewReader(bytes.NewReader(profile))
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err := io.ReadAll(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var samples [][][2]uint64 // string table indices of keys and values
+	var strs []string
+	readProtoFields(t, data, func(field uint64, value uint64, bytes []byte) {
+		switch field {
+		case 2: // Profile.sample
+			var labels [][2]uint64
+			readProtoFields(t, bytes, func(field uint64, _ uint64, bytes []byte) {
+				if field == 3 { // Sample.label
+					var label [2]uint64
+					readProtoFields(t, bytes, func(field uint64, value uint64, _ []byte) {
+						if field == 1 || field == 2 { // Label.key, Label.str
+							label[field-1] = value
+						}
+					})
+					labels = append(labels, label)
+				}
+			})
+			samples = append(samples, labels)
+		case 6: // Profile.string_table
+			strs = append(strs, string(bytes))
+		}
+	})
+	result := make([]map[string]string, len(samples))
+	for i, labels := range samples {
+		result[i] = make(map[string]string)
+		for _, label := range labels {
+			if label[0] >= uint64(len(strs)) || label[1] >= uint64(len(strs)) {
+				t.Fatalf("label %v is not in the string table", label)
+			}
+			result[i][strs[label[0]]] = strs[label[1]]
+		}
+	}
+	return result
+}
+
+// readProtoFields calls f with each field of a protobuf message, with its
+// value if it's a varint, and its bytes if it's length-delimited.
+func readProtoFields(t *testing.T, data []byte, f func(field uint64, value uint64, bytes []byte)) {
+	for len(data) > 0 {
+		tag, n := binary.Uvarint(data)
+		if n <= 0 {
+			t.Fatal("malformed profile")
+		}
+		data = data[n:]
+		var value uint64
+		var bytes []byte
+		switch tag & 7 {
+		case 0:
+			value, n = binary.Uvarint(data)
+		case 1:
+			n = 8
+		case 2:
+			var length uint64
+			length, n = binary.Uvarint(data)
+			if n > 0 && length <= uint64(len(data)-n) {
+				bytes = data[n : n+int(length)]
+				n += int(length)
+			} else {
+				n = 0
+			}
+		case 5:
+			n = 4
+		default:
+			n = 0
+		}
+		if n <= 0 || n > len(data) {
+			t.Fatal("malformed profile")
+		}
+		data = data[n:]
+		f(tag>>3, value, bytes)
+	}
+}
@@ -0,0 +1,164 @@
+package porcupine
+
+import "sync"
+
+// A Recorder records a history of operations as they are executed by
+// concurrent clients. It is safe for concurrent use by multiple goroutines.
+//
+// Timestamps are read from a [Clock] and recorded as nanoseconds since the
+// recorder was created, so they are not affected by changes to the system
+// clock.
+//
+// Operations that were started with Begin but never ended with End, such as
+// operations that timed out, are pending: their outcome is unknown, and they
+// may or may not have taken effect. The histories returned by Operations and
+// Events include pending operations with a nil output and a return time
+// after every other operation, which means they may take effect at any point
+// after they were called. Models used to check such histories must accept a
+// nil output as any outcome. [Recorder.Recorded] tells pending operations
+// apart from ones that ended with a nil output.
+type Recorder struct {
+	clock *Clock
+	mu    sync.Mutex
+	ops   []recordedOperation
+}
+
+type recordedOperation struct {
+	op       Operation
+	ended    bool
+	metadata interface{}
+}
+
+// A RecordedOperation is an operation recorded by a [Recorder], along with
+// whether it's pending, and the metadata attached to it with
+// [OpHandle.SetMetadata].
+type RecordedOperation struct {
+	Operation
+	Pending  bool
+	Metadata interface{}
+}
+
+// An OpHandle refers to an operation that was started with
+// [Recorder.Begin].
+type OpHandle struct {
+	recorder *Recorder
+	index    int
+}
+
+// NewRecorder returns a recorder with an empty history.
+func NewRecorder() *Recorder {
+	return &Recorder{clock: NewClock()}
+}
+
+// Clock returns the clock that the recorder reads timestamps from, such as
+// to convert the timestamps of the recorded history back to wall clock times
+// with [Clock.Time].
+func (r *Recorder) Clock() *Clock {
+	return r.clock
+}
+
+func (r *Recorder) now() int64 {
+	return r.clock.Now()
+}
+
+// Begin records the invocation of an operation by a client. It should be
+// called right before the operation is executed.
+func (r *Recorder) Begin(clientId int, input interface{}) OpHandle {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.ops = append(r.ops, recordedOperation{op: Operation{
+		ClientId: clientId,
+		Input:    input,
+		Call:     r.now(),
+	}})
+	return OpHandle{recorder: r, index: len(r.ops) - 1}
+}
+
+// End records the response of an operation. It should be called right after
+// the operation returns. End panics if it is called more than once for the
+// same operation.
+func (h OpHandle) End(output interface{}) {
+	r := h.recorder
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	rec := &r.ops[h.index]
+	if rec.ended {
+		panic("porcupine: End called more than once for the same operation")
+	}
+	rec.ended = true
+	rec.op.Output = output
+	rec.op.Return = r.now()
+}
+
+// SetMetadata attaches metadata to the operation, such as the id of a request
+// or the server that handled it, replacing any that was attached before. It
+// can be called before or after End, such as when the operation begins or
+// when its response arrives. The checker doesn't use metadata; it's returned
+// by [Recorder.Recorded].
+func (h OpHandle) SetMetadata(metadata interface{}) {
+	r := h.recorder
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.ops[h.index].metadata = metadata
+}
+
+// Pending returns the number of operations that have been started but not
+// ended.
+func (r *Recorder) Pending() int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	pending := 0
+	for _, rec := range r.ops {
+		if !rec.ended {
+			pending++
+		}
+	}
+	return pending
+}
+
+// Operations returns the recorded history, in the order in which operations
+// were started. Pending operations are included as described in the
+// [Recorder] documentation.
+//
+// Operations can be called at any time, but the history is only complete
+// once all clients have stopped.
+func (r *Recorder) Operations() []Operation {
+	recorded := r.Recorded()
+	ops := make([]Operation, len(recorded))
+	for i, rec := range recorded {
+		ops[i] = rec.Operation
+	}
+	return ops
+}
+
+// Recorded returns the recorded history like Operations, with each
+// operation marked as pending or not, and the metadata attached to it.
+func (r *Recorder) Recorded() []RecordedOperation {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	var last int64
+	for _, rec := range r.ops {
+		if rec.op.Call > last {
+			last = rec.op.Call
+		}
+		if rec.ended && rec.op.Return > last {
+			last = rec.op.Return
+		}
+	}
+	ops := make([]RecordedOperation, len(r.ops))
+	for i, rec := range r.ops {
+		ops[i] = RecordedOperation{Operation: rec.op, Pending: !rec.ended, Metadata: rec.metadata}
+		if !rec.ended {
+			ops[i].Output = nil
+			ops[i].Return = last + 1
+		}
+	}
+	return ops
+}
+
+// Events returns the recorded history as a list of events, ordered by time,
+// as converted by [OperationsToEvents]. Pending operations are included as
+// described in the [Recorder] documentation.
+func (r *Recorder) Events() []Event {
+	return OperationsToEvents(r.Operations())
+}
@@ -0,0 +1,140 @@
+package porcupine
+
+import (
+	"sync"
+	"testing"
+)
+
+// pendingRegisterModel is like registerModel, but it accepts a nil output
+// from a pending read as any value.
+var pendingRegisterModel = Model{
+	Init: registerModel.Init,
+	Step: func(state, input, output interface{}) (bool, interface{}) {
+		if output == nil {
+			if input.(registerInput).op == false {
+				return true, input.(registerInput).value
+			}
+			return true, state
+		}
+		return registerModel.Step(state, input, output)
+	},
+}
+
+func TestRecorder(t *testing.T) {
+	r := NewRecorder()
+	var mu sync.Mutex
+	value := 0
+	var wg sync.WaitGroup
+	for client := 0; client < 8; client++ {
+		wg.Add(1)
+		go func(client int) {
+			defer wg.Done()
+			for i := 0; i < 20; i++ {
+				if i%2 == 0 {
+					h := r.Begin(client, registerInput{false, client*100 + i})
+					mu.Lock()
+					value = client*100 + i
+					mu.Unlock()
+					h.End(0)
+				} else {
+					h := r.Begin(client, registerInput{true, 0})
+					mu.Lock()
+					v := value
+					mu.Unlock()
+					h.End(v)
+				}
+			}
+		}(client)
+	}
+	wg.Wait()
+
+	ops := r.Operations()
+	if len(ops) != 160 || r.Pending() != 0 {
+		t.Fatalf("expected 160 complete operations, got %d (%d pending)", len(ops), r.Pending())
+	}
+	for _, op := range ops {
+		if op.Call > op.Return {
+			t.Fatalf("expected call before return, got %+v", op)
+		}
+	}
+	if !CheckOperations(registerModel, ops) {
+		t.Fatal("expected recorded operations to be linearizable")
+	}
+	events := r.Events()
+	if len(events) != 320 {
+		t.Fatalf("expected 320 events, got %d", len(events))
+	}
+	if !CheckEvents(registerModel, events) {
+		t.Fatal("expected recorded events to be linearizable")
+	}
+}
+
+func TestRecorderPending(t *testing.T) {
+	r := NewRecorder()
+	put := r.Begin(0, registerInput{false, 100})
+	r.Begin(1, registerInput{false, 200}) // never ends
+	put.End(0)
+	get := r.Begin(0, registerInput{true, 0})
+	get.End(200)
+
+	if r.Pending() != 1 {
+		t.Fatalf("expected 1 pending operation, got %d", r.Pending())
+	}
+	ops := r.Operations()
+	pending := ops[1]
+	if pending.Output != nil || pending.Return <= ops[2].Return {
+		t.Fatalf("expected pending operation to return after every other operation, got %+v", pending)
+	}
+	// the pending put may have taken effect before the get
+	if !CheckOperations(pendingRegisterModel, ops) {
+		t.Fatal("expected operations with a pending put to be linearizable")
+	}
+	events := r.Events()
+	last := events[len(events)-1]
+	if last.Kind != ReturnEvent || last.Id != 1 || last.Value != nil {
+		t.Fatalf("expected the pending operation to return last, got %+v", last)
+	}
+	if !CheckEvents(pendingRegisterModel, events) {
+		t.Fatal("expected events with a pending put to be linearizable")
+	}
+}
+
+func TestRecorderRecorded(t *testing.T) {
+	r := NewRecorder()
+	pending := r.Begin(0, registerInput{false, 100})
+	pending.SetMetadata("request 1")
+	get := r.Begin(1, registerInput{true, 0})
+	get.End(nil)
+	get.SetMetadata("request 2")
+
+	// the pending operation and the one that ended with a nil output have
+	// the same output, but only one of them is pending
+	recorded := r.Recorded()
+	if len(recorded) != 2 {
+		t.Fatalf("expected 2 operations, got %d", len(recorded))
+	}
+	if !recorded[0].Pending || recorded[0].Output != nil || recorded[0].Metadata != "request 1" {
+		t.Fatalf("expected a pending operation with metadata, got %+v", recorded[0])
+	}
+	if recorded[1].Pending || recorded[1].Output != nil || recorded[1].Metadata != "request 2" {
+		t.Fatalf("expected an operation that ended, with metadata, got %+v", recorded[1])
+	}
+	ops := r.Operations()
+	for i := range ops {
+		if ops[i] != recorded[i].Operation {
+			t.Fatalf("expected operation %d to be %+v, got %+v", i, recorded[i].Operation, ops[i])
+		}
+	}
+}
+
+func TestRecorderEndTwice(t *testing.T) {
+	r := NewRecorder()
+	h := r.Begin(0, registerInput{true, 0})
+	h.End(0)
+	defer func() {
+		if recover() == nil {
+			t.Fatal("expected End to panic when called twice")
+		}
+	}()
+	h.End(0)
+}
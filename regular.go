@@ -0,0 +1,206 @@
+package porcupine
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+)
+
+// A RegisterSemantics is one of Lamport's consistency levels for registers,
+// for [CheckRegisterSemantics]. Each is weaker than the one before it.
+type RegisterSemantics int
+
+const (
+	// AtomicRegister is linearizability.
+	AtomicRegister RegisterSemantics = iota
+	// RegularRegister: a read returns the value of one of the latest
+	// writes that completed before its call, or of a write that is
+	// concurrent with it.
+	RegularRegister
+	// SafeRegister: a read that isn't concurrent with any write returns
+	// the value of one of the latest writes that completed before its
+	// call; a read that is may return anything.
+	SafeRegister
+)
+
+func (s RegisterSemantics) String() string {
+	switch s {
+	case AtomicRegister:
+		return "atomic"
+	case RegularRegister:
+		return "regular"
+	case SafeRegister:
+		return "safe"
+	default:
+		return fmt.Sprintf("RegisterSemantics(%d)", int(s))
+	}
+}
+
+// CheckRegisterSemantics checks a history of registers against a consistency
+// level. With AtomicRegister, it checks linearizability, like
+// [CheckOperationsVerbose] without a timeout. RegularRegister and
+// SafeRegister are weaker, and don't need a search: each read is checked
+// against the writes to its register that completed before it and that are
+// concurrent with it, so the check takes time linear in the number of reads
+// times the number of writes. Checking a history at each level localizes a
+// bug: a history that is regular but not atomic has a read that returned an
+// older value than a read before it, for example.
+//
+// The model's Accesses function says which registers an operation reads or
+// writes, as a Key, and whether it writes them; an operation that writes a
+// register is checked as a write only. The latest writes that completed
+// before a read are the ones that no other such write followed; there's one
+// with a single writer. A read may return the value of a write if the
+// model's Step function accepts the write and then the read, from the
+// initial state, and may return the initial value if no write completed
+// before it. The model's partition functions are used, if it has them, and
+// the Step function must accept a write in any state. If the model has no
+// Accesses function, the result is Unknown, and the returned information's
+// Err says why.
+//
+// For visualization, the returned information holds a partial linearization
+// of all the writes of each partition, in the order of their calls, and one
+// of each read that's allowed, after the write it read from. A read of a safe
+// register that is concurrent with a write isn't in any, unless it read the
+// value of one of those writes, since it may return anything.
+func CheckRegisterSemantics(model Model, history []Operation, semantics RegisterSemantics) (CheckResult, LinearizationInfo) {
+	if semantics == AtomicRegister {
+		return CheckOperationsVerbose(model, history, 0)
+	}
+	if semantics != RegularRegister && semantics != SafeRegister {
+		panic(fmt.Sprintf("porcupine: unknown register semantics %v", semantics))
+	}
+	if model.Accesses == nil {
+		return Unknown, LinearizationInfo{err: errors.New("porcupine: CheckRegisterSemantics needs a model with an Accesses function")}
+	}
+	model = fillDefault(model)
+	partitions := model.Partition(history)
+	info := LinearizationInfo{
+		history:               make([][]entry, len(partitions)),
+		partialLinearizations: make([][][]int, len(partitions)),
+		results:               make([]CheckResult, len(partitions)),
+	}
+	result := Ok
+	for i, ops := range partitions {
+		info.history[i] = makeEntries(ops)
+		ok, partials := checkRegisters(model, ops, semantics)
+		info.partialLinearizations[i] = partials
+		info.results[i] = Ok
+		if !ok {
+			info.results[i] = Illegal
+			result = Illegal
+		}
+	}
+	return result, info
+}
+
+// checkRegisters checks the reads of the registers in one partition, and
+// returns whether they're all allowed, and partial linearizations for
+// visualization.
+func checkRegisters(model Model, ops []Operation, semantics RegisterSemantics) (bool, [][]int) {
+	writes := make(map[interface{}][]int)
+	reads := make(map[interface{}][]int)
+	var keys []interface{} // that are read, in the order of their first read
+	for i, op := range ops {
+		written := make(map[interface{}]bool)
+		accesses := model.Accesses(op.Input, op.Output)
+		for _, a := range accesses {
+			if a.Write && !written[a.Key] {
+				written[a.Key] = true
+				writes[a.Key] = append(writes[a.Key], i)
+			}
+		}
+		for _, a := range accesses {
+			if a.Write || written[a.Key] {
+				continue
+			}
+			if _, ok := reads[a.Key]; !ok {
+				keys = append(keys, a.Key)
+			}
+			reads[a.Key] = append(reads[a.Key], i)
+		}
+	}
+	// every write, in the order of their calls, as long as Step accepts
+	// them
+	var all []int
+	for _, w := range writes {
+		all = append(all, w...)
+	}
+	sort.Slice(all, func(a, b int) bool {
+		if ops[all[a]].Call != ops[all[b]].Call {
+			return ops[all[a]].Call < ops[all[b]].Call
+		}
+		return all[a] < all[b]
+	})
+	state := model.Init()
+	for n, w := range all {
+		ok, next := model.Step(state, ops[w].Input, ops[w].Output)
+		if !ok {
+			all = all[:n]
+			break
+		}
+		state = next
+	}
+	var partials [][]int
+	if len(all) > 0 {
+		partials = append(partials, all)
+	}
+	ok := true
+	for _, key := range keys {
+		for _, r := range reads[key] {
+			partial, allowed := checkRead(model, ops, writes[key], r, semantics)
+			if partial != nil {
+				partials = append(partials, partial)
+			}
+			ok = ok && allowed
+		}
+	}
+	return ok, partials
+}
+
+// checkRead returns a partial linearization of a read after the write it read
+// from, if it's allowed to read from one, and whether the read is allowed.
+func checkRead(model Model, ops []Operation, writes []int, r int, semantics RegisterSemantics) ([]int, bool) {
+	read := ops[r]
+	var before, concurrent []int
+	for _, w := range writes {
+		if ops[w].Return < read.Call {
+			before = append(before, w)
+		} else if ops[w].Call <= read.Return {
+			concurrent = append(concurrent, w)
+		}
+	}
+	// the latest writes that completed before the read
+	var latest []int
+	for _, w := range before {
+		followed := false
+		for _, other := range before {
+			if ops[w].Return < ops[other].Call {
+				followed = true
+				break
+			}
+		}
+		if !followed {
+			latest = append(latest, w)
+		}
+	}
+	// a read of a safe register that is concurrent with a write may
+	// return anything, but it's in a partial linearization if it read
+	// one of the writes
+	candidates := append(latest, concurrent...)
+	if len(before) == 0 {
+		if ok, _ := model.Step(model.Init(), read.Input, read.Output); ok {
+			return []int{r}, true
+		}
+	}
+	for _, w := range candidates {
+		ok, state := model.Step(model.Init(), ops[w].Input, ops[w].Output)
+		if !ok {
+			continue
+		}
+		if ok, _ := model.Step(state, read.Input, read.Output); ok {
+			return []int{w, r}, true
+		}
+	}
+	return nil, semantics == SafeRegister && len(concurrent) > 0
+}
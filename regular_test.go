@@ -0,0 +1,117 @@
+package porcupine
+
+import (
+	"bytes"
+	"testing"
+)
+
+func checkRegisterLevels(t *testing.T, model Model, ops []Operation, atomic, regular, safe CheckResult) {
+	t.Helper()
+	for _, c := range []struct {
+		semantics RegisterSemantics
+		expected  CheckResult
+	}{{AtomicRegister, atomic}, {RegularRegister, regular}, {SafeRegister, safe}} {
+		res, info := CheckRegisterSemantics(model, ops, c.semantics)
+		if res != c.expected {
+			t.Fatalf("%s: expected output %v, got output %v", c.semantics, c.expected, res)
+		}
+		var buf bytes.Buffer
+		if err := Visualize(model, info, &buf); err != nil {
+			t.Fatalf("%s: visualization failed: %v", c.semantics, err)
+		}
+	}
+}
+
+func TestRegularNotAtomic(t *testing.T) {
+	// the second read returns the old value after the first one returned
+	// the new value, while the write is still going
+	ops := []Operation{
+		sessionPut(0, 1, 0, 100),
+		sessionGet(1, 1, 10, 20),
+		sessionGet(2, 0, 30, 40),
+	}
+	checkRegisterLevels(t, sessionRegisterModel(), ops, Illegal, Ok, Ok)
+}
+
+func TestSafeNotRegular(t *testing.T) {
+	// a read concurrent with a write returns a value that was never written
+	ops := []Operation{
+		sessionPut(0, 1, 0, 100),
+		sessionGet(1, 5, 10, 20),
+		sessionGet(2, 1, 110, 120),
+	}
+	checkRegisterLevels(t, sessionRegisterModel(), ops, Illegal, Illegal, Ok)
+	_, info := CheckRegisterSemantics(sessionRegisterModel(), ops, SafeRegister)
+	// the read of a value that was never written isn't linearized
+	if p := info.Partitions(); len(p) != 1 || p[0].Result != Ok || p[0].Linearized != 2 {
+		t.Fatalf("unexpected partitions %+v", p)
+	}
+}
+
+func TestNotSafe(t *testing.T) {
+	// a read returns an overwritten value, with no write going on
+	ops := []Operation{
+		sessionPut(0, 1, 0, 10),
+		sessionPut(0, 2, 20, 30),
+		sessionGet(1, 1, 40, 50),
+	}
+	checkRegisterLevels(t, sessionRegisterModel(), ops, Illegal, Illegal, Illegal)
+	// or the initial value after a write
+	ops = []Operation{
+		sessionPut(0, 1, 0, 10),
+		sessionGet(1, 0, 20, 30),
+	}
+	checkRegisterLevels(t, sessionRegisterModel(), ops, Illegal, Illegal, Illegal)
+}
+
+func TestRegisterSemanticsConcurrentWriters(t *testing.T) {
+	// either of two concurrent writes is one of the latest
+	for _, value := range []int{1, 2} {
+		ops := []Operation{
+			sessionPut(0, 1, 0, 10),
+			sessionPut(1, 2, 5, 15),
+			sessionGet(2, value, 20, 30),
+		}
+		checkRegisterLevels(t, sessionRegisterModel(), ops, Ok, Ok, Ok)
+	}
+	ops := []Operation{
+		sessionPut(0, 1, 0, 10),
+		sessionPut(1, 2, 5, 15),
+		sessionGet(2, 0, 20, 30),
+	}
+	checkRegisterLevels(t, sessionRegisterModel(), ops, Illegal, Illegal, Illegal)
+}
+
+func TestRegisterSemanticsPartitioned(t *testing.T) {
+	model := kvModel
+	model.Accesses = kvAccesses
+	ops := []Operation{
+		{0, kvInput{op: 1, key: "x", value: "a"}, 0, kvOutput{}, 100},
+		{1, kvInput{op: 0, key: "x"}, 10, kvOutput{"a"}, 20},
+		{2, kvInput{op: 0, key: "x"}, 30, kvOutput{""}, 40},
+		{0, kvInput{op: 1, key: "y", value: "b"}, 0, kvOutput{}, 10},
+		{1, kvInput{op: 0, key: "y"}, 30, kvOutput{"b"}, 40},
+	}
+	checkRegisterLevels(t, model, ops, Illegal, Ok, Ok)
+	// a stale read of y breaks all of them
+	ops = append(ops, Operation{2, kvInput{op: 0, key: "y"}, 50, kvOutput{""}, 60})
+	checkRegisterLevels(t, model, ops, Illegal, Illegal, Illegal)
+	_, info := CheckRegisterSemantics(model, ops, RegularRegister)
+	partitions := info.Partitions()
+	if len(partitions) != 2 || partitions[0].Result != Ok || partitions[1].Result != Illegal {
+		t.Fatalf("expected only the partition of y to be illegal, got %+v", partitions)
+	}
+}
+
+func TestRegisterSemanticsNoAccesses(t *testing.T) {
+	ops := []Operation{
+		{0, kvInput{op: 1, key: "x", value: "a"}, 0, kvOutput{}, 10},
+		{1, kvInput{op: 0, key: "x"}, 20, kvOutput{"a"}, 30},
+	}
+	for _, semantics := range []RegisterSemantics{RegularRegister, SafeRegister} {
+		res, info := CheckRegisterSemantics(kvModel, ops, semantics)
+		if res != Unknown || info.Err() == nil {
+			t.Fatalf("%s: expected output %v with an error, got output %v (%v)", semantics, Unknown, res, info.Err())
+		}
+	}
+}
@@ -0,0 +1,165 @@
+package porcupine
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"time"
+)
+
+// A Driver executes operations against a live system, for a [Replayer].
+type Driver interface {
+	// Execute executes an operation with the given input, and returns its
+	// output. It returns an error if the outcome of the operation is
+	// unknown, such as after a timeout; operations that fail with a known
+	// outcome should return an output that the model understands instead.
+	// Execute is called concurrently by the goroutines of different
+	// clients.
+	Execute(ctx context.Context, input interface{}) (interface{}, error)
+}
+
+// A Replayer executes the operations of a recorded history again, against a
+// fresh instance of a system, to find out whether a problem found in the
+// history is reproducible.
+type Replayer struct {
+	Driver Driver
+	// Speed scales the timing of the history: 2 replays it twice as fast
+	// as it was recorded. If it is 0, the history is replayed at its
+	// original speed.
+	Speed float64
+	// Unit is the duration of one unit of the history's timestamps. If it
+	// is 0, timestamps are in nanoseconds.
+	Unit time.Duration
+	// StructureOnly ignores the timing of the history: each client executes
+	// its operations one after another, as fast as possible, and only the
+	// order of each client's operations is preserved.
+	StructureOnly bool
+	// Grace limits how long an operation can run past its original
+	// duration, scaled by Speed. If it is positive, an operation that
+	// doesn't finish in time has its context canceled and is abandoned, and
+	// its outcome is unknown. If it is 0, operations can run for as long as
+	// they need, delaying the client's following operations.
+	Grace time.Duration
+}
+
+// Replay executes the operations of a history with r.Driver, on a goroutine
+// per client, and returns the new history, recorded with a [Recorder], to be
+// checked again.
+//
+// Each client executes its operations in the order of their call times, and,
+// unless r.StructureOnly is set, calls each one at its original call time
+// relative to the start of the history, scaled by r.Speed, or as soon as the
+// client's previous operation finishes if it is late.
+//
+// Operations whose outcome is unknown, because Execute returned an error or
+// because they were abandoned, are pending in the new history, and the
+// client executes its following operations with a new client id, like Jepsen
+// does for crashed processes, so that each client's operations stay
+// sequential. New client ids are allocated after the largest client id in
+// the history.
+//
+// If ctx is canceled, Replay stops calling operations, and returns the
+// history so far, with operations in progress pending, along with the
+// context's error.
+func (r Replayer) Replay(ctx context.Context, ops []Operation) ([]Operation, error) {
+	speed := r.Speed
+	if speed == 0 {
+		speed = 1
+	}
+	unit := r.Unit
+	if unit == 0 {
+		unit = time.Nanosecond
+	}
+	scale := func(d int64) time.Duration {
+		return time.Duration(float64(d) * float64(unit) / speed)
+	}
+
+	byClient := make(map[int][]Operation)
+	var clients []int
+	var start int64
+	maxClient := 0
+	for i, op := range ops {
+		if _, ok := byClient[op.ClientId]; !ok {
+			clients = append(clients, op.ClientId)
+		}
+		byClient[op.ClientId] = append(byClient[op.ClientId], op)
+		if i == 0 || op.Call < start {
+			start = op.Call
+		}
+		if op.ClientId > maxClient {
+			maxClient = op.ClientId
+		}
+	}
+	var mu sync.Mutex
+	nextClient := maxClient + 1
+	newClient := func() int {
+		mu.Lock()
+		defer mu.Unlock()
+		nextClient++
+		return nextClient - 1
+	}
+
+	recorder := NewRecorder()
+	begin := time.Now()
+	var wg sync.WaitGroup
+	for _, client := range clients {
+		clientOps := byClient[client]
+		sort.SliceStable(clientOps, func(i, j int) bool {
+			return clientOps[i].Call < clientOps[j].Call
+		})
+		wg.Add(1)
+		go func(clientId int, clientOps []Operation) {
+			defer wg.Done()
+			for _, op := range clientOps {
+				if !r.StructureOnly {
+					timer := time.NewTimer(time.Until(begin.Add(scale(op.Call - start))))
+					select {
+					case <-timer.C:
+					case <-ctx.Done():
+						timer.Stop()
+					}
+				}
+				if ctx.Err() != nil {
+					return
+				}
+				if !r.replayOperation(ctx, recorder, clientId, op, scale(op.Return-op.Call)) {
+					clientId = newClient()
+				}
+			}
+		}(client, clientOps)
+	}
+	wg.Wait()
+	return recorder.Operations(), ctx.Err()
+}
+
+// replayOperation executes an operation, and records it as an operation of
+// the given client. It returns false if the outcome of the operation is
+// unknown.
+func (r Replayer) replayOperation(ctx context.Context, recorder *Recorder, clientId int, op Operation, duration time.Duration) bool {
+	if r.Grace > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, duration+r.Grace)
+		defer cancel()
+	}
+	type result struct {
+		output interface{}
+		err    error
+	}
+	done := make(chan result, 1)
+	h := recorder.Begin(clientId, op.Input)
+	go func() {
+		output, err := r.Driver.Execute(ctx, op.Input)
+		done <- result{output, err}
+	}()
+	select {
+	case res := <-done:
+		if res.err != nil {
+			return false
+		}
+		h.End(res.output)
+		return true
+	case <-ctx.Done():
+		// the driver may not return, so abandon the operation
+		return false
+	}
+}
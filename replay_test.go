@@ -0,0 +1,141 @@
+package porcupine
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+)
+
+// registerDriver executes register operations on an in-memory register. A
+// write of -1 fails with an unknown outcome, and a write of -2 blocks until
+// unblock is closed, ignoring its context.
+type registerDriver struct {
+	mu      sync.Mutex
+	value   int
+	unblock chan struct{}
+}
+
+func (d *registerDriver) Execute(ctx context.Context, input interface{}) (interface{}, error) {
+	inp := input.(registerInput)
+	switch {
+	case !inp.op && inp.value == -1:
+		return nil, errors.New("timeout")
+	case !inp.op && inp.value == -2:
+		<-d.unblock
+	}
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if inp.op {
+		return d.value, nil
+	}
+	d.value = inp.value
+	return 0, nil
+}
+
+func TestReplay(t *testing.T) {
+	// timestamps in milliseconds
+	ops := []Operation{
+		{0, registerInput{false, 100}, 0, 0, 10},
+		{1, registerInput{true, 0}, 20, 100, 30},
+		{0, registerInput{false, 200}, 40, 0, 50},
+		{2, registerInput{true, 0}, 60, 200, 70},
+	}
+	replayer := Replayer{Driver: &registerDriver{}, Unit: time.Millisecond, Speed: 2}
+	start := time.Now()
+	replayed, err := replayer.Replay(context.Background(), ops)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if elapsed := time.Since(start); elapsed < 30*time.Millisecond {
+		t.Fatalf("expected replay to take at least 30ms, took %v", elapsed)
+	}
+	if len(replayed) != len(ops) {
+		t.Fatalf("expected %d operations, got %d", len(ops), len(replayed))
+	}
+	// the operations don't overlap, so the replay has the same order and
+	// outputs, with the calls spaced like the original ones
+	for i, op := range replayed {
+		if op.ClientId != ops[i].ClientId || op.Input != ops[i].Input || op.Output != ops[i].Output {
+			t.Fatalf("expected operation %d to be %v, got %v", i, ops[i], op)
+		}
+		if i > 0 && op.Call-replayed[i-1].Call < int64(9*time.Millisecond) {
+			t.Fatalf("expected calls to be at least 9ms apart, got %v", replayed)
+		}
+	}
+	if !CheckOperations(registerModel, replayed) {
+		t.Fatal("expected replayed history to be linearizable")
+	}
+}
+
+func TestReplayStructureOnly(t *testing.T) {
+	ops := []Operation{
+		{0, registerInput{false, 100}, 0, 0, 10},
+		{0, registerInput{true, 0}, 1000, 100, 1010},
+		{0, registerInput{false, 200}, 2000, 0, 2010},
+		{0, registerInput{true, 0}, 3000, 200, 3010},
+	}
+	replayer := Replayer{Driver: &registerDriver{}, Unit: time.Hour, StructureOnly: true}
+	replayed, err := replayer.Replay(context.Background(), ops)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i, op := range replayed {
+		if op.Input != ops[i].Input || op.Output != ops[i].Output {
+			t.Fatalf("expected operation %d to be %v, got %v", i, ops[i], op)
+		}
+	}
+}
+
+func TestReplayUnknownOutcomes(t *testing.T) {
+	driver := &registerDriver{unblock: make(chan struct{})}
+	defer close(driver.unblock)
+	ops := []Operation{
+		{0, registerInput{false, -1}, 0, 0, 10},
+		{0, registerInput{true, 0}, 20, 0, 30},
+		{1, registerInput{false, -2}, 0, 0, 10},
+		{1, registerInput{false, 5}, 20, 0, 30},
+		{1, registerInput{true, 0}, 40, 5, 50},
+	}
+	replayer := Replayer{Driver: driver, Unit: time.Millisecond, Grace: 20 * time.Millisecond}
+	replayed, err := replayer.Replay(context.Background(), ops)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pending := make(map[int]bool)
+	clients := make(map[registerInput]int)
+	for _, op := range replayed {
+		clients[op.Input.(registerInput)] = op.ClientId
+		if op.Output == nil {
+			pending[op.Input.(registerInput).value] = true
+		}
+	}
+	if len(replayed) != len(ops) || !pending[-1] || !pending[-2] || len(pending) != 2 {
+		t.Fatalf("expected the failed and the blocked writes to be pending, got %v", replayed)
+	}
+	// clients continue with new ids after an unknown outcome
+	if clients[registerInput{false, -1}] != 0 || clients[registerInput{true, 0}] < 2 ||
+		clients[registerInput{false, -2}] != 1 || clients[registerInput{false, 5}] < 2 {
+		t.Fatalf("unexpected client ids %v", replayed)
+	}
+	for _, issue := range ValidateHistory(replayed) {
+		if issue.Severity != SeverityInfo {
+			t.Fatalf("expected clients to be sequential, got %v", issue)
+		}
+	}
+}
+
+func TestReplayCanceled(t *testing.T) {
+	ops := []Operation{
+		{0, registerInput{false, 1}, 0, 0, 10},
+		{0, registerInput{false, 2}, 1000, 0, 1010},
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	replayer := Replayer{Driver: &registerDriver{}, Unit: time.Second}
+	replayed, err := replayer.Replay(ctx, ops)
+	if !errors.Is(err, context.DeadlineExceeded) || len(replayed) != 1 {
+		t.Fatalf("expected replay to stop after the first operation, got %v, %v", replayed, err)
+	}
+}
@@ -0,0 +1,235 @@
+package porcupine
+
+import (
+	"bytes"
+	"fmt"
+	"go/ast"
+	"go/format"
+	"hash/fnv"
+	"io"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// WriteReproducer writes a self-contained Go test file, in package pkg, with
+// a test that asserts that a history is not linearizable according to the
+// model named modelVar, such as "kvModel" or "models.KV". This preserves a
+// failure found in a history after the files it was recorded in are gone.
+//
+// valuePrinter renders the inputs and outputs of operations as Go
+// expressions, which may refer to identifiers of pkg and to the porcupine
+// package as "porcupine". If it is nil, a default printer is used, which
+// handles nil, booleans, numbers, strings, and slices, arrays, maps, structs,
+// and pointers to structs made of them, naming types by their package name,
+// unless they are in pkg, and importing their packages. Unexported types and
+// fields of other packages can't be rendered, and result in an error.
+//
+// The output is gofmt-clean and deterministic, and the test's name is derived
+// from the history, so that multiple reproducers can be in the same package.
+func WriteReproducer(w io.Writer, pkg string, modelVar string, ops []Operation, valuePrinter func(interface{}) string) error {
+	imports := map[string]bool{"testing": true}
+	qualifier := "porcupine."
+	if pkg == "porcupine" {
+		qualifier = ""
+	} else {
+		imports["github.com/anishathalye/porcupine"] = true
+	}
+	printer := reproducerPrinter{pkg: pkg, imports: imports}
+	render := func(v interface{}) (string, error) {
+		if valuePrinter != nil {
+			return valuePrinter(v), nil
+		}
+		return printer.print(reflect.ValueOf(v))
+	}
+
+	var body bytes.Buffer
+	for i, op := range ops {
+		input, err := render(op.Input)
+		if err != nil {
+			return fmt.Errorf("porcupine: %w (input of operation %d)", err, i)
+		}
+		output, err := render(op.Output)
+		if err != nil {
+			return fmt.Errorf("porcupine: %w (output of operation %d)", err, i)
+		}
+		fmt.Fprintf(&body, "\t\t{ClientId: %d, Input: %s, Call: %d, Output: %s, Return: %d},\n", op.ClientId, input, op.Call, output, op.Return)
+	}
+	h := fnv.New32a()
+	h.Write([]byte(modelVar))
+	h.Write(body.Bytes())
+
+	var paths []string
+	for path := range imports {
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+	var src bytes.Buffer
+	fmt.Fprintf(&src, "// Code generated by porcupine.WriteReproducer. DO NOT EDIT.\n\npackage %s\n\nimport (\n", pkg)
+	for _, path := range paths {
+		fmt.Fprintf(&src, "\t%q\n", path)
+	}
+	fmt.Fprintf(&src, ")\n\n")
+	fmt.Fprintf(&src, "// TestReproducer%08x checks a history of %d operations that is not linearizable.\n", h.Sum32(), len(ops))
+	fmt.Fprintf(&src, "func TestReproducer%08x(t *testing.T) {\n", h.Sum32())
+	fmt.Fprintf(&src, "\tops := []%sOperation{\n%s\t}\n", qualifier, body.Bytes())
+	fmt.Fprintf(&src, "\tif %sCheckOperations(%s, ops) {\n", qualifier, modelVar)
+	fmt.Fprintf(&src, "\t\tt.Fatal(\"expected history to not be linearizable\")\n\t}\n}\n")
+
+	formatted, err := format.Source(src.Bytes())
+	if err != nil {
+		return fmt.Errorf("porcupine: generated invalid Go code: %w", err)
+	}
+	_, err = w.Write(formatted)
+	return err
+}
+
+// reproducerPrinter renders values as Go expressions in package pkg, and
+// collects the import paths of the types it names.
+type reproducerPrinter struct {
+	pkg     string
+	imports map[string]bool
+}
+
+func (p reproducerPrinter) print(v reflect.Value) (string, error) {
+	if !v.IsValid() {
+		return "nil", nil
+	}
+	t := v.Type()
+	name, err := p.typeName(t)
+	if err != nil {
+		return "", err
+	}
+	// convert wraps a literal of a basic kind in a conversion, unless the
+	// literal's default type is already t
+	convert := func(literal string, defaultType reflect.Type) string {
+		if t == defaultType {
+			return literal
+		}
+		return fmt.Sprintf("%s(%s)", name, literal)
+	}
+	switch t.Kind() {
+	case reflect.Bool:
+		return convert(strconv.FormatBool(v.Bool()), reflect.TypeOf(false)), nil
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return convert(strconv.FormatInt(v.Int(), 10), reflect.TypeOf(0)), nil
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return convert(strconv.FormatUint(v.Uint(), 10), nil), nil
+	case reflect.Float32, reflect.Float64:
+		return convert(strconv.FormatFloat(v.Float(), 'g', -1, t.Bits()), nil), nil
+	case reflect.String:
+		return convert(strconv.Quote(v.String()), reflect.TypeOf("")), nil
+	case reflect.Slice, reflect.Array, reflect.Map:
+		if (t.Kind() == reflect.Slice || t.Kind() == reflect.Map) && v.IsNil() {
+			return fmt.Sprintf("%s(nil)", name), nil
+		}
+		var elems []string
+		if t.Kind() == reflect.Map {
+			iter := v.MapRange()
+			for iter.Next() {
+				key, err := p.print(iter.Key())
+				if err != nil {
+					return "", err
+				}
+				value, err := p.print(iter.Value())
+				if err != nil {
+					return "", err
+				}
+				elems = append(elems, key+": "+value)
+			}
+			// map iteration order is random
+			sort.Strings(elems)
+		} else {
+			for i := 0; i < v.Len(); i++ {
+				elem, err := p.print(v.Index(i))
+				if err != nil {
+					return "", err
+				}
+				elems = append(elems, elem)
+			}
+		}
+		return fmt.Sprintf("%s{%s}", name, strings.Join(elems, ", ")), nil
+	case reflect.Struct:
+		var fields []string
+		for i := 0; i < t.NumField(); i++ {
+			field := t.Field(i)
+			if field.PkgPath != "" && !p.local(t) {
+				return "", fmt.Errorf("can't render unexported field %s of %s", field.Name, t)
+			}
+			value, err := p.print(v.Field(i))
+			if err != nil {
+				return "", err
+			}
+			fields = append(fields, field.Name+": "+value)
+		}
+		return fmt.Sprintf("%s{%s}", name, strings.Join(fields, ", ")), nil
+	case reflect.Ptr:
+		if v.IsNil() {
+			return fmt.Sprintf("(%s)(nil)", name), nil
+		}
+		if t.Elem().Kind() != reflect.Struct {
+			return "", fmt.Errorf("can't render pointer of type %s", t)
+		}
+		elem, err := p.print(v.Elem())
+		if err != nil {
+			return "", err
+		}
+		return "&" + elem, nil
+	case reflect.Interface:
+		return p.print(v.Elem())
+	default:
+		return "", fmt.Errorf("can't render value of type %s", t)
+	}
+}
+
+// local returns whether a named type is in the package of the reproducer.
+func (p reproducerPrinter) local(t reflect.Type) bool {
+	return strings.HasPrefix(t.String(), p.pkg+".")
+}
+
+func (p reproducerPrinter) typeName(t reflect.Type) (string, error) {
+	if t.Name() != "" {
+		if t.PkgPath() == "" {
+			return t.Name(), nil
+		}
+		if p.local(t) {
+			return t.Name(), nil
+		}
+		if !ast.IsExported(t.Name()) {
+			return "", fmt.Errorf("can't name unexported type %s", t)
+		}
+		p.imports[t.PkgPath()] = true
+		return t.String(), nil
+	}
+	switch t.Kind() {
+	case reflect.Slice, reflect.Array, reflect.Ptr:
+		elem, err := p.typeName(t.Elem())
+		if err != nil {
+			return "", err
+		}
+		switch t.Kind() {
+		case reflect.Slice:
+			return "[]" + elem, nil
+		case reflect.Array:
+			return fmt.Sprintf("[%d]%s", t.Len(), elem), nil
+		default:
+			return "*" + elem, nil
+		}
+	case reflect.Map:
+		key, err := p.typeName(t.Key())
+		if err != nil {
+			return "", err
+		}
+		elem, err := p.typeName(t.Elem())
+		if err != nil {
+			return "", err
+		}
+		return fmt.Sprintf("map[%s]%s", key, elem), nil
+	case reflect.Interface:
+		if t.NumMethod() == 0 {
+			return "interface{}", nil
+		}
+	}
+	return "", fmt.Errorf("can't name type %s", t)
+}
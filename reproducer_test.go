@@ -0,0 +1,131 @@
+package porcupine
+
+import (
+	"bytes"
+	"fmt"
+	"go/parser"
+	"go/token"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestWriteReproducer(t *testing.T) {
+	ops := []Operation{
+		{0, registerInput{false, 200}, 0, 0, 100},
+		{1, registerInput{true, 0}, 10, 200, 30},
+		{2, registerInput{true, 0}, 40, 0, 90},
+	}
+	var buf bytes.Buffer
+	if err := WriteReproducer(&buf, "porcupine", "registerModel", ops, nil); err != nil {
+		t.Fatal(err)
+	}
+	expected := `// Code generated by porcupine.WriteReproducer. DO NOT EDIT.
+
+package porcupine
+
+import (
+	"testing"
+)
+
+// TestReproducer58eb782f checks a history of 3 operations that is not linearizable.
+func TestReproducer58eb782f(t *testing.T) {
+	ops := []Operation{
+		{ClientId: 0, Input: registerInput{op: false, value: 200}, Call: 0, Output: 0, Return: 100},
+		{ClientId: 1, Input: registerInput{op: true, value: 0}, Call: 10, Output: 200, Return: 30},
+		{ClientId: 2, Input: registerInput{op: true, value: 0}, Call: 40, Output: 0, Return: 90},
+	}
+	if CheckOperations(registerModel, ops) {
+		t.Fatal("expected history to not be linearizable")
+	}
+}
+`
+	if buf.String() != expected {
+		t.Fatalf("expected\n%s\ngot\n%s", expected, buf.String())
+	}
+	// the history of the reproducer is not linearizable, like the one
+	// above, which is checked by the generated test itself
+	if CheckOperations(registerModel, ops) {
+		t.Fatal("expected history to not be linearizable")
+	}
+}
+
+type reproducerValue struct {
+	Name   string
+	Tags   map[string]int
+	Next   *reproducerValue
+	Weight float64
+	Raw    []byte
+	Any    interface{}
+	Flag   uint8
+}
+
+func TestWriteReproducerTypes(t *testing.T) {
+	value := reproducerValue{Name: "n", Tags: map[string]int{"b": 2, "a": 1}, Next: &reproducerValue{Weight: 1}, Raw: []byte("x"), Any: int64(3), Flag: 7}
+	ops := []Operation{
+		{0, CSVKVInput{Op: "put", Key: "x", Value: "a"}, 0, CSVKVOutput{}, 10},
+		{1, value, 5, nil, 15},
+	}
+	tests := []struct {
+		pkg      string
+		ops      []Operation
+		expected []string
+	}{
+		{"porcupine", ops, []string{
+			`CSVKVInput{Op: "put", Key: "x", Value: "a"}`,
+			`Tags: map[string]int{"a": 1, "b": 2}`,
+			`Next: &reproducerValue{`,
+			`Weight: float64(1)`,
+			`Raw: []uint8{uint8(120)}`,
+			`Any: int64(3)`,
+			`Flag: uint8(7)`,
+			`Output: nil`,
+			`CheckOperations(models.KV, ops)`,
+		}},
+		{"repro_test", ops[:1], []string{
+			`"github.com/anishathalye/porcupine"`,
+			`ops := []porcupine.Operation{`,
+			`porcupine.CSVKVInput{Op: "put", Key: "x", Value: "a"}`,
+			`porcupine.CheckOperations(models.KV, ops)`,
+		}},
+	}
+	for _, test := range tests {
+		var first, second bytes.Buffer
+		if err := WriteReproducer(&first, test.pkg, "models.KV", test.ops, nil); err != nil {
+			t.Fatal(err)
+		}
+		if err := WriteReproducer(&second, test.pkg, "models.KV", test.ops, nil); err != nil {
+			t.Fatal(err)
+		}
+		if first.String() != second.String() {
+			t.Fatalf("%s: expected output to be deterministic", test.pkg)
+		}
+		src := first.String()
+		for _, s := range test.expected {
+			if !strings.Contains(src, s) {
+				t.Fatalf("%s: expected output to contain %s, got\n%s", test.pkg, s, src)
+			}
+		}
+		if _, err := parser.ParseFile(token.NewFileSet(), "repro_test.go", src, 0); err != nil {
+			t.Fatalf("%s: expected valid Go code, got %v\n%s", test.pkg, err, src)
+		}
+	}
+
+	// unexported types and fields of other packages can't be rendered
+	for _, v := range []interface{}{registerInput{false, 1}, time.Unix(0, 0)} {
+		err := WriteReproducer(&bytes.Buffer{}, "repro", "m", []Operation{{0, v, 0, 0, 1}}, nil)
+		if err == nil || !strings.Contains(err.Error(), "unexported") {
+			t.Fatalf("expected an error for %v, got %v", v, err)
+		}
+	}
+
+	// custom printers
+	var custom bytes.Buffer
+	printer := func(v interface{}) string { return fmt.Sprintf("%q", fmt.Sprint(v)) }
+	if err := WriteReproducer(&custom, "repro", "m", ops[:1], printer); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(custom.String(), `Input: "{put x a}"`) {
+		t.Fatalf("expected custom printer to be used, got\n%s", custom.String())
+	}
+}
@@ -0,0 +1,375 @@
+package porcupine
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// An Access is a read or a write of one object by an operation, as described
+// by a model's Accesses function, for checking session guarantees (see
+// [CheckSessionGuarantees]).
+type Access struct {
+	// Key identifies the object, such as a key of a key-value store. It
+	// can be nil for a model of a single object. It must be comparable
+	// with ==.
+	Key interface{}
+	// Write is whether the operation writes the object, rather than
+	// reads it.
+	Write bool
+	// Value is the value written, or the value read. It must be
+	// comparable with ==, and each write to an object must write a
+	// different value, so that a read identifies the write it observed.
+	// A read of a value that no operation wrote observes the object's
+	// initial value.
+	Value interface{}
+}
+
+// A SessionGuaranteeSet is a set of session guarantees, such as
+// ReadYourWrites|MonotonicReads.
+type SessionGuaranteeSet uint8
+
+const (
+	// ReadYourWrites: a read observes the writes that its session
+	// made before it.
+	ReadYourWrites SessionGuaranteeSet = 1 << iota
+	// MonotonicReads: a read observes the writes that earlier reads of
+	// its session observed.
+	MonotonicReads
+	// MonotonicWrites: a write comes after the writes that its session
+	// made before it.
+	MonotonicWrites
+	// WritesFollowReads: a write comes after the writes that earlier
+	// reads of its session observed.
+	WritesFollowReads
+
+	// AllSessionGuarantees is the set of every session guarantee.
+	AllSessionGuarantees = ReadYourWrites | MonotonicReads | MonotonicWrites | WritesFollowReads
+)
+
+var sessionGuaranteeNames = [...]string{"read-your-writes", "monotonic-reads", "monotonic-writes", "writes-follow-reads"}
+
+func (s SessionGuaranteeSet) String() string {
+	if s == 0 {
+		return "none"
+	}
+	var names []string
+	for i, name := range sessionGuaranteeNames {
+		if s&(1<<i) != 0 {
+			names = append(names, name)
+		}
+	}
+	if rest := s &^ AllSessionGuarantees; rest != 0 {
+		names = append(names, fmt.Sprintf("SessionGuaranteeSet(%#x)", uint8(rest)))
+	}
+	return strings.Join(names, "|")
+}
+
+// A SessionViolation is a pair of operations of one session that break a
+// session guarantee, given the other constraints on the order of the writes
+// to an object.
+type SessionViolation struct {
+	// Guarantee is the guarantee that is broken.
+	Guarantee SessionGuaranteeSet
+	ClientId  int
+	Key       interface{}
+	// First and Second are the indices in the history of the operations,
+	// in the order of the session: the write and the read that doesn't
+	// observe it, for ReadYourWrites; the two reads, for MonotonicReads;
+	// the two writes, for MonotonicWrites; and the read and the write,
+	// for WritesFollowReads.
+	First, Second int
+	// Before and After are the indices of the writes that the guarantee
+	// orders, which Before must come before, or be the same as for reads,
+	// or -1 for the object's initial value; the other constraints already
+	// order After before Before.
+	Before, After int
+	// Description describes the violation, with the model's
+	// DescribeOperation.
+	Description string
+}
+
+func (v SessionViolation) String() string {
+	return v.Description
+}
+
+// A SessionReport is the result of [CheckSessionGuarantees].
+type SessionReport struct {
+	// Guarantees are the guarantees that were checked.
+	Guarantees SessionGuaranteeSet
+	// Violations lists the pairs of operations that break a guarantee,
+	// in the order of the second operation's call.
+	Violations []SessionViolation
+}
+
+// Ok returns whether the history meets the guarantees.
+func (r SessionReport) Ok() bool {
+	return len(r.Violations) == 0
+}
+
+func (r SessionReport) String() string {
+	if r.Ok() {
+		return fmt.Sprintf("%s: ok", r.Guarantees)
+	}
+	var b strings.Builder
+	fmt.Fprintf(&b, "%s: %d violation", r.Guarantees, len(r.Violations))
+	if len(r.Violations) > 1 {
+		b.WriteString("s")
+	}
+	for _, v := range r.Violations {
+		fmt.Fprintf(&b, "\n  - %s", v.Description)
+	}
+	return b.String()
+}
+
+// CheckSessionGuarantees checks that a history meets session guarantees,
+// which are weaker than linearizability: each client is a session, whose
+// operations are ordered by their calls, and the guarantees constrain the
+// order of the writes to each object that the session's reads and writes
+// imply. The model's Accesses function describes the reads and writes of each
+// operation; Step isn't used.
+//
+// The history meets the guarantees if, for each object, there is an order of
+// its writes after its initial value that meets all the constraints. The
+// guarantees are checked for each object separately, as for a store whose
+// objects are replicated independently. When the constraints can't all be met,
+// the report names the pair of operations of a session whose constraint, in
+// the order of their calls, is the first one that can't be met along with the
+// constraints before it.
+//
+// An operation that both reads and writes an object, such as a
+// compare-and-swap, reads it before it writes it.
+func CheckSessionGuarantees(model Model, history []Operation, guarantees SessionGuaranteeSet) SessionReport {
+	report := SessionReport{Guarantees: guarantees}
+	if model.Accesses == nil {
+		panic("porcupine: CheckSessionGuarantees needs a model with an Accesses function")
+	}
+	model = fillDefault(model)
+	objects := make(map[interface{}]*sessionObject)
+	object := func(key interface{}) *sessionObject {
+		o := objects[key]
+		if o == nil {
+			o = &sessionObject{key: key, writes: make(map[interface{}]int), nodes: map[int]*sessionNode{-1: {}}}
+			objects[key] = o
+		}
+		return o
+	}
+	accesses := make([][]Access, len(history))
+	for i, op := range history {
+		accesses[i] = model.Accesses(op.Input, op.Output)
+		for _, a := range accesses[i] {
+			if !a.Write {
+				continue
+			}
+			o := object(a.Key)
+			if _, ok := o.writes[a.Value]; !ok {
+				o.writes[a.Value] = i
+				o.node(i)
+				o.order(-1, i)
+			}
+		}
+	}
+	// the constraints of each session, in the order of their second
+	// operation's call
+	sessions := make(map[int][]int)
+	for i, op := range history {
+		sessions[op.ClientId] = append(sessions[op.ClientId], i)
+	}
+	var constraints []sessionConstraint
+	for client, ops := range sessions {
+		sort.SliceStable(ops, func(a, b int) bool { return history[ops[a]].Call < history[ops[b]].Call })
+		// earlier reads and writes of the session, for each object
+		type seen struct{ reads, writes []sessionAccess }
+		past := make(map[interface{}]*seen)
+		// the session's first pair of operations that orders two
+		// writes is the one that matters
+		type ordering struct {
+			guarantee     SessionGuaranteeSet
+			object        *sessionObject
+			before, after int
+		}
+		added := make(map[ordering]bool)
+		add := func(c sessionConstraint) {
+			if o := (ordering{c.guarantee, c.object, c.before, c.after}); !added[o] {
+				added[o] = true
+				constraints = append(constraints, c)
+			}
+		}
+		for _, i := range ops {
+			for _, a := range accesses[i] {
+				if a.Write {
+					continue
+				}
+				o := object(a.Key)
+				s := past[a.Key]
+				if s == nil {
+					s = &seen{}
+					past[a.Key] = s
+				}
+				w := o.observed(a.Value)
+				if guarantees&ReadYourWrites != 0 {
+					for _, e := range s.writes {
+						add(sessionConstraint{ReadYourWrites, client, o, e.op, i, e.write, w})
+					}
+				}
+				if guarantees&MonotonicReads != 0 {
+					for _, e := range s.reads {
+						add(sessionConstraint{MonotonicReads, client, o, e.op, i, e.write, w})
+					}
+				}
+				s.reads = append(s.reads, sessionAccess{i, w})
+			}
+			for _, a := range accesses[i] {
+				if !a.Write {
+					continue
+				}
+				o := object(a.Key)
+				s := past[a.Key]
+				if s == nil {
+					s = &seen{}
+					past[a.Key] = s
+				}
+				w := o.writes[a.Value]
+				if guarantees&MonotonicWrites != 0 {
+					for _, e := range s.writes {
+						add(sessionConstraint{MonotonicWrites, client, o, e.op, i, e.write, w})
+					}
+				}
+				if guarantees&WritesFollowReads != 0 {
+					for _, e := range s.reads {
+						add(sessionConstraint{WritesFollowReads, client, o, e.op, i, e.write, w})
+					}
+				}
+				s.writes = append(s.writes, sessionAccess{i, w})
+			}
+		}
+	}
+	sort.SliceStable(constraints, func(a, b int) bool {
+		ca, cb := constraints[a], constraints[b]
+		if history[ca.second].Call != history[cb.second].Call {
+			return history[ca.second].Call < history[cb.second].Call
+		}
+		return ca.second < cb.second
+	})
+	for _, c := range constraints {
+		// a read can observe the write it must observe, and writes of
+		// the same value are the same write
+		if c.before == c.after {
+			continue
+		}
+		if !c.object.reaches(c.after, c.before) {
+			c.object.order(c.before, c.after)
+			continue
+		}
+		report.Violations = append(report.Violations, c.violation(model, history))
+	}
+	return report
+}
+
+type sessionAccess struct {
+	op    int // index in the history
+	write int // written or observed, or -1 for the initial value
+}
+
+// A sessionObject holds the writes to one object, and the order of them that
+// the constraints so far imply, as a graph.
+type sessionObject struct {
+	key    interface{}
+	writes map[interface{}]int // index of the first write of each value
+	nodes  map[int]*sessionNode
+	search int // number of searches so far
+}
+
+type sessionNode struct {
+	next []int // writes that come after this one
+	mark int   // last search that visited the node
+}
+
+func (o *sessionObject) node(write int) *sessionNode {
+	n := o.nodes[write]
+	if n == nil {
+		n = &sessionNode{}
+		o.nodes[write] = n
+	}
+	return n
+}
+
+// observed returns the write that a read of value observed.
+func (o *sessionObject) observed(value interface{}) int {
+	if w, ok := o.writes[value]; ok {
+		return w
+	}
+	return -1
+}
+
+func (o *sessionObject) order(before, after int) {
+	n := o.node(before)
+	n.next = append(n.next, after)
+}
+
+// reaches returns whether the order so far puts the write to after the write
+// from.
+func (o *sessionObject) reaches(from, to int) bool {
+	o.search++
+	search := o.search
+	stack := []int{from}
+	o.node(from).mark = search
+	for len(stack) > 0 {
+		w := stack[len(stack)-1]
+		stack = stack[:len(stack)-1]
+		if w == to {
+			return true
+		}
+		for _, next := range o.node(w).next {
+			if n := o.node(next); n.mark != search {
+				n.mark = search
+				stack = append(stack, next)
+			}
+		}
+	}
+	return false
+}
+
+// A sessionConstraint orders two writes to an object, because of a pair of
+// operations of a session.
+type sessionConstraint struct {
+	guarantee     SessionGuaranteeSet
+	client        int
+	object        *sessionObject
+	first, second int // operations
+	before, after int // writes
+}
+
+func (c sessionConstraint) violation(model Model, history []Operation) SessionViolation {
+	describe := func(i int) string {
+		if i < 0 {
+			return "the initial value"
+		}
+		return fmt.Sprintf("operation %d (%s)", i, model.DescribeOperation(history[i].Input, history[i].Output))
+	}
+	key := ""
+	if c.object.key != nil {
+		key = fmt.Sprintf(" of %v", c.object.key)
+	}
+	var what string
+	switch c.guarantee {
+	case ReadYourWrites:
+		what = fmt.Sprintf("%s reads %s%s, not the write of %s before it", describe(c.second), describe(c.after), key, describe(c.first))
+	case MonotonicReads:
+		what = fmt.Sprintf("%s reads %s%s, which is older than %s that %s read before it", describe(c.second), describe(c.after), key, describe(c.before), describe(c.first))
+	case MonotonicWrites:
+		what = fmt.Sprintf("%s writes%s before %s, which came first in the session", describe(c.second), key, describe(c.first))
+	case WritesFollowReads:
+		what = fmt.Sprintf("%s writes%s before %s, which %s read first", describe(c.second), key, describe(c.before), describe(c.first))
+	}
+	return SessionViolation{
+		Guarantee:   c.guarantee,
+		ClientId:    c.client,
+		Key:         c.object.key,
+		First:       c.first,
+		Second:      c.second,
+		Before:      c.before,
+		After:       c.after,
+		Description: fmt.Sprintf("%s: client %d: %s", c.guarantee, c.client, what),
+	}
+}
@@ -0,0 +1,162 @@
+package porcupine
+
+import (
+	"strings"
+	"testing"
+)
+
+func registerAccesses(input, output interface{}) []Access {
+	in := input.(registerInput)
+	if in.op {
+		return []Access{{Value: output}}
+	}
+	return []Access{{Write: true, Value: in.value}}
+}
+
+// kvAccesses leaves appends out, since their input doesn't say what they
+// write.
+func kvAccesses(input, output interface{}) []Access {
+	in := input.(kvInput)
+	switch in.op {
+	case 0:
+		return []Access{{Key: in.key, Value: output.(kvOutput).value}}
+	case 1:
+		return []Access{{Key: in.key, Write: true, Value: in.value}}
+	}
+	return nil
+}
+
+func sessionRegisterModel() Model {
+	model := registerModel
+	model.Accesses = registerAccesses
+	return model
+}
+
+func sessionPut(client, value int, call, ret int64) Operation {
+	return Operation{client, registerInput{false, value}, call, 0, ret}
+}
+
+func sessionGet(client, value int, call, ret int64) Operation {
+	return Operation{client, registerInput{true, 0}, call, value, ret}
+}
+
+func TestSessionGuaranteesOk(t *testing.T) {
+	ops := []Operation{
+		sessionPut(0, 1, 0, 10),
+		sessionGet(0, 1, 20, 30),
+		sessionGet(1, 1, 5, 15),
+		sessionPut(1, 2, 25, 35),
+		sessionGet(1, 2, 40, 50),
+		// another session can still read older values
+		sessionGet(2, 1, 45, 55),
+		sessionGet(2, 2, 60, 70),
+	}
+	report := CheckSessionGuarantees(sessionRegisterModel(), ops, AllSessionGuarantees)
+	if !report.Ok() {
+		t.Fatalf("expected no violations, got %s", report)
+	}
+	if s := report.String(); s != "read-your-writes|monotonic-reads|monotonic-writes|writes-follow-reads: ok" {
+		t.Fatalf("unexpected report %q", s)
+	}
+}
+
+func checkSessionViolation(t *testing.T, report SessionReport, expected SessionViolation) {
+	t.Helper()
+	if len(report.Violations) != 1 {
+		t.Fatalf("expected one violation, got %s", report)
+	}
+	v := report.Violations[0]
+	if v.Guarantee != expected.Guarantee || v.ClientId != expected.ClientId || v.First != expected.First || v.Second != expected.Second || v.Before != expected.Before || v.After != expected.After {
+		t.Fatalf("expected %+v, got %+v", expected, v)
+	}
+	if !strings.HasPrefix(v.Description, expected.Guarantee.String()) {
+		t.Fatalf("expected the description to name the guarantee, got %q", v.Description)
+	}
+}
+
+func TestReadYourWritesViolation(t *testing.T) {
+	ops := []Operation{
+		sessionPut(0, 1, 0, 10),
+		sessionGet(0, 0, 20, 30),
+		sessionGet(1, 0, 20, 30),
+	}
+	report := CheckSessionGuarantees(sessionRegisterModel(), ops, AllSessionGuarantees)
+	checkSessionViolation(t, report, SessionViolation{Guarantee: ReadYourWrites, ClientId: 0, First: 0, Second: 1, Before: 0, After: -1})
+	expected := "read-your-writes: client 0: operation 1 (get() -> '0') reads the initial value, not the write of operation 0 (put('1')) before it"
+	if report.Violations[0].Description != expected {
+		t.Fatalf("expected %q, got %q", expected, report.Violations[0].Description)
+	}
+	if report := CheckSessionGuarantees(sessionRegisterModel(), ops, MonotonicReads|MonotonicWrites|WritesFollowReads); !report.Ok() {
+		t.Fatalf("expected no violations without read-your-writes, got %s", report)
+	}
+}
+
+func TestMonotonicReadsViolation(t *testing.T) {
+	ops := []Operation{
+		sessionPut(1, 1, 0, 10),
+		sessionPut(1, 2, 20, 30),
+		sessionGet(0, 2, 40, 50),
+		sessionGet(0, 1, 60, 70),
+	}
+	report := CheckSessionGuarantees(sessionRegisterModel(), ops, AllSessionGuarantees)
+	checkSessionViolation(t, report, SessionViolation{Guarantee: MonotonicReads, ClientId: 0, First: 2, Second: 3, Before: 1, After: 0})
+	// nothing orders the writes without monotonic writes
+	if report := CheckSessionGuarantees(sessionRegisterModel(), ops, MonotonicReads); !report.Ok() {
+		t.Fatalf("expected no violations with only monotonic reads, got %s", report)
+	}
+}
+
+func TestMonotonicWritesViolation(t *testing.T) {
+	ops := []Operation{
+		sessionPut(0, 1, 0, 10),
+		sessionGet(1, 2, 20, 30),
+		sessionGet(1, 1, 40, 50),
+		sessionPut(0, 2, 60, 70),
+	}
+	report := CheckSessionGuarantees(sessionRegisterModel(), ops, AllSessionGuarantees)
+	checkSessionViolation(t, report, SessionViolation{Guarantee: MonotonicWrites, ClientId: 0, First: 0, Second: 3, Before: 0, After: 3})
+	if report := CheckSessionGuarantees(sessionRegisterModel(), ops, ReadYourWrites|MonotonicReads|WritesFollowReads); !report.Ok() {
+		t.Fatalf("expected no violations without monotonic writes, got %s", report)
+	}
+}
+
+func TestWritesFollowReadsViolation(t *testing.T) {
+	ops := []Operation{
+		sessionPut(1, 1, 0, 10),
+		sessionGet(2, 2, 20, 30),
+		sessionGet(2, 1, 40, 50),
+		sessionGet(0, 1, 45, 55),
+		sessionPut(0, 2, 60, 70),
+	}
+	report := CheckSessionGuarantees(sessionRegisterModel(), ops, AllSessionGuarantees)
+	checkSessionViolation(t, report, SessionViolation{Guarantee: WritesFollowReads, ClientId: 0, First: 3, Second: 4, Before: 0, After: 4})
+	if report := CheckSessionGuarantees(sessionRegisterModel(), ops, ReadYourWrites|MonotonicReads|MonotonicWrites); !report.Ok() {
+		t.Fatalf("expected no violations without writes-follow-reads, got %s", report)
+	}
+}
+
+func TestSessionGuaranteesPerKey(t *testing.T) {
+	model := kvModel
+	model.Accesses = kvAccesses
+	ops := []Operation{
+		{0, kvInput{op: 1, key: "x", value: "a"}, 0, kvOutput{}, 10},
+		// another key's initial value
+		{0, kvInput{op: 0, key: "y"}, 20, kvOutput{""}, 30},
+		{0, kvInput{op: 0, key: "x"}, 40, kvOutput{"a"}, 50},
+		{1, kvInput{op: 1, key: "y", value: "b"}, 0, kvOutput{}, 10},
+		{1, kvInput{op: 0, key: "y"}, 20, kvOutput{"b"}, 30},
+		{1, kvInput{op: 0, key: "y"}, 40, kvOutput{""}, 50},
+	}
+	// the last read breaks monotonic reads too
+	if report := CheckSessionGuarantees(model, ops, AllSessionGuarantees); len(report.Violations) != 2 {
+		t.Fatalf("expected two violations, got %s", report)
+	}
+	report := CheckSessionGuarantees(model, ops, ReadYourWrites)
+	checkSessionViolation(t, report, SessionViolation{Guarantee: ReadYourWrites, ClientId: 1, First: 3, Second: 5, Before: 3, After: -1})
+	if report.Violations[0].Key != "y" {
+		t.Fatalf("expected the violation to be on y, got %v", report.Violations[0].Key)
+	}
+	if !strings.Contains(report.Violations[0].Description, "of y") {
+		t.Fatalf("expected the description to name the key, got %q", report.Violations[0].Description)
+	}
+}
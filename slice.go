@@ -0,0 +1,96 @@
+package porcupine
+
+// A BoundaryPolicy determines what [SliceHistory] and [SliceEvents] do with
+// operations that straddle a boundary of the window, being called before the
+// window starts or returning after it ends.
+type BoundaryPolicy int
+
+const (
+	// BoundaryDrop drops operations that straddle a boundary.
+	BoundaryDrop BoundaryPolicy = iota
+	// BoundaryClamp keeps operations that straddle a boundary, with their
+	// call and return times clamped to the window.
+	BoundaryClamp
+	// BoundaryKeep keeps operations that straddle a boundary unchanged.
+	BoundaryKeep
+)
+
+// SliceHistory returns the operations of a history that overlap with the
+// window from from to to, inclusive, to check only part of a long history.
+// Operations that are entirely inside the window are kept unchanged, those
+// that are entirely outside of it are dropped, and those that straddle a
+// boundary are handled according to the policy. Operations keep their
+// original order.
+//
+// Clamping only shrinks operations, so it never makes an operation return
+// before it is called, and operations of a client that were sequential stay
+// sequential. Shrinking an operation can only make a history less
+// linearizable, though, so if a clamped history is not linearizable,
+// checking it with BoundaryKeep tells whether that is because of the clamping.
+//
+// The slice is checked starting from the model's initial state, so a slice
+// that starts after the beginning of the history may not be linearizable only
+// because the operations before the window are missing; for example, a read
+// in the window may return a value written before it. A slice that starts at
+// the beginning of the history doesn't have this problem.
+func SliceHistory(ops []Operation, from, to int64, policy BoundaryPolicy) []Operation {
+	sliced, _ := sliceHistory(ops, from, to, policy)
+	return sliced
+}
+
+// sliceHistory is like SliceHistory, but also returns the indices of the
+// kept operations in ops.
+func sliceHistory(ops []Operation, from, to int64, policy BoundaryPolicy) ([]Operation, []int) {
+	var sliced []Operation
+	var indices []int
+	for i, op := range ops {
+		if op.Return < from || op.Call > to {
+			continue
+		}
+		if op.Call < from || op.Return > to {
+			switch policy {
+			case BoundaryDrop:
+				continue
+			case BoundaryClamp:
+				if op.Call < from {
+					op.Call = from
+				}
+				if op.Return > to {
+					op.Return = to
+				}
+			}
+		}
+		sliced = append(sliced, op)
+		indices = append(indices, i)
+	}
+	return sliced, indices
+}
+
+// SliceEvents is the equivalent of [SliceHistory] for a history of events.
+// Events don't have timestamps, so the window is given by the positions of
+// events in the history, from from to to, inclusive. The call and return of
+// each operation are kept or dropped together, and kept operations keep their
+// Ids. Clamped calls are moved to the start of the window, and clamped
+// returns to its end.
+//
+// It returns an error if the events don't form a valid history, as described
+// in [EventsToOperations].
+func SliceEvents(events []Event, from, to int, policy BoundaryPolicy) ([]Event, error) {
+	ops, err := EventsToOperations(events)
+	if err != nil {
+		return nil, err
+	}
+	// operations are in the order of their call events
+	var ids []int
+	for _, event := range events {
+		if event.Kind == CallEvent {
+			ids = append(ids, event.Id)
+		}
+	}
+	sliced, indices := sliceHistory(ops, int64(from), int64(to), policy)
+	result := OperationsToEvents(sliced)
+	for i := range result {
+		result[i].Id = ids[indices[result[i].Id]]
+	}
+	return result, nil
+}
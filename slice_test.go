@@ -0,0 +1,99 @@
+package porcupine
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestSliceHistory(t *testing.T) {
+	ops := []Operation{
+		{0, registerInput{false, 1}, 0, 0, 10},   // before the window
+		{1, registerInput{false, 2}, 5, 0, 25},   // straddles the start
+		{0, registerInput{true, 0}, 20, 2, 30},   // inside
+		{2, registerInput{true, 0}, 35, 2, 60},   // straddles the end
+		{3, registerInput{false, 3}, 15, 0, 100}, // covers the window
+		{0, registerInput{true, 0}, 70, 3, 80},   // after the window
+	}
+	tests := []struct {
+		policy   BoundaryPolicy
+		expected []Operation
+	}{
+		{BoundaryDrop, []Operation{ops[2]}},
+		{BoundaryClamp, []Operation{
+			{1, registerInput{false, 2}, 20, 0, 25},
+			ops[2],
+			{2, registerInput{true, 0}, 35, 2, 40},
+			{3, registerInput{false, 3}, 20, 0, 40},
+		}},
+		{BoundaryKeep, []Operation{ops[1], ops[2], ops[3], ops[4]}},
+	}
+	for _, test := range tests {
+		sliced := SliceHistory(ops, 20, 40, test.policy)
+		if !reflect.DeepEqual(sliced, test.expected) {
+			t.Fatalf("policy %d: expected %v, got %v", test.policy, test.expected, sliced)
+		}
+		for _, issue := range ValidateHistory(sliced) {
+			if issue.Severity != SeverityInfo {
+				t.Fatalf("policy %d: expected sliced history to be well-formed, got %v", test.policy, issue)
+			}
+		}
+	}
+}
+
+func TestSliceEventsJepsen(t *testing.T) {
+	// etcd_000 has a violation that is visible in the first 100 events
+	events := parseJepsenLog("test_data/jepsen/etcd_000.log")
+	for _, policy := range []BoundaryPolicy{BoundaryDrop, BoundaryClamp, BoundaryKeep} {
+		sliced, err := SliceEvents(events, 0, 100, policy)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(sliced) >= len(events) || len(sliced)%2 != 0 {
+			t.Fatalf("policy %d: unexpected number of events %d", policy, len(sliced))
+		}
+		if issues := ValidateEvents(sliced); len(issues) != 0 {
+			t.Fatalf("policy %d: expected matched calls and returns, got %v", policy, issues)
+		}
+		if CheckEvents(etcdModel, sliced) {
+			t.Fatalf("policy %d: expected sliced history to not be linearizable", policy)
+		}
+		sliced, err = SliceEvents(events, 0, 70, policy)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !CheckEvents(etcdModel, sliced) {
+			t.Fatalf("policy %d: expected history before the violation to be linearizable", policy)
+		}
+	}
+}
+
+func TestSliceEvents(t *testing.T) {
+	events := []Event{
+		{0, CallEvent, registerInput{false, 1}, 10},
+		{1, CallEvent, registerInput{true, 0}, 11},
+		{0, ReturnEvent, 0, 10},
+		{2, CallEvent, registerInput{true, 0}, 12},
+		{2, ReturnEvent, 1, 12},
+		{1, ReturnEvent, 1, 11},
+	}
+	sliced, err := SliceEvents(events, 2, 4, BoundaryDrop)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(sliced, events[3:5]) {
+		t.Fatalf("expected the read of client 2, got %v", sliced)
+	}
+	sliced, err = SliceEvents(events, 2, 4, BoundaryClamp)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// the write and the read of client 1 are clamped to be called at 2, and
+	// the read of client 1 to return at 4, like the read of client 2
+	expected := []Event{events[0], events[1], events[2], events[3], events[5], events[4]}
+	if !reflect.DeepEqual(sliced, expected) {
+		t.Fatalf("expected %v, got %v", expected, sliced)
+	}
+	if _, err := SliceEvents(events[:1], 0, 1, BoundaryDrop); err == nil {
+		t.Fatal("expected an error for a call without a return")
+	}
+}
@@ -0,0 +1,299 @@
+package porcupine
+
+import (
+	"fmt"
+	"html/template"
+	"io"
+	"sort"
+	"strings"
+	"unicode/utf8"
+)
+
+// Layout constants for static visualizations, in pixels. Text is drawn in a
+// monospace font, so its width can be estimated without a browser.
+const (
+	staticPadding      = 10
+	staticRowLabel     = 40 // width of the column with client IDs
+	staticBoxHeight    = 30
+	staticBoxSpace     = 15
+	staticBoxPadding   = 8
+	staticBadgeHeight  = 18
+	staticBadgeGap     = 6
+	staticCharWidth    = 8.5 // for a 14px monospace font
+	staticBadgeCharW   = 7   // for a 11px font
+	staticTimeEpsilon  = 20  // minimum distance between distinct timestamps
+	staticHeaderHeight = 50
+	staticMinWidth     = 800 // enough for the header
+)
+
+type staticRow struct {
+	Label string
+	Title string // client name, if any
+	Y     float64
+}
+
+type staticBox struct {
+	X, Y, Width float64
+	Description string
+	Title       string // full description and times, shown on hover
+	Color       string
+	Linearized  bool
+	Badge       string // position in the longest partial linearization
+	BadgeX      float64
+	BadgeY      float64
+	BadgeWidth  float64
+	BadgeTextX  float64
+	TextX       float64
+	TextY       float64
+}
+
+type staticLayout struct {
+	Summary   string
+	Width     float64
+	Height    float64
+	BoxHeight float64
+	Rows      []staticRow
+	Boxes     []staticBox
+	Tables    template.HTML
+}
+
+// staticPoint is a position on the time axis. An operation that ends at the
+// same time as another operation starts is drawn as ending after the other
+// operation starts, like in the interactive visualization.
+type staticPoint struct {
+	time  int64
+	after bool
+}
+
+func (p staticPoint) less(q staticPoint) bool {
+	if p.time != q.time {
+		return p.time < q.time
+	}
+	return !p.after && q.after
+}
+
+type staticElement struct {
+	partition int
+	index     int
+	elem      historyElement
+	badge     string
+	start     staticPoint
+	end       staticPoint
+	textWidth float64
+	width     float64
+	lane      int
+}
+
+// computeStaticLayout lays out a visualization so that it can be drawn
+// without scripting. Time is warped the same way as in the interactive
+// visualization: distinct timestamps are at least staticTimeEpsilon apart,
+// and every box is wide enough to fit its label and badge. If operations of
+// the same client overlap, they are placed in separate lanes of the client's
+// row, so that no two boxes (or labels) collide.
+func computeStaticLayout(data visualizationData) staticLayout {
+	var elements []*staticElement
+	starts := make(map[int64]bool)
+	for p, partition := range data.Partitions {
+		for _, elem := range partition.History {
+			starts[elem.Start] = true
+		}
+		order := make(map[int]int)
+		if len(partition.PartialLinearizations) > 0 {
+			// the longest linearization is first
+			for i, step := range partition.PartialLinearizations[0] {
+				order[step.Index] = i + 1
+			}
+		}
+		for i, elem := range partition.History {
+			e := &staticElement{partition: p, index: i, elem: elem}
+			if n, ok := order[i]; ok {
+				if len(data.Partitions) > 1 {
+					e.badge = fmt.Sprintf("%d.%d", p, n)
+				} else {
+					e.badge = fmt.Sprintf("%d", n)
+				}
+			}
+			elements = append(elements, e)
+		}
+	}
+
+	// x positions: a greedy left-to-right scan over the points on the
+	// time axis
+	pointSet := make(map[staticPoint]bool)
+	for _, e := range elements {
+		e.start = staticPoint{time: e.elem.Start}
+		e.end = staticPoint{time: e.elem.End, after: starts[e.elem.End]}
+		pointSet[e.start] = true
+		pointSet[e.end] = true
+		e.textWidth = float64(utf8.RuneCountInString(e.elem.Description)) * staticCharWidth
+		e.width = e.textWidth + 2*staticBoxPadding
+		if e.badge != "" {
+			e.width += badgeWidth(e.badge) + staticBadgeGap
+		}
+	}
+	points := make([]staticPoint, 0, len(pointSet))
+	for p := range pointSet {
+		points = append(points, p)
+	}
+	sort.Slice(points, func(i, j int) bool { return points[i].less(points[j]) })
+	byEnd := make(map[staticPoint][]*staticElement)
+	for _, e := range elements {
+		byEnd[e.end] = append(byEnd[e.end], e)
+	}
+	xPos := make(map[staticPoint]float64)
+	for i, p := range points {
+		pos := 0.0
+		if i > 0 {
+			pos = xPos[points[i-1]] + staticTimeEpsilon
+		}
+		for _, e := range byEnd[p] {
+			if x := xPos[e.start] + e.width; x > pos {
+				pos = x
+			}
+		}
+		xPos[p] = pos
+	}
+
+	// rows: one per client, ordered by client ID, with as many lanes as
+	// needed for overlapping operations
+	names := make(map[int]string)
+	byClient := make(map[int][]*staticElement)
+	for _, e := range elements {
+		byClient[e.elem.ClientId] = append(byClient[e.elem.ClientId], e)
+	}
+	for _, partition := range data.Partitions {
+		for i, client := range partition.Clients {
+			if partition.ClientNames != nil {
+				names[client] = partition.ClientNames[i]
+			}
+		}
+	}
+	clients := make([]int, 0, len(byClient))
+	for client := range byClient {
+		clients = append(clients, client)
+	}
+	sort.Ints(clients)
+	layout := staticLayout{
+		Summary:   describeSummary(data.Summary),
+		BoxHeight: staticBoxHeight,
+	}
+	y := float64(staticHeaderHeight + staticPadding)
+	for _, client := range clients {
+		es := byClient[client]
+		sort.SliceStable(es, func(i, j int) bool { return xPos[es[i].start] < xPos[es[j].start] })
+		var laneEnds []float64
+		for _, e := range es {
+			e.lane = -1
+			for lane, end := range laneEnds {
+				if end <= xPos[e.start] {
+					e.lane = lane
+					break
+				}
+			}
+			if e.lane == -1 {
+				e.lane = len(laneEnds)
+				laneEnds = append(laneEnds, 0)
+			}
+			laneEnds[e.lane] = xPos[e.end]
+		}
+		layout.Rows = append(layout.Rows, staticRow{
+			Label: fmt.Sprintf("%d", client),
+			Title: names[client],
+			Y:     y + staticBoxHeight/2,
+		})
+		for _, e := range es {
+			x := staticPadding + staticRowLabel + xPos[e.start]
+			box := staticBox{
+				X:           x,
+				Y:           y + float64(e.lane)*(staticBoxHeight+staticBoxSpace),
+				Width:       xPos[e.end] - xPos[e.start],
+				Description: e.elem.Description,
+				Title:       describeStaticElement(e, data.TimeUnit),
+				Color:       e.elem.Color,
+				Linearized:  e.badge != "",
+				Badge:       e.badge,
+			}
+			// center the badge and label together in the box
+			contentWidth := e.textWidth
+			if e.badge != "" {
+				box.BadgeWidth = badgeWidth(e.badge)
+				contentWidth += box.BadgeWidth + staticBadgeGap
+			}
+			left := x + (box.Width-contentWidth)/2
+			box.BadgeX = left
+			box.BadgeY = box.Y + (staticBoxHeight-staticBadgeHeight)/2
+			box.BadgeTextX = left + box.BadgeWidth/2
+			box.TextX = left + contentWidth - e.textWidth
+			box.TextY = box.Y + staticBoxHeight/2
+			layout.Boxes = append(layout.Boxes, box)
+		}
+		y += float64(len(laneEnds)) * (staticBoxHeight + staticBoxSpace)
+	}
+	// deterministic drawing order
+	sort.SliceStable(layout.Boxes, func(i, j int) bool {
+		if layout.Boxes[i].Y != layout.Boxes[j].Y {
+			return layout.Boxes[i].Y < layout.Boxes[j].Y
+		}
+		return layout.Boxes[i].X < layout.Boxes[j].X
+	})
+	width := 0.0
+	if len(points) > 0 {
+		width = xPos[points[len(points)-1]]
+	}
+	layout.Width = 2*staticPadding + staticRowLabel + width
+	if layout.Width < staticMinWidth {
+		layout.Width = staticMinWidth
+	}
+	layout.Height = y + staticPadding
+	return layout
+}
+
+func badgeWidth(badge string) float64 {
+	w := float64(len(badge))*staticBadgeCharW + 8
+	if w < staticBadgeHeight {
+		return staticBadgeHeight
+	}
+	return w
+}
+
+func describeStaticElement(e *staticElement, unit TimeUnit) string {
+	desc := e.elem.Description
+	if e.elem.FullDescription != "" {
+		desc = e.elem.FullDescription
+	}
+	return desc + "\n" + unit.describeTimes(e.elem.Start, e.elem.End)
+}
+
+func describeSummary(summary visualizationSummary) string {
+	var b strings.Builder
+	b.WriteString(string(summary.Result))
+	if summary.ResultComputed {
+		b.WriteString(" (computed)")
+	}
+	fmt.Fprintf(&b, " · %s · %s (%d fully linearized)", plural(summary.Operations, "operation"), plural(summary.Partitions, "partition"), summary.LinearizedPartitions)
+	if summary.Duration != 0 {
+		fmt.Fprintf(&b, " · checked in %v", summary.Duration)
+	}
+	return b.String()
+}
+
+func plural(n int, noun string) string {
+	if n == 1 {
+		return fmt.Sprintf("%d %s", n, noun)
+	}
+	return fmt.Sprintf("%d %ss", n, noun)
+}
+
+var staticTemplate = template.Must(template.ParseFS(visualizationFS, "visualization/static.html"))
+
+func executeStaticLayout(data visualizationData, output io.Writer, opts VisualizationOptions) error {
+	layout := computeStaticLayout(data)
+	if opts.AccessibleTables {
+		var err error
+		layout.Tables, err = renderAccessibleTables(data)
+		if err != nil {
+			return err
+		}
+	}
+	return staticTemplate.Execute(output, layout)
+}
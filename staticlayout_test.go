@@ -0,0 +1,105 @@
+package porcupine
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestStaticLayout(t *testing.T) {
+	ops := []Operation{
+		{0, kvInput{op: 1, key: "x", value: "y"}, 0, kvOutput{}, 10},
+		{1, kvInput{op: 0, key: "x"}, 10, kvOutput{"y"}, 30},
+		{0, kvInput{op: 1, key: "x", value: "z"}, 20, kvOutput{}, 40},
+		{2, kvInput{op: 0, key: "x"}, 50, kvOutput{"y"}, 60},
+	}
+	res, info := CheckOperationsVerbose(kvModel, ops, 0)
+	if res != Illegal {
+		t.Fatalf("expected output %v, got output %v", Illegal, res)
+	}
+	data := computeVisualizationData(kvModel, info, VisualizationOptions{})
+	layout := computeStaticLayout(data)
+	if len(layout.Rows) != 3 || len(layout.Boxes) != 4 {
+		t.Fatalf("expected 3 rows and 4 boxes, got %d and %d", len(layout.Rows), len(layout.Boxes))
+	}
+	byDesc := make(map[string]staticBox)
+	for _, box := range layout.Boxes {
+		byDesc[box.Description] = box
+		// labels fit in their boxes
+		if box.TextX < box.X || box.TextX+float64(len(box.Description))*staticCharWidth > box.X+box.Width {
+			t.Fatalf("label of %q doesn't fit in its box: %+v", box.Description, box)
+		}
+		if box.Badge != "" && (box.BadgeX < box.X || box.BadgeX+box.BadgeWidth > box.TextX) {
+			t.Fatalf("badge of %q collides with its box or label: %+v", box.Description, box)
+		}
+	}
+	// real-time order is preserved
+	put := byDesc["put('x', 'y')"]
+	putZ := byDesc["put('x', 'z')"]
+	if put.X+put.Width > putZ.X {
+		t.Fatalf("expected put('x', 'y') to be drawn before put('x', 'z'): %+v %+v", put, putZ)
+	}
+	// the longest linearization is put y, get y, put z; the last get can't
+	// be linearized
+	expectedBadges := map[string]string{"put('x', 'y')": "1", "put('x', 'z')": "3"}
+	for desc, badge := range expectedBadges {
+		if byDesc[desc].Badge != badge {
+			t.Fatalf("expected %q to have badge %q, got %q", desc, badge, byDesc[desc].Badge)
+		}
+	}
+	unlinearized := 0
+	for _, box := range layout.Boxes {
+		if !box.Linearized {
+			unlinearized++
+		}
+	}
+	if unlinearized != 1 {
+		t.Fatalf("expected 1 operation not to be linearized, got %d", unlinearized)
+	}
+
+	var buf bytes.Buffer
+	err := VisualizeWithOptions(kvModel, info, &buf, VisualizationOptions{StaticLayout: true})
+	if err != nil {
+		t.Fatalf("visualization failed: %v", err)
+	}
+	out := buf.String()
+	if strings.Contains(out, "<script") {
+		t.Fatal("expected static visualization not to contain scripts")
+	}
+	if !strings.Contains(out, "history-rect-unlinearized") || !strings.Contains(out, "Illegal (computed)") {
+		t.Fatalf("expected static visualization to show the result, got %q", out)
+	}
+	var again bytes.Buffer
+	err = VisualizeWithOptions(kvModel, info, &again, VisualizationOptions{StaticLayout: true})
+	if err != nil {
+		t.Fatalf("visualization failed: %v", err)
+	}
+	if !bytes.Equal(buf.Bytes(), again.Bytes()) {
+		t.Fatal("expected static visualization to be deterministic")
+	}
+}
+
+func TestStaticLayoutOverlappingClient(t *testing.T) {
+	// a client with overlapping operations (which can happen with
+	// histories that reuse client IDs) gets an extra lane
+	ops := []Operation{
+		{0, registerInput{false, 100}, 0, 0, 100},
+		{0, registerInput{true, 0}, 25, 100, 75},
+		{1, registerInput{true, 0}, 110, 100, 120},
+	}
+	res, info := CheckOperationsVerbose(registerModel, ops, 0)
+	if res != Ok {
+		t.Fatal("expected operations to be linearizable")
+	}
+	layout := computeStaticLayout(computeVisualizationData(registerModel, info, VisualizationOptions{}))
+	if len(layout.Rows) != 2 {
+		t.Fatalf("expected 2 rows, got %d", len(layout.Rows))
+	}
+	a, b, c := layout.Boxes[0], layout.Boxes[1], layout.Boxes[2]
+	if a.Y == b.Y {
+		t.Fatalf("expected overlapping operations to be in different lanes: %+v %+v", a, b)
+	}
+	if c.Y <= b.Y {
+		t.Fatalf("expected the next client's row to be below both lanes: %+v %+v", b, c)
+	}
+}
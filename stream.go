@@ -0,0 +1,375 @@
+package porcupine
+
+import (
+	"fmt"
+	"io"
+	"reflect"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// The streaming checker checks a history as it's read, without holding all of
+// it in memory. It partitions operations by key as they complete, and keeps,
+// for each partition, the operations since the partition was last quiescent,
+// when all of the operations that had been called in it had returned, along
+// with the states that the partition could be in at that point. When a
+// partition becomes quiescent again, the checker finds every state that the
+// operations since then can lead to from those states, and forgets the
+// operations. Operations that are called later can only be linearized after
+// them, so those states are all that matters about them.
+//
+// The checker finds those states with the search of checkSingle, from each of
+// the states at the start, recording every state at the end of a
+// linearization instead of stopping at the first. That can take much longer
+// than finding a linearization, so the checker gives up on it after the
+// search reaches MaxSegmentStates states, and keeps the operations until the
+// partition is quiescent again. At the end
+// of the history, it only looks for a linearization of the remaining
+// operations.
+
+// defaultMaxSegmentStates is the default for StreamOptions.MaxSegmentStates.
+const defaultMaxSegmentStates = 100000
+
+// An EventIterator returns the events of a history one at a time: the next
+// event and true, or false at the end of the history, or an error.
+type EventIterator func() (Event, bool, error)
+
+// An OperationIterator returns the operations of a history one at a time,
+// like an [EventIterator].
+type OperationIterator func() (Operation, bool, error)
+
+// StreamOptions configures [CheckEventStream] and [CheckOperationStream].
+type StreamOptions struct {
+	// Timeout for the check. A timeout of 0 is interpreted as an
+	// unlimited timeout.
+	Timeout time.Duration
+	// PartitionKey returns the key of the partition of an operation, from
+	// its input, such that a history is linearizable if and only if the
+	// operations with each key are. It takes the place of the model's
+	// partition functions, which need the entire history. If left nil,
+	// the history is checked as a single partition.
+	PartitionKey func(input interface{}) string
+	// If CompletePending is set, calls without returns at the end of an
+	// event stream are completed like [CompletePending] does, and
+	// otherwise they are an error.
+	CompletePending func(call Event) (value interface{}, include bool)
+	// MaxSegmentStates is the most states that the search reaches to
+	// find the states that a partition could be in when it's quiescent,
+	// before the checker keeps the operations for later instead. If it's
+	// 0, the limit is 100000.
+	MaxSegmentStates int
+}
+
+// A StreamPartition is the result of checking one partition of a stream.
+type StreamPartition struct {
+	Key    string
+	Result CheckResult
+	// Operations is the number of operations in the partition that
+	// were checked.
+	Operations int
+}
+
+// CheckEventStream checks whether a history of events is linearizable,
+// reading it from an iterator, and without holding all of it in memory: it
+// holds the calls that haven't returned, and the operations of each partition
+// since it was last quiescent, when all of the operations that were called in
+// it had returned. Histories whose partitions are often quiescent can be
+// checked in little memory, however long they are.
+//
+// Partitions are keyed by [StreamOptions.PartitionKey]; the model's partition
+// functions aren't used. The check stops at the first partition that isn't
+// linearizable, and returns the results of the partitions it checked, which
+// are Unknown for partitions that weren't checked to completion.
+//
+// Since the history isn't kept, there is no [LinearizationInfo] to visualize,
+// and the options that need one, or the entire history, such as snapshots,
+// coverage, search traces, and saved caches, aren't available; use
+// [CheckEventsWithOptions] for those. It returns an error if the iterator
+// does, or if the history is malformed, such as a return without a call.
+func CheckEventStream(model Model, events EventIterator, opts StreamOptions) (CheckResult, []StreamPartition, error) {
+	s := newStreamChecker(model, opts)
+	defer s.stop()
+	type call struct {
+		partition *streamPartition
+		event     Event
+		time      int64
+	}
+	calls := make(map[int]call)
+	var now int64
+	for ; ; now++ {
+		event, ok, err := events()
+		if err != nil {
+			return Unknown, s.results(), err
+		}
+		if !ok {
+			break
+		}
+		switch event.Kind {
+		case CallEvent:
+			if _, ok := calls[event.Id]; ok {
+				return Unknown, s.results(), fmt.Errorf("porcupine: duplicate call event for id %d at position %d", event.Id, now)
+			}
+			p := s.partition(event.Value)
+			p.open++
+			calls[event.Id] = call{p, event, now}
+		case ReturnEvent:
+			c, ok := calls[event.Id]
+			if !ok {
+				return Unknown, s.results(), fmt.Errorf("porcupine: return event for id %d at position %d has no call", event.Id, now)
+			}
+			delete(calls, event.Id)
+			c.partition.open--
+			s.add(c.partition, Operation{ClientId: c.event.ClientId, Input: c.event.Value, Call: c.time, Output: event.Value, Return: now})
+			if c.partition.open == 0 {
+				s.quiescent(c.partition)
+			}
+		}
+		if s.done() {
+			return s.finish()
+		}
+	}
+	if len(calls) > 0 && s.opts.CompletePending == nil {
+		return Unknown, s.results(), fmt.Errorf("porcupine: %d calls have no matching return (see StreamOptions.CompletePending)", len(calls))
+	}
+	// complete the calls in order, which is the order of their times
+	pending := make([]call, 0, len(calls))
+	for _, c := range calls {
+		pending = append(pending, c)
+	}
+	sort.Slice(pending, func(i, j int) bool { return pending[i].time < pending[j].time })
+	for _, c := range pending {
+		if value, include := s.opts.CompletePending(c.event); include {
+			s.add(c.partition, Operation{ClientId: c.event.ClientId, Input: c.event.Value, Call: c.time, Output: value, Return: now})
+			now++
+		}
+	}
+	return s.finish()
+}
+
+// CheckOperationStream checks whether a history of operations is
+// linearizable, reading it from an iterator, like [CheckEventStream]. The
+// operations must be in order of their calls, as recorded by a [Recorder],
+// so that the checker knows when a partition is quiescent: when an operation
+// is called after every operation before it in its partition returned.
+func CheckOperationStream(model Model, ops OperationIterator, opts StreamOptions) (CheckResult, []StreamPartition, error) {
+	s := newStreamChecker(model, opts)
+	defer s.stop()
+	for i := 0; ; i++ {
+		op, ok, err := ops()
+		if err != nil {
+			return Unknown, s.results(), err
+		}
+		if !ok {
+			break
+		}
+		if i > 0 && op.Call < s.lastCall {
+			return Unknown, s.results(), fmt.Errorf("porcupine: operation %d is called before the operation before it; operations must be in order of their calls", i)
+		}
+		s.lastCall = op.Call
+		p := s.partition(op.Input)
+		if len(p.ops) > 0 && p.lastReturn < op.Call {
+			s.quiescent(p)
+		}
+		s.add(p, op)
+		if op.Return > p.lastReturn {
+			p.lastReturn = op.Return
+		}
+		if s.done() {
+			return s.finish()
+		}
+	}
+	return s.finish()
+}
+
+// JSONLIterator returns an iterator over the events written by [WriteJSONL],
+// which reads them from r as they're needed, like [ReadJSONLFunc].
+func JSONLIterator(r io.Reader) EventIterator {
+	jr := newJSONLReader(r)
+	return jr.next
+}
+
+// HistoryIterator returns an iterator over the operations written by
+// [WriteHistory], which reads them from r as they're needed, like
+// [ReadHistory].
+func HistoryIterator(r io.Reader) OperationIterator {
+	hr := ReadHistory(r)
+	return func() (Operation, bool, error) {
+		if hr.Next() {
+			return hr.Operation(), true, nil
+		}
+		return Operation{}, false, hr.Err()
+	}
+}
+
+// A streamChecker holds the state of a streaming check.
+type streamChecker struct {
+	model      Model
+	opts       StreamOptions
+	fastType   reflect.Type
+	partitions map[string]*streamPartition
+	keys       []string // in order of their first operation
+	lastCall   int64
+	kill       int32
+	timer      *time.Timer
+	illegal    bool
+}
+
+// A streamPartition is the state of one partition of a streaming check.
+type streamPartition struct {
+	key        string
+	starts     []interface{} // the states it could be in when it was last quiescent
+	ops        []Operation   // the operations since then
+	checked    int
+	open       int   // calls that haven't returned, for events
+	lastReturn int64 // the latest return, for operations
+	// the number of operations to wait for before trying to find the
+	// states after ops again, after it exceeded MaxSegmentStates
+	retryAt int
+	result  CheckResult
+}
+
+func newStreamChecker(model Model, opts StreamOptions) *streamChecker {
+	s := &streamChecker{
+		opts:       opts,
+		partitions: make(map[string]*streamPartition),
+	}
+	s.fastType = fastStateType(model)
+	s.model = fillDefault(model)
+	if s.opts.MaxSegmentStates <= 0 {
+		s.opts.MaxSegmentStates = defaultMaxSegmentStates
+	}
+	if opts.Timeout > 0 {
+		s.timer = time.AfterFunc(opts.Timeout, func() { atomic.StoreInt32(&s.kill, 1) })
+	}
+	return s
+}
+
+func (s *streamChecker) stop() {
+	if s.timer != nil {
+		s.timer.Stop()
+	}
+}
+
+func (s *streamChecker) partition(input interface{}) *streamPartition {
+	key := ""
+	if s.opts.PartitionKey != nil {
+		key = s.opts.PartitionKey(input)
+	}
+	p, ok := s.partitions[key]
+	if !ok {
+		p = &streamPartition{key: key, starts: []interface{}{s.model.Init()}, retryAt: 1, result: Unknown}
+		s.partitions[key] = p
+		s.keys = append(s.keys, key)
+	}
+	return p
+}
+
+func (s *streamChecker) add(p *streamPartition, op Operation) {
+	if p.result == Illegal {
+		return
+	}
+	p.ops = append(p.ops, op)
+}
+
+// quiescent replaces the operations of a partition that is quiescent with
+// the states that they can lead to, if it can find all of them.
+func (s *streamChecker) quiescent(p *streamPartition) {
+	if p.result == Illegal || len(p.ops) < p.retryAt {
+		return
+	}
+	ends, ok := segmentEnds(s.model, s.fastType, p.ops, p.starts, s.opts.MaxSegmentStates, &s.kill)
+	if !ok {
+		p.retryAt = 2 * len(p.ops)
+		return
+	}
+	p.starts = ends
+	p.checked += len(p.ops)
+	p.ops = nil
+	p.retryAt = 1
+	if len(ends) == 0 {
+		p.result = Illegal
+		s.illegal = true
+	}
+}
+
+// done returns whether the check can stop, because a partition isn't
+// linearizable or it timed out.
+func (s *streamChecker) done() bool {
+	return s.illegal || atomic.LoadInt32(&s.kill) != 0
+}
+
+// finish checks the operations that are left in each partition.
+func (s *streamChecker) finish() (CheckResult, []StreamPartition, error) {
+	if !s.illegal {
+		var wg sync.WaitGroup
+		for _, p := range s.partitions {
+			wg.Add(1)
+			go func(p *streamPartition) {
+				defer wg.Done()
+				result := segmentResult(s.model, s.fastType, p.ops, p.starts, &s.kill)
+				if result == Unknown {
+					return
+				}
+				p.checked += len(p.ops)
+				p.ops = nil
+				p.result = result
+			}(p)
+		}
+		wg.Wait()
+	}
+	results := s.results()
+	result := Ok
+	for _, p := range results {
+		if p.Result == Illegal {
+			return Illegal, results, nil
+		}
+		if p.Result == Unknown {
+			result = Unknown
+		}
+	}
+	return result, results, nil
+}
+
+func (s *streamChecker) results() []StreamPartition {
+	results := make([]StreamPartition, len(s.keys))
+	for i, key := range s.keys {
+		p := s.partitions[key]
+		results[i] = StreamPartition{Key: key, Result: p.result, Operations: p.checked}
+	}
+	return results
+}
+
+// segmentEnds returns every state that a linearization of a segment of a
+// partition can lead to from one of the given states, or false if the search
+// reached more than limit states, where 0 means no limit, or if it was
+// killed, before it was done.
+func segmentEnds(model Model, fastType reflect.Type, ops []Operation, starts []interface{}, limit int, kill *int32) ([]interface{}, bool) {
+	if len(ops) == 0 {
+		return starts, true
+	}
+	ends := []interface{}{}
+	stats := &searchStats{}
+	checkSingle(model, makeEntries(ops), searchOptions{fastType: fastType, kill: kill, stats: stats, starts: starts, ends: &ends, maxStates: limit})
+	if atomic.LoadInt32(kill) != 0 || limit > 0 && stats.states > limit {
+		return nil, false
+	}
+	return ends, true
+}
+
+// segmentResult returns whether a segment of a partition has a linearization
+// from one of the given states, or Unknown if the search was killed first.
+func segmentResult(model Model, fastType reflect.Type, ops []Operation, starts []interface{}, kill *int32) CheckResult {
+	if len(ops) == 0 && len(starts) > 0 {
+		return Ok
+	}
+	ok, _ := checkSingle(model, makeEntries(ops), searchOptions{fastType: fastType, kill: kill, stats: &searchStats{}, starts: starts})
+	if ok {
+		return Ok
+	}
+	if atomic.LoadInt32(kill) != 0 {
+		return Unknown
+	}
+	return Illegal
+}
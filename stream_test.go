@@ -0,0 +1,217 @@
+package porcupine
+
+import (
+	"bytes"
+	"math/rand"
+	"sort"
+	"testing"
+)
+
+func kvPartitionKey(input interface{}) string {
+	return input.(kvInput).key
+}
+
+func eventIterator(events []Event) EventIterator {
+	return func() (Event, bool, error) {
+		if len(events) == 0 {
+			return Event{}, false, nil
+		}
+		event := events[0]
+		events = events[1:]
+		return event, true, nil
+	}
+}
+
+func operationIterator(ops []Operation) OperationIterator {
+	return func() (Operation, bool, error) {
+		if len(ops) == 0 {
+			return Operation{}, false, nil
+		}
+		op := ops[0]
+		ops = ops[1:]
+		return op, true, nil
+	}
+}
+
+func sortByCall(ops []Operation) []Operation {
+	sorted := append([]Operation(nil), ops...)
+	sort.SliceStable(sorted, func(i, j int) bool { return sorted[i].Call < sorted[j].Call })
+	return sorted
+}
+
+func testStreamDifferential(t *testing.T, model Model, key func(interface{}) string, keys []string, bad float64) {
+	for seed := int64(1); seed <= 50; seed++ {
+		rng := rand.New(rand.NewSource(seed))
+		history := sortByCall(randomKvHistory(rng, 1+rng.Intn(5), 20+rng.Intn(200), keys, bad))
+		expected := CheckOperations(model, history)
+		// a small limit makes the checker give up on some segments
+		opts := StreamOptions{PartitionKey: key, MaxSegmentStates: 1 + rng.Intn(200)}
+		res, _, err := CheckOperationStream(model, operationIterator(history), opts)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if (res == Ok) != expected {
+			t.Fatalf("seed %d: operation stream says %s, full check says %t", seed, res, expected)
+		}
+		res, _, err = CheckEventStream(model, eventIterator(OperationsToEvents(history)), opts)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if (res == Ok) != expected {
+			t.Fatalf("seed %d: event stream says %s, full check says %t", seed, res, expected)
+		}
+	}
+}
+
+func TestStreamRegister(t *testing.T) {
+	testStreamDifferential(t, kvNoPartitionModel, nil, []string{"x"}, 0)
+}
+
+func TestStreamRegisterBad(t *testing.T) {
+	testStreamDifferential(t, kvNoPartitionModel, nil, []string{"x"}, 0.05)
+}
+
+func TestStreamKv(t *testing.T) {
+	testStreamDifferential(t, kvModel, kvPartitionKey, []string{"x", "y", "z"}, 0)
+}
+
+func TestStreamKvBad(t *testing.T) {
+	testStreamDifferential(t, kvModel, kvPartitionKey, []string{"x", "y", "z"}, 0.02)
+}
+
+func TestStreamKvLogs(t *testing.T) {
+	for _, log := range []string{"c01-ok", "c01-bad", "c10-ok", "c10-bad"} {
+		events := parseKvLog("test_data/kv/" + log + ".txt")
+		expected := CheckEvents(kvModel, events)
+		res, partitions, err := CheckEventStream(kvModel, eventIterator(events), StreamOptions{PartitionKey: kvPartitionKey})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if (res == Ok) != expected {
+			t.Fatalf("%s: stream says %s, full check says %t", log, res, expected)
+		}
+		if expected {
+			ops := 0
+			for _, p := range partitions {
+				ops += p.Operations
+			}
+			if ops != len(events)/2 {
+				t.Fatalf("%s: checked %d operations, expected %d", log, ops, len(events)/2)
+			}
+		}
+	}
+}
+
+func TestStreamBoundsSegments(t *testing.T) {
+	// a sequential history is quiescent after every operation, so the
+	// checker never holds more than one of them
+	rng := rand.New(rand.NewSource(1))
+	history := sortByCall(randomKvHistory(rng, 1, 5000, []string{"x"}, 0))
+	s := newStreamChecker(kvModel, StreamOptions{})
+	defer s.stop()
+	for _, op := range history {
+		p := s.partition(op.Input)
+		if len(p.ops) > 0 && p.lastReturn < op.Call {
+			s.quiescent(p)
+		}
+		if len(p.ops) > 1 {
+			t.Fatalf("expected at most one operation in the segment, got %d", len(p.ops))
+		}
+		s.add(p, op)
+		p.lastReturn = op.Return
+	}
+	if res, _, _ := s.finish(); res != Ok {
+		t.Fatalf("expected the history to be linearizable, got %s", res)
+	}
+}
+
+func TestStreamUnsortedOperations(t *testing.T) {
+	history := []Operation{
+		{0, kvInput{op: 1, key: "x", value: "1"}, 5, kvOutput{}, 10},
+		{1, kvInput{op: 0, key: "x"}, 0, kvOutput{"1"}, 20},
+	}
+	if _, _, err := CheckOperationStream(kvModel, operationIterator(history), StreamOptions{}); err == nil {
+		t.Fatal("expected an error for operations out of order")
+	}
+}
+
+func TestStreamPending(t *testing.T) {
+	events := []Event{
+		{0, CallEvent, kvInput{op: 1, key: "x", value: "1"}, 0},
+		{1, CallEvent, kvInput{op: 0, key: "x"}, 1},
+		{1, ReturnEvent, kvOutput{"1"}, 1},
+		{2, CallEvent, kvInput{op: 0, key: "x"}, 2},
+		{3, CallEvent, kvInput{op: 1, key: "y", value: "2"}, 3},
+	}
+	if _, _, err := CheckEventStream(kvModel, eventIterator(events), StreamOptions{}); err == nil {
+		t.Fatal("expected an error for calls without returns")
+	}
+	for _, output := range []string{"1", "2"} {
+		makeReturn := func(call Event) (interface{}, bool) {
+			if call.Value.(kvInput).op == 0 {
+				return kvOutput{output}, true
+			}
+			return nil, false
+		}
+		expected := CheckEvents(kvModel, CompletePending(events, makeReturn))
+		res, _, err := CheckEventStream(kvModel, eventIterator(events), StreamOptions{PartitionKey: kvPartitionKey, CompletePending: makeReturn})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if (res == Ok) != expected {
+			t.Fatalf("read of %q: stream says %s, full check says %t", output, res, expected)
+		}
+	}
+}
+
+func TestStreamMalformed(t *testing.T) {
+	returnWithoutCall := []Event{
+		{0, CallEvent, kvInput{op: 0, key: "x"}, 0},
+		{0, ReturnEvent, kvOutput{""}, 1},
+	}
+	if _, _, err := CheckEventStream(kvModel, eventIterator(returnWithoutCall), StreamOptions{}); err == nil {
+		t.Fatal("expected an error for a return without a call")
+	}
+	duplicateCall := []Event{
+		{0, CallEvent, kvInput{op: 0, key: "x"}, 0},
+		{0, CallEvent, kvInput{op: 0, key: "x"}, 0},
+	}
+	if _, _, err := CheckEventStream(kvModel, eventIterator(duplicateCall), StreamOptions{}); err == nil {
+		t.Fatal("expected an error for a duplicate call")
+	}
+}
+
+func TestStreamReaders(t *testing.T) {
+	events := parseKvLog("test_data/kv/c10-bad.txt")
+	var jsonl bytes.Buffer
+	if err := WriteJSONL(&jsonl, events); err != nil {
+		t.Fatal(err)
+	}
+	res, _, err := CheckEventStream(kvModel, JSONLIterator(&jsonl), StreamOptions{PartitionKey: kvPartitionKey})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res != Illegal {
+		t.Fatalf("expected the history not to be linearizable, got %s", res)
+	}
+
+	ops, err := EventsToOperations(parseKvLog("test_data/kv/c10-ok.txt"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var binary bytes.Buffer
+	if err := WriteHistory(&binary, sortByCall(ops)); err != nil {
+		t.Fatal(err)
+	}
+	res, _, err = CheckOperationStream(kvModel, HistoryIterator(&binary), StreamOptions{PartitionKey: kvPartitionKey})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res != Ok {
+		t.Fatalf("expected the history to be linearizable, got %s", res)
+	}
+
+	if _, _, err := CheckEventStream(kvModel, JSONLIterator(bytes.NewBufferString("{\n")), StreamOptions{}); err == nil {
+		t.Fatal("expected an error for a malformed line")
+	}
+}
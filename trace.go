@@ -0,0 +1,160 @@
+package porcupine
+
+import (
+	"fmt"
+	"strings"
+)
+
+// defaultTraceLimit is the number of decisions recorded in a search trace if
+// CheckOptions.TraceLimit is 0.
+const defaultTraceLimit = 10000
+
+// A SearchOutcome is what the checker did with an operation that it tried
+// to linearize next.
+type SearchOutcome int
+
+const (
+	// SearchAccepted means that the model's Step function accepted the
+	// operation, and the search continued from the state it led to.
+	SearchAccepted SearchOutcome = iota
+	// SearchRejected means that the model's Step function returned false.
+	SearchRejected
+	// SearchRevisited means that the model's Step function accepted the
+	// operation, but the search had already reached the state it led to
+	// with the same set of operations linearized, so it didn't continue
+	// from it again.
+	SearchRevisited
+)
+
+func (o SearchOutcome) String() string {
+	switch o {
+	case SearchAccepted:
+		return "accepted"
+	case SearchRejected:
+		return "rejected"
+	case SearchRevisited:
+		return "revisited"
+	}
+	return fmt.Sprintf("SearchOutcome(%d)", int(o))
+}
+
+// A SearchDecision is one attempt of the checker to linearize an operation
+// next, as recorded in a [SearchTrace].
+type SearchDecision struct {
+	// Id is the index of the operation in its partition.
+	Id int
+	// Operation is the description of the operation, and State and
+	// NextState are the descriptions of the state it was applied to and
+	// of the state it led to, as described by the model. NextState is
+	// empty if the operation was rejected.
+	Operation string
+	State     string
+	NextState string
+	Outcome   SearchOutcome
+	// Children are the decisions made after an accepted operation, in
+	// the order in which they were made.
+	Children []*SearchDecision
+}
+
+// A SearchTrace is the tree of decisions that the checker made while
+// searching for a linearization of one partition, as recorded with the
+// TraceSearch option.
+type SearchTrace struct {
+	Partition int
+	// Decisions are the decisions made from the initial state.
+	Decisions []*SearchDecision
+	// Count is the number of decisions in the trace, and Truncated is
+	// true if the search made more decisions than it was allowed to
+	// record (see CheckOptions.TraceLimit).
+	Count     int
+	Truncated bool
+}
+
+// String returns the trace as text, one decision per line, with the
+// decisions made after each accepted operation indented below it.
+func (t *SearchTrace) String() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "partition %d: %d decisions", t.Partition, t.Count)
+	if t.Truncated {
+		b.WriteString(" (truncated)")
+	}
+	b.WriteByte('\n')
+	var write func(decisions []*SearchDecision, depth int)
+	write = func(decisions []*SearchDecision, depth int) {
+		for _, d := range decisions {
+			b.WriteString(strings.Repeat("  ", depth))
+			fmt.Fprintf(&b, "%s [%d] %s: %s", d.Outcome, d.Id, d.Operation, d.State)
+			if d.Outcome != SearchRejected {
+				fmt.Fprintf(&b, " -> %s", d.NextState)
+			}
+			b.WriteByte('\n')
+			write(d.Children, depth+1)
+		}
+	}
+	write(t.Decisions, 0)
+	return b.String()
+}
+
+// SearchTrace returns the trace of the search for a linearization of the
+// given partition, or nil if the check did not trace it (see
+// CheckOptions.TraceSearch).
+func (li LinearizationInfo) SearchTrace(partition int) *SearchTrace {
+	if partition < 0 || partition >= len(li.traces) {
+		return nil
+	}
+	return li.traces[partition]
+}
+
+// A searchTracer records the decisions made by checkSingle into a trace, up
+// to a limit.
+type searchTracer struct {
+	model Model
+	limit int
+	trace *SearchTrace
+	path  []*SearchDecision // the accepted decisions that led to the current state
+}
+
+func newSearchTracer(model Model, partition int, limit int) *searchTracer {
+	if limit <= 0 {
+		limit = defaultTraceLimit
+	}
+	return &searchTracer{model: model, limit: limit, trace: &SearchTrace{Partition: partition}}
+}
+
+// record records a decision made from the current state. Once the limit is
+// reached, it marks the trace as truncated and stops recording.
+func (t *searchTracer) record(id int, input, output, state, nextState interface{}, outcome SearchOutcome) {
+	if t.trace.Truncated {
+		return
+	}
+	if t.trace.Count >= t.limit {
+		t.trace.Truncated = true
+		return
+	}
+	t.trace.Count++
+	d := &SearchDecision{
+		Id:        id,
+		Operation: t.model.DescribeOperation(input, output),
+		State:     t.model.DescribeState(state),
+		Outcome:   outcome,
+	}
+	if outcome != SearchRejected {
+		d.NextState = t.model.DescribeState(nextState)
+	}
+	if len(t.path) == 0 {
+		t.trace.Decisions = append(t.trace.Decisions, d)
+	} else {
+		parent := t.path[len(t.path)-1]
+		parent.Children = append(parent.Children, d)
+	}
+	if outcome == SearchAccepted {
+		t.path = append(t.path, d)
+	}
+}
+
+// backtrack records that the search undid the last accepted decision.
+func (t *searchTracer) backtrack() {
+	if !t.trace.Truncated {
+		t.path = t.path[:len(t.path)-1]
+	}
+}
@@ -0,0 +1,64 @@
+package porcupine
+
+import (
+	"testing"
+)
+
+func TestSearchTrace(t *testing.T) {
+	ops := []Operation{
+		{0, registerInput{false, 1}, 0, 0, 10},
+		{1, registerInput{false, 1}, 5, 0, 15},
+		{2, registerInput{true, 0}, 20, 3, 30},
+	}
+	// both puts write the same value, so the second order of the puts
+	// reaches a state that the first one already explored
+	res, info := CheckOperationsWithOptions(registerModel, ops, CheckOptions{TraceSearch: true})
+	if res != Illegal {
+		t.Fatalf("expected output %v, got output %v", Illegal, res)
+	}
+	trace := info.SearchTrace(0)
+	if trace == nil {
+		t.Fatal("expected a trace")
+	}
+	expected := `partition 0: 5 decisions
+accepted [0] put('1'): 0 -> 1
+  accepted [1] put('1'): 1 -> 1
+    rejected [2] get() -> '3': 1
+accepted [1] put('1'): 0 -> 1
+  revisited [0] put('1'): 1 -> 1
+`
+	if s := trace.String(); s != expected {
+		t.Fatalf("expected trace:\n%s\ngot:\n%s", expected, s)
+	}
+	if info.SearchTrace(1) != nil || info.SearchTrace(-1) != nil {
+		t.Fatal("expected no trace for partitions that don't exist")
+	}
+
+	_, info = CheckOperationsWithOptions(registerModel, ops, CheckOptions{TraceSearch: true, TraceLimit: 2})
+	if trace := info.SearchTrace(0); trace.Count != 2 || !trace.Truncated || len(trace.Decisions) != 1 || len(trace.Decisions[0].Children) != 1 {
+		t.Fatalf("unexpected trace:\n%v", trace)
+	}
+
+	_, info = CheckOperationsWithOptions(registerModel, ops, CheckOptions{})
+	if info.SearchTrace(0) != nil {
+		t.Fatal("expected no trace")
+	}
+}
+
+func TestSearchTracePartition(t *testing.T) {
+	ops, err := EventsToOperations(parseKvLog("test_data/kv/c01-bad.txt"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	partitions := len(kvModel.Partition(ops))
+	_, info := CheckOperationsWithOptions(kvModel, ops, CheckOptions{TraceSearch: true, TracePartition: partitions - 1})
+	for i := 0; i < partitions-1; i++ {
+		if info.SearchTrace(i) != nil {
+			t.Fatalf("expected no trace for partition %d", i)
+		}
+	}
+	trace := info.SearchTrace(partitions - 1)
+	if trace == nil || trace.Partition != partitions-1 || trace.Count == 0 {
+		t.Fatalf("unexpected trace %v", trace)
+	}
+}
@@ -0,0 +1,164 @@
+package porcupine
+
+import (
+	"fmt"
+	"sort"
+)
+
+// A Severity is the severity of a [HistoryIssue].
+type Severity int
+
+const (
+	// SeverityInfo marks issues that are likely intended, but are worth
+	// knowing about.
+	SeverityInfo Severity = iota
+	// SeverityWarning marks issues that don't prevent checking the
+	// history, but that suggest that it was recorded incorrectly.
+	SeverityWarning
+	// SeverityError marks issues that make the history malformed, so that
+	// the result of checking it is meaningless.
+	SeverityError
+)
+
+func (s Severity) String() string {
+	switch s {
+	case SeverityInfo:
+		return "info"
+	case SeverityWarning:
+		return "warning"
+	case SeverityError:
+		return "error"
+	default:
+		return fmt.Sprintf("Severity(%d)", int(s))
+	}
+}
+
+// A HistoryIssue is a problem found by [ValidateHistory] or
+// [ValidateEvents].
+type HistoryIssue struct {
+	Severity Severity
+	// Index is the index of the operation or event with the issue.
+	Index   int
+	Message string
+}
+
+func (i HistoryIssue) String() string {
+	return fmt.Sprintf("%s: %d: %s", i.Severity, i.Index, i.Message)
+}
+
+// ValidateHistory looks for problems in a history of operations, so that they
+// can be fixed before checking it. It reports:
+//
+//   - operations that return before they are called (error)
+//   - negative timestamps (warning)
+//   - operations of a client that overlap with another operation of the same
+//     client, which suggests that client ids are wrong (warning)
+//   - operations with a nil input (warning)
+//   - operations with a nil output, which are pending (info)
+//
+// The issues are ordered by index.
+func ValidateHistory(ops []Operation) []HistoryIssue {
+	var issues []HistoryIssue
+	add := func(severity Severity, index int, format string, args ...interface{}) {
+		issues = append(issues, HistoryIssue{severity, index, fmt.Sprintf(format, args...)})
+	}
+	clientOps := make(map[int][]int)
+	for i, op := range ops {
+		if op.Return < op.Call {
+			add(SeverityError, i, "operation returns at %d, before it is called at %d", op.Return, op.Call)
+		}
+		if op.Call < 0 || op.Return < 0 {
+			add(SeverityWarning, i, "operation has a negative timestamp (call %d, return %d)", op.Call, op.Return)
+		}
+		if op.Input == nil {
+			add(SeverityWarning, i, "operation has a nil input")
+		}
+		if op.Output == nil {
+			add(SeverityInfo, i, "operation has a nil output, so it is pending, and the model must accept a nil output")
+		}
+		clientOps[op.ClientId] = append(clientOps[op.ClientId], i)
+	}
+	for client, indices := range clientOps {
+		sort.SliceStable(indices, func(a, b int) bool {
+			return ops[indices[a]].Call < ops[indices[b]].Call
+		})
+		// track the operation that returns last so far, so an operation
+		// that overlaps with an earlier long one is reported
+		last := -1
+		for _, i := range indices {
+			if last != -1 && ops[i].Call < ops[last].Return {
+				add(SeverityWarning, i, "operation overlaps with operation %d of the same client %d", last, client)
+			}
+			if last == -1 || ops[i].Return > ops[last].Return {
+				last = i
+			}
+		}
+	}
+	sortIssues(issues)
+	return issues
+}
+
+// ValidateEvents looks for problems in a history of events, like
+// [ValidateHistory] does for operations. It reports:
+//
+//   - calls or returns with an Id that is already used by another call or
+//     return (error)
+//   - returns without a preceding call (error)
+//   - returns with a different client than their call (warning)
+//   - calls of a client while another operation of the same client is in
+//     progress, which suggests that client ids are wrong (warning)
+//   - calls without a return (info)
+//
+// The issues are ordered by index.
+func ValidateEvents(events []Event) []HistoryIssue {
+	var issues []HistoryIssue
+	add := func(severity Severity, index int, format string, args ...interface{}) {
+		issues = append(issues, HistoryIssue{severity, index, fmt.Sprintf(format, args...)})
+	}
+	calls := make(map[int]int)      // from id to index of call
+	returns := make(map[int]int)    // from id to index of return
+	inProgress := make(map[int]int) // from client to id of its operation in progress
+	for i, event := range events {
+		if event.Kind == CallEvent {
+			if j, ok := calls[event.Id]; ok {
+				add(SeverityError, i, "call has id %d, which is already used by the call at %d", event.Id, j)
+				continue
+			}
+			calls[event.Id] = i
+			if id, ok := inProgress[event.ClientId]; ok {
+				add(SeverityWarning, i, "call of client %d while its operation with id %d is in progress", event.ClientId, id)
+			}
+			inProgress[event.ClientId] = event.Id
+			continue
+		}
+		if j, ok := returns[event.Id]; ok {
+			add(SeverityError, i, "return has id %d, which is already used by the return at %d", event.Id, j)
+			continue
+		}
+		j, ok := calls[event.Id]
+		if !ok {
+			add(SeverityError, i, "return with id %d has no preceding call", event.Id)
+			continue
+		}
+		returns[event.Id] = i
+		if client := events[j].ClientId; client != event.ClientId {
+			add(SeverityWarning, i, "return has client %d, but its call at %d has client %d", event.ClientId, j, client)
+		}
+		if id, ok := inProgress[events[j].ClientId]; ok && id == event.Id {
+			delete(inProgress, events[j].ClientId)
+		}
+	}
+	for id, i := range calls {
+		if _, ok := returns[id]; !ok {
+			add(SeverityInfo, i, "call with id %d has no return", id)
+		}
+	}
+	sortIssues(issues)
+	return issues
+}
+
+func sortIssues(issues []HistoryIssue) {
+	sort.SliceStable(issues, func(i, j int) bool {
+		return issues[i].Index < issues[j].Index
+	})
+}
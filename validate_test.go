@@ -0,0 +1,77 @@
+package porcupine
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+)
+
+func formatIssues(issues []HistoryIssue) string {
+	var lines []string
+	for _, issue := range issues {
+		lines = append(lines, issue.String())
+	}
+	return strings.Join(lines, "\n")
+}
+
+func TestValidateHistory(t *testing.T) {
+	ops := []Operation{
+		{0, registerInput{false, 1}, 0, 0, 100},
+		{0, registerInput{true, 0}, 50, 1, 60},     // overlaps with 0
+		{1, registerInput{true, 0}, 30, 1, 20},     // returns before call
+		{2, nil, -10, 0, 5},                        // nil input, negative time
+		{3, registerInput{true, 0}, 200, nil, 300}, // pending
+		{0, registerInput{true, 0}, 90, 1, 110},    // overlaps with 0
+	}
+	expected := strings.Join([]string{
+		"warning: 1: operation overlaps with operation 0 of the same client 0",
+		"error: 2: operation returns at 20, before it is called at 30",
+		"warning: 3: operation has a negative timestamp (call -10, return 5)",
+		"warning: 3: operation has a nil input",
+		"info: 4: operation has a nil output, so it is pending, and the model must accept a nil output",
+		"warning: 5: operation overlaps with operation 0 of the same client 0",
+	}, "\n")
+	if got := formatIssues(ValidateHistory(ops)); got != expected {
+		t.Fatalf("expected\n%s\ngot\n%s", expected, got)
+	}
+}
+
+func TestValidateEvents(t *testing.T) {
+	events := []Event{
+		{0, CallEvent, 0, 0},
+		{0, CallEvent, 0, 1}, // client 0 already has an operation in progress
+		{1, CallEvent, 0, 1}, // duplicate call id
+		{0, ReturnEvent, 0, 0},
+		{1, ReturnEvent, 0, 1}, // different client than the call
+		{1, ReturnEvent, 0, 1}, // duplicate return id
+		{2, ReturnEvent, 0, 7}, // no call
+		{3, CallEvent, 0, 8},   // no return
+	}
+	expected := strings.Join([]string{
+		"warning: 1: call of client 0 while its operation with id 0 is in progress",
+		"error: 2: call has id 1, which is already used by the call at 1",
+		"warning: 4: return has client 1, but its call at 1 has client 0",
+		"error: 5: return has id 1, which is already used by the return at 4",
+		"error: 6: return with id 7 has no preceding call",
+		"info: 7: call with id 8 has no return",
+	}, "\n")
+	if got := formatIssues(ValidateEvents(events)); got != expected {
+		t.Fatalf("expected\n%s\ngot\n%s", expected, got)
+	}
+}
+
+func TestValidateTestData(t *testing.T) {
+	for _, logName := range []string{"c01-ok", "c10-ok"} {
+		events := parseKvLog(fmt.Sprintf("test_data/kv/%s.txt", logName))
+		if issues := ValidateEvents(events); len(issues) != 0 {
+			t.Fatalf("%s: expected no issues, got\n%s", logName, formatIssues(issues))
+		}
+		ops, err := EventsToOperations(events)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if issues := ValidateHistory(ops); len(issues) != 0 {
+			t.Fatalf("%s: expected no issues, got\n%s", logName, formatIssues(issues))
+		}
+	}
+}
@@ -1,12 +1,20 @@
 package porcupine
 
 import (
+	"compress/gzip"
 	"embed"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"html/template"
 	"io"
+	"math"
 	"os"
+	"path/filepath"
 	"sort"
+	"strings"
+	"time"
+	"unicode/utf8"
 )
 
 type historyElement struct {
@@ -14,26 +22,279 @@ type historyElement struct {
 	Start       int64
 	End         int64
 	Description string
+	Color       string `json:",omitempty"`
+	// untruncated description, only set if the description was truncated
+	// and the full description was requested
+	FullDescription string `json:",omitempty"`
+	// serialized input and output, from the model's SerializeOperation
+	Raw json.RawMessage `json:",omitempty"`
+	// description from the model, only set if the description was
+	// rewritten and the original description was requested
+	OriginalDescription string `json:",omitempty"`
+}
+
+// HistoryElementInfo describes an operation in a history, as passed to
+// VisualizationOptions.RewriteDescription.
+type HistoryElementInfo struct {
+	ClientId    int
+	Start       int64 // invocation time
+	End         int64 // response time
+	Input       interface{}
+	Output      interface{}
+	Description string // description from the model's DescribeOperation
 }
 
 type linearizationStep struct {
 	Index            int
 	StateDescription string
+	// number of candidate states, for models produced by
+	// NondeterministicModel.ToModel
+	Candidates int `json:",omitempty"`
 }
 
 type partialLinearization = []linearizationStep
 
+// An overview is a downsampled summary of a partition's history, used to draw
+// a minimap. Bucket i covers the times [Start + i*BucketWidth, Start +
+// (i+1)*BucketWidth).
+type overview struct {
+	Start        int64
+	BucketWidth  int64
+	Counts       []int  // number of operations overlapping each bucket
+	Unlinearized []bool // whether a bucket overlaps an operation that isn't in the longest linearization
+}
+
 type partitionVisualizationData struct {
 	History               []historyElement
 	PartialLinearizations []partialLinearization
 	Largest               map[int]int
+	// index of the longest partial linearization, which is selected by
+	// default, or -1 if there are no partial linearizations
+	DefaultSelected int
+	// index of the first history element that could not be linearized
+	// after the default partial linearization, or -1 if the default
+	// partial linearization is complete
+	FirstIllegal int
+	Overview     *overview `json:",omitempty"`
+	// sorted list of the clients that appear in the partition
+	Clients []int
+	// index into Clients of the client of each history element
+	ClientIndex []int
+	// display names of the clients, in the same order as Clients, if
+	// client names were provided
+	ClientNames []string `json:",omitempty"`
+}
+
+// A visualizationSummary describes the overall result of a check, and it is
+// shown in a banner at the top of the visualization.
+type visualizationSummary struct {
+	Result CheckResult
+	// whether the result was computed from the linearization info rather
+	// than supplied by the caller
+	ResultComputed       bool `json:",omitempty"`
+	Operations           int
+	Partitions           int
+	LinearizedPartitions int
+	// checker wall time, if supplied by the caller
+	Duration time.Duration `json:",omitempty"`
+}
+
+type visualizationData struct {
+	// unit of the timestamps in the history, if known
+	TimeUnit   TimeUnit `json:",omitempty"`
+	Summary    visualizationSummary
+	Partitions []partitionVisualizationData
+	// for visualizations written by VisualizeDir, the files containing
+	// the partitions, which are loaded on demand; Partitions is empty
+	Shards []visualizationShard `json:",omitempty"`
+}
+
+type visualizationShard struct {
+	File       string // path relative to the index
+	Operations int
+	Linearized bool
+}
+
+// A TimeUnit is the unit of the timestamps in a history, used to label times
+// in visualizations.
+type TimeUnit string
+
+const (
+	Nanoseconds  TimeUnit = "ns"
+	Microseconds TimeUnit = "µs"
+	Milliseconds TimeUnit = "ms"
+	Seconds      TimeUnit = "s"
+	// Logical timestamps, such as operation or event indices, which
+	// don't correspond to durations.
+	Logical TimeUnit = "logical"
+)
+
+// duration returns the duration of one unit of time, or 0 if the unit isn't
+// a unit of time.
+func (u TimeUnit) duration() time.Duration {
+	switch u {
+	case Nanoseconds:
+		return time.Nanosecond
+	case Microseconds:
+		return time.Microsecond
+	case Milliseconds:
+		return time.Millisecond
+	case Seconds:
+		return time.Second
+	default:
+		return 0
+	}
+}
+
+// describeTimes describes when an operation was called and returned, and how
+// long it lasted if the times are in a unit of time.
+func (u TimeUnit) describeTimes(start, end int64) string {
+	if d := u.duration(); d != 0 {
+		return fmt.Sprintf("call: %d%s, return: %d%s, lasted %v", start, u, end, u, time.Duration(end-start)*d)
+	}
+	return fmt.Sprintf("call: %d, return: %d", start, end)
+}
+
+// VisualizationOptions configures the output of [VisualizeWithOptions]. The
+// zero value gives the defaults used by [Visualize].
+type VisualizationOptions struct {
+	// Number of time buckets in the overview strip (minimap) that is shown
+	// at the bottom of the page. If zero, a default of 1000 buckets is
+	// used; if negative, no overview is computed.
+	OverviewBuckets int
+	// Maximum length of operation descriptions, in runes. Longer
+	// descriptions are truncated and end with an ellipsis ("…"), which
+	// counts towards the limit. If zero, descriptions are not truncated.
+	//
+	// This also limits the length of serialized operations (see
+	// Model.SerializeOperation): serialized operations that are too long
+	// are replaced by a JSON string containing the truncated text.
+	MaxDescriptionLength int
+	// If set, operations whose descriptions were truncated due to
+	// MaxDescriptionLength also include the full description, which is
+	// shown in the tooltip.
+	KeepFullDescriptions bool
+	// Template used to render the visualization. If nil, the template
+	// returned by [DefaultVisualizationTemplate] is used. The template is
+	// executed with a [VisualizationTemplateData].
+	Template *template.Template
+	// If set, the output is gzip-compressed. [VisualizePathWithOptions]
+	// also compresses the output if the path ends in ".gz".
+	Compress bool
+	// Result of the check, which is shown in the summary at the top of the
+	// visualization. If empty, the result is computed from the
+	// linearization info: Ok if every partition was fully linearized, and
+	// Illegal otherwise. Note that the computed result can't distinguish
+	// an Illegal result from an Unknown one due to a timeout.
+	Result CheckResult
+	// Wall time taken by the check, which is shown in the summary. If
+	// zero, it is omitted.
+	CheckDuration time.Duration
+	// Display names of clients, by client ID. Clients that don't have a
+	// name are shown by their ID.
+	ClientNames map[int]string
+	// If set, the visualization is a static, print-friendly page without
+	// any scripting, where the layout is computed ahead of time. Instead of
+	// showing linearizations interactively, each operation that is part of
+	// the longest partial linearization of its partition is labeled with
+	// its position in that linearization. The Template option is ignored.
+	StaticLayout bool
+	// Unit of the timestamps in the history. If set to a unit of time, the
+	// visualization shows times with their unit, along with how long each
+	// operation lasted. If Logical or empty, times are shown as plain
+	// integers. The unit is also recorded in the visualization data so
+	// that other tools can interpret the timestamps.
+	TimeUnit TimeUnit
+	// If set, the visualization also includes a table for each partition
+	// listing its operations, for screen readers and for searching
+	// visualizations as text. This roughly doubles the size of the output.
+	// Descriptions are truncated according to MaxDescriptionLength. Tables
+	// are not included in visualizations written by [VisualizeDir].
+	AccessibleTables bool
+	// If set, this function is called for each operation after the
+	// model's DescribeOperation, and a non-empty return value replaces the
+	// operation's description. This can be used to add information that
+	// isn't available to the model, without changing the model.
+	RewriteDescription func(elem HistoryElementInfo) string
+	// If set, operations whose descriptions were rewritten by
+	// RewriteDescription also include the model's description, which is
+	// shown in the tooltip.
+	KeepOriginalDescriptions bool
+	// If set, [VisualizePathWithOptions] creates the parent directories of
+	// the path if they don't exist.
+	CreateDirs bool
+}
+
+// VisualizationTemplateData is the data passed to the template that renders a
+// visualization (see [VisualizationOptions]).
+//
+// The default template includes CSS in a <style> element and JS followed by
+// "const data = {{.Data}}" and "render(data)" in a <script> element; custom
+// templates should do the same for the visualization to work.
+type VisualizationTemplateData struct {
+	CSS  template.CSS // stylesheet for the visualization
+	JS   template.JS  // code that defines the render function
+	Data template.JS  // visualization data, as a JSON value
+	// tables of operations, if enabled with
+	// VisualizationOptions.AccessibleTables
+	Tables template.HTML
+}
+
+// DefaultVisualizationTemplate returns a new copy of the built-in template
+// used to render visualizations.
+//
+// The template defines empty "head", "header", and "footer" blocks, placed at
+// the end of the <head> element, the start of the <body> element, and after
+// the visualization, respectively. These can be redefined to customize the
+// output without having to copy the entire template, for example:
+//
+//	tmpl := template.Must(porcupine.DefaultVisualizationTemplate().Parse(
+//		`{{define "header"}}<h1>Nightly run</h1>{{end}}`))
+func DefaultVisualizationTemplate() *template.Template {
+	return template.Must(template.ParseFS(visualizationFS, "visualization/index.html"))
 }
 
-type visualizationData = []partitionVisualizationData
+const defaultOverviewBuckets = 1000
 
-func computeVisualizationData(model Model, info LinearizationInfo) visualizationData {
+// computeOverview summarizes a history into at most buckets time buckets
+// spanning the times [start, end]. All partitions of a visualization use the
+// same start and end so that their buckets line up.
+func computeOverview(history []historyElement, linearized []bool, start, end int64, buckets int) *overview {
+	// there are d+1 times, which doesn't fit in a uint64 when they run
+	// from math.MinInt64 to math.MaxInt64, so the width of a bucket,
+	// (d+1)/buckets rounded up, is computed as d/buckets+1, and kept to
+	// what fits in BucketWidth
+	d := uint64(end - start)
+	width := uint64(math.MaxInt64)
+	if q := d / uint64(buckets); q < math.MaxInt64 {
+		width = q + 1
+	}
+	n := int(d/width + 1)
+	o := &overview{
+		Start:        start,
+		BucketWidth:  int64(width),
+		Counts:       make([]int, n),
+		Unlinearized: make([]bool, n),
+	}
+	for i, elem := range history {
+		first := int(uint64(elem.Start-start) / width)
+		last := first
+		if elem.End > elem.Start {
+			last = int(uint64(elem.End-start) / width)
+		}
+		for b := first; b <= last; b++ {
+			o.Counts[b]++
+			if !linearized[i] {
+				o.Unlinearized[b] = true
+			}
+		}
+	}
+	return o
+}
+
+func computeVisualizationData(model Model, info LinearizationInfo, opts VisualizationOptions) visualizationData {
 	model = fillDefault(model)
-	data := make(visualizationData, len(info.history))
+	partitions := make([]partitionVisualizationData, len(info.history))
 	for partition := 0; partition < len(info.history); partition++ {
 		// history
 		n := len(info.history[partition]) / 2
@@ -48,7 +309,34 @@ func computeVisualizationData(model Model, info LinearizationInfo) visualization
 				callValue[elem.id] = elem.value
 			case returnEntry:
 				history[elem.id].End = elem.time
-				history[elem.id].Description = model.DescribeOperation(callValue[elem.id], elem.value)
+				desc := model.DescribeOperation(callValue[elem.id], elem.value)
+				if opts.RewriteDescription != nil {
+					rewritten := opts.RewriteDescription(HistoryElementInfo{
+						ClientId:    history[elem.id].ClientId,
+						Start:       history[elem.id].Start,
+						End:         elem.time,
+						Input:       callValue[elem.id],
+						Output:      elem.value,
+						Description: desc,
+					})
+					if rewritten != "" && rewritten != desc {
+						if opts.KeepOriginalDescriptions {
+							history[elem.id].OriginalDescription, _ = truncateDescription(desc, opts.MaxDescriptionLength)
+						}
+						desc = rewritten
+					}
+				}
+				truncated, ok := truncateDescription(desc, opts.MaxDescriptionLength)
+				history[elem.id].Description = truncated
+				if ok && opts.KeepFullDescriptions {
+					history[elem.id].FullDescription = desc
+				}
+				if model.DescribeOperationColor != nil {
+					history[elem.id].Color = model.DescribeOperationColor(callValue[elem.id], elem.value)
+				}
+				if model.SerializeOperation != nil {
+					history[elem.id].Raw = truncateRaw(model.SerializeOperation(callValue[elem.id], elem.value), opts.MaxDescriptionLength)
+				}
 				returnValue[elem.id] = elem.value
 			}
 		}
@@ -57,8 +345,13 @@ func computeVisualizationData(model Model, info LinearizationInfo) visualization
 		largestSize := make(map[int]int)
 		linearizations := make([]partialLinearization, len(info.partialLinearizations[partition]))
 		partials := info.partialLinearizations[partition]
+		// longest first; the partial linearizations come from a set, so
+		// break ties deterministically to keep the output stable
 		sort.Slice(partials, func(i, j int) bool {
-			return len(partials[i]) > len(partials[j])
+			if len(partials[i]) != len(partials[j]) {
+				return len(partials[i]) > len(partials[j])
+			}
+			return lessInts(partials[i], partials[j])
 		})
 		for i, partial := range partials {
 			linearization := make(partialLinearization, len(partial))
@@ -70,7 +363,7 @@ func computeVisualizationData(model Model, info LinearizationInfo) visualization
 					panic("valid partial linearization returned non-ok result from model step")
 				}
 				stateDesc := model.DescribeState(state)
-				linearization[j] = linearizationStep{histId, stateDesc}
+				linearization[j] = linearizationStep{histId, stateDesc, candidateCount(state)}
 				if largestSize[histId] < len(partial) {
 					largestSize[histId] = len(partial)
 					largestIndex[histId] = i
@@ -78,13 +371,261 @@ func computeVisualizationData(model Model, info LinearizationInfo) visualization
 			}
 			linearizations[i] = linearization
 		}
-		data[partition] = partitionVisualizationData{
+		selected := longestLinearization(partials)
+		var selectedPartial []int // if there are no partial linearizations, nothing could be linearized
+		if selected >= 0 {
+			selectedPartial = partials[selected]
+		}
+		firstIllegal := firstIllegalNext(model, history, selectedPartial, callValue, returnValue)
+		clients, clientIndex, clientNames := computeClients(history, opts.ClientNames)
+		partitions[partition] = partitionVisualizationData{
 			History:               history,
 			PartialLinearizations: linearizations,
 			Largest:               largestIndex,
+			DefaultSelected:       selected,
+			FirstIllegal:          firstIllegal,
+			Clients:               clients,
+			ClientIndex:           clientIndex,
+			ClientNames:           clientNames,
+		}
+	}
+	sortPartitions(partitions)
+	buckets := opts.OverviewBuckets
+	if buckets == 0 {
+		buckets = defaultOverviewBuckets
+	}
+	if buckets > 0 {
+		addOverviews(partitions, buckets)
+	}
+	return visualizationData{
+		TimeUnit:   opts.TimeUnit,
+		Summary:    computeSummary(partitions, opts),
+		Partitions: partitions,
+	}
+}
+
+func computeSummary(partitions []partitionVisualizationData, opts VisualizationOptions) visualizationSummary {
+	summary := visualizationSummary{
+		Result:     opts.Result,
+		Partitions: len(partitions),
+		Duration:   opts.CheckDuration,
+	}
+	for _, partition := range partitions {
+		summary.Operations += len(partition.History)
+		if partition.FirstIllegal == -1 {
+			summary.LinearizedPartitions++
+		}
+	}
+	if summary.Result == "" {
+		summary.ResultComputed = true
+		if summary.LinearizedPartitions == summary.Partitions {
+			summary.Result = Ok
+		} else {
+			summary.Result = Illegal
 		}
 	}
-	return data
+	return summary
+}
+
+// longestLinearization returns the index of the longest partial
+// linearization, breaking ties by choosing the lowest index, or -1 if there
+// are none.
+func longestLinearization(partials [][]int) int {
+	longest := -1
+	for i, partial := range partials {
+		if longest == -1 || len(partial) > len(partials[longest]) {
+			longest = i
+		}
+	}
+	return longest
+}
+
+// firstIllegalNext returns the first history element (by start time, then
+// index) that could be linearized next after the given partial linearization
+// in terms of real-time order but is rejected by the model, or -1 if the
+// partial linearization is complete. If no such element is rejected by the
+// model, meaning that the search hit a dead end later on, the first element
+// that could be linearized next is returned.
+func firstIllegalNext(model Model, history []historyElement, partial []int, callValue, returnValue map[int]interface{}) int {
+	if len(partial) == len(history) {
+		return -1
+	}
+	included := make([]bool, len(history))
+	state := model.Init()
+	for _, id := range partial {
+		included[id] = true
+		_, state = model.Step(state, callValue[id], returnValue[id])
+	}
+	// an element can be linearized next if it starts before every
+	// element that hasn't been linearized ends
+	var minEnd int64
+	first := true
+	for i, elem := range history {
+		if !included[i] && (first || elem.End < minEnd) {
+			minEnd = elem.End
+			first = false
+		}
+	}
+	var candidates []int
+	for i, elem := range history {
+		if !included[i] && elem.Start <= minEnd {
+			candidates = append(candidates, i)
+		}
+	}
+	sort.SliceStable(candidates, func(i, j int) bool {
+		return history[candidates[i]].Start < history[candidates[j]].Start
+	})
+	for _, id := range candidates {
+		if ok, _ := model.Step(state, callValue[id], returnValue[id]); !ok {
+			return id
+		}
+	}
+	return candidates[0]
+}
+
+// computeClients returns the sorted list of clients that appear in a history,
+// the index into that list of the client of each history element, and the
+// names of the clients if names were given.
+func computeClients(history []historyElement, names map[int]string) ([]int, []int, []string) {
+	seen := make(map[int]bool)
+	clients := []int{}
+	for _, elem := range history {
+		if !seen[elem.ClientId] {
+			seen[elem.ClientId] = true
+			clients = append(clients, elem.ClientId)
+		}
+	}
+	sort.Ints(clients)
+	position := make(map[int]int, len(clients))
+	for i, client := range clients {
+		position[client] = i
+	}
+	clientIndex := make([]int, len(history))
+	for i, elem := range history {
+		clientIndex[i] = position[elem.ClientId]
+	}
+	var clientNames []string
+	if names != nil {
+		clientNames = make([]string, len(clients))
+		for i, client := range clients {
+			clientNames[i] = names[client]
+		}
+	}
+	return clients, clientIndex, clientNames
+}
+
+// truncateDescription shortens s to at most max runes (if max is positive),
+// replacing the end with an ellipsis. It returns whether s was truncated.
+func truncateDescription(s string, max int) (string, bool) {
+	if max <= 0 || utf8.RuneCountInString(s) <= max {
+		return s, false
+	}
+	// find the byte offset of the (max-1)th rune, so we never split a
+	// multi-byte rune
+	runes := 0
+	for i := range s {
+		if runes == max-1 {
+			return s[:i] + "…", true
+		}
+		runes++
+	}
+	return s, false // unreachable
+}
+
+// truncateRaw limits the length of serialized JSON to max runes (if max is
+// positive). JSON can't be truncated in place and remain valid, so JSON that is
+// too long is replaced by a JSON string containing the truncated text.
+func truncateRaw(raw json.RawMessage, max int) json.RawMessage {
+	if raw == nil {
+		return nil
+	}
+	truncated, ok := truncateDescription(string(raw), max)
+	if !ok {
+		return raw
+	}
+	s, _ := json.Marshal(truncated)
+	return s
+}
+
+// lessInts compares two slices of ints lexicographically.
+func lessInts(a, b []int) bool {
+	for i := 0; i < len(a) && i < len(b); i++ {
+		if a[i] != b[i] {
+			return a[i] < b[i]
+		}
+	}
+	return len(a) < len(b)
+}
+
+func compareHistoryElements(a, b historyElement) int {
+	switch {
+	case a.Start != b.Start:
+		return compareInt64(a.Start, b.Start)
+	case a.End != b.End:
+		return compareInt64(a.End, b.End)
+	case a.ClientId != b.ClientId:
+		return compareInt64(int64(a.ClientId), int64(b.ClientId))
+	case a.Description != b.Description:
+		return strings.Compare(a.Description, b.Description)
+	default:
+		return strings.Compare(a.Color, b.Color)
+	}
+}
+
+func compareInt64(a, b int64) int {
+	if a < b {
+		return -1
+	} else if a > b {
+		return 1
+	}
+	return 0
+}
+
+// sortPartitions puts partitions in a canonical order, so that the
+// visualization doesn't depend on the order in which the model's partition
+// function returns partitions (which is often based on map iteration order).
+// Partitions are ordered by comparing their history elements
+// lexicographically.
+func sortPartitions(data []partitionVisualizationData) {
+	sort.SliceStable(data, func(i, j int) bool {
+		a, b := data[i].History, data[j].History
+		for k := 0; k < len(a) && k < len(b); k++ {
+			if c := compareHistoryElements(a[k], b[k]); c != 0 {
+				return c < 0
+			}
+		}
+		return len(a) < len(b)
+	})
+}
+
+func addOverviews(data []partitionVisualizationData, buckets int) {
+	first := true
+	var start, end int64
+	for _, partition := range data {
+		for _, elem := range partition.History {
+			if first || elem.Start < start {
+				start = elem.Start
+			}
+			if first || elem.End > end {
+				end = elem.End
+			}
+			first = false
+		}
+	}
+	if first {
+		// empty history
+		return
+	}
+	for i := range data {
+		linearized := make([]bool, len(data[i].History))
+		if len(data[i].PartialLinearizations) > 0 {
+			// the longest linearization is first
+			for _, step := range data[i].PartialLinearizations[0] {
+				linearized[step.Index] = true
+			}
+		}
+		data[i].Overview = computeOverview(data[i].History, linearized, start, end, buckets)
+	}
 }
 
 // Visualize produces a visualization of a history and (partial) linearization
@@ -99,33 +640,149 @@ func computeVisualizationData(model Model, info LinearizationInfo) visualization
 //
 // This function writes the visualization, an HTML file with embedded
 // JavaScript and data, to the given output.
+//
+// The output is deterministic: visualizing the same history twice produces
+// byte-for-byte identical output, regardless of the order in which the model's
+// partition function returns partitions. This requires the model's functions
+// to be deterministic: Step, DescribeOperation, DescribeState, and
+// DescribeOperationColor must return the same results for the same arguments,
+// and the partition functions must return the operations within each
+// partition in a deterministic order.
 func Visualize(model Model, info LinearizationInfo, output io.Writer) error {
-	data := computeVisualizationData(model, info)
+	return VisualizeWithOptions(model, info, output, VisualizationOptions{})
+}
+
+// VisualizeWithOptions is like [Visualize], but it allows customizing the
+// visualization.
+func VisualizeWithOptions(model Model, info LinearizationInfo, output io.Writer, opts VisualizationOptions) error {
+	if opts.Compress {
+		zw := gzip.NewWriter(output)
+		opts.Compress = false
+		err := VisualizeWithOptions(model, info, zw, opts)
+		if err != nil {
+			return err
+		}
+		return zw.Close()
+	}
+	data := computeVisualizationData(model, info, opts)
+	if opts.StaticLayout {
+		return executeStaticLayout(data, output, opts)
+	}
+	return executeVisualizationTemplate(data, output, opts)
+}
+
+func executeVisualizationTemplate(data visualizationData, output io.Writer, opts VisualizationOptions) error {
 	jsonData, err := json.Marshal(data)
 	if err != nil {
 		return err
 	}
-	templateB, _ := visualizationFS.ReadFile("visualization/index.html")
-	template := string(templateB)
+	var tables template.HTML
+	if opts.AccessibleTables {
+		tables, err = renderAccessibleTables(data)
+		if err != nil {
+			return err
+		}
+	}
+	tmpl := opts.Template
+	if tmpl == nil {
+		tmpl = DefaultVisualizationTemplate()
+	}
 	css, _ := visualizationFS.ReadFile("visualization/index.css")
 	js, _ := visualizationFS.ReadFile("visualization/index.js")
-	_, err = fmt.Fprintf(output, template, css, js, jsonData)
-	if err != nil {
-		return err
-	}
-	return nil
+	return tmpl.Execute(output, VisualizationTemplateData{
+		CSS:    template.CSS(css),
+		JS:     template.JS(js),
+		Data:   template.JS(jsonData),
+		Tables: tables,
+	})
 }
 
 // VisualizePath is a wrapper around [Visualize] to write the visualization to
-// a file path.
+// a file path. If the path ends in ".gz", the output is gzip-compressed.
 func VisualizePath(model Model, info LinearizationInfo, path string) error {
-	f, err := os.Create(path)
+	return VisualizePathWithOptions(model, info, path, VisualizationOptions{})
+}
+
+// VisualizePathWithOptions is a wrapper around [VisualizeWithOptions] to
+// write the visualization to a file path. If the path ends in ".gz", the
+// output is gzip-compressed.
+//
+// The visualization is written to a temporary file that is synced to disk and
+// renamed to the given path once the visualization has been written
+// successfully, so an error never leaves behind a truncated file. Errors are
+// returned as a [*FileError], which records the stage that failed.
+func VisualizePathWithOptions(model Model, info LinearizationInfo, path string, opts VisualizationOptions) error {
+	if strings.HasSuffix(path, ".gz") {
+		opts.Compress = true
+	}
+	if opts.CreateDirs {
+		err := os.MkdirAll(filepath.Dir(path), 0755)
+		if err != nil {
+			return &FileError{Stage: "create", Path: path, Err: err}
+		}
+	}
+	return writeFileAtomic(path, func(w io.Writer) error {
+		return VisualizeWithOptions(model, info, w, opts)
+	})
+}
+
+// VisualizeDir is like [VisualizePathWithOptions], but it splits the
+// visualization across multiple files in the given directory, for histories
+// that are too large to be visualized as a single file. The directory
+// contains an index.html file that lists the partitions of the history, and
+// a data directory with one file per partition; a partition's data is only
+// loaded when it is opened. The directory is created if it does not exist.
+//
+// File names are derived from partition indices, so visualizing the same
+// history twice produces the same files. Every file is written atomically,
+// and the index is written last. The Compress and StaticLayout options are not
+// supported.
+func VisualizeDir(model Model, info LinearizationInfo, dir string, opts VisualizationOptions) error {
+	if opts.Compress {
+		return errors.New("porcupine: VisualizeDir does not support compression")
+	}
+	if opts.StaticLayout {
+		return errors.New("porcupine: VisualizeDir does not support static layouts")
+	}
+	data := computeVisualizationData(model, info, opts)
+	shardDir := filepath.Join(dir, visualizationShardDir)
+	err := os.MkdirAll(shardDir, 0755)
 	if err != nil {
-		return err
+		return &FileError{Stage: "create", Path: shardDir, Err: err}
+	}
+	shards := make([]visualizationShard, len(data.Partitions))
+	for i, partition := range data.Partitions {
+		name := fmt.Sprintf("partition-%d.js", i)
+		jsonData, err := json.Marshal(partition)
+		if err != nil {
+			return err
+		}
+		err = writeFileAtomic(filepath.Join(dir, visualizationShardDir, name), func(w io.Writer) error {
+			_, err := fmt.Fprintf(w, "loadShard(%s)\n", jsonData)
+			return err
+		})
+		if err != nil {
+			return err
+		}
+		shards[i] = visualizationShard{
+			// relative URL, so this always uses forward slashes
+			File:       visualizationShardDir + "/" + name,
+			Operations: len(partition.History),
+			Linearized: partition.FirstIllegal == -1,
+		}
 	}
-	defer f.Close()
-	return Visualize(model, info, f)
+	index := visualizationData{
+		TimeUnit:   data.TimeUnit,
+		Summary:    data.Summary,
+		Partitions: []partitionVisualizationData{},
+		Shards:     shards,
+	}
+	return writeFileAtomic(filepath.Join(dir, "index.html"), func(w io.Writer) error {
+		return executeVisualizationTemplate(index, w, opts)
+	})
 }
 
+const visualizationShardDir = "data"
+
 //go:embed visualization
 var visualizationFS embed.FS
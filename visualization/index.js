@@ -52,7 +52,186 @@ function arrayEq(a, b) {
   return true
 }
 
-function render(data) {
+function escapeHTML(s) {
+  const el = document.createElement('div')
+  el.textContent = s
+  return el.innerHTML
+}
+
+function formatDuration(ns) {
+  if (ns < 1e3) {
+    return ns + 'ns'
+  } else if (ns < 1e6) {
+    return (ns / 1e3).toFixed(1) + 'µs'
+  } else if (ns < 1e9) {
+    return (ns / 1e6).toFixed(1) + 'ms'
+  }
+  return (ns / 1e9).toFixed(2) + 's'
+}
+
+// Duration of one unit of time in nanoseconds, for timestamps that are in a
+// unit of time.
+const TIME_UNIT_NANOS = { ns: 1, µs: 1e3, ms: 1e6, s: 1e9 }
+
+function formatTimes(timeUnit, call, ret) {
+  if (!Object.prototype.hasOwnProperty.call(TIME_UNIT_NANOS, timeUnit)) {
+    // logical or unknown unit: plain integers
+    return 'Call: ' + call + '<br><br>Return: ' + ret
+  }
+  return (
+    'Call: ' +
+    call +
+    timeUnit +
+    '<br><br>Return: ' +
+    ret +
+    timeUnit +
+    '<br><br>Lasted: ' +
+    formatDuration((ret - call) * TIME_UNIT_NANOS[timeUnit])
+  )
+}
+
+function renderSummary(summary) {
+  const el = document.getElementById('summary')
+  const result = summary['Result']
+  const parts = [
+    `<span class="summary-result summary-result-${result.toLowerCase()}">${escapeHTML(result)}</span>` +
+      (summary['ResultComputed'] ? ' (computed)' : ''),
+    `${summary['Operations']} operation${summary['Operations'] === 1 ? '' : 's'}`,
+    `${summary['Partitions']} partition${summary['Partitions'] === 1 ? '' : 's'}` +
+      ` (${summary['LinearizedPartitions']} fully linearized)`,
+  ]
+  if (summary['Duration']) {
+    parts.push(`checked in ${formatDuration(summary['Duration'])}`)
+  }
+  el.innerHTML = parts.join(' · ')
+}
+
+// Parse the client filter from the page's query string ("?clients=1,2,5"),
+// returning null if there is no filter. Clients can be given by ID or by name.
+function clientFilter() {
+  const param = new URLSearchParams(window.location.search).get('clients')
+  if (!param) {
+    return null
+  }
+  document.getElementById('client-filter-input').value = param
+  return new Set(
+    param
+      .split(',')
+      .map((s) => s.trim())
+      .filter((s) => s !== '')
+  )
+}
+
+// Restrict the data to the given clients, dropping partitions that are left
+// empty. History indices are renumbered, and linearizations skip the
+// operations that are filtered out.
+function filterClients(data, filter) {
+  return data
+    .map((partition) => {
+      const names = partition['ClientNames']
+      const keepClient = partition['Clients'].map(
+        (client, i) => filter.has(String(client)) || (names != null && filter.has(names[i]))
+      )
+      const clients = partition['Clients'].filter((_, i) => keepClient[i])
+      const clientPosition = []
+      let n = 0
+      keepClient.forEach((keep, i) => {
+        clientPosition[i] = keep ? n++ : -1
+      })
+      const keep = partition['ClientIndex'].map((i) => keepClient[i])
+      const newIndex = []
+      n = 0
+      keep.forEach((k, i) => {
+        newIndex[i] = k ? n++ : -1
+      })
+      // linearizations that only contain filtered-out operations are dropped
+      const lins = []
+      const newLinIndex = partition['PartialLinearizations'].map((lin) => {
+        const projected = lin
+          .filter((step) => keep[step['Index']])
+          .map((step) => Object.assign({}, step, { Index: newIndex[step['Index']] }))
+        if (projected.length === 0) {
+          return -1
+        }
+        lins.push(projected)
+        return lins.length - 1
+      })
+      const largest = {}
+      Object.keys(partition['Largest']).forEach((i) => {
+        if (keep[i]) {
+          largest[newIndex[i]] = newLinIndex[partition['Largest'][i]]
+        }
+      })
+      const selected = partition['DefaultSelected']
+      const firstIllegal = partition['FirstIllegal']
+      return Object.assign({}, partition, {
+        History: partition['History'].filter((_, i) => keep[i]),
+        PartialLinearizations: lins,
+        Largest: largest,
+        DefaultSelected: selected >= 0 ? newLinIndex[selected] : -1,
+        FirstIllegal: firstIllegal >= 0 && keep[firstIllegal] ? newIndex[firstIllegal] : -1,
+        Clients: clients,
+        ClientIndex: partition['ClientIndex'].filter((_, i) => keep[i]).map((i) => clientPosition[i]),
+        ClientNames: names == null ? null : names.filter((_, i) => keepClient[i]),
+      })
+    })
+    .filter((partition) => partition['History'].length > 0)
+}
+
+// Visualizations written by VisualizeDir only contain an index of the
+// partitions, which are stored in separate files. The partition to show is
+// given in the query string ("?partition=3"); without one, the index lists the
+// partitions. Partition files are scripts that call loadShard, because
+// browsers don't allow fetching local files.
+function renderShardIndex(visualization) {
+  renderSummary(visualization['Summary'])
+  const shards = visualization['Shards']
+  const params = new URLSearchParams(window.location.search)
+  const index = parseInt(params.get('partition'), 10)
+  if (!(index >= 0 && index < shards.length)) {
+    const list = document.createElement('ol')
+    list.id = 'shards'
+    list.start = 0
+    shards.forEach((shard, i) => {
+      const item = document.createElement('li')
+      const link = document.createElement('a')
+      link.href = '?partition=' + i
+      link.textContent =
+        `partition ${i}: ${shard['Operations']} operation${shard['Operations'] === 1 ? '' : 's'}` +
+        (shard['Linearized'] ? '' : ' (not linearizable)')
+      item.appendChild(link)
+      list.appendChild(item)
+    })
+    document.getElementById('canvas').appendChild(list)
+    return
+  }
+  // keep the partition when filtering clients
+  const partitionInput = document.createElement('input')
+  partitionInput.type = 'hidden'
+  partitionInput.name = 'partition'
+  partitionInput.value = index
+  document.getElementById('client-filter').appendChild(partitionInput)
+  window.loadShard = (partition) => {
+    render({ TimeUnit: visualization['TimeUnit'], Summary: visualization['Summary'], Partitions: [partition] })
+  }
+  const script = document.createElement('script')
+  script.src = shards[index]['File']
+  document.body.appendChild(script)
+}
+
+function render(visualization) {
+  if (visualization['Shards'] != null) {
+    renderShardIndex(visualization)
+    return
+  }
+  renderSummary(visualization['Summary'])
+  const timeUnit = visualization['TimeUnit']
+  let data = visualization['Partitions']
+  const filter = clientFilter()
+  if (filter !== null) {
+    data = filterClients(data, filter)
+  }
+
   const PADDING = 10
   const BOX_HEIGHT = 30
   const BOX_SPACE = 15
@@ -62,14 +241,24 @@ function render(data) {
   const BOX_GAP = 20
   const BOX_TEXT_PADDING = 10
   const HISTORY_RECT_RADIUS = 4
+  const OVERVIEW_HEIGHT = 40
 
-  let maxClient = -1
+  // Each client gets a row, ordered by client ID.
+  const clientNames = {}
   data.forEach((partition) => {
-    partition['History'].forEach((el) => {
-      maxClient = Math.max(maxClient, el['ClientId'])
+    partition['Clients'].forEach((client, i) => {
+      const names = partition['ClientNames']
+      clientNames[client] = names != null && names[i] !== '' ? names[i] : null
     })
   })
-  const nClient = maxClient + 1
+  const clients = Object.keys(clientNames)
+    .map(Number)
+    .sort((a, b) => a - b)
+  const clientRow = {}
+  clients.forEach((client, row) => {
+    clientRow[client] = row
+  })
+  const nClient = clients.length
 
   // Prepare some useful data to be used later:
   // - Add a GID to each event
@@ -299,14 +488,17 @@ function render(data) {
     class: 'bg',
   })
   bgRect.onclick = handleBgClick
-  for (let i = 0; i < nClient; i++) {
+  clients.forEach((client, i) => {
     const text = svgadd(bg, 'text', {
       x: XOFF / 2,
       y: PADDING + BOX_HEIGHT / 2 + i * (BOX_HEIGHT + BOX_SPACE),
       'text-anchor': 'middle',
     })
-    text.textContent = i
-  }
+    text.textContent = client
+    if (clientNames[client] !== null) {
+      svgadd(text, 'title').textContent = clientNames[client]
+    }
+  })
   svgadd(bg, 'line', {
     x1: PADDING + XOFF,
     y1: PADDING,
@@ -323,23 +515,37 @@ function render(data) {
     const l = svgadd(svg, 'g')
     historyLayers.push(l)
     const rects = []
+    // elements that are part of the longest linearization (which is first)
+    const linearized = new Set()
+    if (partition['PartialLinearizations'].length > 0) {
+      partition['PartialLinearizations'][0].forEach((id) => {
+        linearized.add(id['Index'])
+      })
+    }
     partition['History'].forEach((el, elIndex) => {
       const g = svgadd(l, 'g')
       const rx = xPos[el['Start']]
       const width = xPos[el['End']] - rx
       const x = rx + XOFF + PADDING
-      const y = PADDING + el['ClientId'] * (BOX_HEIGHT + BOX_SPACE)
-      rects.push(
-        svgadd(g, 'rect', {
-          height: BOX_HEIGHT,
-          width: width,
-          x: x,
-          y: y,
-          rx: HISTORY_RECT_RADIUS,
-          ry: HISTORY_RECT_RADIUS,
-          class: 'history-rect',
-        })
-      )
+      const y = PADDING + clientRow[el['ClientId']] * (BOX_HEIGHT + BOX_SPACE)
+      const rect = svgadd(g, 'rect', {
+        height: BOX_HEIGHT,
+        width: width,
+        x: x,
+        y: y,
+        rx: HISTORY_RECT_RADIUS,
+        ry: HISTORY_RECT_RADIUS,
+        class: 'history-rect',
+      })
+      if (el['Color']) {
+        // custom colors only change the fill, so the outline below is
+        // still visible on top of them
+        rect.style.fill = el['Color']
+      }
+      if (!linearized.has(elIndex)) {
+        rect.classList.add('history-rect-unlinearized')
+      }
+      rects.push(rect)
       const text = svgadd(g, 'text', {
         x: x + width / 2,
         y: y + BOX_HEIGHT / 2,
@@ -394,14 +600,14 @@ function render(data) {
         const el = partition['History'][id['Index']]
         const hereX = PADDING + XOFF + xPos[el['Start']]
         const x = prevX !== null ? Math.max(hereX, prevX + EPSILON) : hereX
-        const y = PADDING + el['ClientId'] * (BOX_HEIGHT + BOX_SPACE) - LINE_BLEED
+        const y = PADDING + clientRow[el['ClientId']] * (BOX_HEIGHT + BOX_SPACE) - LINE_BLEED
         // line from previous
         if (prevEl !== null) {
           svgadd(g, 'line', {
             x1: prevX,
             x2: x,
-            y1: prevEl['ClientId'] >= el['ClientId'] ? prevY : prevY + BOX_HEIGHT + 2 * LINE_BLEED,
-            y2: prevEl['ClientId'] <= el['ClientId'] ? y : y + BOX_HEIGHT + 2 * LINE_BLEED,
+            y1: prevY >= y ? prevY : prevY + BOX_HEIGHT + 2 * LINE_BLEED,
+            y2: prevY <= y ? y : y + BOX_HEIGHT + 2 * LINE_BLEED,
             class: 'linearization linearization-line',
           })
         }
@@ -432,13 +638,13 @@ function render(data) {
         if (!included.has(index) && el['Start'] < minEnd) {
           const hereX = PADDING + XOFF + xPos[el['Start']]
           const x = prevX !== null ? Math.max(hereX, prevX + EPSILON) : hereX
-          const y = PADDING + el['ClientId'] * (BOX_HEIGHT + BOX_SPACE) - LINE_BLEED
+          const y = PADDING + clientRow[el['ClientId']] * (BOX_HEIGHT + BOX_SPACE) - LINE_BLEED
           // line from previous
           svgadd(g, 'line', {
             x1: prevX,
             x2: x,
-            y1: prevEl['ClientId'] >= el['ClientId'] ? prevY : prevY + BOX_HEIGHT + 2 * LINE_BLEED,
-            y2: prevEl['ClientId'] <= el['ClientId'] ? y : y + BOX_HEIGHT + 2 * LINE_BLEED,
+            y1: prevY >= y ? prevY : prevY + BOX_HEIGHT + 2 * LINE_BLEED,
+            y2: prevY <= y ? y : y + BOX_HEIGHT + 2 * LINE_BLEED,
             class: 'linearization-invalid linearization-line',
           })
           // current line
@@ -560,29 +766,37 @@ function render(data) {
         if (found) {
           // part of linearization
           if (prev !== null) {
-            msg = '<strong>Previous state:</strong><br>' + prev['StateDescription'] + '<br><br>'
+            msg = '<strong>Previous state' + candidates(prev) + ':</strong><br>' + prev['StateDescription'] + '<br><br>'
           }
           msg +=
-            '<strong>New state:</strong><br>' +
+            '<strong>New state' +
+            candidates(curr) +
+            ':</strong><br>' +
             curr['StateDescription'] +
-            '<br><br>Call: ' +
-            call +
-            '<br><br>Return: ' +
-            ret
+            '<br><br>' +
+            formatTimes(timeUnit, call, ret)
         } else if (illegalLast[partition][maxIndex].has(index)) {
           // illegal next one
           msg =
-            '<strong>Previous state:</strong><br>' +
+            '<strong>Previous state' +
+            candidates(lin[lin.length - 1]) +
+            ':</strong><br>' +
             lin[lin.length - 1]['StateDescription'] +
             '<br><br><strong>New state:</strong><br>&langle;invalid op&rangle;' +
-            '<br><br>Call: ' +
-            call +
-            '<br><br>Return: ' +
-            ret
+            '<br><br>' +
+            formatTimes(timeUnit, call, ret)
         } else {
           // not part of this one
           msg = "Not part of selected element's partial linearization."
         }
+        const full = data[partition]['History'][index]['FullDescription']
+        if (full) {
+          msg = '<strong>Operation:</strong><br>' + escapeHTML(full) + '<br><br>' + msg
+        }
+        const original = data[partition]['History'][index]['OriginalDescription']
+        if (original) {
+          msg = '<strong>Original description:</strong><br>' + escapeHTML(original) + '<br><br>' + msg
+        }
         tooltip.innerHTML = msg
       }
       lastTooltip = thisTooltip
@@ -597,6 +811,15 @@ function render(data) {
     tooltip.style.top = event.pageY + 20 + 'px'
   }
 
+  function candidates(step) {
+    // for nondeterministic models, show the number of candidate states
+    const n = step['Candidates']
+    if (!n) {
+      return ''
+    }
+    return ' (' + n + (n === 1 ? ' candidate state)' : ' candidate states)')
+  }
+
   function handleMouseOut() {
     if (!selected) {
       resetHighlight()
@@ -665,6 +888,23 @@ function render(data) {
     selectedIndex = [partition, index]
     highlight(partition, index)
     historyRects[partition][index].classList.add('selected')
+    showDetails(data[partition]['History'][index])
+  }
+
+  function showDetails(el) {
+    // show serialized operation details (from the model's
+    // SerializeOperation), if present
+    const details = document.getElementById('details')
+    if (!Object.prototype.hasOwnProperty.call(el, 'Raw')) {
+      details.classList.add('inactive')
+      return
+    }
+    details.innerHTML = ''
+    const summary = details.appendChild(document.createElement('strong'))
+    summary.textContent = el['Description']
+    const pre = details.appendChild(document.createElement('pre'))
+    pre.textContent = JSON.stringify(el['Raw'], null, 2)
+    details.classList.remove('inactive')
   }
 
   function deselect() {
@@ -675,7 +915,84 @@ function render(data) {
     resetHighlight()
     const [partition, index] = selectedIndex
     historyRects[partition][index].classList.remove('selected')
+    document.getElementById('details').classList.add('inactive')
+  }
+
+  drawOverview()
+
+  function drawOverview() {
+    // the overview buckets are aligned across partitions, so we can
+    // combine them into a single strip
+    const overviews = data.map((partition) => partition['Overview']).filter((o) => o != null)
+    if (overviews.length === 0) {
+      return
+    }
+    const n = overviews[0]['Counts'].length
+    const counts = newArray(n, () => 0)
+    const unlinearized = newArray(n, () => false)
+    overviews.forEach((o) => {
+      o['Counts'].forEach((c, i) => {
+        counts[i] += c
+      })
+      o['Unlinearized'].forEach((u, i) => {
+        unlinearized[i] = unlinearized[i] || u
+      })
+    })
+    const maxCount = counts.reduce((a, b) => Math.max(a, b), 1)
+    const container = document.getElementById('overview')
+    container.classList.remove('inactive')
+    document.getElementById('canvas').classList.add('with-overview')
+    const overviewSvg = svgadd(container, 'svg', {
+      width: '100%',
+      height: OVERVIEW_HEIGHT,
+      viewBox: '0 0 ' + n + ' ' + OVERVIEW_HEIGHT,
+      preserveAspectRatio: 'none',
+    })
+    counts.forEach((c, i) => {
+      if (c === 0) {
+        return
+      }
+      const h = Math.max(1, (c / maxCount) * OVERVIEW_HEIGHT)
+      svgadd(overviewSvg, 'rect', {
+        x: i,
+        y: OVERVIEW_HEIGHT - h,
+        width: 1,
+        height: h,
+        class: unlinearized[i] ? 'overview-bar overview-bar-invalid' : 'overview-bar',
+      })
+    })
+    overviewSvg.onclick = (e) => {
+      const bounds = overviewSvg.getBoundingClientRect()
+      const bucket = Math.floor(((e.clientX - bounds.left) / bounds.width) * n)
+      const t = overviews[0]['Start'] + bucket * overviews[0]['BucketWidth']
+      // scroll to the first timestamp in (or after) the bucket
+      let ts = sortedTimestamps.find((ts) => ts >= t)
+      if (ts === undefined) {
+        ts = sortedTimestamps[sortedTimestamps.length - 1]
+      }
+      const x = PADDING + XOFF + xPos[ts]
+      window.scrollTo({ left: x - document.documentElement.clientWidth / 2, behavior: 'smooth' })
+    }
   }
 
   handleMouseOut() // initialize, same as mouse out
+  selectDefault()
+
+  function selectDefault() {
+    // select the longest partial linearization of the first partition
+    // that isn't linearizable, and point out the element that couldn't be
+    // linearized next
+    const partition = data.findIndex((p) => p['FirstIllegal'] >= 0)
+    if (partition === -1) {
+      return
+    }
+    const p = data[partition]
+    const rect = historyRects[partition][p['FirstIllegal']]
+    rect.classList.add('first-illegal')
+    if (p['DefaultSelected'] >= 0) {
+      const lin = p['PartialLinearizations'][p['DefaultSelected']]
+      select(partition, lin[lin.length - 1]['Index'])
+    }
+    rect.scrollIntoView({ inline: 'center', block: 'center' })
+  }
 }
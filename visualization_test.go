@@ -1,9 +1,21 @@
 package porcupine
 
 import (
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"fmt"
+	"html/template"
+	"io"
+	"math"
 	"os"
+	"path/filepath"
 	"reflect"
+	"regexp"
+	"strings"
 	"testing"
+	"time"
+	"unicode/utf8"
 )
 
 func visualizeTempFile(t *testing.T, model Model, info LinearizationInfo) {
@@ -18,6 +30,30 @@ func visualizeTempFile(t *testing.T, model Model, info LinearizationInfo) {
 	t.Logf("wrote visualization to %s", file.Name())
 }
 
+var visualizationDataRegexp = regexp.MustCompile(`const data = (\{.*)\n`)
+
+// visualizeExtractData renders a visualization and unmarshals the data that is
+// embedded in the HTML into out.
+func visualizeExtractData(t *testing.T, model Model, info LinearizationInfo, out interface{}) {
+	visualizeExtractDataWithOptions(t, model, info, VisualizationOptions{}, out)
+}
+
+func visualizeExtractDataWithOptions(t *testing.T, model Model, info LinearizationInfo, opts VisualizationOptions, out interface{}) {
+	var buf bytes.Buffer
+	err := VisualizeWithOptions(model, info, &buf, opts)
+	if err != nil {
+		t.Fatalf("visualization failed: %v", err)
+	}
+	match := visualizationDataRegexp.FindSubmatch(buf.Bytes())
+	if match == nil {
+		t.Fatalf("failed to find data in visualization")
+	}
+	err = json.Unmarshal(match[1], out)
+	if err != nil {
+		t.Fatalf("failed to unmarshal visualization data: %v", err)
+	}
+}
+
 func TestVisualizationMultipleLengths(t *testing.T) {
 	ops := []Operation{
 		{0, kvInput{op: 0, key: "x"}, 0, kvOutput{"w"}, 100},
@@ -34,7 +70,7 @@ func TestVisualizationMultipleLengths(t *testing.T) {
 	if res != Illegal {
 		t.Fatalf("expected output %v, got output %v", Illegal, res)
 	}
-	data := computeVisualizationData(kvModel, info)
+	data := computeVisualizationData(kvModel, info, VisualizationOptions{OverviewBuckets: -1}).Partitions
 	expected := []partitionVisualizationData{{
 		History: []historyElement{
 			{ClientId: 0, Start: 0, End: 100, Description: "get('x') -> 'w'"},
@@ -46,19 +82,27 @@ func TestVisualizationMultipleLengths(t *testing.T) {
 			{ClientId: 3, Start: 30, End: 40, Description: "get('x') -> 'y'"},
 		},
 		PartialLinearizations: []partialLinearization{
-			{{2, "z"}, {1, "y"}, {3, "y"}, {6, "y"}, {4, "w"}, {0, "w"}},
-			{{1, "y"}, {2, "z"}, {5, "z"}},
+			{{Index: 2, StateDescription: "z"}, {Index: 1, StateDescription: "y"}, {Index: 3, StateDescription: "y"}, {Index: 6, StateDescription: "y"}, {Index: 4, StateDescription: "w"}, {Index: 0, StateDescription: "w"}},
+			{{Index: 1, StateDescription: "y"}, {Index: 2, StateDescription: "z"}, {Index: 5, StateDescription: "z"}},
 		},
-		Largest: map[int]int{0: 0, 1: 0, 2: 0, 3: 0, 4: 0, 5: 1, 6: 0},
+		Largest:         map[int]int{0: 0, 1: 0, 2: 0, 3: 0, 4: 0, 5: 1, 6: 0},
+		DefaultSelected: 0,
+		FirstIllegal:    5,
+		Clients:         []int{0, 1, 2, 3, 5},
+		ClientIndex:     []int{0, 1, 2, 1, 1, 4, 3},
 	}, {
 		History: []historyElement{
 			{ClientId: 4, Start: 50, End: 90, Description: "get('y') -> 'a'"},
 			{ClientId: 2, Start: 55, End: 85, Description: "put('y', 'a')"},
 		},
 		PartialLinearizations: []partialLinearization{
-			{{1, "a"}, {0, "a"}},
+			{{Index: 1, StateDescription: "a"}, {Index: 0, StateDescription: "a"}},
 		},
-		Largest: map[int]int{0: 0, 1: 0},
+		Largest:         map[int]int{0: 0, 1: 0},
+		DefaultSelected: 0,
+		FirstIllegal:    -1,
+		Clients:         []int{2, 4},
+		ClientIndex:     []int{1, 0},
 	}}
 	if !reflect.DeepEqual(expected, data) {
 		t.Fatalf("expected data to be \n%v\n, was \n%v", expected, data)
@@ -127,3 +171,786 @@ func TestVisualizationLarge(t *testing.T) {
 
 	visualizeTempFile(t, etcdModel, info)
 }
+
+func TestVisualizationColor(t *testing.T) {
+	model := kvModel
+	model.DescribeOperationColor = func(input, output interface{}) string {
+		if input.(kvInput).op == 0 {
+			return "grey"
+		}
+		return ""
+	}
+	ops := []Operation{
+		{0, kvInput{op: 1, key: "x", value: "y"}, 0, kvOutput{}, 10},
+		{1, kvInput{op: 0, key: "x"}, 20, kvOutput{"y"}, 30},
+	}
+	res, info := CheckOperationsVerbose(model, ops, 0)
+	if res != Ok {
+		t.Fatal("expected operations to be linearizable")
+	}
+	var data struct {
+		Partitions []map[string]interface{}
+	}
+	visualizeExtractData(t, model, info, &data)
+	history := data.Partitions[0]["History"].([]interface{})
+	if _, ok := history[0].(map[string]interface{})["Color"]; ok {
+		t.Fatalf("expected no color for put, got %v", history[0])
+	}
+	if color := history[1].(map[string]interface{})["Color"]; color != "grey" {
+		t.Fatalf("expected color grey for get, got %v", color)
+	}
+}
+
+func TestComputeOverviewBuckets(t *testing.T) {
+	history := []historyElement{
+		{ClientId: 0, Start: 0, End: 9},
+		{ClientId: 1, Start: 10, End: 10},
+		{ClientId: 2, Start: 19, End: 20},
+		{ClientId: 0, Start: 25, End: 39},
+	}
+	linearized := []bool{true, true, false, true}
+	o := computeOverview(history, linearized, 0, 39, 4)
+	expected := &overview{
+		Start:        0,
+		BucketWidth:  10,
+		Counts:       []int{1, 2, 2, 1},
+		Unlinearized: []bool{false, true, true, false},
+	}
+	if !reflect.DeepEqual(expected, o) {
+		t.Fatalf("expected overview to be \n%v\n, was \n%v", expected, o)
+	}
+}
+
+func TestComputeOverviewShortSpan(t *testing.T) {
+	// with fewer distinct times than buckets, there is one bucket per time
+	history := []historyElement{
+		{ClientId: 0, Start: 100, End: 102},
+	}
+	o := computeOverview(history, []bool{false}, 100, 102, 1000)
+	expected := &overview{
+		Start:        100,
+		BucketWidth:  1,
+		Counts:       []int{1, 1, 1},
+		Unlinearized: []bool{true, true, true},
+	}
+	if !reflect.DeepEqual(expected, o) {
+		t.Fatalf("expected overview to be \n%v\n, was \n%v", expected, o)
+	}
+}
+
+func TestComputeOverviewUneven(t *testing.T) {
+	// 11 times don't split evenly into 3 buckets, so buckets are rounded
+	// up to a width of 4
+	history := []historyElement{
+		{ClientId: 0, Start: 0, End: 3},
+		{ClientId: 1, Start: 4, End: 4},
+		{ClientId: 2, Start: 8, End: 10},
+	}
+	o := computeOverview(history, []bool{true, true, true}, 0, 10, 3)
+	expected := &overview{
+		Start:        0,
+		BucketWidth:  4,
+		Counts:       []int{1, 1, 1},
+		Unlinearized: []bool{false, false, false},
+	}
+	if !reflect.DeepEqual(expected, o) {
+		t.Fatalf("expected overview to be \n%v\n, was \n%v", expected, o)
+	}
+}
+
+func TestComputeOverviewExtremeTimes(t *testing.T) {
+	// the span of the times doesn't fit in a uint64
+	history := []historyElement{
+		{ClientId: 0, Start: math.MinInt64, End: math.MinInt64 + 1},
+		{ClientId: 1, Start: 0, End: math.MaxInt64},
+	}
+	o := computeOverview(history, []bool{true, false}, math.MinInt64, math.MaxInt64, 4)
+	expected := &overview{
+		Start:        math.MinInt64,
+		BucketWidth:  1 << 62,
+		Counts:       []int{1, 0, 1, 1},
+		Unlinearized: []bool{false, false, true, true},
+	}
+	if !reflect.DeepEqual(expected, o) {
+		t.Fatalf("expected overview to be \n%v\n, was \n%v", expected, o)
+	}
+	// nor does the width of a single bucket fit in BucketWidth, so there
+	// are a few more
+	o = computeOverview(history, []bool{true, false}, math.MinInt64, math.MaxInt64, 1)
+	expected = &overview{
+		Start:        math.MinInt64,
+		BucketWidth:  math.MaxInt64,
+		Counts:       []int{1, 1, 1},
+		Unlinearized: []bool{false, true, true},
+	}
+	if !reflect.DeepEqual(expected, o) {
+		t.Fatalf("expected overview to be \n%v\n, was \n%v", expected, o)
+	}
+}
+
+func TestVisualizationOverview(t *testing.T) {
+	ops := []Operation{
+		{0, kvInput{op: 1, key: "x", value: "y"}, 0, kvOutput{}, 10},
+		{1, kvInput{op: 0, key: "x"}, 20, kvOutput{"z"}, 30},
+		{2, kvInput{op: 0, key: "y"}, 30, kvOutput{""}, 40},
+	}
+	res, info := CheckOperationsVerbose(kvModel, ops, 0)
+	if res != Illegal {
+		t.Fatalf("expected output %v, got output %v", Illegal, res)
+	}
+	data := computeVisualizationData(kvModel, info, VisualizationOptions{OverviewBuckets: 4}).Partitions
+	// x partition: put is linearized, get is not
+	expectedX := &overview{
+		Start:        0,
+		BucketWidth:  11,
+		Counts:       []int{1, 1, 1, 0},
+		Unlinearized: []bool{false, true, true, false},
+	}
+	if !reflect.DeepEqual(expectedX, data[0].Overview) {
+		t.Fatalf("expected overview to be \n%v\n, was \n%v", expectedX, data[0].Overview)
+	}
+	// y partition is aligned with the x partition
+	expectedY := &overview{
+		Start:        0,
+		BucketWidth:  11,
+		Counts:       []int{0, 0, 1, 1},
+		Unlinearized: []bool{false, false, false, false},
+	}
+	if !reflect.DeepEqual(expectedY, data[1].Overview) {
+		t.Fatalf("expected overview to be \n%v\n, was \n%v", expectedY, data[1].Overview)
+	}
+
+	data = computeVisualizationData(kvModel, info, VisualizationOptions{OverviewBuckets: -1}).Partitions
+	for _, partition := range data {
+		if partition.Overview != nil {
+			t.Fatalf("expected no overview, got %v", partition.Overview)
+		}
+	}
+}
+
+func TestVisualizationDeterministic(t *testing.T) {
+	// kvModel's PartitionEvent returns partitions in map iteration order,
+	// and partial linearizations are collected from a set, so this
+	// exercises both sources of nondeterminism
+	events := parseKvLog("test_data/kv/c10-bad.txt")
+	var first []byte
+	for i := 0; i < 5; i++ {
+		res, info := CheckEventsVerbose(kvModel, events, 0)
+		if res != Illegal {
+			t.Fatalf("expected output %v, got output %v", Illegal, res)
+		}
+		var buf bytes.Buffer
+		err := Visualize(kvModel, info, &buf)
+		if err != nil {
+			t.Fatalf("visualization failed: %v", err)
+		}
+		if first == nil {
+			first = buf.Bytes()
+		} else if !bytes.Equal(first, buf.Bytes()) {
+			t.Fatalf("visualization output differs between runs")
+		}
+	}
+
+	etcdEvents := parseJepsenLog("test_data/jepsen/etcd_070.log")
+	first = nil
+	for i := 0; i < 5; i++ {
+		_, info := CheckEventsVerbose(etcdModel, etcdEvents, 0)
+		var buf bytes.Buffer
+		err := Visualize(etcdModel, info, &buf)
+		if err != nil {
+			t.Fatalf("visualization failed: %v", err)
+		}
+		if first == nil {
+			first = buf.Bytes()
+		} else if !bytes.Equal(first, buf.Bytes()) {
+			t.Fatalf("visualization output differs between runs")
+		}
+	}
+}
+
+func TestTruncateDescription(t *testing.T) {
+	tests := []struct {
+		s         string
+		max       int
+		expected  string
+		truncated bool
+	}{
+		{"get('x') -> 'y'", 0, "get('x') -> 'y'", false},
+		{"get('x') -> 'y'", 15, "get('x') -> 'y'", false},
+		{"get('x') -> 'y'", 8, "get('x'…", true},
+		// lengths are in runes, not bytes: "日本語" is 9 bytes
+		{"日本語", 3, "日本語", false},
+		{"日本語テキスト", 3, "日本…", true},
+		{"日本語テキスト", 1, "…", true},
+	}
+	for _, test := range tests {
+		s, truncated := truncateDescription(test.s, test.max)
+		if s != test.expected || truncated != test.truncated {
+			t.Errorf("truncateDescription(%q, %d) = (%q, %v), expected (%q, %v)", test.s, test.max, s, truncated, test.expected, test.truncated)
+		}
+		if !utf8.ValidString(s) {
+			t.Errorf("truncateDescription(%q, %d) produced invalid UTF-8", test.s, test.max)
+		}
+	}
+}
+
+func TestVisualizationMaxDescriptionLength(t *testing.T) {
+	ops := []Operation{
+		{0, kvInput{op: 1, key: "x", value: "ünïcödé"}, 0, kvOutput{}, 10},
+		{1, kvInput{op: 0, key: "x"}, 20, kvOutput{"ünïcödé"}, 30},
+	}
+	res, info := CheckOperationsVerbose(kvModel, ops, 0)
+	if res != Ok {
+		t.Fatal("expected operations to be linearizable")
+	}
+	data := computeVisualizationData(kvModel, info, VisualizationOptions{MaxDescriptionLength: 15}).Partitions
+	history := data[0].History
+	// "put('x', 'ünïcödé')" is 19 runes
+	if history[0].Description != "put('x', 'ünïc…" || history[0].FullDescription != "" {
+		t.Fatalf("unexpected description %q (full %q)", history[0].Description, history[0].FullDescription)
+	}
+
+	data = computeVisualizationData(kvModel, info, VisualizationOptions{MaxDescriptionLength: 15, KeepFullDescriptions: true}).Partitions
+	history = data[0].History
+	if history[0].Description != "put('x', 'ünïc…" || history[0].FullDescription != "put('x', 'ünïcödé')" {
+		t.Fatalf("unexpected description %q (full %q)", history[0].Description, history[0].FullDescription)
+	}
+	// "get('x') -> 'ünïcödé'" is 21 runes
+	if history[1].Description != "get('x') -> 'ü…" || history[1].FullDescription != "get('x') -> 'ünïcödé'" {
+		t.Fatalf("unexpected description %q (full %q)", history[1].Description, history[1].FullDescription)
+	}
+}
+
+func TestVisualizationCustomTemplate(t *testing.T) {
+	ops := []Operation{
+		{0, registerInput{false, 100}, 0, 0, 100},
+		{1, registerInput{true, 0}, 25, 100, 75},
+	}
+	res, info := CheckOperationsVerbose(registerModel, ops, 0)
+	if res != Ok {
+		t.Fatal("expected operations to be linearizable")
+	}
+
+	tmpl := template.Must(template.New("custom").Parse(`<p id="marker">custom</p><script>const data = {{.Data}}</script>`))
+	var buf bytes.Buffer
+	err := VisualizeWithOptions(registerModel, info, &buf, VisualizationOptions{Template: tmpl})
+	if err != nil {
+		t.Fatalf("visualization failed: %v", err)
+	}
+	out := buf.String()
+	if !strings.Contains(out, `<p id="marker">custom</p>`) {
+		t.Fatalf("expected output to contain marker, got %q", out)
+	}
+	match := visualizationDataRegexp.FindStringSubmatch(out + "\n")
+	if match == nil || !strings.Contains(match[1], `"Description":"put('100')"`) {
+		t.Fatalf("expected output to contain data, got %q", out)
+	}
+
+	// extending the default template
+	tmpl = template.Must(DefaultVisualizationTemplate().Parse(`{{define "header"}}<a id="ci-link" href="https://ci.example.com/job/1">job</a>{{end}}`))
+	buf.Reset()
+	err = VisualizeWithOptions(registerModel, info, &buf, VisualizationOptions{Template: tmpl})
+	if err != nil {
+		t.Fatalf("visualization failed: %v", err)
+	}
+	out = buf.String()
+	if !strings.Contains(out, `<a id="ci-link" href="https://ci.example.com/job/1">job</a>`) || !strings.Contains(out, "render(data)") {
+		t.Fatalf("expected output to contain header and default template, got %q", out)
+	}
+	// the default template itself is unmodified
+	buf.Reset()
+	err = Visualize(registerModel, info, &buf)
+	if err != nil {
+		t.Fatalf("visualization failed: %v", err)
+	}
+	if strings.Contains(buf.String(), "ci-link") {
+		t.Fatal("expected default template to be unmodified")
+	}
+}
+
+func TestVisualizationTemplateError(t *testing.T) {
+	_, info := CheckOperationsVerbose(registerModel, []Operation{{0, registerInput{false, 100}, 0, 0, 100}}, 0)
+	tmpl := template.Must(template.New("bad").Parse(`{{.NoSuchField}}`))
+	var buf bytes.Buffer
+	err := VisualizeWithOptions(registerModel, info, &buf, VisualizationOptions{Template: tmpl})
+	if err == nil {
+		t.Fatal("expected template execution error")
+	}
+}
+
+func TestVisualizePathCompressed(t *testing.T) {
+	_, info := CheckOperationsVerbose(registerModel, []Operation{{0, registerInput{false, 100}, 0, 0, 100}}, 0)
+	dir := t.TempDir()
+
+	for _, test := range []struct {
+		name string
+		opts VisualizationOptions
+	}{
+		{"out.html.gz", VisualizationOptions{}},
+		{"out.html", VisualizationOptions{Compress: true}},
+	} {
+		path := filepath.Join(dir, test.name)
+		err := VisualizePathWithOptions(registerModel, info, path, test.opts)
+		if err != nil {
+			t.Fatalf("visualization failed: %v", err)
+		}
+		f, err := os.Open(path)
+		if err != nil {
+			t.Fatalf("failed to open visualization: %v", err)
+		}
+		zr, err := gzip.NewReader(f)
+		if err != nil {
+			t.Fatalf("expected gzip-compressed output: %v", err)
+		}
+		contents, err := io.ReadAll(zr)
+		f.Close()
+		if err != nil {
+			t.Fatalf("failed to decompress visualization: %v", err)
+		}
+		if !strings.Contains(string(contents), "render(data)") {
+			t.Fatalf("expected decompressed output to contain visualization")
+		}
+	}
+}
+
+func TestVisualizePathNoPartialOutput(t *testing.T) {
+	_, info := CheckOperationsVerbose(registerModel, []Operation{{0, registerInput{false, 100}, 0, 0, 100}}, 0)
+	dir := t.TempDir()
+	tmpl := template.Must(template.New("bad").Parse(`partial output {{.NoSuchField}}`))
+	err := VisualizePathWithOptions(registerModel, info, filepath.Join(dir, "out.html.gz"), VisualizationOptions{Template: tmpl})
+	if err == nil {
+		t.Fatal("expected template execution error")
+	}
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 0 {
+		t.Fatalf("expected no files to be left behind, found %v", entries)
+	}
+}
+
+func TestVisualizationSerializeOperation(t *testing.T) {
+	model := kvModel
+	model.SerializeOperation = func(input, output interface{}) json.RawMessage {
+		inp := input.(kvInput)
+		if inp.op != 1 {
+			return nil
+		}
+		raw, _ := json.Marshal(map[string]string{"key": inp.key, "value": inp.value})
+		return raw
+	}
+	ops := []Operation{
+		{0, kvInput{op: 1, key: "x", value: "y"}, 0, kvOutput{}, 10},
+		{1, kvInput{op: 0, key: "x"}, 20, kvOutput{"y"}, 30},
+		{2, kvInput{op: 1, key: "x", value: strings.Repeat("z", 100)}, 40, kvOutput{}, 50},
+	}
+	res, info := CheckOperationsVerbose(model, ops, 0)
+	if res != Ok {
+		t.Fatal("expected operations to be linearizable")
+	}
+	var data struct {
+		Partitions []struct {
+			History []map[string]interface{}
+		}
+	}
+	visualizeExtractData(t, model, info, &data)
+	history := data.Partitions[0].History
+	raw, ok := history[0]["Raw"].(map[string]interface{})
+	if !ok || raw["key"] != "x" || raw["value"] != "y" {
+		t.Fatalf("expected serialized operation, got %v", history[0]["Raw"])
+	}
+	if _, ok := history[1]["Raw"]; ok {
+		t.Fatalf("expected no serialized operation for get, got %v", history[1]["Raw"])
+	}
+
+	// too-long serialized operations are truncated to a string
+	d := computeVisualizationData(model, info, VisualizationOptions{MaxDescriptionLength: 30}).Partitions
+	var truncated string
+	err := json.Unmarshal(d[0].History[2].Raw, &truncated)
+	if err != nil {
+		t.Fatalf("expected truncated operation to be a JSON string: %v", err)
+	}
+	if truncated != `{"key":"x","value":"zzzzzzzzz…` {
+		t.Fatalf("unexpected truncated operation %q", truncated)
+	}
+	if string(d[0].History[0].Raw) != `{"key":"x","value":"y"}` {
+		t.Fatalf("expected short operation not to be truncated, got %s", d[0].History[0].Raw)
+	}
+}
+
+func TestVisualizationNondeterministic(t *testing.T) {
+	nm := ndRegisterModel
+	nm.DescribeStates = func(states []interface{}) string {
+		return fmt.Sprintf("one of %v", states)
+	}
+	model := nm.ToModel()
+	ops := []Operation{
+		{0, registerInput{false, 100}, 0, ndRegisterOutput{timedOut: true}, 5},
+		{1, registerInput{false, 200}, 10, ndRegisterOutput{timedOut: true}, 15},
+		{2, registerInput{true, 0}, 20, ndRegisterOutput{value: 100}, 30},
+	}
+	res, info := CheckOperationsVerbose(model, ops, 0)
+	if res != Ok {
+		t.Fatal("expected operations to be linearizable")
+	}
+	var data struct {
+		Partitions []struct {
+			PartialLinearizations [][]map[string]interface{}
+		}
+	}
+	visualizeExtractData(t, model, info, &data)
+	lin := data.Partitions[0].PartialLinearizations[0]
+	expected := []struct {
+		candidates float64
+		desc       string
+	}{
+		{2, "one of [0 100]"},
+		{3, "one of [0 200 100]"},
+		{1, "one of [100]"},
+	}
+	for i, step := range lin {
+		if step["Candidates"] != expected[i].candidates || step["StateDescription"] != expected[i].desc {
+			t.Fatalf("expected step %d to have %v candidates (%q), got %v", i, expected[i].candidates, expected[i].desc, step)
+		}
+	}
+
+	// deterministic models don't have candidate counts
+	_, info = CheckOperationsVerbose(registerModel, []Operation{{0, registerInput{false, 100}, 0, 0, 100}}, 0)
+	var deterministicData struct {
+		Partitions []struct {
+			PartialLinearizations [][]map[string]interface{}
+		}
+	}
+	visualizeExtractData(t, registerModel, info, &deterministicData)
+	step := deterministicData.Partitions[0].PartialLinearizations[0][0]
+	if _, ok := step["Candidates"]; ok {
+		t.Fatalf("expected no candidate count, got %v", step)
+	}
+}
+
+func TestVisualizationDefaultSelectedNothingLinearizable(t *testing.T) {
+	ops := []Operation{
+		{0, registerInput{true, 0}, 0, 100, 10},
+		{1, registerInput{true, 0}, 5, 200, 15},
+	}
+	res, info := CheckOperationsVerbose(registerModel, ops, 0)
+	if res != Illegal {
+		t.Fatalf("expected output %v, got output %v", Illegal, res)
+	}
+	data := computeVisualizationData(registerModel, info, VisualizationOptions{}).Partitions
+	if data[0].DefaultSelected != -1 || data[0].FirstIllegal != 0 {
+		t.Fatalf("expected nothing to be selected and first illegal to be 0, got %d and %d", data[0].DefaultSelected, data[0].FirstIllegal)
+	}
+}
+
+func TestVisualizationFirstIllegal(t *testing.T) {
+	// after put('100'), get() -> '0' and get() -> '100' can both be
+	// linearized next in real-time order, but only the former is legal
+	ops := []Operation{
+		{0, registerInput{false, 100}, 0, 0, 10},
+		{1, registerInput{true, 0}, 20, 100, 30},
+		{2, registerInput{true, 0}, 20, 0, 40},
+	}
+	res, info := CheckOperationsVerbose(registerModel, ops, 0)
+	if res != Illegal {
+		t.Fatalf("expected output %v, got output %v", Illegal, res)
+	}
+	var data struct {
+		Partitions []struct {
+			DefaultSelected int
+			FirstIllegal    int
+		}
+	}
+	visualizeExtractData(t, registerModel, info, &data)
+	partition := data.Partitions[0]
+	if partition.DefaultSelected != 0 || partition.FirstIllegal != 2 {
+		t.Fatalf("expected default selection 0 and first illegal 2, got %d and %d", partition.DefaultSelected, partition.FirstIllegal)
+	}
+}
+
+func TestVisualizationSummary(t *testing.T) {
+	ops := []Operation{
+		{0, kvInput{op: 1, key: "x", value: "y"}, 0, kvOutput{}, 10},
+		{1, kvInput{op: 0, key: "x"}, 20, kvOutput{"z"}, 30},
+		{0, kvInput{op: 1, key: "y", value: "a"}, 40, kvOutput{}, 50},
+		{1, kvInput{op: 0, key: "y"}, 60, kvOutput{"a"}, 70},
+		{2, kvInput{op: 0, key: "z"}, 0, kvOutput{""}, 70},
+	}
+	res, info := CheckOperationsVerbose(kvModel, ops, 0)
+	if res != Illegal {
+		t.Fatalf("expected output %v, got output %v", Illegal, res)
+	}
+	type summary struct {
+		Result               string
+		ResultComputed       bool
+		Operations           int
+		Partitions           int
+		LinearizedPartitions int
+		Duration             int64
+	}
+	var data struct {
+		Summary summary
+	}
+	visualizeExtractData(t, kvModel, info, &data)
+	expected := summary{
+		Result:               "Illegal",
+		ResultComputed:       true,
+		Operations:           5,
+		Partitions:           3,
+		LinearizedPartitions: 2,
+	}
+	if data.Summary != expected {
+		t.Fatalf("expected summary %+v, got %+v", expected, data.Summary)
+	}
+
+	// supplied result and duration
+	var supplied struct {
+		Summary summary
+	}
+	visualizeExtractDataWithOptions(t, kvModel, info, VisualizationOptions{Result: Unknown, CheckDuration: 1500 * time.Millisecond}, &supplied)
+	expected = summary{
+		Result:               "Unknown",
+		Operations:           5,
+		Partitions:           3,
+		LinearizedPartitions: 2,
+		Duration:             int64(1500 * time.Millisecond),
+	}
+	if supplied.Summary != expected {
+		t.Fatalf("expected summary %+v, got %+v", expected, supplied.Summary)
+	}
+
+	// fully linearizable
+	res, info = CheckOperationsVerbose(kvModel, ops[2:], 0)
+	if res != Ok {
+		t.Fatal("expected operations to be linearizable")
+	}
+	var ok struct {
+		Summary summary
+	}
+	visualizeExtractData(t, kvModel, info, &ok)
+	if ok.Summary.Result != "Ok" || !ok.Summary.ResultComputed || ok.Summary.LinearizedPartitions != 2 || ok.Summary.Partitions != 2 {
+		t.Fatalf("unexpected summary %+v", ok.Summary)
+	}
+}
+
+func TestVisualizationClients(t *testing.T) {
+	ops := []Operation{
+		{7, kvInput{op: 1, key: "x", value: "y"}, 0, kvOutput{}, 10},
+		{3, kvInput{op: 0, key: "x"}, 20, kvOutput{"y"}, 30},
+		{7, kvInput{op: 0, key: "x"}, 40, kvOutput{"y"}, 50},
+		{12, kvInput{op: 1, key: "y", value: "a"}, 0, kvOutput{}, 10},
+	}
+	res, info := CheckOperationsVerbose(kvModel, ops, 0)
+	if res != Ok {
+		t.Fatal("expected operations to be linearizable")
+	}
+	var data struct {
+		Partitions []struct {
+			History     []historyElement
+			Clients     []int
+			ClientIndex []int
+			ClientNames []string
+		}
+	}
+	visualizeExtractDataWithOptions(t, kvModel, info, VisualizationOptions{ClientNames: map[int]string{3: "reader", 12: "writer"}}, &data)
+	if len(data.Partitions) != 2 {
+		t.Fatalf("expected 2 partitions, got %d", len(data.Partitions))
+	}
+	x := data.Partitions[0]
+	if !reflect.DeepEqual(x.Clients, []int{3, 7}) || !reflect.DeepEqual(x.ClientNames, []string{"reader", ""}) {
+		t.Fatalf("unexpected clients %v (names %q)", x.Clients, x.ClientNames)
+	}
+	for i, elem := range x.History {
+		if x.Clients[x.ClientIndex[i]] != elem.ClientId {
+			t.Fatalf("client index of element %d is %d, but its client is %d", i, x.ClientIndex[i], elem.ClientId)
+		}
+	}
+	y := data.Partitions[1]
+	if !reflect.DeepEqual(y.Clients, []int{12}) || !reflect.DeepEqual(y.ClientIndex, []int{0}) || !reflect.DeepEqual(y.ClientNames, []string{"writer"}) {
+		t.Fatalf("unexpected clients %v (index %v, names %q)", y.Clients, y.ClientIndex, y.ClientNames)
+	}
+
+	// names are omitted if not provided
+	part := computeVisualizationData(kvModel, info, VisualizationOptions{}).Partitions[0]
+	if part.ClientNames != nil {
+		t.Fatalf("expected no client names, got %q", part.ClientNames)
+	}
+}
+
+func TestVisualizeDir(t *testing.T) {
+	ops := []Operation{
+		{0, kvInput{op: 1, key: "x", value: "y"}, 0, kvOutput{}, 10},
+		{1, kvInput{op: 0, key: "x"}, 20, kvOutput{"z"}, 30},
+		{0, kvInput{op: 1, key: "y", value: "a"}, 40, kvOutput{}, 50},
+		{1, kvInput{op: 0, key: "y"}, 60, kvOutput{"a"}, 70},
+	}
+	res, info := CheckOperationsVerbose(kvModel, ops, 0)
+	if res != Illegal {
+		t.Fatalf("expected output %v, got output %v", Illegal, res)
+	}
+	dir := filepath.Join(t.TempDir(), "vis")
+	err := VisualizeDir(kvModel, info, dir, VisualizationOptions{})
+	if err != nil {
+		t.Fatalf("visualization failed: %v", err)
+	}
+	index, err := os.ReadFile(filepath.Join(dir, "index.html"))
+	if err != nil {
+		t.Fatalf("failed to read index: %v", err)
+	}
+	match := visualizationDataRegexp.FindSubmatch(index)
+	if match == nil {
+		t.Fatalf("failed to find data in index")
+	}
+	var data struct {
+		Summary    visualizationSummary
+		Partitions []interface{}
+		Shards     []visualizationShard
+	}
+	err = json.Unmarshal(match[1], &data)
+	if err != nil {
+		t.Fatalf("failed to unmarshal index data: %v", err)
+	}
+	expectedShards := []visualizationShard{
+		{File: "data/partition-0.js", Operations: 2, Linearized: false},
+		{File: "data/partition-1.js", Operations: 2, Linearized: true},
+	}
+	if !reflect.DeepEqual(expectedShards, data.Shards) {
+		t.Fatalf("expected shards %v, got %v", expectedShards, data.Shards)
+	}
+	if len(data.Partitions) != 0 || data.Summary.Operations != 4 {
+		t.Fatalf("expected index to only contain the summary, got %v and %+v", data.Partitions, data.Summary)
+	}
+
+	expected := computeVisualizationData(kvModel, info, VisualizationOptions{}).Partitions
+	for i, shard := range data.Shards {
+		contents, err := os.ReadFile(filepath.Join(dir, filepath.FromSlash(shard.File)))
+		if err != nil {
+			t.Fatalf("failed to read shard: %v", err)
+		}
+		s := strings.TrimSuffix(strings.TrimPrefix(string(contents), "loadShard("), ")\n")
+		var partition partitionVisualizationData
+		err = json.Unmarshal([]byte(s), &partition)
+		if err != nil {
+			t.Fatalf("failed to unmarshal shard %d: %v", i, err)
+		}
+		if !reflect.DeepEqual(expected[i], partition) {
+			t.Fatalf("expected shard %d to be %v, got %v", i, expected[i], partition)
+		}
+	}
+
+	// writing again produces the same output
+	err = VisualizeDir(kvModel, info, dir, VisualizationOptions{})
+	if err != nil {
+		t.Fatalf("visualization failed: %v", err)
+	}
+	again, err := os.ReadFile(filepath.Join(dir, "index.html"))
+	if err != nil {
+		t.Fatalf("failed to read index: %v", err)
+	}
+	if !bytes.Equal(index, again) {
+		t.Fatal("expected index to be deterministic")
+	}
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatalf("failed to read directory: %v", err)
+	}
+	if len(entries) != 2 {
+		t.Fatalf("expected only index and data directory, got %v", entries)
+	}
+
+	err = VisualizeDir(kvModel, info, dir, VisualizationOptions{Compress: true})
+	if err == nil {
+		t.Fatal("expected compression to be unsupported")
+	}
+}
+
+func TestVisualizationTimeUnit(t *testing.T) {
+	ops := []Operation{
+		{0, registerInput{false, 100}, 0, 0, 1500},
+		{1, registerInput{true, 0}, 2000, 100, 2500},
+	}
+	res, info := CheckOperationsVerbose(registerModel, ops, 0)
+	if res != Ok {
+		t.Fatal("expected operations to be linearizable")
+	}
+	var data struct {
+		TimeUnit string
+	}
+	visualizeExtractDataWithOptions(t, registerModel, info, VisualizationOptions{TimeUnit: Microseconds}, &data)
+	if data.TimeUnit != "µs" {
+		t.Fatalf("expected time unit to be recorded, got %q", data.TimeUnit)
+	}
+	var unspecified map[string]interface{}
+	visualizeExtractData(t, registerModel, info, &unspecified)
+	if _, ok := unspecified["TimeUnit"]; ok {
+		t.Fatalf("expected no time unit, got %v", unspecified["TimeUnit"])
+	}
+
+	tests := []struct {
+		unit     TimeUnit
+		expected string
+	}{
+		{"", "call: 0, return: 1500"},
+		{Logical, "call: 0, return: 1500"},
+		{Nanoseconds, "call: 0ns, return: 1500ns, lasted 1.5µs"},
+		{Microseconds, "call: 0µs, return: 1500µs, lasted 1.5ms"},
+		{Milliseconds, "call: 0ms, return: 1500ms, lasted 1.5s"},
+		{Seconds, "call: 0s, return: 1500s, lasted 25m0s"},
+	}
+	for _, test := range tests {
+		if desc := test.unit.describeTimes(0, 1500); desc != test.expected {
+			t.Fatalf("expected %q for unit %q, got %q", test.expected, test.unit, desc)
+		}
+	}
+}
+
+func TestVisualizationRewriteDescription(t *testing.T) {
+	ops := []Operation{
+		{0, kvInput{op: 1, key: "x", value: "y"}, 0, kvOutput{}, 10},
+		{1, kvInput{op: 0, key: "x"}, 20, kvOutput{"y"}, 30},
+	}
+	res, info := CheckOperationsVerbose(kvModel, ops, 0)
+	if res != Ok {
+		t.Fatal("expected operations to be linearizable")
+	}
+	names := map[int]string{0: "alice"}
+	rewrite := func(elem HistoryElementInfo) string {
+		name, ok := names[elem.ClientId]
+		if !ok {
+			return ""
+		}
+		if elem.Input.(kvInput).key != "x" || elem.Start != 0 || elem.End != 10 {
+			t.Errorf("unexpected element %+v", elem)
+		}
+		return name + ": " + elem.Description
+	}
+	var data struct {
+		Partitions []struct {
+			History []historyElement
+		}
+	}
+	visualizeExtractDataWithOptions(t, kvModel, info, VisualizationOptions{RewriteDescription: rewrite}, &data)
+	history := data.Partitions[0].History
+	if history[0].Description != "alice: put('x', 'y')" || history[0].OriginalDescription != "" {
+		t.Fatalf("unexpected description %q (original %q)", history[0].Description, history[0].OriginalDescription)
+	}
+	// an empty result keeps the original description
+	if history[1].Description != "get('x') -> 'y'" {
+		t.Fatalf("unexpected description %q", history[1].Description)
+	}
+
+	var kept struct {
+		Partitions []struct {
+			History []historyElement
+		}
+	}
+	visualizeExtractDataWithOptions(t, kvModel, info, VisualizationOptions{RewriteDescription: rewrite, KeepOriginalDescriptions: true}, &kept)
+	history = kept.Partitions[0].History
+	if history[0].Description != "alice: put('x', 'y')" || history[0].OriginalDescription != "put('x', 'y')" {
+		t.Fatalf("unexpected description %q (original %q)", history[0].Description, history[0].OriginalDescription)
+	}
+	if history[1].OriginalDescription != "" {
+		t.Fatalf("expected no original description for unchanged description, got %q", history[1].OriginalDescription)
+	}
+}
@@ -0,0 +1,435 @@
+package porcupine
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"io"
+	"math/bits"
+	"reflect"
+)
+
+// The checker's cache holds, for each partition, the states that the search
+// reached, along with the operations that were linearized to reach each one.
+// Every entry that isn't on the path of the search when it stops is a dead
+// end: the search explored everything that can follow it. The dead ends of a
+// partition can seed the cache of a later check of the same partition, which
+// then skips them.
+//
+// A saved cache starts with a header, cacheMagic followed by the format
+// version as a uvarint and the encoded initial state of the model, and then
+// holds the dead ends of each partition:
+//
+//	uint64  fingerprint of the partition's history, little-endian
+//	uvarint number of entries in the partition's history
+//	uvarint number of states
+//	for each state:
+//	        length-prefixed encoded state
+//	uvarint number of dead ends
+//	for each dead end:
+//	        uvarint for each word of the bitset of linearized operations
+//	        uvarint index of its state
+//
+// Dead ends are only valid for the same model and the same history, so a
+// cache is used for a partition only if the fingerprint of its history and
+// the initial state of the model match, and entries that can't be decoded are
+// dropped. Dropping entries can make a check slower, but never changes its
+// result.
+const (
+	cacheMagic   = "PCPNCACH"
+	cacheVersion = 1
+)
+
+// A StateCodec serializes the states of a model, to save the checker's cache
+// with [LinearizationInfo.SaveCache] and load it with
+// [CheckOptions.WarmCache]. Decode(Encode(state)) must return a state that is
+// equal to state, according to the model.
+//
+// The zero StateCodec encodes states with encoding/json, tagged with the name
+// of their type, which must be registered with [RegisterType].
+type StateCodec struct {
+	Encode func(state interface{}) ([]byte, error)
+	Decode func(data []byte) (interface{}, error)
+}
+
+func (c StateCodec) encode(state interface{}) ([]byte, error) {
+	if c.Encode != nil {
+		return c.Encode(state)
+	}
+	tv, err := encodeValue(state)
+	if err != nil {
+		return nil, err
+	}
+	return json.Marshal(tv)
+}
+
+func (c StateCodec) decode(data []byte) (interface{}, error) {
+	if c.Decode != nil {
+		return c.Decode(data)
+	}
+	var tv *typedValue
+	if err := json.Unmarshal(data, &tv); err != nil {
+		return nil, err
+	}
+	return decodeValue(tv)
+}
+
+// A persistedCache carries the dead ends of one partition into and out of
+// checkSingle: warm seeds its cache, and if record is set, checkSingle sets
+// dead to the dead ends of its search when it returns.
+type persistedCache struct {
+	warm   []cacheEntry
+	record bool
+	dead   []cacheEntry
+}
+
+// deadEntries returns copies of the entries of the cache that aren't on the
+// path of the search: the states that calls led to, the last of which is
+// state.
+func deadEntries(c *stateCache, calls []callsEntry, state interface{}) []cacheEntry {
+	position := make(map[uint]int, len(calls))
+	for i, call := range calls {
+		position[uint(call.entry.id)] = i
+	}
+	// onPath returns whether the entry is the state after the first k
+	// calls, where k is the number of operations it linearized
+	onPath := func(e cacheEntry) bool {
+		k := int(e.linearized.popcnt())
+		if k == 0 || k > len(calls) {
+			return false
+		}
+		for i, word := range e.linearized {
+			for ; word != 0; word &= word - 1 {
+				id := uint(i*64 + bits.TrailingZeros64(word))
+				if p, ok := position[id]; !ok || p >= k {
+					return false
+				}
+			}
+		}
+		pathState := state
+		if k < len(calls) {
+			pathState = calls[k].state
+		}
+		_, fast := c.hashState(0, e.state)
+		return c.equal(e.state, pathState, fast)
+	}
+	var dead []cacheEntry
+	for _, e := range c.all() {
+		if !onPath(e) {
+			dead = append(dead, e)
+		}
+	}
+	return dead
+}
+
+// A recordedCache holds the dead ends of each partition of a check, for
+// [LinearizationInfo.SaveCache].
+type recordedCache struct {
+	codec StateCodec
+	init  interface{}
+	dead  [][]cacheEntry
+}
+
+// SaveCache writes the checker's cache to w, so that a later check of the
+// same history, or of a history with some of the same partitions, can start
+// from it with [CheckOptions.WarmCache]. It requires the check to have been
+// run with [CheckOptions.RecordCache], and the states to be serializable with
+// [CheckOptions.CacheCodec]. Partitions whose inputs and outputs can't be
+// fingerprinted (see [CheckOptions.WarmCache]) are left out.
+func (li LinearizationInfo) SaveCache(w io.Writer) error {
+	if li.cache == nil {
+		return errors.New("porcupine: the check did not record its cache (see CheckOptions.RecordCache)")
+	}
+	codec := li.cache.codec
+	init, err := codec.encode(li.cache.init)
+	if err != nil {
+		return fmt.Errorf("porcupine: encoding the initial state: %w", err)
+	}
+	bw := bufio.NewWriter(w)
+	e := binaryEncoder{w: bw}
+	e.writeBytes([]byte(cacheMagic))
+	e.writeUvarint(cacheVersion)
+	e.writeString(init)
+	for i, dead := range li.cache.dead {
+		fingerprint, ok := fingerprintHistory(li.history[i])
+		if !ok {
+			continue
+		}
+		// many dead ends share a state, so each state is encoded
+		// once, in a table that the dead ends refer to
+		var states [][]byte
+		indices := make([]int, len(dead))
+		index := make(map[string]int)
+		for j, entry := range dead {
+			state, err := codec.encode(entry.state)
+			if err != nil {
+				return fmt.Errorf("porcupine: encoding a state of partition %d: %w", i, err)
+			}
+			k, ok := index[string(state)]
+			if !ok {
+				k = len(states)
+				index[string(state)] = k
+				states = append(states, state)
+			}
+			indices[j] = k
+		}
+		var fp [8]byte
+		binary.LittleEndian.PutUint64(fp[:], fingerprint)
+		e.writeBytes(fp[:])
+		e.writeUvarint(uint64(len(li.history[i])))
+		e.writeUvarint(uint64(len(states)))
+		for _, state := range states {
+			e.writeString(state)
+		}
+		e.writeUvarint(uint64(len(dead)))
+		for j, entry := range dead {
+			for _, word := range entry.linearized {
+				e.writeUvarint(word)
+			}
+			e.writeUvarint(uint64(indices[j]))
+		}
+		if e.err != nil {
+			return e.err
+		}
+	}
+	if e.err != nil {
+		return e.err
+	}
+	return bw.Flush()
+}
+
+// A warmCache holds the dead ends read from a saved cache, before their
+// states are decoded, by the fingerprint of their partition's history.
+type warmCache struct {
+	codec      StateCodec
+	partitions map[uint64][]savedPartition
+}
+
+type savedPartition struct {
+	entries int      // number of entries in the history
+	states  [][]byte // encoded states
+	dead    []savedEntry
+}
+
+type savedEntry struct {
+	linearized bitset
+	state      uint64 // index in states
+}
+
+// readCache reads a cache saved by SaveCache. It returns the partitions that
+// it read completely, if any, and nil if the cache is for a model with a
+// different initial state.
+func readCache(r io.Reader, codec StateCodec, model Model) *warmCache {
+	data, err := io.ReadAll(r)
+	if err != nil || !bytes.HasPrefix(data, []byte(cacheMagic)) {
+		return nil
+	}
+	cr := cacheReader{data: data[len(cacheMagic):]}
+	if cr.uvarint() != cacheVersion {
+		return nil
+	}
+	savedInit := cr.bytes()
+	if init, err := codec.encode(model.Init()); cr.err != nil || err != nil || !bytes.Equal(init, savedInit) {
+		return nil
+	}
+	warm := &warmCache{codec: codec, partitions: make(map[uint64][]savedPartition)}
+	for len(cr.data) >= 8 {
+		fingerprint := binary.LittleEndian.Uint64(cr.data)
+		cr.data = cr.data[8:]
+		p := cr.partition()
+		if cr.err != nil {
+			break
+		}
+		warm.partitions[fingerprint] = append(warm.partitions[fingerprint], p)
+	}
+	return warm
+}
+
+// A cacheReader parses a saved cache, until the first error.
+type cacheReader struct {
+	data []byte
+	err  error
+}
+
+var errCacheTruncated = errors.New("porcupine: saved cache is truncated")
+
+func (cr *cacheReader) uvarint() uint64 {
+	if cr.err != nil {
+		return 0
+	}
+	x, n := binary.Uvarint(cr.data)
+	if n <= 0 {
+		cr.err = errCacheTruncated
+		return 0
+	}
+	cr.data = cr.data[n:]
+	return x
+}
+
+func (cr *cacheReader) bytes() []byte {
+	n := cr.uvarint()
+	if cr.err != nil {
+		return nil
+	}
+	if n > uint64(len(cr.data)) {
+		cr.err = errCacheTruncated
+		return nil
+	}
+	b := cr.data[:n:n]
+	cr.data = cr.data[n:]
+	return b
+}
+
+func (cr *cacheReader) partition() savedPartition {
+	var p savedPartition
+	entries := cr.uvarint()
+	if entries > 2*maxPartitionOperations {
+		cr.err = fmt.Errorf("porcupine: length %d is too large", entries)
+		return p
+	}
+	p.entries = int(entries)
+	states := cr.uvarint()
+	if states > uint64(len(cr.data)) {
+		cr.err = errCacheTruncated
+		return p
+	}
+	p.states = make([][]byte, states)
+	for i := range p.states {
+		p.states[i] = cr.bytes()
+	}
+	// every word of a dead end takes at least a byte, so larger counts
+	// are malformed, and would make huge allocations
+	count := cr.uvarint()
+	words := len(newBitset(uint(entries / 2)))
+	if count > uint64(len(cr.data)) || count > 0 && uint64(words) > uint64(len(cr.data))/count {
+		cr.err = errCacheTruncated
+		return p
+	}
+	p.dead = make([]savedEntry, count)
+	for i := range p.dead {
+		linearized := make(bitset, words)
+		for j := range linearized {
+			linearized[j] = cr.uvarint()
+		}
+		p.dead[i] = savedEntry{linearized, cr.uvarint()}
+		if cr.err != nil {
+			return p
+		}
+	}
+	return p
+}
+
+// entries returns the dead ends saved for a partition with the given history,
+// dropping the ones that are invalid for it.
+func (w *warmCache) entries(history []entry) []cacheEntry {
+	fingerprint, ok := fingerprintHistory(history)
+	if !ok {
+		return nil
+	}
+	n := uint(len(history) / 2)
+	var result []cacheEntry
+	for _, p := range w.partitions[fingerprint] {
+		if p.entries != len(history) {
+			continue
+		}
+		states := make([]interface{}, len(p.states))
+		decoded := make([]bool, len(p.states))
+		for i, data := range p.states {
+			state, err := w.codec.decode(data)
+			states[i], decoded[i] = state, err == nil
+		}
+		for _, e := range p.dead {
+			if !validBitset(e.linearized, n) || e.state >= uint64(len(states)) || !decoded[e.state] {
+				continue
+			}
+			result = append(result, cacheEntry{e.linearized, states[e.state]})
+		}
+	}
+	return result
+}
+
+// validBitset returns whether b is a bitset of n operations, with at least
+// one of them set, as in every entry of the cache.
+func validBitset(b bitset, n uint) bool {
+	if len(b) != len(newBitset(n)) || b.popcnt() == 0 {
+		return false
+	}
+	if n%64 != 0 && b[len(b)-1]>>(n%64) != 0 {
+		return false
+	}
+	return true
+}
+
+var (
+	goStringerType = reflect.TypeOf((*fmt.GoStringer)(nil)).Elem()
+	formatterType  = reflect.TypeOf((*fmt.Formatter)(nil)).Elem()
+)
+
+// fingerprintHistory returns a hash of the entries of a partition, and
+// whether all of its values could be hashed by their contents. Values are
+// hashed with their Go syntax representation if their types hold no
+// pointers, and with their registered encoding (see [RegisterType])
+// otherwise; other values can't be hashed, since two different values could
+// look the same.
+func fingerprintHistory(history []entry) (uint64, bool) {
+	h := fnv.New64a()
+	var buf [binary.MaxVarintLen64]byte
+	writeVarint := func(x int64) {
+		n := binary.PutVarint(buf[:], x)
+		h.Write(buf[:n])
+	}
+	for _, e := range history {
+		if e.kind == callEntry {
+			writeVarint(0)
+		} else {
+			writeVarint(1)
+		}
+		writeVarint(int64(e.id))
+		writeVarint(e.time)
+		writeVarint(int64(e.clientId))
+		var value []byte
+		switch {
+		case e.value == nil:
+			value = []byte("nil")
+		case plainType(reflect.TypeOf(e.value)):
+			value = []byte(fmt.Sprintf("%T %#v", e.value, e.value))
+		default:
+			tv, err := encodeValue(e.value)
+			if err != nil {
+				return 0, false
+			}
+			value = append([]byte(tv.Type+" "), tv.Value...)
+		}
+		writeVarint(int64(len(value)))
+		h.Write(value)
+	}
+	return h.Sum64(), true
+}
+
+// plainType returns whether values of a type are made of nothing but their
+// contents, without pointers or custom formatting, so that formatting them
+// shows all of them.
+func plainType(t reflect.Type) bool {
+	if t.Implements(goStringerType) || t.Implements(formatterType) {
+		return false
+	}
+	switch t.Kind() {
+	case reflect.Ptr, reflect.UnsafePointer, reflect.Interface, reflect.Chan, reflect.Func:
+		return false
+	case reflect.Array, reflect.Slice:
+		return plainType(t.Elem())
+	case reflect.Map:
+		return plainType(t.Key()) && plainType(t.Elem())
+	case reflect.Struct:
+		for i := 0; i < t.NumField(); i++ {
+			if !plainType(t.Field(i).Type) {
+				return false
+			}
+		}
+	}
+	return true
+}
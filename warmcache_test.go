@@ -0,0 +1,208 @@
+package porcupine
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"testing"
+)
+
+func init() {
+	RegisterType("string", "")
+}
+
+type warmCacheHistory struct {
+	name   string
+	model  Model
+	events []Event
+}
+
+func warmCacheHistories() []warmCacheHistory {
+	var histories []warmCacheHistory
+	for i := 0; i < 10; i++ {
+		filename := fmt.Sprintf("test_data/jepsen/etcd_%03d.log", i)
+		if _, err := os.Stat(filename); err != nil {
+			continue
+		}
+		histories = append(histories, warmCacheHistory{filename, etcdModel, parseJepsenLog(filename)})
+	}
+	for _, log := range []string{"c01-ok", "c01-bad", "c10-ok", "c10-bad"} {
+		filename := fmt.Sprintf("test_data/kv/%s.txt", log)
+		histories = append(histories, warmCacheHistory{filename, kvModel, parseKvLog(filename)})
+	}
+	return histories
+}
+
+// checkWithCache checks a history, warming the cache from warm if it's not
+// nil, and returns the result, the saved cache, and the steps and warm states
+// of all partitions.
+func checkWithCache(t *testing.T, model Model, events []Event, warm []byte) (CheckResult, []byte, int, int) {
+	t.Helper()
+	opts := CheckOptions{RecordCache: true}
+	if warm != nil {
+		opts.WarmCache = bytes.NewReader(warm)
+	}
+	res, info := CheckEventsWithOptions(model, events, opts)
+	var buf bytes.Buffer
+	if err := info.SaveCache(&buf); err != nil {
+		t.Fatal(err)
+	}
+	steps, warmStates := 0, 0
+	for _, p := range info.Partitions() {
+		steps += p.Steps
+		warmStates += p.WarmStates
+	}
+	return res, buf.Bytes(), steps, warmStates
+}
+
+func TestWarmCache(t *testing.T) {
+	for _, h := range warmCacheHistories() {
+		cold, cache, coldSteps, _ := checkWithCache(t, h.model, h.events, nil)
+		warm, _, warmSteps, warmStates := checkWithCache(t, h.model, h.events, cache)
+		if warm != cold {
+			t.Fatalf("%s: warm check says %s, cold check says %s", h.name, warm, cold)
+		}
+		if warmSteps > coldSteps {
+			t.Fatalf("%s: warm check took %d steps, cold check took %d", h.name, warmSteps, coldSteps)
+		}
+		if cold == Illegal && warmStates == 0 {
+			t.Fatalf("%s: expected the dead ends of an illegal history to warm the cache", h.name)
+		}
+	}
+}
+
+func TestWarmCacheMismatch(t *testing.T) {
+	histories := warmCacheHistories()
+	results := make([]CheckResult, len(histories))
+	caches := make([][]byte, len(histories))
+	for i, h := range histories {
+		results[i], caches[i], _, _ = checkWithCache(t, h.model, h.events, nil)
+	}
+	for i, h := range histories {
+		// the cache of the next history with the same model
+		for j := i + 1; j < len(histories); j++ {
+			if fmt.Sprintf("%T", histories[j].model.Init()) != fmt.Sprintf("%T", h.model.Init()) {
+				continue
+			}
+			if res, _, _, _ := checkWithCache(t, h.model, h.events, caches[j]); res != results[i] {
+				t.Fatalf("%s with the cache of %s: got %s, expected %s", h.name, histories[j].name, res, results[i])
+			}
+			break
+		}
+		// a cache that was cut short or corrupted only loses entries
+		cache := caches[i]
+		for _, corrupt := range [][]byte{cache[:len(cache)/2], flipByte(cache, len(cache)/3), flipByte(cache, 10)} {
+			if res, _, _, _ := checkWithCache(t, h.model, h.events, corrupt); res != results[i] {
+				t.Fatalf("%s with a corrupted cache: got %s, expected %s", h.name, res, results[i])
+			}
+		}
+	}
+}
+
+func flipByte(b []byte, i int) []byte {
+	c := append([]byte(nil), b...)
+	c[i] ^= 0xff
+	return c
+}
+
+func TestWarmCacheStale(t *testing.T) {
+	// the same history with one read returning a different value is a
+	// different history, whose partitions don't match the cache
+	events := parseJepsenLog("test_data/jepsen/etcd_000.log")
+	_, cache, _, _ := checkWithCache(t, etcdModel, events, nil)
+	changed := append([]Event(nil), events...)
+	for i := len(changed) - 1; i >= 0; i-- {
+		if out, ok := changed[i].Value.(etcdOutput); ok && changed[i].Kind == ReturnEvent && out.exists {
+			out.value++
+			changed[i].Value = out
+			break
+		}
+	}
+	expected, _, _, _ := checkWithCache(t, etcdModel, changed, nil)
+	res, _, _, warmStates := checkWithCache(t, etcdModel, changed, cache)
+	if res != expected {
+		t.Fatalf("got %s, expected %s", res, expected)
+	}
+	if warmStates != 0 {
+		t.Fatalf("expected the cache not to match the changed history, but %d states warmed it", warmStates)
+	}
+
+	// a model with a different initial state doesn't use the cache
+	model := etcdModel
+	model.Init = func() interface{} { return 0 }
+	if _, _, _, warmStates := checkWithCache(t, model, events, cache); warmStates != 0 {
+		t.Fatalf("expected the cache not to match a different model, but %d states warmed it", warmStates)
+	}
+}
+
+func TestWarmCacheCodec(t *testing.T) {
+	encoded := 0
+	codec := StateCodec{
+		Encode: func(state interface{}) ([]byte, error) {
+			encoded++
+			return []byte(state.(string)), nil
+		},
+		Decode: func(data []byte) (interface{}, error) {
+			return string(data), nil
+		},
+	}
+	events := parseKvLog("test_data/kv/c10-bad.txt")
+	res, info := CheckEventsWithOptions(kvModel, events, CheckOptions{RecordCache: true, CacheCodec: codec})
+	var buf bytes.Buffer
+	if err := info.SaveCache(&buf); err != nil {
+		t.Fatal(err)
+	}
+	if encoded == 0 {
+		t.Fatal("expected the codec to encode the states")
+	}
+	warm, info := CheckEventsWithOptions(kvModel, events, CheckOptions{WarmCache: &buf, CacheCodec: codec})
+	if warm != res {
+		t.Fatalf("warm check says %s, cold check says %s", warm, res)
+	}
+	warmStates := 0
+	for _, p := range info.Partitions() {
+		warmStates += p.WarmStates
+	}
+	if warmStates == 0 {
+		t.Fatal("expected the cache to warm the check")
+	}
+}
+
+func TestSaveCacheRequiresRecordCache(t *testing.T) {
+	_, info := CheckEventsVerbose(kvModel, parseKvLog("test_data/kv/c01-ok.txt"), 0)
+	if err := info.SaveCache(&bytes.Buffer{}); err == nil {
+		t.Fatal("expected an error without RecordCache")
+	}
+}
+
+// BenchmarkWarmCache compares checking a history from scratch with checking
+// it again from the cache saved by a previous check, including reading the
+// cache, as when a workload is replayed.
+func BenchmarkWarmCache(b *testing.B) {
+	var histories []warmCacheHistory
+	for _, i := range []int{0, 2, 7} {
+		filename := fmt.Sprintf("test_data/jepsen/etcd_%03d.log", i)
+		histories = append(histories, warmCacheHistory{fmt.Sprintf("etcd_%03d", i), etcdModel, parseJepsenLog(filename)})
+	}
+	histories = append(histories,
+		warmCacheHistory{"kv_c10_bad", kvModel, parseKvLog("test_data/kv/c10-bad.txt")},
+		warmCacheHistory{"kv_c50", kvModel, parseKvLog("test_data/kv/c50-ok.txt")})
+	for _, h := range histories {
+		_, info := CheckEventsWithOptions(h.model, h.events, CheckOptions{RecordCache: true})
+		var cache bytes.Buffer
+		if err := info.SaveCache(&cache); err != nil {
+			b.Fatal(err)
+		}
+		b.Run(h.name+"/cold", func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				CheckEventsWithOptions(h.model, h.events, CheckOptions{})
+			}
+		})
+		b.Run(h.name+"/warm", func(b *testing.B) {
+			b.SetBytes(int64(cache.Len()))
+			for i := 0; i < b.N; i++ {
+				CheckEventsWithOptions(h.model, h.events, CheckOptions{WarmCache: bytes.NewReader(cache.Bytes())})
+			}
+		})
+	}
+}